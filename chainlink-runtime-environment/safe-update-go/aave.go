@@ -0,0 +1,80 @@
+//go:build wasip1
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/blockchain/evm"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+)
+
+// Withdraw(address indexed reserve, address indexed user, address indexed to, uint256 amount),
+// emitted by the Aave V2 and V3 pools
+var aaveWithdrawSignature = crypto.Keccak256Hash([]byte("Withdraw(address,address,address,uint256)"))
+
+// Repay(address indexed reserve, address indexed user, address indexed repayer, uint256 amount),
+// emitted by the Aave V2 pool; V3 adds a bool useATokens after the amount
+var (
+	aaveRepayV2Signature = crypto.Keccak256Hash([]byte("Repay(address,address,address,uint256)"))
+	aaveRepayV3Signature = crypto.Keccak256Hash([]byte("Repay(address,address,address,uint256,bool)"))
+)
+
+// aaveFullAmount is the amount, type(uint256).max, that Aave reads as the
+// whole aToken balance on withdraw and the whole debt on repay
+var aaveFullAmount = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1))
+
+// ResolveAaveFullAmount settles a withdrawal of the whole balance or a
+// repayment of the whole debt from the pool's Withdraw or Repay event, which
+// carries the amount actually moved. Other actions already carry their amount
+// and are left as decoded.
+func ResolveAaveFullAmount(runtime cre.Runtime, evmClient *evm.Client, logger *slog.Logger, action *Action, calldata []byte, txHash []byte) error {
+	var asset *AssetAmount
+	var signatures [][]byte
+	switch {
+	case action.Verb == VerbWithdraw && len(action.AssetsIn) == 1:
+		asset = &action.AssetsIn[0]
+		signatures = [][]byte{aaveWithdrawSignature.Bytes()}
+	case action.Verb == VerbRepay && len(action.AssetsOut) == 1:
+		asset = &action.AssetsOut[0]
+		signatures = [][]byte{aaveRepayV2Signature.Bytes(), aaveRepayV3Signature.Bytes()}
+	}
+	if asset == nil || asset.Amount.Cmp(aaveFullAmount) != 0 {
+		return nil
+	}
+
+	reply, err := evmClient.GetTransactionReceipt(runtime, &evm.GetTransactionReceiptRequest{Hash: txHash}).Await()
+	if err != nil {
+		return fmt.Errorf("failed to get transaction receipt: %w", err)
+	}
+	if reply.Receipt == nil {
+		return fmt.Errorf("transaction receipt not found")
+	}
+
+	for _, log := range reply.Receipt.Logs {
+		if common.BytesToAddress(log.Address) != action.Counterparty || len(log.Topics) != 4 || len(log.Data) < 32 ||
+			!matchesTopic(log.Topics[0], signatures) || common.BytesToAddress(log.Topics[1]) != asset.Token {
+			continue
+		}
+		asset.Amount = new(big.Int).SetBytes(log.Data[:32])
+		logger.Info("Aave full amount", "verb", string(action.Verb), "token", asset.Token.Hex(), "amount", asset.Amount.String())
+		return nil
+	}
+
+	return fmt.Errorf("no Aave %s of %s in receipt for a full amount", action.Verb, asset.Token.Hex())
+}
+
+// matchesTopic reports whether a topic is one of the event signatures
+func matchesTopic(topic []byte, signatures [][]byte) bool {
+	for _, signature := range signatures {
+		if bytes.Equal(topic, signature) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,284 @@
+//go:build wasip1
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/blockchain/evm"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+
+	"safe-update-go/fixedpoint"
+)
+
+// AssetDelta represents the signed change of one token caused by an action.
+// Positive values flow into the Safe, negative values leave it; borrowed and
+// repaid debt counts the other way round.
+type AssetDelta struct {
+	Token      common.Address
+	Symbol     string
+	Amount     *big.Int
+	Decimals   uint8
+	USDValue   *big.Int
+	FixedPrice string
+	Group      string
+	CachedAt   time.Time
+	Unpriced   bool
+}
+
+// ActionAccounting represents the USD accounting of an action
+type ActionAccounting struct {
+	Deltas []AssetDelta
+	NetUSD *big.Int
+}
+
+// findTokenConfig returns the configuration of a token, or nil if it is not configured
+func findTokenConfig(config *Config, token common.Address) *TokenConfig {
+	for i := range config.Tokens {
+		if config.Tokens[i].Address.Address == token {
+			return &config.Tokens[i]
+		}
+	}
+	return nil
+}
+
+// findTokenBySymbol returns the configuration of the token with a symbol, or
+// nil if it is not configured
+func findTokenBySymbol(config *Config, symbol string) *TokenConfig {
+	for i := range config.Tokens {
+		if config.Tokens[i].Symbol == symbol {
+			return &config.Tokens[i]
+		}
+	}
+	return nil
+}
+
+// AccountAction values every asset moved by an action in USD (18 decimals)
+// and aggregates them into a signed net delta for the Safe. Borrowed amounts
+// count against the Safe and repaid amounts for it. Assets may be valued from
+// the price cache while their feed is down, within the cache's limits.
+func AccountAction(config *Config, runtime cre.Runtime, evmClient *evm.Client, logger *slog.Logger, action *Action) (*ActionAccounting, error) {
+	accounting := &ActionAccounting{NetUSD: new(big.Int)}
+
+	if err := ResolveVaultAssets(config, runtime, evmClient, logger, action); err != nil {
+		return nil, err
+	}
+
+	for _, asset := range action.AssetsIn {
+		delta, err := valueAsset(config, runtime, evmClient, logger, asset, 1, true)
+		if err != nil {
+			return nil, err
+		}
+		accounting.Deltas = append(accounting.Deltas, *delta)
+	}
+
+	for _, asset := range action.AssetsOut {
+		delta, err := valueAsset(config, runtime, evmClient, logger, asset, -1, true)
+		if err != nil {
+			return nil, err
+		}
+		accounting.Deltas = append(accounting.Deltas, *delta)
+	}
+
+	for _, delta := range accounting.Deltas {
+		accounting.NetUSD.Add(accounting.NetUSD, delta.USDValue)
+	}
+
+	if config.PriceCache != nil {
+		if err := CheckCachedValuation(config.PriceCache, state.CachedValuations, action, accounting, runtime.Now()); err != nil {
+			return nil, err
+		}
+	}
+
+	return accounting, nil
+}
+
+// valueAsset prices one asset movement and returns its signed delta. Live
+// prices refresh the price cache; with useCache, a token whose feed cannot be
+// read or is stale is valued from the cache when it holds a recent enough
+// price.
+func valueAsset(config *Config, runtime cre.Runtime, evmClient *evm.Client, logger *slog.Logger, asset AssetAmount, sign int64, useCache bool) (*AssetDelta, error) {
+	// Native ETH is configured under one placeholder, whichever one the protocol uses
+	if isNativeToken(asset.Token) {
+		asset.Token = nativeToken
+	}
+	tokenConfig := findTokenConfig(config, asset.Token)
+	if tokenConfig == nil {
+		return nil, fmt.Errorf("token %s not in config", asset.Token.Hex())
+	}
+
+	var tokenDecimals uint8 = nativeDecimals
+	var err error
+	if !tokenConfig.IsNative() {
+		tokenDecimals, err = GetTokenDecimals(runtime, evmClient, asset.Token)
+	}
+	if err != nil {
+		RaiseAlert(config, runtime, slog.LevelError, "ALERT: pricing failed", tokenConfig.Symbol, "symbol", tokenConfig.Symbol, "error", err.Error())
+		return nil, err
+	}
+
+	logger.Info("Token decimals", "symbol", tokenConfig.Symbol, "decimals", tokenDecimals)
+
+	// Token-native modules are updated in token units, so a token without a
+	// usable price is estimated at zero USD and the action held for review
+	var price *big.Int
+	var priceDecimals uint8
+	var cachedAt time.Time
+	unpriced := false
+	if config.TokenNative != nil && !tokenConfig.HasPriceSource() {
+		price, unpriced = new(big.Int), true
+	} else if price, priceDecimals, err = config.priceSource()(config, runtime, evmClient, logger, tokenConfig); err == nil {
+		// Fixed prices never fail for want of a feed, an expired one must not be cached
+		if !tokenConfig.HasFixedPrice() {
+			state.CachePrice(config.PriceCache, tokenConfig.Symbol, price, priceDecimals, runtime.Now())
+		}
+	} else if cached := state.CachedPriceOf(config.PriceCache, tokenConfig.Symbol, runtime.Now()); useCache && cacheFallback(err) && cached != nil && !tokenConfig.HasFixedPrice() {
+		RaiseAlert(config, runtime, slog.LevelWarn, "ALERT: valued from cached price", tokenConfig.Symbol, "symbol", tokenConfig.Symbol,
+			"price", cached.Price.String(), "cachedAt", cached.CachedAt.UTC().Format(time.RFC3339), "error", err.Error())
+		price, priceDecimals, cachedAt = cached.Price, cached.Decimals, cached.CachedAt
+	} else if config.TokenNative == nil {
+		return nil, err
+	} else {
+		logger.Warn("Token not priced, estimated at zero USD", "symbol", tokenConfig.Symbol, "error", err.Error())
+		price, unpriced = new(big.Int), true
+	}
+
+	usdValue := CalculateUSDValue(asset.Amount, tokenDecimals, price, priceDecimals)
+	amount := new(big.Int).Set(asset.Amount)
+	if asset.Debt {
+		sign = -sign
+	}
+	if sign < 0 {
+		usdValue.Neg(usdValue)
+		amount.Neg(amount)
+	}
+
+	return &AssetDelta{
+		Token:      asset.Token,
+		Symbol:     tokenConfig.Symbol,
+		Amount:     amount,
+		Decimals:   tokenDecimals,
+		USDValue:   usdValue,
+		FixedPrice: tokenConfig.FixedPriceUSD,
+		Group:      tokenConfig.Group,
+		CachedAt:   cachedAt,
+		Unpriced:   unpriced,
+	}, nil
+}
+
+// PriceSource returns the USD price of a token and the decimals of the price.
+// Only errors wrapping ErrFeedUnavailable or ErrStalePrice fall back to the
+// price cache.
+type PriceSource func(config *Config, runtime cre.Runtime, evmClient *evm.Client, logger *slog.Logger, tokenConfig *TokenConfig) (*big.Int, uint8, error)
+
+// DefaultPriceSource prices tokens from their configured feeds, fixed and pegged prices
+var DefaultPriceSource PriceSource = tokenPrice
+
+// priceSource returns how the workflow built from the config prices tokens
+func (c *Config) priceSource() PriceSource {
+	if c.pricing != nil {
+		return c.pricing
+	}
+	return tokenPrice
+}
+
+// tokenPrice returns the USD price of a token and its decimals: the answer of
+// its price feed, or its fixed price. The answer of a feed quoted in another
+// token is converted with that token's USD price, and a token pegged to
+// another one is valued at that token's USD price. Quote tokens are priced by
+// the config's price source.
+func tokenPrice(config *Config, runtime cre.Runtime, evmClient *evm.Client, logger *slog.Logger, tokenConfig *TokenConfig) (*big.Int, uint8, error) {
+	// Get price from Chainlink, or the fixed price of tokens without a feed
+	var priceData *PriceData
+	var err error
+	if tokenConfig.HasFixedPrice() {
+		priceData, err = FixedPriceData(tokenConfig, runtime.Now())
+		if err != nil {
+			RaiseAlert(config, runtime, slog.LevelError, "ALERT: fixed price expired", tokenConfig.Symbol, "symbol", tokenConfig.Symbol, "error", err.Error())
+			return nil, 0, err
+		}
+		logger.Info("Fixed price", "symbol", tokenConfig.Symbol, "price", tokenConfig.FixedPriceUSD, "reviewBy", tokenConfig.FixedPriceReviewBy)
+	} else if tokenConfig.HasPeggedPrice() {
+		priceData = PeggedPriceData(runtime.Now())
+		logger.Info("Pegged price", "symbol", tokenConfig.Symbol, "quote", tokenConfig.PriceFeedQuote)
+	} else {
+		priceData, err = GetPriceFromFeed(runtime, evmClient, tokenConfig.PriceFeedAddress.Address)
+		if err != nil {
+			RaiseAlert(config, runtime, slog.LevelError, "ALERT: pricing failed", tokenConfig.Symbol, "symbol", tokenConfig.Symbol, "error", err.Error())
+			return nil, 0, fmt.Errorf("%w for %s: %w", ErrFeedUnavailable, tokenConfig.Symbol, err)
+		}
+
+		logger.Info("Price data", "symbol", tokenConfig.Symbol, "price", priceData.Answer.String(), "decimals", priceData.Decimals)
+		state.RecordFeedUpdate(tokenConfig.Symbol, priceData.UpdatedAt)
+
+		if err := CheckPriceAge(config.Policy, tokenConfig, priceData, runtime.Now()); err != nil {
+			RaiseAlert(config, runtime, slog.LevelError, "ALERT: stale price", tokenConfig.Symbol, "symbol", tokenConfig.Symbol, "error", err.Error())
+			return nil, 0, err
+		}
+	}
+
+	price, err := ApplyNegativePricePolicy(tokenConfig, priceData.Answer)
+	if err != nil {
+		RaiseAlert(config, runtime, slog.LevelError, "ALERT: negative price", tokenConfig.Symbol, "symbol", tokenConfig.Symbol, "price", priceData.Answer.String())
+		return nil, 0, err
+	}
+	if tokenConfig.PriceFeedQuote == "" {
+		return price, priceData.Decimals, nil
+	}
+
+	quoteConfig := findTokenBySymbol(config, tokenConfig.PriceFeedQuote)
+	if quoteConfig == nil {
+		return nil, 0, fmt.Errorf("quote token %s of %s not in config", tokenConfig.PriceFeedQuote, tokenConfig.Symbol)
+	}
+	quotePrice, quoteDecimals, err := config.priceSource()(config, runtime, evmClient, logger, quoteConfig)
+	if err != nil {
+		return nil, 0, err
+	}
+	usdPrice := fixedpoint.MulDiv(price, quotePrice, fixedpoint.Pow10(int(priceData.Decimals)), fixedpoint.RoundDown)
+	logger.Info("Quoted price", "symbol", tokenConfig.Symbol, "quote", quoteConfig.Symbol, "price", usdPrice.String(), "decimals", quoteDecimals)
+	return usdPrice, quoteDecimals, nil
+}
+
+// GrossUSD returns the total absolute USD value moved by the action
+func (a *ActionAccounting) GrossUSD() *big.Int {
+	gross := new(big.Int)
+	for _, delta := range a.Deltas {
+		gross.Add(gross, new(big.Int).Abs(delta.USDValue))
+	}
+	return gross
+}
+
+// Tokens returns the comma separated token addresses of the deltas
+func (a *ActionAccounting) Tokens() string {
+	tokens := make([]string, len(a.Deltas))
+	for i, delta := range a.Deltas {
+		tokens[i] = delta.Token.Hex()
+	}
+	return strings.Join(tokens, ",")
+}
+
+// FixedPrices returns the comma separated symbol=price of the deltas valued at
+// a fixed price, or "" when every delta was valued from a feed
+func (a *ActionAccounting) FixedPrices() string {
+	var prices []string
+	for _, delta := range a.Deltas {
+		if delta.FixedPrice != "" {
+			prices = append(prices, delta.Symbol+"="+delta.FixedPrice)
+		}
+	}
+	return strings.Join(prices, ",")
+}
+
+// Amounts returns the comma separated signed token amounts of the deltas
+func (a *ActionAccounting) Amounts() string {
+	amounts := make([]string, len(a.Deltas))
+	for i, delta := range a.Deltas {
+		amounts[i] = delta.Amount.String()
+	}
+	return strings.Join(amounts, ",")
+}
@@ -0,0 +1,292 @@
+//go:build wasip1
+
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/blockchain/evm"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+)
+
+// Verb represents what a protocol action does to the Safe's positions
+type Verb string
+
+const (
+	VerbWithdraw Verb = "withdraw"
+	VerbDeposit  Verb = "deposit"
+	VerbBorrow   Verb = "borrow"
+	VerbRepay    Verb = "repay"
+	VerbSwap     Verb = "swap"
+	VerbBridge   Verb = "bridge"
+	VerbClaim    Verb = "claim"
+	VerbAdjust   Verb = "adjust"
+	VerbTransfer Verb = "transfer"
+)
+
+// creditingVerbs are the verbs whose net inflow credits allowances: they
+// return funds to the Safe. Other verbs never credit, whatever the receipt shows.
+var creditingVerbs = map[Verb]bool{
+	VerbWithdraw: true,
+	VerbRepay:    true,
+	VerbSwap:     true,
+	VerbClaim:    true,
+}
+
+// AssetAmount represents an amount of a token moved by an action. When Vault
+// is set, Token is an ERC-4626 vault resolved to its underlying asset before
+// valuation, and Shares tells whether Amount is in vault shares. CToken does
+// the same for Compound v2 cTokens. When Curve is set, Token is a Curve pool
+// and the asset is its coin at index Coin, settled from the receipt. Debt
+// marks borrowed (in) or repaid (out) amounts, valued with the opposite sign
+// because they change what the Safe owes.
+type AssetAmount struct {
+	Token  common.Address
+	Amount *big.Int
+	Vault  bool
+	CToken bool
+	Shares bool
+	Curve  bool
+	Coin   uint64
+	Debt   bool
+}
+
+// Action represents a decoded protocol call. AssetsIn flow into the Safe,
+// AssetsOut leave it. Counterparty is the protocol contract that was called.
+// Confidence records how the assets were established; actions flagged
+// NeedsReview are held until an operator approves them. Value and Operation
+// record how the Safe executed the call, and Avatar is that Safe, set before
+// receipt resolvers run. Order is set by calls that sign or cancel an order
+// settled later by a third party, and GMXWithdrawal by GMX v2 withdrawal
+// orders executed later by a keeper. Pool is set by resolvers of protocols
+// whose forks are told apart by the factory of the pool. DestinationRecipient
+// is the address a bridge pays on the destination chain. SettledFromReceipt
+// is set when the assets were read from the events of the whole receipt.
+type Action struct {
+	Protocol     string
+	Verb         Verb
+	AssetsIn     []AssetAmount
+	AssetsOut    []AssetAmount
+	Counterparty common.Address
+	Recipient    common.Address
+	Selector     string
+	Confidence   Confidence
+	NeedsReview  bool
+	ReviewReason string
+	Value        *big.Int
+	Operation    Operation
+	Avatar       common.Address
+	Order        *PendingOrder
+	Pool         common.Address
+
+	GMXWithdrawal        *PendingGMXWithdrawal
+	DestinationRecipient common.Address
+	SettledFromReceipt   bool
+}
+
+// Credits reports whether a net inflow of the action credits allowances
+func (a *Action) Credits() bool {
+	return creditingVerbs[a.Verb]
+}
+
+// DebtReview reports whether an action moves debt, which is held for review.
+// The module only takes credits, so a borrow is never debited; crediting the
+// repayment on its own would let borrow and repay cycles raise allowances.
+func DebtReview(action *Action) (bool, string) {
+	for _, asset := range append(append([]AssetAmount{}, action.AssetsIn...), action.AssetsOut...) {
+		if asset.Debt {
+			return true, "debt moved by the action cannot be debited by the module"
+		}
+	}
+	return false, ""
+}
+
+// ActionDecoder decodes protocol calldata sent to target into an Action
+type ActionDecoder func(logger *slog.Logger, target common.Address, calldata []byte) (*Action, error)
+
+// ReceiptResolver settles the amounts of a decoded action from its
+// transaction receipt, for protocols whose calldata does not carry them. It
+// receives the protocol calldata the action was decoded from.
+type ReceiptResolver func(runtime cre.Runtime, evmClient *evm.Client, logger *slog.Logger, action *Action, calldata []byte, txHash []byte) error
+
+// ErrUnknownSelector is returned when no decoder is registered for a selector
+var ErrUnknownSelector = fmt.Errorf("not a recognized protocol function")
+
+// DecoderSet represents the decoders of function selectors, keyed by hex
+// selector without 0x, with the canonical signature and parameter shapes
+// they were written for, and the receipt resolvers of protocols
+type DecoderSet struct {
+	decoders   map[string]ActionDecoder
+	signatures map[string]string
+	shapes     map[string][]*abiShape
+	resolvers  map[string]ReceiptResolver
+}
+
+// NewDecoderSet creates an empty decoder set
+func NewDecoderSet() *DecoderSet {
+	return &DecoderSet{
+		decoders:   make(map[string]ActionDecoder),
+		signatures: make(map[string]string),
+		shapes:     make(map[string][]*abiShape),
+		resolvers:  make(map[string]ReceiptResolver),
+	}
+}
+
+// registeredDecoders holds the decoders and resolvers the protocol files register
+var registeredDecoders = NewDecoderSet()
+
+// RegisterReceiptResolver registers the receipt resolver of a protocol
+func RegisterReceiptResolver(protocol string, resolver ReceiptResolver) {
+	if err := registeredDecoders.AddResolver(protocol, resolver); err != nil {
+		panic(err.Error())
+	}
+}
+
+// RegisterDecoder registers the decoder of a function selector. The canonical
+// signature, such as withdraw(address,uint256,address), must hash to the
+// selector; calldata is checked against its parameters before it is decoded.
+func RegisterDecoder(selector string, signature string, decoder ActionDecoder) {
+	if err := registeredDecoders.AddDecoder(selector, signature, decoder); err != nil {
+		panic(err.Error())
+	}
+}
+
+// Clone returns a copy of the set that decoders can be added to
+func (d *DecoderSet) Clone() *DecoderSet {
+	clone := NewDecoderSet()
+	for selector, decoder := range d.decoders {
+		clone.decoders[selector] = decoder
+		clone.signatures[selector] = d.signatures[selector]
+		clone.shapes[selector] = d.shapes[selector]
+	}
+	for protocol, resolver := range d.resolvers {
+		clone.resolvers[protocol] = resolver
+	}
+	return clone
+}
+
+// AddResolver adds the receipt resolver of a protocol
+func (d *DecoderSet) AddResolver(protocol string, resolver ReceiptResolver) error {
+	if protocol == "" {
+		return fmt.Errorf("receipt resolver without a protocol")
+	}
+	if _, exists := d.resolvers[protocol]; exists {
+		return fmt.Errorf("receipt resolver already registered for %s", protocol)
+	}
+	d.resolvers[protocol] = resolver
+	return nil
+}
+
+// AddDecoder adds the decoder of a function selector after checking its signature
+func (d *DecoderSet) AddDecoder(selector string, signature string, decoder ActionDecoder) error {
+	if _, exists := d.decoders[selector]; exists {
+		return fmt.Errorf("decoder already registered for selector 0x%s", selector)
+	}
+	if id := hex.EncodeToString(crypto.Keccak256([]byte(signature))[:4]); id != selector {
+		return fmt.Errorf("signature %s has selector 0x%s, not 0x%s", signature, id, selector)
+	}
+	shapes, err := parseSignatureShapes(signature)
+	if err != nil {
+		return err
+	}
+	d.decoders[selector] = decoder
+	d.signatures[selector] = signature
+	d.shapes[selector] = shapes
+	return nil
+}
+
+// Resolver returns the receipt resolver of a protocol, if any
+func (d *DecoderSet) Resolver(protocol string) (ReceiptResolver, bool) {
+	resolver, ok := d.resolvers[protocol]
+	return resolver, ok
+}
+
+// DecodeAction decodes calldata with the registered decoders
+func DecodeAction(logger *slog.Logger, target common.Address, calldata []byte) (*Action, error) {
+	return registeredDecoders.DecodeAction(logger, target, calldata)
+}
+
+// DecodeAction identifies the protocol function in calldata and decodes it into an Action
+func (d *DecoderSet) DecodeAction(logger *slog.Logger, target common.Address, calldata []byte) (*Action, error) {
+	if len(calldata) < 4 {
+		return nil, fmt.Errorf("transaction data too short")
+	}
+
+	// Get function selector (first 4 bytes)
+	selector := hex.EncodeToString(calldata[:4])
+	logger.Info("Transaction selector", "selector", "0x"+selector)
+
+	decoder, ok := d.decoders[selector]
+	if !ok {
+		logger.Info("Unknown function selector", "selector", "0x"+selector)
+		return nil, ErrUnknownSelector
+	}
+
+	// A colliding selector of an unrelated function rarely encodes the same shapes
+	shapeErr := d.CheckCalldataShape(selector, calldata)
+
+	action, err := decoder(logger, target, calldata)
+	if err != nil {
+		return nil, err
+	}
+
+	action.Counterparty = target
+	action.Selector = selector
+	action.Confidence = ConfidenceExactABI
+	if shapeErr != nil {
+		logger.Warn("Calldata does not match the decoded function, downgrading confidence", "selector", "0x"+selector,
+			"signature", d.signatures[selector], "error", shapeErr.Error())
+		action.Confidence = ConfidenceHeuristic
+	}
+	return action, nil
+}
+
+// calldataWord returns the i-th 32 byte argument word after the selector
+func calldataWord(calldata []byte, i int) ([]byte, error) {
+	start := 4 + i*32
+	if len(calldata) < start+32 {
+		return nil, fmt.Errorf("calldata too short for argument %d", i)
+	}
+	return calldata[start : start+32], nil
+}
+
+// calldataAddress decodes the i-th argument as an address
+func calldataAddress(calldata []byte, i int) (common.Address, error) {
+	word, err := calldataWord(calldata, i)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return common.BytesToAddress(word[12:]), nil
+}
+
+// calldataUint decodes the i-th argument as an unsigned integer
+func calldataUint(calldata []byte, i int) (*big.Int, error) {
+	word, err := calldataWord(calldata, i)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(word), nil
+}
+
+// calldataBytes decodes the i-th argument as dynamic bytes
+func calldataBytes(calldata []byte, i int) ([]byte, error) {
+	word, err := calldataWord(calldata, i)
+	if err != nil {
+		return nil, err
+	}
+	offset := new(big.Int).SetBytes(word)
+	if !offset.IsInt64() || offset.Int64() > int64(len(calldata)-4-32) {
+		return nil, fmt.Errorf("argument %d offset out of bounds", i)
+	}
+	start := 4 + int(offset.Int64())
+	length := new(big.Int).SetBytes(calldata[start : start+32])
+	if !length.IsInt64() || length.Int64() > int64(len(calldata)-start-32) {
+		return nil, fmt.Errorf("argument %d length out of bounds", i)
+	}
+	return calldata[start+32 : start+32+int(length.Int64())], nil
+}
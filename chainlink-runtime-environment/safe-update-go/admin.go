@@ -0,0 +1,81 @@
+//go:build wasip1
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/networking/http"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+)
+
+// AdminConfig represents the keys allowed to call the admin API
+type AdminConfig struct {
+	AuthorizedKeys []string `json:"authorizedKeys"`
+}
+
+// AdminRequest represents an admin API call sent as HTTP trigger input
+type AdminRequest struct {
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+// AdminMethod handles one admin API method for the key that signed the
+// request and returns its JSON encodable result
+type AdminMethod func(config *Config, runtime cre.Runtime, caller common.Address, params json.RawMessage) (interface{}, error)
+
+// adminMethods maps a method name to its handler
+var adminMethods = make(map[string]AdminMethod)
+
+// RegisterAdminMethod registers the handler of an admin API method
+func RegisterAdminMethod(name string, method AdminMethod) {
+	if _, exists := adminMethods[name]; exists {
+		panic(fmt.Sprintf("admin method %s already registered", name))
+	}
+	adminMethods[name] = method
+}
+
+// authorizedHTTPTrigger creates an HTTP trigger accepting requests signed by the given EVM keys
+func authorizedHTTPTrigger(keys []string) cre.Trigger[*http.Payload, *http.Payload] {
+	authorized := make([]*http.AuthorizedKey, len(keys))
+	for i, key := range keys {
+		authorized[i] = &http.AuthorizedKey{Type: http.KeyType_KEY_TYPE_ECDSA_EVM, PublicKey: key}
+	}
+	return http.Trigger(&http.Config{AuthorizedKeys: authorized})
+}
+
+// OnAdminRequest is the handler for admin API calls. The result is returned
+// JSON encoded in the execution result message.
+func OnAdminRequest(config *Config, runtime cre.Runtime, payload *http.Payload) (*ExecutionResult, error) {
+	logger := runtime.Logger()
+
+	if payload.Key == nil || !common.IsHexAddress(payload.Key.PublicKey) {
+		return nil, fmt.Errorf("admin request without an EVM signing key")
+	}
+	caller := common.HexToAddress(payload.Key.PublicKey)
+
+	var request AdminRequest
+	if err := json.Unmarshal(payload.Input, &request); err != nil {
+		return nil, fmt.Errorf("failed to decode admin request: %w", err)
+	}
+	logger.Info("Admin request", "method", request.Method, "caller", caller.Hex())
+
+	method, ok := adminMethods[request.Method]
+	if !ok {
+		return nil, fmt.Errorf("unknown admin method %q", request.Method)
+	}
+
+	result, err := method(config, runtime, caller, request.Params)
+	if err != nil {
+		return nil, fmt.Errorf("admin method %s: %w", request.Method, err)
+	}
+
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode admin result: %w", err)
+	}
+
+	return &ExecutionResult{Message: string(encoded), Success: true}, nil
+}
@@ -0,0 +1,116 @@
+//go:build wasip1
+
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/blockchain/evm"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+)
+
+// adminEvents are the module events that change allowances or the
+// configuration of subaccounts
+var adminEvents = []struct {
+	Name      string
+	Signature common.Hash
+}{
+	{"SubaccountAllowancesUpdated", allowancesUpdatedSignature},
+	{"SubAccountLimitsSet", crypto.Keccak256Hash([]byte("SubAccountLimitsSet(address,uint256,uint256,uint256,uint256)"))},
+	{"AllowedAddressesSet", crypto.Keccak256Hash([]byte("AllowedAddressesSet(address,address[],bool,uint256)"))},
+	{"RoleAssigned", crypto.Keccak256Hash([]byte("RoleAssigned(address,uint16,uint256)"))},
+	{"RoleRevoked", crypto.Keccak256Hash([]byte("RoleRevoked(address,uint16,uint256)"))},
+	{"AuthorizedUpdaterChanged", crypto.Keccak256Hash([]byte("AuthorizedUpdaterChanged(address,address)"))},
+	{"TokenPriceFeedSet", crypto.Keccak256Hash([]byte("TokenPriceFeedSet(address,address)"))},
+	{"TokenPriceFeedRemoved", crypto.Keccak256Hash([]byte("TokenPriceFeedRemoved(address)"))},
+}
+
+// AdminAlertsConfig represents the alerts for allowance and subaccount
+// configuration changes made on the module by anyone but the workflow. The
+// workflow's own writes are the transactions it submitted, and any
+// transaction sent to the forwarder, so writes of other shards and instances
+// are recognized when forwarderAddress is set.
+type AdminAlertsConfig struct {
+	Page bool `json:"page,omitempty"`
+}
+
+// adminEventName returns the name of a module admin event from its signature
+func adminEventName(topic []byte) (string, bool) {
+	for _, event := range adminEvents {
+		if bytes.Equal(topic, event.Signature.Bytes()) {
+			return event.Name, true
+		}
+	}
+	return "", false
+}
+
+// OnAdminEvent is the handler for the module's allowance and subaccount
+// configuration events. Changes the workflow did not make raise an alert, or
+// page with page, naming the contract the change was sent through, such as
+// the owner Safe.
+func OnAdminEvent(config *Config, runtime cre.Runtime, payload *evm.Log) (*ExecutionResult, error) {
+	logger := runtime.Logger()
+
+	if len(payload.Topics) < 1 {
+		return nil, fmt.Errorf("invalid admin log format")
+	}
+	module := common.BytesToAddress(payload.Address)
+	target, err := config.TargetForModule(module.Hex())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownEmitter, err.Error())
+	}
+	event, ok := adminEventName(payload.Topics[0])
+	if !ok {
+		return nil, fmt.Errorf("unknown admin event %x", payload.Topics[0])
+	}
+
+	txHash := "0x" + hex.EncodeToString(payload.TxHash)
+	if state.IsOwnUpdate(txHash) {
+		return &ExecutionResult{Message: "Own admin change", Success: true}, nil
+	}
+	tx, err := newEVMClient(config).GetTransactionByHash(runtime, &evm.GetTransactionByHashRequest{Hash: payload.TxHash}).Await()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transaction: %w", err)
+	}
+	// A change whose transaction cannot be read is not known to be the forwarder's, so it is alerted
+	via := "unknown"
+	if tx.Transaction != nil {
+		to := common.BytesToAddress(tx.Transaction.To)
+		if target.ForwarderAddress.IsSet() && to == target.ForwarderAddress.Address {
+			return &ExecutionResult{Message: "Admin change through the forwarder", Success: true}, nil
+		}
+		via = to.Hex()
+	}
+
+	args := []any{"module", module.Hex(), "event", event, "txHash", txHash, "via", via}
+	if len(payload.Topics) > 1 {
+		args = append(args, "subject", common.BytesToAddress(payload.Topics[1]).Hex())
+	}
+	level, message := slog.LevelWarn, "ALERT: third-party admin action"
+	if config.AdminAlerts.Page {
+		level, message = slog.LevelError, "PAGE: third-party admin action"
+	}
+	RaiseAlert(config, runtime, level, message, module.Hex()+":"+event, args...)
+	logger.Info("Third-party admin action", args...)
+
+	return &ExecutionResult{Message: fmt.Sprintf("Third-party %s on %s", event, module.Hex()), Success: true}, nil
+}
+
+// adminEventsTrigger creates the log trigger of the admin events of the modules
+func adminEventsTrigger(config *Config, addresses [][]byte) cre.Trigger[*evm.Log, *evm.Log] {
+	signatures := make([][]byte, 0, len(adminEvents))
+	for _, event := range adminEvents {
+		signatures = append(signatures, event.Signature.Bytes())
+	}
+	return evm.LogTrigger(config.ChainSelector.Uint64(), &evm.FilterLogTriggerRequest{
+		Addresses: addresses,
+		Topics: []*evm.TopicValues{
+			{Values: signatures},
+		},
+	})
+}
@@ -0,0 +1,172 @@
+//go:build wasip1
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+)
+
+// AlertConfig represents how repeated alerts are grouped, when they are
+// suppressed and where they are delivered
+type AlertConfig struct {
+	GroupWindowSeconds uint64             `json:"groupWindowSeconds,omitempty"`
+	Suppressions       []AlertSuppression `json:"suppressions,omitempty"`
+	BusinessHours      *BusinessHours     `json:"businessHours,omitempty"`
+	Routes             []AlertRoute       `json:"routes,omitempty"`
+}
+
+// AlertSuppression silences alerts starting with a prefix during a maintenance window.
+// An empty prefix matches every alert.
+type AlertSuppression struct {
+	Prefix string `json:"prefix,omitempty"`
+	Start  string `json:"start"`
+	End    string `json:"end"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// AlertGroup represents identical alerts raised within one group window, with
+// the transactions of the alerts it counted
+type AlertGroup struct {
+	Message  string
+	Level    slog.Level
+	Key      string
+	First    time.Time
+	Last     time.Time
+	Count    int
+	TxHashes []string
+}
+
+// ValidateAlerts checks the alert configuration
+func ValidateAlerts(alerts *AlertConfig) error {
+	if alerts == nil {
+		return nil
+	}
+	for i, suppression := range alerts.Suppressions {
+		start, err := time.Parse(time.RFC3339, suppression.Start)
+		if err != nil {
+			return fmt.Errorf("suppression %d: invalid start: %w", i, err)
+		}
+		end, err := time.Parse(time.RFC3339, suppression.End)
+		if err != nil {
+			return fmt.Errorf("suppression %d: invalid end: %w", i, err)
+		}
+		if !end.After(start) {
+			return fmt.Errorf("suppression %d: end must be after start", i)
+		}
+	}
+	return validateRoutes(alerts)
+}
+
+// groupWindow returns how long identical alerts are grouped, zero when
+// grouping is not configured
+func groupWindow(alerts *AlertConfig) time.Duration {
+	if alerts == nil {
+		return 0
+	}
+	return seconds(alerts.GroupWindowSeconds)
+}
+
+// alertTxHash returns the txHash argument of an alert, if any
+func alertTxHash(args []any) string {
+	for i := 0; i+1 < len(args); i += 2 {
+		if name, ok := args[i].(string); ok && name == "txHash" {
+			return fmt.Sprint(args[i+1])
+		}
+	}
+	return ""
+}
+
+// activeSuppression returns the suppression window covering an alert, if any
+func activeSuppression(alerts *AlertConfig, message string, now time.Time) (AlertSuppression, bool) {
+	if alerts == nil {
+		return AlertSuppression{}, false
+	}
+	for _, suppression := range alerts.Suppressions {
+		start, err := time.Parse(time.RFC3339, suppression.Start)
+		if err != nil {
+			continue
+		}
+		end, err := time.Parse(time.RFC3339, suppression.End)
+		if err != nil {
+			continue
+		}
+		if strings.HasPrefix(message, suppression.Prefix) && !now.Before(start) && now.Before(end) {
+			return suppression, true
+		}
+	}
+	return AlertSuppression{}, false
+}
+
+// RaiseAlert logs an ALERT or PAGE message unless it is suppressed. With a
+// group window configured, alerts with the same message and key are
+// identical: the first one of a window is logged, the others are counted with
+// their txHash and reported once as a grouped alert when the window closes.
+func RaiseAlert(config *Config, runtime cre.Runtime, level slog.Level, message string, key string, args ...any) {
+	logger := runtime.Logger()
+	now := runtime.Now()
+
+	if suppression, ok := activeSuppression(config.Alerts, message, now); ok {
+		logger.Info("Alert suppressed", "alert", message, "key", key, "reason", suppression.Reason, "until", suppression.End)
+		return
+	}
+
+	if window := groupWindow(config.Alerts); window > 0 {
+		id := message + "|" + key
+		txHash := alertTxHash(args)
+		if group, ok := state.AlertGroups[id]; ok {
+			if now.Sub(group.First) < window {
+				group.Count++
+				group.Last = now
+				if txHash != "" {
+					group.TxHashes = append(group.TxHashes, txHash)
+				}
+				return
+			}
+			emitGroupedAlert(config, runtime, group)
+		}
+
+		group := &AlertGroup{Message: message, Level: level, Key: key, First: now, Last: now, Count: 1}
+		if txHash != "" {
+			group.TxHashes = []string{txHash}
+		}
+		state.AlertGroups[id] = group
+	}
+
+	logger.Log(context.Background(), level, message, args...)
+	RouteAlert(config, runtime, newAlert(level, message, key, now, args...))
+}
+
+// FlushAlertGroups reports the groups whose window has closed
+func FlushAlertGroups(config *Config, runtime cre.Runtime) {
+	now := runtime.Now()
+	window := groupWindow(config.Alerts)
+	if window == 0 {
+		return
+	}
+	for id, group := range state.AlertGroups {
+		if now.Sub(group.First) < window {
+			continue
+		}
+		emitGroupedAlert(config, runtime, group)
+		delete(state.AlertGroups, id)
+	}
+}
+
+// emitGroupedAlert logs and routes one alert for the occurrences of a group
+func emitGroupedAlert(config *Config, runtime cre.Runtime, group *AlertGroup) {
+	if group.Count <= 1 {
+		return
+	}
+	args := []any{"key", group.Key, "occurrences", group.Count, "first", group.First.Unix(), "last", group.Last.Unix()}
+	if len(group.TxHashes) > 0 {
+		args = append(args, "txHashes", strings.Join(group.TxHashes, ","))
+	}
+	runtime.Logger().Log(context.Background(), group.Level, group.Message+" (grouped)", args...)
+	RouteAlert(config, runtime, newAlert(group.Level, group.Message+" (grouped)", group.Key, runtime.Now(), args...))
+}
@@ -0,0 +1,127 @@
+//go:build wasip1
+
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/blockchain/evm"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+)
+
+// SubaccountAllowancesUpdated(address indexed subAccount, uint256 balanceChange, uint256 newApprovedAllowance, uint256 timestamp)
+var allowancesUpdatedSignature = crypto.Keccak256Hash([]byte("SubaccountAllowancesUpdated(address,uint256,uint256,uint256)"))
+
+// moduleProtocol is the protocol name of ledger entries for allowance
+// updates the workflow did not submit
+const moduleProtocol = "module"
+
+// AllowanceEventsConfig represents the merge of the module's
+// SubaccountAllowancesUpdated events into the ledger. Only the module's
+// authorized updater can update allowances. Updates the workflow submitted
+// itself are already in the ledger as the actions they credit; updates sent
+// by another holder of the role, such as an admin who took it over to adjust
+// a subaccount by hand, are recorded as adjustments of their balance change.
+type AllowanceEventsConfig struct {
+	AlertOnExternal bool `json:"alertOnExternal,omitempty"`
+}
+
+// RecordOwnUpdate remembers the transaction of an allowance update the
+// workflow submitted, so its event is not merged a second time
+func (s *WorkflowState) RecordOwnUpdate(txHash string, at time.Time) {
+	for k, submittedAt := range s.OwnUpdates {
+		if at.Sub(submittedAt) > processedRetention {
+			delete(s.OwnUpdates, k)
+		}
+	}
+	s.OwnUpdates[strings.ToLower(txHash)] = at
+}
+
+// IsOwnUpdate reports whether the workflow submitted an allowance update transaction
+func (s *WorkflowState) IsOwnUpdate(txHash string) bool {
+	_, ok := s.OwnUpdates[strings.ToLower(txHash)]
+	return ok
+}
+
+// OnAllowancesUpdated is the handler for the module's SubaccountAllowancesUpdated
+// events. Updates the workflow did not submit are recorded in the ledger with
+// their balance change as net value, and no gross value, so they count in the
+// subaccount's net flows without consuming exposure limits.
+func OnAllowancesUpdated(config *Config, runtime cre.Runtime, payload *evm.Log) (*ExecutionResult, error) {
+	logger := runtime.Logger()
+
+	if len(payload.Topics) < 2 || len(payload.Data) < 96 {
+		return nil, fmt.Errorf("invalid allowance update log format")
+	}
+	module := common.BytesToAddress(payload.Address)
+	target, err := config.TargetForModule(module.Hex())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownEmitter, err.Error())
+	}
+	subAccount := common.BytesToAddress(payload.Topics[1])
+	if !OwnsSubaccount(config, subAccount) {
+		return &ExecutionResult{Message: "Subaccount not in shard", Success: true}, nil
+	}
+
+	txHash := "0x" + hex.EncodeToString(payload.TxHash)
+	if state.IsOwnUpdate(txHash) {
+		logger.Info("Own allowance update", "subAccount", subAccount.Hex(), "txHash", txHash)
+		return &ExecutionResult{Message: "Own allowance update", Success: true}, nil
+	}
+	eventID := eventKey(txHash, payload.Index)
+	if state.HasProcessed(eventID) {
+		return &ExecutionResult{Message: "Duplicate event", Success: true}, nil
+	}
+
+	balanceChange := new(big.Int).SetBytes(payload.Data[:32])
+	approved := new(big.Int).SetBytes(payload.Data[32:64])
+	at := time.Unix(new(big.Int).SetBytes(payload.Data[64:96]).Int64(), 0)
+
+	args := []any{"module", module.Hex(), "subAccount", subAccount.Hex(), "txHash", txHash,
+		"balanceChange", FormatUSD(config, balanceChange), "approvedInWindow", FormatUSD(config, approved)}
+	if config.AllowanceEvents.AlertOnExternal {
+		RaiseAlert(config, runtime, slog.LevelWarn, "ALERT: external allowance update", subAccount.Hex(), args...)
+	} else {
+		logger.Info("External allowance update", args...)
+	}
+
+	// Only USD balance changes can be merged into the USD ledger
+	if balanceChangeUnit(target) != UnitUSD || config.TokenNative != nil {
+		state.MarkProcessed(eventID, runtime.Now())
+		return &ExecutionResult{Message: "External allowance update not in USD, left out of the ledger", Success: true}, nil
+	}
+
+	state.RecordLedgerEntry(LedgerEntry{
+		TxHash:     txHash,
+		SubAccount: subAccount.Hex(),
+		Protocol:   moduleProtocol,
+		Verb:       VerbAdjust,
+		GrossUSD:   new(big.Int),
+		NetUSD:     balanceChange,
+		At:         at,
+	})
+	state.MarkProcessed(eventID, runtime.Now())
+
+	return &ExecutionResult{
+		Message: fmt.Sprintf("External allowance update of %s for %s merged into the ledger", FormatUSD(config, balanceChange), subAccount.Hex()),
+		Success: true,
+	}, nil
+}
+
+// allowancesUpdatedTrigger creates the log trigger of the allowance updates of the modules
+func allowancesUpdatedTrigger(config *Config, addresses [][]byte, subAccounts [][]byte) cre.Trigger[*evm.Log, *evm.Log] {
+	return evm.LogTrigger(config.ChainSelector.Uint64(), &evm.FilterLogTriggerRequest{
+		Addresses: addresses,
+		Topics: []*evm.TopicValues{
+			{Values: [][]byte{allowancesUpdatedSignature.Bytes()}},
+			{Values: subAccounts}, // subAccount (any unless configured)
+		},
+	})
+}
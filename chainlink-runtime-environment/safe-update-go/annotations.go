@@ -0,0 +1,209 @@
+//go:build wasip1
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+)
+
+// Annotation targets
+const (
+	// AnnotateAudit annotates the audit records of a transaction
+	AnnotateAudit = "audit"
+
+	// AnnotateDeadLetter annotates a queued dead letter
+	AnnotateDeadLetter = "deadLetter"
+)
+
+// Annotation represents a triage note left by an operator, e.g. "confirmed
+// legit OTC transfer". Author is the admin key that signed the request.
+type Annotation struct {
+	Kind       string `json:"kind"`
+	TxHash     string `json:"txHash"`
+	Module     string `json:"module,omitempty"`
+	Note       string `json:"note"`
+	Resolution string `json:"resolution,omitempty"`
+	Author     string `json:"author,omitempty"`
+	At         int64  `json:"at"`
+}
+
+// annotationsParams represents the parameters of the annotations admin method
+type annotationsParams struct {
+	Kind   string `json:"kind,omitempty"`
+	TxHash string `json:"txHash,omitempty"`
+}
+
+func init() {
+	RegisterAdminMethod("annotate", adminAnnotate)
+	RegisterAdminMethod("annotations", adminAnnotations)
+	RegisterAdminMethod("auditLog", adminAuditLog)
+	RegisterAdminMethod("deadLetters", adminDeadLetters)
+}
+
+// annotationKey returns the key annotations of an item are stored under
+func annotationKey(kind string, txHash string, module string) string {
+	key := kind + ":" + strings.ToLower(txHash)
+	if kind == AnnotateDeadLetter {
+		key += ":" + strings.ToLower(module)
+	}
+	return key
+}
+
+// Annotate attaches an annotation to an audited transaction or a dead letter
+func (s *WorkflowState) Annotate(annotation Annotation) {
+	key := annotationKey(annotation.Kind, annotation.TxHash, annotation.Module)
+	s.Annotations[key] = append(s.Annotations[key], annotation)
+}
+
+// AuditAnnotations returns the annotations of a transaction's audit records
+func (s *WorkflowState) AuditAnnotations(txHash string) []Annotation {
+	return s.Annotations[annotationKey(AnnotateAudit, txHash, "")]
+}
+
+// DeadLetterAnnotations returns the annotations of a dead letter
+func (s *WorkflowState) DeadLetterAnnotations(letter DeadLetter) []Annotation {
+	return s.Annotations[annotationKey(AnnotateDeadLetter, letter.TxHash, letter.Module)]
+}
+
+// annotationNotes returns the notes of annotations for log output
+func annotationNotes(annotations []Annotation) []string {
+	notes := make([]string, len(annotations))
+	for i, annotation := range annotations {
+		notes[i] = annotation.Note
+		if annotation.Resolution != "" {
+			notes[i] += " (" + annotation.Resolution + ")"
+		}
+	}
+	return notes
+}
+
+// hasAuditRecord reports whether a transaction was audited. Encrypted
+// transaction hashes cannot be matched and are assumed present.
+func hasAuditRecord(config *Config, txHash string) bool {
+	if config.Audit != nil {
+		for _, field := range config.Audit.SensitiveFields {
+			if field == "txHash" {
+				return true
+			}
+		}
+	}
+	for _, fields := range state.AuditLog {
+		if strings.EqualFold(fields["txHash"], txHash) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasDeadLetter reports whether a dead letter is queued
+func hasDeadLetter(txHash string, module string) bool {
+	for _, letter := range state.DeadLetters {
+		if strings.EqualFold(letter.TxHash, txHash) && strings.EqualFold(letter.Module, module) {
+			return true
+		}
+	}
+	return false
+}
+
+// adminAnnotate attaches an operator note to an audit record or dead letter
+func adminAnnotate(config *Config, runtime cre.Runtime, caller common.Address, params json.RawMessage) (interface{}, error) {
+	var annotation Annotation
+	if err := json.Unmarshal(params, &annotation); err != nil {
+		return nil, fmt.Errorf("invalid params: %w", err)
+	}
+	if annotation.TxHash == "" || annotation.Note == "" {
+		return nil, fmt.Errorf("txHash and note are required")
+	}
+
+	switch annotation.Kind {
+	case AnnotateAudit:
+		if !hasAuditRecord(config, annotation.TxHash) {
+			return nil, fmt.Errorf("no audit record for %s", annotation.TxHash)
+		}
+	case AnnotateDeadLetter:
+		if !hasDeadLetter(annotation.TxHash, annotation.Module) {
+			return nil, fmt.Errorf("no dead letter for %s on module %s", annotation.TxHash, annotation.Module)
+		}
+	default:
+		return nil, fmt.Errorf("unknown annotation kind %q", annotation.Kind)
+	}
+
+	annotation.Author = caller.Hex()
+	annotation.At = runtime.Now().Unix()
+	state.Annotate(annotation)
+	runtime.Logger().Info("Annotation added", "kind", annotation.Kind, "txHash", annotation.TxHash,
+		"module", annotation.Module, "note", annotation.Note, "resolution", annotation.Resolution, "author", annotation.Author)
+	return annotation, nil
+}
+
+// adminAnnotations lists annotations, optionally filtered by kind and transaction
+func adminAnnotations(config *Config, runtime cre.Runtime, caller common.Address, params json.RawMessage) (interface{}, error) {
+	var p annotationsParams
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, fmt.Errorf("invalid params: %w", err)
+		}
+	}
+
+	annotations := []Annotation{}
+	for _, list := range state.Annotations {
+		for _, annotation := range list {
+			if p.Kind != "" && annotation.Kind != p.Kind {
+				continue
+			}
+			if p.TxHash != "" && !strings.EqualFold(annotation.TxHash, p.TxHash) {
+				continue
+			}
+			annotations = append(annotations, annotation)
+		}
+	}
+	return annotations, nil
+}
+
+// adminAuditLog reports the retained audit records with their annotations
+func adminAuditLog(config *Config, runtime cre.Runtime, caller common.Address, params json.RawMessage) (interface{}, error) {
+	type annotatedRecord struct {
+		Record      map[string]string `json:"record"`
+		Annotations []Annotation      `json:"annotations,omitempty"`
+	}
+
+	records := make([]annotatedRecord, len(state.AuditLog))
+	for i, fields := range state.AuditLog {
+		records[i] = annotatedRecord{Record: fields, Annotations: state.AuditAnnotations(fields["txHash"])}
+	}
+	return records, nil
+}
+
+// adminDeadLetters reports the queued dead letters with their annotations
+func adminDeadLetters(config *Config, runtime cre.Runtime, caller common.Address, params json.RawMessage) (interface{}, error) {
+	type annotatedLetter struct {
+		TxHash        string       `json:"txHash"`
+		Module        string       `json:"module"`
+		SubAccount    string       `json:"subAccount"`
+		BalanceChange string       `json:"balanceChange"`
+		Reason        string       `json:"reason"`
+		Attempts      int          `json:"attempts"`
+		QueuedAt      int64        `json:"queuedAt"`
+		Annotations   []Annotation `json:"annotations,omitempty"`
+	}
+
+	letters := make([]annotatedLetter, len(state.DeadLetters))
+	for i, letter := range state.DeadLetters {
+		letters[i] = annotatedLetter{
+			TxHash:        letter.TxHash,
+			Module:        letter.Module,
+			SubAccount:    letter.SubAccount,
+			BalanceChange: letter.BalanceChange.String(),
+			Reason:        letter.Reason,
+			Attempts:      letter.Attempts,
+			QueuedAt:      letter.QueuedAt.Unix(),
+			Annotations:   state.DeadLetterAnnotations(letter),
+		}
+	}
+	return letters, nil
+}
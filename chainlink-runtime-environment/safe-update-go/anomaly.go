@@ -0,0 +1,214 @@
+//go:build wasip1
+
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"safe-update-go/fixedpoint"
+)
+
+// Anomaly detection defaults
+const (
+	defaultAnomalyBucket     = time.Hour
+	defaultAnomalySigmas     = 3
+	defaultAnomalyMinSamples = 10
+)
+
+// Responses to an anomalous action
+const (
+	AnomalyAlert  = "alert"
+	AnomalyReview = "review"
+	AnomalyReject = "reject"
+)
+
+// Kinds of anomalies
+const (
+	AnomalySize      = "size"
+	AnomalyFrequency = "frequency"
+)
+
+// AnomalyConfig represents the statistical detector run over each
+// subaccount's ledger history. An action is anomalous when its size, or the
+// number of actions in the current bucket, is more than sigmas standard
+// deviations above the subaccount's mean over the lookback.
+type AnomalyConfig struct {
+	Verb            Verb   `json:"verb,omitempty"`
+	LookbackSeconds uint64 `json:"lookbackSeconds"`
+	BucketSeconds   uint64 `json:"bucketSeconds,omitempty"`
+	Sigmas          uint64 `json:"sigmas,omitempty"`
+	MinSamples      uint64 `json:"minSamples,omitempty"`
+	MinUSD          uint64 `json:"minUsd,omitempty"`
+	Response        string `json:"response,omitempty"`
+}
+
+// Anomaly represents an action outside its subaccount's historical pattern.
+// Size values are USD with 18 decimals; frequency values are action counts.
+type Anomaly struct {
+	Kind    string
+	Value   *big.Int
+	Mean    *big.Int
+	StdDev  *big.Int
+	Samples int
+}
+
+// ValidateAnomaly checks the anomaly detector configuration
+func ValidateAnomaly(anomaly *AnomalyConfig) error {
+	if anomaly == nil {
+		return nil
+	}
+	if anomaly.LookbackSeconds == 0 {
+		return fmt.Errorf("lookbackSeconds is required")
+	}
+	if seconds(anomaly.LookbackSeconds) < 3*anomaly.bucket() {
+		return fmt.Errorf("lookbackSeconds must cover at least 3 buckets of %s", anomaly.bucket())
+	}
+	switch anomaly.Response {
+	case "", AnomalyAlert, AnomalyReview, AnomalyReject:
+	default:
+		return fmt.Errorf("unknown response %q", anomaly.Response)
+	}
+	return nil
+}
+
+// verb returns the verb of the actions the detector watches
+func (c *AnomalyConfig) verb() Verb {
+	if c.Verb == "" {
+		return VerbWithdraw
+	}
+	return c.Verb
+}
+
+// bucket returns the length of the buckets actions are counted in
+func (c *AnomalyConfig) bucket() time.Duration {
+	if c.BucketSeconds == 0 {
+		return defaultAnomalyBucket
+	}
+	return seconds(c.BucketSeconds)
+}
+
+// sigmas returns how many standard deviations above the mean are anomalous
+func (c *AnomalyConfig) sigmas() uint64 {
+	if c.Sigmas == 0 {
+		return defaultAnomalySigmas
+	}
+	return c.Sigmas
+}
+
+// minSamples returns how many past actions a subaccount needs to be checked
+func (c *AnomalyConfig) minSamples() int {
+	if c.MinSamples == 0 {
+		return defaultAnomalyMinSamples
+	}
+	return int(c.MinSamples)
+}
+
+// response returns what is done with an anomalous action
+func (c *AnomalyConfig) response() string {
+	if c.Response == "" {
+		return AnomalyAlert
+	}
+	return c.Response
+}
+
+// String describes the anomaly for logs, alerts and review reasons
+func (a Anomaly) String() string {
+	if a.Kind == AnomalySize {
+		return fmt.Sprintf("size %s USD vs mean %s ± %s over %d actions", usdWhole(a.Value), usdWhole(a.Mean), usdWhole(a.StdDev), a.Samples)
+	}
+	return fmt.Sprintf("%s actions in the bucket vs mean %s ± %s over %d buckets", a.Value, a.Mean, a.StdDev, a.Samples)
+}
+
+// usdWhole returns a USD value with 18 decimals in whole dollars
+func usdWhole(value *big.Int) string {
+	return fixedpoint.Rescale(value, fixedpoint.USDDecimals, 0, fixedpoint.RoundDown).String()
+}
+
+// outlier reports whether a value is more than sigmas standard deviations
+// above the mean of samples, and returns their statistics. The comparison is
+// exact: with n samples of sum S and sum of squares Q, the value x is an
+// outlier when n·x > S and (n·x − S)² > sigmas²·(n·Q − S²).
+func outlier(kind string, samples []*big.Int, x *big.Int, sigmas uint64) (Anomaly, bool) {
+	n := big.NewInt(int64(len(samples)))
+	sum, squares := new(big.Int), new(big.Int)
+	for _, sample := range samples {
+		sum.Add(sum, sample)
+		squares.Add(squares, new(big.Int).Mul(sample, sample))
+	}
+	spread := new(big.Int).Sub(new(big.Int).Mul(n, squares), new(big.Int).Mul(sum, sum))
+
+	anomaly := Anomaly{
+		Kind:    kind,
+		Value:   x,
+		Mean:    new(big.Int).Quo(sum, n),
+		StdDev:  new(big.Int).Quo(new(big.Int).Sqrt(spread), n),
+		Samples: len(samples),
+	}
+
+	deviation := new(big.Int).Sub(new(big.Int).Mul(n, x), sum)
+	if deviation.Sign() <= 0 {
+		return anomaly, false
+	}
+	k := new(big.Int).SetUint64(sigmas)
+	bound := new(big.Int).Mul(new(big.Int).Mul(k, k), spread)
+	return anomaly, new(big.Int).Mul(deviation, deviation).Cmp(bound) > 0
+}
+
+// DetectAnomalies compares an action with its subaccount's ledger history of
+// the same verb over the lookback: its gross value with the past action sizes,
+// and the number of actions in the current bucket, this one included, with
+// the counts of the past buckets. A single action in the current bucket is
+// not a frequency anomaly. Subaccounts with fewer past actions than
+// minSamples, and actions below minUsd, are not checked.
+func DetectAnomalies(policy *PolicyConfig, s *WorkflowState, subAccount string, action *Action, grossUSD *big.Int, now time.Time) []Anomaly {
+	if policy == nil || policy.Anomaly == nil {
+		return nil
+	}
+	config := policy.Anomaly
+	if action.Verb != config.verb() || grossUSD.Cmp(fixedpoint.FromWhole(config.MinUSD, fixedpoint.USDDecimals)) < 0 {
+		return nil
+	}
+
+	bucket := config.bucket()
+	since := now.Add(-seconds(config.LookbackSeconds))
+	counts := make([]*big.Int, int(seconds(config.LookbackSeconds)/bucket))
+	for i := range counts {
+		counts[i] = new(big.Int)
+	}
+	var sizes []*big.Int
+	for _, entry := range s.Ledger {
+		if entry.At.Before(since) || entry.At.After(now) || entry.Verb != config.verb() || !strings.EqualFold(entry.SubAccount, subAccount) {
+			continue
+		}
+		sizes = append(sizes, entry.GrossUSD)
+		if i := int(now.Sub(entry.At) / bucket); i < len(counts) {
+			counts[i].Add(counts[i], big.NewInt(1))
+		}
+	}
+	if len(sizes) < config.minSamples() {
+		return nil
+	}
+
+	var anomalies []Anomaly
+	if anomaly, ok := outlier(AnomalySize, sizes, grossUSD, config.sigmas()); ok {
+		anomalies = append(anomalies, anomaly)
+	}
+	// A lone action is never a burst, however quiet the subaccount usually is
+	current := new(big.Int).Add(counts[0], big.NewInt(1))
+	if anomaly, ok := outlier(AnomalyFrequency, counts[1:], current, config.sigmas()); ok && current.Cmp(big.NewInt(1)) > 0 {
+		anomalies = append(anomalies, anomaly)
+	}
+	return anomalies
+}
+
+// anomalyReason describes anomalies for review reasons and errors
+func anomalyReason(anomalies []Anomaly) string {
+	descriptions := make([]string, len(anomalies))
+	for i, anomaly := range anomalies {
+		descriptions[i] = anomaly.String()
+	}
+	return "anomalous " + strings.Join(descriptions, "; ")
+}
@@ -0,0 +1,248 @@
+//go:build wasip1
+
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+)
+
+// encryptedPrefix marks an audit field value encrypted with AES-256-GCM
+const encryptedPrefix = "enc:v1:"
+
+// redactedValue stands in the logs for the value of a sensitive audit field
+const redactedValue = "[encrypted]"
+
+// AuditConfig represents how audit records are persisted
+type AuditConfig struct {
+	SensitiveFields     []string `json:"sensitiveFields,omitempty"`
+	EncryptionKeySecret string   `json:"encryptionKeySecret,omitempty"`
+}
+
+// AuditRecord represents the outcome of processing one ProtocolExecuted event
+type AuditRecord struct {
+	TxHash        string `json:"txHash"`
+	SubAccount    string `json:"subAccount"`
+	Target        string `json:"target"`
+	Protocol      string `json:"protocol"`
+	Verb          string `json:"verb"`
+	Confidence    string `json:"confidence,omitempty"`
+	Token         string `json:"token"`
+	Amount        string `json:"amount"`
+	FixedPrices   string `json:"fixedPrices,omitempty"`
+	CachedPrices  string `json:"cachedPrices,omitempty"`
+	BalanceChange string `json:"balanceChange"`
+	Module        string `json:"module"`
+	Outcome       string `json:"outcome"`
+	Timestamp     int64  `json:"timestamp"`
+	SafeTxHash    string `json:"safeTxHash,omitempty"`
+	Proposer      string `json:"proposer,omitempty"`
+	Signers       string `json:"signers,omitempty"`
+	Executor      string `json:"executor,omitempty"`
+	ConfigHash    string `json:"configHash,omitempty"`
+
+	// Operator and Note record the admin key and note of operator actions
+	Operator string `json:"operator,omitempty"`
+	Note     string `json:"note,omitempty"`
+
+	Methodology     string `json:"methodology,omitempty"`
+	CurrentNetUSD   string `json:"currentNetUsd,omitempty"`
+	CandidateNetUSD string `json:"candidateNetUsd,omitempty"`
+	ImpactBps       string `json:"impactBps,omitempty"`
+}
+
+// Fields returns the record as field name to value, using the JSON names
+func (r AuditRecord) Fields() map[string]string {
+	return map[string]string{
+		"txHash":        r.TxHash,
+		"subAccount":    r.SubAccount,
+		"target":        r.Target,
+		"protocol":      r.Protocol,
+		"verb":          r.Verb,
+		"confidence":    r.Confidence,
+		"token":         r.Token,
+		"amount":        r.Amount,
+		"fixedPrices":   r.FixedPrices,
+		"cachedPrices":  r.CachedPrices,
+		"balanceChange": r.BalanceChange,
+		"module":        r.Module,
+		"outcome":       r.Outcome,
+		"timestamp":     fmt.Sprintf("%d", r.Timestamp),
+		"safeTxHash":    r.SafeTxHash,
+		"proposer":      r.Proposer,
+		"signers":       r.Signers,
+		"executor":      r.Executor,
+		"configHash":    r.ConfigHash,
+		"operator":      r.Operator,
+		"note":          r.Note,
+
+		"methodology":     r.Methodology,
+		"currentNetUsd":   r.CurrentNetUSD,
+		"candidateNetUsd": r.CandidateNetUSD,
+		"impactBps":       r.ImpactBps,
+	}
+}
+
+// LogValue returns a value to log, withheld when its audit field is sensitive
+// so the logs never carry in clear text what the audit record encrypts
+func (a *AuditConfig) LogValue(field string, value string) string {
+	if a == nil {
+		return value
+	}
+	for _, name := range a.SensitiveFields {
+		if name == field {
+			return redactedValue
+		}
+	}
+	return value
+}
+
+// RecordAudit encrypts the sensitive fields of a record and persists it to the
+// audit log. Audit failures are logged and never block allowance updates.
+func RecordAudit(config *Config, runtime cre.Runtime, record AuditRecord) {
+	logger := runtime.Logger()
+	record.ConfigHash = activeConfigHash
+
+	fields, err := protectAuditFields(config.Audit, runtime, record.Fields())
+	if err != nil {
+		logger.Error("Failed to protect audit record", "txHash", record.TxHash, "error", err.Error())
+		return
+	}
+
+	state.AuditLog = append(state.AuditLog, fields)
+
+	encoded, err := json.Marshal(fields)
+	if err != nil {
+		logger.Error("Failed to encode audit record", "error", err.Error())
+		return
+	}
+	args := []any{"record", string(encoded)}
+
+	if config.DecisionLog != nil {
+		entry, err := state.AppendDecision(fields)
+		if err != nil {
+			logger.Error("Failed to append decision", "txHash", record.TxHash, "error", err.Error())
+		} else {
+			args = append(args, "seq", entry.Seq, "chainHash", entry.Hash.Hex())
+		}
+		if dropped := state.CompactDecisionLog(config.DecisionLog.MaxEntries); dropped > 0 {
+			RaiseAlert(config, runtime, slog.LevelWarn, "ALERT: decision log compacted before anchoring", "decisionLog",
+				"dropped", dropped, "offset", state.DecisionLogOffset)
+		}
+	}
+	if annotations := state.AuditAnnotations(record.TxHash); len(annotations) > 0 {
+		args = append(args, "annotations", annotationNotes(annotations))
+	}
+	logger.Info("Audit record", args...)
+}
+
+// protectAuditFields replaces the value of every sensitive field with its ciphertext
+func protectAuditFields(audit *AuditConfig, runtime cre.Runtime, fields map[string]string) (map[string]string, error) {
+	if audit == nil || len(audit.SensitiveFields) == 0 {
+		return fields, nil
+	}
+
+	key, err := auditKey(audit, runtime)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range audit.SensitiveFields {
+		value, ok := fields[name]
+		if !ok || value == "" {
+			continue
+		}
+		encrypted, err := EncryptField(key, []byte(value), runtime)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encrypt %s: %w", name, err)
+		}
+		fields[name] = encrypted
+	}
+
+	return fields, nil
+}
+
+// auditKey fetches the hex encoded AES-256 key from the workflow secrets
+func auditKey(audit *AuditConfig, runtime cre.Runtime) ([]byte, error) {
+	if audit.EncryptionKeySecret == "" {
+		return nil, fmt.Errorf("sensitive audit fields configured without encryptionKeySecret")
+	}
+
+	secret, err := runtime.GetSecret(&cre.SecretRequest{Id: audit.EncryptionKeySecret}).Await()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get secret %s: %w", audit.EncryptionKeySecret, err)
+	}
+
+	key, err := hex.DecodeString(strings.TrimPrefix(secret.Value, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("secret %s is not hex encoded: %w", audit.EncryptionKeySecret, err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("secret %s must be a 32 byte key, got %d bytes", audit.EncryptionKeySecret, len(key))
+	}
+
+	return key, nil
+}
+
+// EncryptField encrypts a value with AES-256-GCM. The nonce comes from the
+// runtime's random source so every node of the DON produces the same ciphertext.
+func EncryptField(key []byte, plaintext []byte, runtime cre.Runtime) (string, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+
+	rand, err := runtime.Rand()
+	if err != nil {
+		return "", fmt.Errorf("failed to get random source: %w", err)
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	sealed := gcm.Seal(nonce, nonce, plaintext, nil)
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptField reverses EncryptField, for tooling that reads exported audit data
+func DecryptField(key []byte, value string) (string, error) {
+	if !strings.HasPrefix(value, encryptedPrefix) {
+		return value, nil
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encryptedPrefix))
+	if err != nil {
+		return "", err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", fmt.Errorf("ciphertext too short")
+	}
+
+	plaintext, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
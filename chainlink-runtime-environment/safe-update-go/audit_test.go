@@ -0,0 +1,97 @@
+//go:build wasip1
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/smartcontractkit/cre-sdk-go/cre/testutils"
+)
+
+func TestEncryptFieldRoundTrip(t *testing.T) {
+	runtime := testutils.NewRuntime(t, nil)
+	key := bytes.Repeat([]byte{0x42}, 32)
+
+	for _, value := range []string{"1500000", "0x00000000000000000000000000000000000000cc", ""} {
+		encrypted, err := EncryptField(key, []byte(value), runtime)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(encrypted, encryptedPrefix) || (value != "" && strings.Contains(encrypted, value)) {
+			t.Fatalf("encrypted %q as %q", value, encrypted)
+		}
+		decrypted, err := DecryptField(key, encrypted)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decrypted != value {
+			t.Errorf("decrypted %q, want %q", decrypted, value)
+		}
+	}
+
+	t.Run("wrong key", func(t *testing.T) {
+		encrypted, err := EncryptField(key, []byte("1500000"), runtime)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := DecryptField(bytes.Repeat([]byte{0x24}, 32), encrypted); err == nil {
+			t.Error("decrypted with the wrong key")
+		}
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		if _, err := DecryptField(key, encryptedPrefix+"AAAA"); err == nil {
+			t.Error("decrypted a truncated ciphertext")
+		}
+	})
+
+	t.Run("clear text", func(t *testing.T) {
+		// Fields that were not sensitive are read as they are
+		if value, err := DecryptField(key, "1500000"); err != nil || value != "1500000" {
+			t.Errorf("clear text read as %q, %v", value, err)
+		}
+	})
+}
+
+func TestLogValue(t *testing.T) {
+	audit := &AuditConfig{SensitiveFields: []string{"amount"}}
+	if got := audit.LogValue("amount", "1500000"); got != redactedValue {
+		t.Errorf("sensitive field logged as %q", got)
+	}
+	if got := audit.LogValue("txHash", "0xabc"); got != "0xabc" {
+		t.Errorf("field logged as %q", got)
+	}
+	if got := (*AuditConfig)(nil).LogValue("amount", "1500000"); got != "1500000" {
+		t.Errorf("field logged as %q without audit config", got)
+	}
+}
+
+func TestCompactDecisionLog(t *testing.T) {
+	s := NewWorkflowState()
+	for i := 0; i < 5; i++ {
+		if _, err := s.AppendDecision(map[string]string{"txHash": fmt.Sprintf("0x%d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if dropped := s.CompactDecisionLog(3); dropped != 2 {
+		t.Fatalf("dropped %d links, want 2", dropped)
+	}
+	if len(s.DecisionLog) != 3 || s.DecisionLog[0].Seq != 2 || s.DecisionLogOffset != 2 {
+		t.Fatalf("kept %d links from seq %d, offset %d", len(s.DecisionLog), s.DecisionLog[0].Seq, s.DecisionLogOffset)
+	}
+	if broken := VerifyDecisionChain(s.DecisionLog); broken >= 0 {
+		t.Fatalf("compacted chain broken at %d", broken)
+	}
+
+	entry, err := s.AppendDecision(map[string]string{"txHash": "0x5"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Seq != 5 || entry.PrevHash != s.DecisionLog[2].Hash {
+		t.Errorf("appended seq %d after compaction", entry.Seq)
+	}
+}
@@ -0,0 +1,204 @@
+//go:build wasip1
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/blockchain/evm"
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/scheduler/cron"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+)
+
+// BackpressureConfig represents the degradation of event processing when
+// updates back up. Once more than maxDepth updates wait in the dead letters
+// and module pause queues, allowance updates are batched per module and
+// subaccount and submitted on the flush schedule instead of one per event,
+// until the depth is back to resumeDepth.
+type BackpressureConfig struct {
+	MaxDepth      int    `json:"maxDepth"`
+	ResumeDepth   int    `json:"resumeDepth,omitempty"`
+	FlushSchedule string `json:"flushSchedule"`
+}
+
+// BatchedUpdate represents the allowance updates of one subaccount on one
+// module, and one token for token-native modules, aggregated while processing
+// is degraded
+type BatchedUpdate struct {
+	Module        string
+	SubAccount    string
+	Token         string
+	BalanceChange *big.Int
+	TxHashes      []string
+	EventTime     time.Time
+	QueuedAt      time.Time
+}
+
+// ValidateBackpressure checks the backpressure configuration
+func ValidateBackpressure(backpressure *BackpressureConfig) error {
+	if backpressure == nil {
+		return nil
+	}
+	if backpressure.MaxDepth <= 0 || backpressure.FlushSchedule == "" {
+		return fmt.Errorf("maxDepth and flushSchedule are required")
+	}
+	if backpressure.ResumeDepth < 0 || backpressure.ResumeDepth >= backpressure.MaxDepth {
+		return fmt.Errorf("resumeDepth must be below maxDepth")
+	}
+	return nil
+}
+
+// resumeDepth returns the depth at which per-event processing resumes
+func (c *BackpressureConfig) resumeDepth() int {
+	if c.ResumeDepth == 0 {
+		return c.MaxDepth / 2
+	}
+	return c.ResumeDepth
+}
+
+// QueueDepth returns how many allowance updates wait for submission in the
+// dead letters. Exhausted letters are parked for an operator and never
+// retried, so they do not count.
+func (s *WorkflowState) QueueDepth() int {
+	depth := 0
+	for _, letter := range s.DeadLetters {
+		if !letter.Exhausted {
+			depth++
+		}
+	}
+	return depth
+}
+
+// Degraded reports whether updates are batched, entering batched mode above
+// maxDepth and leaving it at resumeDepth
+func Degraded(config *Config, runtime cre.Runtime) bool {
+	if config.Backpressure == nil {
+		return false
+	}
+	depth := state.QueueDepth()
+
+	switch {
+	case !state.Degraded && depth > config.Backpressure.MaxDepth:
+		state.Degraded, state.DegradedSince = true, runtime.Now()
+		RaiseAlert(config, runtime, slog.LevelError, "PAGE: processing degraded", "", "depth", depth, "maxDepth", config.Backpressure.MaxDepth)
+	case state.Degraded && depth <= config.Backpressure.resumeDepth():
+		runtime.Logger().Info("Processing recovered", "depth", depth, "degradedFor", runtime.Now().Sub(state.DegradedSince).String())
+		state.Degraded, state.DegradedSince = false, time.Time{}
+	}
+	return state.Degraded
+}
+
+// BatchUpdate adds an allowance update to the batch of its module, subaccount
+// and token
+func (s *WorkflowState) BatchUpdate(letter DeadLetter) {
+	for i := range s.Batch {
+		batched := &s.Batch[i]
+		if !strings.EqualFold(batched.Module, letter.Module) || !strings.EqualFold(batched.SubAccount, letter.SubAccount) || batched.Token != letter.Token {
+			continue
+		}
+		for _, txHash := range batched.TxHashes {
+			if txHash == letter.TxHash {
+				return
+			}
+		}
+		batched.BalanceChange.Add(batched.BalanceChange, letter.BalanceChange)
+		batched.TxHashes = append(batched.TxHashes, letter.TxHash)
+		if letter.EventTime.Before(batched.EventTime) {
+			batched.EventTime = letter.EventTime
+		}
+		return
+	}
+	s.Batch = append(s.Batch, BatchedUpdate{
+		Module:        letter.Module,
+		SubAccount:    letter.SubAccount,
+		Token:         letter.Token,
+		BalanceChange: new(big.Int).Set(letter.BalanceChange),
+		TxHashes:      []string{letter.TxHash},
+		EventTime:     letter.EventTime,
+		QueuedAt:      letter.QueuedAt,
+	})
+}
+
+// OnFlushBatch is the handler for the batch flush cron trigger. It submits
+// one allowance update per module and subaccount for the batched events.
+// Failed batches are queued as a single dead letter, and batches held by the
+// gas schedule stay batched for the next flush. Processing leaves degraded
+// mode once the flush drained the queue.
+func OnFlushBatch(config *Config, runtime cre.Runtime, payload *cron.Payload) (*ExecutionResult, error) {
+	logger := runtime.Logger()
+	degraded := Degraded(config, runtime)
+	logger.Info("Batch flush triggered", "batched", len(state.Batch), "depth", state.QueueDepth(), "degraded", degraded)
+
+	if len(state.Batch) == 0 {
+		return &ExecutionResult{Message: "No batched updates", Success: true}, nil
+	}
+
+	if !IsLeader(config, runtime, logger) {
+		return &ExecutionResult{Message: "Standby: batches left to the leader", Success: true}, nil
+	}
+
+	evmClient := newEVMClient(config)
+	gas := ReadGasWindow(config, runtime, evmClient)
+	batch := state.Batch
+	state.Batch = nil
+
+	submitted, deferred, events := 0, 0, 0
+	for _, batched := range batch {
+		events += len(batched.TxHashes)
+		if batched.BalanceChange.Sign() == 0 {
+			continue
+		}
+		// Batches wait for a cheaper block, up to the schedule's maximum delay
+		if gas.Defers(config.GasSchedule, batched.QueuedAt, runtime.Now()) {
+			state.Batch = append(state.Batch, batched)
+			deferred++
+			continue
+		}
+		letter := DeadLetter{
+			TxHash:        batched.TxHashes[0],
+			Module:        batched.Module,
+			SubAccount:    batched.SubAccount,
+			Token:         batched.Token,
+			BalanceChange: batched.BalanceChange,
+			EventTime:     batched.EventTime,
+			QueuedAt:      batched.QueuedAt,
+		}
+
+		target, err := config.TargetForModule(batched.Module)
+		if err == nil {
+			var writeResult *evm.WriteReportReply
+			writeResult, err = SubmitLetter(target, runtime, evmClient, letter, target.GasLimit)
+			if err == nil {
+				err = CheckWriteResult(writeResult)
+			}
+			state.RecordModuleResult(target.ModuleAddress.Hex(), err, runtime.Now())
+		}
+		if err != nil {
+			logger.Warn("Batched update failed", "module", batched.Module, "subAccount", batched.SubAccount, "events", len(batched.TxHashes), "error", err.Error())
+			letter.Reason = fmt.Sprintf("batch of %d events: %s", len(batched.TxHashes), err.Error())
+			state.AddDeadLetter(letter)
+			continue
+		}
+
+		if !batched.EventTime.IsZero() {
+			state.RecordSubmission(batched.EventTime, runtime.Now())
+		}
+		logger.Info("Batched update submitted", "module", batched.Module, "subAccount", batched.SubAccount,
+			"events", len(batched.TxHashes), "balanceChange", formatBalanceChange(config, letter))
+		submitted++
+	}
+
+	if deferred > 0 {
+		logger.Info("Batches deferred for gas", "deferred", deferred, "baseFeeGwei", gas.Gwei(), "maxBaseFeeGwei", config.GasSchedule.MaxBaseFeeGwei)
+	}
+	// Updates failed by the flush count towards the depth it is judged on
+	degraded = Degraded(config, runtime)
+	return &ExecutionResult{
+		Message: fmt.Sprintf("Flushed %d batches of %d events: %d submitted, %d deferred for gas, degraded %t", len(batch), events, submitted, deferred, degraded),
+		Success: true,
+	}, nil
+}
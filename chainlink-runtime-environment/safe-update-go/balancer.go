@@ -0,0 +1,103 @@
+//go:build wasip1
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/blockchain/evm"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+)
+
+// PoolBalanceChanged(bytes32 indexed poolId, address indexed liquidityProvider, address[] tokens, int256[] deltas, uint256[] protocolFeeAmounts),
+// emitted by the Balancer V2 Vault on joins and exits
+var balancerPoolBalanceChangedSignature = crypto.Keccak256Hash([]byte("PoolBalanceChanged(bytes32,address,address[],int256[],uint256[])"))
+
+// balancerBalanceChangeArgs decodes the data of PoolBalanceChanged
+func balancerBalanceChangeArgs() (abi.Arguments, error) {
+	addresses, err := abi.NewType("address[]", "", nil)
+	if err != nil {
+		return nil, err
+	}
+	ints, err := abi.NewType("int256[]", "", nil)
+	if err != nil {
+		return nil, err
+	}
+	uints, err := abi.NewType("uint256[]", "", nil)
+	if err != nil {
+		return nil, err
+	}
+	return abi.Arguments{{Type: addresses}, {Type: ints}, {Type: uints}}, nil
+}
+
+// ResolveBalancerExit settles a Balancer V2 pool exit from the Vault's
+// PoolBalanceChanged event for the poolId of the call. The event lists the
+// pool's registered tokens and each negative delta is an amount paid out,
+// but only what the Vault transferred to the Safe as ERC20 is credited.
+// Exits to internal balance and ETH exits, which unwrap WETH and send no
+// Transfer, credit nothing. Tokens with a zero delta, such as the BPT of
+// composable pools, are skipped.
+func ResolveBalancerExit(runtime cre.Runtime, evmClient *evm.Client, logger *slog.Logger, action *Action, calldata []byte, txHash []byte) error {
+	if len(calldata) < 36 {
+		return fmt.Errorf("calldata too short for poolId")
+	}
+	poolID := calldata[4:36]
+
+	args, err := balancerBalanceChangeArgs()
+	if err != nil {
+		return fmt.Errorf("failed to build PoolBalanceChanged arguments: %w", err)
+	}
+
+	reply, err := evmClient.GetTransactionReceipt(runtime, &evm.GetTransactionReceiptRequest{Hash: txHash}).Await()
+	if err != nil {
+		return fmt.Errorf("failed to get transaction receipt: %w", err)
+	}
+	if reply.Receipt == nil {
+		return fmt.Errorf("transaction receipt not found")
+	}
+
+	for _, log := range reply.Receipt.Logs {
+		if common.BytesToAddress(log.Address) != action.Counterparty || len(log.Topics) < 2 ||
+			!bytes.Equal(log.Topics[0], balancerPoolBalanceChangedSignature.Bytes()) || !bytes.Equal(log.Topics[1], poolID) {
+			continue
+		}
+
+		values, err := args.Unpack(log.Data)
+		if err != nil {
+			return fmt.Errorf("failed to unpack PoolBalanceChanged: %w", err)
+		}
+		tokens, ok := values[0].([]common.Address)
+		if !ok {
+			return fmt.Errorf("unexpected PoolBalanceChanged tokens")
+		}
+		deltas, ok := values[1].([]*big.Int)
+		if !ok || len(deltas) != len(tokens) {
+			return fmt.Errorf("unexpected PoolBalanceChanged deltas")
+		}
+
+		for i, token := range tokens {
+			if deltas[i].Sign() >= 0 {
+				continue
+			}
+			amount := poolTransfers(reply.Receipt.Logs, token, action.Counterparty, action.Avatar)
+			if paid := new(big.Int).Neg(deltas[i]); amount.Cmp(paid) > 0 {
+				amount = paid
+			}
+			if amount.Sign() == 0 {
+				logger.Warn("Balancer pool exit paid nothing to the Safe", "poolId", common.BytesToHash(poolID).Hex(), "token", token.Hex())
+				continue
+			}
+			action.AssetsIn = append(action.AssetsIn, AssetAmount{Token: token, Amount: amount})
+			logger.Info("Balancer pool exit", "poolId", common.BytesToHash(poolID).Hex(), "token", token.Hex(), "amount", amount.String())
+		}
+		return nil
+	}
+
+	return fmt.Errorf("no PoolBalanceChanged for pool %s in receipt", common.BytesToHash(poolID).Hex())
+}
@@ -0,0 +1,288 @@
+//go:build wasip1
+
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// shapeKind represents how an ABI type is encoded in calldata
+type shapeKind int
+
+const (
+	shapeAddress shapeKind = iota
+	shapeBool
+	shapeUint
+	shapeInt
+	shapeFixedBytes
+	shapeBytes
+	shapeArray
+	shapeTuple
+)
+
+// abiShape represents the encoding of an ABI type. Size is the bit size of
+// integers, the byte size of fixed bytes and the length of fixed arrays, or
+// -1 for dynamic arrays.
+type abiShape struct {
+	Kind   shapeKind
+	Size   int
+	Elem   *abiShape
+	Fields []*abiShape
+}
+
+// dynamic reports whether the type is encoded in the tail, behind an offset
+func (s *abiShape) dynamic() bool {
+	switch s.Kind {
+	case shapeBytes:
+		return true
+	case shapeArray:
+		return s.Size < 0 || s.Elem.dynamic()
+	case shapeTuple:
+		for _, field := range s.Fields {
+			if field.dynamic() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// headSize returns the bytes the type takes in the head of its enclosing encoding
+func (s *abiShape) headSize() int {
+	if s.dynamic() {
+		return 32
+	}
+	switch s.Kind {
+	case shapeArray:
+		return s.Size * s.Elem.headSize()
+	case shapeTuple:
+		size := 0
+		for _, field := range s.Fields {
+			size += field.headSize()
+		}
+		return size
+	}
+	return 32
+}
+
+// parseSignatureShapes parses the parameter types of a canonical function
+// signature, such as withdraw(address,uint256,address)
+func parseSignatureShapes(signature string) ([]*abiShape, error) {
+	open := strings.IndexByte(signature, '(')
+	if open <= 0 || !strings.HasSuffix(signature, ")") {
+		return nil, fmt.Errorf("invalid function signature %q", signature)
+	}
+	tuple, err := parseShape(signature[open:])
+	if err != nil {
+		return nil, fmt.Errorf("invalid function signature %q: %w", signature, err)
+	}
+	return tuple.Fields, nil
+}
+
+// parseShape parses a canonical ABI type
+func parseShape(t string) (*abiShape, error) {
+	// Array suffixes bind last, so the outermost array is the rightmost one
+	if strings.HasSuffix(t, "]") {
+		open := strings.LastIndexByte(t, '[')
+		if open < 0 {
+			return nil, fmt.Errorf("invalid array type %q", t)
+		}
+		elem, err := parseShape(t[:open])
+		if err != nil {
+			return nil, err
+		}
+		size := -1
+		if length := t[open+1 : len(t)-1]; length != "" {
+			if size, err = strconv.Atoi(length); err != nil || size <= 0 {
+				return nil, fmt.Errorf("invalid array length in %q", t)
+			}
+		}
+		return &abiShape{Kind: shapeArray, Size: size, Elem: elem}, nil
+	}
+
+	if strings.HasPrefix(t, "(") {
+		if !strings.HasSuffix(t, ")") {
+			return nil, fmt.Errorf("invalid tuple type %q", t)
+		}
+		tuple := &abiShape{Kind: shapeTuple}
+		inner := t[1 : len(t)-1]
+		if inner == "" {
+			return tuple, nil
+		}
+		depth, start := 0, 0
+		for i := 0; i <= len(inner); i++ {
+			if i < len(inner) {
+				switch inner[i] {
+				case '(':
+					depth++
+				case ')':
+					depth--
+				}
+				if inner[i] != ',' || depth > 0 {
+					continue
+				}
+			}
+			field, err := parseShape(inner[start:i])
+			if err != nil {
+				return nil, err
+			}
+			tuple.Fields = append(tuple.Fields, field)
+			start = i + 1
+		}
+		return tuple, nil
+	}
+
+	switch {
+	case t == "address":
+		return &abiShape{Kind: shapeAddress}, nil
+	case t == "bool":
+		return &abiShape{Kind: shapeBool}, nil
+	case t == "bytes" || t == "string":
+		return &abiShape{Kind: shapeBytes}, nil
+	case strings.HasPrefix(t, "uint"), strings.HasPrefix(t, "int"):
+		kind, digits := shapeUint, strings.TrimPrefix(t, "uint")
+		if !strings.HasPrefix(t, "uint") {
+			kind, digits = shapeInt, strings.TrimPrefix(t, "int")
+		}
+		bits, err := strconv.Atoi(digits)
+		if err != nil || bits <= 0 || bits > 256 || bits%8 != 0 {
+			return nil, fmt.Errorf("invalid integer type %q", t)
+		}
+		return &abiShape{Kind: kind, Size: bits}, nil
+	case strings.HasPrefix(t, "bytes"):
+		size, err := strconv.Atoi(strings.TrimPrefix(t, "bytes"))
+		if err != nil || size <= 0 || size > 32 {
+			return nil, fmt.Errorf("invalid fixed bytes type %q", t)
+		}
+		return &abiShape{Kind: shapeFixedBytes, Size: size}, nil
+	}
+	return nil, fmt.Errorf("unsupported type %q", t)
+}
+
+// CheckCalldataShape verifies that calldata is a well-formed encoding of the
+// parameters of the function registered for its selector: every argument is
+// present, addresses, booleans and small integers are correctly padded, and
+// offsets and lengths of dynamic values stay within the calldata. Bytes
+// appended after the encoding, such as referral tags, are allowed.
+func (d *DecoderSet) CheckCalldataShape(selector string, calldata []byte) error {
+	shapes, ok := d.shapes[selector]
+	if !ok {
+		return fmt.Errorf("no parameter shapes for selector 0x%s", selector)
+	}
+	return checkTupleShape(calldata[4:], shapes, "")
+}
+
+// checkTupleShape checks the encoding of a sequence of values starting at data
+func checkTupleShape(data []byte, fields []*abiShape, path string) error {
+	offset := 0
+	for i, field := range fields {
+		name := path + "[" + strconv.Itoa(i) + "]"
+		if offset+field.headSize() > len(data) {
+			return fmt.Errorf("argument %s missing: %d bytes", name, len(data))
+		}
+		value := data[offset:]
+		if field.dynamic() {
+			pointer := new(big.Int).SetBytes(data[offset : offset+32])
+			if !pointer.IsInt64() || pointer.Int64() > int64(len(data)) {
+				return fmt.Errorf("argument %s offset %s out of bounds", name, pointer)
+			}
+			if pointer.Int64()%32 != 0 {
+				return fmt.Errorf("argument %s offset %s is not word aligned", name, pointer)
+			}
+			value = data[pointer.Int64():]
+		}
+		if err := checkValueShape(value, field, name); err != nil {
+			return err
+		}
+		offset += field.headSize()
+	}
+	return nil
+}
+
+// checkValueShape checks the encoding of one value starting at data
+func checkValueShape(data []byte, shape *abiShape, name string) error {
+	switch shape.Kind {
+	case shapeTuple:
+		return checkTupleShape(data, shape.Fields, name)
+	case shapeArray:
+		if shape.Size >= 0 {
+			return checkTupleShape(data, repeatShape(shape.Elem, shape.Size), name)
+		}
+		length, err := checkLength(data, shape.Elem.headSize(), name)
+		if err != nil {
+			return err
+		}
+		return checkTupleShape(data[32:], repeatShape(shape.Elem, length), name)
+	case shapeBytes:
+		_, err := checkLength(data, 1, name)
+		return err
+	}
+
+	if len(data) < 32 {
+		return fmt.Errorf("argument %s missing: %d bytes", name, len(data))
+	}
+	word := data[:32]
+	switch shape.Kind {
+	case shapeAddress:
+		if !allBytes(word[:12], 0) {
+			return fmt.Errorf("argument %s is not a padded address", name)
+		}
+	case shapeBool:
+		if !allBytes(word[:31], 0) || word[31] > 1 {
+			return fmt.Errorf("argument %s is not a boolean", name)
+		}
+	case shapeUint:
+		if !allBytes(word[:32-shape.Size/8], 0) {
+			return fmt.Errorf("argument %s overflows uint%d", name, shape.Size)
+		}
+	case shapeInt:
+		// The unused bytes extend the sign bit of the value
+		pad := byte(0)
+		if word[32-shape.Size/8]&0x80 != 0 {
+			pad = 0xff
+		}
+		if !allBytes(word[:32-shape.Size/8], pad) {
+			return fmt.Errorf("argument %s overflows int%d", name, shape.Size)
+		}
+	case shapeFixedBytes:
+		if !allBytes(word[shape.Size:], 0) {
+			return fmt.Errorf("argument %s is not padded bytes%d", name, shape.Size)
+		}
+	}
+	return nil
+}
+
+// checkLength reads the length prefix of a dynamic value and checks that its
+// items of itemSize bytes fit in data
+func checkLength(data []byte, itemSize int, name string) (int, error) {
+	if len(data) < 32 {
+		return 0, fmt.Errorf("argument %s length missing", name)
+	}
+	length := new(big.Int).SetBytes(data[:32])
+	if itemSize > 0 && (!length.IsInt64() || length.Int64() > int64((len(data)-32)/itemSize)) {
+		return 0, fmt.Errorf("argument %s length %s out of bounds", name, length)
+	}
+	return int(length.Int64()), nil
+}
+
+// repeatShape returns n copies of a shape, the fields of an array's encoding
+func repeatShape(shape *abiShape, n int) []*abiShape {
+	shapes := make([]*abiShape, n)
+	for i := range shapes {
+		shapes[i] = shape
+	}
+	return shapes
+}
+
+// allBytes reports whether every byte of b equals v
+func allBytes(b []byte, v byte) bool {
+	for _, x := range b {
+		if x != v {
+			return false
+		}
+	}
+	return true
+}
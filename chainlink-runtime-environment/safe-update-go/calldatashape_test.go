@@ -0,0 +1,234 @@
+//go:build wasip1
+
+package main
+
+import (
+	"log/slog"
+	"math/big"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// shapeString renders a shape back as its canonical ABI type
+func shapeString(s *abiShape) string {
+	switch s.Kind {
+	case shapeAddress:
+		return "address"
+	case shapeBool:
+		return "bool"
+	case shapeUint:
+		return "uint" + strconv.Itoa(s.Size)
+	case shapeInt:
+		return "int" + strconv.Itoa(s.Size)
+	case shapeFixedBytes:
+		return "bytes" + strconv.Itoa(s.Size)
+	case shapeBytes:
+		return "bytes"
+	case shapeArray:
+		if s.Size < 0 {
+			return shapeString(s.Elem) + "[]"
+		}
+		return shapeString(s.Elem) + "[" + strconv.Itoa(s.Size) + "]"
+	}
+	fields := make([]string, len(s.Fields))
+	for i, field := range s.Fields {
+		fields[i] = shapeString(field)
+	}
+	return "(" + strings.Join(fields, ",") + ")"
+}
+
+func TestParseSignatureShapes(t *testing.T) {
+	tests := []struct {
+		signature string
+		// want is the rendered parameters, with string read as bytes
+		want    string
+		dynamic []bool
+		// head is the size of the arguments' head
+		head int
+	}{
+		{"withdraw(address,uint256,address)", "(address,uint256,address)", []bool{false, false, false}, 96},
+		{"claim()", "()", []bool{}, 0},
+		{"f(bool,int24,uint8,bytes32,bytes1)", "(bool,int24,uint8,bytes32,bytes1)", []bool{false, false, false, false, false}, 160},
+		{"f(bytes,string)", "(bytes,bytes)", []bool{true, true}, 64},
+		{"f(uint256[],address[3])", "(uint256[],address[3])", []bool{true, false}, 128},
+		{"f(uint256[2][3])", "(uint256[2][3])", []bool{false}, 192},
+		{"f(uint256[][2])", "(uint256[][2])", []bool{true}, 32},
+		{"f((address,uint256),(address,bytes))", "((address,uint256),(address,bytes))", []bool{false, true}, 96},
+		{"f((address,(uint256,bool)[])[],uint256)", "((address,(uint256,bool)[])[],uint256)", []bool{true, false}, 64},
+		{"execute(bytes,bytes[],uint256)", "(bytes,bytes[],uint256)", []bool{true, true, false}, 96},
+	}
+	for _, tt := range tests {
+		t.Run(tt.signature, func(t *testing.T) {
+			shapes, err := parseSignatureShapes(tt.signature)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tuple := &abiShape{Kind: shapeTuple, Fields: shapes}
+			if got := shapeString(tuple); got != tt.want {
+				t.Errorf("parsed %s", got)
+			}
+			head := 0
+			for i, shape := range shapes {
+				if shape.dynamic() != tt.dynamic[i] {
+					t.Errorf("argument %d dynamic %t", i, shape.dynamic())
+				}
+				head += shape.headSize()
+			}
+			if head != tt.head {
+				t.Errorf("head size %d, want %d", head, tt.head)
+			}
+		})
+	}
+}
+
+func TestParseSignatureShapesRejects(t *testing.T) {
+	for _, signature := range []string{
+		"withdraw",
+		"(uint256)",
+		"f(uint256",
+		"f(uint)",
+		"f(uint7)",
+		"f(uint264)",
+		"f(int0)",
+		"f(bytes0)",
+		"f(bytes33)",
+		"f(uint256[0])",
+		"f(uint256[x])",
+		"f(uint256])",
+		"f((address,uint256)",
+		"f(fixed128x18)",
+		"f(address,,uint256)",
+	} {
+		if shapes, err := parseSignatureShapes(signature); err == nil {
+			t.Errorf("parsed %s as %s", signature, shapeString(&abiShape{Kind: shapeTuple, Fields: shapes}))
+		}
+	}
+}
+
+// shapeTestSignature covers every kind of value the shape check reads
+const shapeTestSignature = "f(address,bool,uint8,int8,bytes4,bytes,uint256[],(address,uint256)[2])"
+
+// shapeTestCalldata packs the arguments of shapeTestSignature, without the selector
+func shapeTestCalldata(t *testing.T) []byte {
+	t.Helper()
+	newType := func(name string, components []abi.ArgumentMarshaling) abi.Type {
+		typ, err := abi.NewType(name, "", components)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return typ
+	}
+	pair := []abi.ArgumentMarshaling{{Name: "token", Type: "address"}, {Name: "amount", Type: "uint256"}}
+	arguments := abi.Arguments{
+		{Type: newType("address", nil)},
+		{Type: newType("bool", nil)},
+		{Type: newType("uint8", nil)},
+		{Type: newType("int8", nil)},
+		{Type: newType("bytes4", nil)},
+		{Type: newType("bytes", nil)},
+		{Type: newType("uint256[]", nil)},
+		{Type: newType("tuple[2]", pair)},
+	}
+	type tokenAmount struct {
+		Token  common.Address
+		Amount *big.Int
+	}
+	data, err := arguments.Pack(
+		common.HexToAddress("0x00000000000000000000000000000000000000cc"),
+		true,
+		uint8(7),
+		int8(-2),
+		[4]byte{0xde, 0xad, 0xbe, 0xef},
+		[]byte{1, 2, 3},
+		[]*big.Int{big.NewInt(1), big.NewInt(2)},
+		[2]tokenAmount{{common.HexToAddress("0xbb"), big.NewInt(3)}, {common.HexToAddress("0xaa"), big.NewInt(4)}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestCheckTupleShape(t *testing.T) {
+	shapes, err := parseSignatureShapes(shapeTestSignature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Head: 0 address, 32 bool, 64 uint8, 96 int8, 128 bytes4, 160 bytes
+	// offset, 192 array offset, 224-351 the tuples. Tail: 352 the bytes
+	// length and 384 their word, 416 the array length and 448-511 its items.
+	valid := shapeTestCalldata(t)
+	if len(valid) != 512 {
+		t.Fatalf("packed %d bytes", len(valid))
+	}
+
+	tests := []struct {
+		name   string
+		mutate func([]byte) []byte
+		ok     bool
+	}{
+		{"valid", func(b []byte) []byte { return b }, true},
+		{"trailing bytes", func(b []byte) []byte { return append(b, 0xca, 0xfe) }, true},
+		{"truncated", func(b []byte) []byte { return b[:len(b)-1] }, false},
+		{"missing head", func(b []byte) []byte { return b[:200] }, false},
+		{"dirty address", func(b []byte) []byte { b[0] = 1; return b }, false},
+		{"dirty tuple address", func(b []byte) []byte { b[224] = 1; return b }, false},
+		{"bool 2", func(b []byte) []byte { b[63] = 2; return b }, false},
+		{"uint8 overflow", func(b []byte) []byte { b[94] = 1; return b }, false},
+		{"int8 not sign extended", func(b []byte) []byte { b[96] = 0; return b }, false},
+		{"bytes4 dirty padding", func(b []byte) []byte { b[132] = 1; return b }, false},
+		{"offset out of bounds", func(b []byte) []byte { b[190] = 0xff; return b }, false},
+		{"offset not aligned", func(b []byte) []byte { b[191]++; return b }, false},
+		{"bytes length out of bounds", func(b []byte) []byte { b[382] = 0xff; return b }, false},
+		{"array length out of bounds", func(b []byte) []byte { b[447] = 3; return b }, false},
+		{"array length overflows int64", func(b []byte) []byte { b[416] = 0xff; return b }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := tt.mutate(append([]byte{}, valid...))
+			err := checkTupleShape(data, shapes, "")
+			if tt.ok && err != nil {
+				t.Errorf("rejected: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Error("accepted")
+			}
+		})
+	}
+}
+
+// TestDecodeActionShapeDowngrade expects decoded calldata that no ABI encoder
+// produces to be downgraded to heuristic confidence, and well-formed calldata
+// with appended bytes to keep the exact ABI confidence
+func TestDecodeActionShapeDowngrade(t *testing.T) {
+	asset := common.HexToAddress("0x6B175474E89094C44Da98b954EedeAC495271d0F")
+	safe := common.HexToAddress("0x00000000000000000000000000000000000000cc")
+	logger := slog.New(slog.DiscardHandler)
+
+	tests := []struct {
+		name   string
+		mutate func([]byte) []byte
+		want   Confidence
+	}{
+		{"well formed", func(b []byte) []byte { return b }, ConfidenceExactABI},
+		{"referral tag", func(b []byte) []byte { return append(b, 0x12, 0x34, 0x56, 0x78) }, ConfidenceExactABI},
+		{"dirty asset padding", func(b []byte) []byte { b[4] = 1; return b }, ConfidenceHeuristic},
+		{"dirty recipient padding", func(b []byte) []byte { b[68] = 1; return b }, ConfidenceHeuristic},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calldata := tt.mutate(wordCalldata(t, AaveWithdrawSelector, asset, big.NewInt(1), safe))
+			action, err := DecodeAction(logger, aaveTestPool, calldata)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if action.Confidence != tt.want {
+				t.Errorf("confidence %s, want %s", action.Confidence, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,491 @@
+// Command scaffold-decoder generates the decoder of a protocol function from
+// its ABI: a decoder_<protocol>.go file with the selector, its registration
+// and a decoder crediting one token amount, and a test skeleton decoding
+// calldata packed from the ABI.
+//
+//	go run ./cmd/scaffold-decoder --abi pool.json --fn withdraw --token-param asset --amount-param amount
+//
+// The ABI may be a plain ABI array or a compiler artifact with an "abi" key.
+// Overloaded functions are selected by signature, such as
+// --fn "withdraw(address,uint256,address)". Without --token-param the amount
+// is credited in the called contract, as for vault shares. The generated
+// files are a starting point: settling amounts from the receipt, review
+// reasons and the README entry are left to the author.
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/format"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+)
+
+// options represents the command line of the scaffold
+type options struct {
+	abiPath        string
+	fn             string
+	tokenParam     string
+	amountParam    string
+	recipientParam string
+	protocol       string
+	name           string
+	verb           string
+	out            string
+	force          bool
+}
+
+// param represents an argument the decoder reads from the calldata head
+type param struct {
+	Name  string
+	Var   string
+	Index int
+}
+
+// scaffold represents the values the templates are rendered with
+type scaffold struct {
+	Protocol    string
+	Name        string
+	Ident       string
+	Method      string
+	MethodIdent string
+	Selector    string
+	Signature   string
+	Canonical   string
+	Verb        string
+	Token       *param
+	Amount      param
+	Recipient   *param
+	FragmentABI string
+	Args        []string
+	AmountArg   string
+	Unsupported string
+}
+
+// verbs maps the --verb values to the Verb constants of the workflow
+var verbs = map[string]string{
+	"withdraw": "VerbWithdraw",
+	"claim":    "VerbClaim",
+	"swap":     "VerbSwap",
+}
+
+func main() {
+	var opts options
+	flag.StringVar(&opts.abiPath, "abi", "", "ABI or compiler artifact JSON file (required)")
+	flag.StringVar(&opts.fn, "fn", "", "function name, or signature if overloaded (required)")
+	flag.StringVar(&opts.tokenParam, "token-param", "", "address argument holding the token; the called contract if empty")
+	flag.StringVar(&opts.amountParam, "amount-param", "", "uint argument holding the amount (required)")
+	flag.StringVar(&opts.recipientParam, "recipient-param", "", "address argument receiving the funds, if any")
+	flag.StringVar(&opts.protocol, "protocol", "", "protocol name; the ABI file name if empty")
+	flag.StringVar(&opts.name, "name", "", "protocol name in comments and logs; the capitalized protocol if empty")
+	flag.StringVar(&opts.verb, "verb", "withdraw", "action verb: withdraw, claim or swap")
+	flag.StringVar(&opts.out, "out", ".", "directory to write the files to")
+	flag.BoolVar(&opts.force, "force", false, "overwrite existing files")
+	flag.Parse()
+
+	if err := run(opts); err != nil {
+		fmt.Fprintln(os.Stderr, "scaffold-decoder:", err)
+		os.Exit(1)
+	}
+}
+
+// run generates and writes the decoder and test files
+func run(opts options) error {
+	if opts.abiPath == "" || opts.fn == "" || opts.amountParam == "" {
+		return fmt.Errorf("--abi, --fn and --amount-param are required")
+	}
+	if _, ok := verbs[opts.verb]; !ok {
+		return fmt.Errorf("unknown verb %q", opts.verb)
+	}
+	if opts.protocol == "" {
+		opts.protocol = strings.TrimSuffix(filepath.Base(opts.abiPath), filepath.Ext(opts.abiPath))
+	}
+	opts.protocol = strings.ToLower(strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, opts.protocol))
+	if opts.protocol == "" || !unicode.IsLetter(rune(opts.protocol[0])) {
+		return fmt.Errorf("protocol name must start with a letter")
+	}
+	if opts.name == "" {
+		opts.name = capitalize(opts.protocol)
+	}
+
+	data, err := os.ReadFile(opts.abiPath)
+	if err != nil {
+		return fmt.Errorf("failed to read ABI: %w", err)
+	}
+	fragment, method, err := findMethod(data, opts.fn)
+	if err != nil {
+		return err
+	}
+	s, err := newScaffold(opts, fragment, method)
+	if err != nil {
+		return err
+	}
+
+	// Selectors are registered once, so a collision panics when the workflow
+	// starts. The decoder file overwritten with --force does not count.
+	skip := ""
+	if opts.force {
+		skip = "decoder_" + s.Protocol + ".go"
+	}
+	if existing, err := registeredIn(opts.out, s.Selector, skip); err != nil {
+		return err
+	} else if existing != "" {
+		return fmt.Errorf("selector 0x%s of %s is already declared in %s", s.Selector, s.Signature, existing)
+	}
+
+	files := map[string]*template.Template{
+		"decoder_" + s.Protocol + ".go":      decoderTemplate,
+		"decoder_" + s.Protocol + "_test.go": testTemplate,
+	}
+	for name, tmpl := range files {
+		path := filepath.Join(opts.out, name)
+		if _, err := os.Stat(path); err == nil && !opts.force {
+			return fmt.Errorf("%s exists, use --force to overwrite", path)
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, s); err != nil {
+			return fmt.Errorf("failed to render %s: %w", name, err)
+		}
+		source, err := format.Source(buf.Bytes())
+		if err != nil {
+			return fmt.Errorf("failed to format %s: %w", name, err)
+		}
+		if err := os.WriteFile(path, source, 0o644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", path, err)
+		}
+		fmt.Println("wrote", path)
+	}
+	fmt.Printf("selector 0x%s %s\n", s.Selector, s.Signature)
+	return nil
+}
+
+// registeredIn returns the decoder file of a directory declaring a selector,
+// if any, other than the skipped file
+func registeredIn(dir string, selector string, skip string) (string, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "decoder_*.go"))
+	if err != nil {
+		return "", err
+	}
+	for _, path := range paths {
+		if filepath.Base(path) == skip {
+			continue
+		}
+		source, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		if bytes.Contains(source, []byte(`"`+selector+`"`)) {
+			return filepath.Base(path), nil
+		}
+	}
+	return "", nil
+}
+
+// findMethod returns the ABI entry of a function, by name or signature, and the parsed method
+func findMethod(data []byte, fn string) (json.RawMessage, abi.Method, error) {
+	var artifact struct {
+		ABI []json.RawMessage `json:"abi"`
+	}
+	var entries []json.RawMessage
+	if err := json.Unmarshal(data, &entries); err != nil {
+		if err := json.Unmarshal(data, &artifact); err != nil || artifact.ABI == nil {
+			return nil, abi.Method{}, fmt.Errorf("ABI must be a JSON array or an artifact with an abi key")
+		}
+		entries = artifact.ABI
+	}
+
+	var found []json.RawMessage
+	var methods []abi.Method
+	for _, entry := range entries {
+		parsed, err := abi.JSON(bytes.NewReader(append(append([]byte("["), entry...), ']')))
+		if err != nil {
+			return nil, abi.Method{}, fmt.Errorf("failed to parse ABI entry: %w", err)
+		}
+		for _, method := range parsed.Methods {
+			if method.RawName == fn || method.Sig == fn {
+				found = append(found, entry)
+				methods = append(methods, method)
+			}
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return nil, abi.Method{}, fmt.Errorf("no function %s in ABI", fn)
+	case 1:
+		return found[0], methods[0], nil
+	default:
+		sigs := make([]string, len(methods))
+		for i, method := range methods {
+			sigs[i] = method.Sig
+		}
+		return nil, abi.Method{}, fmt.Errorf("%s is overloaded, select one of %s", fn, strings.Join(sigs, ", "))
+	}
+}
+
+// newScaffold resolves the arguments the decoder reads and the test packs
+func newScaffold(opts options, fragment json.RawMessage, method abi.Method) (*scaffold, error) {
+	s := &scaffold{
+		Protocol:    opts.protocol,
+		Name:        opts.name,
+		Ident:       capitalize(opts.protocol) + capitalize(method.RawName),
+		Method:      method.RawName,
+		MethodIdent: capitalize(method.RawName),
+		Selector:    hex.EncodeToString(method.ID),
+		Signature:   signature(method),
+		Canonical:   method.Sig,
+		Verb:        verbs[opts.verb],
+		FragmentABI: "[" + string(fragment) + "]",
+	}
+
+	index := 0
+	for _, input := range method.Inputs {
+		p := param{Name: input.Name, Var: goName(input.Name), Index: index}
+		arg := zeroValue(input.Type)
+		switch input.Name {
+		case opts.tokenParam:
+			if input.Type.T != abi.AddressTy {
+				return nil, fmt.Errorf("token param %s is %s, not address", input.Name, input.Type)
+			}
+			s.Token, arg = &p, "token"
+		case opts.amountParam:
+			if input.Type.T != abi.UintTy {
+				return nil, fmt.Errorf("amount param %s is %s, not uint", input.Name, input.Type)
+			}
+			s.Amount, arg = p, amountValue(input.Type)
+			s.AmountArg = arg
+		case opts.recipientParam:
+			if input.Type.T != abi.AddressTy {
+				return nil, fmt.Errorf("recipient param %s is %s, not address", input.Name, input.Type)
+			}
+			s.Recipient, arg = &p, "recipient"
+		}
+		if arg == "" {
+			if s.Unsupported == "" {
+				s.Unsupported = fmt.Sprintf("argument %s of type %s", input.Name, input.Type)
+			}
+			arg = "nil"
+		}
+		s.Args = append(s.Args, arg)
+		index += headWords(input.Type)
+	}
+
+	for flagName, p := range map[string]bool{
+		opts.amountParam:    s.AmountArg != "",
+		opts.tokenParam:     opts.tokenParam == "" || s.Token != nil,
+		opts.recipientParam: opts.recipientParam == "" || s.Recipient != nil,
+	} {
+		if !p {
+			return nil, fmt.Errorf("no argument %s in %s", flagName, method.Sig)
+		}
+	}
+	return s, nil
+}
+
+// signature returns the signature of a method with its argument names
+func signature(method abi.Method) string {
+	args := make([]string, len(method.Inputs))
+	for i, input := range method.Inputs {
+		args[i] = strings.TrimSpace(input.Type.String() + " " + input.Name)
+	}
+	return method.RawName + "(" + strings.Join(args, ", ") + ")"
+}
+
+// isDynamic reports whether a type is encoded in the tail of the calldata
+func isDynamic(t abi.Type) bool {
+	switch t.T {
+	case abi.StringTy, abi.BytesTy, abi.SliceTy:
+		return true
+	case abi.ArrayTy:
+		return isDynamic(*t.Elem)
+	case abi.TupleTy:
+		for _, elem := range t.TupleElems {
+			if isDynamic(*elem) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// headWords returns the number of 32 bytes words a type takes in the calldata head
+func headWords(t abi.Type) int {
+	if isDynamic(t) {
+		return 1
+	}
+	switch t.T {
+	case abi.ArrayTy:
+		return t.Size * headWords(*t.Elem)
+	case abi.TupleTy:
+		words := 0
+		for _, elem := range t.TupleElems {
+			words += headWords(*elem)
+		}
+		return words
+	}
+	return 1
+}
+
+// zeroValue returns a Go expression packing as the zero value of a type, or
+// an empty string for tuples, which the test skeleton cannot fill in
+func zeroValue(t abi.Type) string {
+	goType := t.GetType().String()
+	switch {
+	case strings.Contains(goType, "struct"):
+		return ""
+	case goType == "*big.Int":
+		return "new(big.Int)"
+	}
+	return "*new(" + goType + ")"
+}
+
+// amountValue returns the amount the test skeleton packs, in the Go type of the uint
+func amountValue(t abi.Type) string {
+	if goType := t.GetType().String(); goType != "*big.Int" {
+		return goType + "(1000000)"
+	}
+	return "big.NewInt(1000000)"
+}
+
+// goName returns a Go variable name for an argument
+func goName(name string) string {
+	name = strings.TrimLeft(name, "_")
+	if name == "" {
+		return "arg"
+	}
+	return strings.ToLower(name[:1]) + name[1:]
+}
+
+// capitalize upper-cases the first letter of an identifier
+func capitalize(s string) string {
+	s = strings.TrimLeft(s, "_")
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// decoderTemplate renders the decoder file
+var decoderTemplate = template.Must(template.New("decoder").Parse(`//go:build wasip1
+
+package main
+
+import (
+	"log/slog"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// {{.Name}} {{.Signature}}
+const {{.Ident}}Selector = "{{.Selector}}"
+
+// {{.Protocol}}Protocol is the protocol name of {{.Name}} actions
+const {{.Protocol}}Protocol = "{{.Protocol}}"
+
+func init() {
+	RegisterDecoder({{.Ident}}Selector, "{{.Canonical}}", decode{{.Ident}})
+}
+
+// decode{{.Ident}} decodes {{.Signature}} on {{.Name}}{{if not .Token}}, crediting the amount in the called contract{{end}}
+func decode{{.Ident}}(logger *slog.Logger, target common.Address, calldata []byte) (*Action, error) {
+{{- with .Token}}
+	{{.Var}}, err := calldataAddress(calldata, {{.Index}})
+	if err != nil {
+		return nil, err
+	}
+{{- end}}
+	{{.Amount.Var}}, err := calldataUint(calldata, {{.Amount.Index}})
+	if err != nil {
+		return nil, err
+	}
+{{- with .Recipient}}
+	{{.Var}}, err := calldataAddress(calldata, {{.Index}})
+	if err != nil {
+		return nil, err
+	}
+{{- end}}
+
+	logger.Info("{{.Name}} {{.Method}}", "target", target.Hex(){{with .Token}}, "{{.Name}}", {{.Var}}.Hex(){{end}}, "{{.Amount.Name}}", {{.Amount.Var}}.String())
+
+	return &Action{
+		Protocol: {{.Protocol}}Protocol,
+		Verb:     {{.Verb}},
+		AssetsIn: []AssetAmount{ {Token: {{with .Token}}{{.Var}}{{else}}target{{end}}, Amount: {{.Amount.Var}}} },
+{{- with .Recipient}}
+		Recipient: {{.Var}},
+{{- end}}
+	}, nil
+}
+`))
+
+// testTemplate renders the test skeleton
+var testTemplate = template.Must(template.New("test").Parse(`//go:build wasip1
+
+package main
+
+import (
+	"log/slog"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// {{.Protocol}}{{.MethodIdent}}ABI is the ABI of {{.Signature}}
+const {{.Protocol}}{{.MethodIdent}}ABI = ` + "`{{.FragmentABI}}`" + `
+
+// TestDecode{{.Ident}} decodes calldata packed from the ABI
+func TestDecode{{.Ident}}(t *testing.T) {
+{{- if .Unsupported}}
+	t.Skip("fill in {{.Unsupported}}")
+{{- end}}
+	parsed, err := abi.JSON(strings.NewReader({{.Protocol}}{{.MethodIdent}}ABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+{{- if .Token}}
+	token := common.HexToAddress("0x00000000000000000000000000000000000000bb")
+{{- end}}
+{{- if .Recipient}}
+	recipient := common.HexToAddress("0x00000000000000000000000000000000000000cc")
+{{- end}}
+
+	calldata, err := parsed.Pack("{{.Method}}"{{range .Args}}, {{.}}{{end}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	action, err := DecodeAction(slog.New(slog.DiscardHandler), target, calldata)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if action.Protocol != {{.Protocol}}Protocol || action.Verb != {{.Verb}} {
+		t.Errorf("decoded %s %s", action.Protocol, action.Verb)
+	}
+	if len(action.AssetsIn) != 1 || action.AssetsIn[0].Token != {{if .Token}}token{{else}}target{{end}} || action.AssetsIn[0].Amount.Cmp(big.NewInt(1000000)) != 0 {
+		t.Errorf("assets in %+v", action.AssetsIn)
+	}
+{{- if .Recipient}}
+	if action.Recipient != recipient {
+		t.Errorf("recipient %s", action.Recipient.Hex())
+	}
+{{- end}}
+	// TODO: cover the edge cases of {{.Name}}, such as type(uint256).max amounts
+}
+`))
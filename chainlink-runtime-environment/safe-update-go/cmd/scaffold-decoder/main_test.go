@@ -0,0 +1,98 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// update rewrites the golden files with the generated output
+var update = flag.Bool("update", false, "rewrite the golden files")
+
+// TestRunGolden scaffolds the decoder of testdata/pool.json and compares the
+// generated files with the golden files. Run with -update after changing the
+// templates, and review the diff of the golden files.
+func TestRunGolden(t *testing.T) {
+	tests := []struct {
+		name string
+		opts options
+	}{
+		{"token", options{fn: "withdraw", tokenParam: "asset", amountParam: "amount", recipientParam: "to", verb: "withdraw"}},
+		{"vault", options{fn: "redeem", amountParam: "shares", protocol: "vault", name: "Vault", verb: "withdraw"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := t.TempDir()
+			opts := tt.opts
+			opts.abiPath = filepath.Join("testdata", "pool.json")
+			opts.out = out
+			if err := run(opts); err != nil {
+				t.Fatal(err)
+			}
+
+			protocol := opts.protocol
+			if protocol == "" {
+				protocol = "pool"
+			}
+			for _, file := range []string{"decoder_" + protocol + ".go", "decoder_" + protocol + "_test.go"} {
+				got, err := os.ReadFile(filepath.Join(out, file))
+				if err != nil {
+					t.Fatal(err)
+				}
+				golden := filepath.Join("testdata", strings.TrimSuffix(file, ".go")+".golden")
+				if *update {
+					if err := os.WriteFile(golden, got, 0o644); err != nil {
+						t.Fatal(err)
+					}
+					continue
+				}
+				want, err := os.ReadFile(golden)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(got) != string(want) {
+					t.Errorf("%s differs from %s:\n%s", file, golden, got)
+				}
+			}
+		})
+	}
+}
+
+// TestRunRejects expects the scaffold to refuse invalid options and existing files
+func TestRunRejects(t *testing.T) {
+	abiPath := filepath.Join("testdata", "pool.json")
+	tests := []struct {
+		name string
+		opts options
+	}{
+		{"missing amount", options{abiPath: abiPath, fn: "withdraw", verb: "withdraw"}},
+		{"unknown verb", options{abiPath: abiPath, fn: "withdraw", amountParam: "amount", verb: "deposit"}},
+		{"unknown function", options{abiPath: abiPath, fn: "borrow", amountParam: "amount", verb: "withdraw"}},
+		{"token not an address", options{abiPath: abiPath, fn: "withdraw", tokenParam: "amount", amountParam: "amount", verb: "withdraw"}},
+		{"unknown amount", options{abiPath: abiPath, fn: "withdraw", amountParam: "value", verb: "withdraw"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.out = t.TempDir()
+			if err := run(tt.opts); err == nil {
+				t.Error("accepted invalid options")
+			}
+		})
+	}
+
+	t.Run("existing files", func(t *testing.T) {
+		opts := options{abiPath: abiPath, fn: "withdraw", tokenParam: "asset", amountParam: "amount", verb: "withdraw", out: t.TempDir()}
+		if err := run(opts); err != nil {
+			t.Fatal(err)
+		}
+		if err := run(opts); err == nil {
+			t.Error("overwrote existing files without --force")
+		}
+		opts.force = true
+		if err := run(opts); err != nil {
+			t.Error(err)
+		}
+	})
+}
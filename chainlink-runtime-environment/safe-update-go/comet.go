@@ -0,0 +1,91 @@
+//go:build wasip1
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/blockchain/evm"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+)
+
+// Compound III events emitted by a Comet market on withdrawal
+var (
+	cometWithdrawSignature           = crypto.Keccak256Hash([]byte("Withdraw(address,address,uint256)"))
+	cometWithdrawCollateralSignature = crypto.Keccak256Hash([]byte("WithdrawCollateral(address,address,address,uint256)"))
+)
+
+// ResolveCometWithdrawal settles a Compound III withdrawal from the market's
+// events in the receipt. A collateral withdrawal emits WithdrawCollateral. A
+// base asset withdrawal emits Withdraw with the amount actually sent, which
+// resolves type(uint256).max, and a Transfer to the zero address for the part
+// taken from the supplied balance. Any remainder was borrowed: it is split off
+// as debt, valued against the supplied part, and the action becomes a borrow.
+func ResolveCometWithdrawal(runtime cre.Runtime, evmClient *evm.Client, logger *slog.Logger, action *Action, calldata []byte, txHash []byte) error {
+	if len(action.AssetsIn) != 1 {
+		return fmt.Errorf("unexpected Compound III action with %d assets", len(action.AssetsIn))
+	}
+	asset := &action.AssetsIn[0]
+	comet := action.Counterparty
+
+	reply, err := evmClient.GetTransactionReceipt(runtime, &evm.GetTransactionReceiptRequest{Hash: txHash}).Await()
+	if err != nil {
+		return fmt.Errorf("failed to get transaction receipt: %w", err)
+	}
+	if reply.Receipt == nil {
+		return fmt.Errorf("transaction receipt not found")
+	}
+
+	var withdrawn, supplied *big.Int
+	for _, log := range reply.Receipt.Logs {
+		if common.BytesToAddress(log.Address) != comet || len(log.Topics) == 0 || len(log.Data) < 32 {
+			continue
+		}
+		amount := new(big.Int).SetBytes(log.Data[:32])
+		switch {
+		case bytes.Equal(log.Topics[0], cometWithdrawCollateralSignature.Bytes()):
+			if len(log.Topics) == 4 && common.BytesToAddress(log.Topics[3]) == asset.Token {
+				asset.Amount = amount
+				logger.Info("Compound III collateral withdrawal", "token", asset.Token.Hex(), "amount", amount.String())
+				return nil
+			}
+		case bytes.Equal(log.Topics[0], cometWithdrawSignature.Bytes()):
+			withdrawn = amount
+		case bytes.Equal(log.Topics[0], transferSignature.Bytes()):
+			if len(log.Topics) == 3 && common.BytesToAddress(log.Topics[2]) == (common.Address{}) {
+				supplied = amount
+			}
+		}
+	}
+
+	if withdrawn == nil {
+		return fmt.Errorf("no Compound III withdrawal of %s in receipt", asset.Token.Hex())
+	}
+	if supplied == nil {
+		supplied = new(big.Int)
+	}
+	if supplied.Cmp(withdrawn) > 0 {
+		supplied = withdrawn
+	}
+	borrowed := new(big.Int).Sub(withdrawn, supplied)
+
+	token := asset.Token
+	asset.Amount = supplied
+	if borrowed.Sign() > 0 {
+		action.Verb = VerbBorrow
+		debt := AssetAmount{Token: token, Amount: borrowed, Debt: true}
+		if supplied.Sign() == 0 {
+			action.AssetsIn = []AssetAmount{debt}
+		} else {
+			action.AssetsIn = append(action.AssetsIn, debt)
+		}
+	}
+	logger.Info("Compound III base withdrawal", "token", token.Hex(), "amount", withdrawn.String(),
+		"fromSupply", supplied.String(), "borrowed", borrowed.String(), "verb", string(action.Verb))
+	return nil
+}
@@ -0,0 +1,204 @@
+//go:build wasip1
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/blockchain/evm"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+)
+
+// Confidence represents how an action's assets and amounts were established
+type Confidence string
+
+const (
+	// ConfidenceExactABI is decoded by a protocol decoder written for the function
+	ConfidenceExactABI Confidence = "exact-abi"
+
+	// ConfidenceEventVerified is decoded generically and confirmed by the receipt's Transfer events
+	ConfidenceEventVerified Confidence = "event-verified"
+
+	// ConfidenceHeuristic is inferred from argument names or calldata patterns
+	ConfidenceHeuristic Confidence = "heuristic"
+)
+
+// defaultMinConfidence is required for automatic submission when no policy sets it
+const defaultMinConfidence = ConfidenceEventVerified
+
+// confidenceRank orders the confidence levels, higher is better
+var confidenceRank = map[Confidence]int{
+	ConfidenceHeuristic:     1,
+	ConfidenceEventVerified: 2,
+	ConfidenceExactABI:      3,
+}
+
+// ValidateConfidence checks a configured confidence level
+func ValidateConfidence(c Confidence) error {
+	if c == "" {
+		return nil
+	}
+	if _, ok := confidenceRank[c]; !ok {
+		return fmt.Errorf("unknown confidence %q", c)
+	}
+	return nil
+}
+
+// AtLeast reports whether a confidence level meets a minimum
+func (c Confidence) AtLeast(min Confidence) bool {
+	return confidenceRank[c] >= confidenceRank[min]
+}
+
+// receiptTransfer represents a configured token Transfer to or from the Safe
+type receiptTransfer struct {
+	Token  common.Address
+	Amount *big.Int
+	In     bool
+}
+
+// safeTransfers returns the configured token Transfer events of a transaction
+// that move funds into or out of the Safe of the active module
+func safeTransfers(config *Config, runtime cre.Runtime, evmClient *evm.Client, txHash []byte) ([]receiptTransfer, error) {
+	avatar, err := GetAvatar(runtime, evmClient, ActiveTarget(config).ModuleAddress.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := evmClient.GetTransactionReceipt(runtime, &evm.GetTransactionReceiptRequest{Hash: txHash}).Await()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transaction receipt: %w", err)
+	}
+	if reply.Receipt == nil {
+		return nil, fmt.Errorf("transaction receipt not found")
+	}
+
+	var transfers []receiptTransfer
+	for _, log := range reply.Receipt.Logs {
+		if len(log.Topics) < 3 || len(log.Data) < 32 || !bytes.Equal(log.Topics[0], transferSignature.Bytes()) {
+			continue
+		}
+		token := common.BytesToAddress(log.Address)
+		if findTokenConfig(config, token) == nil {
+			continue
+		}
+		amount := new(big.Int).SetBytes(log.Data[:32])
+		switch avatar {
+		case common.BytesToAddress(log.Topics[2]):
+			transfers = append(transfers, receiptTransfer{Token: token, Amount: amount, In: true})
+		case common.BytesToAddress(log.Topics[1]):
+			transfers = append(transfers, receiptTransfer{Token: token, Amount: amount, In: false})
+		}
+	}
+	return transfers, nil
+}
+
+// netTransfers nets the transfers of each token, in the order the tokens
+// first moved: a net inflow is an asset in and a net outflow an asset out
+func netTransfers(transfers []receiptTransfer) (in []AssetAmount, out []AssetAmount) {
+	var tokens []common.Address
+	net := make(map[common.Address]*big.Int)
+	for _, t := range transfers {
+		if net[t.Token] == nil {
+			net[t.Token] = new(big.Int)
+			tokens = append(tokens, t.Token)
+		}
+		if t.In {
+			net[t.Token].Add(net[t.Token], t.Amount)
+		} else {
+			net[t.Token].Sub(net[t.Token], t.Amount)
+		}
+	}
+	for _, token := range tokens {
+		switch net[token].Sign() {
+		case 1:
+			in = append(in, AssetAmount{Token: token, Amount: net[token]})
+		case -1:
+			out = append(out, AssetAmount{Token: token, Amount: new(big.Int).Neg(net[token])})
+		}
+	}
+	return in, out
+}
+
+// netSettledProtocols are the protocols whose batches can move funds both
+// ways, settled from the Safe's net transfers instead of their calldata
+var netSettledProtocols = map[string]bool{
+	eulerProtocol:   true,
+	gearboxProtocol: true,
+}
+
+// SettleNetTransfers replaces the assets of an action with the Safe's net
+// Transfer events of each configured token in the receipt, so the legs of a
+// batch that pay into a protocol offset the legs that pay out of it
+func SettleNetTransfers(config *Config, runtime cre.Runtime, evmClient *evm.Client, logger *slog.Logger, action *Action, txHash []byte) error {
+	transfers, err := safeTransfers(config, runtime, evmClient, txHash)
+	if err != nil {
+		return err
+	}
+	action.AssetsIn, action.AssetsOut = netTransfers(transfers)
+	logger.Info("Action settled from net transfers", "protocol", action.Protocol, "transfers", len(transfers),
+		"assetsIn", len(action.AssetsIn), "assetsOut", len(action.AssetsOut))
+	return nil
+}
+
+// matchesTransfers reports whether every asset of an action has a Transfer of
+// the same token, amount and direction
+func matchesTransfers(action *Action, transfers []receiptTransfer) bool {
+	check := func(assets []AssetAmount, in bool) bool {
+		for _, asset := range assets {
+			found := false
+			for _, t := range transfers {
+				if t.In == in && t.Token == asset.Token && t.Amount.Cmp(asset.Amount) == 0 {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+		return true
+	}
+	return len(action.AssetsIn)+len(action.AssetsOut) > 0 && check(action.AssetsIn, true) && check(action.AssetsOut, false)
+}
+
+// VerifyWithTransfers upgrades a heuristic action to event-verified when the
+// receipt's Transfer events confirm every asset it moves
+func VerifyWithTransfers(config *Config, runtime cre.Runtime, evmClient *evm.Client, logger *slog.Logger, action *Action, txHash []byte) {
+	if action.Confidence != ConfidenceHeuristic {
+		return
+	}
+	transfers, err := safeTransfers(config, runtime, evmClient, txHash)
+	if err != nil {
+		logger.Warn("Failed to verify action with receipt", "error", err.Error())
+		return
+	}
+	if matchesTransfers(action, transfers) {
+		action.Confidence = ConfidenceEventVerified
+		logger.Info("Action verified by Transfer events", "protocol", action.Protocol, "verb", string(action.Verb))
+	}
+}
+
+// RequiresReview reports whether an action's confidence is below the minimum
+// its protocol needs for automatic submission, and why
+func RequiresReview(policy *PolicyConfig, action *Action) (bool, string) {
+	min := defaultMinConfidence
+	if policy != nil {
+		if policy.MinConfidence != "" {
+			min = policy.MinConfidence
+		}
+		for protocol, c := range policy.ProtocolMinConfidence {
+			if strings.EqualFold(protocol, action.Protocol) {
+				min = c
+			}
+		}
+	}
+	if !action.Confidence.AtLeast(min) {
+		return true, fmt.Sprintf("%s confidence is below the required %s", action.Confidence, min)
+	}
+	return false, ""
+}
@@ -0,0 +1,149 @@
+//go:build wasip1
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Config file formats
+const (
+	ConfigFormatJSON = "json"
+	ConfigFormatYAML = "yaml"
+	ConfigFormatTOML = "toml"
+)
+
+// configFormatDirective matches a "# format: yaml" first line, which names the
+// format of a YAML or TOML config explicitly
+var configFormatDirective = regexp.MustCompile(`^#\s*format:\s*([A-Za-z]+)\s*$`)
+
+// tomlLine matches the table headers and key/value pairs TOML starts with
+var tomlLine = regexp.MustCompile(`^(\[\[?[^\]]+\]\]?|[A-Za-z0-9_."'-]+\s*=)`)
+
+// DetectConfigFormat returns the format of a raw config. The workflow only
+// receives the config contents, not its file name, so a YAML or TOML config
+// names its format with a "# format:" first line, or the format is told from
+// the first line that is not a comment.
+func DetectConfigFormat(data []byte) (string, error) {
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if i == 0 {
+			if match := configFormatDirective.FindStringSubmatch(line); match != nil {
+				switch format := strings.ToLower(match[1]); format {
+				case ConfigFormatYAML, ConfigFormatTOML:
+					return format, nil
+				case "yml":
+					return ConfigFormatYAML, nil
+				default:
+					return "", fmt.Errorf("unknown config format %q", match[1])
+				}
+			}
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(line, "{"):
+			return ConfigFormatJSON, nil
+		case tomlLine.MatchString(line):
+			return ConfigFormatTOML, nil
+		default:
+			return ConfigFormatYAML, nil
+		}
+	}
+	return ConfigFormatJSON, nil
+}
+
+// yamlValue converts a YAML node to the value JSON encodes it as. Hex scalars
+// such as unquoted addresses stay strings rather than becoming integers.
+func yamlValue(node *yaml.Node) (interface{}, error) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		if len(node.Content) == 0 {
+			return nil, nil
+		}
+		return yamlValue(node.Content[0])
+	case yaml.AliasNode:
+		return yamlValue(node.Alias)
+	case yaml.MappingNode:
+		values := make(map[string]interface{}, len(node.Content)/2)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i]
+			if key.Kind != yaml.ScalarNode {
+				return nil, fmt.Errorf("line %d: map keys must be scalars", key.Line)
+			}
+			if key.Value == "<<" {
+				return nil, fmt.Errorf("line %d: merge keys are not supported", key.Line)
+			}
+			value, err := yamlValue(node.Content[i+1])
+			if err != nil {
+				return nil, err
+			}
+			values[key.Value] = value
+		}
+		return values, nil
+	case yaml.SequenceNode:
+		values := make([]interface{}, len(node.Content))
+		for i, item := range node.Content {
+			value, err := yamlValue(item)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = value
+		}
+		return values, nil
+	default:
+		if node.Tag == "!!int" && strings.HasPrefix(strings.ToLower(node.Value), "0x") {
+			return node.Value, nil
+		}
+		var value interface{}
+		if err := node.Decode(&value); err != nil {
+			return nil, fmt.Errorf("line %d: %w", node.Line, err)
+		}
+		return value, nil
+	}
+}
+
+// ConfigToJSON converts a YAML or TOML config to JSON. A JSON config is
+// returned as is.
+func ConfigToJSON(data []byte) ([]byte, error) {
+	format, err := DetectConfigFormat(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var tree interface{}
+	switch format {
+	case ConfigFormatJSON:
+		if bytes.HasPrefix(bytes.TrimSpace(data), []byte("#")) {
+			return nil, fmt.Errorf("JSON config cannot start with a comment")
+		}
+		return data, nil
+	case ConfigFormatYAML:
+		var document yaml.Node
+		if err := yaml.Unmarshal(data, &document); err != nil {
+			return nil, fmt.Errorf("failed to parse YAML config: %w", err)
+		}
+		if tree, err = yamlValue(&document); err != nil {
+			return nil, fmt.Errorf("failed to parse YAML config: %w", err)
+		}
+	case ConfigFormatTOML:
+		values := make(map[string]interface{})
+		if err := toml.Unmarshal(data, &values); err != nil {
+			return nil, fmt.Errorf("failed to parse TOML config: %w", err)
+		}
+		tree = values
+	}
+
+	if _, ok := tree.(map[string]interface{}); !ok {
+		return nil, fmt.Errorf("%s config must be a map", format)
+	}
+	return json.Marshal(tree)
+}
@@ -0,0 +1,49 @@
+//go:build wasip1
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+)
+
+// activeConfigHash is the hash of the config the instance was initialized with
+var activeConfigHash string
+
+// ConfigHash returns the keccak256 of the canonical JSON of a config. The
+// config is re-encoded through a generic value, so object keys are sorted and
+// the hash does not depend on field order or formatting of the deployed file.
+func ConfigHash(config *Config) (string, error) {
+	encoded, err := json.Marshal(config)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode config: %w", err)
+	}
+	var canonical interface{}
+	if err := json.Unmarshal(encoded, &canonical); err != nil {
+		return "", fmt.Errorf("failed to decode config: %w", err)
+	}
+	encoded, err = json.Marshal(canonical)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode canonical config: %w", err)
+	}
+	return crypto.Keccak256Hash(encoded).Hex(), nil
+}
+
+// CheckConfigHash compares the active config hash with the one recorded in
+// the state and alerts when it changed since the last run. A redeployment
+// with a new config starts a new instance, so a change is only seen when the
+// state is kept in an external store.
+func CheckConfigHash(config *Config, runtime cre.Runtime) {
+	if activeConfigHash == "" || state.ConfigHash == activeConfigHash {
+		return
+	}
+	if state.ConfigHash != "" && state.StoreLoaded {
+		RaiseAlert(config, runtime, slog.LevelWarn, "ALERT: config changed", activeConfigHash,
+			"previous", state.ConfigHash, "current", activeConfigHash)
+	}
+	state.ConfigHash = activeConfigHash
+}
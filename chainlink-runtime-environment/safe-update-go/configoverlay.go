@@ -0,0 +1,90 @@
+//go:build wasip1
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// overlayReservedKeys are the template keys an overlay cannot set
+var overlayReservedKeys = []string{"environment", "variables", "environments", "overlays"}
+
+// mergeConfig merges an overlay into a decoded config. Objects are merged key
+// by key; arrays and other values replace the base value, and null removes it.
+func mergeConfig(base, overlay map[string]interface{}) {
+	for key, value := range overlay {
+		if value == nil {
+			delete(base, key)
+			continue
+		}
+		baseObject, baseIsObject := base[key].(map[string]interface{})
+		overlayObject, overlayIsObject := value.(map[string]interface{})
+		if baseIsObject && overlayIsObject {
+			mergeConfig(baseObject, overlayObject)
+			continue
+		}
+		base[key] = value
+	}
+}
+
+// overlayChain returns the overlays of an environment in the order they are
+// applied: the overlays it extends first, the environment's own last
+func overlayChain(overlays map[string]interface{}, name string) ([]map[string]interface{}, error) {
+	var chain []map[string]interface{}
+	seen := make(map[string]bool)
+	for name != "" {
+		if seen[name] {
+			return nil, fmt.Errorf("overlay %q is part of an extends cycle", name)
+		}
+		seen[name] = true
+
+		overlay, ok := overlays[name].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("overlay %q is not defined", name)
+		}
+		for _, key := range overlayReservedKeys {
+			if _, ok := overlay[key]; ok {
+				return nil, fmt.Errorf("overlay %q cannot set %s", name, key)
+			}
+		}
+		chain = append([]map[string]interface{}{overlay}, chain...)
+
+		extends, ok := overlay["extends"]
+		if !ok {
+			break
+		}
+		next, ok := extends.(string)
+		if !ok || strings.TrimSpace(next) == "" {
+			return nil, fmt.Errorf("overlay %q: extends must name an overlay", name)
+		}
+		name = next
+	}
+	return chain, nil
+}
+
+// ApplyOverlays merges the overlays of an environment into a decoded config
+// and removes the overlays from it. An environment without an overlay leaves
+// the config as is.
+func ApplyOverlays(tree map[string]interface{}, environment string) error {
+	overlays, _ := tree["overlays"].(map[string]interface{})
+	delete(tree, "overlays")
+	if environment == "" || overlays[environment] == nil {
+		return nil
+	}
+
+	chain, err := overlayChain(overlays, environment)
+	if err != nil {
+		return err
+	}
+	for _, overlay := range chain {
+		values := make(map[string]interface{}, len(overlay))
+		for key, value := range overlay {
+			if key != "extends" {
+				values[key] = value
+			}
+		}
+		mergeConfig(tree, values)
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+//go:build wasip1
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// configReference matches ${NAME} and ${NAME:-default} in config strings
+var configReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+
+// ConfigTemplate represents the variables config strings can reference and
+// the overlays merged into the config. Variables are shared by every
+// environment; the selected environment overrides them and applies its overlay.
+// They only come from the config itself: every node of the DON must resolve
+// the same config, and the config hash must describe what they run.
+type ConfigTemplate struct {
+	Environment  string                                `json:"environment,omitempty"`
+	Variables    map[string]json.RawMessage            `json:"variables,omitempty"`
+	Environments map[string]map[string]json.RawMessage `json:"environments,omitempty"`
+	Overlays     map[string]json.RawMessage            `json:"overlays,omitempty"`
+}
+
+// templateResolver resolves config references and records those it cannot.
+// Declared names are the variables of the config and of any of its
+// environments; only those may fall back to an inline default.
+type templateResolver struct {
+	variables map[string]json.RawMessage
+	declared  map[string]bool
+	errs      []error
+}
+
+// lookup returns the value of a config variable, which keeps its JSON type
+func (r *templateResolver) lookup(name string) (json.RawMessage, bool) {
+	value, ok := r.variables[name]
+	return value, ok
+}
+
+// text returns a variable value as it is written inside a string
+func text(value json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(value, &s); err == nil {
+		return s
+	}
+	return string(value)
+}
+
+// expand resolves the references of a config string. A string that is
+// exactly one reference takes the JSON type of its value, so numbers and
+// booleans can be templated too.
+func (r *templateResolver) expand(s string, path string) interface{} {
+	if match := configReference.FindStringSubmatchIndex(s); match != nil && match[0] == 0 && match[1] == len(s) {
+		name := s[match[2]:match[3]]
+		if value, ok := r.lookup(name); ok {
+			var typed interface{}
+			decoder := json.NewDecoder(bytes.NewReader(value))
+			decoder.UseNumber()
+			if err := decoder.Decode(&typed); err == nil {
+				return typed
+			}
+		}
+	}
+
+	return configReference.ReplaceAllStringFunc(s, func(reference string) string {
+		parts := configReference.FindStringSubmatch(reference)
+		if value, ok := r.lookup(parts[1]); ok {
+			return text(value)
+		}
+		if !r.declared[parts[1]] {
+			r.errs = append(r.errs, fmt.Errorf("%s: ${%s} is not a config variable", path, parts[1]))
+			return reference
+		}
+		if strings.Contains(reference, ":-") {
+			return parts[2]
+		}
+		r.errs = append(r.errs, fmt.Errorf("%s: ${%s} is not defined", path, parts[1]))
+		return reference
+	})
+}
+
+// walk resolves the references of every string value in a decoded config
+func (r *templateResolver) walk(value interface{}, path string) interface{} {
+	switch v := value.(type) {
+	case string:
+		return r.expand(v, path)
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			v[key] = r.walk(v[key], strings.TrimPrefix(path+"."+key, "."))
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = r.walk(v[i], fmt.Sprintf("%s[%d]", path, i))
+		}
+	}
+	return value
+}
+
+// ExpandConfig composes a raw config and resolves its ${NAME} and
+// ${NAME:-default} references from its own variables. The environment, which
+// may itself be a reference, selects the variables overriding the shared ones
+// and the overlay merged into the config. References are resolved after the
+// overlay is merged, and every undefined reference is reported at once. The
+// process environment is never read, so every node resolves the same config.
+func ExpandConfig(data []byte) ([]byte, error) {
+	var template ConfigTemplate
+	if err := json.Unmarshal(data, &template); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+	if !configReference.MatchString(string(data)) && len(template.Overlays) == 0 {
+		return data, nil
+	}
+
+	resolver := &templateResolver{variables: make(map[string]json.RawMessage), declared: make(map[string]bool)}
+	for name, value := range template.Variables {
+		resolver.variables[name] = value
+		resolver.declared[name] = true
+	}
+	for _, overrides := range template.Environments {
+		for name := range overrides {
+			resolver.declared[name] = true
+		}
+	}
+
+	environment, _ := resolver.expand(template.Environment, "environment").(string)
+	if environment != "" {
+		overrides, ok := template.Environments[environment]
+		if _, overlay := template.Overlays[environment]; !ok && !overlay {
+			return nil, fmt.Errorf("environment %q is not defined", environment)
+		}
+		for name, value := range overrides {
+			resolver.variables[name] = value
+		}
+	}
+
+	var tree map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&tree); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+	// Variables are resolved in place, not expanded themselves
+	delete(tree, "variables")
+	delete(tree, "environments")
+	tree["environment"] = environment
+	if err := ApplyOverlays(tree, environment); err != nil {
+		return nil, err
+	}
+	resolver.walk(tree, "")
+
+	if len(resolver.errs) > 0 {
+		return nil, fmt.Errorf("%d undefined config references:\n%w", len(resolver.errs), errors.Join(resolver.errs...))
+	}
+	return json.Marshal(tree)
+}
@@ -0,0 +1,240 @@
+//go:build wasip1
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// knownChainSelectors maps the CCIP chain selectors the workflow can be
+// deployed on to their chain names
+var knownChainSelectors = map[uint64]string{
+	5009297550715157269:  "ethereum-mainnet",
+	16015286601757825753: "ethereum-testnet-sepolia",
+	4949039107694359620:  "ethereum-mainnet-arbitrum-1",
+	3478487238524512106:  "ethereum-testnet-sepolia-arbitrum-1",
+	15971525489660198786: "ethereum-mainnet-base-1",
+	10344971235874465080: "ethereum-testnet-sepolia-base-1",
+	3734403246176062136:  "ethereum-mainnet-optimism-1",
+	5224473277236331295:  "ethereum-testnet-sepolia-optimism-1",
+	4051577828743386545:  "polygon-mainnet",
+	16281711391670634445: "polygon-testnet-amoy",
+	6433500567565415381:  "avalanche-mainnet",
+	14767482510784806043: "avalanche-testnet-fuji",
+	11344663589394136015: "binance_smart_chain-mainnet",
+}
+
+// configField is implemented by config values that are validated while the
+// config is decoded. Invalid values are kept so every invalid field can be
+// reported at once.
+type configField interface {
+	fieldError() string
+}
+
+// Address represents an address field of the config. It decodes from a 0x
+// prefixed hex string of 20 bytes; a mixed-case string must carry a valid
+// EIP-55 checksum. An empty string decodes to the zero address, which marks an
+// unset optional field.
+type Address struct {
+	common.Address
+	invalid string
+}
+
+// NewAddress returns the config address of a common address
+func NewAddress(addr common.Address) Address {
+	return Address{Address: addr}
+}
+
+// IsSet reports whether the address was configured
+func (a Address) IsSet() bool {
+	return a.Address != (common.Address{}) || a.invalid != ""
+}
+
+// parse decodes a hex address, recording why it is invalid
+func (a *Address) parse(s string) {
+	*a = Address{}
+	if s == "" {
+		return
+	}
+	hexPart, ok := strings.CutPrefix(s, "0x")
+	if !ok || len(hexPart) != 2*common.AddressLength || !common.IsHexAddress(s) {
+		a.invalid = fmt.Sprintf("%q is not a 0x prefixed 20-byte hex address", s)
+		return
+	}
+	a.Address = common.HexToAddress(s)
+	if hexPart != strings.ToLower(hexPart) && hexPart != strings.ToUpper(hexPart) && a.Address.Hex() != s {
+		a.invalid = fmt.Sprintf("%q has an invalid checksum, expected %s", s, a.Address.Hex())
+	}
+}
+
+// UnmarshalJSON decodes an address from a JSON string
+func (a *Address) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		*a = Address{invalid: fmt.Sprintf("%s is not a string", data)}
+		return nil
+	}
+	a.parse(s)
+	return nil
+}
+
+// UnmarshalText decodes an address used as a map key
+func (a *Address) UnmarshalText(text []byte) error {
+	a.parse(string(text))
+	return nil
+}
+
+// MarshalJSON encodes the checksummed address, or an empty string when unset
+func (a Address) MarshalJSON() ([]byte, error) {
+	if !a.IsSet() {
+		return json.Marshal("")
+	}
+	return json.Marshal(a.Address.Hex())
+}
+
+// MarshalText encodes the checksummed address as a map key
+func (a Address) MarshalText() ([]byte, error) {
+	return []byte(a.Address.Hex()), nil
+}
+
+// fieldError returns why the address is invalid
+func (a Address) fieldError() string {
+	return a.invalid
+}
+
+// ChainSelector represents the CCIP chain selector of the config. It decodes
+// from a decimal string or number and must be a known selector.
+type ChainSelector struct {
+	value   uint64
+	invalid string
+}
+
+// Uint64 returns the selector value
+func (c ChainSelector) Uint64() uint64 {
+	return c.value
+}
+
+// String returns the selector in decimal
+func (c ChainSelector) String() string {
+	return strconv.FormatUint(c.value, 10)
+}
+
+// Name returns the chain name of the selector
+func (c ChainSelector) Name() string {
+	return knownChainSelectors[c.value]
+}
+
+// UnmarshalJSON decodes a chain selector from a decimal string or number
+func (c *ChainSelector) UnmarshalJSON(data []byte) error {
+	*c = ChainSelector{}
+	s := strings.Trim(string(data), `"`)
+	value, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		c.invalid = fmt.Sprintf("%s is not a decimal uint64", data)
+		return nil
+	}
+	c.value = value
+	if _, ok := knownChainSelectors[value]; !ok {
+		c.invalid = fmt.Sprintf("%d is not a known chain selector", value)
+	}
+	return nil
+}
+
+// MarshalJSON encodes the selector as a decimal string
+func (c ChainSelector) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.String())
+}
+
+// fieldError returns why the selector is invalid
+func (c ChainSelector) fieldError() string {
+	return c.invalid
+}
+
+// jsonName returns the JSON name of a struct field, or "" when it is not encoded
+func jsonName(field reflect.StructField) string {
+	if field.PkgPath != "" {
+		return ""
+	}
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "-" {
+		return ""
+	}
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+// collectFieldErrors walks a decoded config value and collects the errors of
+// its invalid fields, named by their JSON path
+func collectFieldErrors(v reflect.Value, path string, errs *[]error) {
+	if field, ok := v.Interface().(configField); ok {
+		if reason := field.fieldError(); reason != "" {
+			*errs = append(*errs, fmt.Errorf("%s: %s", path, reason))
+		}
+		return
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if !v.IsNil() {
+			collectFieldErrors(v.Elem(), path, errs)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if name := jsonName(v.Type().Field(i)); name != "" {
+				collectFieldErrors(v.Field(i), strings.TrimPrefix(path+"."+name, "."), errs)
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			collectFieldErrors(v.Index(i), fmt.Sprintf("%s[%d]", path, i), errs)
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			key := fmt.Sprintf("%v", iter.Key().Interface())
+			if field, ok := iter.Key().Interface().(configField); ok {
+				if reason := field.fieldError(); reason != "" {
+					*errs = append(*errs, fmt.Errorf("%s: key %s", path, reason))
+					continue
+				}
+			}
+			collectFieldErrors(iter.Value(), path+"."+key, errs)
+		}
+	}
+}
+
+// ParseConfig converts a YAML or TOML workflow config to JSON, expands its
+// references and decodes it. Addresses and the chain selector are validated
+// while decoding, and every invalid field is reported at once.
+func ParseConfig(data []byte) (*Config, error) {
+	data, err := ConfigToJSON(data)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err = ExpandConfig(data)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &Config{}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+
+	var errs []error
+	collectFieldErrors(reflect.ValueOf(config), "", &errs)
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("%d invalid config fields:\n%w", len(errs), errors.Join(errs...))
+	}
+	return config, nil
+}
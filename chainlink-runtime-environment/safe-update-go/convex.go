@@ -0,0 +1,159 @@
+//go:build wasip1
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/blockchain/evm"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+)
+
+// Convex reward pool and Booster ABI (pid, operator and poolInfo), shared by Aura
+const convexABI = `[
+	{"constant":true,"inputs":[],"name":"pid","outputs":[{"name":"","type":"uint256"}],"type":"function"},
+	{"constant":true,"inputs":[],"name":"operator","outputs":[{"name":"","type":"address"}],"type":"function"},
+	{"constant":true,"inputs":[{"name":"","type":"uint256"}],"name":"poolInfo","outputs":[{"name":"lptoken","type":"address"},{"name":"token","type":"address"},{"name":"gauge","type":"address"},{"name":"crvRewards","type":"address"},{"name":"stash","type":"address"},{"name":"shutdown","type":"bool"}],"type":"function"}
+]`
+
+// Withdrawn(address indexed user, uint256 amount), emitted by Convex and Aura reward pools
+var convexWithdrawnSignature = crypto.Keccak256Hash([]byte("Withdrawn(address,uint256)"))
+
+// callConvex calls a view function of a Convex reward pool or Booster
+func callConvex(runtime cre.Runtime, evmClient *evm.Client, contract common.Address, method string, args ...interface{}) ([]interface{}, error) {
+	parsedConvexABI, err := abi.JSON(strings.NewReader(convexABI))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse Convex ABI: %w", err)
+	}
+
+	callData, err := parsedConvexABI.Pack(method, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to pack %s call: %w", method, err)
+	}
+
+	result, err := evmClient.CallContract(runtime, &evm.CallContractRequest{
+		Call: &evm.CallMsg{
+			To:   contract.Bytes(),
+			Data: callData,
+		},
+	}).Await()
+	if err != nil {
+		return nil, fmt.Errorf("failed to call %s on %s: %w", method, contract.Hex(), err)
+	}
+
+	values, err := parsedConvexABI.Unpack(method, result.Data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unpack %s: %w", method, err)
+	}
+	if len(values) == 0 {
+		return nil, fmt.Errorf("empty %s result", method)
+	}
+	return values, nil
+}
+
+// ConvexPoolLPToken returns the LP token a Convex or Aura reward pool unwraps
+// to and the pool's operator, from the cache or from the operator's poolInfo
+// for the pool's pid
+func ConvexPoolLPToken(runtime cre.Runtime, evmClient *evm.Client, rewardPool common.Address) (common.Address, common.Address, error) {
+	lpKey, operatorKey := rewardPool.Hex(), rewardPool.Hex()+":operator"
+	if lpToken, ok := state.VaultAssets[lpKey]; ok {
+		if operator, ok := state.VaultAssets[operatorKey]; ok {
+			return lpToken, operator, nil
+		}
+	}
+
+	values, err := callConvex(runtime, evmClient, rewardPool, "operator")
+	if err != nil {
+		return common.Address{}, common.Address{}, err
+	}
+	operator, ok := values[0].(common.Address)
+	if !ok {
+		return common.Address{}, common.Address{}, fmt.Errorf("unexpected operator result")
+	}
+	values, err = callConvex(runtime, evmClient, rewardPool, "pid")
+	if err != nil {
+		return common.Address{}, common.Address{}, err
+	}
+	pid, ok := values[0].(*big.Int)
+	if !ok {
+		return common.Address{}, common.Address{}, fmt.Errorf("unexpected pid result")
+	}
+	values, err = callConvex(runtime, evmClient, operator, "poolInfo", pid)
+	if err != nil {
+		return common.Address{}, common.Address{}, err
+	}
+	lpToken, ok := values[0].(common.Address)
+	if !ok {
+		return common.Address{}, common.Address{}, fmt.Errorf("unexpected poolInfo result")
+	}
+
+	state.VaultAssets[lpKey] = lpToken
+	state.VaultAssets[operatorKey] = operator
+	return lpToken, operator, nil
+}
+
+// ResolveConvexUnstake settles a withdrawAndUnwrap from a Convex or Aura
+// reward pool. The amount is the pool's Withdrawn event, which also resolves
+// withdrawAllAndUnwrap, and is credited in the Curve or Balancer LP token of
+// the pool's pid at its operator. Rewards claimed along the way are not
+// credited. A call without the event is left to the fallback decoders.
+func ResolveConvexUnstake(runtime cre.Runtime, evmClient *evm.Client, logger *slog.Logger, action *Action, calldata []byte, txHash []byte) error {
+	reply, err := evmClient.GetTransactionReceipt(runtime, &evm.GetTransactionReceiptRequest{Hash: txHash}).Await()
+	if err != nil {
+		return fmt.Errorf("failed to get transaction receipt: %w", err)
+	}
+	if reply.Receipt == nil {
+		return fmt.Errorf("transaction receipt not found")
+	}
+
+	withdrawn := new(big.Int)
+	found := false
+	for _, log := range reply.Receipt.Logs {
+		if common.BytesToAddress(log.Address) != action.Counterparty || len(log.Topics) != 2 || len(log.Data) < 32 ||
+			!bytes.Equal(log.Topics[0], convexWithdrawnSignature.Bytes()) {
+			continue
+		}
+		withdrawn.Add(withdrawn, new(big.Int).SetBytes(log.Data[:32]))
+		found = true
+	}
+	if !found {
+		return fmt.Errorf("%w: no Withdrawn from reward pool %s in receipt", ErrUnknownSelector, action.Counterparty.Hex())
+	}
+	if len(action.AssetsIn) == 1 && action.AssetsIn[0].Amount.Cmp(withdrawn) != 0 {
+		return fmt.Errorf("reward pool withdrew %s, calldata amount %s", withdrawn, action.AssetsIn[0].Amount)
+	}
+
+	lpToken, _, err := ConvexPoolLPToken(runtime, evmClient, action.Counterparty)
+	if err != nil {
+		return err
+	}
+
+	action.AssetsIn = []AssetAmount{{Token: lpToken, Amount: withdrawn}}
+	logger.Info("Reward pool unstaked", "rewardPool", action.Counterparty.Hex(),
+		"lpToken", lpToken.Hex(), "amount", withdrawn.String())
+	return nil
+}
+
+// LabelAuraPool relabels an unstake from a reward pool whose operator is one
+// of the configured Aura Boosters. Aura forked the Convex reward pools, so
+// their calls are told apart by the pool's operator, cached by the resolver.
+func LabelAuraPool(config *Config, runtime cre.Runtime, evmClient *evm.Client, action *Action) error {
+	_, operator, err := ConvexPoolLPToken(runtime, evmClient, action.Counterparty)
+	if err != nil {
+		return err
+	}
+	for _, booster := range config.AuraBoosters {
+		if booster.Address == operator {
+			action.Protocol = auraProtocol
+			return nil
+		}
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+#!/usr/bin/env bash
+# Runs the workflow tests under WASI and fails when coverage is below the
+# minimums: MIN_TOTAL percent of the package's statements, and MIN_DECODER
+# percent of each decoder file that has a decoder_*_test.go.
+#
+# Go's go_wasip1_wasm_exec runs the tests with wasmtime unless another runner
+# is on PATH. The CRE host functions are not linked outside a node, so unknown
+# imports trap when called instead of failing instantiation.
+set -euo pipefail
+cd "$(dirname "$0")"
+
+MIN_TOTAL=${MIN_TOTAL:-30}
+MIN_DECODER=${MIN_DECODER:-80}
+
+if ! command -v go_wasip1_wasm_exec >/dev/null; then
+	PATH="$(go env GOROOT)/lib/wasm:$PATH"
+fi
+export GOWASIRUNTIMEARGS=${GOWASIRUNTIMEARGS:-"-W unknown-imports-trap=y"}
+
+profile=$(mktemp)
+trap 'rm -f "$profile"' EXIT
+GOOS=wasip1 GOARCH=wasm go test -coverprofile="$profile" .
+
+tested=$(ls decoder_*_test.go | sed 's/_test\.go$/.go/')
+awk -v min_total="$MIN_TOTAL" -v min_decoder="$MIN_DECODER" -v tested="$tested" '
+	BEGIN { split(tested, files, "\n"); for (i in files) decoders[files[i]] = 1 }
+	NR > 1 {
+		file = substr($1, 1, index($1, ":") - 1)
+		sub(/.*\//, "", file)
+		statements[file] += $2
+		total += $2
+		if ($3 > 0) {
+			covered[file] += $2
+			coveredTotal += $2
+		}
+	}
+	END {
+		failed = 0
+		for (file in decoders) {
+			pct = statements[file] ? 100 * covered[file] / statements[file] : 0
+			if (pct < min_decoder) {
+				printf "%s: %.1f%% of statements covered, minimum %d%%\n", file, pct, min_decoder
+				failed = 1
+			}
+		}
+		pct = 100 * coveredTotal / total
+		printf "total: %.1f%% of statements covered, minimum %d%%\n", pct, min_total
+		if (pct < min_total) failed = 1
+		exit failed
+	}' "$profile"
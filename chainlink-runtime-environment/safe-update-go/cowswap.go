@@ -0,0 +1,183 @@
+//go:build wasip1
+
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/blockchain/evm"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+)
+
+// Trade(address indexed owner, address sellToken, address buyToken, uint256 sellAmount, uint256 buyAmount, uint256 feeAmount, bytes orderUid),
+// emitted by GPv2Settlement
+var cowSwapTradeSignature = crypto.Keccak256Hash([]byte("Trade(address,address,address,uint256,uint256,uint256,bytes)"))
+
+// cowSwapSettlement is the GPv2Settlement address on every chain CowSwap is deployed to
+var cowSwapSettlement = common.HexToAddress("0x9008D19f58AAbD9eD0D60971565AA8510560ab41")
+
+// CowSwapConfig represents the settlement of CowSwap orders pre-signed by a
+// subaccount. Orders are settled by solvers in their own transactions, so
+// the Trade events of the listed owners, the Safes, are watched for the
+// orders the workflow saw signed.
+type CowSwapConfig struct {
+	Settlement Address   `json:"settlement,omitempty"`
+	Owners     []Address `json:"owners"`
+}
+
+// PendingOrder represents a CowSwap order pre-signed by a subaccount and not
+// yet expired. Signed is false when the call cancelled the order.
+type PendingOrder struct {
+	UID        string
+	Owner      common.Address
+	ValidTo    time.Time
+	Signed     bool
+	SubAccount string
+}
+
+// ValidateCowSwap checks the CowSwap configuration
+func ValidateCowSwap(cowSwap *CowSwapConfig) error {
+	if cowSwap == nil {
+		return nil
+	}
+	if len(cowSwap.Owners) == 0 {
+		return fmt.Errorf("owners is required")
+	}
+	return nil
+}
+
+// settlement returns the configured GPv2Settlement address, or the canonical one
+func (c *CowSwapConfig) settlement() common.Address {
+	if c.Settlement.IsSet() {
+		return c.Settlement.Address
+	}
+	return cowSwapSettlement
+}
+
+// TrackOrder records the order signed by a subaccount, or forgets it when it
+// was cancelled. Expired orders are forgotten.
+func (s *WorkflowState) TrackOrder(subAccount string, order *PendingOrder, now time.Time) {
+	for uid, pending := range s.PendingOrders {
+		if now.After(pending.ValidTo) {
+			delete(s.PendingOrders, uid)
+		}
+	}
+	uid := strings.ToLower(order.UID)
+	if !order.Signed {
+		delete(s.PendingOrders, uid)
+		return
+	}
+	tracked := *order
+	tracked.SubAccount = subAccount
+	s.PendingOrders[uid] = &tracked
+}
+
+// OnCowSwapTrade is the handler for GPv2Settlement's Trade events. A trade of
+// an order pre-signed by a subaccount is accounted as a swap of that
+// subaccount: the sell amount, which includes the fee, leaves the Safe and
+// the buy amount enters it. Trades of other orders are ignored. Partially fillable orders
+// are accounted per trade until they expire.
+func OnCowSwapTrade(config *Config, runtime cre.Runtime, payload *evm.Log) (*ExecutionResult, error) {
+	logger := runtime.Logger()
+
+	settlement := config.CowSwap.settlement()
+	if common.BytesToAddress(payload.Address) != settlement {
+		return nil, fmt.Errorf("%w: %s is not the CowSwap settlement", ErrUnknownEmitter, common.BytesToAddress(payload.Address).Hex())
+	}
+	if len(payload.Topics) < 2 {
+		return nil, fmt.Errorf("invalid Trade log format")
+	}
+
+	parsedSettlementABI, err := abi.JSON(strings.NewReader(cowSwapSettlementABI))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse GPv2Settlement ABI: %w", err)
+	}
+	values, err := parsedSettlementABI.Unpack("Trade", payload.Data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unpack Trade: %w", err)
+	}
+	sellToken, ok1 := values[0].(common.Address)
+	buyToken, ok2 := values[1].(common.Address)
+	sellAmount, ok3 := values[2].(*big.Int)
+	buyAmount, ok4 := values[3].(*big.Int)
+	feeAmount, ok5 := values[4].(*big.Int)
+	uid, ok6 := values[5].([]byte)
+	if !ok1 || !ok2 || !ok3 || !ok4 || !ok5 || !ok6 {
+		return nil, fmt.Errorf("unexpected Trade arguments")
+	}
+
+	order := state.PendingOrders[strings.ToLower("0x"+hex.EncodeToString(uid))]
+	if order == nil {
+		logger.Info("Trade of an order not signed by a subaccount", "owner", common.BytesToAddress(payload.Topics[1]).Hex())
+		return &ExecutionResult{Message: "Not a pending order", Success: true}, nil
+	}
+	subAccount := common.HexToAddress(order.SubAccount)
+
+	if !OwnsSubaccount(config, subAccount) {
+		return &ExecutionResult{Message: "Subaccount not in shard", Success: true}, nil
+	}
+	if state.IsSubaccountHalted(subAccount) {
+		logger.Warn("Subaccount halted, skipping trade", "subAccount", subAccount.Hex(), "reason", state.HaltedSubaccounts[subAccount.Hex()].Reason)
+		return &ExecutionResult{Message: "Subaccount halted", Success: true}, nil
+	}
+
+	eventID := eventKey("0x"+hex.EncodeToString(payload.TxHash), payload.Index)
+	if state.HasProcessed(eventID) {
+		logger.Info("Event already processed, skipping", "event", eventID)
+		return &ExecutionResult{Message: "Duplicate event", Success: true}, nil
+	}
+
+	// Native ETH is paid to the receiver without a transfer the allowances track
+	if isNativeToken(buyToken) {
+		return nil, fmt.Errorf("CowSwap order %s bought native ETH, which cannot be valued", order.UID)
+	}
+
+	logger.Info("CowSwap trade", "orderUid", order.UID, "subAccount", subAccount.Hex(), "sellToken", sellToken.Hex(),
+		"sellAmount", sellAmount.String(), "feeAmount", feeAmount.String(), "buyToken", buyToken.Hex(), "buyAmount", buyAmount.String())
+
+	action := &Action{
+		Protocol:     cowSwapProtocol,
+		Verb:         VerbSwap,
+		AssetsIn:     []AssetAmount{{Token: buyToken, Amount: buyAmount}},
+		AssetsOut:    []AssetAmount{{Token: sellToken, Amount: sellAmount}},
+		Counterparty: settlement,
+		Confidence:   ConfidenceExactABI,
+	}
+
+	// Trade events carry no timestamp, the trade happened when its block was mined
+	evmClient := newEVMClient(config)
+	eventTime, err := LogBlockTime(runtime, evmClient, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return processAction(config, runtime, evmClient, logger, ActionEvent{
+		SubAccount: subAccount,
+		Target:     settlement,
+		EventID:    eventID,
+		EventTime:  eventTime,
+		Log:        payload,
+	}, action)
+}
+
+// cowSwapTradeTrigger creates the log trigger of the Trade events of the configured owners
+func cowSwapTradeTrigger(config *Config) cre.Trigger[*evm.Log, *evm.Log] {
+	owners := make([][]byte, 0, len(config.CowSwap.Owners))
+	for _, owner := range config.CowSwap.Owners {
+		owners = append(owners, common.LeftPadBytes(owner.Bytes(), 32))
+	}
+	return evm.LogTrigger(config.ChainSelector.Uint64(), &evm.FilterLogTriggerRequest{
+		Addresses: [][]byte{config.CowSwap.settlement().Bytes()},
+		Topics: []*evm.TopicValues{
+			{Values: [][]byte{cowSwapTradeSignature.Bytes()}},
+			{Values: owners},
+		},
+	})
+}
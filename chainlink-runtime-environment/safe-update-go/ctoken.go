@@ -0,0 +1,191 @@
+//go:build wasip1
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/blockchain/evm"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+)
+
+// Compound v2 cToken ABI (underlying and comptroller)
+const cTokenABI = `[
+	{"constant":true,"inputs":[],"name":"underlying","outputs":[{"name":"","type":"address"}],"type":"function"},
+	{"constant":true,"inputs":[],"name":"comptroller","outputs":[{"name":"","type":"address"}],"type":"function"}
+]`
+
+// Compound v2 events emitted by a cToken on redemption. A redemption the
+// market refuses returns an error code without reverting and emits Failure.
+var (
+	cTokenRedeemSignature  = crypto.Keccak256Hash([]byte("Redeem(address,uint256,uint256)"))
+	cTokenFailureSignature = crypto.Keccak256Hash([]byte("Failure(uint256,uint256,uint256)"))
+)
+
+// callCToken calls a view function of a cToken
+func callCToken(runtime cre.Runtime, evmClient *evm.Client, cToken common.Address, method string, out interface{}) error {
+	parsedCTokenABI, err := abi.JSON(strings.NewReader(cTokenABI))
+	if err != nil {
+		return fmt.Errorf("failed to parse cToken ABI: %w", err)
+	}
+
+	callData, err := parsedCTokenABI.Pack(method)
+	if err != nil {
+		return fmt.Errorf("failed to pack %s call: %w", method, err)
+	}
+
+	result, err := evmClient.CallContract(runtime, &evm.CallContractRequest{
+		Call: &evm.CallMsg{
+			To:   cToken.Bytes(),
+			Data: callData,
+		},
+	}).Await()
+	if err != nil {
+		return fmt.Errorf("failed to call %s on cToken %s: %w", method, cToken.Hex(), err)
+	}
+
+	if err := parsedCTokenABI.UnpackIntoInterface(out, method, result.Data); err != nil {
+		return fmt.Errorf("failed to unpack %s: %w", method, err)
+	}
+	return nil
+}
+
+// CTokenUnderlying returns the underlying token of a cToken from the registry,
+// the cache or the cToken's underlying() function. Native markets, such as
+// cETH, vBNB and qiAVAX, have no underlying() and must be mapped in the
+// registry to their wrapped native token.
+func CTokenUnderlying(config *Config, runtime cre.Runtime, evmClient *evm.Client, cToken common.Address) (common.Address, error) {
+	for _, v := range config.Vaults {
+		if v.Address.Address == cToken {
+			return v.Asset.Address, nil
+		}
+	}
+
+	key := cToken.Hex()
+	if underlying, ok := state.VaultAssets[key]; ok {
+		return underlying, nil
+	}
+
+	var underlying common.Address
+	if err := callCToken(runtime, evmClient, cToken, "underlying", &underlying); err != nil {
+		return common.Address{}, err
+	}
+	state.VaultAssets[key] = underlying
+	return underlying, nil
+}
+
+// resolveCTokenAsset turns an amount expressed against a cToken into an amount
+// of the cToken's underlying token
+func resolveCTokenAsset(config *Config, runtime cre.Runtime, evmClient *evm.Client, logger *slog.Logger, asset AssetAmount) (AssetAmount, error) {
+	underlying, err := CTokenUnderlying(config, runtime, evmClient, asset.Token)
+	if err != nil {
+		return AssetAmount{}, err
+	}
+
+	logger.Info("Resolved cToken asset", "cToken", asset.Token.Hex(), "asset", underlying.Hex(), "amount", asset.Amount.String())
+	return AssetAmount{Token: underlying, Amount: asset.Amount, Debt: asset.Debt}, nil
+}
+
+// ResolveCTokenRedeem settles a cToken redemption from the market's Redeem
+// event in the receipt, rather than from the calldata at a stored exchange
+// rate. The underlying is the token the market transferred to the redeemer
+// for the event's amount; a native market sends no token and is resolved
+// through the registry. A redemption the market refused credits nothing.
+func ResolveCTokenRedeem(runtime cre.Runtime, evmClient *evm.Client, logger *slog.Logger, action *Action, calldata []byte, txHash []byte) error {
+	if len(action.AssetsIn) != 1 {
+		return fmt.Errorf("unexpected Compound v2 action with %d assets", len(action.AssetsIn))
+	}
+	asset := &action.AssetsIn[0]
+	cToken := action.Counterparty
+
+	reply, err := evmClient.GetTransactionReceipt(runtime, &evm.GetTransactionReceiptRequest{Hash: txHash}).Await()
+	if err != nil {
+		return fmt.Errorf("failed to get transaction receipt: %w", err)
+	}
+	if reply.Receipt == nil {
+		return fmt.Errorf("transaction receipt not found")
+	}
+	logs := reply.Receipt.Logs
+
+	var redeemer common.Address
+	var redeemAmount, redeemTokens *big.Int
+	failed := false
+	for _, log := range logs {
+		if common.BytesToAddress(log.Address) != cToken || len(log.Topics) != 1 {
+			continue
+		}
+		switch {
+		case bytes.Equal(log.Topics[0], cTokenRedeemSignature.Bytes()) && len(log.Data) >= 96:
+			redeemer = common.BytesToAddress(log.Data[:32])
+			redeemAmount = new(big.Int).SetBytes(log.Data[32:64])
+			redeemTokens = new(big.Int).SetBytes(log.Data[64:96])
+		case bytes.Equal(log.Topics[0], cTokenFailureSignature.Bytes()):
+			failed = true
+		}
+	}
+
+	if redeemAmount == nil {
+		if !failed {
+			return fmt.Errorf("%w: no Redeem from cToken %s in receipt", ErrUnknownSelector, cToken.Hex())
+		}
+		logger.Warn("Compound v2 redemption failed, nothing redeemed", "cToken", cToken.Hex())
+		action.AssetsIn = []AssetAmount{{Token: cToken, Amount: new(big.Int), CToken: true}}
+		return nil
+	}
+
+	expected := redeemAmount
+	if asset.Shares {
+		expected = redeemTokens
+	}
+	if asset.Amount.Cmp(expected) != 0 {
+		return fmt.Errorf("cToken redeemed %s, calldata amount %s", expected, asset.Amount)
+	}
+
+	settled := AssetAmount{Token: cToken, Amount: redeemAmount, CToken: true}
+	for _, log := range logs {
+		if len(log.Topics) == 3 && len(log.Data) >= 32 && bytes.Equal(log.Topics[0], transferSignature.Bytes()) &&
+			common.BytesToAddress(log.Address) != cToken &&
+			common.BytesToAddress(log.Topics[1]) == cToken && common.BytesToAddress(log.Topics[2]) == redeemer &&
+			new(big.Int).SetBytes(log.Data[:32]).Cmp(redeemAmount) == 0 {
+			settled = AssetAmount{Token: common.BytesToAddress(log.Address), Amount: redeemAmount}
+			break
+		}
+	}
+
+	action.AssetsIn = []AssetAmount{settled}
+	action.Recipient = redeemer
+	logger.Info("Compound v2 redemption settled", "cToken", cToken.Hex(), "token", settled.Token.Hex(),
+		"amount", redeemAmount.String(), "cTokens", redeemTokens.String(), "redeemer", redeemer.Hex())
+	return nil
+}
+
+// LabelCompoundV2Fork labels a cToken redemption with the protocol of its
+// configured fork, found through the market's comptroller (cached). Markets
+// of other comptrollers, and markets whose comptroller() cannot be read, stay
+// compoundv2.
+func LabelCompoundV2Fork(config *Config, runtime cre.Runtime, evmClient *evm.Client, logger *slog.Logger, action *Action) {
+	if len(config.CompoundV2Forks) == 0 {
+		return
+	}
+	key := action.Counterparty.Hex() + ":comptroller"
+	comptroller, ok := state.VaultAssets[key]
+	if !ok {
+		if err := callCToken(runtime, evmClient, action.Counterparty, "comptroller", &comptroller); err != nil {
+			logger.Warn("Compound v2 market comptroller unknown, keeping the compoundv2 label", "market", action.Counterparty.Hex(), "error", err)
+			return
+		}
+		state.VaultAssets[key] = comptroller
+	}
+
+	if fork, ok := compoundV2ForkOf(config, comptroller); ok {
+		action.Protocol = fork.Protocol
+	}
+	logger.Info("Compound v2 market", "protocol", action.Protocol, "market", action.Counterparty.Hex(), "comptroller", comptroller.Hex())
+}
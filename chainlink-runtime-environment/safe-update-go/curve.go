@@ -0,0 +1,112 @@
+//go:build wasip1
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/blockchain/evm"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+)
+
+// Curve pool coins(uint256) of newer pools and coins(int128) of older ones.
+// A coin index encodes the same for both.
+var curveCoinsSelectors = [][]byte{common.FromHex("c6610657"), common.FromHex("23746eb8")}
+
+// curveNativeCoin is the placeholder address Curve pools use for ETH
+var curveNativeCoin = common.HexToAddress("0xEeeeeEeeeEeEeeEeEeEeeEEEeeeeEeeeeeeeEEeE")
+
+// CurveCoin returns the token at an index of a Curve pool from the cache or
+// the pool's coins getter, trying the int128 getter of older pools second
+func CurveCoin(runtime cre.Runtime, evmClient *evm.Client, pool common.Address, index uint64) (common.Address, error) {
+	key := fmt.Sprintf("%s:%d", pool.Hex(), index)
+	if coin, ok := state.VaultAssets[key]; ok {
+		return coin, nil
+	}
+
+	indexWord := common.LeftPadBytes(new(big.Int).SetUint64(index).Bytes(), 32)
+	var lastErr error
+	for _, selector := range curveCoinsSelectors {
+		result, err := evmClient.CallContract(runtime, &evm.CallContractRequest{
+			Call: &evm.CallMsg{
+				To:   pool.Bytes(),
+				Data: append(append([]byte{}, selector...), indexWord...),
+			},
+		}).Await()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if len(result.Data) < 32 {
+			lastErr = fmt.Errorf("empty result")
+			continue
+		}
+		coin := common.BytesToAddress(result.Data[:32])
+		state.VaultAssets[key] = coin
+		return coin, nil
+	}
+	return common.Address{}, fmt.Errorf("failed to call coins(%d) on pool %s: %w", index, pool.Hex(), lastErr)
+}
+
+// poolTransfers sums the Transfers of a token sent by a pool to the Safe in a receipt
+func poolTransfers(logs []*evm.Log, token, pool, avatar common.Address) *big.Int {
+	total := new(big.Int)
+	for _, log := range logs {
+		if common.BytesToAddress(log.Address) != token || len(log.Topics) < 3 || len(log.Data) < 32 ||
+			!bytes.Equal(log.Topics[0], transferSignature.Bytes()) ||
+			common.BytesToAddress(log.Topics[1]) != pool || common.BytesToAddress(log.Topics[2]) != avatar {
+			continue
+		}
+		total.Add(total, new(big.Int).SetBytes(log.Data[:32]))
+	}
+	return total
+}
+
+// ResolveCurveRemoval settles a Curve liquidity removal. Each withdrawn coin
+// index is resolved to its token with coins(i), and its amount is what the
+// pool transferred to the Safe in the receipt, which also covers the minimum-only
+// calldata of remove_liquidity and remove_liquidity_one_coin. Coins the pool
+// did not send are dropped.
+func ResolveCurveRemoval(runtime cre.Runtime, evmClient *evm.Client, logger *slog.Logger, action *Action, calldata []byte, txHash []byte) error {
+	reply, err := evmClient.GetTransactionReceipt(runtime, &evm.GetTransactionReceiptRequest{Hash: txHash}).Await()
+	if err != nil {
+		return fmt.Errorf("failed to get transaction receipt: %w", err)
+	}
+	if reply.Receipt == nil {
+		return fmt.Errorf("transaction receipt not found")
+	}
+
+	var settled []AssetAmount
+	for _, asset := range action.AssetsIn {
+		if !asset.Curve {
+			settled = append(settled, asset)
+			continue
+		}
+		pool := asset.Token
+
+		coin, err := CurveCoin(runtime, evmClient, pool, asset.Coin)
+		if err != nil {
+			return err
+		}
+		if coin == curveNativeCoin {
+			return fmt.Errorf("coin %d of pool %s is native ETH, which cannot be settled from transfers", asset.Coin, pool.Hex())
+		}
+
+		amount := poolTransfers(reply.Receipt.Logs, coin, pool, action.Avatar)
+		logger.Info("Curve coin withdrawn", "pool", pool.Hex(), "coin", asset.Coin, "token", coin.Hex(), "amount", amount.String())
+		if amount.Sign() == 0 {
+			continue
+		}
+		settled = append(settled, AssetAmount{Token: coin, Amount: amount})
+	}
+
+	if len(settled) == 0 {
+		return fmt.Errorf("no Curve coin transferred by pool %s", action.Counterparty.Hex())
+	}
+	action.AssetsIn = settled
+	return nil
+}
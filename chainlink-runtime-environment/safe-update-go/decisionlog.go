@@ -0,0 +1,167 @@
+//go:build wasip1
+
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/blockchain/evm"
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/scheduler/cron"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+)
+
+// DecisionLogConfig represents how the head of the decision hash chain is anchored
+type DecisionLogConfig struct {
+	AnchorSchedule string  `json:"anchorSchedule"`
+	AnchorReceiver Address `json:"anchorReceiver"`
+	AnchorGasLimit uint64  `json:"anchorGasLimit,omitempty"`
+	MaxEntries     int     `json:"maxEntries,omitempty"`
+}
+
+// defaultDecisionLogEntries bounds the unanchored decision log
+const defaultDecisionLogEntries = 10000
+
+// DecisionEntry represents one link of the decision hash chain.
+// Hash = keccak256(PrevHash || keccak256(Record)).
+type DecisionEntry struct {
+	Seq      uint64
+	PrevHash common.Hash
+	Record   []byte
+	Hash     common.Hash
+}
+
+// AppendDecision links a decision record to the head of the hash chain. The
+// record is hashed as it is stored, with its sensitive fields encrypted.
+func (s *WorkflowState) AppendDecision(record map[string]string) (DecisionEntry, error) {
+	encoded, err := json.Marshal(record)
+	if err != nil {
+		return DecisionEntry{}, fmt.Errorf("failed to encode decision: %w", err)
+	}
+
+	entry := DecisionEntry{
+		Seq:      uint64(len(s.DecisionLog)) + s.DecisionLogOffset,
+		PrevHash: s.DecisionHead,
+		Record:   encoded,
+	}
+	entry.Hash = crypto.Keccak256Hash(entry.PrevHash.Bytes(), crypto.Keccak256(encoded))
+
+	s.DecisionLog = append(s.DecisionLog, entry)
+	s.DecisionHead = entry.Hash
+	return entry, nil
+}
+
+// CompactDecisionLog drops the oldest links beyond the limit and returns how
+// many were dropped. The links left still verify from their first PrevHash.
+func (s *WorkflowState) CompactDecisionLog(limit int) int {
+	if limit <= 0 {
+		limit = defaultDecisionLogEntries
+	}
+	dropped := len(s.DecisionLog) - limit
+	if dropped <= 0 {
+		return 0
+	}
+	s.DecisionLog = append([]DecisionEntry(nil), s.DecisionLog[dropped:]...)
+	s.DecisionLogOffset += uint64(dropped)
+	return dropped
+}
+
+// VerifyDecisionChain recomputes every link of a chain starting from its first
+// entry's PrevHash and returns the index of the first broken link, or -1
+func VerifyDecisionChain(entries []DecisionEntry) int {
+	for i, entry := range entries {
+		if i > 0 && entry.PrevHash != entries[i-1].Hash {
+			return i
+		}
+		if crypto.Keccak256Hash(entry.PrevHash.Bytes(), crypto.Keccak256(entry.Record)) != entry.Hash {
+			return i
+		}
+	}
+	return -1
+}
+
+// OnAnchorDecisions is the handler for the anchor cron trigger. It has the DON
+// sign a report of the decision chain head and of the accounting roots of the
+// epochs closed since the last anchor, and writes it to the anchor receiver,
+// making the decision history and the ledger tamper-evident. Anchored entries
+// are pruned.
+func OnAnchorDecisions(config *Config, runtime cre.Runtime, payload *cron.Payload) (*ExecutionResult, error) {
+	logger := runtime.Logger()
+
+	fromEpoch, roots, err := pendingAccountingRoots(config.AccountingProofs, state, runtime.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute accounting roots: %w", err)
+	}
+	if len(state.DecisionLog) == 0 && len(roots) == 0 {
+		return &ExecutionResult{Message: "No new decisions", Success: true}, nil
+	}
+
+	if !IsLeader(config, runtime, logger) {
+		return &ExecutionResult{Message: "Standby: anchoring left to the leader", Success: true}, nil
+	}
+
+	// Without new decisions the anchored head is the last one already anchored
+	head := DecisionEntry{Hash: state.DecisionHead}
+	if n := len(state.DecisionLog); n > 0 {
+		head = state.DecisionLog[n-1]
+	} else if state.DecisionLogOffset > 0 {
+		head.Seq = state.DecisionLogOffset - 1
+	}
+
+	uint64Type, _ := abi.NewType("uint64", "", nil)
+	bytes32Type, _ := abi.NewType("bytes32", "", nil)
+	bytes32ArrayType, _ := abi.NewType("bytes32[]", "", nil)
+	accountingRoots := make([][32]byte, len(roots))
+	for i, root := range roots {
+		accountingRoots[i] = root
+	}
+	encoded, err := abi.Arguments{{Type: uint64Type}, {Type: bytes32Type}, {Type: uint64Type}, {Type: bytes32ArrayType}}.Pack(
+		head.Seq, head.Hash, fromEpoch, accountingRoots)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode anchor: %w", err)
+	}
+
+	report, err := runtime.GenerateReport(&cre.ReportRequest{
+		EncodedPayload: encoded,
+	}).Await()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate anchor report: %w", err)
+	}
+
+	evmClient := newEVMClient(config)
+	gasLimit := config.DecisionLog.AnchorGasLimit
+	if gasLimit == 0 {
+		gasLimit = config.GasLimit
+	}
+
+	reply, err := evmClient.WriteReport(runtime, &evm.WriteCreReportRequest{
+		Receiver:  config.DecisionLog.AnchorReceiver.Bytes(),
+		Report:    report,
+		GasConfig: &evm.GasConfig{GasLimit: gasLimit},
+	}).Await()
+	if err == nil {
+		err = CheckWriteResult(reply)
+	}
+	if err != nil {
+		logger.Error("Failed to anchor decision log", "seq", head.Seq, "head", head.Hash.Hex(), "error", err.Error())
+		return nil, fmt.Errorf("failed to anchor decision log: %w", err)
+	}
+
+	logger.Info("Anchored decision log", "seq", head.Seq, "head", head.Hash.Hex(),
+		"fromEpoch", fromEpoch, "epochs", len(roots), "txHash", "0x"+hex.EncodeToString(reply.TxHash))
+
+	state.DecisionLogOffset += uint64(len(state.DecisionLog))
+	state.DecisionLog = nil
+	if len(roots) > 0 {
+		state.AccountingAnchoredEpoch = fromEpoch + uint64(len(roots))
+	}
+
+	return &ExecutionResult{
+		Message: fmt.Sprintf("Anchored decision %d: %s", head.Seq, head.Hash.Hex()),
+		Success: true,
+	}, nil
+}
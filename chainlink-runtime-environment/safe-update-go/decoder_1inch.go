@@ -0,0 +1,137 @@
+//go:build wasip1
+
+package main
+
+import (
+	"log/slog"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// 1inch AggregationRouterV5 swap(address executor, (address srcToken, address dstToken, address srcReceiver, address dstReceiver, uint256 amount, uint256 minReturnAmount, uint256 flags) desc, bytes permit, bytes data)
+const OneInchV5SwapSelector = "12aa3caf"
+
+// 1inch AggregationRouterV6 swap(address executor, (address srcToken, address dstToken, address srcReceiver, address dstReceiver, uint256 amount, uint256 minReturnAmount, uint256 flags) desc, bytes data)
+const OneInchV6SwapSelector = "07ed2379"
+
+// 1inch AggregationRouterV5 unoswap(address srcToken, uint256 amount, uint256 minReturn, uint256[] pools)
+const OneInchV5UnoswapSelector = "0502b1c5"
+
+// 1inch AggregationRouterV5 unoswapTo(address recipient, address srcToken, uint256 amount, uint256 minReturn, uint256[] pools)
+const OneInchV5UnoswapToSelector = "f78dc253"
+
+// 1inch AggregationRouterV6 unoswap, unoswap2 and unoswap3(Address token, uint256 amount, uint256 minReturn, Address dex, ...)
+const (
+	OneInchV6UnoswapSelector  = "83800a8e"
+	OneInchV6Unoswap2Selector = "8770ba91"
+	OneInchV6Unoswap3Selector = "19367472"
+)
+
+// 1inch AggregationRouterV6 unoswapTo, unoswapTo2 and unoswapTo3(Address to, Address token, uint256 amount, uint256 minReturn, Address dex, ...)
+const (
+	OneInchV6UnoswapToSelector  = "e2c95c82"
+	OneInchV6UnoswapTo2Selector = "ea76dddf"
+	OneInchV6UnoswapTo3Selector = "f7a70056"
+)
+
+// oneInchProtocol is the protocol name of 1inch router swaps
+const oneInchProtocol = "1inch"
+
+func init() {
+	RegisterDecoder(OneInchV5SwapSelector, "swap(address,(address,address,address,address,uint256,uint256,uint256),bytes,bytes)", decodeOneInchSwap)
+	RegisterDecoder(OneInchV6SwapSelector, "swap(address,(address,address,address,address,uint256,uint256,uint256),bytes)", decodeOneInchSwap)
+	RegisterDecoder(OneInchV5UnoswapSelector, "unoswap(address,uint256,uint256,uint256[])", decodeOneInchUnoswap)
+	RegisterDecoder(OneInchV6UnoswapSelector, "unoswap(uint256,uint256,uint256,uint256)", decodeOneInchUnoswap)
+	RegisterDecoder(OneInchV6Unoswap2Selector, "unoswap2(uint256,uint256,uint256,uint256,uint256)", decodeOneInchUnoswap)
+	RegisterDecoder(OneInchV6Unoswap3Selector, "unoswap3(uint256,uint256,uint256,uint256,uint256,uint256)", decodeOneInchUnoswap)
+	RegisterDecoder(OneInchV5UnoswapToSelector, "unoswapTo(address,address,uint256,uint256,uint256[])", decodeOneInchUnoswapTo)
+	RegisterDecoder(OneInchV6UnoswapToSelector, "unoswapTo(uint256,uint256,uint256,uint256,uint256)", decodeOneInchUnoswapTo)
+	RegisterDecoder(OneInchV6UnoswapTo2Selector, "unoswapTo2(uint256,uint256,uint256,uint256,uint256,uint256)", decodeOneInchUnoswapTo)
+	RegisterDecoder(OneInchV6UnoswapTo3Selector, "unoswapTo3(uint256,uint256,uint256,uint256,uint256,uint256,uint256)", decodeOneInchUnoswapTo)
+	RegisterReceiptResolver(oneInchProtocol, ResolveOneInchSwap)
+}
+
+// decodeOneInchSwap decodes a swap through an executor. The swap description
+// is a static tuple, so its fields follow the executor in the calldata head.
+// The amount returned is settled from the receipt; minReturnAmount is only
+// its floor.
+func decodeOneInchSwap(logger *slog.Logger, target common.Address, calldata []byte) (*Action, error) {
+	srcToken, err := calldataAddress(calldata, 1)
+	if err != nil {
+		return nil, err
+	}
+	dstToken, err := calldataAddress(calldata, 2)
+	if err != nil {
+		return nil, err
+	}
+	dstReceiver, err := calldataAddress(calldata, 4)
+	if err != nil {
+		return nil, err
+	}
+	amount, err := calldataUint(calldata, 5)
+	if err != nil {
+		return nil, err
+	}
+	minReturn, err := calldataUint(calldata, 6)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("1inch swap", "router", target.Hex(), "srcToken", srcToken.Hex(), "dstToken", dstToken.Hex(),
+		"amount", amount.String(), "minReturn", minReturn.String())
+
+	return &Action{
+		Protocol:  oneInchProtocol,
+		Verb:      VerbSwap,
+		AssetsIn:  []AssetAmount{{Token: dstToken, Amount: minReturn}},
+		AssetsOut: []AssetAmount{{Token: srcToken, Amount: amount}},
+		Recipient: dstReceiver,
+	}, nil
+}
+
+// decodeOneInchUnoswap decodes a swap through one or more pools paying the
+// caller. The calldata does not name the token bought, so it is settled
+// from the receipt.
+func decodeOneInchUnoswap(logger *slog.Logger, target common.Address, calldata []byte) (*Action, error) {
+	return decodeOneInchUnoswapAt(logger, target, calldata, 0)
+}
+
+// decodeOneInchUnoswapTo decodes a swap through one or more pools paying a recipient
+func decodeOneInchUnoswapTo(logger *slog.Logger, target common.Address, calldata []byte) (*Action, error) {
+	recipient, err := calldataAddress(calldata, 0)
+	if err != nil {
+		return nil, err
+	}
+	action, err := decodeOneInchUnoswapAt(logger, target, calldata, 1)
+	if err != nil {
+		return nil, err
+	}
+	action.Recipient = recipient
+	return action, nil
+}
+
+// decodeOneInchUnoswapAt decodes the source token and amount of an unoswap
+// starting at an argument. AggregationRouterV6 packs flags above the 160 bits
+// of its Address arguments, which the address decoding drops.
+func decodeOneInchUnoswapAt(logger *slog.Logger, target common.Address, calldata []byte, first int) (*Action, error) {
+	srcToken, err := calldataAddress(calldata, first)
+	if err != nil {
+		return nil, err
+	}
+	amount, err := calldataUint(calldata, first+1)
+	if err != nil {
+		return nil, err
+	}
+	minReturn, err := calldataUint(calldata, first+2)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("1inch unoswap", "router", target.Hex(), "srcToken", srcToken.Hex(), "amount", amount.String(), "minReturn", minReturn.String())
+
+	return &Action{
+		Protocol:  oneInchProtocol,
+		Verb:      VerbSwap,
+		AssetsOut: []AssetAmount{{Token: srcToken, Amount: amount}},
+	}, nil
+}
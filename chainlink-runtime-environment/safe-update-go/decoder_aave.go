@@ -0,0 +1,147 @@
+//go:build wasip1
+
+package main
+
+import (
+	"log/slog"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Aave withdraw(address asset, uint256 amount, address to)
+const AaveWithdrawSelector = "69328dec"
+
+// Aave V3 supply(address asset, uint256 amount, address onBehalfOf, uint16 referralCode)
+const AaveSupplySelector = "617ba037"
+
+// Aave V2 deposit(address asset, uint256 amount, address onBehalfOf, uint16 referralCode)
+const AaveDepositSelector = "e8eda9df"
+
+// Aave borrow(address asset, uint256 amount, uint256 interestRateMode, uint16 referralCode, address onBehalfOf)
+const AaveBorrowSelector = "a415bcad"
+
+// Aave repay(address asset, uint256 amount, uint256 interestRateMode, address onBehalfOf)
+const AaveRepaySelector = "573ade81"
+
+// aaveProtocol is the protocol name of Aave pool actions
+const aaveProtocol = "aave"
+
+func init() {
+	RegisterDecoder(AaveWithdrawSelector, "withdraw(address,uint256,address)", decodeAaveWithdraw)
+	RegisterDecoder(AaveSupplySelector, "supply(address,uint256,address,uint16)", decodeAaveSupply)
+	RegisterDecoder(AaveDepositSelector, "deposit(address,uint256,address,uint16)", decodeAaveSupply)
+	RegisterDecoder(AaveBorrowSelector, "borrow(address,uint256,uint256,uint16,address)", decodeAaveBorrow)
+	RegisterDecoder(AaveRepaySelector, "repay(address,uint256,uint256,address)", decodeAaveRepay)
+	RegisterReceiptResolver(aaveProtocol, ResolveAaveFullAmount)
+}
+
+// decodeAaveWithdraw decodes an Aave pool withdrawal
+func decodeAaveWithdraw(logger *slog.Logger, target common.Address, calldata []byte) (*Action, error) {
+	logger.Info("Detected Aave withdraw function")
+
+	asset, err := calldataAddress(calldata, 0)
+	if err != nil {
+		return nil, err
+	}
+	amount, err := calldataUint(calldata, 1)
+	if err != nil {
+		return nil, err
+	}
+	to, err := calldataAddress(calldata, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("Aave withdrawal", "amount", amount.String(), "token", asset.Hex())
+
+	return &Action{
+		Protocol:  aaveProtocol,
+		Verb:      VerbWithdraw,
+		AssetsIn:  []AssetAmount{{Token: asset, Amount: amount}},
+		Recipient: to,
+	}, nil
+}
+
+// decodeAaveSupply decodes an Aave pool supply (V3) or deposit (V2). The
+// supplied asset leaves the Safe.
+func decodeAaveSupply(logger *slog.Logger, target common.Address, calldata []byte) (*Action, error) {
+	logger.Info("Detected Aave supply function")
+
+	asset, err := calldataAddress(calldata, 0)
+	if err != nil {
+		return nil, err
+	}
+	amount, err := calldataUint(calldata, 1)
+	if err != nil {
+		return nil, err
+	}
+	onBehalfOf, err := calldataAddress(calldata, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("Aave supply", "amount", amount.String(), "token", asset.Hex())
+
+	return &Action{
+		Protocol:  aaveProtocol,
+		Verb:      VerbDeposit,
+		AssetsOut: []AssetAmount{{Token: asset, Amount: amount}},
+		Recipient: onBehalfOf,
+	}, nil
+}
+
+// decodeAaveBorrow decodes an Aave pool borrow. The borrowed asset flows into
+// the Safe as debt.
+func decodeAaveBorrow(logger *slog.Logger, target common.Address, calldata []byte) (*Action, error) {
+	logger.Info("Detected Aave borrow function")
+
+	asset, err := calldataAddress(calldata, 0)
+	if err != nil {
+		return nil, err
+	}
+	amount, err := calldataUint(calldata, 1)
+	if err != nil {
+		return nil, err
+	}
+	onBehalfOf, err := calldataAddress(calldata, 4)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("Aave borrow", "amount", amount.String(), "token", asset.Hex())
+
+	return &Action{
+		Protocol:  aaveProtocol,
+		Verb:      VerbBorrow,
+		AssetsIn:  []AssetAmount{{Token: asset, Amount: amount, Debt: true}},
+		Recipient: onBehalfOf,
+	}, nil
+}
+
+// decodeAaveRepay decodes an Aave pool repayment. The repaid asset leaves the
+// Safe and pays down debt.
+func decodeAaveRepay(logger *slog.Logger, target common.Address, calldata []byte) (*Action, error) {
+	logger.Info("Detected Aave repay function")
+
+	asset, err := calldataAddress(calldata, 0)
+	if err != nil {
+		return nil, err
+	}
+	amount, err := calldataUint(calldata, 1)
+	if err != nil {
+		return nil, err
+	}
+	onBehalfOf, err := calldataAddress(calldata, 3)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("Aave repay", "amount", amount.String(), "token", asset.Hex())
+
+	return &Action{
+		Protocol:  aaveProtocol,
+		Verb:      VerbRepay,
+		AssetsOut: []AssetAmount{{Token: asset, Amount: amount, Debt: true}},
+		Recipient: onBehalfOf,
+	}, nil
+}
@@ -0,0 +1,145 @@
+//go:build wasip1
+
+package main
+
+import (
+	"log/slog"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// aaveTestPool is an Aave pool that is not a SparkLend pool
+var aaveTestPool = common.HexToAddress("0x87870Bca3F3fD6335C3F4ce8392D69350B4fA4E2")
+
+func TestAaveCalldataOffsets(t *testing.T) {
+	asset := common.HexToAddress("0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48")
+	safe := common.HexToAddress("0x00000000000000000000000000000000000000cc")
+	amount := big.NewInt(1_500_000)
+	mode, referral := big.NewInt(2), big.NewInt(0)
+
+	tests := []struct {
+		name      string
+		calldata  []byte
+		verb      Verb
+		in        bool
+		debt      bool
+		recipient common.Address
+		// recipientAt is where the recipient's 20 bytes sit in the calldata
+		recipientAt int
+	}{
+		{"withdraw", wordCalldata(t, AaveWithdrawSelector, asset, amount, safe), VerbWithdraw, true, false, safe, 80},
+		{"supply", wordCalldata(t, AaveSupplySelector, asset, amount, safe, referral), VerbDeposit, false, false, safe, 80},
+		{"deposit", wordCalldata(t, AaveDepositSelector, asset, amount, safe, referral), VerbDeposit, false, false, safe, 80},
+		{"borrow", wordCalldata(t, AaveBorrowSelector, asset, amount, mode, referral, safe), VerbBorrow, true, true, safe, 144},
+		{"repay", wordCalldata(t, AaveRepaySelector, asset, amount, mode, safe), VerbRepay, false, true, safe, 112},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The asset is calldata[16:36]: the selector, then 12 bytes of padding
+			if common.BytesToAddress(tt.calldata[16:36]) != asset {
+				t.Fatalf("asset not at [16:36]")
+			}
+			if new(big.Int).SetBytes(tt.calldata[36:68]).Cmp(amount) != 0 {
+				t.Fatalf("amount not at [36:68]")
+			}
+			if common.BytesToAddress(tt.calldata[tt.recipientAt:tt.recipientAt+20]) != tt.recipient {
+				t.Fatalf("recipient not at [%d:%d]", tt.recipientAt, tt.recipientAt+20)
+			}
+
+			action, err := DecodeAction(slog.New(slog.DiscardHandler), aaveTestPool, tt.calldata)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if action.Protocol != aaveProtocol || action.Verb != tt.verb || action.Confidence != ConfidenceExactABI {
+				t.Errorf("decoded %s %s (%s)", action.Protocol, action.Verb, action.Confidence)
+			}
+			assets, other := action.AssetsOut, action.AssetsIn
+			if tt.in {
+				assets, other = action.AssetsIn, action.AssetsOut
+			}
+			if len(assets) != 1 || len(other) != 0 {
+				t.Fatalf("assets in %+v, out %+v", action.AssetsIn, action.AssetsOut)
+			}
+			if assets[0].Token != asset || assets[0].Amount.Cmp(amount) != 0 || assets[0].Debt != tt.debt {
+				t.Errorf("asset %+v", assets[0])
+			}
+			if action.Recipient != tt.recipient {
+				t.Errorf("recipient %s", action.Recipient.Hex())
+			}
+			// Debt is never debited, so borrows and repays are held for review
+			if held, _ := DebtReview(action); held != tt.debt {
+				t.Errorf("held for review %v", held)
+			}
+		})
+	}
+}
+
+func TestAaveCalldataEdgeCases(t *testing.T) {
+	asset := common.HexToAddress("0x6B175474E89094C44Da98b954EedeAC495271d0F")
+	safe := common.HexToAddress("0x00000000000000000000000000000000000000cc")
+	logger := slog.New(slog.DiscardHandler)
+
+	t.Run("max amount", func(t *testing.T) {
+		max := bigInt(t, maxUint256)
+		action, err := DecodeAction(logger, aaveTestPool, wordCalldata(t, AaveWithdrawSelector, asset, max, safe))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// type(uint256).max is left to the receipt resolver, which reads the amount withdrawn
+		if action.AssetsIn[0].Amount.Cmp(max) != 0 {
+			t.Errorf("amount %s", action.AssetsIn[0].Amount)
+		}
+	})
+
+	t.Run("dirty address padding", func(t *testing.T) {
+		calldata := wordCalldata(t, AaveWithdrawSelector, asset, big.NewInt(1), safe)
+		copy(calldata[4:16], []byte{0xde, 0xad, 0xbe, 0xef})
+		action, err := DecodeAction(logger, aaveTestPool, calldata)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The padding is ignored, but calldata no ABI encoder produces is downgraded
+		if action.AssetsIn[0].Token != asset {
+			t.Errorf("asset %s", action.AssetsIn[0].Token.Hex())
+		}
+		if action.Confidence != ConfidenceHeuristic {
+			t.Errorf("confidence %s", action.Confidence)
+		}
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		for _, selector := range []string{AaveWithdrawSelector, AaveSupplySelector, AaveBorrowSelector, AaveRepaySelector} {
+			calldata := wordCalldata(t, selector, asset, big.NewInt(1), safe, safe, safe)
+			words := map[string]int{AaveWithdrawSelector: 3, AaveSupplySelector: 3, AaveBorrowSelector: 5, AaveRepaySelector: 4}[selector]
+			if _, err := DecodeAction(logger, aaveTestPool, calldata[:4+words*32-1]); err == nil {
+				t.Errorf("0x%s decoded from %d bytes", selector, 4+words*32-1)
+			}
+		}
+	})
+
+	t.Run("spark pool", func(t *testing.T) {
+		spark := common.HexToAddress("0xC13e21B648A5Ee794902342038FF3aDAB66BE987")
+		calldata := wordCalldata(t, AaveWithdrawSelector, asset, big.NewInt(1), safe)
+		config := &Config{SparkPools: []Address{NewAddress(spark)}}
+
+		action, err := DecodeAction(logger, spark, calldata)
+		if err != nil {
+			t.Fatal(err)
+		}
+		LabelConfiguredProtocol(config, action)
+		if action.Protocol != sparkProtocol {
+			t.Errorf("protocol %s", action.Protocol)
+		}
+
+		action, err = DecodeAction(logger, aaveTestPool, calldata)
+		if err != nil {
+			t.Fatal(err)
+		}
+		LabelConfiguredProtocol(config, action)
+		if action.Protocol != aaveProtocol {
+			t.Errorf("unlisted pool decoded as %s", action.Protocol)
+		}
+	})
+}
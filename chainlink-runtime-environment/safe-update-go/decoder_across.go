@@ -0,0 +1,50 @@
+//go:build wasip1
+
+package main
+
+import (
+	"log/slog"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Across SpokePool depositV3(address depositor, address recipient, address inputToken, address outputToken, uint256 inputAmount, uint256 outputAmount, uint256 destinationChainId, address exclusiveRelayer, uint32 quoteTimestamp, uint32 fillDeadline, uint32 exclusivityDeadline, bytes message)
+const AcrossDepositV3Selector = "7b939232"
+
+// acrossProtocol is the protocol name of Across bridge deposits
+const acrossProtocol = "across"
+
+func init() {
+	RegisterDecoder(AcrossDepositV3Selector, "depositV3(address,address,address,address,uint256,uint256,uint256,address,uint32,uint32,uint32,bytes)", decodeAcrossDepositV3)
+}
+
+// decodeAcrossDepositV3 decodes a deposit to another chain. The input amount
+// leaves the Safe for the recipient on the destination chain.
+func decodeAcrossDepositV3(logger *slog.Logger, target common.Address, calldata []byte) (*Action, error) {
+	recipient, err := calldataAddress(calldata, 1)
+	if err != nil {
+		return nil, err
+	}
+	inputToken, err := calldataAddress(calldata, 2)
+	if err != nil {
+		return nil, err
+	}
+	inputAmount, err := calldataUint(calldata, 4)
+	if err != nil {
+		return nil, err
+	}
+	destinationChainID, err := calldataUint(calldata, 6)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("Across deposit", "spokePool", target.Hex(), "inputToken", inputToken.Hex(), "inputAmount", inputAmount.String(),
+		"destinationChainId", destinationChainID.String(), "recipient", recipient.Hex())
+
+	return &Action{
+		Protocol:             acrossProtocol,
+		Verb:                 VerbBridge,
+		AssetsOut:            []AssetAmount{{Token: inputToken, Amount: inputAmount}},
+		DestinationRecipient: recipient,
+	}, nil
+}
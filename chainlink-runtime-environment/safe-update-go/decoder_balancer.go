@@ -0,0 +1,92 @@
+//go:build wasip1
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Balancer V2 Vault exitPool(bytes32 poolId, address sender, address recipient, ExitPoolRequest request)
+const BalancerExitPoolSelector = "8bdb3913"
+
+// balancerProtocol is the protocol name of Balancer V2 Vault actions
+const balancerProtocol = "balancer"
+
+// balancerInternalBalanceReviewReason explains why exits to the Vault's internal balance are held for review
+const balancerInternalBalanceReviewReason = "Balancer exit to the Vault's internal balance pays nothing to the Safe"
+
+// Balancer V2 Vault ABI (exitPool)
+const balancerVaultABI = `[
+	{"name":"exitPool","type":"function","outputs":[],"inputs":[
+		{"name":"poolId","type":"bytes32"},
+		{"name":"sender","type":"address"},
+		{"name":"recipient","type":"address"},
+		{"name":"request","type":"tuple","components":[
+			{"name":"assets","type":"address[]"},
+			{"name":"minAmountsOut","type":"uint256[]"},
+			{"name":"userData","type":"bytes"},
+			{"name":"toInternalBalance","type":"bool"}
+		]}
+	]}
+]`
+
+// exitPoolRequest represents the ExitPoolRequest struct of exitPool
+type exitPoolRequest struct {
+	Assets            []common.Address
+	MinAmountsOut     []*big.Int
+	UserData          []byte
+	ToInternalBalance bool
+}
+
+func init() {
+	RegisterDecoder(BalancerExitPoolSelector, "exitPool(bytes32,address,address,(address[],uint256[],bytes,bool))", decodeBalancerExitPool)
+	RegisterReceiptResolver(balancerProtocol, ResolveBalancerExit)
+}
+
+// decodeBalancerExitPool decodes a Balancer V2 pool exit. The request only
+// carries minimums, so the tokens and amounts come from the Vault's
+// PoolBalanceChanged event for the poolId. Exits to the Vault's internal
+// balance leave the tokens in the Vault, so they are held for review.
+func decodeBalancerExitPool(logger *slog.Logger, target common.Address, calldata []byte) (*Action, error) {
+	parsedVaultABI, err := abi.JSON(strings.NewReader(balancerVaultABI))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse Balancer Vault ABI: %w", err)
+	}
+
+	values, err := parsedVaultABI.Methods["exitPool"].Inputs.Unpack(calldata[4:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to unpack exitPool: %w", err)
+	}
+	poolID, ok := values[0].([32]byte)
+	if !ok {
+		return nil, fmt.Errorf("unexpected exitPool poolId")
+	}
+	recipient, ok := values[2].(common.Address)
+	if !ok {
+		return nil, fmt.Errorf("unexpected exitPool recipient")
+	}
+	request, ok := abi.ConvertType(values[3], new(exitPoolRequest)).(*exitPoolRequest)
+	if !ok {
+		return nil, fmt.Errorf("unexpected exitPool request")
+	}
+
+	// The pool address is the first 20 bytes of its id
+	logger.Info("Balancer exit pool", "poolId", common.Hash(poolID).Hex(), "pool", common.BytesToAddress(poolID[:20]).Hex(),
+		"assets", len(request.Assets), "toInternalBalance", request.ToInternalBalance)
+
+	action := &Action{
+		Protocol:  balancerProtocol,
+		Verb:      VerbWithdraw,
+		Recipient: recipient,
+	}
+	if request.ToInternalBalance {
+		action.NeedsReview, action.ReviewReason = true, balancerInternalBalanceReviewReason
+	}
+	return action, nil
+}
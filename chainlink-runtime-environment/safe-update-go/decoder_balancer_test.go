@@ -0,0 +1,67 @@
+//go:build wasip1
+
+package main
+
+import (
+	"log/slog"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// balancerTestVault is the Balancer V2 Vault
+var balancerTestVault = common.HexToAddress("0xBA12222222228d8Ba445958a75a0704d566BF2C8")
+
+// balancerExitCalldata packs an exitPool call of a two-token pool
+func balancerExitCalldata(t *testing.T, recipient common.Address, toInternalBalance bool) []byte {
+	t.Helper()
+	var poolID [32]byte
+	copy(poolID[:], common.HexToAddress("0x5c6Ee304399DBdB9C8Ef030aB642B10820DB8F56").Bytes())
+	request := exitPoolRequest{
+		Assets:            []common.Address{common.HexToAddress("0xba100000625a3754423978a60c9317c58a424e3D"), common.HexToAddress("0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2")},
+		MinAmountsOut:     []*big.Int{big.NewInt(1), big.NewInt(1)},
+		UserData:          []byte{0x01},
+		ToInternalBalance: toInternalBalance,
+	}
+	return abiCalldata(t, balancerVaultABI, BalancerExitPoolSelector, poolID, recipient, recipient, request)
+}
+
+func TestDecodeBalancerExitPool(t *testing.T) {
+	safe := common.HexToAddress("0x00000000000000000000000000000000000000cc")
+
+	tests := []struct {
+		name              string
+		toInternalBalance bool
+		review            bool
+	}{
+		{"paid to the recipient", false, false},
+		{"kept in the internal balance", true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action, err := DecodeAction(slog.New(slog.DiscardHandler), balancerTestVault, balancerExitCalldata(t, safe, tt.toInternalBalance))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if action.Protocol != balancerProtocol || action.Verb != VerbWithdraw || action.Confidence != ConfidenceExactABI {
+				t.Errorf("decoded %s %s (%s)", action.Protocol, action.Verb, action.Confidence)
+			}
+			// Amounts come from PoolBalanceChanged, not from the request minimums
+			if len(action.AssetsIn) != 0 || len(action.AssetsOut) != 0 {
+				t.Errorf("assets in %+v, out %+v", action.AssetsIn, action.AssetsOut)
+			}
+			if action.Recipient != safe {
+				t.Errorf("recipient %s", action.Recipient.Hex())
+			}
+			if action.NeedsReview != tt.review || (tt.review && action.ReviewReason != balancerInternalBalanceReviewReason) {
+				t.Errorf("review %t (%s)", action.NeedsReview, action.ReviewReason)
+			}
+		})
+	}
+
+	truncated := balancerExitCalldata(t, safe, false)
+	if _, err := DecodeAction(slog.New(slog.DiscardHandler), balancerTestVault, truncated[:4+3*32]); err == nil {
+		t.Error("decoded an exitPool without its request")
+	}
+}
@@ -0,0 +1,75 @@
+//go:build wasip1
+
+package main
+
+import (
+	"log/slog"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Compound III withdraw(address asset, uint256 amount)
+const CometWithdrawSelector = "f3fef3a3"
+
+// Compound III withdrawTo(address to, address asset, uint256 amount)
+const CometWithdrawToSelector = "c3b35a7e"
+
+// cometProtocol is the protocol name of Compound III actions
+const cometProtocol = "compound"
+
+func init() {
+	RegisterDecoder(CometWithdrawSelector, "withdraw(address,uint256)", decodeCometWithdraw)
+	RegisterDecoder(CometWithdrawToSelector, "withdrawTo(address,address,uint256)", decodeCometWithdrawTo)
+	RegisterReceiptResolver(cometProtocol, ResolveCometWithdrawal)
+}
+
+// decodeCometWithdraw decodes a Compound III withdrawal to the caller. Whether
+// the asset is the market's base asset or a collateral asset is resolved from
+// the receipt.
+func decodeCometWithdraw(logger *slog.Logger, target common.Address, calldata []byte) (*Action, error) {
+	logger.Info("Detected Compound III withdraw function")
+
+	asset, err := calldataAddress(calldata, 0)
+	if err != nil {
+		return nil, err
+	}
+	amount, err := calldataUint(calldata, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("Compound III withdrawal", "amount", amount.String(), "token", asset.Hex(), "comet", target.Hex())
+
+	return &Action{
+		Protocol: cometProtocol,
+		Verb:     VerbWithdraw,
+		AssetsIn: []AssetAmount{{Token: asset, Amount: amount}},
+	}, nil
+}
+
+// decodeCometWithdrawTo decodes a Compound III withdrawal to a recipient
+func decodeCometWithdrawTo(logger *slog.Logger, target common.Address, calldata []byte) (*Action, error) {
+	logger.Info("Detected Compound III withdrawTo function")
+
+	to, err := calldataAddress(calldata, 0)
+	if err != nil {
+		return nil, err
+	}
+	asset, err := calldataAddress(calldata, 1)
+	if err != nil {
+		return nil, err
+	}
+	amount, err := calldataUint(calldata, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("Compound III withdrawal", "amount", amount.String(), "token", asset.Hex(), "comet", target.Hex(), "to", to.Hex())
+
+	return &Action{
+		Protocol:  cometProtocol,
+		Verb:      VerbWithdraw,
+		AssetsIn:  []AssetAmount{{Token: asset, Amount: amount}},
+		Recipient: to,
+	}, nil
+}
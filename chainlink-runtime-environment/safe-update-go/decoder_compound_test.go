@@ -0,0 +1,57 @@
+//go:build wasip1
+
+package main
+
+import (
+	"log/slog"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// cometTestMarket is the Compound III USDC market
+var cometTestMarket = common.HexToAddress("0xc3d688B66703497DAA19211EEdff47f25384cdc3")
+
+func TestDecodeCometWithdraw(t *testing.T) {
+	asset := common.HexToAddress("0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48")
+	safe := common.HexToAddress("0x00000000000000000000000000000000000000cc")
+	amount := big.NewInt(2_500_000)
+
+	tests := []struct {
+		name      string
+		calldata  []byte
+		amount    *big.Int
+		recipient common.Address
+	}{
+		{"withdraw", wordCalldata(t, CometWithdrawSelector, asset, amount), amount, common.Address{}},
+		{"withdrawTo", wordCalldata(t, CometWithdrawToSelector, safe, asset, amount), amount, safe},
+		{"withdraw everything", wordCalldata(t, CometWithdrawSelector, asset, bigInt(t, maxUint256)), bigInt(t, maxUint256), common.Address{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action, err := DecodeAction(slog.New(slog.DiscardHandler), cometTestMarket, tt.calldata)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if action.Protocol != cometProtocol || action.Verb != VerbWithdraw || action.Confidence != ConfidenceExactABI {
+				t.Errorf("decoded %s %s (%s)", action.Protocol, action.Verb, action.Confidence)
+			}
+			if len(action.AssetsIn) != 1 || action.AssetsIn[0].Token != asset || action.AssetsIn[0].Amount.Cmp(tt.amount) != 0 {
+				t.Fatalf("assets in %+v", action.AssetsIn)
+			}
+			if action.Recipient != tt.recipient {
+				t.Errorf("recipient %s, want %s", action.Recipient.Hex(), tt.recipient.Hex())
+			}
+		})
+	}
+
+	for name, calldata := range map[string][]byte{
+		"withdraw without amount":   wordCalldata(t, CometWithdrawSelector, asset),
+		"withdrawTo without amount": wordCalldata(t, CometWithdrawToSelector, safe, asset),
+	} {
+		if _, err := DecodeAction(slog.New(slog.DiscardHandler), cometTestMarket, calldata); err == nil {
+			t.Errorf("%s: decoded", name)
+		}
+	}
+}
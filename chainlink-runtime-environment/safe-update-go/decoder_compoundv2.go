@@ -0,0 +1,101 @@
+//go:build wasip1
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Compound v2 redeem(uint256 redeemTokens)
+const CTokenRedeemSelector = "db006a75"
+
+// Compound v2 redeemUnderlying(uint256 redeemAmount)
+const CTokenRedeemUnderlyingSelector = "852a12e3"
+
+// compoundV2Protocol is the protocol name of Compound v2 cToken actions
+const compoundV2Protocol = "compoundv2"
+
+// CompoundV2Fork represents a Compound v2 fork. Forks keep the cToken
+// functions and exchange rate, so their markets are decoded and valued like
+// cTokens and told apart by their comptroller.
+type CompoundV2Fork struct {
+	Protocol     string    `json:"protocol"`
+	Comptrollers []Address `json:"comptrollers"`
+}
+
+func init() {
+	RegisterDecoder(CTokenRedeemSelector, "redeem(uint256)", decodeCTokenRedeem)
+	RegisterDecoder(CTokenRedeemUnderlyingSelector, "redeemUnderlying(uint256)", decodeCTokenRedeemUnderlying)
+	RegisterReceiptResolver(compoundV2Protocol, ResolveCTokenRedeem)
+}
+
+// compoundV2ForkOf returns the configured fork of a comptroller, if any
+func compoundV2ForkOf(config *Config, comptroller common.Address) (*CompoundV2Fork, bool) {
+	for i := range config.CompoundV2Forks {
+		for _, known := range config.CompoundV2Forks[i].Comptrollers {
+			if known.Address == comptroller {
+				return &config.CompoundV2Forks[i], true
+			}
+		}
+	}
+	return nil, false
+}
+
+// ValidateCompoundV2Forks checks the configured Compound v2 forks
+func ValidateCompoundV2Forks(forks []CompoundV2Fork) error {
+	seen := make(map[string]bool)
+	for i, fork := range forks {
+		if fork.Protocol == "" || fork.Protocol == compoundV2Protocol {
+			return fmt.Errorf("fork %d: protocol is required and must not be %s", i, compoundV2Protocol)
+		}
+		if seen[fork.Protocol] {
+			return fmt.Errorf("fork %d: duplicate protocol %s", i, fork.Protocol)
+		}
+		seen[fork.Protocol] = true
+		if len(fork.Comptrollers) == 0 {
+			return fmt.Errorf("fork %s: comptrollers is required", fork.Protocol)
+		}
+	}
+	return nil
+}
+
+// decodeCTokenRedeem decodes a cToken redemption, including the vTokens of
+// Venus and the qiTokens of Benqi. The amount is in cTokens; the underlying
+// amount is settled from the receipt.
+func decodeCTokenRedeem(logger *slog.Logger, target common.Address, calldata []byte) (*Action, error) {
+	logger.Info("Detected Compound v2 redeem function")
+
+	redeemTokens, err := calldataUint(calldata, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("Compound v2 redemption", "cTokens", redeemTokens.String(), "cToken", target.Hex())
+
+	return &Action{
+		Protocol: compoundV2Protocol,
+		Verb:     VerbWithdraw,
+		AssetsIn: []AssetAmount{{Token: target, Amount: redeemTokens, CToken: true, Shares: true}},
+	}, nil
+}
+
+// decodeCTokenRedeemUnderlying decodes a cToken redemption of an underlying amount
+func decodeCTokenRedeemUnderlying(logger *slog.Logger, target common.Address, calldata []byte) (*Action, error) {
+	logger.Info("Detected Compound v2 redeemUnderlying function")
+
+	redeemAmount, err := calldataUint(calldata, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("Compound v2 redemption", "amount", redeemAmount.String(), "cToken", target.Hex())
+
+	return &Action{
+		Protocol: compoundV2Protocol,
+		Verb:     VerbWithdraw,
+		AssetsIn: []AssetAmount{{Token: target, Amount: redeemAmount, CToken: true}},
+	}, nil
+}
@@ -0,0 +1,82 @@
+//go:build wasip1
+
+package main
+
+import (
+	"log/slog"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// cTokenTestMarket is cUSDC
+var cTokenTestMarket = common.HexToAddress("0x39AA39c021dfbaE8faC545936693aC917d5E7563")
+
+func TestDecodeCTokenRedeem(t *testing.T) {
+	tests := []struct {
+		name     string
+		calldata []byte
+		amount   *big.Int
+		// shares is set when the amount is in cTokens rather than the underlying
+		shares bool
+	}{
+		{"redeem", wordCalldata(t, CTokenRedeemSelector, 5_000_000_000), big.NewInt(5_000_000_000), true},
+		{"redeemUnderlying", wordCalldata(t, CTokenRedeemUnderlyingSelector, 1_000_000), big.NewInt(1_000_000), false},
+		{"redeem everything", wordCalldata(t, CTokenRedeemSelector, bigInt(t, maxUint256)), bigInt(t, maxUint256), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action, err := DecodeAction(slog.New(slog.DiscardHandler), cTokenTestMarket, tt.calldata)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if action.Protocol != compoundV2Protocol || action.Verb != VerbWithdraw || action.Confidence != ConfidenceExactABI {
+				t.Errorf("decoded %s %s (%s)", action.Protocol, action.Verb, action.Confidence)
+			}
+			if len(action.AssetsIn) != 1 {
+				t.Fatalf("assets in %+v", action.AssetsIn)
+			}
+			asset := action.AssetsIn[0]
+			if asset.Token != cTokenTestMarket || !asset.CToken || asset.Shares != tt.shares || asset.Amount.Cmp(tt.amount) != 0 {
+				t.Errorf("asset %+v", asset)
+			}
+		})
+	}
+
+	if _, err := DecodeAction(slog.New(slog.DiscardHandler), cTokenTestMarket, wordCalldata(t, CTokenRedeemSelector)); err == nil {
+		t.Error("decoded a redeem without amount")
+	}
+}
+
+func TestCompoundV2Forks(t *testing.T) {
+	venus := common.HexToAddress("0xfD36E2c2a6789Db23113685031d7F16329158384")
+	forks := []CompoundV2Fork{{Protocol: "venus", Comptrollers: []Address{{Address: venus}}}}
+
+	config := &Config{CompoundV2Forks: forks}
+	if fork, ok := compoundV2ForkOf(config, venus); !ok || fork.Protocol != "venus" {
+		t.Errorf("fork of the Venus comptroller: %+v", fork)
+	}
+	if _, ok := compoundV2ForkOf(config, common.HexToAddress("0x3d9819210A31b4961b30EF54bE2aeD79B9c9Cd3B")); ok {
+		t.Error("the Compound comptroller is a fork")
+	}
+
+	tests := []struct {
+		name  string
+		forks []CompoundV2Fork
+		valid bool
+	}{
+		{"one fork", forks, true},
+		{"no protocol", []CompoundV2Fork{{Comptrollers: []Address{{Address: venus}}}}, false},
+		{"compoundv2 protocol", []CompoundV2Fork{{Protocol: compoundV2Protocol, Comptrollers: []Address{{Address: venus}}}}, false},
+		{"duplicate protocol", append(append([]CompoundV2Fork{}, forks...), forks...), false},
+		{"no comptrollers", []CompoundV2Fork{{Protocol: "benqi"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateCompoundV2Forks(tt.forks); (err == nil) != tt.valid {
+				t.Errorf("error %v, want valid %t", err, tt.valid)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+//go:build wasip1
+
+package main
+
+import (
+	"log/slog"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Convex and Aura reward pool withdrawAndUnwrap(uint256 amount, bool claim)
+const ConvexWithdrawAndUnwrapSelector = "c32e7202"
+
+// Convex and Aura reward pool withdrawAllAndUnwrap(bool claim)
+const ConvexWithdrawAllAndUnwrapSelector = "49f039a2"
+
+// Protocol names of boosted staking actions
+const (
+	convexProtocol = "convex"
+	auraProtocol   = "aura"
+)
+
+func init() {
+	RegisterDecoder(ConvexWithdrawAndUnwrapSelector, "withdrawAndUnwrap(uint256,bool)", decodeConvexWithdrawAndUnwrap)
+	RegisterDecoder(ConvexWithdrawAllAndUnwrapSelector, "withdrawAllAndUnwrap(bool)", decodeConvexWithdrawAndUnwrap)
+	RegisterReceiptResolver(convexProtocol, ResolveConvexUnstake)
+}
+
+// decodeConvexWithdrawAndUnwrap decodes unstaking from a Convex or Aura reward
+// pool back to the Curve or Balancer LP token. The LP token and the amount
+// withdrawn are settled from the pool and the receipt.
+func decodeConvexWithdrawAndUnwrap(logger *slog.Logger, target common.Address, calldata []byte) (*Action, error) {
+	var assets []AssetAmount
+	if len(calldata) >= 4+2*32 {
+		amount, err := calldataUint(calldata, 0)
+		if err != nil {
+			return nil, err
+		}
+		assets = append(assets, AssetAmount{Amount: amount})
+		logger.Info("Convex withdrawAndUnwrap", "rewardPool", target.Hex(), "amount", amount.String())
+	} else {
+		logger.Info("Convex withdrawAllAndUnwrap", "rewardPool", target.Hex())
+	}
+
+	return &Action{
+		Protocol: convexProtocol,
+		Verb:     VerbWithdraw,
+		AssetsIn: assets,
+	}, nil
+}
@@ -0,0 +1,84 @@
+//go:build wasip1
+
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// CowSwap GPv2Settlement setPreSignature(bytes orderUid, bool signed)
+const CowSwapSetPreSignatureSelector = "ec6cb13f"
+
+// cowSwapProtocol is the protocol name of CowSwap orders
+const cowSwapProtocol = "cowswap"
+
+// GPv2Settlement ABI (setPreSignature and the Trade event)
+const cowSwapSettlementABI = `[
+	{"inputs":[{"name":"orderUid","type":"bytes"},{"name":"signed","type":"bool"}],"name":"setPreSignature","outputs":[],"type":"function"},
+	{"anonymous":false,"inputs":[{"indexed":true,"name":"owner","type":"address"},{"indexed":false,"name":"sellToken","type":"address"},{"indexed":false,"name":"buyToken","type":"address"},{"indexed":false,"name":"sellAmount","type":"uint256"},{"indexed":false,"name":"buyAmount","type":"uint256"},{"indexed":false,"name":"feeAmount","type":"uint256"},{"indexed":false,"name":"orderUid","type":"bytes"}],"name":"Trade","type":"event"}
+]`
+
+// cowSwapOrderUIDLength is the length of an order uid: the order digest, its
+// owner and its validTo timestamp
+const cowSwapOrderUIDLength = 32 + 20 + 4
+
+func init() {
+	RegisterDecoder(CowSwapSetPreSignatureSelector, "setPreSignature(bytes,bool)", decodeCowSwapSetPreSignature)
+}
+
+// decodeCowSwapSetPreSignature decodes the pre-signing or cancellation of a
+// CowSwap order by the Safe. Signing moves no tokens; the order is tracked
+// until a solver settles it, and its trade is accounted then.
+func decodeCowSwapSetPreSignature(logger *slog.Logger, target common.Address, calldata []byte) (*Action, error) {
+	parsedSettlementABI, err := abi.JSON(strings.NewReader(cowSwapSettlementABI))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse GPv2Settlement ABI: %w", err)
+	}
+	values, err := parsedSettlementABI.Methods["setPreSignature"].Inputs.Unpack(calldata[4:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to unpack setPreSignature: %w", err)
+	}
+	uid, ok := values[0].([]byte)
+	if !ok {
+		return nil, fmt.Errorf("unexpected setPreSignature orderUid")
+	}
+	signed, ok := values[1].(bool)
+	if !ok {
+		return nil, fmt.Errorf("unexpected setPreSignature signed flag")
+	}
+
+	order, err := parseCowSwapOrderUID(uid)
+	if err != nil {
+		return nil, err
+	}
+	order.Signed = signed
+
+	logger.Info("CowSwap pre-signature", "settlement", target.Hex(), "orderUid", order.UID, "owner", order.Owner.Hex(),
+		"validTo", order.ValidTo.UTC().Format(time.RFC3339), "signed", signed)
+
+	return &Action{
+		Protocol: cowSwapProtocol,
+		Verb:     VerbSwap,
+		Order:    order,
+	}, nil
+}
+
+// parseCowSwapOrderUID splits an order uid into its owner and validTo
+func parseCowSwapOrderUID(uid []byte) (*PendingOrder, error) {
+	if len(uid) != cowSwapOrderUIDLength {
+		return nil, fmt.Errorf("invalid CowSwap order uid length %d", len(uid))
+	}
+	return &PendingOrder{
+		UID:     "0x" + hex.EncodeToString(uid),
+		Owner:   common.BytesToAddress(uid[32:52]),
+		ValidTo: time.Unix(int64(binary.BigEndian.Uint32(uid[52:])), 0),
+	}, nil
+}
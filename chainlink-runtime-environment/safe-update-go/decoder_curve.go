@@ -0,0 +1,126 @@
+//go:build wasip1
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Curve remove_liquidity(uint256 _amount, uint256[N] min_amounts) of 2, 3 and 4-coin pools
+const (
+	CurveRemoveLiquidity2Selector = "5b36389c"
+	CurveRemoveLiquidity3Selector = "ecb586a5"
+	CurveRemoveLiquidity4Selector = "7d49d875"
+)
+
+// Curve remove_liquidity_one_coin(uint256 _token_amount, int128 i, uint256 min_amount), and
+// its uint256 index variant of newer pools
+const (
+	CurveRemoveOneCoinSelector     = "1a4d01d2"
+	CurveRemoveOneCoinUintSelector = "f1dc3cc9"
+)
+
+// Curve remove_liquidity_imbalance(uint256[N] amounts, uint256 max_burn_amount) of 2, 3 and 4-coin pools
+const (
+	CurveRemoveImbalance2Selector = "e3103273"
+	CurveRemoveImbalance3Selector = "9fdaea0c"
+	CurveRemoveImbalance4Selector = "18a7bd76"
+)
+
+// curveProtocol is the protocol name of Curve pool actions
+const curveProtocol = "curve"
+
+// maxCurveCoins is the largest number of coins of a Curve pool
+const maxCurveCoins = 8
+
+func init() {
+	RegisterDecoder(CurveRemoveLiquidity2Selector, "remove_liquidity(uint256,uint256[2])", curveRemoveLiquidity(2))
+	RegisterDecoder(CurveRemoveLiquidity3Selector, "remove_liquidity(uint256,uint256[3])", curveRemoveLiquidity(3))
+	RegisterDecoder(CurveRemoveLiquidity4Selector, "remove_liquidity(uint256,uint256[4])", curveRemoveLiquidity(4))
+	RegisterDecoder(CurveRemoveOneCoinSelector, "remove_liquidity_one_coin(uint256,int128,uint256)", decodeCurveRemoveOneCoin)
+	RegisterDecoder(CurveRemoveOneCoinUintSelector, "remove_liquidity_one_coin(uint256,uint256,uint256)", decodeCurveRemoveOneCoin)
+	RegisterDecoder(CurveRemoveImbalance2Selector, "remove_liquidity_imbalance(uint256[2],uint256)", curveRemoveImbalance(2))
+	RegisterDecoder(CurveRemoveImbalance3Selector, "remove_liquidity_imbalance(uint256[3],uint256)", curveRemoveImbalance(3))
+	RegisterDecoder(CurveRemoveImbalance4Selector, "remove_liquidity_imbalance(uint256[4],uint256)", curveRemoveImbalance(4))
+	RegisterReceiptResolver(curveProtocol, ResolveCurveRemoval)
+}
+
+// curveCoin returns the asset of the i-th coin of a pool, resolved with
+// coins(i) and settled from the receipt
+func curveCoin(pool common.Address, i uint64) AssetAmount {
+	return AssetAmount{Token: pool, Curve: true, Coin: i}
+}
+
+// curveRemoveLiquidity returns the decoder of a proportional withdrawal from
+// an n-coin pool. Every coin is withdrawn; the calldata only carries minimums.
+func curveRemoveLiquidity(n int) ActionDecoder {
+	return func(logger *slog.Logger, target common.Address, calldata []byte) (*Action, error) {
+		burned, err := calldataUint(calldata, 0)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := calldataWord(calldata, n); err != nil {
+			return nil, err
+		}
+
+		logger.Info("Curve remove liquidity", "pool", target.Hex(), "coins", n, "lpAmount", burned.String())
+
+		action := &Action{Protocol: curveProtocol, Verb: VerbWithdraw}
+		for i := 0; i < n; i++ {
+			action.AssetsIn = append(action.AssetsIn, curveCoin(target, uint64(i)))
+		}
+		return action, nil
+	}
+}
+
+// decodeCurveRemoveOneCoin decodes a withdrawal of a single coin. The index
+// word decodes the same for int128 and uint256 pools.
+func decodeCurveRemoveOneCoin(logger *slog.Logger, target common.Address, calldata []byte) (*Action, error) {
+	burned, err := calldataUint(calldata, 0)
+	if err != nil {
+		return nil, err
+	}
+	index, err := calldataUint(calldata, 1)
+	if err != nil {
+		return nil, err
+	}
+	if !index.IsUint64() || index.Uint64() >= maxCurveCoins {
+		return nil, fmt.Errorf("invalid Curve coin index %s", index)
+	}
+
+	logger.Info("Curve remove liquidity one coin", "pool", target.Hex(), "coin", index.Uint64(), "lpAmount", burned.String())
+
+	return &Action{
+		Protocol: curveProtocol,
+		Verb:     VerbWithdraw,
+		AssetsIn: []AssetAmount{curveCoin(target, index.Uint64())},
+	}, nil
+}
+
+// curveRemoveImbalance returns the decoder of a withdrawal of chosen amounts
+// from an n-coin pool. Coins with a zero amount are not withdrawn.
+func curveRemoveImbalance(n int) ActionDecoder {
+	return func(logger *slog.Logger, target common.Address, calldata []byte) (*Action, error) {
+		maxBurn, err := calldataUint(calldata, n)
+		if err != nil {
+			return nil, err
+		}
+
+		action := &Action{Protocol: curveProtocol, Verb: VerbWithdraw}
+		for i := 0; i < n; i++ {
+			amount, err := calldataUint(calldata, i)
+			if err != nil {
+				return nil, err
+			}
+			if amount.Sign() > 0 {
+				action.AssetsIn = append(action.AssetsIn, curveCoin(target, uint64(i)))
+			}
+		}
+
+		logger.Info("Curve remove liquidity imbalance", "pool", target.Hex(), "coins", len(action.AssetsIn), "maxLpAmount", maxBurn.String())
+		return action, nil
+	}
+}
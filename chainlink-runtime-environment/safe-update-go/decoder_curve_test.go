@@ -0,0 +1,71 @@
+//go:build wasip1
+
+package main
+
+import (
+	"log/slog"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// curveTestPool is the 3pool
+var curveTestPool = common.HexToAddress("0xbEbc44782C7dB0a1A60Cb6fe97d0b483032FF1C7")
+
+func TestDecodeCurveExits(t *testing.T) {
+	tests := []struct {
+		name     string
+		calldata []byte
+		// coins are the indexes of the coins credited from the receipt
+		coins []uint64
+	}{
+		{"remove_liquidity 2 coins", wordCalldata(t, CurveRemoveLiquidity2Selector, 1000, 1, 1), []uint64{0, 1}},
+		{"remove_liquidity 3 coins", wordCalldata(t, CurveRemoveLiquidity3Selector, 1000, 1, 1, 1), []uint64{0, 1, 2}},
+		{"remove_liquidity 4 coins", wordCalldata(t, CurveRemoveLiquidity4Selector, 1000, 0, 0, 0, 0), []uint64{0, 1, 2, 3}},
+		{"remove_liquidity_one_coin int128", wordCalldata(t, CurveRemoveOneCoinSelector, 1000, 1, 0), []uint64{1}},
+		{"remove_liquidity_one_coin uint256", wordCalldata(t, CurveRemoveOneCoinUintSelector, 1000, 2, 0), []uint64{2}},
+		{"remove_liquidity_imbalance skips zero amounts", wordCalldata(t, CurveRemoveImbalance3Selector, 5, 0, 7, 1000), []uint64{0, 2}},
+		{"remove_liquidity_imbalance 2 coins", wordCalldata(t, CurveRemoveImbalance2Selector, 5, 6, 1000), []uint64{0, 1}},
+		{"remove_liquidity_imbalance 4 coins", wordCalldata(t, CurveRemoveImbalance4Selector, 0, 0, 0, 9, 1000), []uint64{3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action, err := DecodeAction(slog.New(slog.DiscardHandler), curveTestPool, tt.calldata)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if action.Protocol != curveProtocol || action.Verb != VerbWithdraw || action.Confidence != ConfidenceExactABI {
+				t.Errorf("decoded %s %s (%s)", action.Protocol, action.Verb, action.Confidence)
+			}
+			if len(action.AssetsIn) != len(tt.coins) || len(action.AssetsOut) != 0 {
+				t.Fatalf("assets in %+v, out %+v", action.AssetsIn, action.AssetsOut)
+			}
+			for i, coin := range tt.coins {
+				asset := action.AssetsIn[i]
+				if !asset.Curve || asset.Coin != coin || asset.Token != curveTestPool || asset.Amount != nil {
+					t.Errorf("asset %d: %+v, want coin %d of the pool", i, asset, coin)
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeCurveExitErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		calldata []byte
+	}{
+		{"coin index past the largest pool", wordCalldata(t, CurveRemoveOneCoinSelector, 1000, maxCurveCoins, 0)},
+		{"negative int128 index", wordCalldata(t, CurveRemoveOneCoinSelector, 1000, bigInt(t, maxUint256), 0)},
+		{"remove_liquidity without minimums", wordCalldata(t, CurveRemoveLiquidity3Selector, 1000, 1)},
+		{"remove_liquidity_imbalance without max burn", wordCalldata(t, CurveRemoveImbalance2Selector, 5, 6)},
+		{"remove_liquidity_one_coin without index", wordCalldata(t, CurveRemoveOneCoinSelector, 1000)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if action, err := DecodeAction(slog.New(slog.DiscardHandler), curveTestPool, tt.calldata); err == nil {
+				t.Errorf("decoded %+v", action)
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+//go:build wasip1
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// EigenLayer DelegationManager queueWithdrawals(QueuedWithdrawalParams[] params)
+const EigenLayerQueueWithdrawalsSelector = "0dd8dd02"
+
+// EigenLayer DelegationManager completeQueuedWithdrawal(Withdrawal withdrawal, address[] tokens, uint256 middlewareTimesIndex, bool receiveAsTokens),
+// before the slashing upgrade
+const EigenLayerCompleteQueuedWithdrawalSelector = "60d7faed"
+
+// EigenLayer DelegationManager completeQueuedWithdrawal(Withdrawal withdrawal, address[] tokens, bool receiveAsTokens)
+const EigenLayerCompleteQueuedWithdrawalV2Selector = "e4cc3f90"
+
+// eigenLayerProtocol is the protocol name of EigenLayer restaking actions
+const eigenLayerProtocol = "eigenlayer"
+
+// EigenLayer DelegationManager ABI (queueWithdrawals, completeQueuedWithdrawal)
+const eigenLayerDelegationABI = `[
+	{"name":"queueWithdrawals","type":"function","outputs":[{"name":"","type":"bytes32[]"}],"inputs":[
+		{"name":"params","type":"tuple[]","components":[
+			{"name":"strategies","type":"address[]"},
+			{"name":"shares","type":"uint256[]"},
+			{"name":"withdrawer","type":"address"}
+		]}
+	]},
+	{"name":"completeQueuedWithdrawal","type":"function","outputs":[],"inputs":[
+		{"name":"withdrawal","type":"tuple","components":[
+			{"name":"staker","type":"address"},
+			{"name":"delegatedTo","type":"address"},
+			{"name":"withdrawer","type":"address"},
+			{"name":"nonce","type":"uint256"},
+			{"name":"startBlock","type":"uint32"},
+			{"name":"strategies","type":"address[]"},
+			{"name":"shares","type":"uint256[]"}
+		]},
+		{"name":"tokens","type":"address[]"},
+		{"name":"middlewareTimesIndex","type":"uint256"},
+		{"name":"receiveAsTokens","type":"bool"}
+	]},
+	{"name":"completeQueuedWithdrawal","type":"function","outputs":[],"inputs":[
+		{"name":"withdrawal","type":"tuple","components":[
+			{"name":"staker","type":"address"},
+			{"name":"delegatedTo","type":"address"},
+			{"name":"withdrawer","type":"address"},
+			{"name":"nonce","type":"uint256"},
+			{"name":"startBlock","type":"uint32"},
+			{"name":"strategies","type":"address[]"},
+			{"name":"scaledShares","type":"uint256[]"}
+		]},
+		{"name":"tokens","type":"address[]"},
+		{"name":"receiveAsTokens","type":"bool"}
+	]}
+]`
+
+// eigenLayerQueuedWithdrawalParams represents a QueuedWithdrawalParams struct of queueWithdrawals
+type eigenLayerQueuedWithdrawalParams struct {
+	Strategies []common.Address
+	Shares     []*big.Int
+	Withdrawer common.Address
+}
+
+// eigenLayerWithdrawal represents the Withdrawal struct of completeQueuedWithdrawal.
+// Shares are scaled shares after the slashing upgrade.
+type eigenLayerWithdrawal struct {
+	Staker      common.Address
+	DelegatedTo common.Address
+	Withdrawer  common.Address
+	Nonce       *big.Int
+	StartBlock  uint32
+	Strategies  []common.Address
+	Shares      []*big.Int
+}
+
+// eigenLayerCompletion represents the arguments of completeQueuedWithdrawal
+type eigenLayerCompletion struct {
+	Withdrawal      eigenLayerWithdrawal
+	Tokens          []common.Address
+	ReceiveAsTokens bool
+}
+
+func init() {
+	RegisterDecoder(EigenLayerQueueWithdrawalsSelector, "queueWithdrawals((address[],uint256[],address)[])", decodeEigenLayerQueueWithdrawals)
+	RegisterDecoder(EigenLayerCompleteQueuedWithdrawalSelector, "completeQueuedWithdrawal((address,address,address,uint256,uint32,address[],uint256[]),address[],uint256,bool)", decodeEigenLayerCompleteQueuedWithdrawal)
+	RegisterDecoder(EigenLayerCompleteQueuedWithdrawalV2Selector, "completeQueuedWithdrawal((address,address,address,uint256,uint32,address[],uint256[]),address[],bool)", decodeEigenLayerCompleteQueuedWithdrawal)
+	RegisterReceiptResolver(eigenLayerProtocol, ResolveEigenLayerWithdrawal)
+}
+
+// unpackEigenLayerCall unpacks the arguments of a DelegationManager call
+func unpackEigenLayerCall(calldata []byte) ([]interface{}, error) {
+	parsedDelegationABI, err := abi.JSON(strings.NewReader(eigenLayerDelegationABI))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse EigenLayer DelegationManager ABI: %w", err)
+	}
+	method, err := parsedDelegationABI.MethodById(calldata[:4])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %x", ErrUnknownSelector, calldata[:4])
+	}
+	values, err := method.Inputs.Unpack(calldata[4:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to unpack %s: %w", method.Name, err)
+	}
+	return values, nil
+}
+
+// decodeEigenLayerCompletion unpacks a completeQueuedWithdrawal call of either version
+func decodeEigenLayerCompletion(calldata []byte) (*eigenLayerCompletion, error) {
+	values, err := unpackEigenLayerCall(calldata)
+	if err != nil {
+		return nil, err
+	}
+	withdrawal, ok := abi.ConvertType(values[0], new(eigenLayerWithdrawal)).(*eigenLayerWithdrawal)
+	if !ok {
+		return nil, fmt.Errorf("unexpected completeQueuedWithdrawal withdrawal")
+	}
+	tokens, ok := values[1].([]common.Address)
+	if !ok {
+		return nil, fmt.Errorf("unexpected completeQueuedWithdrawal tokens")
+	}
+	receiveAsTokens, ok := values[len(values)-1].(bool)
+	if !ok {
+		return nil, fmt.Errorf("unexpected completeQueuedWithdrawal receiveAsTokens")
+	}
+	if len(tokens) != len(withdrawal.Strategies) {
+		return nil, fmt.Errorf("completeQueuedWithdrawal has %d tokens for %d strategies", len(tokens), len(withdrawal.Strategies))
+	}
+	return &eigenLayerCompletion{Withdrawal: *withdrawal, Tokens: tokens, ReceiveAsTokens: receiveAsTokens}, nil
+}
+
+// decodeEigenLayerQueueWithdrawals decodes the queueing of restaked shares for
+// withdrawal. Strategy shares are not tokens of the Safe, so nothing is
+// credited until the withdrawal is completed.
+func decodeEigenLayerQueueWithdrawals(logger *slog.Logger, target common.Address, calldata []byte) (*Action, error) {
+	values, err := unpackEigenLayerCall(calldata)
+	if err != nil {
+		return nil, err
+	}
+	var params []eigenLayerQueuedWithdrawalParams
+	converted, ok := abi.ConvertType(values[0], &params).(*[]eigenLayerQueuedWithdrawalParams)
+	if !ok {
+		return nil, fmt.Errorf("unexpected queueWithdrawals params")
+	}
+
+	for _, queued := range *converted {
+		logger.Info("EigenLayer withdrawal queued", "strategies", len(queued.Strategies), "withdrawer", queued.Withdrawer.Hex())
+	}
+
+	return &Action{
+		Protocol: eigenLayerProtocol,
+		Verb:     VerbWithdraw,
+	}, nil
+}
+
+// decodeEigenLayerCompleteQueuedWithdrawal decodes the completion of a queued
+// withdrawal. Completed as tokens, each strategy's underlying token is
+// credited from the receipt; completed as shares, they are restaked and
+// nothing is credited.
+func decodeEigenLayerCompleteQueuedWithdrawal(logger *slog.Logger, target common.Address, calldata []byte) (*Action, error) {
+	completion, err := decodeEigenLayerCompletion(calldata)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("EigenLayer withdrawal completed", "staker", completion.Withdrawal.Staker.Hex(), "withdrawer", completion.Withdrawal.Withdrawer.Hex(),
+		"strategies", len(completion.Withdrawal.Strategies), "receiveAsTokens", completion.ReceiveAsTokens)
+
+	return &Action{
+		Protocol:  eigenLayerProtocol,
+		Verb:      VerbWithdraw,
+		Recipient: completion.Withdrawal.Withdrawer,
+	}, nil
+}
@@ -0,0 +1,87 @@
+//go:build wasip1
+
+package main
+
+import (
+	"log/slog"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// eigenLayerTestDelegation is the EigenLayer DelegationManager
+var eigenLayerTestDelegation = common.HexToAddress("0x39053D51B77DC0d36036Fc1fCc8Cb819df8Ef37A")
+
+func TestDecodeEigenLayer(t *testing.T) {
+	safe := common.HexToAddress("0x00000000000000000000000000000000000000cc")
+	strategy := common.HexToAddress("0x93c4b944D05dfe6df7645A86cd2206016c51564D")
+	stETH := common.HexToAddress("0xae7ab96520DE3A18E5e111B5EaAb095312D7fE84")
+	shares := []*big.Int{big.NewInt(1e18)}
+
+	withdrawal := eigenLayerWithdrawal{
+		Staker:      safe,
+		DelegatedTo: common.HexToAddress("0x00000000000000000000000000000000000000ee"),
+		Withdrawer:  safe,
+		Nonce:       big.NewInt(3),
+		StartBlock:  19_000_000,
+		Strategies:  []common.Address{strategy},
+		Shares:      shares,
+	}
+	// The Withdrawal struct of the slashing upgrade names its shares scaledShares
+	scaled := struct {
+		Staker       common.Address
+		DelegatedTo  common.Address
+		Withdrawer   common.Address
+		Nonce        *big.Int
+		StartBlock   uint32
+		Strategies   []common.Address
+		ScaledShares []*big.Int
+	}{withdrawal.Staker, withdrawal.DelegatedTo, withdrawal.Withdrawer, withdrawal.Nonce, withdrawal.StartBlock, withdrawal.Strategies, shares}
+	queued := []eigenLayerQueuedWithdrawalParams{{Strategies: []common.Address{strategy}, Shares: shares, Withdrawer: safe}}
+
+	tests := []struct {
+		name      string
+		calldata  []byte
+		recipient common.Address
+	}{
+		{"queueWithdrawals", abiCalldata(t, eigenLayerDelegationABI, EigenLayerQueueWithdrawalsSelector, queued), common.Address{}},
+		{"completeQueuedWithdrawal before slashing", abiCalldata(t, eigenLayerDelegationABI, EigenLayerCompleteQueuedWithdrawalSelector,
+			withdrawal, []common.Address{stETH}, big.NewInt(0), true), safe},
+		{"completeQueuedWithdrawal", abiCalldata(t, eigenLayerDelegationABI, EigenLayerCompleteQueuedWithdrawalV2Selector,
+			scaled, []common.Address{stETH}, true), safe},
+		{"completeQueuedWithdrawal as shares", abiCalldata(t, eigenLayerDelegationABI, EigenLayerCompleteQueuedWithdrawalV2Selector,
+			scaled, []common.Address{stETH}, false), safe},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action, err := DecodeAction(slog.New(slog.DiscardHandler), eigenLayerTestDelegation, tt.calldata)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if action.Protocol != eigenLayerProtocol || action.Verb != VerbWithdraw || action.Confidence != ConfidenceExactABI {
+				t.Errorf("decoded %s %s (%s)", action.Protocol, action.Verb, action.Confidence)
+			}
+			// Underlying tokens are credited from the receipt
+			if len(action.AssetsIn) != 0 || len(action.AssetsOut) != 0 {
+				t.Errorf("assets in %+v, out %+v", action.AssetsIn, action.AssetsOut)
+			}
+			if action.Recipient != tt.recipient {
+				t.Errorf("recipient %s, want %s", action.Recipient.Hex(), tt.recipient.Hex())
+			}
+		})
+	}
+
+	t.Run("fewer tokens than strategies", func(t *testing.T) {
+		calldata := abiCalldata(t, eigenLayerDelegationABI, EigenLayerCompleteQueuedWithdrawalV2Selector, scaled, []common.Address{}, true)
+		if _, err := DecodeAction(slog.New(slog.DiscardHandler), eigenLayerTestDelegation, calldata); err == nil {
+			t.Error("decoded")
+		}
+	})
+	t.Run("truncated", func(t *testing.T) {
+		calldata := abiCalldata(t, eigenLayerDelegationABI, EigenLayerQueueWithdrawalsSelector, queued)
+		if _, err := DecodeAction(slog.New(slog.DiscardHandler), eigenLayerTestDelegation, calldata[:4+64]); err == nil {
+			t.Error("decoded")
+		}
+	})
+}
@@ -0,0 +1,73 @@
+//go:build wasip1
+
+package main
+
+import (
+	"log/slog"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// ERC-4626 withdraw(uint256 assets, address receiver, address owner)
+const ERC4626WithdrawSelector = "b460af94"
+
+// ERC-4626 redeem(uint256 shares, address receiver, address owner)
+const ERC4626RedeemSelector = "ba087652"
+
+// erc4626Protocol is the protocol name of ERC-4626 vault actions, unless the
+// vault is configured with another one
+const erc4626Protocol = "erc4626"
+
+func init() {
+	RegisterDecoder(ERC4626WithdrawSelector, "withdraw(uint256,address,address)", decodeERC4626Withdraw)
+	RegisterDecoder(ERC4626RedeemSelector, "redeem(uint256,address,address)", decodeERC4626Redeem)
+}
+
+// decodeERC4626Withdraw decodes a withdrawal from any ERC-4626 vault (Morpho,
+// Yearn v3, sDAI, ...). The amount is in the vault's underlying asset,
+// resolved with asset() during accounting.
+func decodeERC4626Withdraw(logger *slog.Logger, target common.Address, calldata []byte) (*Action, error) {
+	logger.Info("Detected ERC-4626 withdraw function")
+
+	assets, err := calldataUint(calldata, 0)
+	if err != nil {
+		return nil, err
+	}
+	receiver, err := calldataAddress(calldata, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("ERC-4626 withdrawal", "assets", assets.String(), "vault", target.Hex())
+
+	return &Action{
+		Protocol:  erc4626Protocol,
+		Verb:      VerbWithdraw,
+		AssetsIn:  []AssetAmount{{Token: target, Amount: assets, Vault: true}},
+		Recipient: receiver,
+	}, nil
+}
+
+// decodeERC4626Redeem decodes a redemption from any ERC-4626 vault. The amount
+// is in vault shares, converted with convertToAssets() during accounting.
+func decodeERC4626Redeem(logger *slog.Logger, target common.Address, calldata []byte) (*Action, error) {
+	logger.Info("Detected ERC-4626 redeem function")
+
+	shares, err := calldataUint(calldata, 0)
+	if err != nil {
+		return nil, err
+	}
+	receiver, err := calldataAddress(calldata, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("ERC-4626 redemption", "shares", shares.String(), "vault", target.Hex())
+
+	return &Action{
+		Protocol:  erc4626Protocol,
+		Verb:      VerbWithdraw,
+		AssetsIn:  []AssetAmount{{Token: target, Amount: shares, Vault: true, Shares: true}},
+		Recipient: receiver,
+	}, nil
+}
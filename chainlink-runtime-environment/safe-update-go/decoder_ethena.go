@@ -0,0 +1,68 @@
+//go:build wasip1
+
+package main
+
+import (
+	"encoding/hex"
+	"log/slog"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Ethena sUSDe cooldownAssets(uint256 assets)
+const EthenaCooldownAssetsSelector = "cdac52ed"
+
+// Ethena sUSDe cooldownShares(uint256 shares)
+const EthenaCooldownSharesSelector = "9343d9e1"
+
+// Ethena sUSDe unstake(address receiver)
+const EthenaUnstakeSelector = "f2888dbb"
+
+// ethenaProtocol is the protocol name of Ethena staking actions. sUSDe is
+// also a plain ERC-4626 vault while its cooldown is off, decoded as ethena
+// when it is configured with it.
+const ethenaProtocol = "ethena"
+
+func init() {
+	RegisterDecoder(EthenaCooldownAssetsSelector, "cooldownAssets(uint256)", decodeEthenaCooldown)
+	RegisterDecoder(EthenaCooldownSharesSelector, "cooldownShares(uint256)", decodeEthenaCooldown)
+	RegisterDecoder(EthenaUnstakeSelector, "unstake(address)", decodeEthenaUnstake)
+	RegisterReceiptResolver(ethenaProtocol, ResolveEthenaUnstake)
+}
+
+// decodeEthenaCooldown decodes the start of an sUSDe cooldown, which burns
+// the sUSDe and locks its USDe in the silo until it is unstaked. It is
+// debited in USDe: cooldownShares amounts are converted with
+// convertToAssets() during accounting.
+func decodeEthenaCooldown(logger *slog.Logger, target common.Address, calldata []byte) (*Action, error) {
+	amount, err := calldataUint(calldata, 0)
+	if err != nil {
+		return nil, err
+	}
+	shares := hex.EncodeToString(calldata[:4]) == EthenaCooldownSharesSelector
+
+	logger.Info("Ethena cooldown", "sUSDe", target.Hex(), "amount", amount.String(), "shares", shares)
+
+	return &Action{
+		Protocol:  ethenaProtocol,
+		Verb:      VerbWithdraw,
+		AssetsOut: []AssetAmount{{Token: target, Amount: amount, Vault: true, Shares: shares}},
+	}, nil
+}
+
+// decodeEthenaUnstake decodes the claim of USDe whose cooldown is over. The
+// amount is settled from the receipt.
+func decodeEthenaUnstake(logger *slog.Logger, target common.Address, calldata []byte) (*Action, error) {
+	receiver, err := calldataAddress(calldata, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("Ethena unstake", "sUSDe", target.Hex(), "receiver", receiver.Hex())
+
+	return &Action{
+		Protocol:  ethenaProtocol,
+		Verb:      VerbWithdraw,
+		Recipient: receiver,
+	}, nil
+}
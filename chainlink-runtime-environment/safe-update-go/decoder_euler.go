@@ -0,0 +1,157 @@
+//go:build wasip1
+
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Euler v2 EthereumVaultConnector batch((address targetContract, address onBehalfOfAccount, uint256 value, bytes data)[] items)
+const EulerEVCBatchSelector = "c16ae7a4"
+
+// Euler v2 EthereumVaultConnector call(address targetContract, address onBehalfOfAccount, uint256 value, bytes data)
+const EulerEVCCallSelector = "1f8b5215"
+
+// EVault deposit(uint256 assets, address receiver), inside an EVC batch
+const eulerDepositSelector = "6e553f65"
+
+// EVault mint(uint256 shares, address receiver), inside an EVC batch
+const eulerMintSelector = "94bf804d"
+
+// EVault repay(uint256 amount, address receiver), inside an EVC batch
+const eulerRepaySelector = "acb70815"
+
+// eulerProtocol is the protocol name of Euler v2 vault actions
+const eulerProtocol = "euler"
+
+// eulerReceiversReviewReason explains why EVC batches paying several receivers are held for review
+const eulerReceiversReviewReason = "Euler EVC batch withdraws to several receivers"
+
+// eulerCallsReviewReason explains why EVC batches making other vault calls are held for review
+const eulerCallsReviewReason = "Euler EVC batch makes vault calls other than deposits, repays and withdrawals, which may borrow"
+
+// Euler v2 EthereumVaultConnector ABI (batch, call)
+const eulerEVCABI = `[
+	{"name":"batch","type":"function","outputs":[],"inputs":[
+		{"name":"items","type":"tuple[]","components":[
+			{"name":"targetContract","type":"address"},
+			{"name":"onBehalfOfAccount","type":"address"},
+			{"name":"value","type":"uint256"},
+			{"name":"data","type":"bytes"}
+		]}
+	]},
+	{"name":"call","type":"function","outputs":[{"name":"result","type":"bytes"}],"inputs":[
+		{"name":"targetContract","type":"address"},
+		{"name":"onBehalfOfAccount","type":"address"},
+		{"name":"value","type":"uint256"},
+		{"name":"data","type":"bytes"}
+	]}
+]`
+
+// eulerBatchItem represents a call the EVC makes to a vault
+type eulerBatchItem struct {
+	TargetContract    common.Address
+	OnBehalfOfAccount common.Address
+	Value             *big.Int
+	Data              []byte
+}
+
+func init() {
+	RegisterDecoder(EulerEVCBatchSelector, "batch((address,address,uint256,bytes)[])", decodeEulerEVC)
+	RegisterDecoder(EulerEVCCallSelector, "call(address,address,uint256,bytes)", decodeEulerEVC)
+}
+
+// unpackEulerEVC returns the vault calls of an EVC batch or call
+func unpackEulerEVC(calldata []byte) ([]eulerBatchItem, error) {
+	parsedEVCABI, err := abi.JSON(strings.NewReader(eulerEVCABI))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse Euler EVC ABI: %w", err)
+	}
+	method, err := parsedEVCABI.MethodById(calldata[:4])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %x", ErrUnknownSelector, calldata[:4])
+	}
+	values, err := method.Inputs.Unpack(calldata[4:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to unpack %s: %w", method.Name, err)
+	}
+
+	if method.Name == "call" {
+		var item eulerBatchItem
+		if err := method.Inputs.Copy(&item, values); err != nil {
+			return nil, fmt.Errorf("unexpected EVC call arguments: %w", err)
+		}
+		return []eulerBatchItem{item}, nil
+	}
+
+	var items []eulerBatchItem
+	converted, ok := abi.ConvertType(values[0], &items).(*[]eulerBatchItem)
+	if !ok {
+		return nil, fmt.Errorf("unexpected EVC batch items")
+	}
+	return *converted, nil
+}
+
+// decodeEulerEVC decodes an Euler v2 EthereumVaultConnector batch or call
+// withdrawing from EVaults. A batch can deposit and withdraw at once, so the
+// assets are settled from the Safe's net transfers in the receipt, and the
+// ERC-4626 withdraw and redeem calls only give the receivers. Calls to the
+// connector itself, such as enabling collateral, move nothing; vault calls
+// other than deposits, repays and withdrawals may borrow and are held for
+// review.
+func decodeEulerEVC(logger *slog.Logger, target common.Address, calldata []byte) (*Action, error) {
+	items, err := unpackEulerEVC(calldata)
+	if err != nil {
+		return nil, err
+	}
+
+	action := &Action{Protocol: eulerProtocol, Verb: VerbWithdraw}
+	withdrawals := 0
+	for _, item := range items {
+		if item.TargetContract == target {
+			continue
+		}
+		selector := ""
+		if len(item.Data) >= 4 {
+			selector = hex.EncodeToString(item.Data[:4])
+		}
+		var withdrawal *Action
+		switch selector {
+		case ERC4626WithdrawSelector:
+			withdrawal, err = decodeERC4626Withdraw(logger, item.TargetContract, item.Data)
+		case ERC4626RedeemSelector:
+			withdrawal, err = decodeERC4626Redeem(logger, item.TargetContract, item.Data)
+		case eulerDepositSelector, eulerMintSelector, eulerRepaySelector:
+			continue
+		default:
+			if !action.NeedsReview {
+				action.NeedsReview, action.ReviewReason = true, eulerCallsReviewReason
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		withdrawals++
+		switch {
+		case action.Recipient == (common.Address{}):
+			action.Recipient = withdrawal.Recipient
+		case action.Recipient != withdrawal.Recipient:
+			action.NeedsReview, action.ReviewReason = true, eulerReceiversReviewReason
+		}
+	}
+	if withdrawals == 0 {
+		return nil, fmt.Errorf("%w: EVC batch of %d calls without withdraw or redeem", ErrUnknownSelector, len(items))
+	}
+
+	logger.Info("Euler EVC batch", "calls", len(items), "withdrawals", withdrawals)
+	return action, nil
+}
@@ -0,0 +1,9 @@
+//go:build wasip1
+
+package main
+
+// fraxProtocol is the protocol name of the sfrxETH vaults configured with it.
+// sfrxETH is an ERC-4626 vault of frxETH, so its redeem and withdraw go
+// through the ERC-4626 decoders and are converted to frxETH with asset() and
+// convertToAssets().
+const fraxProtocol = "frax"
@@ -0,0 +1,171 @@
+//go:build wasip1
+
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Gearbox v3 CreditFacade multicall(address creditAccount, (address target, bytes callData)[] calls)
+const GearboxMulticallSelector = "ebe4107c"
+
+// Gearbox v3 CreditFacade closeCreditAccount(address creditAccount, (address target, bytes callData)[] calls)
+const GearboxCloseCreditAccountSelector = "36b2ced3"
+
+// Gearbox v3 CreditFacade withdrawCollateral(address token, uint256 amount, address to), inside a multicall
+const gearboxWithdrawCollateralSelector = "1f1088a0"
+
+// Gearbox v3 CreditFacade decreaseDebt(uint256 amount), inside a multicall
+const gearboxDecreaseDebtSelector = "2a7ba1f7"
+
+// Gearbox v3 CreditFacade increaseDebt(uint256 amount), inside a multicall
+const gearboxIncreaseDebtSelector = "2b7c7b11"
+
+// gearboxProtocol is the protocol name of Gearbox credit account actions
+const gearboxProtocol = "gearbox"
+
+// gearboxReceiversReviewReason explains why multicalls paying several receivers are held for review
+const gearboxReceiversReviewReason = "Gearbox multicall withdraws collateral to several receivers"
+
+// gearboxDebtReviewReason explains why multicalls borrowing are held for review
+const gearboxDebtReviewReason = "Gearbox multicall increases debt, which may be withdrawn as collateral"
+
+// Gearbox v3 CreditFacade ABI (multicall, closeCreditAccount, withdrawCollateral)
+const gearboxCreditFacadeABI = `[
+	{"name":"multicall","type":"function","outputs":[],"inputs":[
+		{"name":"creditAccount","type":"address"},
+		{"name":"calls","type":"tuple[]","components":[
+			{"name":"target","type":"address"},
+			{"name":"callData","type":"bytes"}
+		]}
+	]},
+	{"name":"closeCreditAccount","type":"function","outputs":[],"inputs":[
+		{"name":"creditAccount","type":"address"},
+		{"name":"calls","type":"tuple[]","components":[
+			{"name":"target","type":"address"},
+			{"name":"callData","type":"bytes"}
+		]}
+	]},
+	{"name":"withdrawCollateral","type":"function","outputs":[],"inputs":[
+		{"name":"token","type":"address"},
+		{"name":"amount","type":"uint256"},
+		{"name":"to","type":"address"}
+	]}
+]`
+
+// gearboxCall represents a call of a CreditFacade multicall
+type gearboxCall struct {
+	Target   common.Address
+	CallData []byte
+}
+
+// gearboxWithdrawal represents the collateral a multicall withdraws from the credit account
+type gearboxWithdrawal struct {
+	Token common.Address
+	To    common.Address
+}
+
+// gearboxMulticall represents a decoded multicall or closeCreditAccount
+type gearboxMulticall struct {
+	CreditAccount common.Address
+	Withdrawals   []gearboxWithdrawal
+	DecreasesDebt bool
+	IncreasesDebt bool
+}
+
+func init() {
+	RegisterDecoder(GearboxMulticallSelector, "multicall(address,(address,bytes)[])", decodeGearboxMulticall)
+	RegisterDecoder(GearboxCloseCreditAccountSelector, "closeCreditAccount(address,(address,bytes)[])", decodeGearboxMulticall)
+}
+
+// unpackGearboxMulticall returns the credit account of a multicall or
+// closeCreditAccount and the calls it makes to the facade. Calls to adapters
+// move tokens within the credit account and are skipped.
+func unpackGearboxMulticall(facade common.Address, calldata []byte) (*gearboxMulticall, error) {
+	parsedFacadeABI, err := abi.JSON(strings.NewReader(gearboxCreditFacadeABI))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse Gearbox CreditFacade ABI: %w", err)
+	}
+	method, err := parsedFacadeABI.MethodById(calldata[:4])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %x", ErrUnknownSelector, calldata[:4])
+	}
+	values, err := method.Inputs.Unpack(calldata[4:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to unpack %s: %w", method.Name, err)
+	}
+	creditAccount, ok := values[0].(common.Address)
+	if !ok {
+		return nil, fmt.Errorf("unexpected %s credit account", method.Name)
+	}
+	var calls []gearboxCall
+	converted, ok := abi.ConvertType(values[1], &calls).(*[]gearboxCall)
+	if !ok {
+		return nil, fmt.Errorf("unexpected %s calls", method.Name)
+	}
+
+	multicall := &gearboxMulticall{CreditAccount: creditAccount}
+	for _, call := range *converted {
+		if call.Target != facade || len(call.CallData) < 4 {
+			continue
+		}
+		switch hex.EncodeToString(call.CallData[:4]) {
+		case gearboxWithdrawCollateralSelector:
+			args, err := parsedFacadeABI.Methods["withdrawCollateral"].Inputs.Unpack(call.CallData[4:])
+			if err != nil {
+				return nil, fmt.Errorf("failed to unpack withdrawCollateral: %w", err)
+			}
+			token, tokenOK := args[0].(common.Address)
+			to, toOK := args[2].(common.Address)
+			if !tokenOK || !toOK {
+				return nil, fmt.Errorf("unexpected withdrawCollateral arguments")
+			}
+			multicall.Withdrawals = append(multicall.Withdrawals, gearboxWithdrawal{Token: token, To: to})
+		case gearboxDecreaseDebtSelector:
+			multicall.DecreasesDebt = true
+		case gearboxIncreaseDebtSelector:
+			multicall.IncreasesDebt = true
+		}
+	}
+	return multicall, nil
+}
+
+// decodeGearboxMulticall decodes a CreditFacade multicall or
+// closeCreditAccount that unwinds a leveraged position. A multicall can add
+// collateral and withdraw it at once, and the calldata can ask for the whole
+// balance, so the assets are settled from the Safe's net transfers in the
+// receipt. Decreasing debt repays the pool from the credit account and moves
+// nothing; increasing it borrows funds a withdrawal could pay out, so it is
+// held for review.
+func decodeGearboxMulticall(logger *slog.Logger, target common.Address, calldata []byte) (*Action, error) {
+	multicall, err := unpackGearboxMulticall(target, calldata)
+	if err != nil {
+		return nil, err
+	}
+	if len(multicall.Withdrawals) == 0 && !multicall.DecreasesDebt && hex.EncodeToString(calldata[:4]) != GearboxCloseCreditAccountSelector {
+		return nil, fmt.Errorf("%w: Gearbox multicall without withdrawCollateral or decreaseDebt", ErrUnknownSelector)
+	}
+
+	action := &Action{Protocol: gearboxProtocol, Verb: VerbWithdraw}
+	if multicall.IncreasesDebt {
+		action.NeedsReview, action.ReviewReason = true, gearboxDebtReviewReason
+	}
+	for _, withdrawal := range multicall.Withdrawals {
+		switch {
+		case action.Recipient == (common.Address{}):
+			action.Recipient = withdrawal.To
+		case action.Recipient != withdrawal.To && !action.NeedsReview:
+			action.NeedsReview, action.ReviewReason = true, gearboxReceiversReviewReason
+		}
+	}
+
+	logger.Info("Detected Gearbox credit account unwind", "creditAccount", multicall.CreditAccount.Hex(),
+		"withdrawals", len(multicall.Withdrawals), "decreasesDebt", multicall.DecreasesDebt, "increasesDebt", multicall.IncreasesDebt)
+	return action, nil
+}
@@ -0,0 +1,159 @@
+//go:build wasip1
+
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// GMX GlpManager removeLiquidity(address _tokenOut, uint256 _glpAmount, uint256 _minOut, address _receiver)
+const GMXRemoveLiquiditySelector = "8fed0b2c"
+
+// GMX RewardRouter unstakeAndRedeemGlp(address _tokenOut, uint256 _glpAmount, uint256 _minOut, address _receiver)
+const GMXUnstakeAndRedeemGlpSelector = "0f3aa554"
+
+// GMX RewardRouter unstakeAndRedeemGlpETH(uint256 _glpAmount, uint256 _minOut, address _receiver)
+const GMXUnstakeAndRedeemGlpETHSelector = "abb5e5e2"
+
+// GMX v2 ExchangeRouter createWithdrawal(CreateWithdrawalParams params)
+const GMXCreateWithdrawalSelector = "ad23c5a1"
+
+// gmxProtocol is the protocol name of GMX GLP and GM redemptions
+const gmxProtocol = "gmx"
+
+// GMX v2 ExchangeRouter ABI (createWithdrawal)
+const gmxExchangeRouterABI = `[
+	{"name":"createWithdrawal","type":"function","outputs":[{"name":"","type":"bytes32"}],"inputs":[
+		{"name":"params","type":"tuple","components":[
+			{"name":"receiver","type":"address"},
+			{"name":"callbackContract","type":"address"},
+			{"name":"uiFeeReceiver","type":"address"},
+			{"name":"market","type":"address"},
+			{"name":"longTokenSwapPath","type":"address[]"},
+			{"name":"shortTokenSwapPath","type":"address[]"},
+			{"name":"minLongTokenAmount","type":"uint256"},
+			{"name":"minShortTokenAmount","type":"uint256"},
+			{"name":"shouldUnwrapNativeToken","type":"bool"},
+			{"name":"executionFee","type":"uint256"},
+			{"name":"callbackGasLimit","type":"uint256"}
+		]}
+	]}
+]`
+
+// gmxWithdrawalParams represents the CreateWithdrawalParams struct of createWithdrawal
+type gmxWithdrawalParams struct {
+	Receiver                common.Address
+	CallbackContract        common.Address
+	UiFeeReceiver           common.Address
+	Market                  common.Address
+	LongTokenSwapPath       []common.Address
+	ShortTokenSwapPath      []common.Address
+	MinLongTokenAmount      *big.Int
+	MinShortTokenAmount     *big.Int
+	ShouldUnwrapNativeToken bool
+	ExecutionFee            *big.Int
+	CallbackGasLimit        *big.Int
+}
+
+func init() {
+	RegisterDecoder(GMXRemoveLiquiditySelector, "removeLiquidity(address,uint256,uint256,address)", decodeGMXRedeemGlp)
+	RegisterDecoder(GMXUnstakeAndRedeemGlpSelector, "unstakeAndRedeemGlp(address,uint256,uint256,address)", decodeGMXRedeemGlp)
+	RegisterDecoder(GMXUnstakeAndRedeemGlpETHSelector, "unstakeAndRedeemGlpETH(uint256,uint256,address)", decodeGMXRedeemGlp)
+	RegisterDecoder(GMXCreateWithdrawalSelector, "createWithdrawal((address,address,address,address,address[],address[],uint256,uint256,bool,uint256,uint256))", decodeGMXCreateWithdrawal)
+	RegisterReceiptResolver(gmxProtocol, ResolveGMXWithdrawal)
+}
+
+// decodeGMXRedeemGlp decodes a GLP redemption. The calldata only carries a
+// minimum, so the token paid out and its amount come from the GlpManager's
+// RemoveLiquidity event.
+func decodeGMXRedeemGlp(logger *slog.Logger, target common.Address, calldata []byte) (*Action, error) {
+	glpIndex, receiverIndex := 1, 3
+	if hex.EncodeToString(calldata[:4]) == GMXUnstakeAndRedeemGlpETHSelector {
+		glpIndex, receiverIndex = 0, 2
+	}
+
+	glpAmount, err := calldataUint(calldata, glpIndex)
+	if err != nil {
+		return nil, err
+	}
+	receiver, err := calldataAddress(calldata, receiverIndex)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("GMX GLP redemption", "glpAmount", glpAmount.String(), "receiver", receiver.Hex())
+
+	return &Action{
+		Protocol:  gmxProtocol,
+		Verb:      VerbWithdraw,
+		Recipient: receiver,
+	}, nil
+}
+
+// decodeGMXWithdrawalParams unpacks the params of a createWithdrawal call
+func decodeGMXWithdrawalParams(call []byte) (*gmxWithdrawalParams, error) {
+	if len(call) < 4 {
+		return nil, fmt.Errorf("no createWithdrawal call")
+	}
+	parsedRouterABI, err := abi.JSON(strings.NewReader(gmxExchangeRouterABI))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse GMX ExchangeRouter ABI: %w", err)
+	}
+
+	values, err := parsedRouterABI.Methods["createWithdrawal"].Inputs.Unpack(call[4:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to unpack createWithdrawal: %w", err)
+	}
+	params, ok := abi.ConvertType(values[0], new(gmxWithdrawalParams)).(*gmxWithdrawalParams)
+	if !ok {
+		return nil, fmt.Errorf("unexpected createWithdrawal params")
+	}
+	return params, nil
+}
+
+// gmxWithdrawalCall returns the createWithdrawal call of an ExchangeRouter
+// multicall, or nil
+func gmxWithdrawalCall(calls [][]byte) []byte {
+	for _, call := range calls {
+		if len(call) >= 4 && hex.EncodeToString(call[:4]) == GMXCreateWithdrawalSelector {
+			return call
+		}
+	}
+	return nil
+}
+
+// decodeGMXWithdrawalOrder decodes a GMX v2 withdrawal order, created alone or
+// in an ExchangeRouter multicall that sends the GM tokens to the withdrawal
+// vault first. A keeper pays the market's tokens out in a later transaction,
+// so the order credits nothing until its execution is seen.
+func decodeGMXWithdrawalOrder(logger *slog.Logger, target common.Address, calls [][]byte) (*Action, error) {
+	call := gmxWithdrawalCall(calls)
+	if call == nil {
+		return nil, fmt.Errorf("%w: no createWithdrawal call", ErrUnknownSelector)
+	}
+	params, err := decodeGMXWithdrawalParams(call)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("GMX v2 withdrawal order", "market", params.Market.Hex(), "receiver", params.Receiver.Hex(),
+		"minLongTokenAmount", params.MinLongTokenAmount.String(), "minShortTokenAmount", params.MinShortTokenAmount.String())
+
+	return &Action{
+		Protocol:  gmxProtocol,
+		Verb:      VerbWithdraw,
+		Recipient: params.Receiver,
+	}, nil
+}
+
+// decodeGMXCreateWithdrawal decodes a withdrawal order created outside a multicall
+func decodeGMXCreateWithdrawal(logger *slog.Logger, target common.Address, calldata []byte) (*Action, error) {
+	return decodeGMXWithdrawalOrder(logger, target, [][]byte{calldata})
+}
@@ -0,0 +1,77 @@
+//go:build wasip1
+
+package main
+
+import (
+	"log/slog"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+var (
+	// gmxTestRewardRouter is the GMX GLP RewardRouter on Arbitrum
+	gmxTestRewardRouter = common.HexToAddress("0xB95DB5B167D75e6d04227CfFFA61069348d271F5")
+	// gmxTestExchangeRouter is the GMX v2 ExchangeRouter on Arbitrum
+	gmxTestExchangeRouter = common.HexToAddress("0x7C68C7866A64FA2160F78EEaE12217FFbf871fa8")
+)
+
+func TestDecodeGMX(t *testing.T) {
+	safe := common.HexToAddress("0x00000000000000000000000000000000000000cc")
+	usdc := common.HexToAddress("0xaf88d065e77c8cC2239327C5EDb3A432268e5831")
+	glpAmount := bigInt(t, "1000"+e(18))
+
+	params := gmxWithdrawalParams{
+		Receiver:            safe,
+		Market:              common.HexToAddress("0x70d95587d40A2caf56bd97485aB3Eec10Bee6336"),
+		LongTokenSwapPath:   []common.Address{},
+		ShortTokenSwapPath:  []common.Address{},
+		MinLongTokenAmount:  big.NewInt(1),
+		MinShortTokenAmount: big.NewInt(1),
+		ExecutionFee:        big.NewInt(1e15),
+		CallbackGasLimit:    big.NewInt(0),
+	}
+	createWithdrawal := abiCalldata(t, gmxExchangeRouterABI, GMXCreateWithdrawalSelector, params)
+	sendTokens := wordCalldata(t, "e6d66ac8", params.Market, common.HexToAddress("0x0628D46b5D145f183AdB6Ef1f2c97eD1C4701C55"), glpAmount)
+
+	tests := []struct {
+		name     string
+		target   common.Address
+		calldata []byte
+	}{
+		{"removeLiquidity", gmxTestRewardRouter, wordCalldata(t, GMXRemoveLiquiditySelector, usdc, glpAmount, 1, safe)},
+		{"unstakeAndRedeemGlp", gmxTestRewardRouter, wordCalldata(t, GMXUnstakeAndRedeemGlpSelector, usdc, glpAmount, 1, safe)},
+		{"unstakeAndRedeemGlpETH", gmxTestRewardRouter, wordCalldata(t, GMXUnstakeAndRedeemGlpETHSelector, glpAmount, 1, safe)},
+		{"createWithdrawal", gmxTestExchangeRouter, createWithdrawal},
+		{"multicall sending GM tokens then creating the withdrawal", gmxTestExchangeRouter, multicallCalldata(t, sendTokens, createWithdrawal)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action, err := DecodeAction(slog.New(slog.DiscardHandler), tt.target, tt.calldata)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if action.Protocol != gmxProtocol || action.Verb != VerbWithdraw || action.Confidence != ConfidenceExactABI {
+				t.Errorf("decoded %s %s (%s)", action.Protocol, action.Verb, action.Confidence)
+			}
+			// The token paid out comes from the receipt or the keeper's execution
+			if len(action.AssetsIn) != 0 || len(action.AssetsOut) != 0 {
+				t.Errorf("assets in %+v, out %+v", action.AssetsIn, action.AssetsOut)
+			}
+			if action.Recipient != safe {
+				t.Errorf("recipient %s", action.Recipient.Hex())
+			}
+		})
+	}
+
+	for name, calldata := range map[string][]byte{
+		"removeLiquidity without receiver":        wordCalldata(t, GMXRemoveLiquiditySelector, usdc, glpAmount, 1),
+		"unstakeAndRedeemGlpETH without receiver": wordCalldata(t, GMXUnstakeAndRedeemGlpETHSelector, glpAmount, 1),
+		"truncated createWithdrawal":              createWithdrawal[:4+64],
+	} {
+		if _, err := DecodeAction(slog.New(slog.DiscardHandler), gmxTestExchangeRouter, calldata); err == nil {
+			t.Errorf("%s: decoded", name)
+		}
+	}
+}
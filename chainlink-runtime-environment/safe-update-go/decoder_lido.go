@@ -0,0 +1,132 @@
+//go:build wasip1
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Lido wstETH unwrap(uint256 _wstETHAmount)
+const LidoUnwrapSelector = "de0e9a3e"
+
+// Lido WithdrawalQueue requestWithdrawals(uint256[] _amounts, address _owner)
+const LidoRequestWithdrawalsSelector = "d6681042"
+
+// Lido WithdrawalQueue requestWithdrawalsWstETH(uint256[] _amounts, address _owner)
+const LidoRequestWithdrawalsWstETHSelector = "19aa6257"
+
+// Lido WithdrawalQueue claimWithdrawal(uint256 _requestId)
+const LidoClaimWithdrawalSelector = "f8444436"
+
+// Lido WithdrawalQueue claimWithdrawals(uint256[] _requestIds, uint256[] _hints)
+const LidoClaimWithdrawalsSelector = "e3afe0a3"
+
+// lidoProtocol is the protocol name of wstETH and WithdrawalQueue actions
+const lidoProtocol = "lido"
+
+func init() {
+	RegisterDecoder(LidoUnwrapSelector, "unwrap(uint256)", decodeLidoUnwrap)
+	RegisterDecoder(LidoRequestWithdrawalsSelector, "requestWithdrawals(uint256[],address)", decodeLidoRequestWithdrawals)
+	RegisterDecoder(LidoRequestWithdrawalsWstETHSelector, "requestWithdrawalsWstETH(uint256[],address)", decodeLidoRequestWithdrawals)
+	RegisterDecoder(LidoClaimWithdrawalSelector, "claimWithdrawal(uint256)", decodeLidoClaimWithdrawal)
+	RegisterDecoder(LidoClaimWithdrawalsSelector, "claimWithdrawals(uint256[],uint256[])", decodeLidoClaimWithdrawal)
+	RegisterReceiptResolver(lidoProtocol, ResolveLidoWithdrawal)
+}
+
+// lidoUintArrays unpacks the leading uint256[] arguments of a call, followed
+// by an address when withOwner is set
+func lidoUintArrays(calldata []byte, arrays int, withOwner bool) ([][]*big.Int, error) {
+	uints, err := abi.NewType("uint256[]", "", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build uint256[] type: %w", err)
+	}
+	var args abi.Arguments
+	for i := 0; i < arrays; i++ {
+		args = append(args, abi.Argument{Type: uints})
+	}
+	if withOwner {
+		address, err := abi.NewType("address", "", nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build address type: %w", err)
+		}
+		args = append(args, abi.Argument{Type: address})
+	}
+
+	values, err := args.Unpack(calldata[4:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to unpack Lido call: %w", err)
+	}
+	result := make([][]*big.Int, arrays)
+	for i := range result {
+		array, ok := values[i].([]*big.Int)
+		if !ok {
+			return nil, fmt.Errorf("unexpected Lido call arguments")
+		}
+		result[i] = array
+	}
+	return result, nil
+}
+
+// decodeLidoUnwrap decodes the unwrapping of wstETH into stETH. The stETH
+// received is settled from the receipt, since it depends on the share rate.
+func decodeLidoUnwrap(logger *slog.Logger, target common.Address, calldata []byte) (*Action, error) {
+	amount, err := calldataUint(calldata, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("Lido wstETH unwrap", "wstETH", target.Hex(), "amount", amount.String())
+
+	return &Action{
+		Protocol:  lidoProtocol,
+		Verb:      VerbWithdraw,
+		AssetsOut: []AssetAmount{{Token: target, Amount: amount}},
+	}, nil
+}
+
+// decodeLidoRequestWithdrawals decodes a request to withdraw stETH or wstETH
+// through the WithdrawalQueue. The token locked in the queue is settled from
+// the receipt.
+func decodeLidoRequestWithdrawals(logger *slog.Logger, target common.Address, calldata []byte) (*Action, error) {
+	values, err := lidoUintArrays(calldata, 1, true)
+	if err != nil {
+		return nil, err
+	}
+	owner, err := calldataAddress(calldata, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(values[0]) == 0 {
+		return nil, fmt.Errorf("Lido withdrawal request without amounts")
+	}
+
+	var assets []AssetAmount
+	for _, amount := range values[0] {
+		assets = append(assets, AssetAmount{Amount: amount})
+	}
+
+	logger.Info("Lido withdrawal request", "queue", target.Hex(), "requests", len(assets), "owner", owner.Hex())
+
+	return &Action{
+		Protocol:  lidoProtocol,
+		Verb:      VerbWithdraw,
+		AssetsOut: assets,
+		Recipient: owner,
+	}, nil
+}
+
+// decodeLidoClaimWithdrawal decodes the claim of finalized WithdrawalQueue
+// requests. The ETH claimed is settled from the receipt.
+func decodeLidoClaimWithdrawal(logger *slog.Logger, target common.Address, calldata []byte) (*Action, error) {
+	logger.Info("Lido withdrawal claim", "queue", target.Hex())
+
+	return &Action{
+		Protocol: lidoProtocol,
+		Verb:     VerbWithdraw,
+	}, nil
+}
@@ -0,0 +1,105 @@
+//go:build wasip1
+
+package main
+
+import (
+	"encoding/hex"
+	"log/slog"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+var (
+	// lidoTestWstETH is wstETH
+	lidoTestWstETH = common.HexToAddress("0x7f39C581F595B53c5cb19bD0b3f8dA6c935E2Ca0")
+	// lidoTestQueue is the Lido WithdrawalQueue
+	lidoTestQueue = common.HexToAddress("0x889edC2eDab5f40e902b864aD4d7AdE8E412F9B1")
+)
+
+// lidoCalldata packs a WithdrawalQueue call of uint256[] arguments, followed
+// by an address when owner is set
+func lidoCalldata(t *testing.T, selector string, owner *common.Address, arrays ...[]*big.Int) []byte {
+	t.Helper()
+	uints, err := abi.NewType("uint256[]", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var args abi.Arguments
+	var values []interface{}
+	for _, array := range arrays {
+		args = append(args, abi.Argument{Type: uints})
+		values = append(values, array)
+	}
+	if owner != nil {
+		address, err := abi.NewType("address", "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		args = append(args, abi.Argument{Type: address})
+		values = append(values, *owner)
+	}
+	data, err := args.Pack(values...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := hex.DecodeString(selector)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append(id, data...)
+}
+
+func TestDecodeLido(t *testing.T) {
+	safe := common.HexToAddress("0x00000000000000000000000000000000000000cc")
+	amounts := []*big.Int{big.NewInt(1e18), big.NewInt(2e18)}
+
+	tests := []struct {
+		name      string
+		target    common.Address
+		calldata  []byte
+		out       []AssetAmount
+		recipient common.Address
+	}{
+		{"unwrap", lidoTestWstETH, wordCalldata(t, LidoUnwrapSelector, big.NewInt(3e18)), []AssetAmount{{Token: lidoTestWstETH, Amount: big.NewInt(3e18)}}, common.Address{}},
+		{"requestWithdrawals", lidoTestQueue, lidoCalldata(t, LidoRequestWithdrawalsSelector, &safe, amounts), []AssetAmount{{Amount: amounts[0]}, {Amount: amounts[1]}}, safe},
+		{"requestWithdrawalsWstETH", lidoTestQueue, lidoCalldata(t, LidoRequestWithdrawalsWstETHSelector, &safe, amounts[:1]), []AssetAmount{{Amount: amounts[0]}}, safe},
+		{"claimWithdrawal", lidoTestQueue, wordCalldata(t, LidoClaimWithdrawalSelector, 7), nil, common.Address{}},
+		{"claimWithdrawals", lidoTestQueue, lidoCalldata(t, LidoClaimWithdrawalsSelector, nil, []*big.Int{big.NewInt(7), big.NewInt(8)}, []*big.Int{big.NewInt(1), big.NewInt(1)}), nil, common.Address{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action, err := DecodeAction(slog.New(slog.DiscardHandler), tt.target, tt.calldata)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if action.Protocol != lidoProtocol || action.Verb != VerbWithdraw || action.Confidence != ConfidenceExactABI {
+				t.Errorf("decoded %s %s (%s)", action.Protocol, action.Verb, action.Confidence)
+			}
+			// What is received is settled from the receipt
+			if len(action.AssetsIn) != 0 || len(action.AssetsOut) != len(tt.out) {
+				t.Fatalf("assets in %+v, out %+v", action.AssetsIn, action.AssetsOut)
+			}
+			for i, want := range tt.out {
+				if got := action.AssetsOut[i]; got.Token != want.Token || got.Amount.Cmp(want.Amount) != 0 {
+					t.Errorf("asset out %d: %+v, want %+v", i, got, want)
+				}
+			}
+			if action.Recipient != tt.recipient {
+				t.Errorf("recipient %s, want %s", action.Recipient.Hex(), tt.recipient.Hex())
+			}
+		})
+	}
+
+	for name, calldata := range map[string][]byte{
+		"request without amounts": lidoCalldata(t, LidoRequestWithdrawalsSelector, &safe, []*big.Int{}),
+		"unwrap without amount":   wordCalldata(t, LidoUnwrapSelector),
+		"truncated request":       lidoCalldata(t, LidoRequestWithdrawalsSelector, &safe, amounts)[:4+32],
+	} {
+		if _, err := DecodeAction(slog.New(slog.DiscardHandler), lidoTestQueue, calldata); err == nil {
+			t.Errorf("%s: decoded", name)
+		}
+	}
+}
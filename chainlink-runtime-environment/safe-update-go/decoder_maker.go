@@ -0,0 +1,65 @@
+//go:build wasip1
+
+package main
+
+import (
+	"log/slog"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Maker DsrManager exit(address dst, uint256 wad)
+const DSRManagerExitSelector = "ef693bed"
+
+// Maker DsrManager exitAll(address dst)
+const DSRManagerExitAllSelector = "eb0dff66"
+
+// makerProtocol is the protocol name of Dai Savings Rate actions, including
+// the withdrawals of the sDAI vaults configured with it
+const makerProtocol = "maker"
+
+func init() {
+	RegisterDecoder(DSRManagerExitSelector, "exit(address,uint256)", decodeDSRManagerExit)
+	RegisterDecoder(DSRManagerExitAllSelector, "exitAll(address)", decodeDSRManagerExitAll)
+	RegisterReceiptResolver(makerProtocol, ResolveDSRExit)
+}
+
+// decodeDSRManagerExit decodes an exit of DAI from the Dai Savings Rate
+// through the DsrManager. The DAI paid out is settled from the receipt, since
+// the conversion through the savings rate can round it down.
+func decodeDSRManagerExit(logger *slog.Logger, target common.Address, calldata []byte) (*Action, error) {
+	dst, err := calldataAddress(calldata, 0)
+	if err != nil {
+		return nil, err
+	}
+	wad, err := calldataUint(calldata, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("DSR exit", "manager", target.Hex(), "wad", wad.String(), "dst", dst.Hex())
+
+	return &Action{
+		Protocol:  makerProtocol,
+		Verb:      VerbWithdraw,
+		AssetsIn:  []AssetAmount{{Amount: wad}},
+		Recipient: dst,
+	}, nil
+}
+
+// decodeDSRManagerExitAll decodes an exit of the whole Dai Savings Rate
+// balance through the DsrManager. The DAI paid out is settled from the receipt.
+func decodeDSRManagerExitAll(logger *slog.Logger, target common.Address, calldata []byte) (*Action, error) {
+	dst, err := calldataAddress(calldata, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("DSR exit all", "manager", target.Hex(), "dst", dst.Hex())
+
+	return &Action{
+		Protocol:  makerProtocol,
+		Verb:      VerbWithdraw,
+		Recipient: dst,
+	}, nil
+}
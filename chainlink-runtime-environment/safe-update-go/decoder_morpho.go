@@ -0,0 +1,104 @@
+//go:build wasip1
+
+package main
+
+import (
+	"log/slog"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Morpho Blue withdraw(MarketParams marketParams, uint256 assets, uint256 shares, address onBehalf, address receiver)
+// with MarketParams(address loanToken, address collateralToken, address oracle, address irm, uint256 lltv)
+const MorphoBlueWithdrawSelector = "5c2bea49"
+
+// Morpho Blue withdrawCollateral(MarketParams marketParams, uint256 assets, address onBehalf, address receiver)
+const MorphoBlueWithdrawCollateralSelector = "8720316d"
+
+// morphoBlueProtocol is the protocol name of Morpho Blue market actions
+const morphoBlueProtocol = "morphoblue"
+
+// morphoProtocol is the protocol name of the MetaMorpho vaults configured
+// with it. They are plain ERC-4626 vaults.
+const morphoProtocol = "morpho"
+
+// morphoMarketParamsWords is the number of calldata words of the static
+// MarketParams struct, which is encoded in place
+const morphoMarketParamsWords = 5
+
+func init() {
+	RegisterDecoder(MorphoBlueWithdrawSelector, "withdraw((address,address,address,address,uint256),uint256,uint256,address,address)", decodeMorphoBlueWithdraw)
+	RegisterDecoder(MorphoBlueWithdrawCollateralSelector, "withdrawCollateral((address,address,address,address,uint256),uint256,address,address)", decodeMorphoBlueWithdrawCollateral)
+	RegisterReceiptResolver(morphoBlueProtocol, ResolveMorphoBlueWithdraw)
+}
+
+// morphoMarketTokens returns the loan and collateral tokens of the MarketParams
+// the call starts with
+func morphoMarketTokens(calldata []byte) (common.Address, common.Address, error) {
+	loanToken, err := calldataAddress(calldata, 0)
+	if err != nil {
+		return common.Address{}, common.Address{}, err
+	}
+	collateralToken, err := calldataAddress(calldata, 1)
+	if err != nil {
+		return common.Address{}, common.Address{}, err
+	}
+	return loanToken, collateralToken, nil
+}
+
+// decodeMorphoBlueWithdraw decodes a withdrawal of supplied loan tokens from a
+// Morpho Blue market. A withdrawal by shares passes zero assets; the amount
+// then comes from the Withdraw event in the receipt.
+func decodeMorphoBlueWithdraw(logger *slog.Logger, target common.Address, calldata []byte) (*Action, error) {
+	loanToken, _, err := morphoMarketTokens(calldata)
+	if err != nil {
+		return nil, err
+	}
+	assets, err := calldataUint(calldata, morphoMarketParamsWords)
+	if err != nil {
+		return nil, err
+	}
+	shares, err := calldataUint(calldata, morphoMarketParamsWords+1)
+	if err != nil {
+		return nil, err
+	}
+	receiver, err := calldataAddress(calldata, morphoMarketParamsWords+3)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("Morpho Blue withdraw", "loanToken", loanToken.Hex(), "assets", assets.String(), "shares", shares.String())
+
+	return &Action{
+		Protocol:  morphoBlueProtocol,
+		Verb:      VerbWithdraw,
+		AssetsIn:  []AssetAmount{{Token: loanToken, Amount: assets}},
+		Recipient: receiver,
+	}, nil
+}
+
+// decodeMorphoBlueWithdrawCollateral decodes a withdrawal of collateral from a
+// Morpho Blue market
+func decodeMorphoBlueWithdrawCollateral(logger *slog.Logger, target common.Address, calldata []byte) (*Action, error) {
+	_, collateralToken, err := morphoMarketTokens(calldata)
+	if err != nil {
+		return nil, err
+	}
+	assets, err := calldataUint(calldata, morphoMarketParamsWords)
+	if err != nil {
+		return nil, err
+	}
+	receiver, err := calldataAddress(calldata, morphoMarketParamsWords+2)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("Morpho Blue withdraw collateral", "collateralToken", collateralToken.Hex(), "assets", assets.String())
+
+	return &Action{
+		Protocol:  morphoBlueProtocol,
+		Verb:      VerbWithdraw,
+		AssetsIn:  []AssetAmount{{Token: collateralToken, Amount: assets}},
+		Recipient: receiver,
+	}, nil
+}
@@ -0,0 +1,80 @@
+//go:build wasip1
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Pendle router redeemPyToToken(address receiver, address YT, uint256 netPyIn, TokenOutput output)
+const PendleRedeemPyToTokenSelector = "47f1de22"
+
+// Pendle router removeLiquiditySingleToken(address receiver, address market, uint256 netLpToRemove, TokenOutput output, LimitOrderData limit)
+const PendleRemoveLiquiditySingleTokenSelector = "60da0860"
+
+// pendleProtocol is the protocol name of Pendle router actions
+const pendleProtocol = "pendle"
+
+func init() {
+	RegisterDecoder(PendleRedeemPyToTokenSelector, "redeemPyToToken(address,address,uint256,(address,uint256,address,address,(uint8,address,bytes,bool)))", decodePendleExit)
+	RegisterDecoder(PendleRemoveLiquiditySingleTokenSelector, "removeLiquiditySingleToken(address,address,uint256,(address,uint256,address,address,(uint8,address,bytes,bool)),(address,uint256,((uint256,uint256,uint256,uint8,address,address,address,address,uint256,uint256,uint256,bytes),bytes,uint256)[],((uint256,uint256,uint256,uint8,address,address,address,address,uint256,uint256,uint256,bytes),bytes,uint256)[],bytes))", decodePendleExit)
+	RegisterReceiptResolver(pendleProtocol, ResolvePendleExit)
+}
+
+// pendleTokenOutput decodes the tokenOut and minTokenOut of the TokenOutput
+// struct whose offset is the i-th argument
+func pendleTokenOutput(calldata []byte, i int) (common.Address, *big.Int, error) {
+	offset, err := calldataUint(calldata, i)
+	if err != nil {
+		return common.Address{}, nil, err
+	}
+	if !offset.IsUint64() || offset.Uint64()%32 != 0 || offset.Uint64() > uint64(len(calldata)) {
+		return common.Address{}, nil, fmt.Errorf("invalid TokenOutput offset %s", offset)
+	}
+	word := int(offset.Uint64() / 32)
+
+	tokenOut, err := calldataAddress(calldata, word)
+	if err != nil {
+		return common.Address{}, nil, err
+	}
+	minTokenOut, err := calldataUint(calldata, word+1)
+	if err != nil {
+		return common.Address{}, nil, err
+	}
+	return tokenOut, minTokenOut, nil
+}
+
+// decodePendleExit decodes a redemption of PT and YT, or a removal of market
+// liquidity, to a single token. The calldata only carries a minimum, so the
+// amount paid out comes from the router's event in the receipt.
+func decodePendleExit(logger *slog.Logger, target common.Address, calldata []byte) (*Action, error) {
+	receiver, err := calldataAddress(calldata, 0)
+	if err != nil {
+		return nil, err
+	}
+	position, err := calldataAddress(calldata, 1)
+	if err != nil {
+		return nil, err
+	}
+	amount, err := calldataUint(calldata, 2)
+	if err != nil {
+		return nil, err
+	}
+	tokenOut, minTokenOut, err := pendleTokenOutput(calldata, 3)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("Pendle exit", "position", position.Hex(), "amount", amount.String(), "tokenOut", tokenOut.Hex(),
+		"minTokenOut", minTokenOut.String(), "receiver", receiver.Hex())
+
+	return &Action{
+		Protocol:  pendleProtocol,
+		Verb:      VerbWithdraw,
+		Recipient: receiver,
+	}, nil
+}
@@ -0,0 +1,62 @@
+//go:build wasip1
+
+package main
+
+import (
+	"log/slog"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// pendleTestRouter is the Pendle router v4
+var pendleTestRouter = common.HexToAddress("0x888888888889758F76e7103c6CbF23ABbF58F946")
+
+func TestDecodePendleExit(t *testing.T) {
+	safe := common.HexToAddress("0x00000000000000000000000000000000000000cc")
+	yt := common.HexToAddress("0xfb35Fd0095dD1096b1Ca49AD44d8C5812A201677")
+	usdc := common.HexToAddress("0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48")
+	router := common.HexToAddress("0x00000000000000000000000000000000000000ee")
+
+	// redeemPyToToken laid out word by word: the head, the TokenOutput at
+	// word 4, its SwapData at word 9 and the empty extCalldata at word 13
+	redeem := func(outputOffset int) []byte {
+		return wordCalldata(t, PendleRedeemPyToTokenSelector,
+			safe, yt, 5_000, outputOffset,
+			usdc, 4_900, usdc, common.Address{}, 5*32,
+			0, router, 4*32, 0,
+			0)
+	}
+
+	action, err := DecodeAction(slog.New(slog.DiscardHandler), pendleTestRouter, redeem(4*32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if action.Protocol != pendleProtocol || action.Verb != VerbWithdraw || action.Confidence != ConfidenceExactABI {
+		t.Errorf("decoded %s %s (%s)", action.Protocol, action.Verb, action.Confidence)
+	}
+	// The amount paid out comes from the router's event in the receipt
+	if len(action.AssetsIn) != 0 || len(action.AssetsOut) != 0 {
+		t.Errorf("assets in %+v, out %+v", action.AssetsIn, action.AssetsOut)
+	}
+	if action.Recipient != safe {
+		t.Errorf("recipient %s", action.Recipient.Hex())
+	}
+
+	tests := []struct {
+		name     string
+		calldata []byte
+	}{
+		{"unaligned TokenOutput offset", redeem(4*32 + 1)},
+		{"TokenOutput offset past the calldata", redeem(64 * 32)},
+		{"TokenOutput offset on the last word", redeem(13 * 32)},
+		{"no TokenOutput", wordCalldata(t, PendleRedeemPyToTokenSelector, safe, yt, 5_000)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if action, err := DecodeAction(slog.New(slog.DiscardHandler), pendleTestRouter, tt.calldata); err == nil {
+				t.Errorf("decoded %+v", action)
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+//go:build wasip1
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Aave V3 RewardsController claimRewards(address[] assets, uint256 amount, address to, address reward)
+const AaveClaimRewardsSelector = "236300dc"
+
+// Aave V3 RewardsController claimRewardsToSelf(address[] assets, uint256 amount, address reward)
+const AaveClaimRewardsToSelfSelector = "57b89883"
+
+// Aave V3 RewardsController claimAllRewards(address[] assets, address to)
+const AaveClaimAllRewardsSelector = "bb492bf5"
+
+// Aave V3 RewardsController claimAllRewardsToSelf(address[] assets)
+const AaveClaimAllRewardsToSelfSelector = "bf90f63a"
+
+// Aave V2 IncentivesController claimRewards(address[] assets, uint256 amount, address to)
+const AaveV2ClaimRewardsSelector = "3111e7b3"
+
+// Aave V2 IncentivesController claimRewardsToSelf(address[] assets, uint256 amount)
+const AaveV2ClaimRewardsToSelfSelector = "41485304"
+
+// Curve gauge claim_rewards(), claim_rewards(address _addr) and claim_rewards(address _addr, address _receiver)
+const (
+	CurveClaimRewardsSelector            = "e6f1daf2"
+	CurveClaimRewardsForSelector         = "84e9bd7e"
+	CurveClaimRewardsForReceiverSelector = "9faceb1b"
+)
+
+// Convex reward pool getReward() and getReward(address _account, bool _claimExtras)
+const (
+	ConvexGetRewardSelector    = "3d18b912"
+	ConvexGetRewardForSelector = "7050ccd9"
+)
+
+// Merkl Distributor claim(address[] users, address[] tokens, uint256[] amounts, bytes32[][] proofs)
+const MerklClaimSelector = "71ee95c0"
+
+// merklProtocol is the protocol name of Merkl reward claims
+const merklProtocol = "merkl"
+
+// merklUsersReviewReason explains why Merkl claims for several users are held for review
+const merklUsersReviewReason = "Merkl claim for several users"
+
+// Aave rewards controller and Merkl Distributor ABI, for the claims with array arguments
+const rewardsABI = `[
+	{"name":"claimRewards","type":"function","outputs":[],"inputs":[
+		{"name":"assets","type":"address[]"},{"name":"amount","type":"uint256"},{"name":"to","type":"address"},{"name":"reward","type":"address"}]},
+	{"name":"claimRewardsToSelf","type":"function","outputs":[],"inputs":[
+		{"name":"assets","type":"address[]"},{"name":"amount","type":"uint256"},{"name":"reward","type":"address"}]},
+	{"name":"claimAllRewards","type":"function","outputs":[],"inputs":[
+		{"name":"assets","type":"address[]"},{"name":"to","type":"address"}]},
+	{"name":"claimAllRewardsToSelf","type":"function","outputs":[],"inputs":[
+		{"name":"assets","type":"address[]"}]},
+	{"name":"claimRewards","type":"function","outputs":[],"inputs":[
+		{"name":"assets","type":"address[]"},{"name":"amount","type":"uint256"},{"name":"to","type":"address"}]},
+	{"name":"claimRewardsToSelf","type":"function","outputs":[],"inputs":[
+		{"name":"assets","type":"address[]"},{"name":"amount","type":"uint256"}]},
+	{"name":"claim","type":"function","outputs":[],"inputs":[
+		{"name":"users","type":"address[]"},{"name":"tokens","type":"address[]"},{"name":"amounts","type":"uint256[]"},{"name":"proofs","type":"bytes32[][]"}]}
+]`
+
+func init() {
+	RegisterDecoder(AaveClaimRewardsSelector, "claimRewards(address[],uint256,address,address)", decodeAaveClaimRewards)
+	RegisterDecoder(AaveClaimRewardsToSelfSelector, "claimRewardsToSelf(address[],uint256,address)", decodeAaveClaimRewards)
+	RegisterDecoder(AaveClaimAllRewardsSelector, "claimAllRewards(address[],address)", decodeAaveClaimRewards)
+	RegisterDecoder(AaveClaimAllRewardsToSelfSelector, "claimAllRewardsToSelf(address[])", decodeAaveClaimRewards)
+	RegisterDecoder(AaveV2ClaimRewardsSelector, "claimRewards(address[],uint256,address)", decodeAaveClaimRewards)
+	RegisterDecoder(AaveV2ClaimRewardsToSelfSelector, "claimRewardsToSelf(address[],uint256)", decodeAaveClaimRewards)
+	RegisterDecoder(CurveClaimRewardsSelector, "claim_rewards()", decodeCurveClaimRewards)
+	RegisterDecoder(CurveClaimRewardsForSelector, "claim_rewards(address)", decodeCurveClaimRewards)
+	RegisterDecoder(CurveClaimRewardsForReceiverSelector, "claim_rewards(address,address)", decodeCurveClaimRewards)
+	RegisterDecoder(ConvexGetRewardSelector, "getReward()", decodeConvexGetReward)
+	RegisterDecoder(ConvexGetRewardForSelector, "getReward(address,bool)", decodeConvexGetReward)
+	RegisterDecoder(MerklClaimSelector, "claim(address[],address[],uint256[],bytes32[][])", decodeMerklClaim)
+}
+
+// unpackRewardsCall returns the named arguments of a claim with array arguments
+func unpackRewardsCall(calldata []byte) (string, map[string]interface{}, error) {
+	parsedRewardsABI, err := abi.JSON(strings.NewReader(rewardsABI))
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to parse rewards ABI: %w", err)
+	}
+	method, err := parsedRewardsABI.MethodById(calldata[:4])
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: %x", ErrUnknownSelector, calldata[:4])
+	}
+	values, err := method.Inputs.Unpack(calldata[4:])
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to unpack %s: %w", method.Sig, err)
+	}
+	args := make(map[string]interface{}, len(values))
+	for i, input := range method.Inputs {
+		args[input.Name] = values[i]
+	}
+	return method.Sig, args, nil
+}
+
+// decodeAaveClaimRewards decodes a claim from an Aave V3 rewards controller
+// or V2 incentives controller. A claim of one reward token names it, with the
+// most it claims; the rewards paid are settled from the receipt.
+func decodeAaveClaimRewards(logger *slog.Logger, target common.Address, calldata []byte) (*Action, error) {
+	sig, args, err := unpackRewardsCall(calldata)
+	if err != nil {
+		return nil, err
+	}
+
+	action := &Action{Protocol: aaveProtocol, Verb: VerbClaim}
+	if to, ok := args["to"].(common.Address); ok {
+		action.Recipient = to
+	}
+	if reward, ok := args["reward"].(common.Address); ok {
+		amount, _ := args["amount"].(*big.Int)
+		action.AssetsIn = []AssetAmount{{Token: reward, Amount: amount}}
+	}
+
+	logger.Info("Aave rewards claim", "controller", target.Hex(), "function", sig)
+	return action, nil
+}
+
+// decodeCurveClaimRewards decodes a claim of a Curve gauge's extra rewards.
+// CRV emissions are minted by the Minter, not claimed from the gauge.
+func decodeCurveClaimRewards(logger *slog.Logger, target common.Address, calldata []byte) (*Action, error) {
+	action := &Action{Protocol: curveProtocol, Verb: VerbClaim}
+
+	// claim_rewards(_addr) pays _addr, claim_rewards(_addr, _receiver) pays _receiver
+	if len(calldata) >= 4+32 {
+		recipient, err := calldataAddress(calldata, 0)
+		if err != nil {
+			return nil, err
+		}
+		if len(calldata) >= 4+2*32 {
+			if recipient, err = calldataAddress(calldata, 1); err != nil {
+				return nil, err
+			}
+		}
+		action.Recipient = recipient
+	}
+
+	logger.Info("Curve gauge rewards claim", "gauge", target.Hex())
+	return action, nil
+}
+
+// decodeConvexGetReward decodes a claim from a Convex or Aura reward pool,
+// which also claims the extra rewards of the pool unless told otherwise
+func decodeConvexGetReward(logger *slog.Logger, target common.Address, calldata []byte) (*Action, error) {
+	action := &Action{Protocol: convexProtocol, Verb: VerbClaim}
+	if len(calldata) >= 4+32 {
+		account, err := calldataAddress(calldata, 0)
+		if err != nil {
+			return nil, err
+		}
+		action.Recipient = account
+	}
+
+	logger.Info("Convex rewards claim", "rewardPool", target.Hex())
+	return action, nil
+}
+
+// decodeMerklClaim decodes a claim from the Merkl Distributor. Its amounts
+// are the cumulative rewards of each token, so they only bound what is paid,
+// which is settled from the receipt.
+func decodeMerklClaim(logger *slog.Logger, target common.Address, calldata []byte) (*Action, error) {
+	_, args, err := unpackRewardsCall(calldata)
+	if err != nil {
+		return nil, err
+	}
+	users, _ := args["users"].([]common.Address)
+	tokens, _ := args["tokens"].([]common.Address)
+	amounts, _ := args["amounts"].([]*big.Int)
+	if len(users) == 0 || len(users) != len(tokens) || len(tokens) != len(amounts) {
+		return nil, fmt.Errorf("Merkl claim of %d users, %d tokens and %d amounts", len(users), len(tokens), len(amounts))
+	}
+
+	action := &Action{Protocol: merklProtocol, Verb: VerbClaim, Recipient: users[0]}
+	for i, token := range tokens {
+		if users[i] != action.Recipient {
+			action.NeedsReview, action.ReviewReason = true, merklUsersReviewReason
+		}
+		action.AssetsIn = append(action.AssetsIn, AssetAmount{Token: token, Amount: amounts[i]})
+	}
+
+	logger.Info("Merkl rewards claim", "distributor", target.Hex(), "tokens", len(tokens))
+	return action, nil
+}
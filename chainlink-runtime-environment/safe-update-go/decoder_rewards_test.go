@@ -0,0 +1,92 @@
+//go:build wasip1
+
+package main
+
+import (
+	"log/slog"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// TestDecodeRewardClaims decodes claim calldata packed from the ABI. Amounts
+// are settled from the receipt, so only the named reward tokens, their bounds
+// and the recipients are checked here.
+func TestDecodeRewardClaims(t *testing.T) {
+	parsed, err := abi.JSON(strings.NewReader(rewardsABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pack := func(method string, args ...interface{}) []byte {
+		t.Helper()
+		calldata, err := parsed.Pack(method, args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return calldata
+	}
+	target := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	reward := common.HexToAddress("0x00000000000000000000000000000000000000bb")
+	safe := common.HexToAddress("0x00000000000000000000000000000000000000cc")
+	other := common.HexToAddress("0x00000000000000000000000000000000000000dd")
+	assets := []common.Address{common.HexToAddress("0x00000000000000000000000000000000000000ee")}
+	amount := big.NewInt(1000000)
+
+	tests := []struct {
+		name      string
+		calldata  []byte
+		protocol  string
+		recipient common.Address
+		rewards   []AssetAmount
+		review    bool
+	}{
+		{"aave claimRewards", pack("claimRewards", assets, amount, safe, reward), aaveProtocol, safe,
+			[]AssetAmount{{Token: reward, Amount: amount}}, false},
+		{"aave claimRewardsToSelf", pack("claimRewardsToSelf", assets, amount, reward), aaveProtocol, common.Address{},
+			[]AssetAmount{{Token: reward, Amount: amount}}, false},
+		{"aave claimAllRewards", pack("claimAllRewards", assets, safe), aaveProtocol, safe, nil, false},
+		{"aave claimAllRewardsToSelf", pack("claimAllRewardsToSelf", assets), aaveProtocol, common.Address{}, nil, false},
+		{"aave v2 claimRewards", pack("claimRewards0", assets, amount, safe), aaveProtocol, safe, nil, false},
+		{"aave v2 claimRewardsToSelf", pack("claimRewardsToSelf0", assets, amount), aaveProtocol, common.Address{}, nil, false},
+		{"curve claim_rewards()", common.FromHex("0x" + CurveClaimRewardsSelector), curveProtocol, common.Address{}, nil, false},
+		{"curve claim_rewards(addr)", append(common.FromHex("0x"+CurveClaimRewardsForSelector), common.LeftPadBytes(safe.Bytes(), 32)...),
+			curveProtocol, safe, nil, false},
+		{"curve claim_rewards(addr, receiver)", append(append(common.FromHex("0x"+CurveClaimRewardsForReceiverSelector),
+			common.LeftPadBytes(safe.Bytes(), 32)...), common.LeftPadBytes(other.Bytes(), 32)...), curveProtocol, other, nil, false},
+		{"convex getReward()", common.FromHex("0x" + ConvexGetRewardSelector), convexProtocol, common.Address{}, nil, false},
+		{"convex getReward(account, extras)", append(append(common.FromHex("0x"+ConvexGetRewardForSelector),
+			common.LeftPadBytes(safe.Bytes(), 32)...), common.LeftPadBytes([]byte{1}, 32)...), convexProtocol, safe, nil, false},
+		{"merkl claim", pack("claim", []common.Address{safe, safe}, []common.Address{reward, target}, []*big.Int{amount, amount}, [][][32]byte{{}, {}}),
+			merklProtocol, safe, []AssetAmount{{Token: reward, Amount: amount}, {Token: target, Amount: amount}}, false},
+		{"merkl claim for several users", pack("claim", []common.Address{safe, other}, []common.Address{reward, reward}, []*big.Int{amount, amount}, [][][32]byte{{}, {}}),
+			merklProtocol, safe, []AssetAmount{{Token: reward, Amount: amount}, {Token: reward, Amount: amount}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action, err := DecodeAction(slog.New(slog.DiscardHandler), target, tt.calldata)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if action.Protocol != tt.protocol || action.Verb != VerbClaim || action.Confidence != ConfidenceExactABI {
+				t.Errorf("decoded %s %s (%s)", action.Protocol, action.Verb, action.Confidence)
+			}
+			if action.Recipient != tt.recipient {
+				t.Errorf("recipient %s", action.Recipient.Hex())
+			}
+			if len(action.AssetsIn) != len(tt.rewards) || len(action.AssetsOut) != 0 {
+				t.Fatalf("assets in %+v, out %+v", action.AssetsIn, action.AssetsOut)
+			}
+			for i, want := range tt.rewards {
+				if got := action.AssetsIn[i]; got.Token != want.Token || got.Amount.Cmp(want.Amount) != 0 {
+					t.Errorf("reward %d %+v", i, got)
+				}
+			}
+			if action.NeedsReview != tt.review {
+				t.Errorf("needs review %v: %s", action.NeedsReview, action.ReviewReason)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+//go:build wasip1
+
+package main
+
+import (
+	"log/slog"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Rocket Pool rETH burn(uint256 _rethAmount)
+const RocketPoolBurnSelector = "42966c68"
+
+// rocketPoolProtocol is the protocol name of rETH actions
+const rocketPoolProtocol = "rocketpool"
+
+func init() {
+	RegisterDecoder(RocketPoolBurnSelector, "burn(uint256)", decodeRocketPoolBurn)
+	RegisterReceiptResolver(rocketPoolProtocol, ResolveRocketPoolBurn)
+}
+
+// decodeRocketPoolBurn decodes the redemption of rETH for ETH. The rETH is
+// converted to its ETH value once the receipt confirms the target is rETH.
+func decodeRocketPoolBurn(logger *slog.Logger, target common.Address, calldata []byte) (*Action, error) {
+	amount, err := calldataUint(calldata, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("Rocket Pool rETH burn", "rETH", target.Hex(), "amount", amount.String())
+
+	return &Action{
+		Protocol:  rocketPoolProtocol,
+		Verb:      VerbWithdraw,
+		AssetsOut: []AssetAmount{{Token: target, Amount: amount}},
+	}, nil
+}
@@ -0,0 +1,12 @@
+//go:build wasip1
+
+package main
+
+// sparkProtocol is the protocol name of the SparkLend pools listed in
+// sparkPools. SparkLend is a fork of the Aave V3 pool with the same
+// selectors, so its calls are told apart by their target.
+const sparkProtocol = "spark"
+
+func init() {
+	RegisterReceiptResolver(sparkProtocol, ResolveSparkWithdraw)
+}
@@ -0,0 +1,60 @@
+//go:build wasip1
+
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Stargate Router redeemLocal(uint16 _dstChainId, uint256 _srcPoolId, uint256 _dstPoolId, address _refundAddress, uint256 _amountLP, bytes _to, (uint256 dstGasForCall, uint256 dstNativeAmount, bytes dstNativeAddr) _lzTxParams)
+const StargateRedeemLocalSelector = "8f2e1d18"
+
+// stargateProtocol is the protocol name of Stargate bridge transfers
+const stargateProtocol = "stargate"
+
+func init() {
+	RegisterDecoder(StargateRedeemLocalSelector, "redeemLocal(uint16,uint256,uint256,address,uint256,bytes,(uint256,uint256,bytes))", decodeStargateRedeemLocal)
+	RegisterReceiptResolver(stargateProtocol, ResolveStargateBridge)
+}
+
+// decodeStargateRedeemLocal decodes the redemption of pool LP tokens on
+// another chain. The LP tokens burned leave the Safe; their pool and
+// underlying amount are settled from the receipt. A destination address that
+// is not an EVM address is held for review.
+func decodeStargateRedeemLocal(logger *slog.Logger, target common.Address, calldata []byte) (*Action, error) {
+	dstChainID, err := calldataUint(calldata, 0)
+	if err != nil {
+		return nil, err
+	}
+	srcPoolID, err := calldataUint(calldata, 1)
+	if err != nil {
+		return nil, err
+	}
+	amountLP, err := calldataUint(calldata, 4)
+	if err != nil {
+		return nil, err
+	}
+
+	to, err := calldataBytes(calldata, 5)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("Stargate redeemLocal", "router", target.Hex(), "dstChainId", dstChainID.String(), "srcPoolId", srcPoolID.String(),
+		"amountLP", amountLP.String(), "to", "0x"+hex.EncodeToString(to))
+
+	action := &Action{
+		Protocol:             stargateProtocol,
+		Verb:                 VerbBridge,
+		AssetsOut:            []AssetAmount{{Amount: amountLP}},
+		DestinationRecipient: common.BytesToAddress(to),
+	}
+	if len(to) != common.AddressLength {
+		action.NeedsReview, action.ReviewReason = true, fmt.Sprintf("Stargate destination 0x%x is not an address", to)
+	}
+	return action, nil
+}
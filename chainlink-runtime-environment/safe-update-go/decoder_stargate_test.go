@@ -0,0 +1,94 @@
+//go:build wasip1
+
+package main
+
+import (
+	"encoding/hex"
+	"log/slog"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// stargateRedeemLocalCalldata packs a redeemLocal call bridging to the destination to
+func stargateRedeemLocalCalldata(t *testing.T, to []byte) []byte {
+	t.Helper()
+	newType := func(name string, components []abi.ArgumentMarshaling) abi.Type {
+		typ, err := abi.NewType(name, "", components)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return typ
+	}
+	lzTxObj := []abi.ArgumentMarshaling{
+		{Name: "dstGasForCall", Type: "uint256"},
+		{Name: "dstNativeAmount", Type: "uint256"},
+		{Name: "dstNativeAddr", Type: "bytes"},
+	}
+	arguments := abi.Arguments{
+		{Type: newType("uint16", nil)},
+		{Type: newType("uint256", nil)},
+		{Type: newType("uint256", nil)},
+		{Type: newType("address", nil)},
+		{Type: newType("uint256", nil)},
+		{Type: newType("bytes", nil)},
+		{Type: newType("tuple", lzTxObj)},
+	}
+	type lzTxParams struct {
+		DstGasForCall   *big.Int
+		DstNativeAmount *big.Int
+		DstNativeAddr   []byte
+	}
+	data, err := arguments.Pack(uint16(110), big.NewInt(1), big.NewInt(1), common.HexToAddress("0xcc"), big.NewInt(1e6), to,
+		lzTxParams{big.NewInt(0), big.NewInt(0), []byte{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	selector, err := hex.DecodeString(StargateRedeemLocalSelector)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append(selector, data...)
+}
+
+func TestDecodeStargateRedeemLocalDestination(t *testing.T) {
+	router := common.HexToAddress("0x8731d54E9D02c286767d56ac03e8037C07e01e98")
+	safe := common.HexToAddress("0x00000000000000000000000000000000000000cc")
+	logger := slog.New(slog.DiscardHandler)
+
+	tests := []struct {
+		name      string
+		to        []byte
+		recipient common.Address
+		review    bool
+	}{
+		{"address", safe.Bytes(), safe, false},
+		{"not an address", make([]byte, 32), common.Address{}, true},
+		{"empty", []byte{}, common.Address{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action, err := DecodeAction(logger, router, stargateRedeemLocalCalldata(t, tt.to))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if action.Verb != VerbBridge || action.AssetsOut[0].Amount.Cmp(big.NewInt(1e6)) != 0 {
+				t.Errorf("decoded %s %+v", action.Verb, action.AssetsOut)
+			}
+			if action.NeedsReview != tt.review {
+				t.Errorf("review %t (%s)", action.NeedsReview, action.ReviewReason)
+			}
+			if !tt.review && action.DestinationRecipient != tt.recipient {
+				t.Errorf("destination %s, want %s", action.DestinationRecipient.Hex(), tt.recipient.Hex())
+			}
+		})
+	}
+
+	calldata := stargateRedeemLocalCalldata(t, safe.Bytes())
+	calldata[4+5*32+30] = 0xff
+	if _, err := DecodeAction(logger, router, calldata); err == nil {
+		t.Error("accepted an out of bounds destination offset")
+	}
+}
@@ -0,0 +1,80 @@
+//go:build wasip1
+
+package main
+
+import (
+	"log/slog"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Uniswap V2 router removeLiquidity(address tokenA, address tokenB, uint256 liquidity, uint256 amountAMin, uint256 amountBMin, address to, uint256 deadline)
+const UniswapV2RemoveLiquiditySelector = "baa2abde"
+
+// Uniswap V2 router removeLiquidityETH(address token, uint256 liquidity, uint256 amountTokenMin, uint256 amountETHMin, address to, uint256 deadline)
+const UniswapV2RemoveLiquidityETHSelector = "02751cec"
+
+// uniswapV2Protocol is the protocol name of Uniswap V2 style router actions,
+// which also covers forks such as SushiSwap
+const uniswapV2Protocol = "uniswapv2"
+
+func init() {
+	RegisterDecoder(UniswapV2RemoveLiquiditySelector, "removeLiquidity(address,address,uint256,uint256,uint256,address,uint256)", decodeUniswapV2RemoveLiquidity)
+	RegisterDecoder(UniswapV2RemoveLiquidityETHSelector, "removeLiquidityETH(address,uint256,uint256,uint256,address,uint256)", decodeUniswapV2RemoveLiquidityETH)
+	RegisterReceiptResolver(uniswapV2Protocol, ResolveUniswapV2Burn)
+}
+
+// decodeUniswapV2RemoveLiquidity decodes a liquidity removal of a token pair.
+// The calldata only carries minimums, so both amounts come from the pair's
+// Burn event in the receipt.
+func decodeUniswapV2RemoveLiquidity(logger *slog.Logger, target common.Address, calldata []byte) (*Action, error) {
+	tokenA, err := calldataAddress(calldata, 0)
+	if err != nil {
+		return nil, err
+	}
+	tokenB, err := calldataAddress(calldata, 1)
+	if err != nil {
+		return nil, err
+	}
+	liquidity, err := calldataUint(calldata, 2)
+	if err != nil {
+		return nil, err
+	}
+	to, err := calldataAddress(calldata, 5)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("Uniswap V2 remove liquidity", "tokenA", tokenA.Hex(), "tokenB", tokenB.Hex(), "liquidity", liquidity.String())
+
+	return &Action{
+		Protocol:  uniswapV2Protocol,
+		Verb:      VerbWithdraw,
+		Recipient: to,
+	}, nil
+}
+
+// decodeUniswapV2RemoveLiquidityETH decodes a liquidity removal of a token and
+// WETH pair. The router unwraps the WETH and sends ETH, which is valued as WETH.
+func decodeUniswapV2RemoveLiquidityETH(logger *slog.Logger, target common.Address, calldata []byte) (*Action, error) {
+	token, err := calldataAddress(calldata, 0)
+	if err != nil {
+		return nil, err
+	}
+	liquidity, err := calldataUint(calldata, 1)
+	if err != nil {
+		return nil, err
+	}
+	to, err := calldataAddress(calldata, 4)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("Uniswap V2 remove liquidity ETH", "token", token.Hex(), "liquidity", liquidity.String())
+
+	return &Action{
+		Protocol:  uniswapV2Protocol,
+		Verb:      VerbWithdraw,
+		Recipient: to,
+	}, nil
+}
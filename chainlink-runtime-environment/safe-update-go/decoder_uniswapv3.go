@@ -0,0 +1,118 @@
+//go:build wasip1
+
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Uniswap V3 NonfungiblePositionManager decreaseLiquidity((uint256 tokenId, uint128 liquidity, uint256 amount0Min, uint256 amount1Min, uint256 deadline))
+const UniswapV3DecreaseLiquiditySelector = "0c49ccbe"
+
+// Uniswap V3 NonfungiblePositionManager collect((uint256 tokenId, address recipient, uint128 amount0Max, uint128 amount1Max))
+const UniswapV3CollectSelector = "fc6f7865"
+
+// Uniswap V3 multicall(bytes[] data)
+const UniswapV3MulticallSelector = "ac9650d8"
+
+// uniswapV3Protocol is the protocol name of Uniswap V3 position actions
+const uniswapV3Protocol = "uniswapv3"
+
+func init() {
+	RegisterDecoder(UniswapV3DecreaseLiquiditySelector, "decreaseLiquidity((uint256,uint128,uint256,uint256,uint256))", decodeUniswapV3PositionExit)
+	RegisterDecoder(UniswapV3CollectSelector, "collect((uint256,address,uint128,uint128))", decodeUniswapV3PositionExit)
+	RegisterDecoder(UniswapV3MulticallSelector, "multicall(bytes[])", decodeUniswapV3Multicall)
+	RegisterReceiptResolver(uniswapV3Protocol, ResolveUniswapV3Collect)
+}
+
+// decodeUniswapV3PositionExit decodes decreaseLiquidity and collect. The
+// recipient is collect's; the tokens and amounts come from the Collect events
+// of the receipt.
+func decodeUniswapV3PositionExit(logger *slog.Logger, target common.Address, calldata []byte) (*Action, error) {
+	tokenID, err := calldataUint(calldata, 0)
+	if err != nil {
+		return nil, err
+	}
+	var recipient common.Address
+	if hex.EncodeToString(calldata[:4]) == UniswapV3CollectSelector {
+		recipient, err = calldataAddress(calldata, 1)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	logger.Info("Detected Uniswap V3 position exit", "selector", "0x"+hex.EncodeToString(calldata[:4]), "tokenId", tokenID.String(),
+		"recipient", recipient.Hex())
+
+	return &Action{
+		Protocol:  uniswapV3Protocol,
+		Verb:      VerbWithdraw,
+		Recipient: recipient,
+	}, nil
+}
+
+// unpackMulticall returns the calls of a multicall(bytes[] data)
+func unpackMulticall(calldata []byte) ([][]byte, error) {
+	bytesArray, err := abi.NewType("bytes[]", "", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build multicall type: %w", err)
+	}
+	values, err := abi.Arguments{{Type: bytesArray}}.Unpack(calldata[4:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to unpack multicall: %w", err)
+	}
+	calls, ok := values[0].([][]byte)
+	if !ok {
+		return nil, fmt.Errorf("unexpected multicall arguments")
+	}
+	return calls, nil
+}
+
+// decodeUniswapV3Multicall decodes a position manager multicall that removes
+// liquidity or collects. GMX v2 ExchangeRouter multicalls share the selector
+// and are decoded as withdrawal orders when they create one. Other multicalls
+// are left to the fallback decoders.
+func decodeUniswapV3Multicall(logger *slog.Logger, target common.Address, calldata []byte) (*Action, error) {
+	calls, err := unpackMulticall(calldata)
+	if err != nil {
+		return nil, err
+	}
+	if gmxWithdrawalCall(calls) != nil {
+		return decodeGMXWithdrawalOrder(logger, target, calls)
+	}
+
+	var action *Action
+	var recipient common.Address
+	for _, call := range calls {
+		if len(call) < 4 {
+			continue
+		}
+		switch hex.EncodeToString(call[:4]) {
+		case UniswapV3DecreaseLiquiditySelector, UniswapV3CollectSelector:
+			action, err = decodeUniswapV3PositionExit(logger, target, call)
+			if err != nil {
+				return nil, err
+			}
+			if action.Recipient != (common.Address{}) {
+				if recipient != (common.Address{}) && recipient != action.Recipient {
+					return nil, fmt.Errorf("multicall collects to %s and %s", recipient.Hex(), action.Recipient.Hex())
+				}
+				recipient = action.Recipient
+			}
+		}
+	}
+	if action != nil {
+		action.Recipient = recipient
+	}
+	if action == nil {
+		return nil, fmt.Errorf("%w: multicall of %d calls without decreaseLiquidity or collect", ErrUnknownSelector, len(calls))
+	}
+
+	logger.Info("Uniswap V3 multicall", "calls", len(calls))
+	return action, nil
+}
@@ -0,0 +1,91 @@
+//go:build wasip1
+
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// uniswapV3TestManager is the Uniswap V3 NonfungiblePositionManager
+var uniswapV3TestManager = common.HexToAddress("0xC36442b4a4522E871399CD717aBDD847Ab11FE88")
+
+// multicallCalldata packs a multicall(bytes[] data) of calls
+func multicallCalldata(t *testing.T, calls ...[]byte) []byte {
+	t.Helper()
+	bytesArray, err := abi.NewType("bytes[]", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := abi.Arguments{{Type: bytesArray}}.Pack(calls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	selector, err := hex.DecodeString(UniswapV3MulticallSelector)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append(selector, data...)
+}
+
+func TestDecodeUniswapV3PositionExit(t *testing.T) {
+	safe := common.HexToAddress("0x00000000000000000000000000000000000000cc")
+	other := common.HexToAddress("0x00000000000000000000000000000000000000dd")
+	tokenID := 421337
+	decrease := wordCalldata(t, UniswapV3DecreaseLiquiditySelector, tokenID, 1_000_000, 0, 0, 1_900_000_000)
+	collect := func(recipient common.Address) []byte {
+		return wordCalldata(t, UniswapV3CollectSelector, tokenID, recipient, bigInt(t, "340282366920938463463374607431768211455"), bigInt(t, "340282366920938463463374607431768211455"))
+	}
+
+	tests := []struct {
+		name      string
+		calldata  []byte
+		recipient common.Address
+	}{
+		{"decreaseLiquidity", decrease, common.Address{}},
+		{"collect", collect(safe), safe},
+		{"multicall decrease and collect", multicallCalldata(t, decrease, collect(safe)), safe},
+		{"multicall decrease only", multicallCalldata(t, decrease), common.Address{}},
+		{"multicall collect then burn", multicallCalldata(t, collect(safe), wordCalldata(t, "42966c68", tokenID)), safe},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action, err := DecodeAction(slog.New(slog.DiscardHandler), uniswapV3TestManager, tt.calldata)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if action.Protocol != uniswapV3Protocol || action.Verb != VerbWithdraw || action.Confidence != ConfidenceExactABI {
+				t.Errorf("decoded %s %s (%s)", action.Protocol, action.Verb, action.Confidence)
+			}
+			// Tokens and amounts come from the Collect events of the receipt
+			if len(action.AssetsIn) != 0 || len(action.AssetsOut) != 0 {
+				t.Errorf("assets in %+v, out %+v", action.AssetsIn, action.AssetsOut)
+			}
+			if action.Recipient != tt.recipient {
+				t.Errorf("recipient %s, want %s", action.Recipient.Hex(), tt.recipient.Hex())
+			}
+		})
+	}
+
+	t.Run("multicall collecting to two recipients", func(t *testing.T) {
+		if _, err := DecodeAction(slog.New(slog.DiscardHandler), uniswapV3TestManager, multicallCalldata(t, collect(safe), collect(other))); err == nil {
+			t.Error("decoded")
+		}
+	})
+	t.Run("multicall without a position exit", func(t *testing.T) {
+		_, err := DecodeAction(slog.New(slog.DiscardHandler), uniswapV3TestManager, multicallCalldata(t, wordCalldata(t, "42966c68", tokenID), []byte{0x01}))
+		if !errors.Is(err, ErrUnknownSelector) {
+			t.Errorf("error %v, want ErrUnknownSelector", err)
+		}
+	})
+	t.Run("collect without recipient", func(t *testing.T) {
+		if _, err := DecodeAction(slog.New(slog.DiscardHandler), uniswapV3TestManager, wordCalldata(t, UniswapV3CollectSelector, tokenID)); err == nil {
+			t.Error("decoded")
+		}
+	})
+}
@@ -0,0 +1,266 @@
+//go:build wasip1
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Uniswap Universal Router execute(bytes commands, bytes[] inputs, uint256 deadline)
+const UniversalRouterExecuteSelector = "3593564c"
+
+// Uniswap Universal Router execute(bytes commands, bytes[] inputs)
+const UniversalRouterExecuteNoDeadlineSelector = "24856bc3"
+
+// universalRouterProtocol is the protocol name of Universal Router swaps
+const universalRouterProtocol = "universalrouter"
+
+// Universal Router commands. The command byte's top bit allows the command to
+// revert without reverting the execution, and its low 6 bits are the command.
+const (
+	urV3SwapExactIn            = 0x00
+	urV3SwapExactOut           = 0x01
+	urPermit2TransferFrom      = 0x02
+	urPermit2PermitBatch       = 0x03
+	urSweep                    = 0x04
+	urTransfer                 = 0x05
+	urPayPortion               = 0x06
+	urV2SwapExactIn            = 0x08
+	urV2SwapExactOut           = 0x09
+	urPermit2Permit            = 0x0a
+	urWrapETH                  = 0x0b
+	urUnwrapWETH               = 0x0c
+	urBalanceCheckERC20        = 0x0e
+	universalRouterCommandMask = 0x3f
+)
+
+// Recipients the router resolves: the caller, and the router itself, which
+// holds intermediate outputs for later commands
+var (
+	urMsgSender   = common.HexToAddress("0x0000000000000000000000000000000000000001")
+	urAddressThis = common.HexToAddress("0x0000000000000000000000000000000000000002")
+)
+
+// urContractBalance as an amount spends the router's whole balance of a token
+var urContractBalance = new(big.Int).Lsh(big.NewInt(1), 255)
+
+func init() {
+	RegisterDecoder(UniversalRouterExecuteSelector, "execute(bytes,bytes[],uint256)", decodeUniversalRouterExecute)
+	RegisterDecoder(UniversalRouterExecuteNoDeadlineSelector, "execute(bytes,bytes[])", decodeUniversalRouterExecute)
+	RegisterReceiptResolver(universalRouterProtocol, ResolveUniversalRouter)
+}
+
+// urSwap represents the legs of a decoded Universal Router command
+type urSwap struct {
+	sold      *AssetAmount
+	bought    *AssetAmount
+	recipient common.Address
+}
+
+// decodeUniversalRouterExecute decodes the command stream of a Universal
+// Router execution into one swap. Tokens paid by the Safe are sold; outputs
+// paid to the Safe, or to one other recipient, are bought. Outputs the router
+// keeps for later commands are neither. An execution paying both the Safe and
+// another recipient, such as an interface fee, is held for review. Native ETH legs are recorded with the
+// 0xEeee placeholder and valued as the router's WETH once settled. Amounts are
+// the calldata's bounds until they are settled from the receipt.
+func decodeUniversalRouterExecute(logger *slog.Logger, target common.Address, calldata []byte) (*Action, error) {
+	bytesType, err := abi.NewType("bytes", "", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build bytes type: %w", err)
+	}
+	bytesArray, err := abi.NewType("bytes[]", "", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build bytes[] type: %w", err)
+	}
+	values, err := abi.Arguments{{Type: bytesType}, {Type: bytesArray}}.Unpack(calldata[4:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to unpack Universal Router execute: %w", err)
+	}
+	commands, ok1 := values[0].([]byte)
+	inputs, ok2 := values[1].([][]byte)
+	if !ok1 || !ok2 || len(commands) != len(inputs) {
+		return nil, fmt.Errorf("unexpected Universal Router execute arguments")
+	}
+
+	action := &Action{Protocol: universalRouterProtocol, Verb: VerbSwap}
+	recipients := make(map[common.Address]bool)
+	for i, command := range commands {
+		swap, err := decodeUniversalRouterCommand(command&universalRouterCommandMask, inputs[i])
+		if err != nil {
+			return nil, fmt.Errorf("command %d (0x%02x): %w", i, command, err)
+		}
+		if swap == nil {
+			continue
+		}
+		if swap.sold != nil {
+			action.AssetsOut = addAssetAmount(action.AssetsOut, *swap.sold)
+		}
+		if swap.bought == nil || swap.recipient == urAddressThis {
+			continue
+		}
+		action.AssetsIn = addAssetAmount(action.AssetsIn, *swap.bought)
+		recipients[swap.recipient] = true
+		// Payouts to anyone but the Safe go through the recipient check
+		if swap.recipient != urMsgSender {
+			action.Recipient = swap.recipient
+		}
+	}
+	if len(recipients) > 1 {
+		action.NeedsReview, action.ReviewReason = true, "Universal Router execution pays several recipients"
+	}
+
+	for _, command := range commands {
+		if !universalRouterSupported(command & universalRouterCommandMask) {
+			action.NeedsReview, action.ReviewReason = true, fmt.Sprintf("unsupported Universal Router command 0x%02x", command)
+			break
+		}
+	}
+
+	logger.Info("Universal Router execution", "router", target.Hex(), "commands", fmt.Sprintf("0x%x", commands),
+		"sold", len(action.AssetsOut), "bought", len(action.AssetsIn), "recipient", action.Recipient.Hex())
+	return action, nil
+}
+
+// decodeUniversalRouterCommand decodes the input of one command. Commands that
+// move nothing, such as permits and balance checks, decode to nothing.
+func decodeUniversalRouterCommand(command byte, input []byte) (*urSwap, error) {
+	switch command {
+	case urV3SwapExactIn, urV3SwapExactOut:
+		values, err := unpackUniversalRouterInput(input, "address", "uint256", "uint256", "bytes", "bool")
+		if err != nil {
+			return nil, err
+		}
+		path := values[3].([]byte)
+		if len(path) < 43 {
+			return nil, fmt.Errorf("V3 path too short")
+		}
+		first, last := common.BytesToAddress(path[:20]), common.BytesToAddress(path[len(path)-20:])
+		// Exact output paths run from the output token to the input token
+		if command == urV3SwapExactOut {
+			first, last = last, first
+		}
+		return urSwapOf(command == urV3SwapExactIn, values, first, last), nil
+
+	case urV2SwapExactIn, urV2SwapExactOut:
+		values, err := unpackUniversalRouterInput(input, "address", "uint256", "uint256", "address[]", "bool")
+		if err != nil {
+			return nil, err
+		}
+		path := values[3].([]common.Address)
+		if len(path) < 2 {
+			return nil, fmt.Errorf("V2 path too short")
+		}
+		return urSwapOf(command == urV2SwapExactIn, values, path[0], path[len(path)-1]), nil
+
+	case urWrapETH:
+		values, err := unpackUniversalRouterInput(input, "address", "uint256")
+		if err != nil {
+			return nil, err
+		}
+		if values[1].(*big.Int).Cmp(urContractBalance) == 0 {
+			return nil, fmt.Errorf("wrapping the router's whole ETH balance is not supported")
+		}
+		return &urSwap{sold: &AssetAmount{Token: curveNativeCoin, Amount: values[1].(*big.Int)}}, nil
+
+	case urUnwrapWETH:
+		values, err := unpackUniversalRouterInput(input, "address", "uint256")
+		if err != nil {
+			return nil, err
+		}
+		return &urSwap{bought: &AssetAmount{Token: curveNativeCoin, Amount: values[1].(*big.Int)}, recipient: values[0].(common.Address)}, nil
+
+	case urPermit2TransferFrom:
+		values, err := unpackUniversalRouterInput(input, "address", "address", "uint160")
+		if err != nil {
+			return nil, err
+		}
+		return &urSwap{sold: &AssetAmount{Token: values[0].(common.Address), Amount: values[2].(*big.Int)}}, nil
+
+	case urSweep:
+		values, err := unpackUniversalRouterInput(input, "address", "address", "uint256")
+		if err != nil {
+			return nil, err
+		}
+		return &urSwap{bought: &AssetAmount{Token: values[0].(common.Address), Amount: values[2].(*big.Int)}, recipient: values[1].(common.Address)}, nil
+
+	case urTransfer, urPayPortion:
+		// TRANSFER pays an amount and PAY_PORTION basis points of the router's
+		// balance. Neither sets a minimum, so the receipt settles what was paid.
+		values, err := unpackUniversalRouterInput(input, "address", "address", "uint256")
+		if err != nil {
+			return nil, err
+		}
+		token := values[0].(common.Address)
+		if token == (common.Address{}) {
+			token = curveNativeCoin
+		}
+		return &urSwap{bought: &AssetAmount{Token: token, Amount: new(big.Int)}, recipient: values[1].(common.Address)}, nil
+	}
+	return nil, nil
+}
+
+// urSwapOf returns the legs of a V2 or V3 swap input (recipient, amount,
+// bound, path, payerIsUser). Only tokens the Safe pays are sold; the router
+// pays the others out of earlier outputs.
+func urSwapOf(exactIn bool, values []interface{}, tokenIn common.Address, tokenOut common.Address) *urSwap {
+	amountIn, amountOut := values[1].(*big.Int), values[2].(*big.Int)
+	if !exactIn {
+		amountIn, amountOut = amountOut, amountIn
+	}
+	swap := &urSwap{
+		bought:    &AssetAmount{Token: tokenOut, Amount: amountOut},
+		recipient: values[0].(common.Address),
+	}
+	if values[4].(bool) {
+		swap.sold = &AssetAmount{Token: tokenIn, Amount: amountIn}
+	}
+	return swap
+}
+
+// unpackUniversalRouterInput unpacks the ABI-encoded input of a command
+func unpackUniversalRouterInput(input []byte, types ...string) ([]interface{}, error) {
+	var args abi.Arguments
+	for _, t := range types {
+		typ, err := abi.NewType(t, "", nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build %s type: %w", t, err)
+		}
+		args = append(args, abi.Argument{Type: typ})
+	}
+	values, err := args.Unpack(input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unpack command input: %w", err)
+	}
+	return values, nil
+}
+
+// universalRouterSupported reports whether the effect of a command on the Safe
+// is accounted: swaps, wrapping, sweeps, transfers and payments out of the
+// router and Permit2 payments are decoded, and permits and balance checks
+// move nothing
+func universalRouterSupported(command byte) bool {
+	switch command {
+	case urV3SwapExactIn, urV3SwapExactOut, urV2SwapExactIn, urV2SwapExactOut, urWrapETH, urUnwrapWETH, urSweep,
+		urPermit2TransferFrom, urPermit2PermitBatch, urPermit2Permit, urBalanceCheckERC20,
+		urTransfer, urPayPortion:
+		return true
+	}
+	return false
+}
+
+// addAssetAmount adds an amount to a list of assets, merging amounts of the same token
+func addAssetAmount(assets []AssetAmount, asset AssetAmount) []AssetAmount {
+	for i := range assets {
+		if assets[i].Token == asset.Token {
+			assets[i].Amount = new(big.Int).Add(assets[i].Amount, asset.Amount)
+			return assets
+		}
+	}
+	return append(assets, AssetAmount{Token: asset.Token, Amount: new(big.Int).Set(asset.Amount)})
+}
@@ -0,0 +1,202 @@
+//go:build wasip1
+
+package main
+
+import (
+	"encoding/hex"
+	"log/slog"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// urCommand represents one command of a Universal Router execution and its arguments
+type urCommand struct {
+	command byte
+	types   []string
+	values  []interface{}
+}
+
+// urCalldata packs an execute(bytes,bytes[],uint256) call of commands
+func urCalldata(t *testing.T, commands ...urCommand) []byte {
+	t.Helper()
+	pack := func(types []string, values ...interface{}) []byte {
+		var args abi.Arguments
+		for _, name := range types {
+			typ, err := abi.NewType(name, "", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			args = append(args, abi.Argument{Type: typ})
+		}
+		packed, err := args.Pack(values...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return packed
+	}
+
+	var stream []byte
+	var inputs [][]byte
+	for _, c := range commands {
+		stream = append(stream, c.command)
+		inputs = append(inputs, pack(c.types, c.values...))
+	}
+	selector, err := hex.DecodeString(UniversalRouterExecuteSelector)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append(selector, pack([]string{"bytes", "bytes[]", "uint256"}, stream, inputs, big.NewInt(1700000000))...)
+}
+
+func TestDecodeUniversalRouterPayouts(t *testing.T) {
+	router := common.HexToAddress("0x3fC91A3afd70395Cd496C647d5a6CC9D4B2b7FAD")
+	usdc := common.HexToAddress("0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48")
+	weth := common.HexToAddress("0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2")
+	other := common.HexToAddress("0x00000000000000000000000000000000000000dd")
+	feeRecipient := common.HexToAddress("0x000000fee13a103A10D593b9AE06b3e05F2E7E1c")
+
+	swapToRouter := urCommand{urV2SwapExactIn, []string{"address", "uint256", "uint256", "address[]", "bool"},
+		[]interface{}{urAddressThis, big.NewInt(1e18), big.NewInt(0), []common.Address{weth, usdc}, true}}
+	transfer := func(token, recipient common.Address) urCommand {
+		return urCommand{urTransfer, []string{"address", "address", "uint256"}, []interface{}{token, recipient, big.NewInt(1000)}}
+	}
+	payPortion := func(token, recipient common.Address) urCommand {
+		return urCommand{urPayPortion, []string{"address", "address", "uint256"}, []interface{}{token, recipient, big.NewInt(25)}}
+	}
+	sweep := func(token, recipient common.Address) urCommand {
+		return urCommand{urSweep, []string{"address", "address", "uint256"}, []interface{}{token, recipient, big.NewInt(900)}}
+	}
+
+	tests := []struct {
+		name      string
+		commands  []urCommand
+		bought    []common.Address
+		recipient common.Address
+		review    bool
+	}{
+		{"transfer to the Safe", []urCommand{swapToRouter, transfer(usdc, urMsgSender)}, []common.Address{usdc}, common.Address{}, false},
+		{"transfer to another address", []urCommand{swapToRouter, transfer(usdc, other)}, []common.Address{usdc}, other, false},
+		{"pay portion to another address", []urCommand{swapToRouter, payPortion(usdc, other)}, []common.Address{usdc}, other, false},
+		{"transfer kept by the router", []urCommand{swapToRouter, transfer(usdc, urAddressThis)}, nil, common.Address{}, false},
+		{"native transfer to the Safe", []urCommand{transfer(common.Address{}, urMsgSender)}, []common.Address{curveNativeCoin}, common.Address{}, false},
+		{"interface fee", []urCommand{swapToRouter, payPortion(usdc, feeRecipient), sweep(usdc, urMsgSender)}, []common.Address{usdc}, feeRecipient, true},
+		{"sweep and transfer elsewhere", []urCommand{swapToRouter, sweep(usdc, urMsgSender), transfer(usdc, other)}, []common.Address{usdc}, other, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action, err := DecodeAction(slog.New(slog.DiscardHandler), router, urCalldata(t, tt.commands...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(action.AssetsIn) != len(tt.bought) {
+				t.Fatalf("bought %+v", action.AssetsIn)
+			}
+			for i, token := range tt.bought {
+				if action.AssetsIn[i].Token != token {
+					t.Errorf("bought %s, want %s", action.AssetsIn[i].Token.Hex(), token.Hex())
+				}
+			}
+			if action.Recipient != tt.recipient {
+				t.Errorf("recipient %s, want %s", action.Recipient.Hex(), tt.recipient.Hex())
+			}
+			if action.NeedsReview != tt.review {
+				t.Errorf("review %t (%s)", action.NeedsReview, action.ReviewReason)
+			}
+		})
+	}
+}
+
+func TestDecodeUniversalRouterLegs(t *testing.T) {
+	router := common.HexToAddress("0x3fC91A3afd70395Cd496C647d5a6CC9D4B2b7FAD")
+	usdc := common.HexToAddress("0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48")
+	weth := common.HexToAddress("0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2")
+	// V3 paths are token, 3-byte fee, token
+	v3Path := append(append(weth.Bytes(), 0x00, 0x01, 0xf4), usdc.Bytes()...)
+	v3 := func(command byte, amount, bound int64, payerIsUser bool) urCommand {
+		return urCommand{command, []string{"address", "uint256", "uint256", "bytes", "bool"},
+			[]interface{}{urMsgSender, big.NewInt(amount), big.NewInt(bound), v3Path, payerIsUser}}
+	}
+	v2 := func(command byte, amount, bound int64) urCommand {
+		return urCommand{command, []string{"address", "uint256", "uint256", "address[]", "bool"},
+			[]interface{}{urMsgSender, big.NewInt(amount), big.NewInt(bound), []common.Address{usdc, weth}, true}}
+	}
+	wrap := urCommand{urWrapETH, []string{"address", "uint256"}, []interface{}{urAddressThis, big.NewInt(5)}}
+	unwrap := urCommand{urUnwrapWETH, []string{"address", "uint256"}, []interface{}{urMsgSender, big.NewInt(4)}}
+	permit2 := urCommand{urPermit2TransferFrom, []string{"address", "address", "uint160"}, []interface{}{usdc, urAddressThis, big.NewInt(700)}}
+	balanceCheck := urCommand{urBalanceCheckERC20, []string{"address", "address", "uint256"}, []interface{}{urMsgSender, usdc, big.NewInt(1)}}
+	unsupported := urCommand{0x10, []string{"uint256"}, []interface{}{big.NewInt(0)}}
+
+	tests := []struct {
+		name     string
+		commands []urCommand
+		sold     []AssetAmount
+		bought   []AssetAmount
+		review   bool
+	}{
+		{"V3 exact in", []urCommand{v3(urV3SwapExactIn, 10, 30, true)},
+			[]AssetAmount{{Token: weth, Amount: big.NewInt(10)}}, []AssetAmount{{Token: usdc, Amount: big.NewInt(30)}}, false},
+		{"V3 exact out reverses the path", []urCommand{v3(urV3SwapExactOut, 30, 10, true)},
+			[]AssetAmount{{Token: usdc, Amount: big.NewInt(10)}}, []AssetAmount{{Token: weth, Amount: big.NewInt(30)}}, false},
+		{"V3 paid by the router", []urCommand{v3(urV3SwapExactIn, 10, 30, false)},
+			nil, []AssetAmount{{Token: usdc, Amount: big.NewInt(30)}}, false},
+		{"V2 exact out", []urCommand{v2(urV2SwapExactOut, 8, 20)},
+			[]AssetAmount{{Token: usdc, Amount: big.NewInt(20)}}, []AssetAmount{{Token: weth, Amount: big.NewInt(8)}}, false},
+		{"wrap and unwrap", []urCommand{wrap, unwrap},
+			[]AssetAmount{{Token: curveNativeCoin, Amount: big.NewInt(5)}}, []AssetAmount{{Token: curveNativeCoin, Amount: big.NewInt(4)}}, false},
+		{"Permit2 payment merged with the swap", []urCommand{permit2, v2(urV2SwapExactIn, 300, 1)},
+			[]AssetAmount{{Token: usdc, Amount: big.NewInt(1000)}}, []AssetAmount{{Token: weth, Amount: big.NewInt(1)}}, false},
+		{"balance check moves nothing", []urCommand{balanceCheck}, nil, nil, false},
+		{"unsupported command", []urCommand{unsupported}, nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action, err := DecodeAction(slog.New(slog.DiscardHandler), router, urCalldata(t, tt.commands...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, side := range []struct {
+				name      string
+				got, want []AssetAmount
+			}{{"sold", action.AssetsOut, tt.sold}, {"bought", action.AssetsIn, tt.bought}} {
+				if len(side.got) != len(side.want) {
+					t.Fatalf("%s %+v, want %+v", side.name, side.got, side.want)
+				}
+				for i := range side.want {
+					if side.got[i].Token != side.want[i].Token || side.got[i].Amount.Cmp(side.want[i].Amount) != 0 {
+						t.Errorf("%s %s %s, want %s %s", side.name, side.got[i].Amount, side.got[i].Token.Hex(), side.want[i].Amount, side.want[i].Token.Hex())
+					}
+				}
+			}
+			if action.NeedsReview != tt.review {
+				t.Errorf("review %t (%s)", action.NeedsReview, action.ReviewReason)
+			}
+		})
+	}
+}
+
+func TestDecodeUniversalRouterErrors(t *testing.T) {
+	router := common.HexToAddress("0x3fC91A3afd70395Cd496C647d5a6CC9D4B2b7FAD")
+	usdc := common.HexToAddress("0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48")
+
+	tests := []struct {
+		name    string
+		command urCommand
+	}{
+		{"V3 path too short", urCommand{urV3SwapExactIn, []string{"address", "uint256", "uint256", "bytes", "bool"},
+			[]interface{}{urMsgSender, big.NewInt(1), big.NewInt(1), usdc.Bytes(), true}}},
+		{"V2 path too short", urCommand{urV2SwapExactIn, []string{"address", "uint256", "uint256", "address[]", "bool"},
+			[]interface{}{urMsgSender, big.NewInt(1), big.NewInt(1), []common.Address{usdc}, true}}},
+		{"wrap the whole balance", urCommand{urWrapETH, []string{"address", "uint256"}, []interface{}{urAddressThis, urContractBalance}}},
+		{"truncated sweep", urCommand{urSweep, []string{"address"}, []interface{}{usdc}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if action, err := DecodeAction(slog.New(slog.DiscardHandler), router, urCalldata(t, tt.command)); err == nil {
+				t.Errorf("decoded %+v", action)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+//go:build wasip1
+
+package main
+
+import (
+	"log/slog"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Velodrome and Aerodrome router removeLiquidity(address tokenA, address tokenB, bool stable, uint256 liquidity, uint256 amountAMin, uint256 amountBMin, address to, uint256 deadline)
+const VelodromeRemoveLiquiditySelector = "0dede6c4"
+
+// Velodrome and Aerodrome router removeLiquidityETH(address token, bool stable, uint256 liquidity, uint256 amountTokenMin, uint256 amountETHMin, address to, uint256 deadline)
+const VelodromeRemoveLiquidityETHSelector = "d7b0e0a5"
+
+// Protocol names of Velodrome style pool actions
+const (
+	velodromeProtocol = "velodrome"
+	aerodromeProtocol = "aerodrome"
+)
+
+func init() {
+	RegisterDecoder(VelodromeRemoveLiquiditySelector, "removeLiquidity(address,address,bool,uint256,uint256,uint256,address,uint256)", decodeVelodromeRemoveLiquidity)
+	RegisterDecoder(VelodromeRemoveLiquidityETHSelector, "removeLiquidityETH(address,bool,uint256,uint256,uint256,address,uint256)", decodeVelodromeRemoveLiquidityETH)
+	RegisterReceiptResolver(velodromeProtocol, ResolveVelodromeBurn)
+}
+
+// decodeVelodromeRemoveLiquidity decodes a liquidity removal from a stable or
+// volatile pool. The calldata only carries minimums, so both amounts come
+// from the pool's Burn event in the receipt.
+func decodeVelodromeRemoveLiquidity(logger *slog.Logger, target common.Address, calldata []byte) (*Action, error) {
+	tokenA, err := calldataAddress(calldata, 0)
+	if err != nil {
+		return nil, err
+	}
+	tokenB, err := calldataAddress(calldata, 1)
+	if err != nil {
+		return nil, err
+	}
+	liquidity, err := calldataUint(calldata, 3)
+	if err != nil {
+		return nil, err
+	}
+	to, err := calldataAddress(calldata, 6)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("Velodrome remove liquidity", "router", target.Hex(), "tokenA", tokenA.Hex(), "tokenB", tokenB.Hex(), "liquidity", liquidity.String())
+
+	return &Action{
+		Protocol:  velodromeProtocol,
+		Verb:      VerbWithdraw,
+		Recipient: to,
+	}, nil
+}
+
+// decodeVelodromeRemoveLiquidityETH decodes a liquidity removal from a token
+// and WETH pool. The router unwraps the WETH and sends ETH, which is valued as WETH.
+func decodeVelodromeRemoveLiquidityETH(logger *slog.Logger, target common.Address, calldata []byte) (*Action, error) {
+	token, err := calldataAddress(calldata, 0)
+	if err != nil {
+		return nil, err
+	}
+	liquidity, err := calldataUint(calldata, 2)
+	if err != nil {
+		return nil, err
+	}
+	to, err := calldataAddress(calldata, 5)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("Velodrome remove liquidity ETH", "router", target.Hex(), "token", token.Hex(), "liquidity", liquidity.String())
+
+	return &Action{
+		Protocol:  velodromeProtocol,
+		Verb:      VerbWithdraw,
+		Recipient: to,
+	}, nil
+}
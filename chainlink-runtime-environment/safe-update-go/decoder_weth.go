@@ -0,0 +1,65 @@
+//go:build wasip1
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// wethProtocol is the protocol name of WETH unwraps
+const wethProtocol = "weth"
+
+// isWrappedNative reports whether a target is the configured WETH contract
+func isWrappedNative(config *Config, target common.Address) bool {
+	return config.WrappedNative.IsSet() && config.WrappedNative.Address == target
+}
+
+// ValidateWrappedNative checks that the configured WETH contract and native
+// ETH are both configured tokens, since an unwrap moves both
+func ValidateWrappedNative(config *Config) error {
+	if !config.WrappedNative.IsSet() {
+		return nil
+	}
+	if findTokenConfig(config, config.WrappedNative.Address) == nil {
+		return fmt.Errorf("wrappedNative %s is not a configured token", config.WrappedNative.Hex())
+	}
+	if findTokenConfig(config, nativeToken) == nil {
+		return fmt.Errorf("wrappedNative requires a %s token", TokenTypeNative)
+	}
+	return nil
+}
+
+// UnwrapWETH decodes the Yearn v2 withdraw(uint256) action of a call to the
+// configured WETH contract as an unwrap, since both share the selector
+func UnwrapWETH(config *Config, logger *slog.Logger, target common.Address, calldata []byte, action *Action) (*Action, error) {
+	if action.Selector != YearnV2WithdrawSelector || !isWrappedNative(config, target) {
+		return action, nil
+	}
+	unwrap, err := decodeWETHWithdraw(logger, target, calldata)
+	if err != nil {
+		return nil, err
+	}
+	unwrap.Counterparty, unwrap.Selector, unwrap.Confidence = action.Counterparty, action.Selector, action.Confidence
+	return unwrap, nil
+}
+
+// decodeWETHWithdraw decodes a WETH withdraw(uint256 wad), which burns wad
+// WETH and pays the Safe the same amount of native ETH
+func decodeWETHWithdraw(logger *slog.Logger, target common.Address, calldata []byte) (*Action, error) {
+	wad, err := calldataUint(calldata, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("WETH unwrap", "weth", target.Hex(), "amount", wad.String())
+
+	return &Action{
+		Protocol:  wethProtocol,
+		Verb:      VerbWithdraw,
+		AssetsIn:  []AssetAmount{{Token: nativeToken, Amount: wad}},
+		AssetsOut: []AssetAmount{{Token: target, Amount: wad}},
+	}, nil
+}
@@ -0,0 +1,92 @@
+//go:build wasip1
+
+package main
+
+import (
+	"log/slog"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Yearn v2 vault withdraw(uint256 maxShares), also WETH withdraw(uint256 wad)
+const YearnV2WithdrawSelector = "2e1a7d4d"
+
+// Yearn v2 vault withdraw(uint256 maxShares, address recipient)
+const YearnV2WithdrawToSelector = "00f714ce"
+
+// Yearn v2 vault withdraw(uint256 maxShares, address recipient, uint256 maxLoss)
+const YearnV2WithdrawMaxLossSelector = "e63697c8"
+
+// Yearn v3 vault withdraw(uint256 assets, address receiver, address owner, uint256 max_loss)
+const YearnV3WithdrawSelector = "a318c1a4"
+
+// Yearn v3 vault redeem(uint256 shares, address receiver, address owner, uint256 max_loss)
+const YearnV3RedeemSelector = "9f40a7b3"
+
+// Yearn v3 vault withdraw(uint256 assets, address receiver, address owner, uint256 max_loss, address[] strategies)
+const YearnV3WithdrawStrategiesSelector = "d81a09f6"
+
+// Yearn v3 vault redeem(uint256 shares, address receiver, address owner, uint256 max_loss, address[] strategies)
+const YearnV3RedeemStrategiesSelector = "06580f2d"
+
+// yearnProtocol is the protocol name of Yearn vault actions
+const yearnProtocol = "yearn"
+
+func init() {
+	RegisterDecoder(YearnV2WithdrawSelector, "withdraw(uint256)", decodeYearnV2Withdraw)
+	RegisterDecoder(YearnV2WithdrawToSelector, "withdraw(uint256,address)", decodeYearnV2Withdraw)
+	RegisterDecoder(YearnV2WithdrawMaxLossSelector, "withdraw(uint256,address,uint256)", decodeYearnV2Withdraw)
+	RegisterDecoder(YearnV3WithdrawSelector, "withdraw(uint256,address,address,uint256)", decodeYearnV3Withdraw)
+	RegisterDecoder(YearnV3WithdrawStrategiesSelector, "withdraw(uint256,address,address,uint256,address[])", decodeYearnV3Withdraw)
+	RegisterDecoder(YearnV3RedeemSelector, "redeem(uint256,address,address,uint256)", decodeYearnV3Redeem)
+	RegisterDecoder(YearnV3RedeemStrategiesSelector, "redeem(uint256,address,address,uint256,address[])", decodeYearnV3Redeem)
+	RegisterReceiptResolver(yearnProtocol, ResolveYearnV2Withdraw)
+}
+
+// decodeYearnV2Withdraw decodes a withdrawal from a Yearn v2 vault. The
+// amount is a maximum of vault shares; the shares actually burned are settled
+// from the receipt and converted with pricePerShare.
+func decodeYearnV2Withdraw(logger *slog.Logger, target common.Address, calldata []byte) (*Action, error) {
+	maxShares, err := calldataUint(calldata, 0)
+	if err != nil {
+		return nil, err
+	}
+	var recipient common.Address
+	if len(calldata) >= 4+2*32 {
+		recipient, err = calldataAddress(calldata, 1)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	logger.Info("Yearn v2 withdrawal", "vault", target.Hex(), "maxShares", maxShares.String())
+
+	return &Action{
+		Protocol:  yearnProtocol,
+		Verb:      VerbWithdraw,
+		AssetsIn:  []AssetAmount{{Token: target, Amount: maxShares, Shares: true}},
+		Recipient: recipient,
+	}, nil
+}
+
+// decodeYearnV3Withdraw decodes a Yearn v3 withdrawal with a maximum loss,
+// which is otherwise an ERC-4626 withdraw
+func decodeYearnV3Withdraw(logger *slog.Logger, target common.Address, calldata []byte) (*Action, error) {
+	action, err := decodeERC4626Withdraw(logger, target, calldata)
+	if err != nil {
+		return nil, err
+	}
+	action.Protocol = yearnProtocol
+	return action, nil
+}
+
+// decodeYearnV3Redeem decodes a Yearn v3 redemption with a maximum loss,
+// which is otherwise an ERC-4626 redeem
+func decodeYearnV3Redeem(logger *slog.Logger, target common.Address, calldata []byte) (*Action, error) {
+	action, err := decodeERC4626Redeem(logger, target, calldata)
+	if err != nil {
+		return nil, err
+	}
+	action.Protocol = yearnProtocol
+	return action, nil
+}
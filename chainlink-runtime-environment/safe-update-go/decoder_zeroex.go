@@ -0,0 +1,53 @@
+//go:build wasip1
+
+package main
+
+import (
+	"log/slog"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// 0x ExchangeProxy transformERC20(address inputToken, address outputToken, uint256 inputTokenAmount, uint256 minOutputTokenAmount, (uint32 deploymentNonce, bytes data)[] transformations)
+const ZeroExTransformERC20Selector = "415565b0"
+
+// zeroExProtocol is the protocol name of 0x ExchangeProxy swaps
+const zeroExProtocol = "0x"
+
+func init() {
+	RegisterDecoder(ZeroExTransformERC20Selector, "transformERC20(address,address,uint256,uint256,(uint32,bytes)[])", decodeZeroExTransformERC20)
+	RegisterReceiptResolver(zeroExProtocol, ResolveZeroExTransform)
+}
+
+// decodeZeroExTransformERC20 decodes a swap through the ExchangeProxy's
+// transformers. The proxy pays the caller, and the amounts it swapped are
+// settled from its TransformedERC20 event; minOutputTokenAmount is only the
+// floor of the amount bought.
+func decodeZeroExTransformERC20(logger *slog.Logger, target common.Address, calldata []byte) (*Action, error) {
+	inputToken, err := calldataAddress(calldata, 0)
+	if err != nil {
+		return nil, err
+	}
+	outputToken, err := calldataAddress(calldata, 1)
+	if err != nil {
+		return nil, err
+	}
+	inputAmount, err := calldataUint(calldata, 2)
+	if err != nil {
+		return nil, err
+	}
+	minOutputAmount, err := calldataUint(calldata, 3)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("0x transformERC20", "proxy", target.Hex(), "inputToken", inputToken.Hex(), "outputToken", outputToken.Hex(),
+		"inputAmount", inputAmount.String(), "minOutputAmount", minOutputAmount.String())
+
+	return &Action{
+		Protocol:  zeroExProtocol,
+		Verb:      VerbSwap,
+		AssetsIn:  []AssetAmount{{Token: outputToken, Amount: minOutputAmount}},
+		AssetsOut: []AssetAmount{{Token: inputToken, Amount: inputAmount}},
+	}, nil
+}
@@ -0,0 +1,286 @@
+//go:build wasip1
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/blockchain/evm"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+
+	"safe-update-go/fixedpoint"
+)
+
+// Methodologies of a dual write
+const (
+	// MethodologyCurrent values actions with the config
+	MethodologyCurrent = "current"
+
+	// MethodologyCandidate values actions with the config merged with the candidate overlay
+	MethodologyCandidate = "candidate"
+)
+
+// dualWriteReservedKeys are the config keys a candidate methodology cannot set
+var dualWriteReservedKeys = []string{"dualWrite", "moduleAddress", "chainSelector"}
+
+// DualWriteConfig represents a transition between valuation methodologies,
+// such as adding haircuts or moving a token to another feed. The candidate is
+// an overlay merged into the config like an environment overlay. During the
+// transition every action is valued with both methodologies and both net
+// values are recorded in the audit trail, but only the submitted
+// methodology's is submitted. Impacts above alertAboveBps raise an alert.
+type DualWriteConfig struct {
+	Candidate     map[string]interface{} `json:"candidate"`
+	Submit        string                 `json:"submit,omitempty"`
+	AlertAboveBps uint64                 `json:"alertAboveBps,omitempty"`
+}
+
+// MethodologyComparison represents an action valued with both methodologies
+type MethodologyComparison struct {
+	Submit       string
+	Current      *ActionAccounting
+	CurrentErr   error
+	Candidate    *ActionAccounting
+	CandidateErr error
+}
+
+// DualWriteStats represents the impact of the candidate methodology on the
+// actions valued with both, since the transition started
+type DualWriteStats struct {
+	Since           time.Time
+	Actions         int
+	Diverged        int
+	Failed          int
+	CurrentNetUSD   *big.Int
+	CandidateNetUSD *big.Int
+	MaxImpactBps    int64
+}
+
+// candidateConfigs caches the candidate config of each dual write config
+var candidateConfigs = make(map[*DualWriteConfig]*Config)
+
+func init() {
+	RegisterAdminMethod("dualWrite", adminDualWrite)
+}
+
+// ValidateDualWrite checks the dual write configuration and the config the
+// candidate methodology produces
+func ValidateDualWrite(config *Config) error {
+	if config.DualWrite == nil {
+		return nil
+	}
+	switch config.DualWrite.Submit {
+	case "", MethodologyCurrent, MethodologyCandidate:
+	default:
+		return fmt.Errorf("unknown methodology %q", config.DualWrite.Submit)
+	}
+	if len(config.DualWrite.Candidate) == 0 {
+		return fmt.Errorf("candidate is required")
+	}
+	for _, key := range dualWriteReservedKeys {
+		if _, ok := config.DualWrite.Candidate[key]; ok {
+			return fmt.Errorf("candidate cannot set %s", key)
+		}
+	}
+
+	candidate, err := CandidateConfig(config)
+	if err != nil {
+		return err
+	}
+	if err := ValidateConfig(candidate); err != nil {
+		return fmt.Errorf("candidate: %w", err)
+	}
+	return nil
+}
+
+// submit returns the methodology whose values are submitted
+func (c *DualWriteConfig) submit() string {
+	if c.Submit == "" {
+		return MethodologyCurrent
+	}
+	return c.Submit
+}
+
+// CandidateConfig returns the config with the candidate methodology merged in.
+// The config is re-encoded through a generic value, so the candidate merges
+// with the same rules as environment overlays.
+func CandidateConfig(config *Config) (*Config, error) {
+	if candidate, ok := candidateConfigs[config.DualWrite]; ok {
+		return candidate, nil
+	}
+
+	base := *config
+	base.DualWrite = nil
+	encoded, err := json.Marshal(&base)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode config: %w", err)
+	}
+	var tree map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+	if err := decoder.Decode(&tree); err != nil {
+		return nil, fmt.Errorf("failed to decode config: %w", err)
+	}
+	mergeConfig(tree, config.DualWrite.Candidate)
+
+	encoded, err = json.Marshal(tree)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode candidate config: %w", err)
+	}
+	candidate := &Config{}
+	if err := json.Unmarshal(encoded, candidate); err != nil {
+		return nil, fmt.Errorf("failed to parse candidate config: %w", err)
+	}
+	candidate.decoders, candidate.pricing = config.decoders, config.pricing
+
+	candidateConfigs[config.DualWrite] = candidate
+	return candidate, nil
+}
+
+// AccountActionDual values an action with the config and, during a dual
+// write, with the candidate methodology too. It returns the accounting of the
+// submitted methodology, and the comparison of both when dual writing. The
+// action is left with the assets the submitted methodology resolved.
+func AccountActionDual(config *Config, runtime cre.Runtime, evmClient *evm.Client, logger *slog.Logger, action *Action) (*ActionAccounting, *MethodologyComparison, error) {
+	if config.DualWrite == nil {
+		accounting, err := AccountAction(config, runtime, evmClient, logger, action)
+		return accounting, nil, err
+	}
+	candidate, err := CandidateConfig(config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Vault assets are resolved in place, so the candidate values its own copy
+	candidateAction := *action
+	candidateAction.AssetsIn = append([]AssetAmount(nil), action.AssetsIn...)
+	candidateAction.AssetsOut = append([]AssetAmount(nil), action.AssetsOut...)
+
+	comparison := &MethodologyComparison{Submit: config.DualWrite.submit()}
+	comparison.Current, comparison.CurrentErr = AccountAction(config, runtime, evmClient, logger, action)
+	comparison.Candidate, comparison.CandidateErr = AccountAction(candidate, runtime, evmClient, logger, &candidateAction)
+	RecordMethodologyComparison(config, runtime, comparison)
+
+	if comparison.Submit == MethodologyCandidate {
+		*action = candidateAction
+		return comparison.Candidate, comparison, comparison.CandidateErr
+	}
+	return comparison.Current, comparison, comparison.CurrentErr
+}
+
+// ImpactBps returns the change of the net value from the current to the
+// candidate methodology in basis points of the current net value. A change
+// from zero counts as 10000 bps.
+func (c *MethodologyComparison) ImpactBps() int64 {
+	if c.Current == nil || c.Candidate == nil {
+		return 0
+	}
+	diff := new(big.Int).Sub(c.Candidate.NetUSD, c.Current.NetUSD)
+	if c.Current.NetUSD.Sign() == 0 {
+		return int64(diff.Sign()) * fixedpoint.BasisPoints
+	}
+	bps := fixedpoint.MulDiv(diff, big.NewInt(fixedpoint.BasisPoints), new(big.Int).Abs(c.Current.NetUSD), fixedpoint.RoundDown)
+	if !bps.IsInt64() {
+		return int64(bps.Sign()) * math.MaxInt64
+	}
+	return bps.Int64()
+}
+
+// RecordMethodologyComparison adds a comparison to the dual write statistics
+// and alerts when either methodology failed or the impact exceeds alertAboveBps
+func RecordMethodologyComparison(config *Config, runtime cre.Runtime, comparison *MethodologyComparison) {
+	if state.DualWrite == nil {
+		state.DualWrite = &DualWriteStats{Since: runtime.Now(), CurrentNetUSD: new(big.Int), CandidateNetUSD: new(big.Int)}
+	}
+	stats := state.DualWrite
+	stats.Actions++
+
+	if comparison.CurrentErr != nil || comparison.CandidateErr != nil {
+		stats.Failed++
+		args := []any{"submit", comparison.Submit}
+		if comparison.CurrentErr != nil {
+			args = append(args, "currentError", comparison.CurrentErr.Error())
+		}
+		if comparison.CandidateErr != nil {
+			args = append(args, "candidateError", comparison.CandidateErr.Error())
+		}
+		RaiseAlert(config, runtime, slog.LevelWarn, "ALERT: methodology valuation failed", "", args...)
+		return
+	}
+
+	stats.CurrentNetUSD.Add(stats.CurrentNetUSD, comparison.Current.NetUSD)
+	stats.CandidateNetUSD.Add(stats.CandidateNetUSD, comparison.Candidate.NetUSD)
+	impact := comparison.ImpactBps()
+	if comparison.Current.NetUSD.Cmp(comparison.Candidate.NetUSD) != 0 {
+		stats.Diverged++
+	}
+	if abs64(impact) > abs64(stats.MaxImpactBps) {
+		stats.MaxImpactBps = impact
+	}
+
+	runtime.Logger().Info("Methodologies compared", "submit", comparison.Submit, "currentNetUsd", FormatUSD(config, comparison.Current.NetUSD),
+		"candidateNetUsd", FormatUSD(config, comparison.Candidate.NetUSD), "impactBps", impact)
+	if config.DualWrite.AlertAboveBps > 0 && uint64(abs64(impact)) > config.DualWrite.AlertAboveBps {
+		RaiseAlert(config, runtime, slog.LevelWarn, "ALERT: methodology impact", "", "currentNetUsd", FormatUSD(config, comparison.Current.NetUSD),
+			"candidateNetUsd", FormatUSD(config, comparison.Candidate.NetUSD), "impactBps", impact, "submit", comparison.Submit)
+	}
+}
+
+// WithMethodology copies the values of both methodologies into an audit record
+func (r AuditRecord) WithMethodology(comparison *MethodologyComparison) AuditRecord {
+	if comparison == nil {
+		return r
+	}
+	r.Methodology = comparison.Submit
+	if comparison.Current != nil {
+		r.CurrentNetUSD = comparison.Current.NetUSD.String()
+	}
+	if comparison.Candidate != nil {
+		r.CandidateNetUSD = comparison.Candidate.NetUSD.String()
+	}
+	if comparison.Current != nil && comparison.Candidate != nil {
+		r.ImpactBps = fmt.Sprintf("%d", comparison.ImpactBps())
+	}
+	return r
+}
+
+// abs64 returns the absolute value of an int64
+func abs64(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// adminDualWrite returns the impact of the candidate methodology so far
+func adminDualWrite(config *Config, runtime cre.Runtime, caller common.Address, params json.RawMessage) (interface{}, error) {
+	if config.DualWrite == nil {
+		return nil, fmt.Errorf("no dual write configured")
+	}
+	stats := state.DualWrite
+	if stats == nil {
+		stats = &DualWriteStats{CurrentNetUSD: new(big.Int), CandidateNetUSD: new(big.Int)}
+	}
+	impact := &MethodologyComparison{
+		Current:   &ActionAccounting{NetUSD: stats.CurrentNetUSD},
+		Candidate: &ActionAccounting{NetUSD: stats.CandidateNetUSD},
+	}
+	return map[string]interface{}{
+		"submit":          config.DualWrite.submit(),
+		"since":           stats.Since.Unix(),
+		"actions":         stats.Actions,
+		"diverged":        stats.Diverged,
+		"failed":          stats.Failed,
+		"currentNetUsd":   stats.CurrentNetUSD.String(),
+		"candidateNetUsd": stats.CandidateNetUSD.String(),
+		"impactBps":       impact.ImpactBps(),
+		"maxImpactBps":    stats.MaxImpactBps,
+	}, nil
+}
@@ -0,0 +1,133 @@
+//go:build wasip1
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/blockchain/evm"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+)
+
+// EigenLayer strategy ABI (underlyingToken)
+const eigenLayerStrategyABI = `[{"constant":true,"inputs":[],"name":"underlyingToken","outputs":[{"name":"","type":"address"}],"type":"function"}]`
+
+// eigenLayerBeaconChainETHStrategy is the virtual strategy of natively restaked ETH
+var eigenLayerBeaconChainETHStrategy = common.HexToAddress("0xbeaC0eeEeeeeEEeEeEEEEeeEeeeeEeeEEEEeeeEb0")
+
+// RestakedBeaconChainETHWithdrawn(address indexed recipient, uint256 amount), emitted by EigenPods
+var eigenPodWithdrawnSignature = crypto.Keccak256Hash([]byte("RestakedBeaconChainETHWithdrawn(address,uint256)"))
+
+// EigenLayerStrategyToken returns the underlying token of an EigenLayer
+// strategy from the cache or the strategy's underlyingToken()
+func EigenLayerStrategyToken(runtime cre.Runtime, evmClient *evm.Client, strategy common.Address) (common.Address, error) {
+	key := strategy.Hex()
+	if token, ok := state.VaultAssets[key]; ok {
+		return token, nil
+	}
+
+	parsedStrategyABI, err := abi.JSON(strings.NewReader(eigenLayerStrategyABI))
+	if err != nil {
+		return common.Address{}, fmt.Errorf("failed to parse EigenLayer strategy ABI: %w", err)
+	}
+	callData, err := parsedStrategyABI.Pack("underlyingToken")
+	if err != nil {
+		return common.Address{}, fmt.Errorf("failed to pack underlyingToken call: %w", err)
+	}
+	result, err := evmClient.CallContract(runtime, &evm.CallContractRequest{
+		Call: &evm.CallMsg{
+			To:   strategy.Bytes(),
+			Data: callData,
+		},
+	}).Await()
+	if err != nil {
+		return common.Address{}, fmt.Errorf("failed to call underlyingToken on %s: %w", strategy.Hex(), err)
+	}
+	var token common.Address
+	if err := parsedStrategyABI.UnpackIntoInterface(&token, "underlyingToken", result.Data); err != nil {
+		return common.Address{}, fmt.Errorf("failed to unpack underlyingToken: %w", err)
+	}
+
+	state.VaultAssets[key] = token
+	return token, nil
+}
+
+// ResolveEigenLayerWithdrawal settles a completed EigenLayer withdrawal
+// received as tokens. Each strategy is mapped to its underlying token, which
+// must be the token of the call, and credited with what the strategy
+// transferred to the withdrawer in the receipt. Natively restaked ETH is
+// credited with the EigenPod's RestakedBeaconChainETHWithdrawn events, through
+// the beacon chain ETH strategy's entry in the vaults registry, which maps it
+// to WETH. Queued withdrawals and completions as shares credit nothing.
+func ResolveEigenLayerWithdrawal(runtime cre.Runtime, evmClient *evm.Client, logger *slog.Logger, action *Action, calldata []byte, txHash []byte) error {
+	if action.Selector == EigenLayerQueueWithdrawalsSelector {
+		return nil
+	}
+	completion, err := decodeEigenLayerCompletion(calldata)
+	if err != nil {
+		return err
+	}
+	if !completion.ReceiveAsTokens {
+		return nil
+	}
+
+	reply, err := evmClient.GetTransactionReceipt(runtime, &evm.GetTransactionReceiptRequest{Hash: txHash}).Await()
+	if err != nil {
+		return fmt.Errorf("failed to get transaction receipt: %w", err)
+	}
+	if reply.Receipt == nil {
+		return fmt.Errorf("transaction receipt not found")
+	}
+	logs := reply.Receipt.Logs
+	withdrawer := completion.Withdrawal.Withdrawer
+
+	for i, strategy := range completion.Withdrawal.Strategies {
+		if strategy == eigenLayerBeaconChainETHStrategy {
+			amount := new(big.Int)
+			for _, log := range logs {
+				if len(log.Topics) == 2 && len(log.Data) >= 32 && bytes.Equal(log.Topics[0], eigenPodWithdrawnSignature.Bytes()) &&
+					common.BytesToAddress(log.Topics[1]) == withdrawer {
+					amount.Add(amount, new(big.Int).SetBytes(log.Data[:32]))
+				}
+			}
+			if amount.Sign() > 0 {
+				action.AssetsIn = append(action.AssetsIn, AssetAmount{Token: strategy, Amount: amount, Vault: true})
+				logger.Info("EigenLayer beacon chain ETH withdrawn", "withdrawer", withdrawer.Hex(), "amount", amount.String())
+			}
+			continue
+		}
+
+		token, err := EigenLayerStrategyToken(runtime, evmClient, strategy)
+		if err != nil {
+			return err
+		}
+		if token != completion.Tokens[i] {
+			return fmt.Errorf("strategy %s underlying token is %s, call withdraws %s", strategy.Hex(), token.Hex(), completion.Tokens[i].Hex())
+		}
+
+		amount := new(big.Int)
+		for _, log := range logs {
+			if common.BytesToAddress(log.Address) == token && len(log.Topics) == 3 && len(log.Data) >= 32 &&
+				bytes.Equal(log.Topics[0], transferSignature.Bytes()) &&
+				common.BytesToAddress(log.Topics[1]) == strategy && common.BytesToAddress(log.Topics[2]) == withdrawer {
+				amount.Add(amount, new(big.Int).SetBytes(log.Data[:32]))
+			}
+		}
+		if amount.Sign() > 0 {
+			action.AssetsIn = append(action.AssetsIn, AssetAmount{Token: token, Amount: amount})
+			logger.Info("EigenLayer strategy withdrawn", "strategy", strategy.Hex(), "token", token.Hex(), "amount", amount.String())
+		}
+	}
+
+	if len(action.AssetsIn) == 0 {
+		return fmt.Errorf("no EigenLayer withdrawal to %s in receipt", withdrawer.Hex())
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+//go:build wasip1
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/blockchain/evm"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+)
+
+// Ethena sUSDe ABI (silo)
+const ethenaStakedUSDeABI = `[{"constant":true,"inputs":[],"name":"silo","outputs":[{"name":"","type":"address"}],"type":"function"}]`
+
+// EthenaSilo returns the silo holding the USDe of an sUSDe vault's cooldowns,
+// from the cache or from the vault's silo()
+func EthenaSilo(runtime cre.Runtime, evmClient *evm.Client, stakedUSDe common.Address) (common.Address, error) {
+	key := stakedUSDe.Hex() + ":silo"
+	if silo, ok := state.VaultAssets[key]; ok {
+		return silo, nil
+	}
+
+	parsedStakedUSDeABI, err := abi.JSON(strings.NewReader(ethenaStakedUSDeABI))
+	if err != nil {
+		return common.Address{}, fmt.Errorf("failed to parse sUSDe ABI: %w", err)
+	}
+	callData, err := parsedStakedUSDeABI.Pack("silo")
+	if err != nil {
+		return common.Address{}, fmt.Errorf("failed to pack silo call: %w", err)
+	}
+	result, err := evmClient.CallContract(runtime, &evm.CallContractRequest{
+		Call: &evm.CallMsg{
+			To:   stakedUSDe.Bytes(),
+			Data: callData,
+		},
+	}).Await()
+	if err != nil {
+		return common.Address{}, fmt.Errorf("failed to call silo on %s: %w", stakedUSDe.Hex(), err)
+	}
+	var silo common.Address
+	if err := parsedStakedUSDeABI.UnpackIntoInterface(&silo, "silo", result.Data); err != nil {
+		return common.Address{}, fmt.Errorf("failed to unpack silo: %w", err)
+	}
+
+	state.VaultAssets[key] = silo
+	return silo, nil
+}
+
+// ResolveEthenaUnstake settles an sUSDe unstake with the USDe the vault's silo
+// transferred to the receiver in the receipt, credited through the vault so
+// it resolves to USDe. Cooldowns are settled from the calldata, and sUSDe
+// withdrawals and redemptions while the cooldown is off are plain ERC-4626.
+func ResolveEthenaUnstake(runtime cre.Runtime, evmClient *evm.Client, logger *slog.Logger, action *Action, calldata []byte, txHash []byte) error {
+	if action.Selector != EthenaUnstakeSelector {
+		return nil
+	}
+
+	silo, err := EthenaSilo(runtime, evmClient, action.Counterparty)
+	if err != nil {
+		return err
+	}
+
+	reply, err := evmClient.GetTransactionReceipt(runtime, &evm.GetTransactionReceiptRequest{Hash: txHash}).Await()
+	if err != nil {
+		return fmt.Errorf("failed to get transaction receipt: %w", err)
+	}
+	if reply.Receipt == nil {
+		return fmt.Errorf("transaction receipt not found")
+	}
+
+	amount := new(big.Int)
+	for _, log := range reply.Receipt.Logs {
+		if len(log.Topics) == 3 && len(log.Data) >= 32 && bytes.Equal(log.Topics[0], transferSignature.Bytes()) &&
+			common.BytesToAddress(log.Topics[1]) == silo && common.BytesToAddress(log.Topics[2]) == action.Recipient {
+			amount.Add(amount, new(big.Int).SetBytes(log.Data[:32]))
+		}
+	}
+	if amount.Sign() == 0 {
+		return fmt.Errorf("no USDe transfer from silo %s to %s in receipt", silo.Hex(), action.Recipient.Hex())
+	}
+
+	action.AssetsIn = append(action.AssetsIn, AssetAmount{Token: action.Counterparty, Amount: amount, Vault: true})
+	logger.Info("Ethena unstaked", "sUSDe", action.Counterparty.Hex(), "silo", silo.Hex(), "amount", amount.String())
+	return nil
+}
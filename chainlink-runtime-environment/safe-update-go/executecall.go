@@ -0,0 +1,124 @@
+//go:build wasip1
+
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Operation represents how the Safe executes a protocol call
+type Operation uint8
+
+// Operations of a protocol call, as in Safe and Zodiac modules
+const (
+	OperationCall         Operation = 0
+	OperationDelegateCall Operation = 1
+)
+
+// String returns the name of an operation
+func (o Operation) String() string {
+	switch o {
+	case OperationCall:
+		return "call"
+	case OperationDelegateCall:
+		return "delegatecall"
+	}
+	return fmt.Sprintf("operation(%d)", uint8(o))
+}
+
+// executeOnProtocol variants of the module versions, told apart by selector
+const executeOnProtocolABI = `[
+	{"name":"executeOnProtocol","type":"function","outputs":[{"name":"result","type":"bytes"}],"inputs":[
+		{"name":"target","type":"address"},{"name":"data","type":"bytes"}]},
+	{"name":"executeOnProtocol","type":"function","stateMutability":"payable","outputs":[{"name":"result","type":"bytes"}],"inputs":[
+		{"name":"target","type":"address"},{"name":"value","type":"uint256"},{"name":"data","type":"bytes"}]},
+	{"name":"executeOnProtocol","type":"function","stateMutability":"payable","outputs":[{"name":"result","type":"bytes"}],"inputs":[
+		{"name":"target","type":"address"},{"name":"value","type":"uint256"},{"name":"data","type":"bytes"},{"name":"operation","type":"uint8"}]}
+]`
+
+// ProtocolCall represents the protocol call of an executeOnProtocol
+// transaction: the calldata, the native value the Safe sends with it and
+// whether it is delegatecalled. Module versions without value or operation
+// make plain calls without value.
+type ProtocolCall struct {
+	Target    common.Address
+	Calldata  []byte
+	Value     *big.Int
+	Operation Operation
+}
+
+// executeOnProtocolArgs represents the arguments of any executeOnProtocol variant
+type executeOnProtocolArgs struct {
+	Target    common.Address
+	Value     *big.Int
+	Data      []byte
+	Operation uint8
+}
+
+// ExtractProtocolCalldata decodes the protocol call of an executeOnProtocol
+// transaction, in any of the variants of the module versions
+func ExtractProtocolCalldata(logger *slog.Logger, txData []byte) (*ProtocolCall, error) {
+	if len(txData) < 4 {
+		return nil, fmt.Errorf("transaction data too short for executeOnProtocol")
+	}
+	logger.Info("Full transaction data", "length", len(txData))
+
+	parsedABI, err := abi.JSON(strings.NewReader(executeOnProtocolABI))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse executeOnProtocol ABI: %w", err)
+	}
+	method, err := parsedABI.MethodById(txData[:4])
+	if err != nil {
+		return nil, fmt.Errorf("not an executeOnProtocol variant: selector %x", txData[:4])
+	}
+	values, err := method.Inputs.Unpack(txData[4:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to unpack %s: %w", method.Sig, err)
+	}
+	var args executeOnProtocolArgs
+	if err := method.Inputs.Copy(&args, values); err != nil {
+		return nil, fmt.Errorf("unexpected %s arguments: %w", method.Sig, err)
+	}
+
+	call := &ProtocolCall{Target: args.Target, Calldata: args.Data, Value: args.Value, Operation: Operation(args.Operation)}
+	if call.Value == nil {
+		call.Value = new(big.Int)
+	}
+	logger.Info("Extracted protocol calldata", "variant", method.Sig, "value", call.Value.String(),
+		"operation", call.Operation.String(), "data", "0x"+hex.EncodeToString(call.Calldata))
+	return call, nil
+}
+
+// WithCall copies the native value and the operation of the protocol call into an action
+func (a *Action) WithCall(call *ProtocolCall) *Action {
+	a.Value, a.Operation = call.Value, call.Operation
+	return a
+}
+
+// ExecutionReview reports whether the way an action was executed requires
+// review, and why. A delegatecall runs the target's code as the Safe, so
+// the decoded function does not describe what it did, except for MultiSend
+// deployments, which make each call of their batch as the Safe. Batches are
+// only decoded with moduleDelegateCall, for module versions taking an
+// operation, and those called rather than delegatecalled are held. Native
+// value sent with the call leaves the Safe without a token transfer and is not
+// valued, unless the action accounts for it as native ETH.
+func ExecutionReview(action *Action) (bool, string) {
+	if action.Selector == MultiSendSelector && action.Operation == OperationCall {
+		return true, "MultiSend batch called rather than delegatecalled, its calls are not made by the Safe"
+	}
+	if !action.executedAsCall() {
+		return true, fmt.Sprintf("protocol call executed as %s", action.Operation)
+	}
+	if action.Value != nil && action.Value.Sign() > 0 && !action.sendsValue() {
+		return true, fmt.Sprintf("protocol call sends %s wei of native value, which is not valued", action.Value)
+	}
+	return false, ""
+}
@@ -0,0 +1,239 @@
+//go:build wasip1
+
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/networking/http"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+)
+
+// ExplorerConfig represents an Etherscan-family API used to fetch verified
+// ABIs of unknown targets on one chain. Methods maps the method names decoded
+// from fetched ABIs to their verb; other methods are not decoded.
+type ExplorerConfig struct {
+	APIURL          string          `json:"apiUrl"`
+	ChainID         string          `json:"chainId,omitempty"`
+	APIKeySecret    string          `json:"apiKeySecret"`
+	CacheTTLSeconds uint64          `json:"cacheTtlSeconds,omitempty"`
+	Methods         map[string]Verb `json:"methods"`
+}
+
+// CachedABI represents a fetched ABI. Unverified contracts are cached too so
+// the explorer is not asked again for every event.
+type CachedABI struct {
+	ABI       string
+	Verified  bool
+	FetchedAt time.Time
+}
+
+// explorerResponse represents the getabi response of Etherscan-family APIs
+type explorerResponse struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	Result  string `json:"result"`
+}
+
+// defaultABICacheTTL keeps fetched ABIs when no TTL is configured
+const defaultABICacheTTL = 24 * time.Hour
+
+// genericProtocol is the protocol name of actions decoded from fetched ABIs
+const genericProtocol = "generic"
+
+// explorerVerbs are the verbs a fetched ABI method can be mapped to
+var explorerVerbs = map[Verb]bool{
+	VerbWithdraw: true,
+	VerbDeposit:  true,
+	VerbBorrow:   true,
+	VerbRepay:    true,
+	VerbClaim:    true,
+}
+
+// amountNames are the argument names that usually carry the amount moved
+var amountNames = []string{"amount", "assets", "shares", "value", "wad", "amt"}
+
+// explorerFor returns the explorer configured for the workflow's chain
+func explorerFor(config *Config) (*ExplorerConfig, bool) {
+	explorer, ok := config.Explorers[config.ChainSelector.String()]
+	return &explorer, ok
+}
+
+// FetchABI returns the verified ABI of a contract from the cache or the explorer
+func FetchABI(config *Config, runtime cre.Runtime, explorer *ExplorerConfig, target common.Address) (*CachedABI, error) {
+	key := strings.ToLower(target.Hex())
+	ttl := defaultABICacheTTL
+	if explorer.CacheTTLSeconds > 0 {
+		ttl = seconds(explorer.CacheTTLSeconds)
+	}
+	if cached, ok := state.ABICache[key]; ok && runtime.Now().Sub(cached.FetchedAt) < ttl {
+		return &cached, nil
+	}
+
+	secret, err := runtime.GetSecret(&cre.SecretRequest{Id: explorer.APIKeySecret}).Await()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get secret %s: %w", explorer.APIKeySecret, err)
+	}
+
+	url := fmt.Sprintf("%s?module=contract&action=getabi&address=%s&apikey=%s", explorer.APIURL, target.Hex(), secret.Value)
+	if explorer.ChainID != "" {
+		url += "&chainid=" + explorer.ChainID
+	}
+
+	result, err := http.SendRequest(config, runtime, &http.Client{},
+		func(config *Config, logger *slog.Logger, sendRequester *http.SendRequester) (string, error) {
+			resp, err := sendRequester.SendRequest(&http.Request{Url: url, Method: "GET"}).Await()
+			if err != nil {
+				return "", fmt.Errorf("failed to call explorer: %w", err)
+			}
+			if resp.StatusCode != 200 {
+				return "", fmt.Errorf("explorer returned status %d", resp.StatusCode)
+			}
+
+			var reply explorerResponse
+			if err := json.Unmarshal(resp.Body, &reply); err != nil {
+				return "", fmt.Errorf("failed to decode explorer response: %w", err)
+			}
+			if reply.Status != "1" {
+				// Unverified contracts are reported with status 0
+				if strings.Contains(strings.ToLower(reply.Result), "not verified") {
+					return "", nil
+				}
+				return "", fmt.Errorf("explorer error: %s: %s", reply.Message, reply.Result)
+			}
+			return reply.Result, nil
+		},
+		cre.ConsensusIdenticalAggregation[string](),
+	).Await()
+	if err != nil {
+		return nil, err
+	}
+
+	cached := CachedABI{ABI: result, Verified: result != "", FetchedAt: runtime.Now()}
+	state.ABICache[key] = cached
+	return &cached, nil
+}
+
+// DecodeWithFetchedABI decodes calldata to an unknown target with its verified
+// ABI. The verb comes from the method name and the asset from the arguments:
+// an address argument that is a configured token and the amount argument.
+func DecodeWithFetchedABI(config *Config, runtime cre.Runtime, logger *slog.Logger, target common.Address, calldata []byte) (*Action, error) {
+	explorer, ok := explorerFor(config)
+	if !ok {
+		return nil, fmt.Errorf("no explorer configured for chain %s", config.ChainSelector)
+	}
+	if len(calldata) < 4 {
+		return nil, fmt.Errorf("transaction data too short")
+	}
+
+	cached, err := FetchABI(config, runtime, explorer, target)
+	if err != nil {
+		return nil, err
+	}
+	if !cached.Verified {
+		return nil, fmt.Errorf("contract %s is not verified", target.Hex())
+	}
+
+	parsed, err := abi.JSON(strings.NewReader(cached.ABI))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse fetched ABI: %w", err)
+	}
+	method, err := parsed.MethodById(calldata[:4])
+	if err != nil {
+		return nil, fmt.Errorf("selector not in fetched ABI: %w", err)
+	}
+	values, err := method.Inputs.Unpack(calldata[4:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to unpack %s: %w", method.Name, err)
+	}
+
+	verb, ok := explorer.Methods[method.Name]
+	if !ok {
+		return nil, fmt.Errorf("method %s has no configured verb", method.Name)
+	}
+
+	token, amount := genericAsset(config, target, method.Inputs, values)
+	if amount == nil {
+		return nil, fmt.Errorf("no amount argument in %s", method.Sig)
+	}
+
+	logger.Info("Decoded with fetched ABI", "target", target.Hex(), "method", method.Sig, "verb", string(verb),
+		"token", token.Hex(), "amount", amount.String())
+
+	action := &Action{
+		Protocol:     genericProtocol,
+		Verb:         verb,
+		Counterparty: target,
+		Selector:     hex.EncodeToString(calldata[:4]),
+		Confidence:   ConfidenceHeuristic,
+	}
+	asset := []AssetAmount{{Token: token, Amount: amount}}
+	switch verb {
+	case VerbWithdraw, VerbBorrow, VerbClaim:
+		action.AssetsIn = asset
+	default:
+		action.AssetsOut = asset
+	}
+	return action, nil
+}
+
+// ValidateExplorer checks an explorer and the verbs of its methods
+func ValidateExplorer(explorer ExplorerConfig) error {
+	if explorer.APIURL == "" || explorer.APIKeySecret == "" {
+		return fmt.Errorf("apiUrl and apiKeySecret are required")
+	}
+	if len(explorer.Methods) == 0 {
+		return fmt.Errorf("methods is required")
+	}
+	for name, verb := range explorer.Methods {
+		if !explorerVerbs[verb] {
+			return fmt.Errorf("method %s: unsupported verb %q", name, verb)
+		}
+	}
+	return nil
+}
+
+// genericAsset picks the token and amount arguments of a decoded call. The
+// token is the first address argument that is a configured token, else the
+// target itself (vault shares); the amount is the first uint argument with a
+// known name, else the first uint argument.
+func genericAsset(config *Config, target common.Address, inputs abi.Arguments, values []interface{}) (common.Address, *big.Int) {
+	token := target
+	tokenFound := false
+	var amount, firstUint *big.Int
+
+	for i, input := range inputs {
+		switch value := values[i].(type) {
+		case common.Address:
+			if !tokenFound && findTokenConfig(config, value) != nil {
+				token = value
+				tokenFound = true
+			}
+		case *big.Int:
+			if firstUint == nil {
+				firstUint = value
+			}
+			if amount == nil {
+				for _, name := range amountNames {
+					if strings.Contains(strings.ToLower(input.Name), name) {
+						amount = value
+						break
+					}
+				}
+			}
+		}
+	}
+
+	if amount == nil {
+		amount = firstUint
+	}
+	return token, amount
+}
@@ -0,0 +1,262 @@
+//go:build wasip1
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/smartcontractkit/chainlink-protos/cre/go/values/pb"
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/blockchain/evm"
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/networking/http"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+)
+
+// FailoverConfig represents the lease shared by redundant workflow deployments.
+// Only the lease holder submits transactions; standbys shadow its decisions.
+type FailoverConfig struct {
+	InstanceID             string `json:"instanceId"`
+	LeaseURL               string `json:"leaseUrl"`
+	LeaseTTLSeconds        uint64 `json:"leaseTtlSeconds"`
+	DivergenceGraceSeconds uint64 `json:"divergenceGraceSeconds,omitempty"`
+}
+
+// ShadowDecision represents an allowance update computed by a standby
+type ShadowDecision struct {
+	TxHash        string
+	Module        string
+	SubAccount    common.Address
+	BalanceChange *big.Int
+	BlockNumber   *pb.BigInt
+	DecidedAt     time.Time
+}
+
+// leaseRequest is sent to the lease store to acquire or renew the lease
+type leaseRequest struct {
+	Holder     string `json:"holder"`
+	TTLSeconds uint64 `json:"ttlSeconds"`
+}
+
+// leaseResponse is the lease store's answer: the current lease holder
+type leaseResponse struct {
+	Holder string `json:"holder"`
+}
+
+// ValidateFailover checks the failover configuration
+func ValidateFailover(failover *FailoverConfig) error {
+	if failover == nil {
+		return nil
+	}
+	if failover.InstanceID == "" || failover.LeaseURL == "" {
+		return fmt.Errorf("instanceId and leaseUrl are required")
+	}
+	if failover.LeaseTTLSeconds == 0 {
+		return fmt.Errorf("leaseTtlSeconds is required")
+	}
+	return nil
+}
+
+// IsLeader reports whether this instance holds the submission lease. The lease
+// is renewed every third of its TTL. If the lease store is unreachable, a
+// leader keeps submitting until its own lease expires and a standby stays idle.
+func IsLeader(config *Config, runtime cre.Runtime, logger *slog.Logger) bool {
+	failover := config.Failover
+	if failover == nil {
+		return true
+	}
+
+	now := runtime.Now()
+	ttl := seconds(failover.LeaseTTLSeconds)
+	if now.Before(state.LeaseCheckedAt.Add(ttl / 3)) {
+		return state.LeaseHolder == failover.InstanceID
+	}
+
+	holder, err := acquireLease(config, runtime)
+	if err != nil {
+		logger.Warn("Failed to reach lease store", "error", err.Error())
+		return state.LeaseHolder == failover.InstanceID && now.Before(state.LeaseExpiresAt)
+	}
+
+	if holder != state.LeaseHolder {
+		logger.Warn("Lease holder changed", "from", state.LeaseHolder, "to", holder, "self", failover.InstanceID)
+	}
+	state.LeaseHolder = holder
+	state.LeaseCheckedAt = now
+	if holder == failover.InstanceID {
+		state.LeaseExpiresAt = now.Add(ttl)
+	}
+
+	return holder == failover.InstanceID
+}
+
+// acquireLease asks the lease store to grant or renew the lease for this
+// instance and returns the current holder
+func acquireLease(config *Config, runtime cre.Runtime) (string, error) {
+	return http.SendRequest(config, runtime, &http.Client{},
+		func(config *Config, logger *slog.Logger, sendRequester *http.SendRequester) (string, error) {
+			body, err := json.Marshal(leaseRequest{
+				Holder:     config.Failover.InstanceID,
+				TTLSeconds: config.Failover.LeaseTTLSeconds,
+			})
+			if err != nil {
+				return "", fmt.Errorf("failed to encode lease request: %w", err)
+			}
+
+			resp, err := sendRequester.SendRequest(&http.Request{
+				Url:     config.Failover.LeaseURL,
+				Method:  "POST",
+				Headers: map[string]string{"Content-Type": "application/json"},
+				Body:    body,
+			}).Await()
+			if err != nil {
+				return "", fmt.Errorf("failed to call lease store: %w", err)
+			}
+			if resp.StatusCode != 200 {
+				return "", fmt.Errorf("lease store returned status %d", resp.StatusCode)
+			}
+
+			var lease leaseResponse
+			if err := json.Unmarshal(resp.Body, &lease); err != nil {
+				return "", fmt.Errorf("failed to decode lease response: %w", err)
+			}
+			return lease.Holder, nil
+		},
+		cre.ConsensusIdenticalAggregation[string](),
+	).Await()
+}
+
+// RecordShadow stores a decision the standby would have submitted
+func (s *WorkflowState) RecordShadow(decision ShadowDecision) {
+	s.Shadow = append(s.Shadow, decision)
+}
+
+// CheckShadowDivergence compares the standby's decisions, once their grace
+// period is over, with the SubaccountAllowancesUpdated events the leader
+// produced for the same module and subaccount. Each decision is matched with
+// an update of the same balance change; the leader may also have batched
+// several of them into one update of their total, so the decisions left over
+// are matched with the total of the updates left over. Decisions the leader's
+// updates do not cover are divergences.
+func CheckShadowDivergence(config *Config, runtime cre.Runtime, evmClient *evm.Client, logger *slog.Logger) int {
+	if config.Failover == nil || len(state.Shadow) == 0 {
+		return 0
+	}
+
+	now := runtime.Now()
+	grace := seconds(config.Failover.DivergenceGraceSeconds)
+	eventSignature := crypto.Keccak256Hash([]byte("SubaccountAllowancesUpdated(address,uint256,uint256,uint256)"))
+
+	// Decisions past their grace period, by module and subaccount
+	var pending []ShadowDecision
+	var keys []string
+	groups := make(map[string][]ShadowDecision)
+	for _, decision := range state.Shadow {
+		if now.Sub(decision.DecidedAt) < grace {
+			pending = append(pending, decision)
+			continue
+		}
+		key := decision.Module + "/" + decision.SubAccount.Hex()
+		if groups[key] == nil {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], decision)
+	}
+
+	divergences := 0
+	for _, key := range keys {
+		decisions := groups[key]
+		fromBlock := decisions[0].BlockNumber
+		for _, decision := range decisions[1:] {
+			if pbBigInt(decision.BlockNumber).Cmp(pbBigInt(fromBlock)) < 0 {
+				fromBlock = decision.BlockNumber
+			}
+		}
+
+		reply, err := evmClient.FilterLogs(runtime, &evm.FilterLogsRequest{
+			FilterQuery: &evm.FilterQuery{
+				FromBlock: fromBlock,
+				Addresses: [][]byte{common.HexToAddress(decisions[0].Module).Bytes()},
+				Topics: []*evm.Topics{
+					{Topic: [][]byte{eventSignature.Bytes()}},
+					{Topic: [][]byte{common.LeftPadBytes(decisions[0].SubAccount.Bytes(), 32)}},
+				},
+			},
+		}).Await()
+		if err != nil {
+			logger.Warn("Failed to read leader updates", "module", decisions[0].Module, "subAccount", decisions[0].SubAccount.Hex(), "error", err.Error())
+			pending = append(pending, decisions...)
+			continue
+		}
+
+		unmatched, expected, updated := unmatchedDecisions(decisions, leaderBalanceChanges(reply.Logs))
+		if unmatched == 0 {
+			continue
+		}
+		divergences += unmatched
+		RaiseAlert(config, runtime, slog.LevelError, "ALERT: leader divergence", key, "subAccount", decisions[0].SubAccount.Hex(), "module", decisions[0].Module,
+			"decisions", unmatched, "expectedBalanceChange", FormatUSD(config, expected), "leaderBalanceChange", FormatUSD(config, updated), "leader", state.LeaseHolder)
+	}
+	state.Shadow = pending
+
+	return divergences
+}
+
+// leaderBalanceChanges returns the balance changes of SubaccountAllowancesUpdated logs
+func leaderBalanceChanges(logs []*evm.Log) []*big.Int {
+	var changes []*big.Int
+	for _, log := range logs {
+		if len(log.Data) >= 32 {
+			changes = append(changes, new(big.Int).SetBytes(log.Data[:32]))
+		}
+	}
+	return changes
+}
+
+// unmatchedDecisions matches decisions with the leader's balance changes one
+// to one, then the decisions left over with the total of the changes left
+// over. It returns how many decisions are not covered, with the total of the
+// decisions and of the changes left over.
+func unmatchedDecisions(decisions []ShadowDecision, changes []*big.Int) (int, *big.Int, *big.Int) {
+	used := make([]bool, len(changes))
+	expected, updated := new(big.Int), new(big.Int)
+	left := 0
+	for _, decision := range decisions {
+		matched := false
+		for i, change := range changes {
+			if !used[i] && change.Cmp(decision.BalanceChange) == 0 {
+				used[i], matched = true, true
+				break
+			}
+		}
+		if !matched {
+			expected.Add(expected, decision.BalanceChange)
+			left++
+		}
+	}
+	for i, change := range changes {
+		if !used[i] {
+			updated.Add(updated, change)
+		}
+	}
+	if left > 0 && updated.Cmp(expected) >= 0 {
+		return 0, expected, updated
+	}
+	return left, expected, updated
+}
+
+// pbBigInt converts a protobuf big integer, nil being zero
+func pbBigInt(value *pb.BigInt) *big.Int {
+	if value == nil {
+		return new(big.Int)
+	}
+	n := new(big.Int).SetBytes(value.AbsVal)
+	if value.Sign < 0 {
+		n.Neg(n)
+	}
+	return n
+}
@@ -0,0 +1,64 @@
+//go:build wasip1
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"safe-update-go/scenarios"
+)
+
+// TestStandbyFirstLeaderSubmits delivers an event to the standby before the
+// leader. Both share one store, and the leader must still submit the event.
+func TestStandbyFirstLeaderSubmits(t *testing.T) {
+	leader := scenarioConfig(t, "{}")
+	leader.Store = &StoreConfig{Backend: StoreKV, URL: "https://store.example.com"}
+	leader.Failover = &FailoverConfig{InstanceID: "primary", LeaseURL: "https://lease.example.com", LeaseTTLSeconds: 60}
+	standby := *leader
+	standby.Failover = &FailoverConfig{InstanceID: "standby", LeaseURL: "https://lease.example.com", LeaseTTLSeconds: 60}
+	if storeNamespace(leader) == storeNamespace(&standby) {
+		t.Fatalf("leader and standby share namespace %s", storeNamespace(leader))
+	}
+
+	runtime, chain := newScenarioChain(t, leader)
+	store := make(mapStore)
+	handler := withStateStore(OnProtocolExecuted)
+
+	// Both instances last saw the leader holding the lease, so neither asks
+	// the lease store again
+	for _, config := range []*Config{leader, &standby} {
+		state = NewWorkflowState()
+		state.Store = store
+		if err := LoadState(config, runtime); err != nil {
+			t.Fatalf("load state: %v", err)
+		}
+		state.LeaseHolder = leader.Failover.InstanceID
+		state.LeaseCheckedAt = runtime.now
+		state.LeaseExpiresAt = runtime.now.Add(time.Minute)
+		if err := PersistState(config, runtime); err != nil {
+			t.Fatalf("persist lease: %v", err)
+		}
+	}
+
+	payload := chain.protocolExecuted(t.Name(), scenarios.Pool,
+		scenarios.AaveWithdraw(scenarios.Token, scenarios.USD(1000), scenarios.Safe), runtime.now)
+
+	state = NewWorkflowState()
+	state.Store = store
+	if _, err := handler(&standby, runtime, payload); err != nil {
+		t.Fatalf("standby: %v", err)
+	}
+	if chain.writes != 0 || len(state.Shadow) != 1 {
+		t.Fatalf("standby wrote %d updates and shadowed %d", chain.writes, len(state.Shadow))
+	}
+
+	state = NewWorkflowState()
+	state.Store = store
+	if _, err := handler(leader, runtime, payload); err != nil {
+		t.Fatalf("leader: %v", err)
+	}
+	if chain.writes != 1 {
+		t.Fatalf("leader wrote %d updates after the standby processed the event", chain.writes)
+	}
+}
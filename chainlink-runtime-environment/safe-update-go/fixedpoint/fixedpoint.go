@@ -0,0 +1,129 @@
+// Package fixedpoint implements the decimal scaling used to value token
+// amounts: conversions between token, feed and USD precisions, percentage
+// haircuts and explicit rounding. All values are integers scaled by 10^decimals.
+package fixedpoint
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// USDDecimals is the precision of USD values submitted to the module
+const USDDecimals uint8 = 18
+
+// MaxDecimals bounds the precision accepted from tokens and price feeds
+const MaxDecimals uint8 = 36
+
+// BasisPoints is the denominator of basis point ratios
+const BasisPoints = 10_000
+
+// Rounding selects how a division remainder is resolved
+type Rounding int
+
+const (
+	// RoundDown truncates toward zero
+	RoundDown Rounding = iota
+	// RoundUp rounds away from zero
+	RoundUp
+	// RoundHalfUp rounds to nearest, ties away from zero
+	RoundHalfUp
+)
+
+// ErrDecimalsOutOfRange is returned for a precision above MaxDecimals
+var ErrDecimalsOutOfRange = fmt.Errorf("decimals out of range")
+
+// pow10 holds 10^0 to 10^(2*MaxDecimals+USDDecimals)
+var pow10 = func() []*big.Int {
+	table := make([]*big.Int, 2*int(MaxDecimals)+int(USDDecimals)+1)
+	table[0] = big.NewInt(1)
+	for i := 1; i < len(table); i++ {
+		table[i] = new(big.Int).Mul(table[i-1], big.NewInt(10))
+	}
+	return table
+}()
+
+// Pow10 returns a new 10^n
+func Pow10(n int) *big.Int {
+	if n < 0 {
+		panic(fmt.Sprintf("fixedpoint: negative exponent %d", n))
+	}
+	if n < len(pow10) {
+		return new(big.Int).Set(pow10[n])
+	}
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+// CheckDecimals returns an error if a precision is above MaxDecimals
+func CheckDecimals(decimals uint8) error {
+	if decimals > MaxDecimals {
+		return fmt.Errorf("%w: %d > %d", ErrDecimalsOutOfRange, decimals, MaxDecimals)
+	}
+	return nil
+}
+
+// Div returns a / b rounded with the given mode. It panics if b is zero.
+func Div(a, b *big.Int, rounding Rounding) *big.Int {
+	quotient, remainder := new(big.Int).QuoRem(a, b, new(big.Int))
+	if remainder.Sign() == 0 {
+		return quotient
+	}
+
+	// Direction of the exact result, used to step away from zero
+	step := big.NewInt(int64(a.Sign() * b.Sign()))
+
+	switch rounding {
+	case RoundUp:
+		quotient.Add(quotient, step)
+	case RoundHalfUp:
+		twice := new(big.Int).Abs(remainder)
+		twice.Lsh(twice, 1)
+		if twice.Cmp(new(big.Int).Abs(b)) >= 0 {
+			quotient.Add(quotient, step)
+		}
+	}
+	return quotient
+}
+
+// MulDiv returns a * b / denominator rounded with the given mode
+func MulDiv(a, b, denominator *big.Int, rounding Rounding) *big.Int {
+	return Div(new(big.Int).Mul(a, b), denominator, rounding)
+}
+
+// Rescale converts a value from one precision to another
+func Rescale(value *big.Int, from, to uint8, rounding Rounding) *big.Int {
+	switch {
+	case from == to:
+		return new(big.Int).Set(value)
+	case from < to:
+		return new(big.Int).Mul(value, Pow10(int(to)-int(from)))
+	default:
+		return Div(value, Pow10(int(from)-int(to)), rounding)
+	}
+}
+
+// ToUSD values a token amount at a feed price, returning USD with USDDecimals.
+// The product is computed before dividing so no precision is lost in between.
+func ToUSD(amount *big.Int, tokenDecimals uint8, price *big.Int, priceDecimals uint8, rounding Rounding) *big.Int {
+	numerator := new(big.Int).Mul(amount, price)
+	numerator.Mul(numerator, Pow10(int(USDDecimals)))
+	return Div(numerator, Pow10(int(tokenDecimals)+int(priceDecimals)), rounding)
+}
+
+// FromWhole scales a whole number of units to the given precision
+func FromWhole(units uint64, decimals uint8) *big.Int {
+	return new(big.Int).Mul(new(big.Int).SetUint64(units), Pow10(int(decimals)))
+}
+
+// Percent returns value * percent / 100
+func Percent(value *big.Int, percent uint64, rounding Rounding) *big.Int {
+	return MulDiv(value, new(big.Int).SetUint64(percent), big.NewInt(100), rounding)
+}
+
+// Haircut removes bps basis points from a value. Rounding applies to the
+// remaining value, so RoundDown is the conservative choice for credits.
+func Haircut(value *big.Int, bps uint64, rounding Rounding) *big.Int {
+	if bps >= BasisPoints {
+		return new(big.Int)
+	}
+	return MulDiv(value, new(big.Int).SetUint64(BasisPoints-bps), big.NewInt(BasisPoints), rounding)
+}
@@ -0,0 +1,211 @@
+package fixedpoint
+
+import (
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+// bi parses a base 10 integer for test tables
+func bi(t *testing.T, s string) *big.Int {
+	t.Helper()
+	v, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		t.Fatalf("invalid integer %q", s)
+	}
+	return v
+}
+
+func TestPow10(t *testing.T) {
+	tests := []struct {
+		n    int
+		want string
+	}{
+		{0, "1"},
+		{1, "10"},
+		{6, "1000000"},
+		{18, "1000000000000000000"},
+		{90, "1" + zeros(90)},
+		{100, "1" + zeros(100)},
+	}
+	for _, tt := range tests {
+		if got := Pow10(tt.n); got.String() != tt.want {
+			t.Errorf("Pow10(%d) = %s, want %s", tt.n, got, tt.want)
+		}
+	}
+
+	// Returned values must not alias the table
+	Pow10(2).SetInt64(7)
+	if got := Pow10(2); got.Int64() != 100 {
+		t.Errorf("Pow10(2) = %s after mutating a previous result", got)
+	}
+}
+
+func TestCheckDecimals(t *testing.T) {
+	for _, d := range []uint8{0, 6, 8, 18, MaxDecimals} {
+		if err := CheckDecimals(d); err != nil {
+			t.Errorf("CheckDecimals(%d) = %v", d, err)
+		}
+	}
+	for _, d := range []uint8{MaxDecimals + 1, 255} {
+		if err := CheckDecimals(d); !errors.Is(err, ErrDecimalsOutOfRange) {
+			t.Errorf("CheckDecimals(%d) = %v, want ErrDecimalsOutOfRange", d, err)
+		}
+	}
+}
+
+func TestDiv(t *testing.T) {
+	tests := []struct {
+		a, b     int64
+		rounding Rounding
+		want     int64
+	}{
+		{10, 5, RoundDown, 2},
+		{10, 5, RoundUp, 2},
+		{10, 5, RoundHalfUp, 2},
+		{7, 2, RoundDown, 3},
+		{7, 2, RoundUp, 4},
+		{7, 2, RoundHalfUp, 4},
+		{7, 3, RoundHalfUp, 2},
+		{8, 3, RoundHalfUp, 3},
+		{1, 3, RoundUp, 1},
+		{-7, 2, RoundDown, -3},
+		{-7, 2, RoundUp, -4},
+		{-7, 2, RoundHalfUp, -4},
+		{7, -2, RoundUp, -4},
+		{-7, -2, RoundDown, 3},
+		{-7, -2, RoundUp, 4},
+		{-7, 3, RoundHalfUp, -2},
+		{0, 3, RoundUp, 0},
+	}
+	for _, tt := range tests {
+		got := Div(big.NewInt(tt.a), big.NewInt(tt.b), tt.rounding)
+		if got.Int64() != tt.want {
+			t.Errorf("Div(%d, %d, %d) = %s, want %d", tt.a, tt.b, tt.rounding, got, tt.want)
+		}
+	}
+}
+
+func TestRescale(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		from, to uint8
+		rounding Rounding
+		want     string
+	}{
+		{"same precision", "123456", 6, 6, RoundDown, "123456"},
+		{"up 6 to 18", "1500000", 6, 18, RoundDown, "1500000000000000000"},
+		{"down 18 to 6 exact", "1500000000000000000", 18, 6, RoundDown, "1500000"},
+		{"down truncates", "1999999999999", 18, 6, RoundDown, "1"},
+		{"down rounds up", "1000000000001", 18, 6, RoundUp, "2"},
+		{"down half up", "1500000000000", 18, 6, RoundHalfUp, "2"},
+		{"down below half", "1499999999999", 18, 6, RoundHalfUp, "1"},
+		{"8 to 0", "12345678901", 8, 0, RoundDown, "123"},
+		{"0 to 8", "123", 0, 8, RoundDown, "12300000000"},
+		{"negative down", "-1999999999999", 18, 6, RoundDown, "-1"},
+		{"negative up", "-1000000000001", 18, 6, RoundUp, "-2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value := bi(t, tt.value)
+			got := Rescale(value, tt.from, tt.to, tt.rounding)
+			if got.String() != tt.want {
+				t.Errorf("Rescale(%s, %d, %d) = %s, want %s", tt.value, tt.from, tt.to, got, tt.want)
+			}
+			if value.String() != tt.value {
+				t.Errorf("Rescale modified its input to %s", value)
+			}
+		})
+	}
+}
+
+func TestToUSD(t *testing.T) {
+	tests := []struct {
+		name          string
+		amount        string
+		tokenDecimals uint8
+		price         string
+		priceDecimals uint8
+		rounding      Rounding
+		want          string
+	}{
+		{"1000 USDC at $1", "1000000000", 6, "100000000", 8, RoundDown, "1000" + zeros(18)},
+		{"1 WETH at $3000.12", "1" + zeros(18), 18, "300012000000", 8, RoundDown, "300012" + zeros(16)},
+		{"1 WBTC at $65000", "100000000", 8, "6500000000000", 8, RoundDown, "65000" + zeros(18)},
+		{"18 decimal feed", "2" + zeros(18), 18, "1" + zeros(18), 18, RoundDown, "2" + zeros(18)},
+		{"0 decimal token", "5", 0, "200000000", 8, RoundDown, "10" + zeros(18)},
+		{"24 decimal token", "3" + zeros(24), 24, "150000000", 8, RoundDown, "45" + zeros(17)},
+		{"zero amount", "0", 6, "100000000", 8, RoundDown, "0"},
+		{"dust truncates", "1", 36, "1", 8, RoundDown, "0"},
+		{"dust rounds up", "1", 36, "1", 8, RoundUp, "1"},
+		{"72 combined decimals", "1" + zeros(36), 36, "1" + zeros(36), 36, RoundDown, "1" + zeros(18)},
+		{"negative price", "1000000", 6, "-50000000", 8, RoundDown, "-5" + zeros(17)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ToUSD(bi(t, tt.amount), tt.tokenDecimals, bi(t, tt.price), tt.priceDecimals, tt.rounding)
+			if got.String() != tt.want {
+				t.Errorf("ToUSD = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFromWhole(t *testing.T) {
+	if got := FromWhole(1_000_000, USDDecimals); got.String() != "1000000"+zeros(18) {
+		t.Errorf("FromWhole(1000000, 18) = %s", got)
+	}
+	if got := FromWhole(0, 6); got.Sign() != 0 {
+		t.Errorf("FromWhole(0, 6) = %s", got)
+	}
+}
+
+func TestPercent(t *testing.T) {
+	tests := []struct {
+		value    int64
+		percent  uint64
+		rounding Rounding
+		want     int64
+	}{
+		{1000, 80, RoundDown, 800},
+		{999, 80, RoundDown, 799},
+		{999, 80, RoundUp, 800},
+		{1000, 0, RoundDown, 0},
+		{1000, 100, RoundDown, 1000},
+		{1000, 120, RoundDown, 1200},
+	}
+	for _, tt := range tests {
+		if got := Percent(big.NewInt(tt.value), tt.percent, tt.rounding); got.Int64() != tt.want {
+			t.Errorf("Percent(%d, %d) = %s, want %d", tt.value, tt.percent, got, tt.want)
+		}
+	}
+}
+
+func TestHaircut(t *testing.T) {
+	tests := []struct {
+		value    int64
+		bps      uint64
+		rounding Rounding
+		want     int64
+	}{
+		{10000, 0, RoundDown, 10000},
+		{10000, 50, RoundDown, 9950},
+		{10001, 50, RoundDown, 9950},
+		{10001, 50, RoundUp, 9951},
+		{10000, 10000, RoundDown, 0},
+		{10000, 20000, RoundDown, 0},
+		{-10001, 50, RoundDown, -9950},
+	}
+	for _, tt := range tests {
+		if got := Haircut(big.NewInt(tt.value), tt.bps, tt.rounding); got.Int64() != tt.want {
+			t.Errorf("Haircut(%d, %d) = %s, want %d", tt.value, tt.bps, got, tt.want)
+		}
+	}
+}
+
+// zeros returns n zero digits
+func zeros(n int) string {
+	return strings.Repeat("0", n)
+}
@@ -0,0 +1,103 @@
+package fixedpoint
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Format represents how a fixed-point value is rendered for humans
+type Format struct {
+	ThousandsSeparator string
+	DecimalSeparator   string
+	Symbol             string
+	SymbolAfter        bool
+	FractionDigits     int
+	SignificantDigits  int
+}
+
+// locales holds the separators and symbol placement of the supported locales
+var locales = map[string]Format{
+	"en-US": {ThousandsSeparator: ",", DecimalSeparator: ".", Symbol: "$"},
+	"en-GB": {ThousandsSeparator: ",", DecimalSeparator: ".", Symbol: "US$"},
+	"de-DE": {ThousandsSeparator: ".", DecimalSeparator: ",", Symbol: " $", SymbolAfter: true},
+	"de-CH": {ThousandsSeparator: "’", DecimalSeparator: ".", Symbol: "$ "},
+	"fr-FR": {ThousandsSeparator: " ", DecimalSeparator: ",", Symbol: " $", SymbolAfter: true},
+}
+
+// LocaleFormat returns the USD format of a locale with two fraction digits
+func LocaleFormat(locale string) (Format, error) {
+	format, ok := locales[locale]
+	if !ok {
+		return Format{}, fmt.Errorf("unsupported locale %q", locale)
+	}
+	format.FractionDigits = 2
+	return format, nil
+}
+
+// FormatDecimal renders a value scaled by 10^decimals, e.g. 1234567 with 3
+// decimals as "$1,234.57" in en-US. The value is rounded half up to
+// FractionDigits, then to SignificantDigits if set.
+func FormatDecimal(value *big.Int, decimals uint8, format Format) string {
+	fractionDigits := format.FractionDigits
+	if fractionDigits < 0 {
+		fractionDigits = 0
+	}
+	if fractionDigits > int(MaxDecimals) {
+		fractionDigits = int(MaxDecimals)
+	}
+
+	scaled := Rescale(value, decimals, uint8(fractionDigits), RoundHalfUp)
+	negative := scaled.Sign() < 0
+	scaled.Abs(scaled)
+
+	if format.SignificantDigits > 0 {
+		if extra := len(scaled.String()) - format.SignificantDigits; extra > 0 {
+			scaled = Div(scaled, Pow10(extra), RoundHalfUp)
+			scaled.Mul(scaled, Pow10(extra))
+		}
+	}
+
+	digits := scaled.String()
+	if len(digits) <= fractionDigits {
+		digits = strings.Repeat("0", fractionDigits-len(digits)+1) + digits
+	}
+	integer, fraction := digits[:len(digits)-fractionDigits], digits[len(digits)-fractionDigits:]
+
+	var b strings.Builder
+	if negative {
+		b.WriteString("-")
+	}
+	if !format.SymbolAfter {
+		b.WriteString(format.Symbol)
+	}
+	for i, digit := range integer {
+		if i > 0 && (len(integer)-i)%3 == 0 {
+			b.WriteString(format.ThousandsSeparator)
+		}
+		b.WriteRune(digit)
+	}
+	if fractionDigits > 0 {
+		b.WriteString(format.DecimalSeparator)
+		b.WriteString(fraction)
+	}
+	if format.SymbolAfter {
+		b.WriteString(format.Symbol)
+	}
+	return b.String()
+}
+
+// ErrInvalidDecimal is returned for a string that is not a plain decimal
+var ErrInvalidDecimal = fmt.Errorf("invalid decimal")
+
+// ParseDecimal parses a plain decimal such as "1" or "0.9995" into a value
+// scaled by 10^decimals. It rejects signs, exponents and more fraction digits
+// than decimals, so the value is never rounded.
+func ParseDecimal(s string, decimals uint8) (*big.Int, error) {
+	integer, fraction, _ := strings.Cut(s, ".")
+	if integer == "" && fraction == "" || len(fraction) > int(decimals) || strings.Trim(integer+fraction, "0123456789") != "" {
+		return nil, fmt.Errorf("%w: %q with %d decimals", ErrInvalidDecimal, s, decimals)
+	}
+	value, _ := new(big.Int).SetString(integer+fraction+strings.Repeat("0", int(decimals)-len(fraction)), 10)
+	return value, nil
+}
@@ -0,0 +1,86 @@
+package fixedpoint
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFormatDecimal(t *testing.T) {
+	enUS, _ := LocaleFormat("en-US")
+	deDE, _ := LocaleFormat("de-DE")
+	frFR, _ := LocaleFormat("fr-FR")
+
+	tests := []struct {
+		name     string
+		value    string
+		decimals uint8
+		format   Format
+		want     string
+	}{
+		{"en-US", "1234567890000000000000", 18, enUS, "$1,234.57"},
+		{"de-DE", "1234567890000000000000", 18, deDE, "1.234,57 $"},
+		{"fr-FR", "1234567890000000000000", 18, frFR, "1 234,57 $"},
+		{"millions", "1000000" + zeros(18), 18, enUS, "$1,000,000.00"},
+		{"below one", "5" + zeros(15), 18, enUS, "$0.01"},
+		{"rounds to zero", "4" + zeros(15), 18, enUS, "$0.00"},
+		{"negative", "-1500" + zeros(18), 18, enUS, "-$1,500.00"},
+		{"zero", "0", 18, enUS, "$0.00"},
+		{"no fraction", "999500" + zeros(15), 18, Format{ThousandsSeparator: ","}, "1,000"},
+		{"raw separators", "123456789", 2, Format{DecimalSeparator: ".", FractionDigits: 2}, "1234567.89"},
+		{"significant digits", "1234567" + zeros(18), 18, Format{ThousandsSeparator: ",", Symbol: "$", SignificantDigits: 3}, "$1,230,000"},
+		{"significant carry", "9996" + zeros(18), 18, Format{ThousandsSeparator: ",", SignificantDigits: 3}, "10,000"},
+		{"more fraction than decimals", "15", 1, Format{DecimalSeparator: ".", FractionDigits: 3}, "1.500"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FormatDecimal(bi(t, tt.value), tt.decimals, tt.format); got != tt.want {
+				t.Errorf("FormatDecimal(%s, %d) = %q, want %q", tt.value, tt.decimals, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLocaleFormat(t *testing.T) {
+	if _, err := LocaleFormat("xx-XX"); err == nil {
+		t.Error("LocaleFormat(xx-XX) succeeded")
+	}
+	format, err := LocaleFormat("en-US")
+	if err != nil {
+		t.Fatalf("LocaleFormat(en-US) = %v", err)
+	}
+	if format.FractionDigits != 2 {
+		t.Errorf("FractionDigits = %d, want 2", format.FractionDigits)
+	}
+}
+
+func TestParseDecimal(t *testing.T) {
+	tests := []struct {
+		s        string
+		decimals uint8
+		want     string
+	}{
+		{"1", 18, "1" + zeros(18)},
+		{"1.00", 18, "1" + zeros(18)},
+		{"0.9995", 18, "9995" + zeros(14)},
+		{".5", 2, "50"},
+		{"12.", 2, "1200"},
+		{"0", 0, "0"},
+		{"1.25", 2, "125"},
+	}
+	for _, tt := range tests {
+		got, err := ParseDecimal(tt.s, tt.decimals)
+		if err != nil {
+			t.Errorf("ParseDecimal(%q, %d) = %v", tt.s, tt.decimals, err)
+			continue
+		}
+		if got.String() != tt.want {
+			t.Errorf("ParseDecimal(%q, %d) = %s, want %s", tt.s, tt.decimals, got, tt.want)
+		}
+	}
+
+	for _, s := range []string{"", ".", "-1", "+1", "1e3", "1,5", "1.2.3", "1.234", " 1"} {
+		if _, err := ParseDecimal(s, 2); !errors.Is(err, ErrInvalidDecimal) {
+			t.Errorf("ParseDecimal(%q, 2) = %v, want ErrInvalidDecimal", s, err)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+//go:build wasip1
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"math/big"
+	"time"
+
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+
+	"safe-update-go/fixedpoint"
+)
+
+// fixedPriceDateLayout is the layout of fixedPriceReviewBy
+const fixedPriceDateLayout = "2006-01-02"
+
+// fixedPriceReviewNotice is how long before its review date a fixed price is reported
+const fixedPriceReviewNotice = 14 * 24 * time.Hour
+
+// ErrFixedPriceExpired is returned when a fixed price is used after its review date
+var ErrFixedPriceExpired = fmt.Errorf("fixed price past its review date")
+
+// HasFixedPrice reports whether the token is valued at a fixed USD price
+// instead of a price feed
+func (t *TokenConfig) HasFixedPrice() bool {
+	return t.FixedPriceUSD != ""
+}
+
+// fixedPrice returns the fixed USD price of a token with USD decimals and the
+// end of its review date
+func fixedPrice(token *TokenConfig) (*big.Int, time.Time, error) {
+	price, err := fixedpoint.ParseDecimal(token.FixedPriceUSD, fixedpoint.USDDecimals)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("fixedPriceUsd: %w", err)
+	}
+	reviewBy, err := time.Parse(fixedPriceDateLayout, token.FixedPriceReviewBy)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("fixedPriceReviewBy must be a YYYY-MM-DD date: %w", err)
+	}
+	return price, reviewBy.Add(24 * time.Hour), nil
+}
+
+// ValidateFixedPrice checks the fixed price of a token
+func ValidateFixedPrice(token *TokenConfig) error {
+	if !token.HasFixedPrice() {
+		if token.FixedPriceReviewBy != "" {
+			return fmt.Errorf("fixedPriceReviewBy requires fixedPriceUsd")
+		}
+		return nil
+	}
+	if token.PriceFeedAddress.IsSet() {
+		return fmt.Errorf("fixedPriceUsd and priceFeedAddress are exclusive")
+	}
+	_, _, err := fixedPrice(token)
+	return err
+}
+
+// FixedPriceData returns the fixed price of a token as a feed answer updated
+// now. It fails once the review date has passed.
+func FixedPriceData(token *TokenConfig, now time.Time) (*PriceData, error) {
+	price, expiresAt, err := fixedPrice(token)
+	if err != nil {
+		return nil, err
+	}
+	if !now.Before(expiresAt) {
+		return nil, fmt.Errorf("%w: %s reviewed by %s", ErrFixedPriceExpired, token.Symbol, token.FixedPriceReviewBy)
+	}
+	return &PriceData{Answer: price, Decimals: fixedpoint.USDDecimals, UpdatedAt: now}, nil
+}
+
+// CheckFixedPrices alerts on fixed prices whose review date is near or past
+func CheckFixedPrices(config *Config, runtime cre.Runtime) {
+	now := runtime.Now()
+	for i := range config.Tokens {
+		token := &config.Tokens[i]
+		if !token.HasFixedPrice() {
+			continue
+		}
+		_, expiresAt, err := fixedPrice(token)
+		if err != nil {
+			continue
+		}
+		switch {
+		case !now.Before(expiresAt):
+			RaiseAlert(config, runtime, slog.LevelError, "ALERT: fixed price expired", token.Symbol, "symbol", token.Symbol,
+				"price", token.FixedPriceUSD, "reviewBy", token.FixedPriceReviewBy)
+		case expiresAt.Sub(now) <= fixedPriceReviewNotice:
+			RaiseAlert(config, runtime, slog.LevelWarn, "ALERT: fixed price review due", token.Symbol, "symbol", token.Symbol,
+				"price", token.FixedPriceUSD, "reviewBy", token.FixedPriceReviewBy)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+//go:build wasip1
+
+package main
+
+import (
+	"fmt"
+	"math/big"
+
+	"safe-update-go/fixedpoint"
+)
+
+// FormatConfig represents how USD amounts are rendered in reports and alerts.
+// Locale selects the separators and symbol placement; the other fields override it.
+type FormatConfig struct {
+	Locale             string  `json:"locale,omitempty"`
+	CurrencySymbol     *string `json:"currencySymbol,omitempty"`
+	ThousandsSeparator *string `json:"thousandsSeparator,omitempty"`
+	DecimalSeparator   *string `json:"decimalSeparator,omitempty"`
+	FractionDigits     *int    `json:"fractionDigits,omitempty"`
+	SignificantDigits  int     `json:"significantDigits,omitempty"`
+}
+
+// defaultLocale is used when formatting is configured without a locale
+const defaultLocale = "en-US"
+
+// ValidateFormat checks the formatting configuration
+func ValidateFormat(format *FormatConfig) error {
+	if format == nil {
+		return nil
+	}
+	if _, err := usdFormat(format); err != nil {
+		return err
+	}
+	if format.FractionDigits != nil && (*format.FractionDigits < 0 || *format.FractionDigits > int(fixedpoint.USDDecimals)) {
+		return fmt.Errorf("fractionDigits must be between 0 and %d", fixedpoint.USDDecimals)
+	}
+	if format.SignificantDigits < 0 {
+		return fmt.Errorf("significantDigits must not be negative")
+	}
+	return nil
+}
+
+// usdFormat resolves the configured locale and overrides
+func usdFormat(format *FormatConfig) (fixedpoint.Format, error) {
+	locale := format.Locale
+	if locale == "" {
+		locale = defaultLocale
+	}
+	f, err := fixedpoint.LocaleFormat(locale)
+	if err != nil {
+		return fixedpoint.Format{}, err
+	}
+	if format.CurrencySymbol != nil {
+		f.Symbol = *format.CurrencySymbol
+	}
+	if format.ThousandsSeparator != nil {
+		f.ThousandsSeparator = *format.ThousandsSeparator
+	}
+	if format.DecimalSeparator != nil {
+		f.DecimalSeparator = *format.DecimalSeparator
+	}
+	if format.FractionDigits != nil {
+		f.FractionDigits = *format.FractionDigits
+	}
+	f.SignificantDigits = format.SignificantDigits
+	return f, nil
+}
+
+// FormatUSD renders an 18 decimal USD value for humans. Without formatting
+// configured the raw integer is returned.
+func FormatUSD(config *Config, value *big.Int) string {
+	if config.Formatting == nil {
+		return value.String()
+	}
+	f, err := usdFormat(config.Formatting)
+	if err != nil {
+		return value.String()
+	}
+	return fixedpoint.FormatDecimal(value, fixedpoint.USDDecimals, f)
+}
@@ -0,0 +1,84 @@
+//go:build wasip1
+
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/blockchain/evm"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+
+	"safe-update-go/fixedpoint"
+)
+
+// GasScheduleConfig represents the gas-aware scheduling of non-urgent
+// submissions. Batched updates, and dead letter retries with retries, are
+// held while the base fee is above maxBaseFeeGwei, until they have waited
+// maxDelaySeconds since they were queued. The base fee is read from a
+// Chainlink gas price feed answering in wei.
+type GasScheduleConfig struct {
+	MaxBaseFeeGwei  uint64  `json:"maxBaseFeeGwei"`
+	MaxDelaySeconds uint64  `json:"maxDelaySeconds"`
+	Retries         bool    `json:"retries,omitempty"`
+	GasPriceFeed    Address `json:"gasPriceFeed"`
+}
+
+// ValidateGasSchedule checks the gas schedule configuration
+func ValidateGasSchedule(schedule *GasScheduleConfig) error {
+	if schedule == nil {
+		return nil
+	}
+	if schedule.MaxBaseFeeGwei == 0 || schedule.MaxDelaySeconds == 0 {
+		return fmt.Errorf("maxBaseFeeGwei and maxDelaySeconds are required")
+	}
+	// A call reads the block with a zero base fee, so the fee comes from a feed
+	if !schedule.GasPriceFeed.IsSet() {
+		return fmt.Errorf("gasPriceFeed is required")
+	}
+	return nil
+}
+
+// GasWindow represents the gas price seen by one run of a handler submitting
+// non-urgent updates
+type GasWindow struct {
+	BaseFee   *big.Int
+	Max       *big.Int
+	Expensive bool
+}
+
+// ReadGasWindow reads the current base fee when gas scheduling is configured.
+// Without a schedule, or when the base fee cannot be read, it returns nil and
+// updates are submitted right away.
+func ReadGasWindow(config *Config, runtime cre.Runtime, evmClient *evm.Client) *GasWindow {
+	schedule := config.GasSchedule
+	if schedule == nil {
+		return nil
+	}
+
+	priceData, err := GetPriceFromFeed(runtime, evmClient, schedule.GasPriceFeed.Address)
+	if err != nil {
+		runtime.Logger().Warn("Failed to read base fee, submitting without waiting", "error", err.Error())
+		return nil
+	}
+	baseFee := priceData.Answer
+
+	maxFee := fixedpoint.FromWhole(schedule.MaxBaseFeeGwei, 9)
+	return &GasWindow{BaseFee: baseFee, Max: maxFee, Expensive: baseFee.Cmp(maxFee) > 0}
+}
+
+// Defers reports whether an update queued at queuedAt waits for a lower base
+// fee, which it does while gas is expensive and it was queued less than
+// maxDelaySeconds ago. Updates of unknown age are never held.
+func (w *GasWindow) Defers(schedule *GasScheduleConfig, queuedAt time.Time, now time.Time) bool {
+	if w == nil || !w.Expensive || queuedAt.IsZero() {
+		return false
+	}
+	return now.Sub(queuedAt) < seconds(schedule.MaxDelaySeconds)
+}
+
+// Gwei formats the base fee in gwei for logs and results
+func (w *GasWindow) Gwei() string {
+	return fixedpoint.FormatDecimal(w.BaseFee, 9, fixedpoint.Format{DecimalSeparator: ".", FractionDigits: 2})
+}
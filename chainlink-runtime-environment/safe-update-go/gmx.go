@@ -0,0 +1,200 @@
+//go:build wasip1
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/blockchain/evm"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+)
+
+// GMX v2 ExchangeRouter and DataStore ABI (dataStore, getAddress)
+const gmxDataStoreABI = `[
+	{"constant":true,"inputs":[],"name":"dataStore","outputs":[{"name":"","type":"address"}],"type":"function"},
+	{"constant":true,"inputs":[{"name":"key","type":"bytes32"}],"name":"getAddress","outputs":[{"name":"","type":"address"}],"type":"function"}
+]`
+
+// RemoveLiquidity(address account, address token, uint256 glpAmount, uint256 aumInUsdg, uint256 glpSupply, uint256 usdgAmount, uint256 amountOut),
+// emitted by the GMX GlpManager
+var gmxRemoveLiquiditySignature = crypto.Keccak256Hash([]byte("RemoveLiquidity(address,address,uint256,uint256,uint256,uint256,uint256)"))
+
+// callGMXAddress calls a GMX view function returning an address
+func callGMXAddress(runtime cre.Runtime, evmClient *evm.Client, contract common.Address, method string, args ...interface{}) (common.Address, error) {
+	parsedGMXABI, err := abi.JSON(strings.NewReader(gmxDataStoreABI))
+	if err != nil {
+		return common.Address{}, fmt.Errorf("failed to parse GMX ABI: %w", err)
+	}
+
+	callData, err := parsedGMXABI.Pack(method, args...)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("failed to pack %s call: %w", method, err)
+	}
+
+	result, err := evmClient.CallContract(runtime, &evm.CallContractRequest{
+		Call: &evm.CallMsg{
+			To:   contract.Bytes(),
+			Data: callData,
+		},
+	}).Await()
+	if err != nil {
+		return common.Address{}, fmt.Errorf("failed to call %s on %s: %w", method, contract.Hex(), err)
+	}
+
+	var address common.Address
+	if err := parsedGMXABI.UnpackIntoInterface(&address, method, result.Data); err != nil {
+		return common.Address{}, fmt.Errorf("failed to unpack %s: %w", method, err)
+	}
+	return address, nil
+}
+
+// gmxMarketKey returns the DataStore key of a market property, as computed by
+// MarketStoreUtils: keccak256(abi.encode(market, keccak256(abi.encode(name))))
+func gmxMarketKey(market common.Address, name string) [32]byte {
+	encodedName := append(common.LeftPadBytes(big.NewInt(32).Bytes(), 32), common.LeftPadBytes(big.NewInt(int64(len(name))).Bytes(), 32)...)
+	encodedName = append(encodedName, common.RightPadBytes([]byte(name), (len(name)+31)/32*32)...)
+	return [32]byte(crypto.Keccak256Hash(common.LeftPadBytes(market.Bytes(), 32), crypto.Keccak256(encodedName)))
+}
+
+// GMXMarketTokens returns the long and short tokens of a GMX v2 market, from
+// the cache or from the DataStore of the ExchangeRouter
+func GMXMarketTokens(runtime cre.Runtime, evmClient *evm.Client, router common.Address, market common.Address) (common.Address, common.Address, error) {
+	longKey, shortKey := market.Hex()+":long", market.Hex()+":short"
+	if longToken, ok := state.VaultAssets[longKey]; ok {
+		if shortToken, ok := state.VaultAssets[shortKey]; ok {
+			return longToken, shortToken, nil
+		}
+	}
+
+	dataStore, err := callGMXAddress(runtime, evmClient, router, "dataStore")
+	if err != nil {
+		return common.Address{}, common.Address{}, err
+	}
+	longToken, err := callGMXAddress(runtime, evmClient, dataStore, "getAddress", gmxMarketKey(market, "LONG_TOKEN"))
+	if err != nil {
+		return common.Address{}, common.Address{}, err
+	}
+	shortToken, err := callGMXAddress(runtime, evmClient, dataStore, "getAddress", gmxMarketKey(market, "SHORT_TOKEN"))
+	if err != nil {
+		return common.Address{}, common.Address{}, err
+	}
+	if longToken == (common.Address{}) || shortToken == (common.Address{}) {
+		return common.Address{}, common.Address{}, fmt.Errorf("%s is not a GMX market", market.Hex())
+	}
+
+	state.VaultAssets[longKey] = longToken
+	state.VaultAssets[shortKey] = shortToken
+	return longToken, shortToken, nil
+}
+
+// ResolveGMXWithdrawal settles GMX redemptions:
+//   - a GLP redemption credits the amountOut of the GlpManager's
+//     RemoveLiquidity event for the redeemed GLP amount, in the event's token.
+//     unstakeAndRedeemGlpETH is paid out as ETH and credited as WETH.
+//   - a v2 withdrawal order credits nothing when it is created. It is tracked
+//     by the key of the EventEmitter's WithdrawalCreated event for the Safe,
+//     with the market's tokens, until a keeper executes or cancels it. Orders
+//     swapping or unwrapping their outputs are not supported.
+func ResolveGMXWithdrawal(runtime cre.Runtime, evmClient *evm.Client, logger *slog.Logger, action *Action, calldata []byte, txHash []byte) error {
+	switch action.Selector {
+	case GMXRemoveLiquiditySelector, GMXUnstakeAndRedeemGlpSelector, GMXUnstakeAndRedeemGlpETHSelector:
+		return resolveGMXRedeemGlp(runtime, evmClient, logger, action, calldata, txHash)
+	}
+
+	calls := [][]byte{calldata}
+	if action.Selector == UniswapV3MulticallSelector {
+		var err error
+		if calls, err = unpackMulticall(calldata); err != nil {
+			return err
+		}
+	}
+	params, err := decodeGMXWithdrawalParams(gmxWithdrawalCall(calls))
+	if err != nil {
+		return err
+	}
+	if len(params.LongTokenSwapPath) > 0 || len(params.ShortTokenSwapPath) > 0 {
+		return fmt.Errorf("GMX withdrawal from %s swaps its outputs, which is not supported", params.Market.Hex())
+	}
+	// Native ETH is paid to the receiver without a transfer the allowances track
+	if params.ShouldUnwrapNativeToken {
+		return fmt.Errorf("GMX withdrawal from %s unwraps its outputs to native ETH, which cannot be valued", params.Market.Hex())
+	}
+
+	longToken, shortToken, err := GMXMarketTokens(runtime, evmClient, action.Counterparty, params.Market)
+	if err != nil {
+		return err
+	}
+
+	reply, err := evmClient.GetTransactionReceipt(runtime, &evm.GetTransactionReceiptRequest{Hash: txHash}).Await()
+	if err != nil {
+		return fmt.Errorf("failed to get transaction receipt: %w", err)
+	}
+	if reply.Receipt == nil {
+		return fmt.Errorf("transaction receipt not found")
+	}
+	for _, log := range reply.Receipt.Logs {
+		if !isGMXWithdrawalEvent(log, gmxWithdrawalCreated) || common.BytesToAddress(log.Topics[3]) != action.Avatar {
+			continue
+		}
+		action.GMXWithdrawal = &PendingGMXWithdrawal{
+			Key:          common.BytesToHash(log.Topics[2]).Hex(),
+			EventEmitter: common.BytesToAddress(log.Address),
+			Router:       action.Counterparty,
+			Market:       params.Market,
+			LongToken:    longToken,
+			ShortToken:   shortToken,
+			Receiver:     params.Receiver,
+		}
+		logger.Info("GMX v2 withdrawal order created", "key", action.GMXWithdrawal.Key, "market", params.Market.Hex(),
+			"longToken", longToken.Hex(), "shortToken", shortToken.Hex())
+		return nil
+	}
+	return fmt.Errorf("no WithdrawalCreated for %s in receipt", action.Avatar.Hex())
+}
+
+// resolveGMXRedeemGlp credits the token a GLP redemption paid out
+func resolveGMXRedeemGlp(runtime cre.Runtime, evmClient *evm.Client, logger *slog.Logger, action *Action, calldata []byte, txHash []byte) error {
+	var tokenOut common.Address
+	glpIndex := 0
+	if action.Selector != GMXUnstakeAndRedeemGlpETHSelector {
+		var err error
+		if tokenOut, err = calldataAddress(calldata, 0); err != nil {
+			return err
+		}
+		glpIndex = 1
+	}
+	glpAmount, err := calldataUint(calldata, glpIndex)
+	if err != nil {
+		return err
+	}
+
+	reply, err := evmClient.GetTransactionReceipt(runtime, &evm.GetTransactionReceiptRequest{Hash: txHash}).Await()
+	if err != nil {
+		return fmt.Errorf("failed to get transaction receipt: %w", err)
+	}
+	if reply.Receipt == nil {
+		return fmt.Errorf("transaction receipt not found")
+	}
+
+	for _, log := range reply.Receipt.Logs {
+		if len(log.Topics) != 1 || len(log.Data) < 7*32 || !bytes.Equal(log.Topics[0], gmxRemoveLiquiditySignature.Bytes()) {
+			continue
+		}
+		token := common.BytesToAddress(log.Data[32:64])
+		if new(big.Int).SetBytes(log.Data[64:96]).Cmp(glpAmount) != 0 || (tokenOut != (common.Address{}) && token != tokenOut) {
+			continue
+		}
+		amountOut := new(big.Int).SetBytes(log.Data[192:224])
+		action.AssetsIn = append(action.AssetsIn, AssetAmount{Token: token, Amount: amountOut})
+		logger.Info("GMX GLP redeemed", "token", token.Hex(), "glpAmount", glpAmount.String(), "amountOut", amountOut.String())
+		return nil
+	}
+	return fmt.Errorf("no RemoveLiquidity of %s GLP in receipt", glpAmount)
+}
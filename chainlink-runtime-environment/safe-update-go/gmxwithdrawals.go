@@ -0,0 +1,213 @@
+//go:build wasip1
+
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/blockchain/evm"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+)
+
+// EventLog2(address msgSender, string eventName, string indexed eventNameHash, bytes32 indexed topic1, bytes32 indexed topic2, EventLogData eventData),
+// emitted by the GMX v2 EventEmitter. Withdrawal events carry the withdrawal
+// key in topic1 and the account in topic2.
+var gmxEventLog2Signature = crypto.Keccak256Hash([]byte("EventLog2(address,string,string,bytes32,bytes32," +
+	"(((string,address)[],(string,address[])[]),((string,uint256)[],(string,uint256[])[]),((string,int256)[],(string,int256[])[])," +
+	"((string,bool)[],(string,bool[])[]),((string,bytes32)[],(string,bytes32[])[]),((string,bytes)[],(string,bytes[])[]),((string,string)[],(string,string[])[])))"))
+
+// GMX v2 withdrawal event names, indexed by their hash
+var (
+	gmxWithdrawalCreated   = crypto.Keccak256Hash([]byte("WithdrawalCreated"))
+	gmxWithdrawalExecuted  = crypto.Keccak256Hash([]byte("WithdrawalExecuted"))
+	gmxWithdrawalCancelled = crypto.Keccak256Hash([]byte("WithdrawalCancelled"))
+)
+
+// GMXConfig represents the settlement of GMX v2 withdrawal orders created by
+// a subaccount. Keepers execute or cancel them in their own transactions, so
+// the EventEmitter's withdrawal events of the listed accounts, the Safes, are
+// watched for the orders the workflow saw created.
+type GMXConfig struct {
+	EventEmitter Address   `json:"eventEmitter"`
+	Accounts     []Address `json:"accounts"`
+}
+
+// PendingGMXWithdrawal represents a GMX v2 withdrawal order created by a
+// subaccount and not yet executed or cancelled by a keeper
+type PendingGMXWithdrawal struct {
+	Key          string
+	EventEmitter common.Address
+	Router       common.Address
+	Market       common.Address
+	LongToken    common.Address
+	ShortToken   common.Address
+	Receiver     common.Address
+	SubAccount   string
+	CreatedAt    time.Time
+}
+
+// ValidateGMX checks the GMX configuration
+func ValidateGMX(gmx *GMXConfig) error {
+	if gmx == nil {
+		return nil
+	}
+	if !gmx.EventEmitter.IsSet() {
+		return fmt.Errorf("eventEmitter is required")
+	}
+	if len(gmx.Accounts) == 0 {
+		return fmt.Errorf("accounts is required")
+	}
+	return nil
+}
+
+// CheckGMXWithdrawal checks that the withdrawal order of an action will be
+// settled: its execution is only seen for the configured EventEmitter and
+// accounts
+func CheckGMXWithdrawal(config *Config, action *Action) error {
+	withdrawal := action.GMXWithdrawal
+	if config.GMX == nil {
+		return fmt.Errorf("GMX withdrawal order %s cannot be settled without gmx configured", withdrawal.Key)
+	}
+	if withdrawal.EventEmitter != config.GMX.EventEmitter.Address {
+		return fmt.Errorf("GMX withdrawal order %s emitted by %s, not the configured EventEmitter", withdrawal.Key, withdrawal.EventEmitter.Hex())
+	}
+	for _, account := range config.GMX.Accounts {
+		if account.Address == action.Avatar {
+			return nil
+		}
+	}
+	return fmt.Errorf("GMX withdrawal order %s of %s, which is not a configured account", withdrawal.Key, action.Avatar.Hex())
+}
+
+// isGMXWithdrawalEvent reports whether a log is an EventLog2 withdrawal event with the given name hash
+func isGMXWithdrawalEvent(log *evm.Log, name common.Hash) bool {
+	return len(log.Topics) == 4 && bytes.Equal(log.Topics[0], gmxEventLog2Signature.Bytes()) && bytes.Equal(log.Topics[1], name.Bytes())
+}
+
+// TrackGMXWithdrawal records the withdrawal order created by a subaccount
+func (s *WorkflowState) TrackGMXWithdrawal(subAccount string, withdrawal *PendingGMXWithdrawal, now time.Time) {
+	tracked := *withdrawal
+	tracked.SubAccount = subAccount
+	tracked.CreatedAt = now
+	s.GMXWithdrawals[withdrawal.Key] = &tracked
+}
+
+// OnGMXWithdrawalEvent is the handler for the EventEmitter's withdrawal
+// events. The execution of an order created by a subaccount is accounted as
+// a withdrawal of that subaccount: the long and short tokens the market
+// transferred to the order's receiver in the keeper's transaction are
+// credited. A cancelled order returns the GM tokens and is forgotten.
+// Events of other orders are ignored.
+func OnGMXWithdrawalEvent(config *Config, runtime cre.Runtime, payload *evm.Log) (*ExecutionResult, error) {
+	logger := runtime.Logger()
+
+	emitter := common.BytesToAddress(payload.Address)
+	if emitter != config.GMX.EventEmitter.Address {
+		return nil, fmt.Errorf("%w: %s is not the GMX EventEmitter", ErrUnknownEmitter, emitter.Hex())
+	}
+	if len(payload.Topics) != 4 {
+		return nil, fmt.Errorf("invalid EventLog2 log format")
+	}
+
+	key := common.BytesToHash(payload.Topics[2]).Hex()
+	withdrawal := state.GMXWithdrawals[key]
+	if withdrawal == nil || withdrawal.EventEmitter != emitter {
+		logger.Info("Withdrawal event of an order not created by a subaccount", "key", key)
+		return &ExecutionResult{Message: "Not a pending withdrawal", Success: true}, nil
+	}
+	subAccount := common.HexToAddress(withdrawal.SubAccount)
+
+	if isGMXWithdrawalEvent(payload, gmxWithdrawalCancelled) {
+		delete(state.GMXWithdrawals, key)
+		logger.Info("GMX v2 withdrawal order cancelled", "key", key, "subAccount", subAccount.Hex())
+		return &ExecutionResult{Message: "Withdrawal cancelled", Success: true}, nil
+	}
+	if !isGMXWithdrawalEvent(payload, gmxWithdrawalExecuted) {
+		return &ExecutionResult{Message: "Not a withdrawal settlement", Success: true}, nil
+	}
+
+	if !OwnsSubaccount(config, subAccount) {
+		return &ExecutionResult{Message: "Subaccount not in shard", Success: true}, nil
+	}
+	if state.IsSubaccountHalted(subAccount) {
+		logger.Warn("Subaccount halted, skipping withdrawal", "subAccount", subAccount.Hex(), "reason", state.HaltedSubaccounts[subAccount.Hex()].Reason)
+		return &ExecutionResult{Message: "Subaccount halted", Success: true}, nil
+	}
+
+	eventID := eventKey("0x"+hex.EncodeToString(payload.TxHash), payload.Index)
+	if state.HasProcessed(eventID) {
+		logger.Info("Event already processed, skipping", "event", eventID)
+		return &ExecutionResult{Message: "Duplicate event", Success: true}, nil
+	}
+
+	evmClient := newEVMClient(config)
+	reply, err := evmClient.GetTransactionReceipt(runtime, &evm.GetTransactionReceiptRequest{Hash: payload.TxHash}).Await()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transaction receipt: %w", err)
+	}
+	if reply.Receipt == nil {
+		return nil, fmt.Errorf("transaction receipt not found")
+	}
+
+	action := &Action{
+		Protocol:     gmxProtocol,
+		Verb:         VerbWithdraw,
+		Counterparty: withdrawal.Router,
+		Recipient:    withdrawal.Receiver,
+		Confidence:   ConfidenceExactABI,
+	}
+	for _, token := range []common.Address{withdrawal.LongToken, withdrawal.ShortToken} {
+		amount := poolTransfers(reply.Receipt.Logs, token, withdrawal.Market, withdrawal.Receiver)
+		if amount.Sign() > 0 {
+			action.AssetsIn = append(action.AssetsIn, AssetAmount{Token: token, Amount: amount})
+		}
+		// Single token markets pay both sides in the same token
+		if withdrawal.LongToken == withdrawal.ShortToken {
+			break
+		}
+	}
+
+	logger.Info("GMX v2 withdrawal executed", "key", key, "subAccount", subAccount.Hex(), "market", withdrawal.Market.Hex(),
+		"assetsIn", len(action.AssetsIn))
+
+	// The withdrawal was executed when the keeper's transaction was mined
+	eventTime, err := LogBlockTime(runtime, evmClient, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := processAction(config, runtime, evmClient, logger, ActionEvent{
+		SubAccount: subAccount,
+		Target:     withdrawal.Router,
+		EventID:    eventID,
+		EventTime:  eventTime,
+		Log:        payload,
+	}, action)
+	if err == nil {
+		delete(state.GMXWithdrawals, key)
+	}
+	return result, err
+}
+
+// gmxWithdrawalTrigger creates the log trigger of the withdrawal executions
+// and cancellations of the configured accounts
+func gmxWithdrawalTrigger(config *Config) cre.Trigger[*evm.Log, *evm.Log] {
+	accounts := make([][]byte, 0, len(config.GMX.Accounts))
+	for _, account := range config.GMX.Accounts {
+		accounts = append(accounts, common.LeftPadBytes(account.Bytes(), 32))
+	}
+	return evm.LogTrigger(config.ChainSelector.Uint64(), &evm.FilterLogTriggerRequest{
+		Addresses: [][]byte{config.GMX.EventEmitter.Bytes()},
+		Topics: []*evm.TopicValues{
+			{Values: [][]byte{gmxEventLog2Signature.Bytes()}},
+			{Values: [][]byte{gmxWithdrawalExecuted.Bytes(), gmxWithdrawalCancelled.Bytes()}},
+			{Values: [][]byte{}}, // key (any)
+			{Values: accounts},
+		},
+	})
+}
@@ -0,0 +1,163 @@
+//go:build wasip1
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+)
+
+// Flow directions of group exposure limits
+const (
+	FlowInflow  = "inflow"
+	FlowOutflow = "outflow"
+)
+
+// GroupFlow represents the USD value of a token group that moved into and out
+// of the Safe. Both values are positive.
+type GroupFlow struct {
+	InflowUSD  *big.Int
+	OutflowUSD *big.Int
+}
+
+// GroupSummary represents the aggregated flows of one token group
+type GroupSummary struct {
+	Group      string `json:"group"`
+	InflowUSD  string `json:"inflowUsd"`
+	OutflowUSD string `json:"outflowUsd"`
+	NetUSD     string `json:"netUsd"`
+	Count      int    `json:"count"`
+}
+
+// groupFlowsParams represents the parameters of the groupFlows admin method
+type groupFlowsParams struct {
+	Since      int64  `json:"since,omitempty"`
+	SubAccount string `json:"subAccount,omitempty"`
+}
+
+func init() {
+	RegisterAdminMethod("groupFlows", adminGroupFlows)
+}
+
+// hasTokenGroup reports whether a configured token belongs to a group
+func hasTokenGroup(tokens []TokenConfig, group string) bool {
+	for _, token := range tokens {
+		if token.Group == group {
+			return true
+		}
+	}
+	return false
+}
+
+// value returns the gross value of the flow, or only its inflow or outflow
+func (f GroupFlow) value(flow string) *big.Int {
+	switch flow {
+	case FlowInflow:
+		return new(big.Int).Set(f.InflowUSD)
+	case FlowOutflow:
+		return new(big.Int).Set(f.OutflowUSD)
+	default:
+		return new(big.Int).Add(f.InflowUSD, f.OutflowUSD)
+	}
+}
+
+// GroupFlows returns the inflow and outflow of every token group moved by the
+// action. Tokens without a group are left out.
+func (a *ActionAccounting) GroupFlows() map[string]GroupFlow {
+	flows := make(map[string]GroupFlow)
+	for _, delta := range a.Deltas {
+		if delta.Group == "" {
+			continue
+		}
+		flow, ok := flows[delta.Group]
+		if !ok {
+			flow = GroupFlow{InflowUSD: new(big.Int), OutflowUSD: new(big.Int)}
+			flows[delta.Group] = flow
+		}
+		if delta.USDValue.Sign() >= 0 {
+			flow.InflowUSD.Add(flow.InflowUSD, delta.USDValue)
+		} else {
+			flow.OutflowUSD.Sub(flow.OutflowUSD, delta.USDValue)
+		}
+	}
+	return flows
+}
+
+// GroupExposureSince returns the value of a token group moved since a point in
+// time by actions matching protocol and verb, in one direction or both.
+// Empty filters match everything.
+func (s *WorkflowState) GroupExposureSince(protocol string, verb Verb, group string, flow string, since time.Time) *big.Int {
+	total := new(big.Int)
+	for _, entry := range s.Ledger {
+		if entry.At.Before(since) {
+			continue
+		}
+		if protocol != "" && !strings.EqualFold(entry.Protocol, protocol) {
+			continue
+		}
+		if verb != "" && entry.Verb != verb {
+			continue
+		}
+		if groupFlow, ok := entry.Groups[group]; ok {
+			total.Add(total, groupFlow.value(flow))
+		}
+	}
+	return total
+}
+
+// GroupFlowSummaries aggregates the group flows of the ledger since a point in
+// time, for every subaccount or only one
+func GroupFlowSummaries(config *Config, s *WorkflowState, subAccount string, since time.Time) []GroupSummary {
+	inflows := make(map[string]*big.Int)
+	outflows := make(map[string]*big.Int)
+	counts := make(map[string]int)
+	for _, entry := range s.Ledger {
+		if entry.At.Before(since) || (subAccount != "" && !strings.EqualFold(entry.SubAccount, subAccount)) {
+			continue
+		}
+		for group, flow := range entry.Groups {
+			if _, ok := inflows[group]; !ok {
+				inflows[group], outflows[group] = new(big.Int), new(big.Int)
+			}
+			inflows[group].Add(inflows[group], flow.InflowUSD)
+			outflows[group].Add(outflows[group], flow.OutflowUSD)
+			counts[group]++
+		}
+	}
+
+	groups := make([]string, 0, len(inflows))
+	for group := range inflows {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+
+	summaries := make([]GroupSummary, len(groups))
+	for i, group := range groups {
+		summaries[i] = GroupSummary{
+			Group:      group,
+			InflowUSD:  FormatUSD(config, inflows[group]),
+			OutflowUSD: FormatUSD(config, outflows[group]),
+			NetUSD:     FormatUSD(config, new(big.Int).Sub(inflows[group], outflows[group])),
+			Count:      counts[group],
+		}
+	}
+	return summaries
+}
+
+// adminGroupFlows reports the inflow, outflow and net value of each token group
+func adminGroupFlows(config *Config, runtime cre.Runtime, caller common.Address, params json.RawMessage) (interface{}, error) {
+	var p groupFlowsParams
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, fmt.Errorf("invalid params: %w", err)
+		}
+	}
+	return GroupFlowSummaries(config, state, p.SubAccount, time.Unix(p.Since, 0)), nil
+}
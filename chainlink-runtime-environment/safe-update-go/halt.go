@@ -0,0 +1,148 @@
+//go:build wasip1
+
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+)
+
+// HaltConfig represents when a subaccount's processing is halted
+type HaltConfig struct {
+	MaxConsecutiveFailures int  `json:"maxConsecutiveFailures"`
+	ProposeRevoke          bool `json:"proposeRevoke,omitempty"`
+}
+
+// HaltedSubaccount represents a subaccount whose events are no longer processed
+type HaltedSubaccount struct {
+	Reason     string
+	OwnerCalls []OwnerCall
+}
+
+// unhaltParams represents the parameters of the unhalt admin method
+type unhaltParams struct {
+	SubAccount common.Address `json:"subAccount"`
+	Note       string         `json:"note,omitempty"`
+}
+
+func init() {
+	RegisterAdminMethod("unhalt", adminUnhalt)
+}
+
+// IsSubaccountHalted reports whether processing is halted for a subaccount
+func (s *WorkflowState) IsSubaccountHalted(subAccount common.Address) bool {
+	_, halted := s.HaltedSubaccounts[subAccount.Hex()]
+	return halted
+}
+
+// ResetSubaccountFailures clears the consecutive failure count of a subaccount
+func (s *WorkflowState) ResetSubaccountFailures(subAccount common.Address) {
+	delete(s.SubaccountFailures, subAccount.Hex())
+}
+
+// Unhalt resumes processing for a subaccount, its failure count starting over
+func (s *WorkflowState) Unhalt(subAccount common.Address) {
+	delete(s.HaltedSubaccounts, subAccount.Hex())
+	s.ResetSubaccountFailures(subAccount)
+}
+
+// RecordSubaccountFailure counts an undecodable or policy-violating transaction
+// and halts the subaccount once the configured limit is exceeded. It returns
+// whether the subaccount is halted.
+func RecordSubaccountFailure(config *Config, runtime cre.Runtime, subAccount common.Address, reason string) bool {
+	if config.Halt == nil || config.Halt.MaxConsecutiveFailures <= 0 {
+		return false
+	}
+
+	logger := runtime.Logger()
+	key := subAccount.Hex()
+	state.SubaccountFailures[key]++
+	failures := state.SubaccountFailures[key]
+	if failures <= config.Halt.MaxConsecutiveFailures {
+		logger.Warn("Subaccount failure recorded", "subAccount", key, "consecutive", failures, "reason", reason)
+		return false
+	}
+
+	halted := HaltedSubaccount{
+		Reason: fmt.Sprintf("%d consecutive failures, last: %s", failures, reason),
+	}
+
+	if config.Halt.ProposeRevoke {
+		calls, err := revokeRoleCalls(config, subAccount)
+		if err != nil {
+			logger.Error("Failed to build revoke calls", "subAccount", key, "error", err.Error())
+		} else {
+			halted.OwnerCalls = calls
+		}
+	}
+
+	state.HaltedSubaccounts[key] = halted
+	logger.Error("PAGE: subaccount halted", "subAccount", key, "reason", halted.Reason)
+	RouteAlert(config, runtime, newAlert(slog.LevelError, "PAGE: subaccount halted", key, runtime.Now(), "subAccount", key, "reason", halted.Reason))
+
+	if len(halted.OwnerCalls) > 0 {
+		batch, err := json.Marshal(halted.OwnerCalls)
+		if err == nil {
+			logger.Info("Owner calls proposed to revoke subaccount", "subAccount", key, "calls", string(batch))
+		}
+	}
+
+	return true
+}
+
+// adminUnhalt lifts the halt of a subaccount once its transactions were
+// looked into. Events skipped while it was halted are not processed again.
+func adminUnhalt(config *Config, runtime cre.Runtime, caller common.Address, params json.RawMessage) (interface{}, error) {
+	var p unhaltParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, fmt.Errorf("invalid params: %w", err)
+	}
+	halted, ok := state.HaltedSubaccounts[p.SubAccount.Hex()]
+	if !ok {
+		return nil, fmt.Errorf("subaccount %s is not halted", p.SubAccount.Hex())
+	}
+
+	state.Unhalt(p.SubAccount)
+	RecordAudit(config, runtime, AuditRecord{
+		SubAccount: p.SubAccount.Hex(),
+		Outcome:    "unhalted",
+		Operator:   caller.Hex(),
+		Note:       p.Note,
+		Timestamp:  runtime.Now().Unix(),
+	})
+
+	runtime.Logger().Info("Subaccount unhalted", "subAccount", p.SubAccount.Hex(), "haltReason", halted.Reason, "author", caller.Hex())
+	return map[string]string{"subAccount": p.SubAccount.Hex(), "unhalted": halted.Reason}, nil
+}
+
+// revokeRoleCalls builds the owner calls removing a subaccount's module roles.
+// The module has no removeSubAccount and revokeRole is owner-only, so the
+// calls are proposed to the Safe rather than submitted by the workflow.
+func revokeRoleCalls(config *Config, subAccount common.Address) ([]OwnerCall, error) {
+	parsedModuleABI, err := abi.JSON(strings.NewReader(moduleABI))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse module ABI: %w", err)
+	}
+
+	module := ActiveTarget(config).ModuleAddress.Address
+	var calls []OwnerCall
+	for _, roleID := range []uint16{DefiExecuteRole, DefiTransferRole} {
+		data, err := parsedModuleABI.Pack("revokeRole", subAccount, roleID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to pack revokeRole: %w", err)
+		}
+		calls = append(calls, OwnerCall{
+			To:          module.Hex(),
+			Data:        "0x" + hex.EncodeToString(data),
+			Description: fmt.Sprintf("revokeRole(%s, %d)", subAccount.Hex(), roleID),
+		})
+	}
+	return calls, nil
+}
@@ -0,0 +1,100 @@
+//go:build wasip1
+
+package main
+
+import (
+	"testing"
+
+	"github.com/smartcontractkit/cre-sdk-go/cre/testutils"
+
+	"safe-update-go/scenarios"
+)
+
+// TestHaltAcrossInstances records each failure in a fresh instance, as every
+// CRE trigger runs in its own, so the count only reaches the limit through the store
+func TestHaltAcrossInstances(t *testing.T) {
+	const maxFailures = 3
+	config := scenarioConfig(t, "{}")
+	config.Halt = &HaltConfig{MaxConsecutiveFailures: maxFailures}
+	runtime := testutils.NewRuntime(t, nil)
+	store := mapStore{}
+
+	newInstance := func() {
+		t.Helper()
+		state = NewWorkflowState()
+		state.Store = store
+		if err := LoadState(config, runtime); err != nil {
+			t.Fatalf("load state: %v", err)
+		}
+	}
+
+	for i := 1; i <= maxFailures+1; i++ {
+		newInstance()
+		if state.IsSubaccountHalted(scenarios.SubAccount) {
+			t.Fatalf("halted before failure %d", i)
+		}
+		halted := RecordSubaccountFailure(config, runtime, scenarios.SubAccount, "undecodable")
+		if halted != (i == maxFailures+1) {
+			t.Fatalf("failure %d: halted %v", i, halted)
+		}
+		if err := PersistState(config, runtime); err != nil {
+			t.Fatalf("persist state: %v", err)
+		}
+	}
+
+	newInstance()
+	if !state.IsSubaccountHalted(scenarios.SubAccount) {
+		t.Fatalf("halt not persisted")
+	}
+	if failures := state.SubaccountFailures[scenarios.SubAccount.Hex()]; failures != maxFailures+1 {
+		t.Errorf("%d failures persisted, want %d", failures, maxFailures+1)
+	}
+
+	// A success in another instance resets the count for good
+	state.ResetSubaccountFailures(scenarios.SubAccount)
+	if err := PersistState(config, runtime); err != nil {
+		t.Fatalf("persist state: %v", err)
+	}
+	newInstance()
+	if failures := state.SubaccountFailures[scenarios.SubAccount.Hex()]; failures != 0 {
+		t.Errorf("%d failures after reset", failures)
+	}
+}
+
+// TestUnhalt halts a subaccount on undecodable transactions, whose replays
+// count once, and lifts the halt through the admin API
+func TestUnhalt(t *testing.T) {
+	h := newHarness(t)
+	h.config.Halt = &HaltConfig{MaxConsecutiveFailures: 1}
+	undecodable := append([]byte{0xde, 0xad, 0xbe, 0xef}, make([]byte, 32)...)
+
+	first := h.chain.protocolExecuted(t.Name()+" first", scenarios.Pool, undecodable, h.runtime.now)
+	h.deliver(first)
+	h.deliver(first)
+	if state.IsSubaccountHalted(scenarios.SubAccount) {
+		t.Fatal("replayed undecodable event counted twice")
+	}
+	h.deliver(h.chain.protocolExecuted(t.Name()+" second", scenarios.Pool, undecodable, h.runtime.now))
+	if !state.IsSubaccountHalted(scenarios.SubAccount) {
+		t.Fatal("subaccount not halted")
+	}
+	if h.withdraw(0) {
+		t.Fatal("update submitted for a halted subaccount")
+	}
+
+	if err := h.admin("unhalt", `{"subAccount": "`+scenarios.SubAccount.Hex()+`", "note": "new router whitelisted"}`); err != nil {
+		t.Fatalf("unhalt: %v", err)
+	}
+	if fields := state.AuditLog[len(state.AuditLog)-1]; fields["outcome"] != "unhalted" || fields["operator"] != scenarios.Updater.Hex() {
+		t.Errorf("unhalt audited as %v", fields)
+	}
+	if failures := state.SubaccountFailures[scenarios.SubAccount.Hex()]; failures != 0 {
+		t.Errorf("%d failures left after unhalt", failures)
+	}
+	if err := h.admin("unhalt", `{"subAccount": "`+scenarios.SubAccount.Hex()+`"}`); err == nil {
+		t.Error("unhalted twice")
+	}
+	if !h.withdraw(0) {
+		t.Fatal("update not submitted after unhalt")
+	}
+}
@@ -0,0 +1,86 @@
+//go:build wasip1
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/scheduler/cron"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+)
+
+// OnHealthCheck is the handler for the health cron trigger. It evaluates the
+// configured SLAs and walks the escalation ladder (warn, page, auto-pause).
+func OnHealthCheck(config *Config, runtime cre.Runtime, payload *cron.Payload) (*ExecutionResult, error) {
+	logger := runtime.Logger()
+	logger.Info("Health check triggered")
+
+	FlushAlertGroups(config, runtime)
+
+	evmClient := newEVMClient(config)
+
+	if !config.MonitorOnly {
+		if err := Preflight(config, runtime, evmClient); err != nil {
+			RaiseAlert(config, runtime, slog.LevelError, "PAGE: preflight failed", "", "error", err.Error())
+			return nil, err
+		}
+	}
+
+	if divergences := CheckShadowDivergence(config, runtime, evmClient, logger); divergences > 0 {
+		RaiseAlert(config, runtime, slog.LevelError, "PAGE: standby diverged from leader", "", "divergences", divergences)
+	}
+
+	CheckFixedPrices(config, runtime)
+
+	CheckModulePauses(config, runtime, evmClient)
+
+	if config.NAV != nil {
+		SnapshotNAV(config, runtime, evmClient, logger)
+	}
+
+	if config.SLA == nil {
+		return &ExecutionResult{Message: "No SLA configured", Success: true}, nil
+	}
+
+	// Refresh feed staleness from the configured price feeds
+	for _, token := range config.Tokens {
+		if token.HasFixedPrice() || token.HasPeggedPrice() || !token.HasPriceSource() {
+			continue
+		}
+		priceData, err := GetPriceFromFeed(runtime, evmClient, token.PriceFeedAddress.Address)
+		if err != nil {
+			logger.Warn("Failed to read price feed", "symbol", token.Symbol, "error", err.Error())
+			continue
+		}
+		state.RecordFeedUpdate(token.Symbol, priceData.UpdatedAt)
+	}
+
+	breaches := EvaluateSLA(config.SLA, state, state.FeedUpdatedAt, runtime.Now())
+	if len(breaches) == 0 {
+		if state.ConsecutiveBreach > 0 || state.Paused {
+			logger.Info("SLAs recovered", "previousBreaches", state.ConsecutiveBreach)
+		}
+		if state.Paused {
+			state.Resume(runtime.Now())
+		}
+		state.ConsecutiveBreach = 0
+		return &ExecutionResult{Message: "All SLAs met", Success: true}, nil
+	}
+
+	state.ConsecutiveBreach++
+	level := EscalationFor(config.SLA.Escalation, state.ConsecutiveBreach)
+	Escalate(logger, state, level, breaches)
+	if level == EscalationWarn {
+		RouteAlert(config, runtime, newAlert(slog.LevelWarn, "ALERT: SLA breached", "", runtime.Now(),
+			"consecutive", state.ConsecutiveBreach, "breaches", len(breaches)))
+	} else if level != EscalationNone {
+		RouteAlert(config, runtime, newAlert(slog.LevelError, "PAGE: SLA breached", "", runtime.Now(),
+			"consecutive", state.ConsecutiveBreach, "escalation", level.String(), "breaches", len(breaches)))
+	}
+
+	return &ExecutionResult{
+		Message: fmt.Sprintf("%d SLA breaches, escalation: %s", len(breaches), level),
+		Success: true,
+	}, nil
+}
@@ -0,0 +1,105 @@
+//go:build wasip1
+
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/blockchain/evm"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+)
+
+// heuristicProtocol is the protocol name of heuristically decoded actions
+const heuristicProtocol = "heuristic"
+
+// maxPlausibleAmount bounds the calldata words considered amounts: larger
+// values are hashes, packed data or type(uint256).max sentinels
+var maxPlausibleAmount = new(big.Int).Lsh(big.NewInt(1), 128)
+
+// calldataCandidates scans every argument word for configured token addresses
+// and plausible amounts
+func calldataCandidates(config *Config, calldata []byte) (map[common.Address]bool, []*big.Int) {
+	tokens := make(map[common.Address]bool)
+	var amounts []*big.Int
+	zeroPrefix := make([]byte, 12)
+
+	for start := 4; start+32 <= len(calldata); start += 32 {
+		word := calldata[start : start+32]
+		if bytes.Equal(word[:12], zeroPrefix) {
+			addr := common.BytesToAddress(word[12:])
+			if findTokenConfig(config, addr) != nil {
+				tokens[addr] = true
+				continue
+			}
+		}
+		value := new(big.Int).SetBytes(word)
+		if value.Sign() > 0 && value.Cmp(maxPlausibleAmount) < 0 {
+			amounts = append(amounts, value)
+		}
+	}
+	return tokens, amounts
+}
+
+// containsAmount reports whether an amount is among the candidates
+func containsAmount(amounts []*big.Int, amount *big.Int) bool {
+	for _, candidate := range amounts {
+		if candidate.Cmp(amount) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// DecodeHeuristic is a best-effort decoder for unverified contracts. It keeps
+// the configured token Transfer events of the receipt that move funds into or
+// out of the Safe and are corroborated by the calldata, either by their token
+// address or by their exact amount.
+func DecodeHeuristic(config *Config, runtime cre.Runtime, evmClient *evm.Client, logger *slog.Logger, target common.Address, calldata []byte, txHash []byte) (*Action, error) {
+	if len(calldata) < 4 {
+		return nil, fmt.Errorf("transaction data too short")
+	}
+
+	transfers, err := safeTransfers(config, runtime, evmClient, txHash)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, amounts := calldataCandidates(config, calldata)
+	action := &Action{
+		Protocol:     heuristicProtocol,
+		Counterparty: target,
+		Selector:     hex.EncodeToString(calldata[:4]),
+		Confidence:   ConfidenceHeuristic,
+	}
+
+	for _, t := range transfers {
+		if !tokens[t.Token] && !containsAmount(amounts, t.Amount) {
+			continue
+		}
+		if t.In {
+			action.AssetsIn = append(action.AssetsIn, AssetAmount{Token: t.Token, Amount: t.Amount})
+		} else {
+			action.AssetsOut = append(action.AssetsOut, AssetAmount{Token: t.Token, Amount: t.Amount})
+		}
+	}
+
+	switch {
+	case len(action.AssetsIn) > 0 && len(action.AssetsOut) > 0:
+		action.Verb = VerbSwap
+	case len(action.AssetsIn) > 0:
+		action.Verb = VerbWithdraw
+	case len(action.AssetsOut) > 0:
+		action.Verb = VerbDeposit
+	default:
+		return nil, fmt.Errorf("no corroborated token transfer to or from the Safe")
+	}
+
+	logger.Warn("Heuristically decoded action", "target", target.Hex(), "verb", string(action.Verb),
+		"assetsIn", len(action.AssetsIn), "assetsOut", len(action.AssetsOut))
+	return action, nil
+}
@@ -0,0 +1,120 @@
+//go:build wasip1
+
+package main
+
+import (
+	"math/big"
+	"strings"
+	"time"
+)
+
+// LedgerEntry represents the value moved by one processed action
+type LedgerEntry struct {
+	TxHash     string
+	SubAccount string
+	Protocol   string
+	Verb       Verb
+	GrossUSD   *big.Int
+	NetUSD     *big.Int
+	Groups     map[string]GroupFlow
+	At         time.Time
+}
+
+// RecordLedgerEntry appends an action to the ledger
+func (s *WorkflowState) RecordLedgerEntry(entry LedgerEntry) {
+	s.Ledger = append(s.Ledger, entry)
+}
+
+// ExposureSince returns the gross USD value moved since a point in time by
+// actions matching protocol and verb. Empty filters match everything.
+func (s *WorkflowState) ExposureSince(protocol string, verb Verb, since time.Time) *big.Int {
+	return s.SubaccountExposureSince("", protocol, verb, since)
+}
+
+// SubaccountExposureSince returns the gross USD value moved since a point in
+// time by one subaccount's actions matching protocol and verb. Empty filters
+// match everything.
+func (s *WorkflowState) SubaccountExposureSince(subAccount string, protocol string, verb Verb, since time.Time) *big.Int {
+	total := new(big.Int)
+	for _, entry := range s.Ledger {
+		if entry.At.Before(since) {
+			continue
+		}
+		if subAccount != "" && !strings.EqualFold(entry.SubAccount, subAccount) {
+			continue
+		}
+		if protocol != "" && !strings.EqualFold(entry.Protocol, protocol) {
+			continue
+		}
+		if verb != "" && entry.Verb != verb {
+			continue
+		}
+		total.Add(total, entry.GrossUSD)
+	}
+	return total
+}
+
+// LedgerAggregate represents the compacted ledger entries of one day,
+// subaccount, protocol and verb
+type LedgerAggregate struct {
+	Day        string
+	SubAccount string
+	Protocol   string
+	Verb       Verb
+	Count      int
+	GrossUSD   *big.Int
+	NetUSD     *big.Int
+}
+
+// ledgerRetention returns how long ledger entries are needed for exposure
+// limits, accounting proofs and the configured detail retention
+func ledgerRetention(config *Config) time.Duration {
+	retention := longestExposurePeriod(config.Policy)
+	if proofs := accountingRetention(config.AccountingProofs); proofs > retention {
+		retention = proofs
+	}
+	if detail := ledgerDetailRetention(config.Retention); detail > retention {
+		retention = detail
+	}
+	return retention
+}
+
+// CompactLedger rolls entries older than a point in time into daily
+// aggregates, which are kept forever
+func (s *WorkflowState) CompactLedger(before time.Time) int {
+	kept := s.Ledger[:0]
+	compacted := 0
+	for _, entry := range s.Ledger {
+		if !entry.At.Before(before) {
+			kept = append(kept, entry)
+			continue
+		}
+		s.aggregateLedgerEntry(entry)
+		compacted++
+	}
+	s.Ledger = kept
+	return compacted
+}
+
+// aggregateLedgerEntry adds an entry to the aggregate of its day
+func (s *WorkflowState) aggregateLedgerEntry(entry LedgerEntry) {
+	day := entry.At.UTC().Format("2006-01-02")
+	for i := range s.LedgerAggregates {
+		agg := &s.LedgerAggregates[i]
+		if agg.Day == day && agg.SubAccount == entry.SubAccount && agg.Protocol == entry.Protocol && agg.Verb == entry.Verb {
+			agg.Count++
+			agg.GrossUSD.Add(agg.GrossUSD, entry.GrossUSD)
+			agg.NetUSD.Add(agg.NetUSD, entry.NetUSD)
+			return
+		}
+	}
+	s.LedgerAggregates = append(s.LedgerAggregates, LedgerAggregate{
+		Day:        day,
+		SubAccount: entry.SubAccount,
+		Protocol:   entry.Protocol,
+		Verb:       entry.Verb,
+		Count:      1,
+		GrossUSD:   new(big.Int).Set(entry.GrossUSD),
+		NetUSD:     new(big.Int).Set(entry.NetUSD),
+	})
+}
@@ -0,0 +1,111 @@
+//go:build wasip1
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/blockchain/evm"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+)
+
+// WithdrawalClaimed(uint256 indexed requestId, address indexed owner, address indexed receiver, uint256 amountOfETH),
+// emitted by the Lido WithdrawalQueue
+var lidoWithdrawalClaimedSignature = crypto.Keccak256Hash([]byte("WithdrawalClaimed(uint256,address,address,uint256)"))
+
+// lidoClaimedRequests returns the ids of the WithdrawalQueue requests a claim settles
+func lidoClaimedRequests(selector string, calldata []byte) ([]*big.Int, error) {
+	if selector == LidoClaimWithdrawalSelector {
+		requestID, err := calldataUint(calldata, 0)
+		if err != nil {
+			return nil, err
+		}
+		return []*big.Int{requestID}, nil
+	}
+	values, err := lidoUintArrays(calldata, 2, false)
+	if err != nil {
+		return nil, err
+	}
+	return values[0], nil
+}
+
+// ResolveLidoWithdrawal settles Lido staked-ETH exits from the receipt:
+//   - unwrap credits the stETH the wstETH contract transferred out
+//   - a withdrawal request debits the stETH or wstETH the queue pulled, found
+//     by the Transfer of each requested amount to the queue
+//   - a claim credits the ETH of the WithdrawalClaimed events of the claimed
+//     requests, valued through the queue's entry in the vaults registry,
+//     which maps it to WETH
+func ResolveLidoWithdrawal(runtime cre.Runtime, evmClient *evm.Client, logger *slog.Logger, action *Action, calldata []byte, txHash []byte) error {
+	reply, err := evmClient.GetTransactionReceipt(runtime, &evm.GetTransactionReceiptRequest{Hash: txHash}).Await()
+	if err != nil {
+		return fmt.Errorf("failed to get transaction receipt: %w", err)
+	}
+	if reply.Receipt == nil {
+		return fmt.Errorf("transaction receipt not found")
+	}
+	logs := reply.Receipt.Logs
+
+	switch action.Selector {
+	case LidoUnwrapSelector:
+		for _, log := range logs {
+			if len(log.Topics) < 3 || len(log.Data) < 32 || !bytes.Equal(log.Topics[0], transferSignature.Bytes()) ||
+				common.BytesToAddress(log.Topics[1]) != action.Counterparty {
+				continue
+			}
+			stETH, amount := common.BytesToAddress(log.Address), new(big.Int).SetBytes(log.Data[:32])
+			action.AssetsIn = append(action.AssetsIn, AssetAmount{Token: stETH, Amount: amount})
+			logger.Info("Lido wstETH unwrapped", "stETH", stETH.Hex(), "amount", amount.String())
+			return nil
+		}
+		return fmt.Errorf("no stETH transfer from %s in receipt", action.Counterparty.Hex())
+
+	case LidoRequestWithdrawalsSelector, LidoRequestWithdrawalsWstETHSelector:
+		for i := range action.AssetsOut {
+			asset := &action.AssetsOut[i]
+			token, ok := transferredToken(logs, action.Counterparty, asset.Amount)
+			if !ok {
+				return fmt.Errorf("no transfer of %s to withdrawal queue %s", asset.Amount, action.Counterparty.Hex())
+			}
+			asset.Token = token
+			logger.Info("Lido withdrawal requested", "token", token.Hex(), "amount", asset.Amount.String())
+		}
+		return nil
+
+	case LidoClaimWithdrawalSelector, LidoClaimWithdrawalsSelector:
+		requestIDs, err := lidoClaimedRequests(action.Selector, calldata)
+		if err != nil {
+			return err
+		}
+		claimed := make(map[string]bool, len(requestIDs))
+		for _, requestID := range requestIDs {
+			claimed[requestID.String()] = true
+		}
+
+		total := new(big.Int)
+		for _, log := range logs {
+			if common.BytesToAddress(log.Address) != action.Counterparty || len(log.Topics) != 4 || len(log.Data) < 32 ||
+				!bytes.Equal(log.Topics[0], lidoWithdrawalClaimedSignature.Bytes()) {
+				continue
+			}
+			requestID := new(big.Int).SetBytes(log.Topics[1])
+			if !claimed[requestID.String()] {
+				continue
+			}
+			amount := new(big.Int).SetBytes(log.Data[:32])
+			total.Add(total, amount)
+			logger.Info("Lido withdrawal claimed", "requestId", requestID.String(), "amountOfETH", amount.String())
+		}
+		if total.Sign() == 0 {
+			return fmt.Errorf("no WithdrawalClaimed for the claimed requests in receipt")
+		}
+		action.AssetsIn = append(action.AssetsIn, AssetAmount{Token: action.Counterparty, Amount: total, Vault: true})
+		return nil
+	}
+	return nil
+}
@@ -0,0 +1,256 @@
+//go:build wasip1
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/smartcontractkit/chainlink-protos/cre/go/values/pb"
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/blockchain/evm"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+)
+
+// Scanning defaults: 2000 blocks per eth_getLogs, split down to single
+// blocks, 60 requests per minute with bursts of 20
+const (
+	defaultScanChunkBlocks       = 2000
+	defaultScanMinChunkBlocks    = 1
+	defaultScanRequestsPerMinute = 60
+	defaultScanBurst             = 20
+)
+
+// providerLimitErrors are the error fragments RPC providers return when a
+// range holds too many logs or spans too many blocks
+var providerLimitErrors = []string{
+	"query returned more than",
+	"more than 10000 results",
+	"response size exceeded",
+	"response size should not",
+	"block range",
+	"range too large",
+	"exceed maximum block range",
+	"limit exceeded",
+	"too many",
+	"query timeout",
+}
+
+// LogScanConfig represents the chunking and rate limiting of log scans
+type LogScanConfig struct {
+	ChunkBlocks       uint64 `json:"chunkBlocks,omitempty"`
+	MinChunkBlocks    uint64 `json:"minChunkBlocks,omitempty"`
+	RequestsPerMinute uint64 `json:"requestsPerMinute,omitempty"`
+	Burst             uint64 `json:"burst,omitempty"`
+}
+
+// LogScan represents a log query over a block range. Named scans keep a
+// cursor in the state, so a scan cut short by the rate limit resumes where it
+// stopped on the next run.
+type LogScan struct {
+	Name      string
+	Addresses [][]byte
+	Topics    []*evm.Topics
+	FromBlock uint64
+	ToBlock   uint64
+}
+
+// ScanCursor represents the progress of a named scan. Chunk is the current
+// range size, shrunk on provider limits and grown back on success.
+type ScanCursor struct {
+	NextBlock uint64    `json:"nextBlock"`
+	ToBlock   uint64    `json:"toBlock"`
+	Chunk     uint64    `json:"chunk"`
+	Requests  uint64    `json:"requests"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Done reports whether the cursor reached the end of its range
+func (c *ScanCursor) Done() bool {
+	return c.NextBlock > c.ToBlock
+}
+
+// ScanBudget represents the token bucket shared by every scan
+type ScanBudget struct {
+	Tokens     float64   `json:"tokens"`
+	RefilledAt time.Time `json:"refilledAt"`
+}
+
+func init() {
+	RegisterAdminMethod("scanCursors", adminScanCursors)
+}
+
+// ValidateLogScan checks the log scanning configuration
+func ValidateLogScan(scan *LogScanConfig) error {
+	if scan == nil {
+		return nil
+	}
+	if scan.ChunkBlocks != 0 && scan.MinChunkBlocks > scan.ChunkBlocks {
+		return fmt.Errorf("minChunkBlocks must not be larger than chunkBlocks")
+	}
+	return nil
+}
+
+// scanSettings returns the log scanning configuration with its defaults
+func scanSettings(config *Config) LogScanConfig {
+	settings := LogScanConfig{
+		ChunkBlocks:       defaultScanChunkBlocks,
+		MinChunkBlocks:    defaultScanMinChunkBlocks,
+		RequestsPerMinute: defaultScanRequestsPerMinute,
+		Burst:             defaultScanBurst,
+	}
+	if scan := config.LogScan; scan != nil {
+		if scan.ChunkBlocks > 0 {
+			settings.ChunkBlocks = scan.ChunkBlocks
+		}
+		if scan.MinChunkBlocks > 0 {
+			settings.MinChunkBlocks = scan.MinChunkBlocks
+		}
+		if scan.RequestsPerMinute > 0 {
+			settings.RequestsPerMinute = scan.RequestsPerMinute
+		}
+		if scan.Burst > 0 {
+			settings.Burst = scan.Burst
+		}
+	}
+	return settings
+}
+
+// TakeScanToken refills the bucket for the time elapsed and takes one request
+// from it. It reports false when the rate limit is reached.
+func (s *WorkflowState) TakeScanToken(settings LogScanConfig, now time.Time) bool {
+	if s.ScanBudget.RefilledAt.IsZero() {
+		s.ScanBudget = ScanBudget{Tokens: float64(settings.Burst), RefilledAt: now}
+	}
+	elapsed := now.Sub(s.ScanBudget.RefilledAt)
+	if elapsed > 0 {
+		s.ScanBudget.Tokens += elapsed.Minutes() * float64(settings.RequestsPerMinute)
+		if s.ScanBudget.Tokens > float64(settings.Burst) {
+			s.ScanBudget.Tokens = float64(settings.Burst)
+		}
+		s.ScanBudget.RefilledAt = now
+	}
+	if s.ScanBudget.Tokens < 1 {
+		return false
+	}
+	s.ScanBudget.Tokens--
+	return true
+}
+
+// isProviderLimit reports whether an eth_getLogs error asks for a smaller range
+func isProviderLimit(err error) bool {
+	message := strings.ToLower(err.Error())
+	for _, fragment := range providerLimitErrors {
+		if strings.Contains(message, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+// scanCursor returns the cursor of a scan, resuming a named one. A resumed
+// cursor keeps its position and follows the new end of the range.
+func scanCursor(scan LogScan, settings LogScanConfig) *ScanCursor {
+	fresh := &ScanCursor{NextBlock: scan.FromBlock, ToBlock: scan.ToBlock, Chunk: settings.ChunkBlocks}
+	if scan.Name == "" {
+		return fresh
+	}
+	cursor, ok := state.ScanCursors[scan.Name]
+	if !ok {
+		state.ScanCursors[scan.Name] = fresh
+		return fresh
+	}
+	if cursor.NextBlock < scan.FromBlock {
+		cursor.NextBlock = scan.FromBlock
+	}
+	if scan.ToBlock > cursor.ToBlock {
+		cursor.ToBlock = scan.ToBlock
+	}
+	if cursor.Chunk == 0 || cursor.Chunk > settings.ChunkBlocks {
+		cursor.Chunk = settings.ChunkBlocks
+	}
+	return cursor
+}
+
+// ScanLogs reads the logs of a scan in chunks, passing each chunk to handle
+// in block order. A chunk the provider refuses is halved down to
+// minChunkBlocks, and the chunk grows back after each success. The scan stops
+// early when the rate limit is reached; the returned cursor tells whether it
+// is done. The cursor only advances past chunks that were handled.
+func ScanLogs(config *Config, runtime cre.Runtime, evmClient *evm.Client, logger *slog.Logger, scan LogScan, handle func(logs []*evm.Log) error) (*ScanCursor, error) {
+	settings := scanSettings(config)
+	cursor := scanCursor(scan, settings)
+
+	for !cursor.Done() {
+		if !state.TakeScanToken(settings, runtime.Now()) {
+			logger.Info("Log scan rate limited", "scan", scan.Name, "nextBlock", cursor.NextBlock, "toBlock", cursor.ToBlock)
+			break
+		}
+
+		toBlock := cursor.NextBlock + cursor.Chunk - 1
+		if toBlock > cursor.ToBlock {
+			toBlock = cursor.ToBlock
+		}
+
+		reply, err := evmClient.FilterLogs(runtime, &evm.FilterLogsRequest{
+			FilterQuery: &evm.FilterQuery{
+				FromBlock: pb.NewBigIntFromInt(new(big.Int).SetUint64(cursor.NextBlock)),
+				ToBlock:   pb.NewBigIntFromInt(new(big.Int).SetUint64(toBlock)),
+				Addresses: scan.Addresses,
+				Topics:    scan.Topics,
+			},
+		}).Await()
+		cursor.Requests++
+		cursor.UpdatedAt = runtime.Now()
+
+		if err != nil {
+			if isProviderLimit(err) && cursor.Chunk > settings.MinChunkBlocks {
+				cursor.Chunk = max(cursor.Chunk/2, settings.MinChunkBlocks)
+				logger.Info("Log scan range split", "scan", scan.Name, "fromBlock", cursor.NextBlock, "chunk", cursor.Chunk, "error", err.Error())
+				continue
+			}
+			return cursor, fmt.Errorf("failed to read logs of blocks %d-%d: %w", cursor.NextBlock, toBlock, err)
+		}
+
+		if err := handle(reply.Logs); err != nil {
+			return cursor, fmt.Errorf("failed to handle logs of blocks %d-%d: %w", cursor.NextBlock, toBlock, err)
+		}
+
+		cursor.NextBlock = toBlock + 1
+		if cursor.Chunk < settings.ChunkBlocks {
+			cursor.Chunk = min(cursor.Chunk*2, settings.ChunkBlocks)
+		}
+	}
+
+	if scan.Name != "" && cursor.Done() {
+		logger.Info("Log scan done", "scan", scan.Name, "toBlock", cursor.ToBlock, "requests", cursor.Requests)
+	}
+	return cursor, nil
+}
+
+// adminScanCursors lists the named scans and their progress
+func adminScanCursors(config *Config, runtime cre.Runtime, caller common.Address, params json.RawMessage) (interface{}, error) {
+	type scanCursor struct {
+		Name string `json:"name"`
+		*ScanCursor
+		Done bool `json:"done"`
+	}
+
+	names := make([]string, 0, len(state.ScanCursors))
+	for name := range state.ScanCursors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	cursors := make([]scanCursor, len(names))
+	for i, name := range names {
+		cursor := state.ScanCursors[name]
+		cursors[i] = scanCursor{Name: name, ScanCursor: cursor, Done: cursor.Done()}
+	}
+	return map[string]interface{}{"cursors": cursors, "tokens": state.ScanBudget.Tokens}, nil
+}
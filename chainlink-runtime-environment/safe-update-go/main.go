@@ -4,40 +4,107 @@ package main
 
 import (
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"log/slog"
 	"math/big"
-	"strings"
+	"time"
 
-	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/smartcontractkit/chainlink-protos/cre/go/values/pb"
 	"github.com/smartcontractkit/cre-sdk-go/capabilities/blockchain/evm"
 	"github.com/smartcontractkit/cre-sdk-go/cre"
 	"github.com/smartcontractkit/cre-sdk-go/cre/wasm"
+
+	"safe-update-go/fixedpoint"
 )
 
 // Config represents the workflow configuration
 type Config struct {
-	ModuleAddress   string        `json:"moduleAddress"`
-	ChainSelector   string        `json:"chainSelector"`
-	GasLimit        uint64        `json:"gasLimit"`
-	ProxyAddress    string        `json:"proxyAddress"`
-	Tokens          []TokenConfig `json:"tokens"`
+	Environment         string                    `json:"environment,omitempty"`
+	ModuleAddress       Address                   `json:"moduleAddress"`
+	ChainSelector       ChainSelector             `json:"chainSelector"`
+	GasLimit            uint64                    `json:"gasLimit"`
+	ProxyAddress        Address                   `json:"proxyAddress,omitempty"`
+	SubmissionMode      string                    `json:"submissionMode,omitempty"`
+	ForwarderAddress    Address                   `json:"forwarderAddress,omitempty"`
+	ModuleReceiver      bool                      `json:"moduleReceiver,omitempty"`
+	ModuleDelegateCall  bool                      `json:"moduleDelegateCall,omitempty"`
+	Tokens              []TokenConfig             `json:"tokens"`
+	HealthCheckSchedule string                    `json:"healthCheckSchedule,omitempty"`
+	SLA                 *SLAConfig                `json:"sla,omitempty"`
+	Retry               *RetryConfig              `json:"retry,omitempty"`
+	ModulePause         *ModulePauseConfig        `json:"modulePause,omitempty"`
+	Backpressure        *BackpressureConfig       `json:"backpressure,omitempty"`
+	Mirrors             []MirrorConfig            `json:"mirrors,omitempty"`
+	Migration           *MigrationConfig          `json:"migration,omitempty"`
+	Audit               *AuditConfig              `json:"audit,omitempty"`
+	Precision           *PrecisionConfig          `json:"precision,omitempty"`
+	ValueTransform      *ValueTransformConfig     `json:"valueTransform,omitempty"`
+	TokenNative         *TokenNativeConfig        `json:"tokenNative,omitempty"`
+	DualWrite           *DualWriteConfig          `json:"dualWrite,omitempty"`
+	AllowanceEvents     *AllowanceEventsConfig    `json:"allowanceEvents,omitempty"`
+	AdminAlerts         *AdminAlertsConfig        `json:"adminAlerts,omitempty"`
+	CowSwap             *CowSwapConfig            `json:"cowSwap,omitempty"`
+	GMX                 *GMXConfig                `json:"gmx,omitempty"`
+	NoOp                *NoOpConfig               `json:"noOp,omitempty"`
+	PriceCache          *PriceCacheConfig         `json:"priceCache,omitempty"`
+	MonitorOnly         bool                      `json:"monitorOnly,omitempty"`
+	GasSchedule         *GasScheduleConfig        `json:"gasSchedule,omitempty"`
+	Policy              *PolicyConfig             `json:"policy,omitempty"`
+	Halt                *HaltConfig               `json:"halt,omitempty"`
+	SelfTest            *SelfTestConfig           `json:"selfTest,omitempty"`
+	ClockSkew           *ClockSkewConfig          `json:"clockSkew,omitempty"`
+	ModuleCodeHashes    map[Address]string        `json:"moduleCodeHashes,omitempty"`
+	SubAccounts         []Address                 `json:"subAccounts,omitempty"`
+	Sharding            *ShardingConfig           `json:"sharding,omitempty"`
+	Failover            *FailoverConfig           `json:"failover,omitempty"`
+	DecisionLog         *DecisionLogConfig        `json:"decisionLog,omitempty"`
+	Admin               *AdminConfig              `json:"admin,omitempty"`
+	AccountingProofs    *AccountingProofsConfig   `json:"accountingProofs,omitempty"`
+	OwnerAPI            *OwnerAPIConfig           `json:"ownerApi,omitempty"`
+	Formatting          *FormatConfig             `json:"formatting,omitempty"`
+	Alerts              *AlertConfig              `json:"alerts,omitempty"`
+	Watch               *WatchConfig              `json:"watch,omitempty"`
+	SafeTxService       *SafeTxServiceConfig      `json:"safeTxService,omitempty"`
+	Simulation          *SimulationConfig         `json:"simulation,omitempty"`
+	Explorers           map[string]ExplorerConfig `json:"explorers,omitempty"`
+	HeuristicDecoding   bool                      `json:"heuristicDecoding,omitempty"`
+	Vaults              []VaultConfig             `json:"vaults,omitempty"`
+	SparkPools          []Address                 `json:"sparkPools,omitempty"`
+	AuraBoosters        []Address                 `json:"auraBoosters,omitempty"`
+	AerodromeFactories  []Address                 `json:"aerodromeFactories,omitempty"`
+	CompoundV2Forks     []CompoundV2Fork          `json:"compoundV2Forks,omitempty"`
+	WrappedNative       Address                   `json:"wrappedNative,omitempty"`
+	Regression          *RegressionConfig         `json:"regression,omitempty"`
+	Store               *StoreConfig              `json:"store,omitempty"`
+	Retention           *RetentionConfig          `json:"retention,omitempty"`
+	LogScan             *LogScanConfig            `json:"logScan,omitempty"`
+	NAV                 *NAVConfig                `json:"nav,omitempty"`
+
+	// The decoders and pricing of the built workflow
+	decoders *DecoderSet
+	pricing  PriceSource
 }
 
-// TokenConfig represents a token configuration
-type TokenConfig struct {
-	Address          string `json:"address"`
-	PriceFeedAddress string `json:"priceFeedAddress"`
-	Symbol           string `json:"symbol"`
-	Type             string `json:"type"`
-}
+// ProtocolExecuted(address indexed subAccount, address indexed target, uint256 timestamp)
+var protocolExecutedSignature = crypto.Keccak256Hash([]byte("ProtocolExecuted(address,address,uint256)"))
 
-// WithdrawalData represents decoded withdrawal information
-type WithdrawalData struct {
-	Amount common.Address
-	Token  common.Address
+// TokenConfig represents a token configuration. Tokens that will never have
+// a price feed, such as wrapped internal tokens, are valued at FixedPriceUSD
+// until FixedPriceReviewBy.
+type TokenConfig struct {
+	Address            Address `json:"address"`
+	PriceFeedAddress   Address `json:"priceFeedAddress"`
+	PriceFeedQuote     string  `json:"priceFeedQuote,omitempty"`
+	Pegged             bool    `json:"pegged,omitempty"`
+	Group              string  `json:"group,omitempty"`
+	Symbol             string  `json:"symbol"`
+	Type               string  `json:"type"`
+	NegativePrice      string  `json:"negativePrice,omitempty"`
+	FixedPriceUSD      string  `json:"fixedPriceUsd,omitempty"`
+	FixedPriceReviewBy string  `json:"fixedPriceReviewBy,omitempty"`
 }
 
 // ExecutionResult represents the workflow execution result
@@ -46,15 +113,6 @@ type ExecutionResult struct {
 	Success bool
 }
 
-// ABI definitions for common protocols
-const (
-	// Aave withdraw(address asset, uint256 amount, address to)
-	AaveWithdrawSelector = "69328dec"
-
-	// Morpho withdraw(uint256 assets, address receiver, address owner)
-	MorphoWithdrawSelector = "b460af94"
-)
-
 // ERC20 ABI for decimals
 const erc20ABI = `[{"constant":true,"inputs":[],"name":"decimals","outputs":[{"name":"","type":"uint8"}],"type":"function"}]`
 
@@ -62,85 +120,112 @@ const erc20ABI = `[{"constant":true,"inputs":[],"name":"decimals","outputs":[{"n
 const priceFeedABI = `[{"constant":true,"inputs":[],"name":"latestRoundData","outputs":[{"name":"roundId","type":"uint80"},{"name":"answer","type":"int256"},{"name":"startedAt","type":"uint256"},{"name":"updatedAt","type":"uint256"},{"name":"answeredInRound","type":"uint80"}],"type":"function"},{"constant":true,"inputs":[],"name":"decimals","outputs":[{"name":"","type":"uint8"}],"type":"function"}]`
 
 // DeFiInteractorModule ABI
-const moduleABI = `[{"constant":false,"inputs":[{"name":"subAccount","type":"address"},{"name":"balanceChange","type":"uint256"}],"name":"updateSubaccountAllowances","outputs":[],"type":"function"}]`
-
-// DecodeWithdrawalAmount decodes the withdrawal amount from protocol calldata
-func DecodeWithdrawalAmount(logger *slog.Logger, txData []byte) (*big.Int, common.Address, error) {
-	if len(txData) < 4 {
-		return nil, common.Address{}, fmt.Errorf("transaction data too short")
-	}
-
-	// Get function selector (first 4 bytes)
-	selector := hex.EncodeToString(txData[:4])
-	logger.Info("Transaction selector", "selector", "0x"+selector)
-
-	// Aave withdraw(address asset, uint256 amount, address to)
-	if selector == AaveWithdrawSelector {
-		logger.Info("Detected Aave withdraw function")
-
-		if len(txData) < 100 {
-			return nil, common.Address{}, fmt.Errorf("Aave withdraw data too short")
+const moduleABI = `[
+	{"constant":false,"inputs":[{"name":"subAccount","type":"address"},{"name":"balanceChange","type":"uint256"}],"name":"updateSubaccountAllowances","outputs":[],"type":"function"},
+	{"constant":true,"inputs":[],"name":"authorizedUpdater","outputs":[{"name":"","type":"address"}],"type":"function"},
+	{"constant":true,"inputs":[],"name":"owner","outputs":[{"name":"","type":"address"}],"type":"function"},
+	{"constant":true,"inputs":[],"name":"paused","outputs":[{"name":"","type":"bool"}],"type":"function"},
+	{"constant":true,"inputs":[],"name":"avatar","outputs":[{"name":"","type":"address"}],"type":"function"},
+	{"constant":true,"inputs":[{"name":"","type":"address"}],"name":"executionWindowStart","outputs":[{"name":"","type":"uint256"}],"type":"function"},
+	{"constant":true,"inputs":[{"name":"","type":"address"}],"name":"executionWindowPortfolioValue","outputs":[{"name":"","type":"uint256"}],"type":"function"},
+	{"constant":true,"inputs":[{"name":"","type":"address"}],"name":"valueApprovedInWindow","outputs":[{"name":"","type":"uint256"}],"type":"function"},
+	{"constant":true,"inputs":[{"name":"roleId","type":"uint16"}],"name":"getSubaccountsByRole","outputs":[{"name":"","type":"address[]"}],"type":"function"},
+	{"constant":true,"inputs":[{"name":"member","type":"address"},{"name":"roleId","type":"uint16"}],"name":"hasRole","outputs":[{"name":"","type":"bool"}],"type":"function"},
+	{"constant":true,"inputs":[{"name":"subAccount","type":"address"}],"name":"getSubAccountLimits","outputs":[{"name":"maxLossBps","type":"uint256"},{"name":"maxTransferBps","type":"uint256"},{"name":"windowDuration","type":"uint256"}],"type":"function"},
+	{"constant":false,"inputs":[{"name":"member","type":"address"},{"name":"roleId","type":"uint16"}],"name":"grantRole","outputs":[],"type":"function"},
+	{"constant":false,"inputs":[{"name":"member","type":"address"},{"name":"roleId","type":"uint16"}],"name":"revokeRole","outputs":[],"type":"function"},
+	{"constant":false,"inputs":[{"name":"subAccount","type":"address"},{"name":"maxLossBps","type":"uint256"},{"name":"maxTransferBps","type":"uint256"},{"name":"windowDuration","type":"uint256"}],"name":"setSubAccountLimits","outputs":[],"type":"function"}
+]`
+
+// updateSubaccountTokenAllowances of token-native module versions
+const tokenAllowanceABI = `[{"constant":false,"inputs":[{"name":"subAccount","type":"address"},{"name":"token","type":"address"},{"name":"amount","type":"uint256"}],"name":"updateSubaccountTokenAllowances","outputs":[],"type":"function"}]`
+
+// DecodeProtocolCall decodes protocol calldata with the registered decoders,
+// falling back on the target's verified ABI and then on heuristic decoding
+// when they are enabled. Protocols with a receipt resolver are settled from
+// the receipt.
+func DecodeProtocolCall(config *Config, runtime cre.Runtime, evmClient *evm.Client, logger *slog.Logger, target common.Address, calldata []byte, txHash []byte) (*Action, error) {
+	// MultiSend batches are decoded call by call, on module versions whose
+	// executeOnProtocol can delegatecall them. The repo's module only calls
+	// them, so none of their calls is made by the Safe.
+	if IsMultiSend(calldata) {
+		if !config.ModuleDelegateCall {
+			return nil, fmt.Errorf("MultiSend batch sent to a module that does not delegatecall")
+		}
+		return DecodeMultiSend(config, runtime, evmClient, logger, target, calldata, txHash)
+	}
+
+	decoders := config.decoderSet()
+	action, err := decoders.DecodeAction(logger, target, calldata)
+	if err == nil {
+		action, err = UnwrapWETH(config, logger, target, calldata, action)
+	}
+	if err == nil {
+		LabelConfiguredProtocol(config, action)
+		if action.Verb == VerbClaim {
+			// Rewards are not in the calldata, they are what the receipt paid the Safe
+			action.SettledFromReceipt = true
+			err = SettleClaim(config, runtime, evmClient, logger, action, txHash)
+		} else if resolve, ok := decoders.Resolver(action.Protocol); ok {
+			action.SettledFromReceipt = true
+			action.Avatar, err = GetAvatar(runtime, evmClient, ActiveTarget(config).ModuleAddress.Address)
+			if err == nil {
+				err = resolve(runtime, evmClient, logger, action, calldata, txHash)
+			}
+		}
+		if err == nil && netSettledProtocols[action.Protocol] {
+			action.SettledFromReceipt = true
+			err = SettleNetTransfers(config, runtime, evmClient, logger, action, txHash)
+		}
+		if err == nil {
+			err = CheckNativePayoutVaults(config, action)
+		}
+		if err == nil && action.GMXWithdrawal != nil {
+			err = CheckGMXWithdrawal(config, action)
+		}
+		if err == nil && action.Verb == VerbBridge {
+			err = BridgeRecipientReview(config, runtime, evmClient, action)
+		}
+		if err == nil && action.Protocol == convexProtocol {
+			err = LabelAuraPool(config, runtime, evmClient, action)
+		}
+		if err == nil && action.Protocol == velodromeProtocol {
+			err = LabelAerodromePool(config, runtime, evmClient, action)
+		}
+		if err == nil && action.Protocol == compoundV2Protocol {
+			LabelCompoundV2Fork(config, runtime, evmClient, logger, action)
 		}
-
-		// Decode parameters: asset (32 bytes), amount (32 bytes), to (32 bytes)
-		assetBytes := txData[16:36] // Skip padding, get address
-		amountBytes := txData[36:68]
-
-		asset := common.BytesToAddress(assetBytes)
-		amount := new(big.Int).SetBytes(amountBytes)
-
-		logger.Info("Aave withdrawal", "amount", amount.String(), "token", asset.Hex())
-
-		return amount, asset, nil
-	}
-
-	// Morpho withdraw(uint256 assets, address receiver, address owner)
-	if selector == MorphoWithdrawSelector {
-		logger.Info("Detected Morpho withdraw function")
-		return nil, common.Address{}, fmt.Errorf("Morpho vault token mapping not implemented")
 	}
-
-	logger.Info("Unknown function selector", "selector", "0x"+selector)
-	return nil, common.Address{}, fmt.Errorf("not a recognized withdrawal function")
-}
-
-// ExtractProtocolCalldata extracts the nested protocol calldata from executeOnProtocol transaction
-func ExtractProtocolCalldata(logger *slog.Logger, txData []byte) ([]byte, error) {
-	if len(txData) < 132 {
-		return nil, fmt.Errorf("transaction data too short for executeOnProtocol")
+	if err == nil {
+		// Calldata that did not match its decoder's shapes is trusted once the receipt confirms it
+		VerifyWithTransfers(config, runtime, evmClient, logger, action, txHash)
+	}
+	if errors.Is(err, ErrUnknownSelector) && len(config.Explorers) > 0 {
+		var abiErr error
+		action, abiErr = DecodeWithFetchedABI(config, runtime, logger, target, calldata)
+		if abiErr != nil {
+			err = fmt.Errorf("%w; fetched ABI: %v", err, abiErr)
+		} else {
+			err = nil
+			VerifyWithTransfers(config, runtime, evmClient, logger, action, txHash)
+		}
 	}
-
-	logger.Info("Full transaction data", "length", len(txData))
-
-	// Skip selector (4) + address (32) + offset (32) = 68 bytes
-	dataLengthOffset := 68
-	dataLengthBytes := txData[dataLengthOffset : dataLengthOffset+32]
-	dataLength := new(big.Int).SetBytes(dataLengthBytes).Uint64()
-
-	logger.Info("Nested calldata", "length", dataLength)
-
-	// Extract the nested calldata
-	dataOffset := dataLengthOffset + 32
-	if uint64(len(txData)) < uint64(dataOffset)+dataLength {
-		return nil, fmt.Errorf("transaction data shorter than expected nested calldata")
+	if errors.Is(err, ErrUnknownSelector) && config.HeuristicDecoding {
+		var heuristicErr error
+		action, heuristicErr = DecodeHeuristic(config, runtime, evmClient, logger, target, calldata, txHash)
+		if heuristicErr != nil {
+			err = fmt.Errorf("%w; heuristic: %v", err, heuristicErr)
+		} else {
+			err = nil
+		}
 	}
-
-	protocolCalldata := txData[dataOffset : uint64(dataOffset)+dataLength]
-	logger.Info("Extracted protocol calldata", "data", "0x"+hex.EncodeToString(protocolCalldata))
-
-	return protocolCalldata, nil
+	return action, err
 }
 
 // CalculateUSDValue converts a token amount to USD value with 18 decimals
 func CalculateUSDValue(amount *big.Int, tokenDecimals uint8, price *big.Int, priceDecimals uint8) *big.Int {
 	// Formula: (amount * price * 10^18) / (10^tokenDecimals * 10^priceDecimals)
-	result := new(big.Int).Mul(amount, price)
-	result.Mul(result, big.NewInt(1e18))
-
-	divisor := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(tokenDecimals+priceDecimals)), nil)
-	result.Div(result, divisor)
-
-	return result
+	return fixedpoint.ToUSD(amount, tokenDecimals, price, priceDecimals, fixedpoint.RoundDown)
 }
 
 // OnProtocolExecuted is the handler for ProtocolExecuted events
@@ -148,13 +233,12 @@ func OnProtocolExecuted(config *Config, runtime cre.Runtime, payload *evm.Log) (
 	logger := runtime.Logger()
 	logger.Info("ProtocolExecuted event received")
 
-	// Parse chain selector
-	chainSelector := new(big.Int)
-	chainSelector.SetString(config.ChainSelector, 10)
+	evmClient := newEVMClient(config)
 
-	// Create EVM client
-	evmClient := &evm.Client{
-		ChainSelector: chainSelector.Uint64(),
+	// Only logs from the configured modules are trusted
+	if err := VerifyEmitter(config, runtime, evmClient, payload); err != nil {
+		RaiseAlert(config, runtime, slog.LevelError, "ALERT: rejecting log", common.BytesToAddress(payload.Address).Hex(), "error", err.Error())
+		return nil, err
 	}
 
 	// Get event topics
@@ -166,7 +250,35 @@ func OnProtocolExecuted(config *Config, runtime cre.Runtime, payload *evm.Log) (
 	subAccount := common.BytesToAddress(payload.Topics[1])
 	target := common.BytesToAddress(payload.Topics[2])
 
-	logger.Info("Processing transaction", "subAccount", subAccount.Hex(), "target", target.Hex())
+	logger.Info("Processing transaction", "subAccount", config.Audit.LogValue("subAccount", subAccount.Hex()), "target", config.Audit.LogValue("target", target.Hex()))
+
+	// Other instances process subaccounts outside this shard
+	if !OwnsSubaccount(config, subAccount) {
+		return &ExecutionResult{Message: "Subaccount not in shard", Success: true}, nil
+	}
+
+	if state.IsSubaccountHalted(subAccount) {
+		logger.Warn("Subaccount halted, skipping event", "subAccount", config.Audit.LogValue("subAccount", subAccount.Hex()), "reason", state.HaltedSubaccounts[subAccount.Hex()].Reason)
+		return &ExecutionResult{Message: "Subaccount halted", Success: true}, nil
+	}
+
+	// Replayed logs, e.g. after a restart with a persistent state store, are accounted once
+	eventID := eventKey("0x"+hex.EncodeToString(payload.TxHash), payload.Index)
+	if state.HasProcessed(eventID) {
+		logger.Info("Event already processed, skipping", "event", eventID)
+		return &ExecutionResult{Message: "Duplicate event", Success: true}, nil
+	}
+
+	// Event timestamp is the only non-indexed field
+	var eventTime time.Time
+	if len(payload.Data) >= 32 {
+		eventTime = time.Unix(new(big.Int).SetBytes(payload.Data[:32]).Int64(), 0)
+	}
+
+	// The event timestamp must match the block it was mined in
+	if err := CheckEventSkew(config, runtime, evmClient, payload, eventTime); err != nil {
+		return nil, err
+	}
 
 	// Get transaction by hash to retrieve input data
 	txHashBytes := payload.TxHash
@@ -186,212 +298,432 @@ func OnProtocolExecuted(config *Config, runtime cre.Runtime, payload *evm.Log) (
 
 	logger.Info("Transaction data", "length", len(tx.Transaction.Data))
 
-	// Extract the nested protocol calldata
-	protocolCalldata, err := ExtractProtocolCalldata(logger, tx.Transaction.Data)
+	// Extract the nested protocol call
+	call, err := ExtractProtocolCalldata(logger, tx.Transaction.Data)
 	if err != nil {
 		return nil, fmt.Errorf("failed to extract protocol calldata: %w", err)
 	}
 
-	// Try to decode withdrawal
-	withdrawalAmount, withdrawalToken, err := DecodeWithdrawalAmount(logger, protocolCalldata)
-	if err != nil {
-		logger.Info("Not a recognized withdrawal", "error", err.Error())
-		return &ExecutionResult{Message: "Not a withdrawal", Success: true}, nil
+	// Approvals have no decoder; they are no-ops rather than undecodable
+	if kind, ok := ClassifyApproval(call); ok {
+		return HandleNoOp(config, runtime, subAccount, target, eventID, kind, ""), nil
 	}
 
-	logger.Info("Detected withdrawal", "amount", withdrawalAmount.String(), "token", withdrawalToken.Hex())
-
-	// Find token in config
-	var tokenConfig *TokenConfig
-	for i := range config.Tokens {
-		if strings.EqualFold(config.Tokens[i].Address, withdrawalToken.Hex()) {
-			tokenConfig = &config.Tokens[i]
-			break
-		}
+	action, err := DecodeExecution(config, runtime, evmClient, logger, target, call, payload.TxHash)
+	if err != nil {
+		logger.Info("Not a recognized action", "error", err.Error())
+		// A replayed undecodable event counts once towards the halt
+		state.MarkProcessed(eventID, runtime.Now())
+		RecordSubaccountFailure(config, runtime, subAccount, "undecodable: "+err.Error())
+		return &ExecutionResult{Message: "Not a recognized action", Success: true}, nil
 	}
 
-	if tokenConfig == nil {
-		return nil, fmt.Errorf("token %s not in config", withdrawalToken.Hex())
+	// Pre-signed orders are settled later, when their trade is seen
+	if action.Order != nil {
+		state.TrackOrder(subAccount.Hex(), action.Order, runtime.Now())
 	}
-
-	// Get token decimals
-	parsedERC20ABI, err := abi.JSON(strings.NewReader(erc20ABI))
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse ERC20 ABI: %w", err)
+	// GMX v2 withdrawal orders are settled when a keeper executes them
+	if action.GMXWithdrawal != nil {
+		state.TrackGMXWithdrawal(subAccount.Hex(), action.GMXWithdrawal, runtime.Now())
 	}
 
-	decimalsCallData, err := parsedERC20ABI.Pack("decimals")
-	if err != nil {
-		return nil, fmt.Errorf("failed to pack decimals call: %w", err)
+	// Actions that move no value are neither valued nor submitted
+	if kind, ok := ClassifyNoOp(action); ok {
+		return HandleNoOp(config, runtime, subAccount, target, eventID, kind, action.Protocol), nil
 	}
 
-	tokenAddr := common.HexToAddress(tokenConfig.Address)
-	decimalsReq := &evm.CallContractRequest{
-		Call: &evm.CallMsg{
-			To:   tokenAddr.Bytes(),
-			Data: decimalsCallData,
-		},
-	}
+	return processAction(config, runtime, evmClient, logger, ActionEvent{
+		SubAccount:  subAccount,
+		Target:      target,
+		EventID:     eventID,
+		EventTime:   eventTime,
+		Transaction: tx.Transaction,
+		Log:         payload,
+	}, action)
+}
 
-	decimalsPromise := evmClient.CallContract(runtime, decimalsReq)
-	decimalsResult, err := decimalsPromise.Await()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get token decimals: %w", err)
+// DecodeExecution decodes the protocol call of an executeOnProtocol
+// transaction into an action carrying the call's native value and operation.
+// Plain native value transfers have no calldata; other calls are decoded by
+// protocol, then by the target's verified ABI, then heuristically.
+func DecodeExecution(config *Config, runtime cre.Runtime, evmClient *evm.Client, logger *slog.Logger, target common.Address, call *ProtocolCall, txHash []byte) (*Action, error) {
+	if IsNativeTransfer(call) {
+		return NativeTransferAction(logger, call).WithCall(call), nil
 	}
-
-	var tokenDecimals uint8
-	err = parsedERC20ABI.UnpackIntoInterface(&tokenDecimals, "decimals", decimalsResult.Data)
+	action, err := DecodeProtocolCall(config, runtime, evmClient, logger, target, call.Calldata, txHash)
 	if err != nil {
-		return nil, fmt.Errorf("failed to unpack decimals: %w", err)
+		return nil, err
 	}
+	return action.WithCall(call), nil
+}
 
-	logger.Info("Token decimals", "decimals", tokenDecimals)
-
-	// Get price from Chainlink
-	parsedPriceFeedABI, err := abi.JSON(strings.NewReader(priceFeedABI))
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse price feed ABI: %w", err)
+// HoldForReview routes to review the actions held by their decoder,
+// delegatecalled or sending native value, moving debt, below the required
+// confidence, or taken when a schedule requires it
+func HoldForReview(config *Config, runtime cre.Runtime, action *Action) {
+	if !action.NeedsReview {
+		action.NeedsReview, action.ReviewReason = ExecutionReview(action)
 	}
-
-	latestRoundDataCallData, err := parsedPriceFeedABI.Pack("latestRoundData")
-	if err != nil {
-		return nil, fmt.Errorf("failed to pack latestRoundData call: %w", err)
+	if !action.NeedsReview {
+		action.NeedsReview, action.ReviewReason = DebtReview(action)
 	}
-
-	priceFeedAddr := common.HexToAddress(tokenConfig.PriceFeedAddress)
-	priceReq := &evm.CallContractRequest{
-		Call: &evm.CallMsg{
-			To:   priceFeedAddr.Bytes(),
-			Data: latestRoundDataCallData,
-		},
+	if !action.NeedsReview {
+		action.NeedsReview, action.ReviewReason = RequiresReview(config.Policy, action)
 	}
-
-	pricePromise := evmClient.CallContract(runtime, priceReq)
-	priceResult, err := pricePromise.Await()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get price: %w", err)
+	if !action.NeedsReview {
+		action.NeedsReview, action.ReviewReason = ScheduledReview(config.Policy, runtime.Now())
 	}
+}
 
-	var roundData struct {
-		RoundId         *big.Int
-		Answer          *big.Int
-		StartedAt       *big.Int
-		UpdatedAt       *big.Int
-		AnsweredInRound *big.Int
-	}
+// ActionEvent represents the event a decoded action was observed in. Target
+// is the protocol contract called; Transaction may be nil when the action
+// was not taken in a transaction of the subaccount.
+type ActionEvent struct {
+	SubAccount  common.Address
+	Target      common.Address
+	EventID     string
+	EventTime   time.Time
+	Transaction *evm.Transaction
+	Log         *evm.Log
+}
 
-	err = parsedPriceFeedABI.UnpackIntoInterface(&roundData, "latestRoundData", priceResult.Data)
-	if err != nil {
-		return nil, fmt.Errorf("failed to unpack latestRoundData: %w", err)
-	}
+// processAction reviews and values a decoded action, enforces the policy on
+// it, records it in the ledger and routes the allowance update it results in
+func processAction(config *Config, runtime cre.Runtime, evmClient *evm.Client, logger *slog.Logger, event ActionEvent, action *Action) (*ExecutionResult, error) {
+	subAccount, target, payload := event.SubAccount, event.Target, event.Log
+	eventID, eventTime := event.EventID, event.EventTime
 
-	// Get price decimals
-	priceDecimalsCallData, err := parsedPriceFeedABI.Pack("decimals")
-	if err != nil {
-		return nil, fmt.Errorf("failed to pack decimals call: %w", err)
-	}
+	logger.Info("Detected action", "protocol", action.Protocol, "verb", string(action.Verb),
+		"assetsIn", len(action.AssetsIn), "assetsOut", len(action.AssetsOut), "confidence", string(action.Confidence))
 
-	priceDecimalsReq := &evm.CallContractRequest{
-		Call: &evm.CallMsg{
-			To:   priceFeedAddr.Bytes(),
-			Data: priceDecimalsCallData,
-		},
-	}
+	HoldForReview(config, runtime, action)
 
-	priceDecimalsPromise := evmClient.CallContract(runtime, priceDecimalsReq)
-	priceDecimalsResult, err := priceDecimalsPromise.Await()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get price decimals: %w", err)
+	// Payouts to anyone but the Safe are rejected when recipients are restricted
+	recipientErr := CheckRecipient(config, runtime, evmClient, action)
+	if recipientErr != nil && !errors.Is(recipientErr, ErrPolicyViolation) {
+		return nil, recipientErr
 	}
 
-	var priceDecimals uint8
-	err = parsedPriceFeedABI.UnpackIntoInterface(&priceDecimals, "decimals", priceDecimalsResult.Data)
+	// Value every asset moved by the action and aggregate the signed USD deltas
+	accounting, methodology, err := AccountActionDual(config, runtime, evmClient, logger, action)
 	if err != nil {
-		return nil, fmt.Errorf("failed to unpack price decimals: %w", err)
+		return nil, err
+	}
+
+	for _, delta := range accounting.Deltas {
+		logger.Info("Asset delta", "symbol", config.Audit.LogValue("token", delta.Symbol), "amount", config.Audit.LogValue("amount", delta.Amount.String()),
+			"usd", config.Audit.LogValue("balanceChange", FormatUSD(config, delta.USDValue)))
+	}
+	logger.Info("Net value in USD", "value", config.Audit.LogValue("balanceChange", FormatUSD(config, accounting.NetUSD)))
+	if !action.NeedsReview {
+		action.NeedsReview, action.ReviewReason = accounting.UnpricedReview()
+	}
+
+	// Enforce exposure limits against the ledger before recording this action
+	txHash := "0x" + hex.EncodeToString(payload.TxHash)
+	now := runtime.Now()
+	initiator := LookupSafeInitiator(config, runtime, subAccount, txHash)
+	grossUSD := accounting.GrossUSD()
+	alerts, policyErr := EvaluatePolicy(config.Policy, state, action, accounting, now)
+	if policyErr == nil {
+		policyErr = recipientErr
+	}
+	if policyErr == nil {
+		policyErr = EvaluateNAVLimits(config.Policy, config.NAV, state, subAccount.Hex(), action, grossUSD, now)
+	}
+	for _, alert := range alerts {
+		RaiseAlert(config, runtime, slog.LevelWarn, "ALERT: exposure limit nearly reached", alert.Limit.String(), "limit", alert.Limit.String(), "used", FormatUSD(config, alert.Used), "cap", FormatUSD(config, alert.Cap))
+	}
+
+	// Actions far outside the subaccount's history are alerted on, and held or rejected if configured
+	if anomalies := DetectAnomalies(config.Policy, state, subAccount.Hex(), action, grossUSD, now); len(anomalies) > 0 {
+		reason := anomalyReason(anomalies)
+		RaiseAlert(config, runtime, slog.LevelWarn, "ALERT: anomalous activity", subAccount.Hex(), "subAccount", subAccount.Hex(),
+			"txHash", txHash, "anomaly", reason, "response", config.Policy.Anomaly.response())
+		switch config.Policy.Anomaly.response() {
+		case AnomalyReview:
+			if !action.NeedsReview {
+				action.NeedsReview, action.ReviewReason = true, reason
+			}
+		case AnomalyReject:
+			if policyErr == nil {
+				policyErr = fmt.Errorf("%w: %s", ErrPolicyViolation, reason)
+			}
+		}
 	}
 
-	logger.Info("Price data", "price", roundData.Answer.String(), "decimals", priceDecimals)
-
-	// Calculate USD value
-	balanceChange := CalculateUSDValue(withdrawalAmount, tokenDecimals, roundData.Answer, priceDecimals)
-	logger.Info("Withdrawal value in USD", "value", balanceChange.String())
-
-	// Call updateSubaccountAllowances
-	parsedModuleABI, err := abi.JSON(strings.NewReader(moduleABI))
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse module ABI: %w", err)
+	// Withdrawals split just below a threshold are escalated as one withdrawal above it
+	if structuring := DetectStructuring(config.Policy, state, subAccount.Hex(), action, grossUSD, now); structuring != nil {
+		reason := structuring.Reason()
+		RaiseAlert(config, runtime, slog.LevelWarn, "ALERT: structured withdrawals", subAccount.Hex(), "subAccount", subAccount.Hex(),
+			"txHash", txHash, "count", structuring.Count, "total", FormatUSD(config, structuring.TotalUSD),
+			"threshold", FormatUSD(config, structuring.ThresholdUSD), "response", config.Policy.Structuring.response())
+		switch config.Policy.Structuring.response() {
+		case AnomalyReview:
+			if !action.NeedsReview {
+				action.NeedsReview, action.ReviewReason = true, reason
+			}
+		case AnomalyReject:
+			if policyErr == nil {
+				policyErr = fmt.Errorf("%w: %s", ErrPolicyViolation, reason)
+			}
+		}
 	}
 
-	callData, err := parsedModuleABI.Pack("updateSubaccountAllowances", subAccount, balanceChange)
+	state.CompactLedger(now.Add(-ledgerRetention(config)))
+	state.RecordLedgerEntry(LedgerEntry{
+		TxHash:     txHash,
+		SubAccount: subAccount.Hex(),
+		Protocol:   action.Protocol,
+		Verb:       action.Verb,
+		GrossUSD:   grossUSD,
+		NetUSD:     accounting.NetUSD,
+		Groups:     accounting.GroupFlows(),
+		At:         now,
+	})
+	state.MarkProcessed(eventID, now)
+
+	if policyErr != nil {
+		args := []any{"subAccount", subAccount.Hex(), "txHash", txHash, "error", policyErr.Error()}
+		args = append(args, simulationAlertArgs(config, runtime, subAccount, event.Transaction, payload)...)
+		RaiseAlert(config, runtime, slog.LevelError, "ALERT: action rejected by policy", subAccount.Hex(), args...)
+		RecordSubaccountFailure(config, runtime, subAccount, policyErr.Error())
+		RecordAudit(config, runtime, AuditRecord{
+			TxHash:       txHash,
+			SubAccount:   subAccount.Hex(),
+			Target:       target.Hex(),
+			Protocol:     action.Protocol,
+			Verb:         string(action.Verb),
+			Confidence:   string(action.Confidence),
+			Token:        accounting.Tokens(),
+			Amount:       accounting.Amounts(),
+			FixedPrices:  accounting.FixedPrices(),
+			CachedPrices: accounting.CachedPrices(),
+			Outcome:      "rejected",
+			Timestamp:    now.Unix(),
+		}.WithInitiator(initiator).WithMethodology(methodology))
+		return nil, policyErr
+	}
+	state.ResetSubaccountFailures(subAccount)
+	state.RecordCachedValuation(config.PriceCache, accounting, now)
+
+	// Submit to the new module once a migration has switched over
+	active := ActiveTarget(config)
+
+	deadLetter := DeadLetter{
+		TxHash:     txHash,
+		Module:     active.ModuleAddress.Hex(),
+		SubAccount: subAccount.Hex(),
+		EventTime:  eventTime,
+		QueuedAt:   runtime.Now(),
+	}
+
+	auditRecord := AuditRecord{
+		TxHash:       deadLetter.TxHash,
+		SubAccount:   subAccount.Hex(),
+		Target:       target.Hex(),
+		Protocol:     action.Protocol,
+		Verb:         string(action.Verb),
+		Confidence:   string(action.Confidence),
+		Token:        accounting.Tokens(),
+		Amount:       accounting.Amounts(),
+		FixedPrices:  accounting.FixedPrices(),
+		CachedPrices: accounting.CachedPrices(),
+		Module:       active.ModuleAddress.Hex(),
+		Timestamp:    runtime.Now().Unix(),
+	}.WithInitiator(initiator).WithMethodology(methodology)
+
+	// Only the verbs returning funds to the Safe credit allowances
+	if accounting.NetUSD.Sign() > 0 && !action.Credits() {
+		logger.Info("Action does not credit allowances", "protocol", action.Protocol, "verb", string(action.Verb))
+		return &ExecutionResult{Message: "Not a crediting action", Success: true}, nil
+	}
+
+	// Token-native modules take the net amount of every token instead of USD
+	if config.TokenNative != nil {
+		return submitTokenBalanceChanges(config, runtime, evmClient, logger, action, accounting, deadLetter, auditRecord, payload.BlockNumber)
+	}
+
+	// Only a net inflow credits allowances. The module takes an unsigned
+	// balance change, so a net outflow cannot be debited and is reported,
+	// except for deposits: their tokens were approved through approveProtocol,
+	// which already charged the subaccount's allowance.
+	if accounting.NetUSD.Sign() == 0 {
+		return &ExecutionResult{Message: "No net inflow", Success: true}, nil
+	}
+	if accounting.NetUSD.Sign() < 0 && action.Verb == VerbDeposit {
+		logger.Info("Deposit charged at approval, nothing to submit", "protocol", action.Protocol, "value", FormatUSD(config, accounting.NetUSD))
+		return &ExecutionResult{Message: "No net inflow", Success: true}, nil
+	}
+	if accounting.NetUSD.Sign() < 0 {
+		RaiseAlert(config, runtime, slog.LevelWarn, "ALERT: net outflow not debited", subAccount.Hex(), "subAccount", subAccount.Hex(),
+			"txHash", txHash, "protocol", action.Protocol, "verb", string(action.Verb), "value", FormatUSD(config, accounting.NetUSD))
+		return &ExecutionResult{Message: "No net inflow", Success: true}, nil
+	}
+	balanceChange := new(big.Int).Set(accounting.NetUSD)
+
+	// Make sure the value fits the module's balanceChange parameter. Values in
+	// other units are checked once converted, at submission.
+	precision := config.Precision
+	if balanceChangeUnit(ActiveTarget(config)) != UnitUSD {
+		precision = nil
+	}
+	guarded, clamped, err := ApplyPrecisionGuard(precision, balanceChange)
 	if err != nil {
-		return nil, fmt.Errorf("failed to pack updateSubaccountAllowances call: %w", err)
+		args := []any{"subAccount", subAccount.Hex(), "value", FormatUSD(config, balanceChange), "error", err.Error()}
+		args = append(args, simulationAlertArgs(config, runtime, subAccount, event.Transaction, payload)...)
+		RaiseAlert(config, runtime, slog.LevelError, "ALERT: balance change blocked", subAccount.Hex(), args...)
+		return nil, err
 	}
+	if clamped {
+		RaiseAlert(config, runtime, slog.LevelError, "ALERT: balance change clamped", subAccount.Hex(), "subAccount", subAccount.Hex(), "value", FormatUSD(config, balanceChange), "clampedTo", FormatUSD(config, guarded))
+	}
+	balanceChange = guarded
+	deadLetter.BalanceChange = balanceChange
+	auditRecord.BalanceChange = balanceChange.String()
 
-	logger.Info("Calling updateSubaccountAllowances", "subAccount", subAccount.Hex(), "balanceChange", balanceChange.String())
+	return routeAllowanceUpdate(config, runtime, evmClient, logger, action, deadLetter, auditRecord, payload.BlockNumber)
+}
 
-	// Create report for the transaction
-	proxyAddr := common.HexToAddress(config.ProxyAddress)
+// routeAllowanceUpdate holds an allowance update for review, shadows it on
+// standbys, queues it while updates or the module are paused, batches it
+// while processing is degraded, and otherwise submits it to the module and
+// its mirrors
+func routeAllowanceUpdate(config *Config, runtime cre.Runtime, evmClient *evm.Client, logger *slog.Logger, action *Action,
+	deadLetter DeadLetter, auditRecord AuditRecord, blockNumber *pb.BigInt) (*ExecutionResult, error) {
+	active := ActiveTarget(config)
+	txHash := deadLetter.TxHash
+	subAccount := common.HexToAddress(deadLetter.SubAccount)
+	balanceChange := formatBalanceChange(config, deadLetter)
+
+	// Monitor-only workflows record what they would submit
+	if config.MonitorOnly {
+		auditRecord.Outcome = "monitored"
+		RecordAudit(config, runtime, auditRecord)
+		return &ExecutionResult{Message: "Monitor only: allowance update not submitted", Success: true}, nil
+	}
+
+	// Low-confidence actions wait for an operator instead of being submitted
+	if action.NeedsReview {
+		state.QueueReview(ReviewItem{Letter: deadLetter, Protocol: action.Protocol, Verb: action.Verb, Reason: action.ReviewReason})
+		RaiseAlert(config, runtime, slog.LevelWarn, "ALERT: action needs review", subAccount.Hex(), "subAccount", subAccount.Hex(),
+			"txHash", txHash, "reason", action.ReviewReason, "value", balanceChange)
+		auditRecord.Outcome = "review"
+		RecordAudit(config, runtime, auditRecord)
+		return &ExecutionResult{Message: "Action held for review", Success: true}, nil
+	}
+
+	// Standbys compute the same decision but leave submission to the leader.
+	// Only USD updates are compared with the leader's allowance events.
+	if !IsLeader(config, runtime, logger) {
+		if deadLetter.Token == "" && balanceChangeUnit(active) == UnitUSD {
+			state.RecordShadow(ShadowDecision{
+				TxHash:        txHash,
+				Module:        active.ModuleAddress.Hex(),
+				SubAccount:    subAccount,
+				BalanceChange: deadLetter.BalanceChange,
+				BlockNumber:   blockNumber,
+				DecidedAt:     runtime.Now(),
+			})
+		}
+		auditRecord.Outcome = "shadowed"
+		RecordAudit(config, runtime, auditRecord)
+		return &ExecutionResult{Message: "Standby: decision shadowed", Success: true}, nil
+	}
+
+	if state.Paused {
+		logger.Warn("Allowance updates paused, queueing event", "reason", state.PausedReason)
+		deadLetter.Reason = pausedReasonPrefix + state.PausedReason
+		state.AddDeadLetter(deadLetter)
+		QueueMirrorDeadLetters(config, deadLetter, runtime.Now())
+		auditRecord.Outcome = "paused"
+		RecordAudit(config, runtime, auditRecord)
+		return &ExecutionResult{Message: "Allowance updates paused", Success: true}, nil
+	}
+
+	// A backed up queue degrades to one batched update per subaccount
+	if Degraded(config, runtime) {
+		logger.Warn("Processing degraded, batching allowance update", "depth", state.QueueDepth())
+		state.BatchUpdate(deadLetter)
+		for _, mirror := range activeMirrors(config, runtime.Now()) {
+			mirrorLetter := deadLetter
+			mirrorLetter.Module = mirror.ModuleAddress.Hex()
+			state.BatchUpdate(mirrorLetter)
+		}
+		auditRecord.Outcome = "batched"
+		RecordAudit(config, runtime, auditRecord)
+		return &ExecutionResult{Message: "Processing degraded, allowance update batched", Success: true}, nil
+	}
 
-	reportPromise := runtime.GenerateReport(&cre.ReportRequest{
-		EncodedPayload: callData,
-	})
+	logger.Info("Submitting allowance update", "subAccount", config.Audit.LogValue("subAccount", subAccount.Hex()), "balanceChange", config.Audit.LogValue("balanceChange", balanceChange))
 
-	reportData, err := reportPromise.Await()
-	if err != nil {
-		return nil, fmt.Errorf("failed to await report: %w", err)
+	writeResult, err := SubmitLetter(active, runtime, evmClient, deadLetter, active.GasLimit)
+	if err == nil {
+		err = CheckWriteResult(writeResult)
 	}
+	state.RecordModuleResult(active.ModuleAddress.Hex(), err, runtime.Now())
 
-	// Submit transaction via WriteReport
-	writeReq := &evm.WriteCreReportRequest{
-		Receiver: proxyAddr.Bytes(),
-		Report:   reportData,
-		GasConfig: &evm.GasConfig{
-			GasLimit: config.GasLimit,
-		},
-	}
+	// Mirrors are updated independently of the primary outcome
+	SubmitToMirrors(config, runtime, evmClient, logger, deadLetter)
 
-	writePromise := evmClient.WriteReport(runtime, writeReq)
-	writeResult, err := writePromise.Await()
 	if err != nil {
+		deadLetter.Reason = err.Error()
+		state.AddDeadLetter(deadLetter)
+		auditRecord.Outcome = "failed"
+		RecordAudit(config, runtime, auditRecord)
 		return nil, fmt.Errorf("failed to send transaction: %w", err)
 	}
 
-	txHash := hex.EncodeToString(writeResult.TxHash)
-	logger.Info("Successfully updated allowances", "subAccount", subAccount.Hex(), "txHash", "0x"+txHash)
+	if !deadLetter.EventTime.IsZero() {
+		state.RecordSubmission(deadLetter.EventTime, runtime.Now())
+	}
+
+	writeTxHash := hex.EncodeToString(writeResult.TxHash)
+	logger.Info("Successfully updated allowances", "subAccount", config.Audit.LogValue("subAccount", subAccount.Hex()), "txHash", "0x"+writeTxHash)
+
+	auditRecord.Outcome = "submitted"
+	RecordAudit(config, runtime, auditRecord)
 
 	return &ExecutionResult{
 		Message: fmt.Sprintf("Success: Updated allowances for %s, amount: %s, txHash: 0x%s",
-			subAccount.Hex(), balanceChange.String(), txHash),
+			config.Audit.LogValue("subAccount", subAccount.Hex()), config.Audit.LogValue("balanceChange", balanceChange), writeTxHash),
 		Success: true,
 	}, nil
 }
 
-// InitWorkflow initializes the workflow with EVM log trigger
-func InitWorkflow(config *Config, logger *slog.Logger, secretsProvider cre.SecretsProvider) (cre.Workflow[*Config], error) {
-	// Parse chain selector
-	chainSelector := new(big.Int)
-	chainSelector.SetString(config.ChainSelector, 10)
-
-	// Create EVM log trigger for ProtocolExecuted events
-	// ProtocolExecuted(address indexed subAccount, address indexed target, uint256 timestamp)
-	eventSignature := crypto.Keccak256Hash([]byte("ProtocolExecuted(address,address,uint256)"))
-	moduleAddr := common.HexToAddress(config.ModuleAddress)
-
-	logTrigger := evm.LogTrigger(chainSelector.Uint64(), &evm.FilterLogTriggerRequest{
-		Addresses: [][]byte{moduleAddr.Bytes()},
-		Topics: []*evm.TopicValues{
-			{Values: [][]byte{eventSignature.Bytes()}},
-			{Values: [][]byte{}}, // subAccount (any)
-			{Values: [][]byte{}}, // target (any)
-			{Values: [][]byte{}}, // timestamp (not indexed, but we need 4 topic slots)
-		},
-	})
+// newEVMClient creates an EVM client for the configured chain
+func newEVMClient(config *Config) *evm.Client {
+	return &evm.Client{
+		ChainSelector: config.ChainSelector.Uint64(),
+	}
+}
 
-	return cre.Workflow[*Config]{
-		cre.Handler(logTrigger, OnProtocolExecuted),
-	}, nil
+// subAccountTopics returns the indexed subAccount values to filter the log
+// trigger on. Single-tenant deployments list their subaccounts so events of
+// other subaccounts are never delivered; an empty list matches any subaccount.
+// It fails when subaccounts are listed but none belongs to this shard, since
+// the empty filter would then subscribe the shard to every subaccount.
+func subAccountTopics(config *Config) ([][]byte, error) {
+	topics := [][]byte{}
+	for _, subAccount := range config.SubAccounts {
+		addr := subAccount.Address
+		if !OwnsSubaccount(config, addr) {
+			continue
+		}
+		topics = append(topics, common.LeftPadBytes(addr.Bytes(), 32))
+	}
+	if len(config.SubAccounts) > 0 && len(topics) == 0 {
+		return nil, fmt.Errorf("none of the configured subAccounts belongs to shard %d", config.Sharding.Index)
+	}
+	return topics, nil
+}
+
+// InitWorkflow builds the workflow of the configuration, with every
+// registered protocol and the configured pricing and policy
+func InitWorkflow(config *Config, logger *slog.Logger, secretsProvider cre.SecretsProvider) (cre.Workflow[*Config], error) {
+	return NewAccountingWorkflow(config).WithLogger(logger).Build()
 }
 
 func main() {
-	wasm.NewRunner(cre.ParseJSON[Config]).Run(InitWorkflow)
+	wasm.NewRunner(ParseConfig).Run(InitWorkflow)
 }
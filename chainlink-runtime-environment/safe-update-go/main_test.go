@@ -0,0 +1,147 @@
+//go:build wasip1
+
+package main
+
+import (
+	"encoding/hex"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+
+	"safe-update-go/scenarios"
+)
+
+// maxUint256 is type(uint256).max, the largest amount calldata can carry
+const maxUint256 = "115792089237316195423570985008687907853269984665640564039457584007913129639935"
+
+// bigInt parses a base 10 integer for test tables
+func bigInt(t *testing.T, s string) *big.Int {
+	t.Helper()
+	v, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		t.Fatalf("invalid integer %q", s)
+	}
+	return v
+}
+
+// e returns n zeros, to write amounts as mantissa + e(decimals)
+func e(n int) string {
+	return strings.Repeat("0", n)
+}
+
+// wordCalldata lays out calldata byte by byte, so the tests pin the offsets
+// the decoders read rather than re-deriving them with an ABI encoder. Words
+// are given as addresses, written to the low 20 bytes of their word, or as
+// amounts.
+func wordCalldata(t *testing.T, selector string, words ...any) []byte {
+	t.Helper()
+	calldata, err := hex.DecodeString(selector)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, word := range words {
+		switch w := word.(type) {
+		case common.Address:
+			calldata = append(calldata, common.LeftPadBytes(w.Bytes(), 32)...)
+		case *big.Int:
+			calldata = append(calldata, common.LeftPadBytes(w.Bytes(), 32)...)
+		case int:
+			calldata = append(calldata, common.LeftPadBytes(big.NewInt(int64(w)).Bytes(), 32)...)
+		default:
+			t.Fatalf("unsupported word %T", word)
+		}
+	}
+	return calldata
+}
+
+// abiCalldata packs a call of a method of a JSON ABI, selected by its
+// selector when the ABI overloads the method's name
+func abiCalldata(t *testing.T, abiJSON string, selector string, args ...interface{}) []byte {
+	t.Helper()
+	parsed, err := abi.JSON(strings.NewReader(abiJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := hex.DecodeString(selector)
+	if err != nil {
+		t.Fatal(err)
+	}
+	method, err := parsed.MethodById(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := method.Inputs.Pack(args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append(id, data...)
+}
+
+func TestCalculateUSDValue(t *testing.T) {
+	tests := []struct {
+		name          string
+		amount        string
+		tokenDecimals uint8
+		price         string
+		priceDecimals uint8
+		want          string
+	}{
+		{"0 decimals: 5 tokens at $2", "5", 0, "2" + e(8), 8, "10" + e(18)},
+		{"0 decimals feed: 3 USDC at $7", "3" + e(6), 6, "7", 0, "21" + e(18)},
+		{"6 decimals: 1000 USDC at $1", "1000" + e(6), 6, "1" + e(8), 8, "1000" + e(18)},
+		{"6 decimals: 1 USDC at $0.999", "1" + e(6), 6, "999" + e(5), 8, "999" + e(15)},
+		{"6 decimals: 1 wei of USDC", "1", 6, "1" + e(8), 8, "1" + e(12)},
+		{"8 decimals: 1 WBTC at $65000", "1" + e(8), 8, "65000" + e(8), 8, "65000" + e(18)},
+		{"18 decimals: 1.5 WETH at $3000.12", "15" + e(17), 18, "300012" + e(6), 8, "450018" + e(16)},
+		{"18 decimals: 18 decimal feed", "2" + e(18), 18, "1" + e(18), 18, "2" + e(18)},
+		{"18 decimals: 1 wei at $1", "1", 18, "1" + e(8), 8, "1"},
+		{"24 decimals: 1 token at $1", "1" + e(24), 24, "1" + e(8), 8, "1" + e(18)},
+		{"24 decimals: smallest valued amount", "1" + e(6), 24, "1" + e(8), 8, "1"},
+		{"24 decimals: dust truncates to zero", "999999", 24, "1" + e(8), 8, "0"},
+		{"zero amount", "0", 18, "3000" + e(8), 8, "0"},
+		{"zero price", "1" + e(18), 18, "0", 8, "0"},
+		{"max uint256 at $1", maxUint256, 18, "1" + e(8), 8, maxUint256},
+		{"max uint256 with 18 decimal feed", maxUint256, 18, "1" + e(18), 18, maxUint256},
+		{"max uint256 of a 0 decimal token at $3000", maxUint256, 0, "3000" + e(8), 8,
+			"347376267711948586270712955026063723559809953996921692118372752023739388919805" + e(21)},
+		{"max uint256 of a 24 decimal token at $1", maxUint256, 24, "1" + e(8), 8,
+			"115792089237316195423570985008687907853269984665640564039457584007913129"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			amount, price := bigInt(t, tt.amount), bigInt(t, tt.price)
+			got := CalculateUSDValue(amount, tt.tokenDecimals, price, tt.priceDecimals)
+			if got.String() != tt.want {
+				t.Errorf("CalculateUSDValue = %s, want %s", got, tt.want)
+			}
+			if amount.String() != tt.amount || price.String() != tt.price {
+				t.Errorf("CalculateUSDValue modified its arguments: %s, %s", amount, price)
+			}
+		})
+	}
+}
+
+// TestDepositOutflowNotAlerted supplies to Aave: the deposit was charged at
+// approval, so its outflow is recorded in the ledger without an alert
+func TestDepositOutflowNotAlerted(t *testing.T) {
+	h := newHarness(t)
+	h.config.Alerts = &AlertConfig{GroupWindowSeconds: 3600}
+	const alert = "ALERT: net outflow not debited"
+
+	supply := h.chain.protocolExecuted(t.Name()+" supply", scenarios.Pool,
+		scenarios.AaveSupply(scenarios.Token, scenarios.USD(1000), scenarios.Safe), h.runtime.now)
+	if h.deliver(supply) {
+		t.Fatal("update submitted for a deposit")
+	}
+	if len(state.Ledger) != 1 || state.Ledger[0].Verb != VerbDeposit {
+		t.Fatalf("deposit not recorded in the ledger: %+v", state.Ledger)
+	}
+	for id := range state.AlertGroups {
+		if strings.HasPrefix(id, alert) {
+			t.Fatalf("deposit raised %s", id)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+//go:build wasip1
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/blockchain/evm"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+)
+
+// Exit(address indexed dst, uint256 wad), emitted by the Maker DsrManager
+var dsrExitSignature = crypto.Keccak256Hash([]byte("Exit(address,uint256)"))
+
+// ResolveDSRExit settles DsrManager exits from the receipt. The DAI credited
+// is the wad of the manager's Exit event, and its token is found by the DAI
+// minted to dst for that amount. sDAI withdrawals need no receipt: their
+// shares are converted to DAI with convertToAssets during accounting. An
+// exit(address,uint256) on another contract, such as a Maker join adapter,
+// has no Exit event and is left to the fallback decoders.
+func ResolveDSRExit(runtime cre.Runtime, evmClient *evm.Client, logger *slog.Logger, action *Action, calldata []byte, txHash []byte) error {
+	if action.Selector != DSRManagerExitSelector && action.Selector != DSRManagerExitAllSelector {
+		return nil
+	}
+
+	reply, err := evmClient.GetTransactionReceipt(runtime, &evm.GetTransactionReceiptRequest{Hash: txHash}).Await()
+	if err != nil {
+		return fmt.Errorf("failed to get transaction receipt: %w", err)
+	}
+	if reply.Receipt == nil {
+		return fmt.Errorf("transaction receipt not found")
+	}
+	logs := reply.Receipt.Logs
+
+	for _, log := range logs {
+		if common.BytesToAddress(log.Address) != action.Counterparty || len(log.Topics) != 2 || len(log.Data) < 32 ||
+			!bytes.Equal(log.Topics[0], dsrExitSignature.Bytes()) || common.BytesToAddress(log.Topics[1]) != action.Recipient {
+			continue
+		}
+		wad := new(big.Int).SetBytes(log.Data[:32])
+
+		dai, ok := transferredToken(logs, action.Recipient, wad)
+		if !ok {
+			return fmt.Errorf("no DAI transfer of %s to %s in receipt", wad, action.Recipient.Hex())
+		}
+
+		action.AssetsIn = []AssetAmount{{Token: dai, Amount: wad}}
+		logger.Info("DSR exit settled", "dai", dai.Hex(), "wad", wad.String(), "dst", action.Recipient.Hex())
+		return nil
+	}
+
+	return fmt.Errorf("%w: no DsrManager Exit from %s in receipt", ErrUnknownSelector, action.Counterparty.Hex())
+}
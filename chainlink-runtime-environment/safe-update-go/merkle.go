@@ -0,0 +1,93 @@
+//go:build wasip1
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// MerkleTree represents a binary Merkle tree with sorted pair hashing, the
+// scheme verified by OpenZeppelin's MerkleProof library
+type MerkleTree struct {
+	Leaves []common.Hash
+	layers [][]common.Hash
+}
+
+// hashPair hashes two nodes in ascending order
+func hashPair(a, b common.Hash) common.Hash {
+	if bytes.Compare(a.Bytes(), b.Bytes()) > 0 {
+		a, b = b, a
+	}
+	return crypto.Keccak256Hash(a.Bytes(), b.Bytes())
+}
+
+// NewMerkleTree builds a tree over leaves. Leaves are sorted so the root only
+// depends on the set of leaves. An odd node is promoted to the next layer.
+func NewMerkleTree(leaves []common.Hash) *MerkleTree {
+	sorted := append([]common.Hash(nil), leaves...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return bytes.Compare(sorted[i].Bytes(), sorted[j].Bytes()) < 0
+	})
+
+	tree := &MerkleTree{Leaves: sorted, layers: [][]common.Hash{sorted}}
+	for layer := sorted; len(layer) > 1; {
+		next := make([]common.Hash, 0, (len(layer)+1)/2)
+		for i := 0; i < len(layer); i += 2 {
+			if i+1 == len(layer) {
+				next = append(next, layer[i])
+				continue
+			}
+			next = append(next, hashPair(layer[i], layer[i+1]))
+		}
+		tree.layers = append(tree.layers, next)
+		layer = next
+	}
+	return tree
+}
+
+// Root returns the root of the tree, or the zero hash for an empty tree
+func (t *MerkleTree) Root() common.Hash {
+	top := t.layers[len(t.layers)-1]
+	if len(top) == 0 {
+		return common.Hash{}
+	}
+	return top[0]
+}
+
+// Proof returns the sibling hashes proving that leaf is in the tree
+func (t *MerkleTree) Proof(leaf common.Hash) ([]common.Hash, error) {
+	index := -1
+	for i, l := range t.Leaves {
+		if l == leaf {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return nil, fmt.Errorf("leaf %s not in tree", leaf.Hex())
+	}
+
+	var proof []common.Hash
+	for _, layer := range t.layers[:len(t.layers)-1] {
+		sibling := index ^ 1
+		if sibling < len(layer) {
+			proof = append(proof, layer[sibling])
+		}
+		index /= 2
+	}
+	return proof, nil
+}
+
+// VerifyMerkleProof recomputes the root from a leaf and its proof
+func VerifyMerkleProof(root common.Hash, leaf common.Hash, proof []common.Hash) bool {
+	computed := leaf
+	for _, sibling := range proof {
+		computed = hashPair(computed, sibling)
+	}
+	return computed == root
+}
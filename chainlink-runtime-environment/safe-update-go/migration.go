@@ -0,0 +1,333 @@
+//go:build wasip1
+
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/blockchain/evm"
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/scheduler/cron"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+)
+
+// Role IDs defined by DeFiInteractorModule
+const (
+	DefiExecuteRole  uint16 = 1
+	DefiTransferRole uint16 = 2
+)
+
+// MigrationConfig represents a migration from moduleAddress to a new module
+type MigrationConfig struct {
+	Schedule       string       `json:"schedule"`
+	NewModule      MirrorConfig `json:"newModule"`
+	RoleIDs        []uint16     `json:"roleIds,omitempty"`
+	SwitchOnParity bool         `json:"switchOnParity"`
+}
+
+// MigrationPhase represents the step a migration is at
+type MigrationPhase string
+
+const (
+	MigrationSnapshot MigrationPhase = "snapshot"
+	MigrationReplay   MigrationPhase = "replay"
+	MigrationVerify   MigrationPhase = "verify"
+	MigrationSwitched MigrationPhase = "switched"
+)
+
+// SubaccountSnapshot represents the allowance-related state of a subaccount on a module
+type SubaccountSnapshot struct {
+	SubAccount    common.Address
+	Roles         map[uint16]bool
+	Limits        *SubAccountLimits
+	WindowStart   *big.Int
+	ApprovedValue *big.Int
+}
+
+// OwnerCall represents an owner-only call the module owner (the Safe) must execute
+type OwnerCall struct {
+	To          string `json:"to"`
+	Data        string `json:"data"`
+	Description string `json:"description"`
+}
+
+// MigrationState represents the progress of a module migration
+type MigrationState struct {
+	Phase      MigrationPhase
+	Snapshot   []SubaccountSnapshot
+	OwnerCalls []OwnerCall
+	Mismatches []string
+}
+
+// migrationRoles returns the roles to migrate, defaulting to all module roles
+func migrationRoles(migration *MigrationConfig) []uint16 {
+	if len(migration.RoleIDs) > 0 {
+		return migration.RoleIDs
+	}
+	return []uint16{DefiExecuteRole, DefiTransferRole}
+}
+
+// ActiveTarget returns the config allowance updates are submitted with: the new
+// module once a migration has switched over, the workflow config otherwise
+func ActiveTarget(config *Config) *Config {
+	if config.Migration != nil && state.Migration != nil && state.Migration.Phase == MigrationSwitched {
+		return config.Migration.NewModule.TargetConfig(config)
+	}
+	return config
+}
+
+// SnapshotModule reads the role members, limits and used allowance of every
+// subaccount holding one of the given roles
+func SnapshotModule(runtime cre.Runtime, evmClient *evm.Client, moduleAddr common.Address, roles []uint16) ([]SubaccountSnapshot, error) {
+	bySubAccount := make(map[common.Address]*SubaccountSnapshot)
+	var order []common.Address
+
+	for _, roleID := range roles {
+		members, err := GetSubaccountsByRole(runtime, evmClient, moduleAddr, roleID)
+		if err != nil {
+			return nil, err
+		}
+		for _, member := range members {
+			snapshot, ok := bySubAccount[member]
+			if !ok {
+				snapshot = &SubaccountSnapshot{SubAccount: member, Roles: make(map[uint16]bool)}
+				bySubAccount[member] = snapshot
+				order = append(order, member)
+			}
+			snapshot.Roles[roleID] = true
+		}
+	}
+
+	snapshots := make([]SubaccountSnapshot, 0, len(order))
+	for _, subAccount := range order {
+		snapshot, err := snapshotSubaccount(runtime, evmClient, moduleAddr, subAccount)
+		if err != nil {
+			return nil, err
+		}
+		snapshot.Roles = bySubAccount[subAccount].Roles
+		snapshots = append(snapshots, *snapshot)
+	}
+
+	return snapshots, nil
+}
+
+// snapshotSubaccount reads the limits and used allowance of one subaccount
+func snapshotSubaccount(runtime cre.Runtime, evmClient *evm.Client, moduleAddr common.Address, subAccount common.Address) (*SubaccountSnapshot, error) {
+	limits, err := GetSubAccountLimits(runtime, evmClient, moduleAddr, subAccount)
+	if err != nil {
+		return nil, err
+	}
+	windowStart, err := GetExecutionWindowStart(runtime, evmClient, moduleAddr, subAccount)
+	if err != nil {
+		return nil, err
+	}
+	approved, err := GetValueApprovedInWindow(runtime, evmClient, moduleAddr, subAccount)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SubaccountSnapshot{
+		SubAccount:    subAccount,
+		Roles:         make(map[uint16]bool),
+		Limits:        limits,
+		WindowStart:   windowStart,
+		ApprovedValue: approved,
+	}, nil
+}
+
+// OnMigrationStep is the handler for the migration cron trigger. Each run
+// advances the migration by one phase: snapshot the old module, replay its
+// state onto the new module, verify parity, and switch the active target.
+func OnMigrationStep(config *Config, runtime cre.Runtime, payload *cron.Payload) (*ExecutionResult, error) {
+	logger := runtime.Logger()
+
+	if !IsLeader(config, runtime, logger) {
+		return &ExecutionResult{Message: "Standby: migration left to the leader", Success: true}, nil
+	}
+
+	if state.Migration == nil {
+		state.Migration = &MigrationState{Phase: MigrationSnapshot}
+	}
+	migration := state.Migration
+	logger.Info("Migration step triggered", "phase", string(migration.Phase))
+
+	evmClient := newEVMClient(config)
+	oldModule := config.ModuleAddress.Address
+	newTarget := config.Migration.NewModule.TargetConfig(config)
+	newModule := newTarget.ModuleAddress.Address
+	roles := migrationRoles(config.Migration)
+
+	switch migration.Phase {
+	case MigrationSnapshot:
+		snapshot, err := SnapshotModule(runtime, evmClient, oldModule, roles)
+		if err != nil {
+			return nil, fmt.Errorf("failed to snapshot module %s: %w", oldModule.Hex(), err)
+		}
+		migration.Snapshot = snapshot
+		migration.Phase = MigrationReplay
+		return &ExecutionResult{Message: fmt.Sprintf("Snapshot of %d subaccounts taken", len(snapshot)), Success: true}, nil
+
+	case MigrationReplay:
+		if err := Preflight(newTarget, runtime, evmClient); err != nil {
+			return nil, err
+		}
+		calls, err := replayMigration(newTarget, runtime, evmClient, logger, migration.Snapshot, roles)
+		if err != nil {
+			return nil, err
+		}
+		migration.OwnerCalls = calls
+		migration.Phase = MigrationVerify
+
+		batch, err := json.Marshal(calls)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode owner calls: %w", err)
+		}
+		logger.Info("Owner calls required on new module", "module", newModule.Hex(), "count", len(calls), "calls", string(batch))
+		return &ExecutionResult{Message: fmt.Sprintf("Replay done, %d owner calls required", len(calls)), Success: true}, nil
+
+	case MigrationVerify:
+		mismatches, err := verifyMigration(runtime, evmClient, oldModule, newModule, roles)
+		if err != nil {
+			return nil, err
+		}
+		migration.Mismatches = mismatches
+		if len(mismatches) > 0 {
+			logger.Warn("Migration parity not reached", "mismatches", mismatches)
+			return &ExecutionResult{Message: fmt.Sprintf("%d parity mismatches", len(mismatches)), Success: true}, nil
+		}
+		if !config.Migration.SwitchOnParity {
+			logger.Info("Migration parity reached, waiting for switchOnParity")
+			return &ExecutionResult{Message: "Parity reached", Success: true}, nil
+		}
+		migration.Phase = MigrationSwitched
+		logger.Info("Migration switched active module", "from", oldModule.Hex(), "to", newModule.Hex())
+		return &ExecutionResult{Message: "Switched to " + newModule.Hex(), Success: true}, nil
+	}
+
+	return &ExecutionResult{Message: "Migration complete", Success: true}, nil
+}
+
+// replayMigration brings the new module in line with the snapshot. Owner-only
+// settings are returned as calls for the Safe to execute; used allowances that
+// are higher on the new module are credited through updateSubaccountAllowances.
+func replayMigration(target *Config, runtime cre.Runtime, evmClient *evm.Client, logger *slog.Logger, snapshot []SubaccountSnapshot, roles []uint16) ([]OwnerCall, error) {
+	parsedModuleABI, err := abi.JSON(strings.NewReader(moduleABI))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse module ABI: %w", err)
+	}
+
+	newModule := target.ModuleAddress.Address
+	var calls []OwnerCall
+
+	for _, old := range snapshot {
+		current, err := snapshotSubaccount(runtime, evmClient, newModule, old.SubAccount)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, roleID := range roles {
+			if !old.Roles[roleID] {
+				continue
+			}
+			hasRole, err := HasRole(runtime, evmClient, newModule, old.SubAccount, roleID)
+			if err != nil {
+				return nil, err
+			}
+			if hasRole {
+				continue
+			}
+			data, err := parsedModuleABI.Pack("grantRole", old.SubAccount, roleID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to pack grantRole call: %w", err)
+			}
+			calls = append(calls, OwnerCall{
+				To:          newModule.Hex(),
+				Data:        "0x" + hex.EncodeToString(data),
+				Description: fmt.Sprintf("grantRole(%s, %d)", old.SubAccount.Hex(), roleID),
+			})
+		}
+
+		if !limitsEqual(old.Limits, current.Limits) {
+			data, err := parsedModuleABI.Pack("setSubAccountLimits", old.SubAccount,
+				old.Limits.MaxLossBps, old.Limits.MaxTransferBps, old.Limits.WindowDuration)
+			if err != nil {
+				return nil, fmt.Errorf("failed to pack setSubAccountLimits call: %w", err)
+			}
+			calls = append(calls, OwnerCall{
+				To:   newModule.Hex(),
+				Data: "0x" + hex.EncodeToString(data),
+				Description: fmt.Sprintf("setSubAccountLimits(%s, %s, %s, %s)", old.SubAccount.Hex(),
+					old.Limits.MaxLossBps, old.Limits.MaxTransferBps, old.Limits.WindowDuration),
+			})
+		}
+
+		// The workflow can only credit allowances, so only a higher used value is replayed
+		if current.WindowStart.Sign() != 0 && current.ApprovedValue.Cmp(old.ApprovedValue) > 0 {
+			credit := new(big.Int).Sub(current.ApprovedValue, old.ApprovedValue)
+			logger.Info("Replaying allowance credit", "subAccount", old.SubAccount.Hex(), "credit", FormatUSD(target, credit))
+
+			writeResult, err := SubmitAllowanceUpdate(target, runtime, evmClient, old.SubAccount, credit, target.GasLimit)
+			if err == nil {
+				err = CheckWriteResult(writeResult)
+			}
+			state.RecordModuleResult(target.ModuleAddress.Hex(), err, runtime.Now())
+			if err != nil {
+				return nil, fmt.Errorf("failed to replay allowance of %s: %w", old.SubAccount.Hex(), err)
+			}
+		}
+	}
+
+	return calls, nil
+}
+
+// verifyMigration compares a fresh snapshot of both modules and returns the differences
+func verifyMigration(runtime cre.Runtime, evmClient *evm.Client, oldModule common.Address, newModule common.Address, roles []uint16) ([]string, error) {
+	oldSnapshot, err := SnapshotModule(runtime, evmClient, oldModule, roles)
+	if err != nil {
+		return nil, err
+	}
+	newSnapshot, err := SnapshotModule(runtime, evmClient, newModule, roles)
+	if err != nil {
+		return nil, err
+	}
+
+	byAddress := make(map[common.Address]SubaccountSnapshot, len(newSnapshot))
+	for _, snapshot := range newSnapshot {
+		byAddress[snapshot.SubAccount] = snapshot
+	}
+
+	var mismatches []string
+	for _, old := range oldSnapshot {
+		current, ok := byAddress[old.SubAccount]
+		if !ok {
+			mismatches = append(mismatches, fmt.Sprintf("%s: missing on new module", old.SubAccount.Hex()))
+			continue
+		}
+		for roleID := range old.Roles {
+			if !current.Roles[roleID] {
+				mismatches = append(mismatches, fmt.Sprintf("%s: missing role %d", old.SubAccount.Hex(), roleID))
+			}
+		}
+		if !limitsEqual(old.Limits, current.Limits) {
+			mismatches = append(mismatches, fmt.Sprintf("%s: limits differ", old.SubAccount.Hex()))
+		}
+		if old.WindowStart.Sign() != 0 && current.WindowStart.Sign() != 0 && old.ApprovedValue.Cmp(current.ApprovedValue) != 0 {
+			mismatches = append(mismatches, fmt.Sprintf("%s: used allowance %s != %s",
+				old.SubAccount.Hex(), old.ApprovedValue, current.ApprovedValue))
+		}
+	}
+
+	return mismatches, nil
+}
+
+func limitsEqual(a, b *SubAccountLimits) bool {
+	return a.MaxLossBps.Cmp(b.MaxLossBps) == 0 &&
+		a.MaxTransferBps.Cmp(b.MaxTransferBps) == 0 &&
+		a.WindowDuration.Cmp(b.WindowDuration) == 0
+}
@@ -0,0 +1,130 @@
+//go:build wasip1
+
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/blockchain/evm"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+)
+
+// MirrorConfig represents a secondary module that receives a copy of every
+// allowance update, e.g. the new deployment during a module migration
+type MirrorConfig struct {
+	ModuleAddress    Address `json:"moduleAddress"`
+	SubmissionMode   string  `json:"submissionMode,omitempty"`
+	ProxyAddress     Address `json:"proxyAddress,omitempty"`
+	ForwarderAddress Address `json:"forwarderAddress,omitempty"`
+	ModuleReceiver   bool    `json:"moduleReceiver,omitempty"`
+	GasLimit         uint64  `json:"gasLimit,omitempty"`
+	UntilTimestamp   int64   `json:"untilTimestamp,omitempty"`
+
+	ValueTransform *ValueTransformConfig `json:"valueTransform,omitempty"`
+}
+
+// MirrorResult represents the outcome of mirroring an update to one module
+type MirrorResult struct {
+	Module string
+	TxHash string
+	Err    error
+}
+
+// TargetConfig returns a copy of the workflow config pointing at the mirror module
+func (m MirrorConfig) TargetConfig(config *Config) *Config {
+	target := *config
+	target.ModuleAddress = m.ModuleAddress
+	target.SubmissionMode = m.SubmissionMode
+	target.ProxyAddress = m.ProxyAddress
+	target.ForwarderAddress = m.ForwarderAddress
+	target.ModuleReceiver = m.ModuleReceiver
+	target.ValueTransform = m.ValueTransform
+	if m.GasLimit != 0 {
+		target.GasLimit = m.GasLimit
+	}
+	target.Mirrors = nil
+	target.Migration = nil
+	return &target
+}
+
+// TargetForModule returns the config used to submit to a module: the workflow
+// config for the primary module ("" or moduleAddress), or the mirror's or
+// migration target's config
+func (c *Config) TargetForModule(module string) (*Config, error) {
+	if module == "" || strings.EqualFold(module, c.ModuleAddress.Hex()) {
+		return c, nil
+	}
+
+	if c.Migration != nil && strings.EqualFold(c.Migration.NewModule.ModuleAddress.Hex(), module) {
+		return c.Migration.NewModule.TargetConfig(c), nil
+	}
+
+	for _, mirror := range c.Mirrors {
+		if strings.EqualFold(mirror.ModuleAddress.Hex(), module) {
+			return mirror.TargetConfig(c), nil
+		}
+	}
+
+	return nil, fmt.Errorf("module %s is neither the primary module nor a mirror", module)
+}
+
+// activeMirrors returns the target configs of mirrors whose cutover window is still open
+func activeMirrors(config *Config, now time.Time) []*Config {
+	var targets []*Config
+	for _, mirror := range config.Mirrors {
+		if mirror.UntilTimestamp != 0 && now.Unix() > mirror.UntilTimestamp {
+			continue
+		}
+		targets = append(targets, mirror.TargetConfig(config))
+	}
+	return targets
+}
+
+// QueueMirrorDeadLetters queues the update described by letter for every active
+// mirror, used when the primary submission is not attempted at all
+func QueueMirrorDeadLetters(config *Config, letter DeadLetter, now time.Time) {
+	for _, target := range activeMirrors(config, now) {
+		mirrorLetter := letter
+		mirrorLetter.Module = target.ModuleAddress.Hex()
+		state.AddDeadLetter(mirrorLetter)
+	}
+}
+
+// SubmitToMirrors sends the allowance update described by letter to every
+// active mirror. Failures are queued as dead letters for that mirror and do not
+// affect the primary submission.
+func SubmitToMirrors(config *Config, runtime cre.Runtime, evmClient *evm.Client, logger *slog.Logger, letter DeadLetter) []MirrorResult {
+	var results []MirrorResult
+	now := runtime.Now()
+
+	for _, target := range activeMirrors(config, now) {
+		result := MirrorResult{Module: target.ModuleAddress.Hex()}
+
+		writeResult, err := SubmitLetter(target, runtime, evmClient, letter, target.GasLimit)
+		if err == nil {
+			err = CheckWriteResult(writeResult)
+		}
+		state.RecordModuleResult(target.ModuleAddress.Hex(), err, now)
+
+		if err != nil {
+			result.Err = err
+			logger.Warn("Mirror update failed", "module", target.ModuleAddress.Hex(), "error", err.Error())
+
+			mirrorLetter := letter
+			mirrorLetter.Module = target.ModuleAddress.Hex()
+			mirrorLetter.Reason = err.Error()
+			state.AddDeadLetter(mirrorLetter)
+		} else {
+			result.TxHash = "0x" + hex.EncodeToString(writeResult.TxHash)
+			logger.Info("Mirror updated", "module", target.ModuleAddress.Hex(), "txHash", result.TxHash)
+		}
+
+		results = append(results, result)
+	}
+
+	return results
+}
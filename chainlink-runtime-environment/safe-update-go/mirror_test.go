@@ -0,0 +1,55 @@
+//go:build wasip1
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"safe-update-go/scenarios"
+)
+
+// TestValidateMirrorsAndMigration validates configs with both a mirror and a
+// migration, whose target configs must not validate each other in turn
+func TestValidateMirrorsAndMigration(t *testing.T) {
+	const newModule = "0x00000000000000000000000000000000000000a1"
+	const mirrorModule = "0x00000000000000000000000000000000000000a2"
+
+	tests := []struct {
+		name   string
+		mirror string
+		err    string
+	}{
+		{"valid", fmt.Sprintf(`{"moduleAddress": %q, "proxyAddress": %q}`, mirrorModule, scenarios.Updater.Hex()), ""},
+		{"mirror without forwarder", fmt.Sprintf(`{"moduleAddress": %q, "submissionMode": "direct"}`, mirrorModule), "mirror 0: forwarderAddress is required"},
+		{"direct mirror without receiver", fmt.Sprintf(`{"moduleAddress": %q, "submissionMode": "direct", "forwarderAddress": %q}`, mirrorModule, scenarios.Updater.Hex()),
+			"mirror 0: direct submission mode requires a module implementing IReceiver"},
+		{"direct mirror of a receiver", fmt.Sprintf(`{"moduleAddress": %q, "submissionMode": "direct", "forwarderAddress": %q, "moduleReceiver": true}`, mirrorModule, scenarios.Updater.Hex()), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := ParseConfig([]byte(fmt.Sprintf(`{
+				"moduleAddress": %q,
+				"chainSelector": "16015286601757825753",
+				"gasLimit": 500000,
+				"proxyAddress": %q,
+				"tokens": [{"address": %q, "priceFeedAddress": %q, "symbol": "USDC", "type": "erc20"}],
+				"migration": {"schedule": "0 */10 * * * *", "newModule": {"moduleAddress": %q, "proxyAddress": %q}},
+				"mirrors": [%s]
+			}`, scenarios.Module.Hex(), scenarios.Updater.Hex(), scenarios.Token.Hex(), scenarios.PriceFeed.Hex(),
+				newModule, scenarios.Updater.Hex(), tt.mirror)))
+			if err != nil {
+				t.Fatalf("parse config: %v", err)
+			}
+
+			err = ValidateConfig(config)
+			switch {
+			case tt.err == "" && err != nil:
+				t.Fatalf("validate config: %v", err)
+			case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+				t.Fatalf("validate config: %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+//go:build wasip1
+
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/blockchain/evm"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+)
+
+// callModule calls a view function on a module and unpacks the result into out
+func callModule(runtime cre.Runtime, evmClient *evm.Client, moduleAddr common.Address, method string, out interface{}, args ...interface{}) error {
+	parsedModuleABI, err := abi.JSON(strings.NewReader(moduleABI))
+	if err != nil {
+		return fmt.Errorf("failed to parse module ABI: %w", err)
+	}
+
+	callData, err := parsedModuleABI.Pack(method, args...)
+	if err != nil {
+		return fmt.Errorf("failed to pack %s call: %w", method, err)
+	}
+
+	result, err := evmClient.CallContract(runtime, &evm.CallContractRequest{
+		Call: &evm.CallMsg{
+			To:   moduleAddr.Bytes(),
+			Data: callData,
+		},
+	}).Await()
+	if err != nil {
+		return fmt.Errorf("failed to call %s on module %s: %w", method, moduleAddr.Hex(), err)
+	}
+
+	err = parsedModuleABI.UnpackIntoInterface(out, method, result.Data)
+	if err != nil {
+		return fmt.Errorf("failed to unpack %s: %w", method, err)
+	}
+
+	return nil
+}
+
+// GetAuthorizedUpdater returns the only address allowed to update allowances on a module
+func GetAuthorizedUpdater(runtime cre.Runtime, evmClient *evm.Client, moduleAddr common.Address) (common.Address, error) {
+	var updater common.Address
+	err := callModule(runtime, evmClient, moduleAddr, "authorizedUpdater", &updater)
+	return updater, err
+}
+
+// IsModulePaused returns whether a module is paused
+func IsModulePaused(runtime cre.Runtime, evmClient *evm.Client, moduleAddr common.Address) (bool, error) {
+	var paused bool
+	err := callModule(runtime, evmClient, moduleAddr, "paused", &paused)
+	return paused, err
+}
+
+// GetExecutionWindowStart returns the start of a subaccount's current execution window,
+// zero when the subaccount has no active window
+func GetExecutionWindowStart(runtime cre.Runtime, evmClient *evm.Client, moduleAddr common.Address, subAccount common.Address) (*big.Int, error) {
+	windowStart := new(big.Int)
+	err := callModule(runtime, evmClient, moduleAddr, "executionWindowStart", &windowStart, subAccount)
+	return windowStart, err
+}
+
+// GetExecutionWindowPortfolioValue returns the USD portfolio value a subaccount's current window started with
+func GetExecutionWindowPortfolioValue(runtime cre.Runtime, evmClient *evm.Client, moduleAddr common.Address, subAccount common.Address) (*big.Int, error) {
+	portfolioValue := new(big.Int)
+	err := callModule(runtime, evmClient, moduleAddr, "executionWindowPortfolioValue", &portfolioValue, subAccount)
+	return portfolioValue, err
+}
+
+// GetAvatar reads the Safe the module executes for
+func GetAvatar(runtime cre.Runtime, evmClient *evm.Client, moduleAddr common.Address) (common.Address, error) {
+	var avatar common.Address
+	err := callModule(runtime, evmClient, moduleAddr, "avatar", &avatar)
+	return avatar, err
+}
+
+// SubAccountLimits represents the effective limits of a subaccount
+type SubAccountLimits struct {
+	MaxLossBps     *big.Int
+	MaxTransferBps *big.Int
+	WindowDuration *big.Int
+}
+
+// GetSubaccountsByRole returns the members of a role on a module
+func GetSubaccountsByRole(runtime cre.Runtime, evmClient *evm.Client, moduleAddr common.Address, roleID uint16) ([]common.Address, error) {
+	var members []common.Address
+	err := callModule(runtime, evmClient, moduleAddr, "getSubaccountsByRole", &members, roleID)
+	return members, err
+}
+
+// HasRole returns whether a subaccount holds a role on a module
+func HasRole(runtime cre.Runtime, evmClient *evm.Client, moduleAddr common.Address, subAccount common.Address, roleID uint16) (bool, error) {
+	var hasRole bool
+	err := callModule(runtime, evmClient, moduleAddr, "hasRole", &hasRole, subAccount, roleID)
+	return hasRole, err
+}
+
+// GetSubAccountLimits returns the effective limits of a subaccount on a module
+func GetSubAccountLimits(runtime cre.Runtime, evmClient *evm.Client, moduleAddr common.Address, subAccount common.Address) (*SubAccountLimits, error) {
+	limits := &SubAccountLimits{}
+	err := callModule(runtime, evmClient, moduleAddr, "getSubAccountLimits", limits, subAccount)
+	return limits, err
+}
+
+// GetValueApprovedInWindow returns the USD value a subaccount used in its current window
+func GetValueApprovedInWindow(runtime cre.Runtime, evmClient *evm.Client, moduleAddr common.Address, subAccount common.Address) (*big.Int, error) {
+	approved := new(big.Int)
+	err := callModule(runtime, evmClient, moduleAddr, "valueApprovedInWindow", &approved, subAccount)
+	return approved, err
+}
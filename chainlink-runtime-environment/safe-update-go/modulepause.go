@@ -0,0 +1,167 @@
+//go:build wasip1
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/blockchain/evm"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+)
+
+// EmergencyPaused(address indexed by, uint256 timestamp), emitted by the module
+var emergencyPausedSignature = crypto.Keccak256Hash([]byte("EmergencyPaused(address,uint256)"))
+
+// EmergencyUnpaused(address indexed by, uint256 timestamp), emitted by the module
+var emergencyUnpausedSignature = crypto.Keccak256Hash([]byte("EmergencyUnpaused(address,uint256)"))
+
+// ModulePauseConfig represents the monitoring of periods the module is
+// paused. Pausing stops the subaccounts' protocol calls but not
+// updateSubaccountAllowances, so allowance updates are still submitted. A
+// pause lasting longer than alertAfterSeconds raises an alert, and one
+// lasting longer than pageAfterSeconds pages.
+type ModulePauseConfig struct {
+	AlertAfterSeconds uint64 `json:"alertAfterSeconds,omitempty"`
+	PageAfterSeconds  uint64 `json:"pageAfterSeconds,omitempty"`
+}
+
+// ModulePause represents a pause of a module
+type ModulePause struct {
+	Since   time.Time
+	By      string
+	Alerted bool
+	Paged   bool
+}
+
+// ValidateModulePause checks the module pause configuration
+func ValidateModulePause(pause *ModulePauseConfig) error {
+	if pause == nil {
+		return nil
+	}
+	if pause.AlertAfterSeconds > 0 && pause.PageAfterSeconds > 0 && pause.PageAfterSeconds < pause.AlertAfterSeconds {
+		return fmt.Errorf("pageAfterSeconds must be at least alertAfterSeconds")
+	}
+	return nil
+}
+
+// PauseModule records a module as paused since a time. It returns false if
+// the module was already known to be paused.
+func (s *WorkflowState) PauseModule(module string, by string, since time.Time) bool {
+	key := strings.ToLower(module)
+	if _, ok := s.ModulePauses[key]; ok {
+		return false
+	}
+	s.ModulePauses[key] = &ModulePause{Since: since, By: by}
+	return true
+}
+
+// PauseOf returns the pause of a module, or nil if it is not known to be paused
+func (s *WorkflowState) PauseOf(module string) *ModulePause {
+	return s.ModulePauses[strings.ToLower(module)]
+}
+
+// UnpauseModule forgets the pause of a module and returns it, or nil if it
+// was not known to be paused
+func (s *WorkflowState) UnpauseModule(module string) *ModulePause {
+	key := strings.ToLower(module)
+	pause, ok := s.ModulePauses[key]
+	if !ok {
+		return nil
+	}
+	delete(s.ModulePauses, key)
+	return pause
+}
+
+// OnModulePauseEvent is the handler for the module's EmergencyPaused and
+// EmergencyUnpaused events. A pause is alerted and tracked until the module
+// unpauses.
+func OnModulePauseEvent(config *Config, runtime cre.Runtime, payload *evm.Log) (*ExecutionResult, error) {
+	logger := runtime.Logger()
+
+	if len(payload.Topics) < 2 || len(payload.Data) < 32 {
+		return nil, fmt.Errorf("invalid pause log format")
+	}
+	module := common.BytesToAddress(payload.Address)
+	if _, err := config.TargetForModule(module.Hex()); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownEmitter, err.Error())
+	}
+	by := common.BytesToAddress(payload.Topics[1]).Hex()
+	at := time.Unix(new(big.Int).SetBytes(payload.Data[:32]).Int64(), 0)
+
+	switch {
+	case bytes.Equal(payload.Topics[0], emergencyPausedSignature.Bytes()):
+		if state.PauseModule(module.Hex(), by, at) {
+			RaiseAlert(config, runtime, slog.LevelWarn, "ALERT: module paused", module.Hex(), "module", module.Hex(), "by", by, "detectedBy", "event")
+		}
+		return &ExecutionResult{Message: fmt.Sprintf("Module %s paused", module.Hex()), Success: true}, nil
+
+	case bytes.Equal(payload.Topics[0], emergencyUnpausedSignature.Bytes()):
+		logger.Info("Module unpaused", "module", module.Hex(), "by", by)
+		return ResumeModule(runtime, module), nil
+	}
+
+	return nil, fmt.Errorf("unexpected pause event topic 0x%x", payload.Topics[0])
+}
+
+// ResumeModule forgets the pause of a module that unpaused
+func ResumeModule(runtime cre.Runtime, module common.Address) *ExecutionResult {
+	pause := state.UnpauseModule(module.Hex())
+	if pause == nil {
+		return &ExecutionResult{Message: fmt.Sprintf("Module %s was not paused", module.Hex()), Success: true}
+	}
+	duration := runtime.Now().Sub(pause.Since)
+	runtime.Logger().Info("Module pause ended", "module", module.Hex(), "pausedFor", duration.String())
+	return &ExecutionResult{Message: fmt.Sprintf("Module %s unpaused after %s", module.Hex(), duration), Success: true}
+}
+
+// CheckModulePauses reads the modules known to be paused and forgets those
+// that unpaused without their event being seen, then alerts once a pause
+// lasts longer than alertAfterSeconds and pages once it lasts longer than
+// pageAfterSeconds
+func CheckModulePauses(config *Config, runtime cre.Runtime, evmClient *evm.Client) {
+	if config.ModulePause == nil {
+		return
+	}
+	logger := runtime.Logger()
+	now := runtime.Now()
+
+	for module, pause := range state.ModulePauses {
+		moduleAddr := common.HexToAddress(module)
+		paused, err := IsModulePaused(runtime, evmClient, moduleAddr)
+		if err != nil {
+			logger.Warn("Failed to read module pause", "module", moduleAddr.Hex(), "error", err.Error())
+		} else if !paused {
+			ResumeModule(runtime, moduleAddr)
+			continue
+		}
+
+		age := now.Sub(pause.Since)
+		args := []any{"module", moduleAddr.Hex(), "pausedFor", age.String()}
+		switch {
+		case config.ModulePause.PageAfterSeconds > 0 && age > seconds(config.ModulePause.PageAfterSeconds) && !pause.Paged:
+			pause.Paged, pause.Alerted = true, true
+			RaiseAlert(config, runtime, slog.LevelError, "PAGE: module paused too long", moduleAddr.Hex(), args...)
+		case config.ModulePause.AlertAfterSeconds > 0 && age > seconds(config.ModulePause.AlertAfterSeconds) && !pause.Alerted:
+			pause.Alerted = true
+			RaiseAlert(config, runtime, slog.LevelWarn, "ALERT: module paused too long", moduleAddr.Hex(), args...)
+		}
+	}
+}
+
+// modulePauseTrigger creates the log trigger of the pause events of the modules
+func modulePauseTrigger(config *Config, addresses [][]byte) cre.Trigger[*evm.Log, *evm.Log] {
+	return evm.LogTrigger(config.ChainSelector.Uint64(), &evm.FilterLogTriggerRequest{
+		Addresses: addresses,
+		Topics: []*evm.TopicValues{
+			{Values: [][]byte{emergencyPausedSignature.Bytes(), emergencyUnpausedSignature.Bytes()}},
+			{Values: [][]byte{}}, // by (any)
+		},
+	})
+}
@@ -0,0 +1,66 @@
+//go:build wasip1
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/blockchain/evm"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+)
+
+// Withdraw(Id indexed id, address caller, address indexed onBehalf, address indexed receiver, uint256 assets, uint256 shares),
+// emitted by Morpho Blue
+var morphoBlueWithdrawSignature = crypto.Keccak256Hash([]byte("Withdraw(bytes32,address,address,address,uint256,uint256)"))
+
+// morphoMarketID returns the id of the market whose MarketParams the call
+// starts with: the keccak256 of the ABI encoded struct
+func morphoMarketID(calldata []byte) ([]byte, error) {
+	end := 4 + morphoMarketParamsWords*32
+	if len(calldata) < end {
+		return nil, fmt.Errorf("calldata too short for MarketParams")
+	}
+	return crypto.Keccak256(calldata[4:end]), nil
+}
+
+// ResolveMorphoBlueWithdraw settles a Morpho Blue withdrawal by shares from
+// the Withdraw event of its market, which carries the assets withdrawn.
+// Withdrawals by assets and of collateral already carry their amount and are
+// left as decoded.
+func ResolveMorphoBlueWithdraw(runtime cre.Runtime, evmClient *evm.Client, logger *slog.Logger, action *Action, calldata []byte, txHash []byte) error {
+	if action.Selector != MorphoBlueWithdrawSelector || len(action.AssetsIn) != 1 || action.AssetsIn[0].Amount.Sign() != 0 {
+		return nil
+	}
+	asset := &action.AssetsIn[0]
+
+	marketID, err := morphoMarketID(calldata)
+	if err != nil {
+		return err
+	}
+
+	reply, err := evmClient.GetTransactionReceipt(runtime, &evm.GetTransactionReceiptRequest{Hash: txHash}).Await()
+	if err != nil {
+		return fmt.Errorf("failed to get transaction receipt: %w", err)
+	}
+	if reply.Receipt == nil {
+		return fmt.Errorf("transaction receipt not found")
+	}
+
+	for _, log := range reply.Receipt.Logs {
+		if common.BytesToAddress(log.Address) != action.Counterparty || len(log.Topics) != 4 || len(log.Data) < 96 ||
+			!bytes.Equal(log.Topics[0], morphoBlueWithdrawSignature.Bytes()) || !bytes.Equal(log.Topics[1], marketID) {
+			continue
+		}
+		asset.Amount = new(big.Int).SetBytes(log.Data[32:64])
+		logger.Info("Morpho Blue withdrawal by shares", "market", common.BytesToHash(marketID).Hex(),
+			"token", asset.Token.Hex(), "assets", asset.Amount.String(), "shares", new(big.Int).SetBytes(log.Data[64:96]).String())
+		return nil
+	}
+
+	return fmt.Errorf("no Morpho Blue Withdraw for market %s in receipt", common.BytesToHash(marketID).Hex())
+}
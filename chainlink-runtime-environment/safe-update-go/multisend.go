@@ -0,0 +1,218 @@
+//go:build wasip1
+
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/blockchain/evm"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+)
+
+// Safe MultiSend and MultiSendCallOnly multiSend(bytes transactions)
+const MultiSendSelector = "8d80ff0a"
+
+// multiSendProtocol is the protocol name of MultiSend batches mixing protocols or verbs
+const multiSendProtocol = "multisend"
+
+// multiSendMixedReviewReason explains why batches mixing protocols or verbs are held for review
+const multiSendMixedReviewReason = "MultiSend batch mixes protocols or verbs"
+
+// multiSendRecipientsReviewReason explains why batches paying several recipients are held for review
+const multiSendRecipientsReviewReason = "MultiSend batch pays several recipients"
+
+// multiSendOrdersReviewReason explains why batches signing several orders are held for review
+const multiSendOrdersReviewReason = "MultiSend batch signs several orders"
+
+// multiSendClaimReviewReason explains why batches claiming rewards along other calls are held for review
+const multiSendClaimReviewReason = "MultiSend batch claims rewards along other calls"
+
+// multiSendReceiptReviewReason explains why batches with several calls settled from the receipt are held for review
+const multiSendReceiptReviewReason = "MultiSend batch has several calls settled from the same receipt"
+
+// multiSendApprovalReviewReason explains why batches granting approvals are held for review
+const multiSendApprovalReviewReason = "MultiSend batch grants an approval"
+
+// multiSendTxHeaderLength is the packed header of a MultiSend transaction:
+// operation (1), to (20), value (32) and data length (32)
+const multiSendTxHeaderLength = 1 + 20 + 32 + 32
+
+// multiSendDeployments lists the canonical MultiSend and MultiSendCallOnly
+// contracts of the Safe deployments. They are delegatecalled by the Safe, so
+// each call of the batch is made as the Safe.
+var multiSendDeployments = map[common.Address]bool{
+	common.HexToAddress("0xA238CBeb142c10Ef7Ad8442C6D1f9E89e07e7761"): true, // MultiSend 1.3.0
+	common.HexToAddress("0x40A2aCCbd92BCA938b02010E17A5b8929b49130D"): true, // MultiSendCallOnly 1.3.0
+	common.HexToAddress("0x998739BFdAAdde7C933B942a68053933098f9EDa"): true, // MultiSend 1.3.0 eip155
+	common.HexToAddress("0xA1dabEF33b3B82c7814B6D82A79e50F4AC44102B"): true, // MultiSendCallOnly 1.3.0 eip155
+	common.HexToAddress("0x38869bf66a61cF6bDB996A6aE40D5853Fd43B526"): true, // MultiSend 1.4.1
+	common.HexToAddress("0x9641d764fc13c8B624c04430C7356C1C7C8102e2"): true, // MultiSendCallOnly 1.4.1
+}
+
+// IsMultiSend reports whether protocol calldata is a MultiSend batch
+func IsMultiSend(calldata []byte) bool {
+	return len(calldata) >= 4 && hex.EncodeToString(calldata[:4]) == MultiSendSelector
+}
+
+// UnpackMultiSend returns the calls packed in the transactions argument of a
+// multiSend(bytes) call
+func UnpackMultiSend(calldata []byte) ([]ProtocolCall, error) {
+	offset, err := calldataUint(calldata, 0)
+	if err != nil {
+		return nil, err
+	}
+	args := calldata[4:]
+	if !offset.IsUint64() || offset.Uint64() > uint64(len(args))-32 {
+		return nil, fmt.Errorf("MultiSend transactions offset %s out of range", offset)
+	}
+	start := offset.Uint64() + 32
+	length := new(big.Int).SetBytes(args[start-32 : start])
+	if !length.IsUint64() || length.Uint64() > uint64(len(args))-start {
+		return nil, fmt.Errorf("MultiSend transactions length %s out of range", length)
+	}
+	packed := args[start : start+length.Uint64()]
+
+	var calls []ProtocolCall
+	for len(packed) > 0 {
+		if len(packed) < multiSendTxHeaderLength {
+			return nil, fmt.Errorf("MultiSend transaction %d truncated", len(calls))
+		}
+		dataLength := new(big.Int).SetBytes(packed[53:85])
+		if !dataLength.IsUint64() || dataLength.Uint64() > uint64(len(packed)-multiSendTxHeaderLength) {
+			return nil, fmt.Errorf("MultiSend transaction %d data length %s out of range", len(calls), dataLength)
+		}
+		end := multiSendTxHeaderLength + int(dataLength.Uint64())
+		calls = append(calls, ProtocolCall{
+			Operation: Operation(packed[0]),
+			Target:    common.BytesToAddress(packed[1:21]),
+			Value:     new(big.Int).SetBytes(packed[21:53]),
+			Calldata:  packed[multiSendTxHeaderLength:end],
+		})
+		packed = packed[end:]
+	}
+	return calls, nil
+}
+
+// DecodeMultiSend decodes each call of a MultiSend batch with the decoder
+// registry, as if the Safe had made it, and merges them into one action
+// moving the assets of all of them. Calls moving nothing are skipped. A batch
+// of one protocol and verb keeps them; a batch mixing protocols or verbs,
+// granting an approval, or whose calls would be held on their own, is held
+// for review so per-protocol policies cannot be sidestepped by batching. So
+// is a batch with several calls settled from the receipt, since each of them
+// would also count the events of the others.
+func DecodeMultiSend(config *Config, runtime cre.Runtime, evmClient *evm.Client, logger *slog.Logger, target common.Address, calldata []byte, txHash []byte) (*Action, error) {
+	calls, err := UnpackMultiSend(calldata)
+	if err != nil {
+		return nil, err
+	}
+
+	batch := &Action{
+		Protocol:     multiSendProtocol,
+		Counterparty: target,
+		Selector:     MultiSendSelector,
+		Confidence:   ConfidenceExactABI,
+	}
+	actions, claims, settled := 0, 0, 0
+	hold := func(reason string) {
+		if !batch.NeedsReview {
+			batch.NeedsReview, batch.ReviewReason = true, reason
+		}
+	}
+	for i := range calls {
+		call := &calls[i]
+		if _, ok := ClassifyApproval(call); ok {
+			hold(multiSendApprovalReviewReason)
+			continue
+		}
+		if len(call.Calldata) == 0 && call.Value.Sign() == 0 {
+			continue
+		}
+		if IsMultiSend(call.Calldata) {
+			return nil, fmt.Errorf("MultiSend transaction %d nests another MultiSend batch", i)
+		}
+
+		var action *Action
+		if IsNativeTransfer(call) {
+			action = NativeTransferAction(logger, call)
+		} else if action, err = DecodeProtocolCall(config, runtime, evmClient, logger, call.Target, call.Calldata, txHash); err != nil {
+			return nil, fmt.Errorf("MultiSend transaction %d to %s: %w", i, call.Target.Hex(), err)
+		}
+		action.WithCall(call)
+		if !action.NeedsReview {
+			action.NeedsReview, action.ReviewReason = ExecutionReview(action)
+		}
+		if action.NeedsReview {
+			hold(fmt.Sprintf("MultiSend transaction %d: %s", i, action.ReviewReason))
+		}
+
+		// A batch mixing verbs has none, so it never credits allowances
+		if actions == 0 {
+			batch.Protocol, batch.Verb = action.Protocol, action.Verb
+		} else if batch.Protocol != action.Protocol || batch.Verb != action.Verb {
+			if batch.Protocol != action.Protocol {
+				batch.Protocol = multiSendProtocol
+			}
+			if batch.Verb != action.Verb {
+				batch.Verb = ""
+			}
+			hold(multiSendMixedReviewReason)
+		}
+		if !action.Confidence.AtLeast(batch.Confidence) {
+			batch.Confidence = action.Confidence
+		}
+		switch {
+		case action.Recipient == (common.Address{}):
+		case batch.Recipient == (common.Address{}):
+			batch.Recipient = action.Recipient
+		case batch.Recipient != action.Recipient:
+			hold(multiSendRecipientsReviewReason)
+		}
+		if action.Order != nil {
+			if batch.Order != nil {
+				hold(multiSendOrdersReviewReason)
+			}
+			batch.Order = action.Order
+		}
+		if action.GMXWithdrawal != nil {
+			if batch.GMXWithdrawal != nil {
+				hold(multiSendOrdersReviewReason)
+			}
+			batch.GMXWithdrawal = action.GMXWithdrawal
+		}
+		if action.Verb == VerbClaim {
+			claims++
+		}
+		if action.SettledFromReceipt {
+			settled++
+		}
+		batch.AssetsIn = append(batch.AssetsIn, action.AssetsIn...)
+		batch.AssetsOut = append(batch.AssetsOut, action.AssetsOut...)
+		actions++
+	}
+
+	// A claim is settled from every inflow of the receipt, including the other calls'
+	if claims > 0 && actions > 1 {
+		hold(multiSendClaimReviewReason)
+	}
+	if settled > 1 {
+		hold(multiSendReceiptReviewReason)
+	}
+
+	logger.Info("MultiSend batch", "multiSend", target.Hex(), "calls", len(calls), "actions", actions,
+		"protocol", batch.Protocol, "verb", string(batch.Verb))
+	return batch, nil
+}
+
+// executedAsCall reports whether the calls of an action are made by the Safe
+// itself: a plain call, or a delegatecall to a MultiSend deployment batching them
+func (a *Action) executedAsCall() bool {
+	if a.Operation == OperationCall {
+		return true
+	}
+	return a.Operation == OperationDelegateCall && a.Selector == MultiSendSelector && multiSendDeployments[a.Counterparty]
+}
@@ -0,0 +1,143 @@
+//go:build wasip1
+
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"log/slog"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// packMultiSendTransactions packs calls the way MultiSend reads them:
+// operation, to, value, data length and data, back to back
+func packMultiSendTransactions(calls ...ProtocolCall) []byte {
+	var packed []byte
+	for _, call := range calls {
+		packed = append(packed, byte(call.Operation))
+		packed = append(packed, call.Target.Bytes()...)
+		packed = append(packed, common.LeftPadBytes(call.Value.Bytes(), 32)...)
+		packed = append(packed, common.LeftPadBytes(big.NewInt(int64(len(call.Calldata))).Bytes(), 32)...)
+		packed = append(packed, call.Calldata...)
+	}
+	return packed
+}
+
+// multiSendCalldata encodes a multiSend(bytes) call of packed transactions
+func multiSendCalldata(t *testing.T, transactions []byte) []byte {
+	t.Helper()
+	typ, err := abi.NewType("bytes", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	args, err := abi.Arguments{{Type: typ}}.Pack(transactions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append(common.FromHex(MultiSendSelector), args...)
+}
+
+func TestUnpackMultiSend(t *testing.T) {
+	pool := common.HexToAddress("0x87870Bca3F3fD6335C3F4ce8392D69350B4fA4E2")
+	recipient := common.HexToAddress("0x00000000000000000000000000000000000000dd")
+	withdraw := ProtocolCall{Target: pool, Value: new(big.Int), Calldata: common.FromHex(AaveWithdrawSelector + "00000000000000000000000000000000000000000000000000000000000000cc")}
+	transfer := ProtocolCall{Target: recipient, Value: big.NewInt(1e18), Calldata: []byte{}}
+	valid := packMultiSendTransactions(withdraw, transfer)
+
+	delegatecall := ProtocolCall{Target: pool, Value: new(big.Int), Operation: OperationDelegateCall, Calldata: []byte{}}
+	nested := ProtocolCall{Target: pool, Value: new(big.Int), Calldata: multiSendCalldata(t, valid)}
+	mutate := func(index int, value byte) []byte {
+		calldata := multiSendCalldata(t, valid)
+		calldata[index] = value
+		return calldata
+	}
+
+	tests := []struct {
+		name     string
+		calldata []byte
+		calls    []ProtocolCall
+		ok       bool
+	}{
+		{"two calls", multiSendCalldata(t, valid), []ProtocolCall{withdraw, transfer}, true},
+		{"no calls", multiSendCalldata(t, nil), nil, true},
+		{"delegatecall", multiSendCalldata(t, packMultiSendTransactions(delegatecall)), []ProtocolCall{delegatecall}, true},
+		// Nested batches are unpacked as one call, DecodeMultiSend rejects them
+		{"nested batch", multiSendCalldata(t, packMultiSendTransactions(nested)), []ProtocolCall{nested}, true},
+		{"missing offset", common.FromHex(MultiSendSelector), nil, false},
+		{"offset out of range", mutate(4+30, 0xff), nil, false},
+		{"offset overflows", mutate(4, 0xff), nil, false},
+		{"length out of range", mutate(4+32+30, 0xff), nil, false},
+		{"truncated header", multiSendCalldata(t, valid[:multiSendTxHeaderLength-1]), nil, false},
+		{"truncated data", multiSendCalldata(t, valid[:multiSendTxHeaderLength+10]), nil, false},
+		{"truncated second transaction", multiSendCalldata(t, valid[:len(valid)-1]), nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls, err := UnpackMultiSend(tt.calldata)
+			if !tt.ok {
+				if err == nil {
+					t.Errorf("unpacked %d calls", len(calls))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(calls) != len(tt.calls) {
+				t.Fatalf("unpacked %d calls, want %d", len(calls), len(tt.calls))
+			}
+			for i, call := range calls {
+				want := tt.calls[i]
+				if call.Operation != want.Operation || call.Target != want.Target || call.Value.Cmp(want.Value) != 0 || !bytes.Equal(call.Calldata, want.Calldata) {
+					t.Errorf("call %d: %+v, want %+v", i, call, want)
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeMultiSendHolds(t *testing.T) {
+	multiSend := common.HexToAddress("0x40A2aCCbd92BCA938b02010E17A5b8929b49130D")
+	token := common.HexToAddress("0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48")
+	logger := slog.New(slog.DiscardHandler)
+	approve, err := hex.DecodeString("095ea7b3" + "00000000000000000000000000000000000000000000000000000000000000dd" +
+		"ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	calldata := multiSendCalldata(t, packMultiSendTransactions(ProtocolCall{Target: token, Value: new(big.Int), Calldata: approve}))
+	batch, err := DecodeMultiSend(&Config{}, nil, nil, logger, multiSend, calldata, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !batch.NeedsReview || batch.ReviewReason != multiSendApprovalReviewReason {
+		t.Errorf("approval batch review %t (%s)", batch.NeedsReview, batch.ReviewReason)
+	}
+
+	nested := multiSendCalldata(t, packMultiSendTransactions(ProtocolCall{Target: multiSend, Value: new(big.Int), Calldata: calldata}))
+	if _, err := DecodeMultiSend(&Config{}, nil, nil, logger, multiSend, nested, nil); err == nil {
+		t.Error("decoded a nested batch")
+	}
+}
+
+func TestDecodeMultiSendNeedsDelegateCall(t *testing.T) {
+	multiSend := common.HexToAddress("0x40A2aCCbd92BCA938b02010E17A5b8929b49130D")
+	logger := slog.New(slog.DiscardHandler)
+	calldata := multiSendCalldata(t, nil)
+
+	if _, err := DecodeProtocolCall(&Config{}, nil, nil, logger, multiSend, calldata, nil); err == nil {
+		t.Error("decoded a batch the module cannot delegatecall")
+	}
+	batch, err := DecodeProtocolCall(&Config{ModuleDelegateCall: true}, nil, nil, logger, multiSend, calldata, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if batch.Selector != MultiSendSelector {
+		t.Errorf("decoded as %s", batch.Selector)
+	}
+}
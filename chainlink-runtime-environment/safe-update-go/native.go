@@ -0,0 +1,98 @@
+//go:build wasip1
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/smartcontractkit/chainlink-protos/cre/go/values/pb"
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/blockchain/evm"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+)
+
+// TokenTypeNative is the type of the token configuration of native ETH
+const TokenTypeNative = "native"
+
+// nativeToken is the placeholder address native ETH is configured and valued under
+var nativeToken = curveNativeCoin
+
+// nativeDecimals are the decimals of native ETH amounts, in wei
+const nativeDecimals = 18
+
+// nativeProtocol is the protocol name of plain native value transfers
+const nativeProtocol = "native"
+
+// IsNative reports whether a token configuration is the one of native ETH
+func (t *TokenConfig) IsNative() bool {
+	return t.Type == TokenTypeNative
+}
+
+// ValidateNativeToken checks that native ETH is configured under its
+// placeholder address, and at most once
+func ValidateNativeToken(tokens []TokenConfig) error {
+	native := 0
+	for _, token := range tokens {
+		if !token.IsNative() {
+			if token.Address.Address == nativeToken {
+				return fmt.Errorf("token %s: %s is the native ETH placeholder, type must be %s", token.Symbol, nativeToken.Hex(), TokenTypeNative)
+			}
+			continue
+		}
+		if token.Address.Address != nativeToken {
+			return fmt.Errorf("token %s: native ETH must be configured under %s", token.Symbol, nativeToken.Hex())
+		}
+		native++
+	}
+	if native > 1 {
+		return fmt.Errorf("native ETH configured %d times", native)
+	}
+	return nil
+}
+
+// GetNativeBalance returns the native ETH balance of an account in wei
+func GetNativeBalance(runtime cre.Runtime, evmClient *evm.Client, account common.Address) (*big.Int, error) {
+	reply, err := evmClient.BalanceAt(runtime, &evm.BalanceAtRequest{Account: account.Bytes()}).Await()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get native balance of %s: %w", account.Hex(), err)
+	}
+	if reply.Balance == nil {
+		return new(big.Int), nil
+	}
+	return pb.NewIntFromBigInt(reply.Balance), nil
+}
+
+// IsNativeTransfer reports whether a protocol call only sends native value,
+// without calldata. The repo module executes protocol calls with no value, so
+// only modules forwarding value make them.
+func IsNativeTransfer(call *ProtocolCall) bool {
+	return len(call.Calldata) == 0 && call.Value.Sign() > 0 && call.Operation == OperationCall
+}
+
+// NativeTransferAction returns the action of a plain native value transfer:
+// the value leaves the Safe as native ETH and the target receives it
+func NativeTransferAction(logger *slog.Logger, call *ProtocolCall) *Action {
+	logger.Info("Native value transfer", "to", call.Target.Hex(), "value", call.Value.String())
+
+	return &Action{
+		Protocol:     nativeProtocol,
+		Verb:         VerbTransfer,
+		AssetsOut:    []AssetAmount{{Token: nativeToken, Amount: new(big.Int).Set(call.Value)}},
+		Counterparty: call.Target,
+		Recipient:    call.Target,
+		Confidence:   ConfidenceExactABI,
+	}
+}
+
+// sendsValue reports whether the native value of the call is one of the
+// assets the action moves out of the Safe
+func (a *Action) sendsValue() bool {
+	for _, asset := range a.AssetsOut {
+		if isNativeToken(asset.Token) && asset.Amount.Cmp(a.Value) == 0 {
+			return true
+		}
+	}
+	return false
+}
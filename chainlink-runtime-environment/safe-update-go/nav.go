@@ -0,0 +1,314 @@
+//go:build wasip1
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/blockchain/evm"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+
+	"safe-update-go/fixedpoint"
+	"safe-update-go/ownerclient"
+)
+
+// ERC20 ABI for balanceOf
+const erc20BalanceOfABI = `[{"constant":true,"inputs":[{"name":"account","type":"address"}],"name":"balanceOf","outputs":[{"name":"","type":"uint256"}],"type":"function"}]`
+
+// defaultNAVRetention keeps NAV snapshots when no retention is configured
+const defaultNAVRetention = 30 * 24 * time.Hour
+
+// NAVConfig represents the subaccounts whose net asset value is snapshotted by
+// the health check. A subaccount's portfolio is the configured tokens held by
+// its holders, or by the module's Safe when it has none.
+type NAVConfig struct {
+	SubAccounts      []Address             `json:"subAccounts,omitempty"`
+	Holders          map[Address][]Address `json:"holders,omitempty"`
+	IntervalSeconds  uint64                `json:"intervalSeconds,omitempty"`
+	RetentionSeconds uint64                `json:"retentionSeconds,omitempty"`
+}
+
+// NAVPosition represents the balance of one token held by one holder
+type NAVPosition struct {
+	Holder   string
+	Symbol   string
+	Amount   *big.Int
+	USDValue *big.Int
+}
+
+// NAVPoint represents a net asset value snapshot of a subaccount's portfolio,
+// with the value it used in its current window
+type NAVPoint struct {
+	SubAccount  string
+	At          time.Time
+	NAVUSD      *big.Int
+	ApprovedUSD *big.Int
+	Positions   []NAVPosition
+}
+
+// navParams represents the parameters of the nav admin method
+type navParams struct {
+	SubAccount string `json:"subAccount,omitempty"`
+	Since      int64  `json:"since,omitempty"`
+}
+
+func init() {
+	RegisterAdminMethod("nav", adminNAV)
+}
+
+// ValidateNAV checks the NAV configuration
+func ValidateNAV(nav *NAVConfig) error {
+	if nav == nil {
+		return nil
+	}
+	if len(nav.SubAccounts) == 0 && len(nav.Holders) == 0 {
+		return fmt.Errorf("at least one subaccount is required")
+	}
+	for subAccount, holders := range nav.Holders {
+		for i, holder := range holders {
+			if !holder.IsSet() {
+				return fmt.Errorf("holder %d of %s: address is required", i, subAccount.Hex())
+			}
+		}
+	}
+	return nil
+}
+
+// navSubAccounts returns the subaccounts listed in the NAV configuration
+func navSubAccounts(nav *NAVConfig) []common.Address {
+	var subAccounts []common.Address
+	seen := make(map[common.Address]bool)
+	for _, subAccount := range nav.SubAccounts {
+		if !seen[subAccount.Address] {
+			seen[subAccount.Address] = true
+			subAccounts = append(subAccounts, subAccount.Address)
+		}
+	}
+	for subAccount := range nav.Holders {
+		if !seen[subAccount.Address] {
+			seen[subAccount.Address] = true
+			subAccounts = append(subAccounts, subAccount.Address)
+		}
+	}
+	return subAccounts
+}
+
+// navRetention returns how long NAV snapshots are kept
+func navRetention(nav *NAVConfig) time.Duration {
+	if nav.RetentionSeconds == 0 {
+		return defaultNAVRetention
+	}
+	return seconds(nav.RetentionSeconds)
+}
+
+// GetTokenBalance returns the ERC20 balance of an account, or its native ETH
+// balance for the native placeholder
+func GetTokenBalance(runtime cre.Runtime, evmClient *evm.Client, token common.Address, account common.Address) (*big.Int, error) {
+	if token == nativeToken {
+		return GetNativeBalance(runtime, evmClient, account)
+	}
+
+	parsedABI, err := abi.JSON(strings.NewReader(erc20BalanceOfABI))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse ERC20 ABI: %w", err)
+	}
+
+	callData, err := parsedABI.Pack("balanceOf", account)
+	if err != nil {
+		return nil, fmt.Errorf("failed to pack balanceOf call: %w", err)
+	}
+
+	result, err := evmClient.CallContract(runtime, &evm.CallContractRequest{
+		Call: &evm.CallMsg{
+			To:   token.Bytes(),
+			Data: callData,
+		},
+	}).Await()
+	if err != nil {
+		return nil, fmt.Errorf("failed to call balanceOf on %s: %w", token.Hex(), err)
+	}
+
+	balance := new(big.Int)
+	if err := parsedABI.UnpackIntoInterface(&balance, "balanceOf", result.Data); err != nil {
+		return nil, fmt.Errorf("failed to unpack balanceOf: %w", err)
+	}
+	return balance, nil
+}
+
+// navHolders returns the addresses holding a subaccount's portfolio
+func navHolders(config *Config, runtime cre.Runtime, evmClient *evm.Client, subAccount common.Address) ([]common.Address, error) {
+	for key, holders := range config.NAV.Holders {
+		if key.Address == subAccount && len(holders) > 0 {
+			addresses := make([]common.Address, len(holders))
+			for i, holder := range holders {
+				addresses[i] = holder.Address
+			}
+			return addresses, nil
+		}
+	}
+	avatar, err := GetAvatar(runtime, evmClient, ActiveTarget(config).ModuleAddress.Address)
+	if err != nil {
+		return nil, err
+	}
+	return []common.Address{avatar}, nil
+}
+
+// ComputeNAV values the configured tokens held by a subaccount's holders
+func ComputeNAV(config *Config, runtime cre.Runtime, evmClient *evm.Client, logger *slog.Logger, subAccount common.Address) (*NAVPoint, error) {
+	holders, err := navHolders(config, runtime, evmClient, subAccount)
+	if err != nil {
+		return nil, err
+	}
+
+	point := &NAVPoint{SubAccount: subAccount.Hex(), At: runtime.Now(), NAVUSD: new(big.Int)}
+	for _, holder := range holders {
+		for _, token := range config.Tokens {
+			balance, err := GetTokenBalance(runtime, evmClient, token.Address.Address, holder)
+			if err != nil {
+				return nil, err
+			}
+			if balance.Sign() == 0 {
+				continue
+			}
+			delta, err := valueAsset(config, runtime, evmClient, logger, AssetAmount{Token: token.Address.Address, Amount: balance}, 1, false)
+			if err != nil {
+				return nil, err
+			}
+			point.Positions = append(point.Positions, NAVPosition{
+				Holder:   holder.Hex(),
+				Symbol:   delta.Symbol,
+				Amount:   delta.Amount,
+				USDValue: delta.USDValue,
+			})
+			point.NAVUSD.Add(point.NAVUSD, delta.USDValue)
+		}
+	}
+
+	point.ApprovedUSD, err = GetValueApprovedInWindow(runtime, evmClient, ActiveTarget(config).ModuleAddress.Address, subAccount)
+	if err != nil {
+		return nil, err
+	}
+	return point, nil
+}
+
+// SnapshotNAV records a NAV point for every configured subaccount this
+// instance owns and whose last point is older than the interval. A subaccount
+// that cannot be valued is alerted on and skipped.
+func SnapshotNAV(config *Config, runtime cre.Runtime, evmClient *evm.Client, logger *slog.Logger) int {
+	now := runtime.Now()
+	state.PruneNAV(now.Add(-navRetention(config.NAV)))
+
+	recorded := 0
+	for _, subAccount := range navSubAccounts(config.NAV) {
+		if !OwnsSubaccount(config, subAccount) {
+			continue
+		}
+		if last := state.LastNAV(subAccount.Hex()); last != nil && now.Sub(last.At) < seconds(config.NAV.IntervalSeconds) {
+			continue
+		}
+
+		point, err := ComputeNAV(config, runtime, evmClient, logger, subAccount)
+		if err != nil {
+			RaiseAlert(config, runtime, slog.LevelWarn, "ALERT: NAV snapshot failed", subAccount.Hex(), "subAccount", subAccount.Hex(), "error", err.Error())
+			continue
+		}
+		state.NAVSeries = append(state.NAVSeries, *point)
+		logger.Info("NAV snapshot", "subAccount", subAccount.Hex(), "nav", FormatUSD(config, point.NAVUSD),
+			"approved", FormatUSD(config, point.ApprovedUSD), "usageBps", point.UsageBps().String(), "positions", len(point.Positions))
+		recorded++
+	}
+	return recorded
+}
+
+// UsageBps returns the value used in the window as a share of the NAV in
+// basis points, rounded up. An empty portfolio has no usage.
+func (p NAVPoint) UsageBps() *big.Int {
+	if p.NAVUSD.Sign() <= 0 {
+		return new(big.Int)
+	}
+	return fixedpoint.MulDiv(p.ApprovedUSD, big.NewInt(fixedpoint.BasisPoints), p.NAVUSD, fixedpoint.RoundUp)
+}
+
+// LastNAV returns the latest NAV point of a subaccount, or nil
+func (s *WorkflowState) LastNAV(subAccount string) *NAVPoint {
+	for i := len(s.NAVSeries) - 1; i >= 0; i-- {
+		if strings.EqualFold(s.NAVSeries[i].SubAccount, subAccount) {
+			return &s.NAVSeries[i]
+		}
+	}
+	return nil
+}
+
+// PruneNAV drops NAV points older than a point in time
+func (s *WorkflowState) PruneNAV(before time.Time) {
+	kept := s.NAVSeries[:0]
+	for _, point := range s.NAVSeries {
+		if !point.At.Before(before) {
+			kept = append(kept, point)
+		}
+	}
+	s.NAVSeries = kept
+}
+
+// View returns the NAV point as exposed by the admin and owner APIs
+func (p NAVPoint) View() ownerclient.NAVPoint {
+	positions := make([]ownerclient.Position, len(p.Positions))
+	for i, position := range p.Positions {
+		positions[i] = ownerclient.Position{
+			Holder:   position.Holder,
+			Symbol:   position.Symbol,
+			Amount:   position.Amount.String(),
+			USDValue: position.USDValue.String(),
+		}
+	}
+	return ownerclient.NAVPoint{
+		SubAccount:  p.SubAccount,
+		Timestamp:   p.At.Unix(),
+		NAVUSD:      p.NAVUSD.String(),
+		ApprovedUSD: p.ApprovedUSD.String(),
+		UsageBps:    p.UsageBps().String(),
+		Positions:   positions,
+	}
+}
+
+// NAVSeries returns the NAV points since a point in time, for every
+// subaccount or only one
+func NAVSeries(s *WorkflowState, subAccount string, since time.Time) []ownerclient.NAVPoint {
+	points := []ownerclient.NAVPoint{}
+	for _, point := range s.NAVSeries {
+		if point.At.Before(since) || (subAccount != "" && !strings.EqualFold(point.SubAccount, subAccount)) {
+			continue
+		}
+		points = append(points, point.View())
+	}
+	return points
+}
+
+// adminNAV reports the NAV series of the subaccounts
+func adminNAV(config *Config, runtime cre.Runtime, caller common.Address, params json.RawMessage) (interface{}, error) {
+	var p navParams
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, fmt.Errorf("invalid params: %w", err)
+		}
+	}
+	return NAVSeries(state, p.SubAccount, time.Unix(p.Since, 0)), nil
+}
+
+// ownerNAV returns the caller's NAV series
+func ownerNAV(config *Config, runtime cre.Runtime, caller common.Address, params json.RawMessage) (interface{}, error) {
+	var p ownerclient.NAVParams
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, fmt.Errorf("invalid params: %w", err)
+		}
+	}
+	return NAVSeries(state, caller.Hex(), time.Unix(p.Since, 0)), nil
+}
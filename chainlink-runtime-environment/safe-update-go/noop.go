@@ -0,0 +1,156 @@
+//go:build wasip1
+
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+)
+
+// Kinds of no-op actions
+const (
+	NoOpZeroAmount = "zero-amount"
+	NoOpNoAssets   = "no-assets"
+	NoOpApproval   = "approval"
+)
+
+// Treatments of a no-op action
+const (
+	NoOpIgnore = "ignore"
+	NoOpLog    = "log"
+	NoOpAlert  = "alert"
+)
+
+// approvalSelectors maps the selectors of token approvals to their function
+var approvalSelectors = map[string]string{
+	"095ea7b3": "approve(address,uint256)",
+	"39509351": "increaseAllowance(address,uint256)",
+	"a457c2d7": "decreaseAllowance(address,uint256)",
+	"a22cb465": "setApprovalForAll(address,bool)",
+	"87517c45": "approve(address,address,uint160,uint48)", // Permit2
+}
+
+// NoOpConfig represents the treatment of actions that move no value: actions
+// whose amounts are zero or cancel out per token, actions that move no assets, such as queueing a
+// withdrawal or pre-signing an order, and token approvals. They are never
+// valued, recorded in the ledger or submitted. Kinds override the default
+// treatment, log, per kind.
+type NoOpConfig struct {
+	Default string            `json:"default,omitempty"`
+	Kinds   map[string]string `json:"kinds,omitempty"`
+}
+
+// ValidateNoOp checks the no-op configuration
+func ValidateNoOp(noOp *NoOpConfig) error {
+	if noOp == nil {
+		return nil
+	}
+	if err := validateNoOpTreatment(noOp.Default); err != nil {
+		return err
+	}
+	for kind, treatment := range noOp.Kinds {
+		switch kind {
+		case NoOpZeroAmount, NoOpNoAssets, NoOpApproval:
+		default:
+			return fmt.Errorf("unknown no-op kind %q", kind)
+		}
+		if err := validateNoOpTreatment(treatment); err != nil {
+			return fmt.Errorf("%s: %w", kind, err)
+		}
+	}
+	return nil
+}
+
+// validateNoOpTreatment checks a configured treatment
+func validateNoOpTreatment(treatment string) error {
+	switch treatment {
+	case "", NoOpIgnore, NoOpLog, NoOpAlert:
+		return nil
+	}
+	return fmt.Errorf("unknown treatment %q", treatment)
+}
+
+// treatment returns what is done with a no-op action of a kind
+func (c *NoOpConfig) treatment(kind string) string {
+	if c == nil {
+		return NoOpLog
+	}
+	if treatment := c.Kinds[kind]; treatment != "" {
+		return treatment
+	}
+	if c.Default != "" {
+		return c.Default
+	}
+	return NoOpLog
+}
+
+// ClassifyApproval reports whether a protocol call is a token approval. A
+// delegatecall or a call sending native value is never a no-op.
+func ClassifyApproval(call *ProtocolCall) (string, bool) {
+	if len(call.Calldata) < 4 || call.Operation != OperationCall || (call.Value != nil && call.Value.Sign() != 0) {
+		return "", false
+	}
+	if _, ok := approvalSelectors[hex.EncodeToString(call.Calldata[:4])]; !ok {
+		return "", false
+	}
+	return NoOpApproval, true
+}
+
+// ClassifyNoOp reports whether a decoded action moves no value, and of which
+// kind. Actions held by their decoder or by how they were executed are left
+// to review instead.
+func ClassifyNoOp(action *Action) (string, bool) {
+	if action.NeedsReview || !action.executedAsCall() || (action.Value != nil && action.Value.Sign() != 0) {
+		return "", false
+	}
+	if len(action.AssetsIn)+len(action.AssetsOut) == 0 {
+		return NoOpNoAssets, true
+	}
+	net := make(map[common.Address]*big.Int)
+	for i, assets := range [][]AssetAmount{action.AssetsIn, action.AssetsOut} {
+		for _, asset := range assets {
+			if asset.Amount == nil {
+				continue
+			}
+			if net[asset.Token] == nil {
+				net[asset.Token] = new(big.Int)
+			}
+			if i == 0 {
+				net[asset.Token].Add(net[asset.Token], asset.Amount)
+			} else {
+				net[asset.Token].Sub(net[asset.Token], asset.Amount)
+			}
+		}
+	}
+	for _, amount := range net {
+		if amount.Sign() != 0 {
+			return "", false
+		}
+	}
+	return NoOpZeroAmount, true
+}
+
+// HandleNoOp applies the configured treatment to a no-op action and marks its
+// event processed. It counts as a success of the subaccount.
+func HandleNoOp(config *Config, runtime cre.Runtime, subAccount common.Address, target common.Address, eventID string, kind string, protocol string) *ExecutionResult {
+	args := []any{"subAccount", subAccount.Hex(), "target", target.Hex(), "event", eventID, "kind", kind}
+	if protocol != "" {
+		args = append(args, "protocol", protocol)
+	}
+
+	switch config.NoOp.treatment(kind) {
+	case NoOpLog:
+		runtime.Logger().Info("No-op action", args...)
+	case NoOpAlert:
+		RaiseAlert(config, runtime, slog.LevelWarn, "ALERT: no-op action", subAccount.Hex(), args...)
+	}
+
+	state.MarkProcessed(eventID, runtime.Now())
+	state.ResetSubaccountFailures(subAccount)
+	return &ExecutionResult{Message: fmt.Sprintf("No-op action (%s)", kind), Success: true}
+}
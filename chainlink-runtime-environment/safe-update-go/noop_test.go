@@ -0,0 +1,117 @@
+//go:build wasip1
+
+package main
+
+import (
+	"encoding/hex"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestClassifyNoOp(t *testing.T) {
+	usdc := common.HexToAddress("0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48")
+	weth := common.HexToAddress("0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2")
+	amount := func(token common.Address, n int64) AssetAmount {
+		return AssetAmount{Token: token, Amount: big.NewInt(n)}
+	}
+
+	tests := []struct {
+		name   string
+		action Action
+		kind   string
+		ok     bool
+	}{
+		{"no assets", Action{}, NoOpNoAssets, true},
+		{"zero amount in", Action{AssetsIn: []AssetAmount{amount(usdc, 0)}}, NoOpZeroAmount, true},
+		{"zero amounts in and out", Action{AssetsIn: []AssetAmount{amount(usdc, 0)}, AssetsOut: []AssetAmount{amount(weth, 0)}}, NoOpZeroAmount, true},
+		{"nil amount", Action{AssetsIn: []AssetAmount{{Token: usdc}}}, NoOpZeroAmount, true},
+		{"cancels out", Action{AssetsIn: []AssetAmount{amount(usdc, 100)}, AssetsOut: []AssetAmount{amount(usdc, 100)}}, NoOpZeroAmount, true},
+		{"cancels out over legs", Action{AssetsIn: []AssetAmount{amount(usdc, 60), amount(usdc, 40)}, AssetsOut: []AssetAmount{amount(usdc, 100)}}, NoOpZeroAmount, true},
+		{"amount in", Action{AssetsIn: []AssetAmount{amount(usdc, 1)}}, "", false},
+		{"amount out", Action{AssetsOut: []AssetAmount{amount(usdc, 1)}}, "", false},
+		{"partly cancels out", Action{AssetsIn: []AssetAmount{amount(usdc, 100)}, AssetsOut: []AssetAmount{amount(usdc, 99)}}, "", false},
+		{"same amount of other tokens", Action{AssetsIn: []AssetAmount{amount(usdc, 100)}, AssetsOut: []AssetAmount{amount(weth, 100)}}, "", false},
+		{"one token cancels out", Action{AssetsIn: []AssetAmount{amount(usdc, 100), amount(weth, 1)}, AssetsOut: []AssetAmount{amount(usdc, 100)}}, "", false},
+		{"held for review", Action{NeedsReview: true}, "", false},
+		{"native value", Action{Value: big.NewInt(1)}, "", false},
+		{"zero native value", Action{Value: new(big.Int)}, NoOpNoAssets, true},
+		{"delegatecall", Action{Operation: OperationDelegateCall}, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kind, ok := ClassifyNoOp(&tt.action)
+			if kind != tt.kind || ok != tt.ok {
+				t.Errorf("classified %q %t, want %q %t", kind, ok, tt.kind, tt.ok)
+			}
+		})
+	}
+}
+
+func TestClassifyApproval(t *testing.T) {
+	calldata := func(selector string) []byte {
+		b, err := hex.DecodeString(selector + "00000000000000000000000000000000000000000000000000000000000000cc")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	tests := []struct {
+		name string
+		call ProtocolCall
+		ok   bool
+	}{
+		{"approve", ProtocolCall{Calldata: calldata("095ea7b3")}, true},
+		{"increaseAllowance", ProtocolCall{Calldata: calldata("39509351")}, true},
+		{"decreaseAllowance", ProtocolCall{Calldata: calldata("a457c2d7")}, true},
+		{"setApprovalForAll", ProtocolCall{Calldata: calldata("a22cb465")}, true},
+		{"permit2 approve", ProtocolCall{Calldata: calldata("87517c45")}, true},
+		{"zero value", ProtocolCall{Calldata: calldata("095ea7b3"), Value: new(big.Int)}, true},
+		{"transfer", ProtocolCall{Calldata: calldata("a9059cbb")}, false},
+		{"short calldata", ProtocolCall{Calldata: []byte{0x09, 0x5e, 0xa7}}, false},
+		{"native value", ProtocolCall{Calldata: calldata("095ea7b3"), Value: big.NewInt(1)}, false},
+		{"delegatecall", ProtocolCall{Calldata: calldata("095ea7b3"), Operation: OperationDelegateCall}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kind, ok := ClassifyApproval(&tt.call)
+			if ok != tt.ok || (ok && kind != NoOpApproval) {
+				t.Errorf("classified %q %t", kind, ok)
+			}
+		})
+	}
+}
+
+func TestNoOpTreatment(t *testing.T) {
+	tests := []struct {
+		name   string
+		config *NoOpConfig
+		kind   string
+		want   string
+	}{
+		{"unconfigured", nil, NoOpApproval, NoOpLog},
+		{"empty", &NoOpConfig{}, NoOpZeroAmount, NoOpLog},
+		{"default", &NoOpConfig{Default: NoOpIgnore}, NoOpNoAssets, NoOpIgnore},
+		{"kind", &NoOpConfig{Default: NoOpIgnore, Kinds: map[string]string{NoOpApproval: NoOpAlert}}, NoOpApproval, NoOpAlert},
+		{"other kind", &NoOpConfig{Default: NoOpIgnore, Kinds: map[string]string{NoOpApproval: NoOpAlert}}, NoOpZeroAmount, NoOpIgnore},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.config.treatment(tt.kind); got != tt.want {
+				t.Errorf("treatment %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	for _, invalid := range []*NoOpConfig{
+		{Default: "drop"},
+		{Kinds: map[string]string{"transfer": NoOpLog}},
+		{Kinds: map[string]string{NoOpApproval: "drop"}},
+	} {
+		if err := ValidateNoOp(invalid); err == nil {
+			t.Errorf("accepted %+v", invalid)
+		}
+	}
+}
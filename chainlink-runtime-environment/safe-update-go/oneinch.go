@@ -0,0 +1,104 @@
+//go:build wasip1
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/blockchain/evm"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+)
+
+// ResolveOneInchSwap settles a 1inch swap from the token transfers in the
+// receipt. The Safe is the sender of the exact input amount; what the
+// recipient, or the Safe when there is none, received of the bought token is
+// credited, so slippage shows in the net value. The bought token of an
+// unoswap is the only token other than the one sold that the recipient
+// received. Native ETH moves without transfers, so swaps from or to it are
+// not settled.
+func ResolveOneInchSwap(runtime cre.Runtime, evmClient *evm.Client, logger *slog.Logger, action *Action, calldata []byte, txHash []byte) error {
+	sold := action.AssetsOut[0]
+	if isNativeToken(sold.Token) || (len(action.AssetsIn) == 1 && isNativeToken(action.AssetsIn[0].Token)) {
+		return fmt.Errorf("1inch swap of native ETH cannot be settled from transfers")
+	}
+
+	reply, err := evmClient.GetTransactionReceipt(runtime, &evm.GetTransactionReceiptRequest{Hash: txHash}).Await()
+	if err != nil {
+		return fmt.Errorf("failed to get transaction receipt: %w", err)
+	}
+	if reply.Receipt == nil {
+		return fmt.Errorf("transaction receipt not found")
+	}
+	logs := reply.Receipt.Logs
+
+	safe, ok := transferSender(logs, sold.Token, sold.Amount)
+	if !ok {
+		return fmt.Errorf("no transfer of %s %s sold in receipt", sold.Amount, sold.Token.Hex())
+	}
+	recipient := action.Recipient
+	if recipient == (common.Address{}) {
+		recipient = safe
+	}
+
+	var bought []AssetAmount
+	for _, log := range logs {
+		if len(log.Topics) < 3 || len(log.Data) < 32 || !bytes.Equal(log.Topics[0], transferSignature.Bytes()) ||
+			common.BytesToAddress(log.Topics[2]) != recipient {
+			continue
+		}
+		token := common.BytesToAddress(log.Address)
+		if token == sold.Token || (len(action.AssetsIn) == 1 && token != action.AssetsIn[0].Token) {
+			continue
+		}
+		amount := new(big.Int).SetBytes(log.Data[:32])
+		found := false
+		for i := range bought {
+			if bought[i].Token == token {
+				bought[i].Amount.Add(bought[i].Amount, amount)
+				found = true
+				break
+			}
+		}
+		if !found {
+			bought = append(bought, AssetAmount{Token: token, Amount: amount})
+		}
+	}
+
+	switch {
+	case len(bought) == 0:
+		return fmt.Errorf("no tokens bought by %s in receipt", recipient.Hex())
+	case len(bought) > 1:
+		return fmt.Errorf("1inch swap paid %d tokens to %s", len(bought), recipient.Hex())
+	}
+	if len(action.AssetsIn) == 1 && bought[0].Amount.Cmp(action.AssetsIn[0].Amount) < 0 {
+		return fmt.Errorf("1inch swap returned %s, below its minimum %s", bought[0].Amount, action.AssetsIn[0].Amount)
+	}
+
+	action.AssetsIn = bought
+	logger.Info("1inch swap settled", "sold", sold.Token.Hex(), "spent", sold.Amount.String(),
+		"bought", bought[0].Token.Hex(), "returned", bought[0].Amount.String(), "recipient", recipient.Hex())
+	return nil
+}
+
+// isNativeToken reports whether a token address is a placeholder for native ETH
+func isNativeToken(token common.Address) bool {
+	return token == (common.Address{}) || token == curveNativeCoin
+}
+
+// transferSender finds the sender of a Transfer of an amount of a token
+func transferSender(logs []*evm.Log, token common.Address, amount *big.Int) (common.Address, bool) {
+	for _, log := range logs {
+		if len(log.Topics) < 3 || len(log.Data) < 32 || !bytes.Equal(log.Topics[0], transferSignature.Bytes()) ||
+			common.BytesToAddress(log.Address) != token {
+			continue
+		}
+		if new(big.Int).SetBytes(log.Data[:32]).Cmp(amount) == 0 {
+			return common.BytesToAddress(log.Topics[1]), true
+		}
+	}
+	return common.Address{}, false
+}
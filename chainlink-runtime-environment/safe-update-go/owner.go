@@ -0,0 +1,149 @@
+//go:build wasip1
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/networking/http"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+
+	"safe-update-go/fixedpoint"
+	"safe-update-go/ownerclient"
+)
+
+// OwnerAPIConfig represents the subaccount keys allowed to query their own accounting
+type OwnerAPIConfig struct {
+	AuthorizedKeys []string `json:"authorizedKeys"`
+}
+
+// OwnerMethod handles one owner API method for the calling subaccount
+type OwnerMethod func(config *Config, runtime cre.Runtime, caller common.Address, params json.RawMessage) (interface{}, error)
+
+// ownerMethods maps a method name to its handler
+var ownerMethods = map[string]OwnerMethod{
+	ownerclient.MethodActions:   ownerActions,
+	ownerclient.MethodAllowance: ownerAllowance,
+	ownerclient.MethodNAV:       ownerNAV,
+}
+
+// OnOwnerRequest is the handler for owner API calls. Owners can only query
+// the subaccount whose key signed the request.
+func OnOwnerRequest(config *Config, runtime cre.Runtime, payload *http.Payload) (*ExecutionResult, error) {
+	logger := runtime.Logger()
+
+	if payload.Key == nil || !common.IsHexAddress(payload.Key.PublicKey) {
+		return nil, fmt.Errorf("owner request without an EVM signing key")
+	}
+	caller := common.HexToAddress(payload.Key.PublicKey)
+
+	var request ownerclient.Request
+	if err := json.Unmarshal(payload.Input, &request); err != nil {
+		return nil, fmt.Errorf("failed to decode owner request: %w", err)
+	}
+	logger.Info("Owner request", "method", request.Method, "subAccount", caller.Hex())
+
+	method, ok := ownerMethods[request.Method]
+	if !ok {
+		return nil, fmt.Errorf("unknown owner method %q", request.Method)
+	}
+
+	result, err := method(config, runtime, caller, request.Params)
+	if err != nil {
+		return nil, fmt.Errorf("owner method %s: %w", request.Method, err)
+	}
+
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode owner result: %w", err)
+	}
+
+	return &ExecutionResult{Message: string(encoded), Success: true}, nil
+}
+
+// ownerActions returns the caller's retained ledger entries
+func ownerActions(config *Config, runtime cre.Runtime, caller common.Address, params json.RawMessage) (interface{}, error) {
+	var p ownerclient.ActionsParams
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, fmt.Errorf("invalid params: %w", err)
+		}
+	}
+	since := time.Unix(p.Since, 0)
+
+	entries := []ownerclient.LedgerEntry{}
+	for _, entry := range state.Ledger {
+		if strings.EqualFold(entry.SubAccount, caller.Hex()) && !entry.At.Before(since) {
+			entries = append(entries, entry.View())
+		}
+	}
+	return entries, nil
+}
+
+// ownerAllowance reads the caller's window from the active module and projects
+// the remaining allowance once queued credits are submitted. The total mirrors
+// the module: portfolioValue * maxLossBps / 10000, rounded down.
+func ownerAllowance(config *Config, runtime cre.Runtime, caller common.Address, params json.RawMessage) (interface{}, error) {
+	evmClient := newEVMClient(config)
+	active := ActiveTarget(config)
+	moduleAddr := active.ModuleAddress.Address
+
+	windowStart, err := GetExecutionWindowStart(runtime, evmClient, moduleAddr, caller)
+	if err != nil {
+		return nil, err
+	}
+	limits, err := GetSubAccountLimits(runtime, evmClient, moduleAddr, caller)
+	if err != nil {
+		return nil, err
+	}
+	portfolioValue := new(big.Int)
+	if err := callModule(runtime, evmClient, moduleAddr, "executionWindowPortfolioValue", &portfolioValue, caller); err != nil {
+		return nil, err
+	}
+	approved, err := GetValueApprovedInWindow(runtime, evmClient, moduleAddr, caller)
+	if err != nil {
+		return nil, err
+	}
+
+	total := fixedpoint.MulDiv(portfolioValue, limits.MaxLossBps, big.NewInt(fixedpoint.BasisPoints), fixedpoint.RoundDown)
+	remaining := new(big.Int).Sub(total, approved)
+	if remaining.Sign() < 0 {
+		remaining.SetInt64(0)
+	}
+
+	// Token-native letters carry token amounts, not USD, so they are left out
+	pending := new(big.Int)
+	for _, letter := range state.DeadLetters {
+		if letter.Token == "" && strings.EqualFold(letter.SubAccount, caller.Hex()) && strings.EqualFold(letter.Module, active.ModuleAddress.Hex()) {
+			pending.Add(pending, letter.BalanceChange)
+		}
+	}
+	projected := new(big.Int).Add(remaining, pending)
+	if projected.Cmp(total) > 0 {
+		projected.Set(total)
+	}
+
+	windowEnd := int64(0)
+	if windowStart.Sign() > 0 {
+		windowEnd = new(big.Int).Add(windowStart, limits.WindowDuration).Int64()
+	}
+
+	return ownerclient.Allowance{
+		SubAccount:         caller.Hex(),
+		Module:             moduleAddr.Hex(),
+		WindowStart:        windowStart.Int64(),
+		WindowEnd:          windowEnd,
+		PortfolioValue:     portfolioValue.String(),
+		MaxLossBps:         limits.MaxLossBps.String(),
+		TotalAllowance:     total.String(),
+		ApprovedInWindow:   approved.String(),
+		RemainingAllowance: remaining.String(),
+		PendingCredits:     pending.String(),
+		ProjectedRemaining: projected.String(),
+	}, nil
+}
@@ -0,0 +1,168 @@
+// Package ownerclient lets subaccount owners query their own accounting from
+// the workflow's owner API: decoded actions with their USD valuations, a
+// projection of the remaining allowance, and the net asset value series.
+//
+// The owner API is a CRE HTTP trigger. Requests must be signed with the
+// subaccount's key, which the trigger only accepts if it is authorized in the
+// workflow config. Signing and delivery to the gateway are left to a
+// Transport, so the package has no dependency on a particular gateway client.
+package ownerclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Owner API methods
+const (
+	MethodActions   = "actions"
+	MethodAllowance = "allowance"
+	MethodNAV       = "nav"
+)
+
+// Transport sends a signed trigger input to the owner API and returns the
+// execution result message, which holds the JSON encoded method result
+type Transport func(ctx context.Context, input []byte) ([]byte, error)
+
+// Request represents an owner API call
+type Request struct {
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+// ActionsParams represents the parameters of the actions method
+type ActionsParams struct {
+	Since int64 `json:"since,omitempty"`
+}
+
+// NAVParams represents the parameters of the nav method
+type NAVParams struct {
+	Since int64 `json:"since,omitempty"`
+}
+
+// LedgerEntry represents a decoded action of a subaccount and its USD valuation
+// (18 decimals). GrossUSD is the total value moved, NetUSD the signed value
+// that flowed into the Safe.
+type LedgerEntry struct {
+	TxHash     string `json:"txHash"`
+	SubAccount string `json:"subAccount"`
+	Protocol   string `json:"protocol"`
+	Verb       string `json:"verb"`
+	GrossUSD   string `json:"grossUsd"`
+	NetUSD     string `json:"netUsd"`
+	Timestamp  int64  `json:"timestamp"`
+}
+
+// Allowance represents the current allowance of a subaccount and its
+// projection at the end of the execution window. USD values have 18 decimals.
+type Allowance struct {
+	SubAccount         string `json:"subAccount"`
+	Module             string `json:"module"`
+	WindowStart        int64  `json:"windowStart"`
+	WindowEnd          int64  `json:"windowEnd"`
+	PortfolioValue     string `json:"portfolioValue"`
+	MaxLossBps         string `json:"maxLossBps"`
+	TotalAllowance     string `json:"totalAllowance"`
+	ApprovedInWindow   string `json:"approvedInWindow"`
+	RemainingAllowance string `json:"remainingAllowance"`
+	PendingCredits     string `json:"pendingCredits"`
+	ProjectedRemaining string `json:"projectedRemaining"`
+}
+
+// Position represents the balance of one token held for a subaccount and its
+// USD value (18 decimals)
+type Position struct {
+	Holder   string `json:"holder"`
+	Symbol   string `json:"symbol"`
+	Amount   string `json:"amount"`
+	USDValue string `json:"usdValue"`
+}
+
+// NAVPoint represents a net asset value snapshot of a subaccount's portfolio.
+// ApprovedUSD is the value used in the current execution window and UsageBps
+// its share of the NAV in basis points.
+type NAVPoint struct {
+	SubAccount  string     `json:"subAccount"`
+	Timestamp   int64      `json:"timestamp"`
+	NAVUSD      string     `json:"navUsd"`
+	ApprovedUSD string     `json:"approvedUsd"`
+	UsageBps    string     `json:"usageBps"`
+	Positions   []Position `json:"positions"`
+}
+
+// Client queries the owner API
+type Client struct {
+	transport Transport
+}
+
+// New creates a client sending requests through transport
+func New(transport Transport) *Client {
+	return &Client{transport: transport}
+}
+
+// Actions returns the subaccount's decoded actions since a point in time.
+// A zero time returns every entry the workflow still retains.
+func (c *Client) Actions(ctx context.Context, since time.Time) ([]LedgerEntry, error) {
+	params := ActionsParams{}
+	if !since.IsZero() {
+		params.Since = since.Unix()
+	}
+
+	var entries []LedgerEntry
+	if err := c.call(ctx, MethodActions, params, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// Allowance returns the subaccount's current and projected allowance
+func (c *Client) Allowance(ctx context.Context) (*Allowance, error) {
+	var allowance Allowance
+	if err := c.call(ctx, MethodAllowance, nil, &allowance); err != nil {
+		return nil, err
+	}
+	return &allowance, nil
+}
+
+// NAV returns the subaccount's net asset value snapshots taken since a point in time
+func (c *Client) NAV(ctx context.Context, since time.Time) ([]NAVPoint, error) {
+	params := NAVParams{}
+	if !since.IsZero() {
+		params.Since = since.Unix()
+	}
+
+	var points []NAVPoint
+	if err := c.call(ctx, MethodNAV, params, &points); err != nil {
+		return nil, err
+	}
+	return points, nil
+}
+
+// call encodes a request, sends it and decodes the result into out
+func (c *Client) call(ctx context.Context, method string, params interface{}, out interface{}) error {
+	request := Request{Method: method}
+	if params != nil {
+		encoded, err := json.Marshal(params)
+		if err != nil {
+			return fmt.Errorf("failed to encode %s params: %w", method, err)
+		}
+		request.Params = encoded
+	}
+
+	input, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s request: %w", method, err)
+	}
+
+	result, err := c.transport(ctx, input)
+	if err != nil {
+		return fmt.Errorf("failed to call %s: %w", method, err)
+	}
+
+	if err := json.Unmarshal(result, out); err != nil {
+		return fmt.Errorf("failed to decode %s result: %w", method, err)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+//go:build wasip1
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/blockchain/evm"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+)
+
+// RedeemPyToToken(address indexed caller, address indexed tokenOut, address indexed YT, address receiver, uint256 netPyIn, uint256 netTokenOut, uint256 netSyInterm),
+// emitted by the Pendle router
+var pendleRedeemPyToTokenSignature = crypto.Keccak256Hash([]byte("RedeemPyToToken(address,address,address,address,uint256,uint256,uint256)"))
+
+// RemoveLiquiditySingleToken(address indexed caller, address indexed market, address indexed token, address receiver, uint256 netLpToRemove, uint256 netTokenOut, uint256 netSyInterm),
+// emitted by the Pendle router
+var pendleRemoveLiquiditySingleTokenSignature = crypto.Keccak256Hash([]byte("RemoveLiquiditySingleToken(address,address,address,address,uint256,uint256,uint256)"))
+
+// ResolvePendleExit settles a Pendle single token exit from the router's
+// RedeemPyToToken or RemoveLiquiditySingleToken event for the YT or market
+// and the amount of the call. The netTokenOut of the event is credited in its
+// token. Native ETH is paid out as the zero address and credited through the
+// router's entry in the vaults registry, which maps it to WETH.
+func ResolvePendleExit(runtime cre.Runtime, evmClient *evm.Client, logger *slog.Logger, action *Action, calldata []byte, txHash []byte) error {
+	position, err := calldataAddress(calldata, 1)
+	if err != nil {
+		return err
+	}
+	amount, err := calldataUint(calldata, 2)
+	if err != nil {
+		return err
+	}
+	tokenOut, _, err := pendleTokenOutput(calldata, 3)
+	if err != nil {
+		return err
+	}
+
+	signature, positionTopic, tokenTopic := pendleRemoveLiquiditySingleTokenSignature, 2, 3
+	if action.Selector == PendleRedeemPyToTokenSelector {
+		signature, positionTopic, tokenTopic = pendleRedeemPyToTokenSignature, 3, 2
+	}
+
+	reply, err := evmClient.GetTransactionReceipt(runtime, &evm.GetTransactionReceiptRequest{Hash: txHash}).Await()
+	if err != nil {
+		return fmt.Errorf("failed to get transaction receipt: %w", err)
+	}
+	if reply.Receipt == nil {
+		return fmt.Errorf("transaction receipt not found")
+	}
+
+	for _, log := range reply.Receipt.Logs {
+		if common.BytesToAddress(log.Address) != action.Counterparty || len(log.Topics) != 4 || len(log.Data) < 4*32 ||
+			!bytes.Equal(log.Topics[0], signature.Bytes()) {
+			continue
+		}
+		token := common.BytesToAddress(log.Topics[tokenTopic])
+		if common.BytesToAddress(log.Topics[positionTopic]) != position || token != tokenOut ||
+			new(big.Int).SetBytes(log.Data[32:64]).Cmp(amount) != 0 {
+			continue
+		}
+
+		netTokenOut := new(big.Int).SetBytes(log.Data[64:96])
+		if token == (common.Address{}) {
+			action.AssetsIn = append(action.AssetsIn, AssetAmount{Token: action.Counterparty, Amount: netTokenOut, Vault: true})
+		} else {
+			action.AssetsIn = append(action.AssetsIn, AssetAmount{Token: token, Amount: netTokenOut})
+		}
+		logger.Info("Pendle exit settled", "position", position.Hex(), "token", token.Hex(), "netTokenOut", netTokenOut.String())
+		return nil
+	}
+	return fmt.Errorf("no Pendle exit of %s from %s in receipt", amount, position.Hex())
+}
@@ -0,0 +1,310 @@
+//go:build wasip1
+
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"safe-update-go/fixedpoint"
+)
+
+// defaultExposureAlertPercent is the share of a cap at which an alert is raised
+const defaultExposureAlertPercent = 80
+
+// defaultNAVMaxAge is how old a NAV snapshot can be for NAV limits when no
+// maximum age is configured
+const defaultNAVMaxAge = 24 * time.Hour
+
+// PolicyConfig represents the limits enforced on decoded actions. Actions
+// decoded with less than the minimum confidence are held for review.
+// Modifiers tighten the policy outside business hours or on weekends. The
+// anomaly detector flags actions outside a subaccount's usual pattern, and the
+// structuring detector withdrawals split just below a threshold.
+// Actions are only valued at feed answers younger than MaxPriceAgeSeconds, and
+// with RestrictRecipients they may only pay out to the Safe or an allowed
+// recipient. Bridge transfers to anyone but the Safe or an allowed bridge
+// recipient are held for review.
+type PolicyConfig struct {
+	ExposureLimits          []ExposureLimit       `json:"exposureLimits,omitempty"`
+	NAVLimits               []NAVLimit            `json:"navLimits,omitempty"`
+	MinConfidence           Confidence            `json:"minConfidence,omitempty"`
+	ProtocolMinConfidence   map[string]Confidence `json:"protocolMinConfidence,omitempty"`
+	BusinessHours           *BusinessHours        `json:"businessHours,omitempty"`
+	Modifiers               []PolicyModifier      `json:"modifiers,omitempty"`
+	Anomaly                 *AnomalyConfig        `json:"anomaly,omitempty"`
+	Structuring             *StructuringConfig    `json:"structuring,omitempty"`
+	MaxPriceAgeSeconds      uint64                `json:"maxPriceAgeSeconds,omitempty"`
+	RestrictRecipients      bool                  `json:"restrictRecipients,omitempty"`
+	AllowedRecipients       []Address             `json:"allowedRecipients,omitempty"`
+	AllowedBridgeRecipients []Address             `json:"allowedBridgeRecipients,omitempty"`
+}
+
+// ExposureLimit caps the gross USD value moved through a protocol or verb per period.
+// An empty protocol or verb matches every action. A limit on a token group
+// only counts the value of that group's tokens, inflows and outflows or
+// either one alone.
+type ExposureLimit struct {
+	Protocol      string `json:"protocol,omitempty"`
+	Verb          Verb   `json:"verb,omitempty"`
+	Group         string `json:"group,omitempty"`
+	Flow          string `json:"flow,omitempty"`
+	MaxUSD        uint64 `json:"maxUsd"`
+	PeriodSeconds uint64 `json:"periodSeconds"`
+	AlertPercent  uint64 `json:"alertPercent,omitempty"`
+}
+
+// NAVLimit caps the gross USD value a subaccount moves through a protocol or
+// verb as a share of its latest NAV snapshot, in basis points. Without a
+// period each action is capped alone.
+type NAVLimit struct {
+	Protocol      string `json:"protocol,omitempty"`
+	Verb          Verb   `json:"verb,omitempty"`
+	MaxNAVBps     uint64 `json:"maxNavBps"`
+	PeriodSeconds uint64 `json:"periodSeconds,omitempty"`
+	MaxAgeSeconds uint64 `json:"maxAgeSeconds,omitempty"`
+}
+
+// ExposureAlert represents a limit whose usage crossed its alert threshold
+type ExposureAlert struct {
+	Limit ExposureLimit
+	Used  *big.Int
+	Cap   *big.Int
+}
+
+// ErrPolicyViolation is returned when an action breaks a configured policy
+var ErrPolicyViolation = fmt.Errorf("policy violation")
+
+// String describes the limit for logs and errors
+func (l ExposureLimit) String() string {
+	protocol := l.Protocol
+	if protocol == "" {
+		protocol = "*"
+	}
+	verb := string(l.Verb)
+	if verb == "" {
+		verb = "*"
+	}
+	if l.Group != "" {
+		flow := l.Flow
+		if flow == "" {
+			flow = "gross"
+		}
+		return fmt.Sprintf("%s/%s %s %s $%d per %ds", protocol, verb, l.Group, flow, l.MaxUSD, l.PeriodSeconds)
+	}
+	return fmt.Sprintf("%s/%s $%d per %ds", protocol, verb, l.MaxUSD, l.PeriodSeconds)
+}
+
+// matches reports whether an action falls under the limit
+func (l ExposureLimit) matches(action *Action) bool {
+	return actionMatches(l.Protocol, l.Verb, action)
+}
+
+// actionMatches reports whether an action has a protocol and verb. Empty
+// filters match every action.
+func actionMatches(protocol string, verb Verb, action *Action) bool {
+	if protocol != "" && !strings.EqualFold(protocol, action.Protocol) {
+		return false
+	}
+	return verb == "" || verb == action.Verb
+}
+
+// String describes the NAV limit for logs and errors
+func (l NAVLimit) String() string {
+	protocol := l.Protocol
+	if protocol == "" {
+		protocol = "*"
+	}
+	verb := string(l.Verb)
+	if verb == "" {
+		verb = "*"
+	}
+	if l.PeriodSeconds == 0 {
+		return fmt.Sprintf("%s/%s %d bps of NAV per action", protocol, verb, l.MaxNAVBps)
+	}
+	return fmt.Sprintf("%s/%s %d bps of NAV per %ds", protocol, verb, l.MaxNAVBps, l.PeriodSeconds)
+}
+
+// maxAge returns how old the NAV snapshot a limit is computed from can be
+func (l NAVLimit) maxAge() time.Duration {
+	if l.MaxAgeSeconds == 0 {
+		return defaultNAVMaxAge
+	}
+	return seconds(l.MaxAgeSeconds)
+}
+
+// capUSD returns the cap with 18 decimals, like CalculateUSDValue
+func (l ExposureLimit) capUSD() *big.Int {
+	return fixedpoint.FromWhole(l.MaxUSD, fixedpoint.USDDecimals)
+}
+
+// ValidatePolicy checks the policy configuration against the configured tokens
+func ValidatePolicy(policy *PolicyConfig, tokens []TokenConfig) error {
+	if policy == nil {
+		return nil
+	}
+	if err := ValidateConfidence(policy.MinConfidence); err != nil {
+		return fmt.Errorf("minConfidence: %w", err)
+	}
+	for protocol, c := range policy.ProtocolMinConfidence {
+		if err := ValidateConfidence(c); err != nil {
+			return fmt.Errorf("protocolMinConfidence %s: %w", protocol, err)
+		}
+	}
+	for i, limit := range policy.ExposureLimits {
+		if limit.MaxUSD == 0 || limit.PeriodSeconds == 0 {
+			return fmt.Errorf("exposure limit %d: maxUsd and periodSeconds are required", i)
+		}
+		if limit.AlertPercent > 100 {
+			return fmt.Errorf("exposure limit %d: alertPercent must be at most 100", i)
+		}
+		switch limit.Flow {
+		case "", FlowInflow, FlowOutflow:
+		default:
+			return fmt.Errorf("exposure limit %d: unknown flow %q", i, limit.Flow)
+		}
+		if limit.Group == "" && limit.Flow != "" {
+			return fmt.Errorf("exposure limit %d: flow requires a group", i)
+		}
+		if limit.Group != "" && !hasTokenGroup(tokens, limit.Group) {
+			return fmt.Errorf("exposure limit %d: no token in group %q", i, limit.Group)
+		}
+	}
+	for i, limit := range policy.NAVLimits {
+		if limit.MaxNAVBps == 0 || limit.MaxNAVBps > fixedpoint.BasisPoints {
+			return fmt.Errorf("nav limit %d: maxNavBps must be between 1 and %d", i, fixedpoint.BasisPoints)
+		}
+	}
+	if err := ValidateAnomaly(policy.Anomaly); err != nil {
+		return fmt.Errorf("anomaly: %w", err)
+	}
+	if err := ValidateStructuring(policy.Structuring); err != nil {
+		return fmt.Errorf("structuring: %w", err)
+	}
+	if err := validateRecipients(policy); err != nil {
+		return err
+	}
+	return validateModifiers(policy)
+}
+
+// EvaluatePolicy checks the value moved by an action against the exposure
+// limits, using the ledger aggregates of each limit's period. Group limits only
+// apply to actions moving tokens of their group. It returns the limits past
+// their alert threshold, and ErrPolicyViolation if a cap would be exceeded.
+// Caps are scaled down by the modifiers active at now.
+func EvaluatePolicy(policy *PolicyConfig, s *WorkflowState, action *Action, accounting *ActionAccounting, now time.Time) ([]ExposureAlert, error) {
+	if policy == nil {
+		return nil, nil
+	}
+
+	percent := limitPercent(policy, now)
+	groupFlows := accounting.GroupFlows()
+	var alerts []ExposureAlert
+	for _, limit := range policy.ExposureLimits {
+		if !limit.matches(action) {
+			continue
+		}
+
+		since := now.Add(-seconds(limit.PeriodSeconds))
+		var used *big.Int
+		if limit.Group == "" {
+			used = s.ExposureSince(limit.Protocol, limit.Verb, since)
+			used.Add(used, accounting.GrossUSD())
+		} else {
+			flow, ok := groupFlows[limit.Group]
+			if !ok || flow.value(limit.Flow).Sign() == 0 {
+				continue
+			}
+			used = s.GroupExposureSince(limit.Protocol, limit.Verb, limit.Group, limit.Flow, since)
+			used.Add(used, flow.value(limit.Flow))
+		}
+
+		capUSD, scaled := scheduledCap(limit.capUSD(), percent)
+		if used.Cmp(capUSD) > 0 {
+			return alerts, fmt.Errorf("%w: exposure %s would exceed %s%s", ErrPolicyViolation, used, limit, scaled)
+		}
+
+		alertPercent := limit.AlertPercent
+		if alertPercent == 0 {
+			alertPercent = defaultExposureAlertPercent
+		}
+		threshold := fixedpoint.Percent(capUSD, alertPercent, fixedpoint.RoundDown)
+		if used.Cmp(threshold) >= 0 {
+			alerts = append(alerts, ExposureAlert{Limit: limit, Used: used, Cap: capUSD})
+		}
+	}
+
+	return alerts, nil
+}
+
+// EvaluateNAVLimits checks the value a subaccount moves with an action against
+// the NAV limits, using its latest NAV snapshot and the ledger of each limit's
+// period. NAV limits only apply to the subaccounts snapshotted by nav; others
+// are skipped. Without a snapshot recent enough the action is rejected. Caps
+// are scaled down by the modifiers active at now.
+func EvaluateNAVLimits(policy *PolicyConfig, nav *NAVConfig, s *WorkflowState, subAccount string, action *Action, grossUSD *big.Int, now time.Time) error {
+	if policy == nil || nav == nil {
+		return nil
+	}
+	tracked := false
+	for _, snapshotted := range navSubAccounts(nav) {
+		if snapshotted.Hex() == subAccount {
+			tracked = true
+			break
+		}
+	}
+	if !tracked {
+		return nil
+	}
+
+	percent := limitPercent(policy, now)
+	for _, limit := range policy.NAVLimits {
+		if !actionMatches(limit.Protocol, limit.Verb, action) {
+			continue
+		}
+
+		nav := s.LastNAV(subAccount)
+		if nav == nil || now.Sub(nav.At) > limit.maxAge() {
+			return fmt.Errorf("%w: no NAV snapshot of %s within %s for %s", ErrPolicyViolation, subAccount, limit.maxAge(), limit)
+		}
+
+		used := new(big.Int).Set(grossUSD)
+		if limit.PeriodSeconds > 0 {
+			used.Add(used, s.SubaccountExposureSince(subAccount, limit.Protocol, limit.Verb, now.Add(-seconds(limit.PeriodSeconds))))
+		}
+
+		capUSD, scaled := scheduledCap(fixedpoint.MulDiv(nav.NAVUSD, new(big.Int).SetUint64(limit.MaxNAVBps), big.NewInt(fixedpoint.BasisPoints), fixedpoint.RoundDown), percent)
+		if used.Cmp(capUSD) > 0 {
+			return fmt.Errorf("%w: %s would exceed %s%s (NAV %s)", ErrPolicyViolation, used, limit, scaled, nav.NAVUSD)
+		}
+	}
+
+	return nil
+}
+
+// longestExposurePeriod returns the period the ledger must cover
+func longestExposurePeriod(policy *PolicyConfig) time.Duration {
+	var longest time.Duration
+	if policy == nil {
+		return longest
+	}
+	for _, limit := range policy.ExposureLimits {
+		if period := seconds(limit.PeriodSeconds); period > longest {
+			longest = period
+		}
+	}
+	for _, limit := range policy.NAVLimits {
+		if period := seconds(limit.PeriodSeconds); period > longest {
+			longest = period
+		}
+	}
+	if policy.Anomaly != nil && seconds(policy.Anomaly.LookbackSeconds) > longest {
+		longest = seconds(policy.Anomaly.LookbackSeconds)
+	}
+	if policy.Structuring != nil && seconds(policy.Structuring.WindowSeconds) > longest {
+		longest = seconds(policy.Structuring.WindowSeconds)
+	}
+	return longest
+}
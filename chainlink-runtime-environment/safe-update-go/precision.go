@@ -0,0 +1,59 @@
+//go:build wasip1
+
+package main
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// Overflow policies for balance changes that do not fit the module's parameter type
+const (
+	// OverflowClamp submits the largest representable value and raises an alert
+	OverflowClamp = "clamp"
+
+	// OverflowBlock refuses to submit the update
+	OverflowBlock = "block"
+)
+
+// PrecisionConfig represents the range of balanceChange accepted by the module
+type PrecisionConfig struct {
+	BalanceChangeBits uint   `json:"balanceChangeBits"`
+	OverflowPolicy    string `json:"overflowPolicy"`
+}
+
+// ErrBalanceChangeOverflow is returned when an out of range value is blocked
+var ErrBalanceChangeOverflow = fmt.Errorf("balance change exceeds module range")
+
+// maxUnsigned returns 2^bits - 1
+func maxUnsigned(bits uint) *big.Int {
+	max := new(big.Int).Lsh(big.NewInt(1), bits)
+	return max.Sub(max, big.NewInt(1))
+}
+
+// ApplyPrecisionGuard checks that a balance change fits in an unsigned integer
+// of the configured width and applies the overflow policy. It returns the value
+// to submit and whether it was clamped.
+func ApplyPrecisionGuard(precision *PrecisionConfig, balanceChange *big.Int) (*big.Int, bool, error) {
+	if precision == nil || precision.BalanceChangeBits == 0 || precision.BalanceChangeBits >= 256 {
+		return balanceChange, false, nil
+	}
+
+	if balanceChange.Sign() < 0 {
+		return nil, false, fmt.Errorf("%w: negative value %s", ErrBalanceChangeOverflow, balanceChange)
+	}
+
+	max := maxUnsigned(precision.BalanceChangeBits)
+	if balanceChange.Cmp(max) <= 0 {
+		return balanceChange, false, nil
+	}
+
+	switch precision.OverflowPolicy {
+	case OverflowClamp:
+		return max, true, nil
+	case OverflowBlock, "":
+		return nil, false, fmt.Errorf("%w: %s does not fit in uint%d", ErrBalanceChangeOverflow, balanceChange, precision.BalanceChangeBits)
+	default:
+		return nil, false, fmt.Errorf("unknown overflow policy %q", precision.OverflowPolicy)
+	}
+}
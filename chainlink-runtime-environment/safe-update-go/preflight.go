@@ -0,0 +1,324 @@
+//go:build wasip1
+
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/blockchain/evm"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+)
+
+// ValidateConfig checks the configuration for errors that can be detected
+// without reaching the chain
+func ValidateConfig(config *Config) error {
+	if !config.ModuleAddress.IsSet() {
+		return fmt.Errorf("moduleAddress is required")
+	}
+
+	// Monitor-only workflows never submit, so they need no receiver
+	if !config.MonitorOnly {
+		if _, err := submissionReceiver(config); err != nil {
+			return err
+		}
+
+		if submissionMode(config) == SubmissionModeDirect && !config.ForwarderAddress.IsSet() {
+			return fmt.Errorf("forwarderAddress is required in %s submission mode", SubmissionModeDirect)
+		}
+		// The forwarder calls onReport on the receiver, which DeFiInteractorModule does not implement
+		if submissionMode(config) == SubmissionModeDirect && !config.ModuleReceiver {
+			return fmt.Errorf("%s submission mode requires a module implementing IReceiver (onReport); set moduleReceiver for such a module, or use %s mode",
+				SubmissionModeDirect, SubmissionModeProxy)
+		}
+	}
+
+	if config.Precision != nil {
+		switch config.Precision.OverflowPolicy {
+		case "", OverflowClamp, OverflowBlock:
+		default:
+			return fmt.Errorf("unknown overflow policy %q", config.Precision.OverflowPolicy)
+		}
+	}
+
+	if config.DecisionLog != nil && config.DecisionLog.AnchorSchedule != "" && !config.DecisionLog.AnchorReceiver.IsSet() {
+		return fmt.Errorf("decisionLog: anchorReceiver is required with anchorSchedule")
+	}
+
+	if config.AccountingProofs != nil && config.AccountingProofs.EpochSeconds == 0 {
+		return fmt.Errorf("accountingProofs: epochSeconds is required")
+	}
+	if config.AccountingProofs != nil && (config.DecisionLog == nil || config.DecisionLog.AnchorSchedule == "") {
+		return fmt.Errorf("accountingProofs: decisionLog.anchorSchedule is required to anchor the roots")
+	}
+
+	if err := ValidateFailover(config.Failover); err != nil {
+		return fmt.Errorf("failover: %w", err)
+	}
+
+	if err := ValidateModulePause(config.ModulePause); err != nil {
+		return fmt.Errorf("modulePause: %w", err)
+	}
+
+	if err := ValidateBackpressure(config.Backpressure); err != nil {
+		return fmt.Errorf("backpressure: %w", err)
+	}
+
+	if err := ValidateGasSchedule(config.GasSchedule); err != nil {
+		return fmt.Errorf("gasSchedule: %w", err)
+	}
+	if config.GasSchedule != nil && config.GasSchedule.Retries && config.Retry == nil {
+		return fmt.Errorf("gasSchedule: retries require a retry schedule")
+	}
+	if config.GasSchedule != nil && config.Backpressure == nil && !config.GasSchedule.Retries {
+		return fmt.Errorf("gasSchedule: nothing to schedule without backpressure batches or retries")
+	}
+
+	if err := ValidateSharding(config.Sharding); err != nil {
+		return fmt.Errorf("sharding: %w", err)
+	}
+
+	// An empty topic filter matches every subaccount
+	if _, err := subAccountTopics(config); err != nil {
+		return err
+	}
+
+	for i, token := range config.Tokens {
+		switch token.NegativePrice {
+		case "", NegativePriceReject, NegativePriceZero, NegativePriceAllow:
+		default:
+			return fmt.Errorf("unknown negative price policy %q for %s", token.NegativePrice, token.Symbol)
+		}
+		if err := ValidateFixedPrice(&config.Tokens[i]); err != nil {
+			return fmt.Errorf("token %s: %w", token.Symbol, err)
+		}
+		if err := ValidatePriceQuote(config, &config.Tokens[i]); err != nil {
+			return fmt.Errorf("token %s: %w", token.Symbol, err)
+		}
+	}
+
+	if err := ValidateNativeToken(config.Tokens); err != nil {
+		return err
+	}
+	if err := ValidateWrappedNative(config); err != nil {
+		return err
+	}
+
+	for addr, hash := range config.ModuleCodeHashes {
+		if b, err := hex.DecodeString(strings.TrimPrefix(hash, "0x")); err != nil || len(b) != common.HashLength {
+			return fmt.Errorf("invalid code hash %q for module %s", hash, addr)
+		}
+	}
+
+	if config.ClockSkew != nil {
+		switch config.ClockSkew.Policy {
+		case "", SkewFlag, SkewReject:
+		default:
+			return fmt.Errorf("unknown clock skew policy %q", config.ClockSkew.Policy)
+		}
+	}
+
+	if err := ValidateValueTransform(config.ValueTransform, config.Tokens); err != nil {
+		return fmt.Errorf("valueTransform: %w", err)
+	}
+
+	if err := ValidateTokenNative(config.TokenNative); err != nil {
+		return fmt.Errorf("tokenNative: %w", err)
+	}
+	if config.TokenNative != nil && config.ValueTransform != nil {
+		return fmt.Errorf("tokenNative: valueTransform does not apply to token-native modules")
+	}
+
+	if err := ValidateDualWrite(config); err != nil {
+		return fmt.Errorf("dualWrite: %w", err)
+	}
+
+	if err := ValidatePolicy(config.Policy, config.Tokens); err != nil {
+		return fmt.Errorf("policy: %w", err)
+	}
+
+	if err := ValidateFormat(config.Formatting); err != nil {
+		return fmt.Errorf("formatting: %w", err)
+	}
+
+	if err := ValidateAlerts(config.Alerts); err != nil {
+		return fmt.Errorf("alerts: %w", err)
+	}
+
+	if err := ValidateWatch(config.Watch); err != nil {
+		return fmt.Errorf("watch: %w", err)
+	}
+
+	if err := ValidateNAV(config.NAV); err != nil {
+		return fmt.Errorf("nav: %w", err)
+	}
+	if config.Policy != nil && len(config.Policy.NAVLimits) > 0 && config.NAV == nil {
+		return fmt.Errorf("policy: navLimits require nav snapshots")
+	}
+
+	if err := ValidateRetention(config.Retention); err != nil {
+		return fmt.Errorf("retention: %w", err)
+	}
+
+	if err := ValidateStore(config.Store); err != nil {
+		return fmt.Errorf("store: %w", err)
+	}
+	if features := historyFeatures(config); len(features) > 0 && !PersistentStore(config) {
+		return fmt.Errorf("store: a persistent store is required by %s", strings.Join(features, ", "))
+	}
+	// The stored document, audit log included, is saved on every execution
+	if PersistentStore(config) && (config.Retention == nil || config.Retention.AuditDays == 0) {
+		return fmt.Errorf("retention: auditDays is required with a persistent store, so the stored audit log stays bounded")
+	}
+
+	if err := ValidateRegression(config.Regression); err != nil {
+		return fmt.Errorf("regression: %w", err)
+	}
+
+	if err := ValidateNoOp(config.NoOp); err != nil {
+		return fmt.Errorf("noOp: %w", err)
+	}
+
+	if err := ValidatePriceCache(config.PriceCache); err != nil {
+		return fmt.Errorf("priceCache: %w", err)
+	}
+	if config.PriceCache != nil && config.TokenNative != nil {
+		return fmt.Errorf("priceCache: token-native modules estimate unpriced tokens at zero instead")
+	}
+
+	if err := ValidateCowSwap(config.CowSwap); err != nil {
+		return fmt.Errorf("cowSwap: %w", err)
+	}
+
+	if err := ValidateGMX(config.GMX); err != nil {
+		return fmt.Errorf("gmx: %w", err)
+	}
+
+	if err := ValidateLogScan(config.LogScan); err != nil {
+		return fmt.Errorf("logScan: %w", err)
+	}
+
+	if config.SafeTxService != nil && !strings.HasPrefix(config.SafeTxService.BaseURL, "https://") {
+		return fmt.Errorf("safeTxService: baseUrl must be an https URL")
+	}
+
+	for i, vault := range config.Vaults {
+		if !vault.Address.IsSet() || !vault.Asset.IsSet() {
+			return fmt.Errorf("vault %d: address and asset are required", i)
+		}
+		if vault.Protocol != "" && !vaultProtocols[vault.Protocol] && !nativePayoutProtocols[vault.Protocol] {
+			return fmt.Errorf("vault %d: unknown protocol %q", i, vault.Protocol)
+		}
+		if nativePayoutProtocols[vault.Protocol] && findTokenConfig(config, vault.Asset.Address) == nil {
+			return fmt.Errorf("vault %d: %s native ETH is valued as %s, which is not a configured token", i, vault.Protocol, vault.Asset.Hex())
+		}
+		if vault.Protocol == eigenLayerProtocol && vault.Address.Address != eigenLayerBeaconChainETHStrategy {
+			return fmt.Errorf("vault %d: the eigenlayer entry must be the beacon chain ETH strategy %s", i, eigenLayerBeaconChainETHStrategy.Hex())
+		}
+	}
+
+	if err := ValidateCompoundV2Forks(config.CompoundV2Forks); err != nil {
+		return fmt.Errorf("compoundV2Forks: %w", err)
+	}
+
+	for chain, explorer := range config.Explorers {
+		if err := ValidateExplorer(explorer); err != nil {
+			return fmt.Errorf("explorer %s: %w", chain, err)
+		}
+	}
+
+	if sim := config.Simulation; sim != nil {
+		if sim.AccountSlug == "" || sim.ProjectSlug == "" || sim.NetworkID == "" || sim.AccessKeySecret == "" {
+			return fmt.Errorf("simulation: accountSlug, projectSlug, networkId and accessKeySecret are required")
+		}
+	}
+
+	if config.Migration != nil {
+		if err := ValidateConfig(config.Migration.NewModule.TargetConfig(config)); err != nil {
+			return fmt.Errorf("migration: %w", err)
+		}
+	}
+
+	for i, mirror := range config.Mirrors {
+		if err := ValidateConfig(mirror.TargetConfig(config)); err != nil {
+			return fmt.Errorf("mirror %d: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// expectedUpdater returns the address that calls the module in the configured
+// submission mode
+func expectedUpdater(config *Config) common.Address {
+	if submissionMode(config) == SubmissionModeDirect {
+		return config.ForwarderAddress.Address
+	}
+	return config.ProxyAddress.Address
+}
+
+// Preflight verifies once per config and module that the configured proxy or
+// forwarder is allowed to call updateSubaccountAllowances on the module.
+// Capability calls are not available in InitWorkflow, so it runs before the
+// first on-chain interaction instead. The pass is recorded with the config
+// hash in the stored state, so later executions skip it until the config
+// changes or a submission to the module fails. Without a persistent store it
+// runs on every execution.
+func Preflight(config *Config, runtime cre.Runtime, evmClient *evm.Client) error {
+	if hash, passed := state.PreflightPassed[config.ModuleAddress.Hex()]; passed && hash == activeConfigHash {
+		return nil
+	}
+
+	moduleAddr := config.ModuleAddress.Address
+	caller := expectedUpdater(config)
+
+	// Role query: the module only accepts updates from its authorized updater
+	updater, err := GetAuthorizedUpdater(runtime, evmClient, moduleAddr)
+	if err != nil {
+		return fmt.Errorf("preflight: %w", err)
+	}
+
+	if updater != caller {
+		return fmt.Errorf("preflight: %s (%s mode) is not the authorized updater of module %s, expected %s; call setAuthorizedUpdater(%s) from the module owner",
+			caller.Hex(), submissionMode(config), moduleAddr.Hex(), updater.Hex(), caller.Hex())
+	}
+
+	// Direct reports reach the module through onReport, checked through ERC-165
+	if submissionMode(config) == SubmissionModeDirect {
+		supported, err := SupportsReceiver(runtime, evmClient, moduleAddr)
+		if err != nil {
+			return fmt.Errorf("preflight: %w", err)
+		}
+		if !supported {
+			return fmt.Errorf("preflight: module %s does not declare IReceiver (supportsInterface(0x%x)), so the forwarder cannot deliver %s mode reports; use %s mode",
+				moduleAddr.Hex(), receiverInterfaceID, SubmissionModeDirect, SubmissionModeProxy)
+		}
+	}
+
+	// Static call: a zero balance change is a no-op but still runs the access check
+	probeCallData, err := packAllowanceUpdate(moduleAddr, big.NewInt(0))
+	if config.TokenNative != nil {
+		probeCallData, err = packTokenAllowanceUpdate(moduleAddr, common.Address{}, big.NewInt(0))
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = evmClient.CallContract(runtime, &evm.CallContractRequest{
+		Call: &evm.CallMsg{
+			From: caller.Bytes(),
+			To:   moduleAddr.Bytes(),
+			Data: probeCallData,
+		},
+	}).Await()
+	if err != nil {
+		return fmt.Errorf("preflight: static allowance update call from %s reverted: %w", caller.Hex(), err)
+	}
+
+	runtime.Logger().Info("Preflight passed", "module", moduleAddr.Hex(), "updater", caller.Hex(), "mode", submissionMode(config))
+	state.PreflightPassed[config.ModuleAddress.Hex()] = activeConfigHash
+	return nil
+}
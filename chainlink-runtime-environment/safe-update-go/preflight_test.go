@@ -0,0 +1,68 @@
+//go:build wasip1
+
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"safe-update-go/scenarios"
+)
+
+// TestPreflightDirectReceiver only lets direct mode submit to a module the
+// forwarder can deliver reports to
+func TestPreflightDirectReceiver(t *testing.T) {
+	config := scenarioConfig(t, "{}")
+	config.SubmissionMode = SubmissionModeDirect
+	config.ForwarderAddress = Address{Address: scenarios.Updater}
+	if err := ValidateConfig(config); err == nil || !strings.Contains(err.Error(), "requires a module implementing IReceiver") {
+		t.Fatalf("validate config: %v, want direct mode rejected without moduleReceiver", err)
+	}
+	config.ModuleReceiver = true
+	if err := ValidateConfig(config); err != nil {
+		t.Fatalf("validate config: %v", err)
+	}
+
+	runtime, chain := newScenarioChain(t, config)
+	for _, receiver := range []bool{false, true} {
+		chain.receiver = receiver
+		state = NewWorkflowState()
+		err := Preflight(config, runtime, newEVMClient(config))
+		if receiver && err != nil {
+			t.Errorf("preflight of a receiver: %v", err)
+		}
+		if !receiver && (err == nil || !strings.Contains(err.Error(), "does not declare IReceiver")) {
+			t.Errorf("preflight of a module without onReport: %v", err)
+		}
+	}
+}
+
+// TestPreflightStored runs the preflight once for instances sharing a store,
+// and again once a submission failed or the config changed
+func TestPreflightStored(t *testing.T) {
+	h := newHarness(t)
+	previous := activeConfigHash
+	t.Cleanup(func() { activeConfigHash = previous })
+	activeConfigHash = "first"
+
+	for i := 0; i < 2; i++ {
+		if !h.withdraw(0) {
+			t.Fatalf("update %d not submitted", i)
+		}
+	}
+	if h.chain.updaterReads != 1 {
+		t.Fatalf("preflight ran %d times, want once", h.chain.updaterReads)
+	}
+
+	state.RecordModuleResult(scenarios.Module.Hex(), errors.New("reverted"), h.runtime.now)
+	if _, passed := state.PreflightPassed[scenarios.Module.Hex()]; passed {
+		t.Error("preflight pass kept after a failed submission")
+	}
+
+	activeConfigHash = "second"
+	h.withdraw(0)
+	if h.chain.updaterReads != 2 {
+		t.Errorf("preflight ran %d times, want again under a new config", h.chain.updaterReads)
+	}
+}
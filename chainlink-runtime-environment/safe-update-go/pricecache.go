@@ -0,0 +1,148 @@
+//go:build wasip1
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"safe-update-go/fixedpoint"
+)
+
+// PriceCacheConfig represents the warm standby price cache. The last USD
+// price of every token that passed its feed checks is kept in the state
+// store. While a feed fails or is stale, actions of the verb moving at most
+// maxUsd are valued from the cached price for up to maxAgeSeconds after it
+// was read, instead of failing until the feed recovers. At most maxWindowUsd
+// is valued from the cache per window of maxAgeSeconds.
+type PriceCacheConfig struct {
+	MaxAgeSeconds uint64 `json:"maxAgeSeconds"`
+	MaxUSD        uint64 `json:"maxUsd"`
+	MaxWindowUSD  uint64 `json:"maxWindowUsd"`
+	Verb          Verb   `json:"verb,omitempty"`
+}
+
+// CachedPrice represents the last good USD price of a token
+type CachedPrice struct {
+	Price    *big.Int
+	Decimals uint8
+	CachedAt time.Time
+}
+
+// CachedValuationWindow represents the gross USD of the actions valued from
+// cached prices since Start. A window lasts maxAgeSeconds.
+type CachedValuationWindow struct {
+	Start    time.Time
+	GrossUSD *big.Int
+}
+
+// ValidatePriceCache checks the price cache configuration
+func ValidatePriceCache(cache *PriceCacheConfig) error {
+	if cache == nil {
+		return nil
+	}
+	if cache.MaxAgeSeconds == 0 || cache.MaxUSD == 0 || cache.MaxWindowUSD == 0 {
+		return fmt.Errorf("maxAgeSeconds, maxUsd and maxWindowUsd are required")
+	}
+	if cache.MaxWindowUSD < cache.MaxUSD {
+		return fmt.Errorf("maxWindowUsd %d is below maxUsd %d", cache.MaxWindowUSD, cache.MaxUSD)
+	}
+	return nil
+}
+
+// cacheFallback reports whether a pricing error may be bridged by the cache:
+// a feed that cannot be read or answers stale. Rejected answers, such as
+// negative prices, and configuration errors never are.
+func cacheFallback(err error) bool {
+	return errors.Is(err, ErrFeedUnavailable) || errors.Is(err, ErrStalePrice)
+}
+
+// verb returns the verb of the actions that may be valued from the cache
+func (c *PriceCacheConfig) verb() Verb {
+	if c.Verb == "" {
+		return VerbWithdraw
+	}
+	return c.Verb
+}
+
+// CachePrice records the last good price of a token when the cache is enabled
+func (s *WorkflowState) CachePrice(cache *PriceCacheConfig, symbol string, price *big.Int, decimals uint8, now time.Time) {
+	if cache == nil {
+		return
+	}
+	s.PriceCache[symbol] = CachedPrice{Price: new(big.Int).Set(price), Decimals: decimals, CachedAt: now}
+}
+
+// CachedPriceOf returns the cached price of a token, or nil when the cache is
+// disabled, holds no price for it or its price is older than maxAgeSeconds
+func (s *WorkflowState) CachedPriceOf(cache *PriceCacheConfig, symbol string, now time.Time) *CachedPrice {
+	if cache == nil {
+		return nil
+	}
+	cached, ok := s.PriceCache[symbol]
+	if !ok || cached.Price == nil || now.Sub(cached.CachedAt) > seconds(cache.MaxAgeSeconds) {
+		return nil
+	}
+	return &cached
+}
+
+// CheckCachedValuation rejects the valuation of an action from cached prices
+// unless it is of the cache's verb, moves at most maxUsd, and keeps the
+// window's cached valuations at most maxWindowUsd
+func CheckCachedValuation(cache *PriceCacheConfig, window CachedValuationWindow, action *Action, accounting *ActionAccounting, now time.Time) error {
+	cached := accounting.CachedPrices()
+	if cached == "" {
+		return nil
+	}
+	if action.Verb != cache.verb() {
+		return fmt.Errorf("prices of %s only available from cache, which does not value %s actions", cached, action.Verb)
+	}
+	maxUSD := fixedpoint.FromWhole(cache.MaxUSD, fixedpoint.USDDecimals)
+	if gross := accounting.GrossUSD(); gross.Cmp(maxUSD) > 0 {
+		return fmt.Errorf("prices of %s only available from cache, which does not value actions above $%d (gross %s)", cached, cache.MaxUSD, gross.String())
+	}
+	used := window.used(cache, now)
+	maxWindowUSD := fixedpoint.FromWhole(cache.MaxWindowUSD, fixedpoint.USDDecimals)
+	if total := new(big.Int).Add(used, accounting.GrossUSD()); total.Cmp(maxWindowUSD) > 0 {
+		return fmt.Errorf("prices of %s only available from cache, which values at most $%d per %s (used %s)", cached, cache.MaxWindowUSD,
+			seconds(cache.MaxAgeSeconds), used.String())
+	}
+	return nil
+}
+
+// used returns the gross USD valued from cached prices in the window, or zero
+// once the window has expired
+func (w CachedValuationWindow) used(cache *PriceCacheConfig, now time.Time) *big.Int {
+	if w.GrossUSD == nil || now.Sub(w.Start) > seconds(cache.MaxAgeSeconds) {
+		return new(big.Int)
+	}
+	return w.GrossUSD
+}
+
+// RecordCachedValuation adds an action valued from cached prices to the
+// window, opening a new window when the last one has expired
+func (s *WorkflowState) RecordCachedValuation(cache *PriceCacheConfig, accounting *ActionAccounting, now time.Time) {
+	if cache == nil || accounting.CachedPrices() == "" {
+		return
+	}
+	used := s.CachedValuations.used(cache, now)
+	if used.Sign() == 0 {
+		s.CachedValuations.Start = now
+	}
+	s.CachedValuations.GrossUSD = new(big.Int).Add(used, accounting.GrossUSD())
+}
+
+// CachedPrices returns the comma separated symbol@time of the deltas valued
+// from a cached price, or "" when every delta was priced live
+func (a *ActionAccounting) CachedPrices() string {
+	var prices []string
+	for _, delta := range a.Deltas {
+		if !delta.CachedAt.IsZero() {
+			prices = append(prices, delta.Symbol+"@"+delta.CachedAt.UTC().Format(time.RFC3339))
+		}
+	}
+	return strings.Join(prices, ",")
+}
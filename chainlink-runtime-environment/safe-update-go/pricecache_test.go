@@ -0,0 +1,79 @@
+//go:build wasip1
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"safe-update-go/fixedpoint"
+)
+
+func TestCacheFallback(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"feed unavailable", fmt.Errorf("%w for WETH: %w", ErrFeedUnavailable, errors.New("call reverted")), true},
+		{"stale price", fmt.Errorf("%w: WETH answer is 2h0m0s old", ErrStalePrice), true},
+		{"negative price", fmt.Errorf("%w -1 for WETH", ErrNegativePrice), false},
+		{"quote token missing", errors.New("quote token ETH of stETH not in config"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cacheFallback(tt.err); got != tt.want {
+				t.Errorf("fallback %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestCheckCachedValuationWindow expects the actions valued from the cache to
+// be capped per action and in total per window
+func TestCheckCachedValuationWindow(t *testing.T) {
+	cache := &PriceCacheConfig{MaxAgeSeconds: 3600, MaxUSD: 5000, MaxWindowUSD: 8000}
+	start := time.Date(2026, 10, 16, 8, 0, 0, 0, time.UTC)
+	usd := func(whole uint64) *big.Int { return fixedpoint.FromWhole(whole, fixedpoint.USDDecimals) }
+	cachedAccounting := func(whole uint64) *ActionAccounting {
+		return &ActionAccounting{Deltas: []AssetDelta{{Symbol: "WETH", USDValue: usd(whole), CachedAt: start}}}
+	}
+	withdraw := &Action{Verb: VerbWithdraw}
+
+	s := NewWorkflowState()
+	for _, step := range []struct {
+		name   string
+		gross  uint64
+		at     time.Duration
+		action *Action
+		ok     bool
+	}{
+		{"first", 4000, 0, withdraw, true},
+		{"above maxUsd", 6000, time.Minute, withdraw, false},
+		{"other verb", 100, time.Minute, &Action{Verb: VerbDeposit}, false},
+		{"within window", 3000, 2 * time.Minute, withdraw, true},
+		{"window exhausted", 2000, 3 * time.Minute, withdraw, false},
+		{"next window", 2000, time.Hour + time.Minute, withdraw, true},
+	} {
+		accounting := cachedAccounting(step.gross)
+		now := start.Add(step.at)
+		err := CheckCachedValuation(cache, s.CachedValuations, step.action, accounting, now)
+		if (err == nil) != step.ok {
+			t.Fatalf("%s: error %v", step.name, err)
+		}
+		if err == nil {
+			s.RecordCachedValuation(cache, accounting, now)
+		}
+	}
+	if s.CachedValuations.GrossUSD.Cmp(usd(2000)) != 0 || !s.CachedValuations.Start.Equal(start.Add(time.Hour+time.Minute)) {
+		t.Errorf("window %s from %s", s.CachedValuations.GrossUSD, s.CachedValuations.Start)
+	}
+
+	live := &ActionAccounting{Deltas: []AssetDelta{{Symbol: "WETH", USDValue: usd(100000)}}}
+	if err := CheckCachedValuation(cache, s.CachedValuations, withdraw, live, start); err != nil {
+		t.Errorf("live prices rejected: %v", err)
+	}
+}
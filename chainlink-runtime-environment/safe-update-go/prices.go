@@ -0,0 +1,243 @@
+//go:build wasip1
+
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/blockchain/evm"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+
+	"safe-update-go/fixedpoint"
+)
+
+// PriceData represents the latest answer of a Chainlink price feed
+type PriceData struct {
+	Answer    *big.Int
+	Decimals  uint8
+	UpdatedAt time.Time
+}
+
+// GetTokenDecimals fetches the ERC20 decimals of a token
+func GetTokenDecimals(runtime cre.Runtime, evmClient *evm.Client, tokenAddr common.Address) (uint8, error) {
+	parsedERC20ABI, err := abi.JSON(strings.NewReader(erc20ABI))
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse ERC20 ABI: %w", err)
+	}
+
+	decimalsCallData, err := parsedERC20ABI.Pack("decimals")
+	if err != nil {
+		return 0, fmt.Errorf("failed to pack decimals call: %w", err)
+	}
+
+	decimalsReq := &evm.CallContractRequest{
+		Call: &evm.CallMsg{
+			To:   tokenAddr.Bytes(),
+			Data: decimalsCallData,
+		},
+	}
+
+	decimalsResult, err := evmClient.CallContract(runtime, decimalsReq).Await()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get token decimals: %w", err)
+	}
+
+	var tokenDecimals uint8
+	err = parsedERC20ABI.UnpackIntoInterface(&tokenDecimals, "decimals", decimalsResult.Data)
+	if err != nil {
+		return 0, fmt.Errorf("failed to unpack decimals: %w", err)
+	}
+	if err := fixedpoint.CheckDecimals(tokenDecimals); err != nil {
+		return 0, fmt.Errorf("token %s: %w", tokenAddr.Hex(), err)
+	}
+
+	return tokenDecimals, nil
+}
+
+// Policies for price feeds returning a negative answer
+const (
+	// NegativePriceReject refuses to value the token (default)
+	NegativePriceReject = "reject"
+
+	// NegativePriceZero values the token at zero
+	NegativePriceZero = "zero"
+
+	// NegativePriceAllow keeps the signed price, so the token's USD value is negative
+	NegativePriceAllow = "allow"
+)
+
+// ErrNegativePrice is returned when a negative answer is rejected
+var ErrNegativePrice = fmt.Errorf("negative price")
+
+// decodeInt256 decodes the i-th 32 byte word of ABI encoded data as a two's complement int256
+func decodeInt256(data []byte, i int) (*big.Int, error) {
+	start := i * 32
+	if len(data) < start+32 {
+		return nil, fmt.Errorf("data too short for word %d", i)
+	}
+	value := new(big.Int).SetBytes(data[start : start+32])
+	if data[start]&0x80 != 0 {
+		value.Sub(value, new(big.Int).Lsh(big.NewInt(1), 256))
+	}
+	return value, nil
+}
+
+// ApplyNegativePricePolicy returns the price to value a token with, applying
+// the token's policy when the feed answer is negative
+func ApplyNegativePricePolicy(token *TokenConfig, price *big.Int) (*big.Int, error) {
+	if price.Sign() >= 0 {
+		return price, nil
+	}
+
+	switch token.NegativePrice {
+	case NegativePriceAllow:
+		return price, nil
+	case NegativePriceZero:
+		return new(big.Int), nil
+	default:
+		return nil, fmt.Errorf("%w %s for %s", ErrNegativePrice, price, token.Symbol)
+	}
+}
+
+// HasPeggedPrice reports whether the token is configured as pegged: it has no
+// price feed of its own and is valued 1:1 at the token it is quoted in, such
+// as frxETH at WETH
+func (t *TokenConfig) HasPeggedPrice() bool {
+	return t.Pegged
+}
+
+// PeggedPriceData returns the 1:1 rate of a pegged token to its quote token as
+// a feed answer updated now
+func PeggedPriceData(now time.Time) *PriceData {
+	return &PriceData{Answer: fixedpoint.Pow10(int(fixedpoint.USDDecimals)), Decimals: fixedpoint.USDDecimals, UpdatedAt: now}
+}
+
+// ErrStalePrice is returned when a feed answer is older than the policy allows
+var ErrStalePrice = fmt.Errorf("stale price")
+
+// ErrFeedUnavailable is returned when a price feed cannot be read
+var ErrFeedUnavailable = fmt.Errorf("feed unavailable")
+
+// CheckPriceAge fails when the policy caps the age of feed answers and the
+// answer is older. Fixed prices are always current.
+func CheckPriceAge(policy *PolicyConfig, token *TokenConfig, priceData *PriceData, now time.Time) error {
+	if policy == nil || policy.MaxPriceAgeSeconds == 0 {
+		return nil
+	}
+	if age := now.Sub(priceData.UpdatedAt); age > seconds(policy.MaxPriceAgeSeconds) {
+		return fmt.Errorf("%w: %s answer is %s old, at most %s allowed", ErrStalePrice, token.Symbol,
+			age.Truncate(time.Second), seconds(policy.MaxPriceAgeSeconds))
+	}
+	return nil
+}
+
+// ValidatePriceQuote checks that the token a feed is quoted in is configured
+// and that following quotes ends at a USD price. A quote without a feed is
+// only a 1:1 peg when the token says so.
+func ValidatePriceQuote(config *Config, token *TokenConfig) error {
+	if token.Pegged && (token.PriceFeedQuote == "" || token.PriceFeedAddress.IsSet()) {
+		return fmt.Errorf("pegged requires priceFeedQuote and no priceFeedAddress")
+	}
+	if token.PriceFeedQuote != "" && !token.PriceFeedAddress.IsSet() && !token.Pegged {
+		return fmt.Errorf("priceFeedQuote %s without priceFeedAddress requires pegged", token.PriceFeedQuote)
+	}
+	seen := map[string]bool{token.Symbol: true}
+	for quote := token; quote.PriceFeedQuote != ""; {
+		if quote.HasFixedPrice() {
+			return fmt.Errorf("priceFeedQuote and fixedPriceUsd are exclusive")
+		}
+		next := findTokenBySymbol(config, quote.PriceFeedQuote)
+		if next == nil {
+			return fmt.Errorf("priceFeedQuote %s is not a configured token", quote.PriceFeedQuote)
+		}
+		if seen[next.Symbol] {
+			return fmt.Errorf("priceFeedQuote %s is part of a quote cycle", next.Symbol)
+		}
+		seen[next.Symbol] = true
+		quote = next
+	}
+	return nil
+}
+
+// GetPriceFromFeed fetches the latest answer and decimals from a Chainlink price feed
+func GetPriceFromFeed(runtime cre.Runtime, evmClient *evm.Client, priceFeedAddr common.Address) (*PriceData, error) {
+	parsedPriceFeedABI, err := abi.JSON(strings.NewReader(priceFeedABI))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse price feed ABI: %w", err)
+	}
+
+	latestRoundDataCallData, err := parsedPriceFeedABI.Pack("latestRoundData")
+	if err != nil {
+		return nil, fmt.Errorf("failed to pack latestRoundData call: %w", err)
+	}
+
+	priceReq := &evm.CallContractRequest{
+		Call: &evm.CallMsg{
+			To:   priceFeedAddr.Bytes(),
+			Data: latestRoundDataCallData,
+		},
+	}
+
+	priceResult, err := evmClient.CallContract(runtime, priceReq).Await()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get price: %w", err)
+	}
+
+	var roundData struct {
+		RoundId         *big.Int
+		Answer          *big.Int
+		StartedAt       *big.Int
+		UpdatedAt       *big.Int
+		AnsweredInRound *big.Int
+	}
+
+	err = parsedPriceFeedABI.UnpackIntoInterface(&roundData, "latestRoundData", priceResult.Data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unpack latestRoundData: %w", err)
+	}
+
+	// answer is an int256; decode its word explicitly so a negative answer can
+	// never be read as a huge unsigned value
+	answer, err := decodeInt256(priceResult.Data, 1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode answer: %w", err)
+	}
+
+	// Get price decimals
+	priceDecimalsCallData, err := parsedPriceFeedABI.Pack("decimals")
+	if err != nil {
+		return nil, fmt.Errorf("failed to pack decimals call: %w", err)
+	}
+
+	priceDecimalsReq := &evm.CallContractRequest{
+		Call: &evm.CallMsg{
+			To:   priceFeedAddr.Bytes(),
+			Data: priceDecimalsCallData,
+		},
+	}
+
+	priceDecimalsResult, err := evmClient.CallContract(runtime, priceDecimalsReq).Await()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get price decimals: %w", err)
+	}
+
+	var priceDecimals uint8
+	err = parsedPriceFeedABI.UnpackIntoInterface(&priceDecimals, "decimals", priceDecimalsResult.Data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unpack price decimals: %w", err)
+	}
+	if err := fixedpoint.CheckDecimals(priceDecimals); err != nil {
+		return nil, fmt.Errorf("price feed %s: %w", priceFeedAddr.Hex(), err)
+	}
+
+	return &PriceData{
+		Answer:    answer,
+		Decimals:  priceDecimals,
+		UpdatedAt: time.Unix(roundData.UpdatedAt.Int64(), 0),
+	}, nil
+}
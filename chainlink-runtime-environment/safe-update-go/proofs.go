@@ -0,0 +1,282 @@
+//go:build wasip1
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+
+	"safe-update-go/ownerclient"
+)
+
+// AccountingProofsConfig represents the epochs ledger entries are committed in
+type AccountingProofsConfig struct {
+	EpochSeconds    uint64 `json:"epochSeconds"`
+	RetentionEpochs uint64 `json:"retentionEpochs"`
+}
+
+// LedgerEntryView represents a ledger entry as exposed to subaccount owners
+type LedgerEntryView = ownerclient.LedgerEntry
+
+// AccountingProof represents the inclusion proof of a ledger entry in its
+// subaccount's tree, and of that tree's root in the anchored epoch tree
+type AccountingProof struct {
+	SubAccount string          `json:"subAccount"`
+	Epoch      uint64          `json:"epoch"`
+	Root       string          `json:"root"`
+	Leaf       string          `json:"leaf"`
+	Proof      []string        `json:"proof"`
+	EpochRoot  string          `json:"epochRoot"`
+	EpochLeaf  string          `json:"epochLeaf"`
+	EpochProof []string        `json:"epochProof"`
+	Entry      LedgerEntryView `json:"entry"`
+}
+
+// accountingParams represents the parameters of the accounting admin methods
+type accountingParams struct {
+	SubAccount string `json:"subAccount"`
+	Epoch      uint64 `json:"epoch"`
+	TxHash     string `json:"txHash,omitempty"`
+}
+
+func init() {
+	RegisterAdminMethod("accountingRoot", adminAccountingRoot)
+	RegisterAdminMethod("accountingProof", adminAccountingProof)
+}
+
+// View returns the owner facing representation of a ledger entry
+func (e LedgerEntry) View() LedgerEntryView {
+	return LedgerEntryView{
+		TxHash:     e.TxHash,
+		SubAccount: e.SubAccount,
+		Protocol:   e.Protocol,
+		Verb:       string(e.Verb),
+		GrossUSD:   e.GrossUSD.String(),
+		NetUSD:     e.NetUSD.String(),
+		Timestamp:  e.At.Unix(),
+	}
+}
+
+// LedgerLeaf returns the Merkle leaf of a ledger entry:
+// keccak256(keccak256(abi.encode(subAccount, txHash, protocol, verb, grossUsd, netUsd, timestamp)))
+func LedgerLeaf(entry LedgerEntry) (common.Hash, error) {
+	addressType, _ := abi.NewType("address", "", nil)
+	bytes32Type, _ := abi.NewType("bytes32", "", nil)
+	stringType, _ := abi.NewType("string", "", nil)
+	int256Type, _ := abi.NewType("int256", "", nil)
+	uint64Type, _ := abi.NewType("uint64", "", nil)
+
+	encoded, err := abi.Arguments{
+		{Type: addressType}, {Type: bytes32Type}, {Type: stringType}, {Type: stringType},
+		{Type: int256Type}, {Type: int256Type}, {Type: uint64Type},
+	}.Pack(
+		common.HexToAddress(entry.SubAccount), common.HexToHash(entry.TxHash), entry.Protocol, string(entry.Verb),
+		entry.GrossUSD, entry.NetUSD, uint64(entry.At.Unix()),
+	)
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("failed to encode ledger entry: %w", err)
+	}
+	return crypto.Keccak256Hash(crypto.Keccak256(encoded)), nil
+}
+
+// SubaccountRootLeaf returns the leaf of a subaccount's root in its epoch tree:
+// keccak256(keccak256(abi.encode(subAccount, root)))
+func SubaccountRootLeaf(subAccount common.Address, root common.Hash) (common.Hash, error) {
+	addressType, _ := abi.NewType("address", "", nil)
+	bytes32Type, _ := abi.NewType("bytes32", "", nil)
+
+	encoded, err := abi.Arguments{{Type: addressType}, {Type: bytes32Type}}.Pack(subAccount, root)
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("failed to encode subaccount root: %w", err)
+	}
+	return crypto.Keccak256Hash(crypto.Keccak256(encoded)), nil
+}
+
+// epochOf returns the epoch index of a point in time
+func epochOf(proofs *AccountingProofsConfig, t time.Time) uint64 {
+	return uint64(t.Unix()) / proofs.EpochSeconds
+}
+
+// accountingRetention returns how long ledger entries must be kept for proofs
+func accountingRetention(proofs *AccountingProofsConfig) time.Duration {
+	if proofs == nil {
+		return 0
+	}
+	return seconds(proofs.EpochSeconds * (proofs.RetentionEpochs + 1))
+}
+
+// SubaccountEpochTree builds the Merkle tree over a subaccount's ledger entries of an epoch
+func SubaccountEpochTree(proofs *AccountingProofsConfig, s *WorkflowState, subAccount common.Address, epoch uint64) (*MerkleTree, map[common.Hash]LedgerEntry, error) {
+	entries := make(map[common.Hash]LedgerEntry)
+	var leaves []common.Hash
+	for _, entry := range s.Ledger {
+		if !strings.EqualFold(entry.SubAccount, subAccount.Hex()) || epochOf(proofs, entry.At) != epoch {
+			continue
+		}
+		leaf, err := LedgerLeaf(entry)
+		if err != nil {
+			return nil, nil, err
+		}
+		entries[leaf] = entry
+		leaves = append(leaves, leaf)
+	}
+	return NewMerkleTree(leaves), entries, nil
+}
+
+// AccountingEpochTree builds the Merkle tree over the roots of every
+// subaccount with ledger entries in an epoch. Its root is the one anchored.
+func AccountingEpochTree(proofs *AccountingProofsConfig, s *WorkflowState, epoch uint64) (*MerkleTree, error) {
+	seen := make(map[common.Address]bool)
+	var leaves []common.Hash
+	for _, entry := range s.Ledger {
+		subAccount := common.HexToAddress(entry.SubAccount)
+		if seen[subAccount] || epochOf(proofs, entry.At) != epoch {
+			continue
+		}
+		seen[subAccount] = true
+
+		tree, _, err := SubaccountEpochTree(proofs, s, subAccount, epoch)
+		if err != nil {
+			return nil, err
+		}
+		leaf, err := SubaccountRootLeaf(subAccount, tree.Root())
+		if err != nil {
+			return nil, err
+		}
+		leaves = append(leaves, leaf)
+	}
+	return NewMerkleTree(leaves), nil
+}
+
+// pendingAccountingRoots returns the first closed epoch not yet anchored and
+// the epoch roots from there to the last closed epoch. Epochs older than the
+// retained ledger are skipped.
+func pendingAccountingRoots(proofs *AccountingProofsConfig, s *WorkflowState, now time.Time) (uint64, []common.Hash, error) {
+	if proofs == nil || proofs.EpochSeconds == 0 {
+		return 0, nil, nil
+	}
+
+	current := epochOf(proofs, now)
+	from := s.AccountingAnchoredEpoch
+	if current > proofs.RetentionEpochs+1 && from < current-proofs.RetentionEpochs-1 {
+		from = current - proofs.RetentionEpochs - 1
+	}
+
+	var roots []common.Hash
+	for epoch := from; epoch < current; epoch++ {
+		tree, err := AccountingEpochTree(proofs, s, epoch)
+		if err != nil {
+			return 0, nil, err
+		}
+		roots = append(roots, tree.Root())
+	}
+	return from, roots, nil
+}
+
+// parseAccountingParams decodes and checks the parameters of the accounting methods
+func parseAccountingParams(config *Config, params json.RawMessage) (*accountingParams, error) {
+	if config.AccountingProofs == nil || config.AccountingProofs.EpochSeconds == 0 {
+		return nil, fmt.Errorf("accounting proofs not configured")
+	}
+	var p accountingParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, fmt.Errorf("invalid params: %w", err)
+	}
+	if !common.IsHexAddress(p.SubAccount) {
+		return nil, fmt.Errorf("invalid subAccount %q", p.SubAccount)
+	}
+	return &p, nil
+}
+
+// adminAccountingRoot returns the Merkle root of a subaccount's epoch
+func adminAccountingRoot(config *Config, runtime cre.Runtime, caller common.Address, params json.RawMessage) (interface{}, error) {
+	p, err := parseAccountingParams(config, params)
+	if err != nil {
+		return nil, err
+	}
+
+	tree, _, err := SubaccountEpochTree(config.AccountingProofs, state, common.HexToAddress(p.SubAccount), p.Epoch)
+	if err != nil {
+		return nil, err
+	}
+
+	epochTree, err := AccountingEpochTree(config.AccountingProofs, state, p.Epoch)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"subAccount": common.HexToAddress(p.SubAccount).Hex(),
+		"epoch":      p.Epoch,
+		"root":       tree.Root().Hex(),
+		"entries":    len(tree.Leaves),
+		"epochRoot":  epochTree.Root().Hex(),
+	}, nil
+}
+
+// adminAccountingProof returns the inclusion proof of one transaction's ledger entry
+func adminAccountingProof(config *Config, runtime cre.Runtime, caller common.Address, params json.RawMessage) (interface{}, error) {
+	p, err := parseAccountingParams(config, params)
+	if err != nil {
+		return nil, err
+	}
+
+	subAccount := common.HexToAddress(p.SubAccount)
+	tree, entries, err := SubaccountEpochTree(config.AccountingProofs, state, subAccount, p.Epoch)
+	if err != nil {
+		return nil, err
+	}
+
+	for leaf, entry := range entries {
+		if !strings.EqualFold(entry.TxHash, p.TxHash) {
+			continue
+		}
+		proof, err := tree.Proof(leaf)
+		if err != nil {
+			return nil, err
+		}
+
+		epochTree, err := AccountingEpochTree(config.AccountingProofs, state, p.Epoch)
+		if err != nil {
+			return nil, err
+		}
+		epochLeaf, err := SubaccountRootLeaf(subAccount, tree.Root())
+		if err != nil {
+			return nil, err
+		}
+		epochProof, err := epochTree.Proof(epochLeaf)
+		if err != nil {
+			return nil, err
+		}
+
+		return AccountingProof{
+			SubAccount: subAccount.Hex(),
+			Epoch:      p.Epoch,
+			Root:       tree.Root().Hex(),
+			Leaf:       leaf.Hex(),
+			Proof:      hexHashes(proof),
+			EpochRoot:  epochTree.Root().Hex(),
+			EpochLeaf:  epochLeaf.Hex(),
+			EpochProof: hexHashes(epochProof),
+			Entry:      entry.View(),
+		}, nil
+	}
+
+	return nil, fmt.Errorf("no ledger entry for %s in epoch %d", p.TxHash, p.Epoch)
+}
+
+// hexHashes returns the hex representation of hashes
+func hexHashes(hashes []common.Hash) []string {
+	hexed := make([]string, len(hashes))
+	for i, hash := range hashes {
+		hexed[i] = hash.Hex()
+	}
+	return hexed
+}
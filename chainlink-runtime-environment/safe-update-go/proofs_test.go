@@ -0,0 +1,135 @@
+//go:build wasip1
+
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestMerkleProof(t *testing.T) {
+	for _, n := range []int{1, 2, 3, 4, 7} {
+		t.Run(fmt.Sprintf("%d leaves", n), func(t *testing.T) {
+			leaves := make([]common.Hash, n)
+			for i := range leaves {
+				leaves[i] = common.BigToHash(big.NewInt(int64(i + 1)))
+			}
+			tree := NewMerkleTree(leaves)
+
+			for _, leaf := range leaves {
+				proof, err := tree.Proof(leaf)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !VerifyMerkleProof(tree.Root(), leaf, proof) {
+					t.Errorf("proof of %s does not verify", leaf.Hex())
+				}
+				if VerifyMerkleProof(tree.Root(), common.BigToHash(big.NewInt(99)), proof) {
+					t.Errorf("proof of %s verifies another leaf", leaf.Hex())
+				}
+			}
+
+			if _, err := tree.Proof(common.BigToHash(big.NewInt(99))); err == nil {
+				t.Error("proved a leaf not in the tree")
+			}
+		})
+	}
+}
+
+func TestAccountingEpochProof(t *testing.T) {
+	proofs := &AccountingProofsConfig{EpochSeconds: 86400, RetentionEpochs: 2}
+	alice := common.HexToAddress("0x00000000000000000000000000000000000000a1")
+	bob := common.HexToAddress("0x00000000000000000000000000000000000000b0")
+	epochStart := time.Unix(20000*86400, 0)
+
+	s := NewWorkflowState()
+	for i, subAccount := range []common.Address{alice, bob, alice, alice} {
+		s.RecordLedgerEntry(LedgerEntry{
+			TxHash:     common.BigToHash(big.NewInt(int64(i + 1))).Hex(),
+			SubAccount: subAccount.Hex(),
+			Protocol:   "aave",
+			Verb:       VerbWithdraw,
+			GrossUSD:   big.NewInt(int64(1000 * (i + 1))),
+			NetUSD:     big.NewInt(int64(1000 * (i + 1))),
+			At:         epochStart.Add(time.Duration(i) * time.Hour),
+		})
+	}
+
+	epochTree, err := AccountingEpochTree(proofs, s, 20000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(epochTree.Leaves) != 2 {
+		t.Fatalf("epoch tree has %d leaves, want one per subaccount", len(epochTree.Leaves))
+	}
+
+	tree, entries, err := SubaccountEpochTree(proofs, s, alice, 20000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("alice has %d entries, want 3", len(entries))
+	}
+	for leaf := range entries {
+		proof, err := tree.Proof(leaf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !VerifyMerkleProof(tree.Root(), leaf, proof) {
+			t.Errorf("entry proof of %s does not verify", leaf.Hex())
+		}
+	}
+
+	epochLeaf, err := SubaccountRootLeaf(alice, tree.Root())
+	if err != nil {
+		t.Fatal(err)
+	}
+	epochProof, err := epochTree.Proof(epochLeaf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !VerifyMerkleProof(epochTree.Root(), epochLeaf, epochProof) {
+		t.Error("subaccount root does not verify against the epoch root")
+	}
+
+	// A tampered entry changes the subaccount root, which the epoch root rejects
+	s.Ledger[0].NetUSD = big.NewInt(1)
+	tampered, _, err := SubaccountEpochTree(proofs, s, alice, 20000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tamperedLeaf, err := SubaccountRootLeaf(alice, tampered.Root())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if VerifyMerkleProof(epochTree.Root(), tamperedLeaf, epochProof) {
+		t.Error("tampered ledger verifies against the epoch root")
+	}
+}
+
+func TestPendingAccountingRoots(t *testing.T) {
+	proofs := &AccountingProofsConfig{EpochSeconds: 86400, RetentionEpochs: 2}
+	now := time.Unix(20010*86400+3600, 0)
+
+	s := NewWorkflowState()
+	from, roots, err := pendingAccountingRoots(proofs, s, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if from != 20007 || len(roots) != 3 {
+		t.Fatalf("first anchor from epoch %d with %d roots, want the 3 retained epochs from 20007", from, len(roots))
+	}
+
+	s.AccountingAnchoredEpoch = 20010
+	if _, roots, _ := pendingAccountingRoots(proofs, s, now); len(roots) != 0 {
+		t.Errorf("%d roots pending after anchoring the closed epochs", len(roots))
+	}
+
+	if _, roots, _ := pendingAccountingRoots(nil, s, now); roots != nil {
+		t.Error("roots pending without accounting proofs")
+	}
+}
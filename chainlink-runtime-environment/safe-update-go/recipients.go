@@ -0,0 +1,84 @@
+//go:build wasip1
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/blockchain/evm"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+)
+
+// validateRecipients checks the recipient restriction of the policy
+func validateRecipients(policy *PolicyConfig) error {
+	if len(policy.AllowedRecipients) > 0 && !policy.RestrictRecipients {
+		return fmt.Errorf("allowedRecipients requires restrictRecipients")
+	}
+	for i, recipient := range policy.AllowedRecipients {
+		if !recipient.IsSet() {
+			return fmt.Errorf("allowed recipient %d: address is required", i)
+		}
+	}
+	for i, recipient := range policy.AllowedBridgeRecipients {
+		if !recipient.IsSet() {
+			return fmt.Errorf("allowed bridge recipient %d: address is required", i)
+		}
+	}
+	return nil
+}
+
+// CheckRecipient returns ErrPolicyViolation when recipients are restricted and
+// an action pays out to an address other than the module's Safe or an allowed
+// recipient. Actions without an explicit recipient pay the caller, which is
+// the Safe.
+func CheckRecipient(config *Config, runtime cre.Runtime, evmClient *evm.Client, action *Action) error {
+	policy := config.Policy
+	if policy == nil || !policy.RestrictRecipients || action.Recipient == (common.Address{}) {
+		return nil
+	}
+	for _, allowed := range policy.AllowedRecipients {
+		if allowed.Address == action.Recipient {
+			return nil
+		}
+	}
+
+	avatar, err := GetAvatar(runtime, evmClient, ActiveTarget(config).ModuleAddress.Address)
+	if err != nil {
+		return err
+	}
+	if action.Recipient == avatar {
+		return nil
+	}
+	return fmt.Errorf("%w: %s %s pays out to %s, which is neither the Safe nor an allowed recipient",
+		ErrPolicyViolation, action.Protocol, action.Verb, action.Recipient.Hex())
+}
+
+// BridgeRecipientReview holds for review a bridge transfer paying anyone but
+// the module's Safe or an allowed bridge recipient on the destination chain.
+// The Safe is expected at the same address there, as Safes deployed with the
+// same factory and setup are.
+func BridgeRecipientReview(config *Config, runtime cre.Runtime, evmClient *evm.Client, action *Action) error {
+	if action.Verb != VerbBridge || action.NeedsReview {
+		return nil
+	}
+	recipient := action.DestinationRecipient
+	if config.Policy != nil {
+		for _, allowed := range config.Policy.AllowedBridgeRecipients {
+			if allowed.Address == recipient {
+				return nil
+			}
+		}
+	}
+
+	avatar, err := GetAvatar(runtime, evmClient, ActiveTarget(config).ModuleAddress.Address)
+	if err != nil {
+		return err
+	}
+	if recipient == avatar {
+		return nil
+	}
+	action.NeedsReview = true
+	action.ReviewReason = fmt.Sprintf("%s bridges to %s, which is neither the Safe nor an allowed bridge recipient", action.Protocol, recipient.Hex())
+	return nil
+}
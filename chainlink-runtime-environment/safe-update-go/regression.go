@@ -0,0 +1,362 @@
+//go:build wasip1
+
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/smartcontractkit/chainlink-protos/cre/go/values/pb"
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/blockchain/evm"
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/scheduler/cron"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+)
+
+// Sampling defaults: about a day of mainnet blocks, 50 transactions, and a
+// drop of 5 percentage points before alerting
+const (
+	defaultRegressionLookbackBlocks = 7200
+	defaultRegressionSampleSize     = 50
+	defaultRegressionMaxDropPercent = 5
+)
+
+// maxRegressionRuns is the number of sampling runs kept in the state store
+const maxRegressionRuns = 30
+
+// maxRegressionExamples is the number of failed samples kept per run for triage
+const maxRegressionExamples = 10
+
+// RegressionConfig represents the scheduled dry-run of the decoders over
+// recent executeOnProtocol transactions
+type RegressionConfig struct {
+	Schedule       string `json:"schedule"`
+	LookbackBlocks uint64 `json:"lookbackBlocks,omitempty"`
+	SampleSize     int    `json:"sampleSize,omitempty"`
+	MaxDropPercent uint64 `json:"maxDropPercent,omitempty"`
+}
+
+// RegressionRun represents the outcome of one sampling run. Recognized
+// transactions were decoded, valued ones were also priced in USD, and held
+// ones would have been routed to review.
+type RegressionRun struct {
+	At         time.Time
+	FromBlock  uint64
+	ToBlock    uint64
+	Sampled    int
+	Recognized int
+	Valued     int
+	Held       int
+	Failures   []string
+}
+
+func init() {
+	RegisterAdminMethod("regressionRuns", adminRegressionRuns)
+}
+
+// ValidateRegression checks the regression sampling configuration
+func ValidateRegression(regression *RegressionConfig) error {
+	if regression == nil {
+		return nil
+	}
+	if regression.Schedule == "" {
+		return fmt.Errorf("schedule is required")
+	}
+	if regression.SampleSize < 0 {
+		return fmt.Errorf("sampleSize must not be negative")
+	}
+	if regression.MaxDropPercent > 100 {
+		return fmt.Errorf("maxDropPercent must be at most 100")
+	}
+	return nil
+}
+
+// rate returns a count as basis points of the sampled transactions
+func (r RegressionRun) rate(count int) int {
+	if r.Sampled == 0 {
+		return 0
+	}
+	return count * 10000 / r.Sampled
+}
+
+// RecognitionBps returns the share of sampled transactions that were decoded
+func (r RegressionRun) RecognitionBps() int {
+	return r.rate(r.Recognized)
+}
+
+// ValuationBps returns the share of sampled transactions that were valued
+func (r RegressionRun) ValuationBps() int {
+	return r.rate(r.Valued)
+}
+
+// HeldBps returns the share of sampled transactions that were held for review
+func (r RegressionRun) HeldBps() int {
+	return r.rate(r.Held)
+}
+
+// RecordRegressionRun appends a sampling run, keeping the most recent ones
+func (s *WorkflowState) RecordRegressionRun(run RegressionRun) {
+	s.RegressionRuns = append(s.RegressionRuns, run)
+	if len(s.RegressionRuns) > maxRegressionRuns {
+		s.RegressionRuns = s.RegressionRuns[len(s.RegressionRuns)-maxRegressionRuns:]
+	}
+}
+
+// sampledEvent represents a ProtocolExecuted log and the module that emitted it
+type sampledEvent struct {
+	Log    *evm.Log
+	Target *Config
+}
+
+// sampleProtocolEvents returns the most recent ProtocolExecuted logs of every
+// configured module within the block range, one per transaction
+func sampleProtocolEvents(config *Config, runtime cre.Runtime, evmClient *evm.Client, fromBlock, toBlock uint64, size int) ([]sampledEvent, error) {
+	modules := []string{config.ModuleAddress.Hex()}
+	if config.Migration != nil {
+		modules = append(modules, config.Migration.NewModule.ModuleAddress.Hex())
+	}
+	for _, mirror := range config.Mirrors {
+		modules = append(modules, mirror.ModuleAddress.Hex())
+	}
+
+	seen := make(map[string]bool)
+	var events []sampledEvent
+	for _, module := range modules {
+		target, err := config.TargetForModule(module)
+		if err != nil {
+			return nil, err
+		}
+
+		// Named, so a run resumes after the blocks the previous one read
+		scan := LogScan{
+			Name:      "regression:" + module,
+			Addresses: [][]byte{common.HexToAddress(module).Bytes()},
+			Topics:    []*evm.Topics{{Topic: [][]byte{protocolExecutedSignature.Bytes()}}},
+			FromBlock: fromBlock,
+			ToBlock:   toBlock,
+		}
+		cursor, err := ScanLogs(config, runtime, evmClient, runtime.Logger(), scan, func(logs []*evm.Log) error {
+			for _, log := range logs {
+				key := hex.EncodeToString(log.TxHash)
+				if log.Removed || len(log.Topics) < 3 || seen[key] {
+					continue
+				}
+				seen[key] = true
+				events = append(events, sampledEvent{Log: log, Target: target})
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ProtocolExecuted logs of %s: %w", module, err)
+		}
+		if !cursor.Done() {
+			runtime.Logger().Warn("Regression sample cut short by the scan rate limit", "module", module, "nextBlock", cursor.NextBlock)
+		}
+	}
+
+	// Most recent first, so the sample reflects current usage
+	sort.Slice(events, func(i, j int) bool {
+		bi, bj := pb.NewIntFromBigInt(events[i].Log.BlockNumber), pb.NewIntFromBigInt(events[j].Log.BlockNumber)
+		if c := bi.Cmp(bj); c != 0 {
+			return c > 0
+		}
+		return events[i].Log.Index > events[j].Log.Index
+	})
+	if len(events) > size {
+		events = events[:size]
+	}
+	return events, nil
+}
+
+// sampleOutcome represents what the dry run of a sampled transaction did
+type sampleOutcome struct {
+	Recognized bool
+	Valued     bool
+	Held       bool
+}
+
+// dryRunEvent replays a sampled transaction through the same decoding,
+// review holds and valuation as the executed one, without recording or
+// submitting anything. Approvals and no-ops are recognized and need no
+// valuation. The error tells why the transaction was not recognized, valued
+// or was held.
+func dryRunEvent(runtime cre.Runtime, evmClient *evm.Client, logger *slog.Logger, event sampledEvent) (sampleOutcome, error) {
+	config := event.Target
+	target := common.BytesToAddress(event.Log.Topics[2])
+
+	tx, err := evmClient.GetTransactionByHash(runtime, &evm.GetTransactionByHashRequest{Hash: event.Log.TxHash}).Await()
+	if err != nil {
+		return sampleOutcome{}, fmt.Errorf("failed to get transaction: %w", err)
+	}
+	if tx.Transaction == nil {
+		return sampleOutcome{}, fmt.Errorf("transaction not found")
+	}
+
+	call, err := ExtractProtocolCalldata(logger, tx.Transaction.Data)
+	if err != nil {
+		return sampleOutcome{}, fmt.Errorf("failed to extract protocol calldata: %w", err)
+	}
+	if _, ok := ClassifyApproval(call); ok {
+		return sampleOutcome{Recognized: true, Valued: true}, nil
+	}
+
+	action, err := DecodeExecution(config, runtime, evmClient, logger, target, call, event.Log.TxHash)
+	if err != nil {
+		return sampleOutcome{}, fmt.Errorf("undecodable call to %s: %w", target.Hex(), err)
+	}
+	if _, ok := ClassifyNoOp(action); ok {
+		return sampleOutcome{Recognized: true, Valued: true}, nil
+	}
+
+	outcome := sampleOutcome{Recognized: true}
+	HoldForReview(config, runtime, action)
+	accounting, err := AccountAction(config, runtime, evmClient, logger, action)
+	if err != nil {
+		return outcome, fmt.Errorf("%s %s not valued: %w", action.Protocol, action.Verb, err)
+	}
+	outcome.Valued = true
+	if !action.NeedsReview {
+		action.NeedsReview, action.ReviewReason = accounting.UnpricedReview()
+	}
+	if action.NeedsReview {
+		outcome.Held = true
+		return outcome, fmt.Errorf("%s %s held: %s", action.Protocol, action.Verb, action.ReviewReason)
+	}
+	return outcome, nil
+}
+
+// OnRegressionSample is the handler for the regression sampling cron trigger.
+// It dry-runs the current decoders over recent executeOnProtocol transactions
+// and alerts when the recognition or valuation rate dropped since the last run.
+func OnRegressionSample(config *Config, runtime cre.Runtime, payload *cron.Payload) (*ExecutionResult, error) {
+	logger := runtime.Logger()
+	regression := config.Regression
+
+	if !IsLeader(config, runtime, logger) {
+		return &ExecutionResult{Message: "Standby: regression sampling left to the leader", Success: true}, nil
+	}
+
+	evmClient := newEVMClient(config)
+
+	// A nil block number reads the latest header
+	header, err := evmClient.HeaderByNumber(runtime, &evm.HeaderByNumberRequest{}).Await()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest block header: %w", err)
+	}
+	if header.Header == nil {
+		return nil, fmt.Errorf("latest block header not found")
+	}
+
+	lookback := regression.LookbackBlocks
+	if lookback == 0 {
+		lookback = defaultRegressionLookbackBlocks
+	}
+	size := regression.SampleSize
+	if size == 0 {
+		size = defaultRegressionSampleSize
+	}
+
+	toBlock := pb.NewIntFromBigInt(header.Header.BlockNumber).Uint64()
+	fromBlock := uint64(0)
+	if toBlock > lookback {
+		fromBlock = toBlock - lookback
+	}
+
+	events, err := sampleProtocolEvents(config, runtime, evmClient, fromBlock, toBlock, size)
+	if err != nil {
+		return nil, err
+	}
+
+	run := RegressionRun{At: runtime.Now(), FromBlock: fromBlock, ToBlock: toBlock, Sampled: len(events)}
+	for _, event := range events {
+		outcome, err := dryRunEvent(runtime, evmClient, logger, event)
+		if outcome.Recognized {
+			run.Recognized++
+		}
+		if outcome.Valued {
+			run.Valued++
+		}
+		if outcome.Held {
+			run.Held++
+		}
+		if err != nil && len(run.Failures) < maxRegressionExamples {
+			run.Failures = append(run.Failures, "0x"+hex.EncodeToString(event.Log.TxHash)+": "+err.Error())
+		}
+	}
+
+	logger.Info("Regression sample done", "sampled", run.Sampled, "recognized", run.Recognized, "valued", run.Valued, "held", run.Held,
+		"fromBlock", fromBlock, "toBlock", toBlock)
+
+	var previous *RegressionRun
+	if n := len(state.RegressionRuns); n > 0 {
+		previous = &state.RegressionRuns[n-1]
+	}
+	state.RecordRegressionRun(run)
+
+	if previous == nil || previous.Sampled == 0 || run.Sampled == 0 {
+		return &ExecutionResult{Message: fmt.Sprintf("Sampled %d transactions", run.Sampled), Success: true}, nil
+	}
+
+	maxDrop := regression.MaxDropPercent
+	if maxDrop == 0 {
+		maxDrop = defaultRegressionMaxDropPercent
+	}
+	regressions := checkRegression(*previous, run, int(maxDrop)*100)
+	if len(regressions) > 0 {
+		RaiseAlert(config, runtime, slog.LevelError, "ALERT: decoder regression", "", "regressions", regressions,
+			"sampled", run.Sampled, "failures", run.Failures)
+		return &ExecutionResult{Message: fmt.Sprintf("%d regressions detected", len(regressions)), Success: true}, nil
+	}
+
+	return &ExecutionResult{Message: fmt.Sprintf("Sampled %d transactions, no regression", run.Sampled), Success: true}, nil
+}
+
+// checkRegression compares the rates of two runs and describes the
+// recognition and valuation drops, and the review hold rises, larger than
+// maxDropBps
+func checkRegression(previous, current RegressionRun, maxDropBps int) []string {
+	var regressions []string
+	compare := func(name string, before, after, drop int) {
+		if drop > maxDropBps {
+			regressions = append(regressions, fmt.Sprintf("%s rate %d.%02d%% -> %d.%02d%%", name,
+				before/100, before%100, after/100, after%100))
+		}
+	}
+	compare("recognition", previous.RecognitionBps(), current.RecognitionBps(), previous.RecognitionBps()-current.RecognitionBps())
+	compare("valuation", previous.ValuationBps(), current.ValuationBps(), previous.ValuationBps()-current.ValuationBps())
+	compare("review hold", previous.HeldBps(), current.HeldBps(), current.HeldBps()-previous.HeldBps())
+	return regressions
+}
+
+// adminRegressionRuns lists the recent sampling runs
+func adminRegressionRuns(config *Config, runtime cre.Runtime, caller common.Address, params json.RawMessage) (interface{}, error) {
+	type regressionRun struct {
+		At             int64    `json:"at"`
+		FromBlock      uint64   `json:"fromBlock"`
+		ToBlock        uint64   `json:"toBlock"`
+		Sampled        int      `json:"sampled"`
+		RecognitionBps int      `json:"recognitionBps"`
+		ValuationBps   int      `json:"valuationBps"`
+		HeldBps        int      `json:"heldBps"`
+		Failures       []string `json:"failures,omitempty"`
+	}
+
+	runs := make([]regressionRun, len(state.RegressionRuns))
+	for i, run := range state.RegressionRuns {
+		runs[i] = regressionRun{
+			At:             run.At.Unix(),
+			FromBlock:      run.FromBlock,
+			ToBlock:        run.ToBlock,
+			Sampled:        run.Sampled,
+			RecognitionBps: run.RecognitionBps(),
+			ValuationBps:   run.ValuationBps(),
+			HeldBps:        run.HeldBps(),
+			Failures:       run.Failures,
+		}
+	}
+	return runs, nil
+}
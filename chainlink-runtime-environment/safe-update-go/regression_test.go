@@ -0,0 +1,32 @@
+//go:build wasip1
+
+package main
+
+import "testing"
+
+// TestCheckRegression expects recognition and valuation drops, and review
+// hold rises, beyond the threshold to be reported
+func TestCheckRegression(t *testing.T) {
+	previous := RegressionRun{Sampled: 100, Recognized: 90, Valued: 80, Held: 10}
+
+	tests := []struct {
+		name    string
+		current RegressionRun
+		want    int
+	}{
+		{"unchanged", RegressionRun{Sampled: 100, Recognized: 90, Valued: 80, Held: 10}, 0},
+		{"within threshold", RegressionRun{Sampled: 100, Recognized: 86, Valued: 76, Held: 14}, 0},
+		{"recognition drop", RegressionRun{Sampled: 100, Recognized: 80, Valued: 80, Held: 10}, 1},
+		{"valuation drop", RegressionRun{Sampled: 100, Recognized: 90, Valued: 70, Held: 10}, 1},
+		{"hold rise", RegressionRun{Sampled: 100, Recognized: 90, Valued: 80, Held: 20}, 1},
+		{"hold drop", RegressionRun{Sampled: 100, Recognized: 90, Valued: 80, Held: 0}, 0},
+		{"all", RegressionRun{Sampled: 100, Recognized: 50, Valued: 40, Held: 40}, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := checkRegression(previous, tt.current, 500); len(got) != tt.want {
+				t.Errorf("regressions %v, want %d", got, tt.want)
+			}
+		})
+	}
+}
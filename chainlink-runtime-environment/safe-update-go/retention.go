@@ -0,0 +1,128 @@
+//go:build wasip1
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/scheduler/cron"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+)
+
+// defaultDetailDays is how long full audit records and raw ledger entries are kept
+const defaultDetailDays = 90
+
+// auditSummaryFields are the audit fields kept once a record is compacted
+var auditSummaryFields = []string{
+	"txHash", "subAccount", "module", "protocol", "verb", "confidence", "balanceChange", "outcome", "timestamp", "configHash", "fixedPrices", "cachedPrices", "operator",
+}
+
+// RetentionConfig represents how long audit and ledger data is kept in
+// detail before scheduled compaction. Compacted audit records keep their
+// summary fields; compacted ledger entries are rolled into daily aggregates.
+type RetentionConfig struct {
+	Schedule         string `json:"schedule"`
+	AuditDetailDays  uint64 `json:"auditDetailDays,omitempty"`
+	AuditDays        uint64 `json:"auditDays,omitempty"`
+	LedgerDetailDays uint64 `json:"ledgerDetailDays,omitempty"`
+}
+
+// ValidateRetention checks the retention configuration
+func ValidateRetention(retention *RetentionConfig) error {
+	if retention == nil {
+		return nil
+	}
+	if retention.Schedule == "" {
+		return fmt.Errorf("schedule is required")
+	}
+	if retention.AuditDays != 0 && retention.AuditDays < auditDetailDays(retention) {
+		return fmt.Errorf("auditDays must not be shorter than auditDetailDays")
+	}
+	return nil
+}
+
+// days converts a number of days to a duration
+func days(n uint64) time.Duration {
+	return time.Duration(n) * 24 * time.Hour
+}
+
+// auditDetailDays returns how many days audit records are kept in full
+func auditDetailDays(retention *RetentionConfig) uint64 {
+	if retention == nil || retention.AuditDetailDays == 0 {
+		return defaultDetailDays
+	}
+	return retention.AuditDetailDays
+}
+
+// ledgerDetailRetention returns how long raw ledger entries are kept when
+// compaction is configured
+func ledgerDetailRetention(retention *RetentionConfig) time.Duration {
+	if retention == nil {
+		return 0
+	}
+	if retention.LedgerDetailDays == 0 {
+		return days(defaultDetailDays)
+	}
+	return days(retention.LedgerDetailDays)
+}
+
+// CompactAuditLog strips records older than detailBefore down to their summary
+// fields and drops those older than dropBefore, unless it is zero. It returns
+// the number of compacted and dropped records.
+func (s *WorkflowState) CompactAuditLog(detailBefore, dropBefore time.Time) (int, int) {
+	compacted, dropped := 0, 0
+	kept := s.AuditLog[:0]
+	for _, fields := range s.AuditLog {
+		seconds, err := strconv.ParseInt(fields["timestamp"], 10, 64)
+		if err != nil {
+			kept = append(kept, fields)
+			continue
+		}
+		at := time.Unix(seconds, 0)
+
+		if !dropBefore.IsZero() && at.Before(dropBefore) {
+			dropped++
+			continue
+		}
+		if at.Before(detailBefore) && fields["compacted"] == "" {
+			summary := map[string]string{"compacted": "true"}
+			for _, name := range auditSummaryFields {
+				if value, ok := fields[name]; ok {
+					summary[name] = value
+				}
+			}
+			fields = summary
+			compacted++
+		}
+		kept = append(kept, fields)
+	}
+	s.AuditLog = kept
+	return compacted, dropped
+}
+
+// OnCompaction is the handler for the retention cron trigger. It compacts the
+// audit log and rolls old ledger entries into daily aggregates.
+func OnCompaction(config *Config, runtime cre.Runtime, payload *cron.Payload) (*ExecutionResult, error) {
+	logger := runtime.Logger()
+	retention := config.Retention
+	now := runtime.Now()
+
+	var dropBefore time.Time
+	if retention.AuditDays > 0 {
+		dropBefore = now.Add(-days(retention.AuditDays))
+	}
+	compactedAudit, droppedAudit := state.CompactAuditLog(now.Add(-days(auditDetailDays(retention))), dropBefore)
+	compactedLedger := state.CompactLedger(now.Add(-ledgerRetention(config)))
+
+	logger.Info("Compaction done", "auditCompacted", compactedAudit, "auditDropped", droppedAudit,
+		"auditRecords", len(state.AuditLog), "ledgerCompacted", compactedLedger, "ledgerEntries", len(state.Ledger),
+		"ledgerAggregates", len(state.LedgerAggregates))
+
+	return &ExecutionResult{
+		Message: fmt.Sprintf("Compacted %d audit records, dropped %d, rolled up %d ledger entries",
+			compactedAudit, droppedAudit, compactedLedger),
+		Success: true,
+	}, nil
+}
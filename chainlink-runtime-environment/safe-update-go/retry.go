@@ -0,0 +1,192 @@
+//go:build wasip1
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/blockchain/evm"
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/scheduler/cron"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+
+	"safe-update-go/fixedpoint"
+)
+
+// RetryConfig represents the configuration of the dead letter retry handler
+type RetryConfig struct {
+	Schedule         string `json:"schedule"`
+	MaxAttempts      int    `json:"maxAttempts"`
+	GasBufferPercent uint64 `json:"gasBufferPercent"`
+}
+
+// RetryOutcome represents what happened to a dead letter during a retry run
+type RetryOutcome string
+
+const (
+	RetrySubmitted RetryOutcome = "submitted"
+	RetryDropped   RetryOutcome = "dropped"
+	RetryDeferred  RetryOutcome = "deferred"
+	RetryFailed    RetryOutcome = "failed"
+	RetryExhausted RetryOutcome = "exhausted"
+)
+
+// OnRetryDeadLetters is the handler for the retry cron trigger. It re-validates
+// queued dead letters against the module and resubmits them with fresh gas,
+// unless the gas schedule holds them for a lower base fee.
+func OnRetryDeadLetters(config *Config, runtime cre.Runtime, payload *cron.Payload) (*ExecutionResult, error) {
+	logger := runtime.Logger()
+	logger.Info("Dead letter retry triggered", "queued", len(state.DeadLetters))
+
+	if state.Paused {
+		return &ExecutionResult{Message: "Allowance updates paused: " + state.PausedReason, Success: true}, nil
+	}
+
+	if len(state.DeadLetters) == 0 {
+		return &ExecutionResult{Message: "No dead letters", Success: true}, nil
+	}
+
+	if !IsLeader(config, runtime, logger) {
+		return &ExecutionResult{Message: "Standby: retries left to the leader", Success: true}, nil
+	}
+
+	evmClient := newEVMClient(config)
+	counts := make(map[RetryOutcome]int)
+
+	// Retries are only held for gas when the schedule covers them
+	var gas *GasWindow
+	if config.GasSchedule != nil && config.GasSchedule.Retries {
+		gas = ReadGasWindow(config, runtime, evmClient)
+	}
+
+	// Iterate over a copy since handled letters are removed from the queue
+	letters := append([]DeadLetter(nil), state.DeadLetters...)
+	for _, letter := range letters {
+		var outcome RetryOutcome
+		var err error
+		if gas.Defers(config.GasSchedule, letter.QueuedAt, runtime.Now()) {
+			outcome, err = RetryDeferred, fmt.Errorf("base fee %s gwei above %d gwei", gas.Gwei(), config.GasSchedule.MaxBaseFeeGwei)
+		} else {
+			outcome, err = retryDeadLetter(config, runtime, evmClient, letter)
+		}
+		counts[outcome]++
+
+		switch outcome {
+		case RetrySubmitted, RetryDropped:
+			state.RemoveDeadLetter(letter.TxHash, letter.Module, letter.Token)
+		case RetryFailed:
+			letter.Reason = err.Error()
+			state.AddDeadLetter(letter)
+		case RetryExhausted:
+			if state.MarkDeadLetterExhausted(letter.TxHash, letter.Module, letter.Token) {
+				RaiseAlert(config, runtime, slog.LevelError, "PAGE: dead letter exhausted retries", letter.Module, "txHash", letter.TxHash, "attempts", letter.Attempts, "reason", letter.Reason,
+					"annotations", annotationNotes(state.DeadLetterAnnotations(letter)))
+			}
+		}
+
+		if err != nil {
+			logger.Warn("Dead letter retry", "txHash", letter.TxHash, "module", letter.Module, "outcome", string(outcome), "error", err.Error())
+		} else {
+			logger.Info("Dead letter retry", "txHash", letter.TxHash, "module", letter.Module, "outcome", string(outcome))
+		}
+	}
+
+	return &ExecutionResult{
+		Message: fmt.Sprintf("Retried %d dead letters: %d submitted, %d dropped, %d deferred, %d failed, %d exhausted",
+			len(letters), counts[RetrySubmitted], counts[RetryDropped], counts[RetryDeferred], counts[RetryFailed], counts[RetryExhausted]),
+		Success: true,
+	}, nil
+}
+
+// retryDeadLetter re-validates a single dead letter and resubmits it
+func retryDeadLetter(config *Config, runtime cre.Runtime, evmClient *evm.Client, letter DeadLetter) (RetryOutcome, error) {
+	if letter.BalanceChange == nil || letter.BalanceChange.Sign() == 0 {
+		return RetryDropped, fmt.Errorf("no balance change to submit")
+	}
+
+	if config.Retry.MaxAttempts > 0 && letter.Attempts >= config.Retry.MaxAttempts {
+		return RetryExhausted, nil
+	}
+
+	// Mirrored updates are retried against the module they failed on
+	target, err := config.TargetForModule(letter.Module)
+	if err != nil {
+		return RetryDropped, err
+	}
+
+	moduleAddr := target.ModuleAddress.Address
+	subAccount := common.HexToAddress(letter.SubAccount)
+
+	// A paused module is temporary: keep the letter queued until it resumes
+	paused, err := IsModulePaused(runtime, evmClient, moduleAddr)
+	if err != nil {
+		return RetryDeferred, err
+	}
+	if paused {
+		return RetryDeferred, fmt.Errorf("module %s paused", moduleAddr.Hex())
+	}
+
+	// The module ignores updates for subaccounts without an active window, and a
+	// window opened after the withdrawal already starts from a fresh allowance
+	windowStart, err := GetExecutionWindowStart(runtime, evmClient, moduleAddr, subAccount)
+	if err != nil {
+		return RetryDeferred, err
+	}
+	if windowStart.Sign() == 0 {
+		return RetryDropped, fmt.Errorf("subaccount has no active execution window")
+	}
+	if !letter.EventTime.IsZero() && windowStart.Int64() > letter.EventTime.Unix() {
+		return RetryDropped, fmt.Errorf("execution window reset after the withdrawal")
+	}
+
+	gasLimit, err := estimateRetryGas(target, runtime, evmClient, letter)
+	if err != nil {
+		return RetryFailed, err
+	}
+
+	// The letter leaves the queue before the write checkpoints the state, so
+	// a save failing after the write cannot submit it again. A failed write
+	// queues it back.
+	state.RemoveDeadLetter(letter.TxHash, letter.Module, letter.Token)
+	writeResult, err := SubmitLetter(target, runtime, evmClient, letter, gasLimit)
+	if err == nil {
+		err = CheckWriteResult(writeResult)
+	}
+	state.RecordModuleResult(target.ModuleAddress.Hex(), err, runtime.Now())
+	if err != nil {
+		return RetryFailed, err
+	}
+
+	return RetrySubmitted, nil
+}
+
+// estimateRetryGas estimates the gas of the module call and adds a buffer that
+// grows with every attempt, never going below the configured gas limit
+func estimateRetryGas(config *Config, runtime cre.Runtime, evmClient *evm.Client, letter DeadLetter) (uint64, error) {
+	callData, err := packLetter(config, letter)
+	if err != nil {
+		return 0, err
+	}
+
+	moduleAddr := config.ModuleAddress.Address
+	estimate, err := evmClient.EstimateGas(runtime, &evm.EstimateGasRequest{
+		Msg: &evm.CallMsg{
+			From: expectedUpdater(config).Bytes(),
+			To:   moduleAddr.Bytes(),
+			Data: callData,
+		},
+	}).Await()
+	if err != nil {
+		return 0, fmt.Errorf("failed to estimate gas: %w", err)
+	}
+
+	bufferPercent := config.Retry.GasBufferPercent * uint64(letter.Attempts+1)
+	gas := fixedpoint.Percent(new(big.Int).SetUint64(estimate.Gas), 100+bufferPercent, fixedpoint.RoundUp)
+
+	if !gas.IsUint64() || gas.Uint64() < config.GasLimit {
+		return config.GasLimit, nil
+	}
+	return gas.Uint64(), nil
+}
@@ -0,0 +1,129 @@
+//go:build wasip1
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+)
+
+// ReviewItem represents an allowance update held until an operator approves it
+type ReviewItem struct {
+	Letter   DeadLetter
+	Protocol string
+	Verb     Verb
+	Reason   string
+}
+
+// reviewParams represents the parameters of the resolveReview admin method
+type reviewParams struct {
+	TxHash  string `json:"txHash"`
+	Approve bool   `json:"approve"`
+	Note    string `json:"note,omitempty"`
+}
+
+func init() {
+	RegisterAdminMethod("reviews", adminReviews)
+	RegisterAdminMethod("resolveReview", adminResolveReview)
+}
+
+// QueueReview holds an allowance update for review
+func (s *WorkflowState) QueueReview(item ReviewItem) {
+	for _, queued := range s.Reviews {
+		if queued.Letter.TxHash == item.Letter.TxHash && queued.Letter.Token == item.Letter.Token {
+			return
+		}
+	}
+	s.Reviews = append(s.Reviews, item)
+}
+
+// TakeReviews removes and returns the reviews of a transaction, one per token
+// for token-native modules
+func (s *WorkflowState) TakeReviews(txHash string) []ReviewItem {
+	var taken, kept []ReviewItem
+	for _, item := range s.Reviews {
+		if strings.EqualFold(item.Letter.TxHash, txHash) {
+			taken = append(taken, item)
+		} else {
+			kept = append(kept, item)
+		}
+	}
+	s.Reviews = kept
+	return taken
+}
+
+// adminReviews lists the updates waiting for review
+func adminReviews(config *Config, runtime cre.Runtime, caller common.Address, params json.RawMessage) (interface{}, error) {
+	type review struct {
+		TxHash        string `json:"txHash"`
+		SubAccount    string `json:"subAccount"`
+		Module        string `json:"module"`
+		Token         string `json:"token,omitempty"`
+		Protocol      string `json:"protocol"`
+		Verb          string `json:"verb"`
+		BalanceChange string `json:"balanceChange"`
+		Reason        string `json:"reason"`
+		QueuedAt      int64  `json:"queuedAt"`
+	}
+
+	reviews := make([]review, len(state.Reviews))
+	for i, item := range state.Reviews {
+		reviews[i] = review{
+			TxHash:        item.Letter.TxHash,
+			SubAccount:    item.Letter.SubAccount,
+			Module:        item.Letter.Module,
+			Token:         item.Letter.Token,
+			Protocol:      item.Protocol,
+			Verb:          string(item.Verb),
+			BalanceChange: item.Letter.BalanceChange.String(),
+			Reason:        item.Reason,
+			QueuedAt:      item.Letter.QueuedAt.Unix(),
+		}
+	}
+	return reviews, nil
+}
+
+// adminResolveReview approves or rejects a held update. Approved updates are
+// queued as dead letters, so the retry handler submits them.
+func adminResolveReview(config *Config, runtime cre.Runtime, caller common.Address, params json.RawMessage) (interface{}, error) {
+	var p reviewParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, fmt.Errorf("invalid params: %w", err)
+	}
+
+	items := state.TakeReviews(p.TxHash)
+	if len(items) == 0 {
+		return nil, fmt.Errorf("no review pending for %s", p.TxHash)
+	}
+	item := items[0]
+
+	resolution := "rejected"
+	if p.Approve {
+		resolution = "approved"
+		for _, approved := range items {
+			letter := approved.Letter
+			letter.Reason = "approved after review"
+			letter.QueuedAt = runtime.Now()
+			state.AddDeadLetter(letter)
+			QueueMirrorDeadLetters(config, letter, runtime.Now())
+		}
+	}
+
+	if p.Note != "" {
+		state.Annotate(Annotation{
+			Kind:       AnnotateAudit,
+			TxHash:     item.Letter.TxHash,
+			Note:       p.Note,
+			Resolution: resolution,
+			Author:     caller.Hex(),
+			At:         runtime.Now().Unix(),
+		})
+	}
+
+	runtime.Logger().Info("Review resolved", "txHash", item.Letter.TxHash, "resolution", resolution, "author", caller.Hex())
+	return map[string]string{"txHash": item.Letter.TxHash, "resolution": resolution}, nil
+}
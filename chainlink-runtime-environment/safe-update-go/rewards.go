@@ -0,0 +1,83 @@
+//go:build wasip1
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/blockchain/evm"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+)
+
+// SettleClaim settles a reward claim from its receipt. Claim calldata does
+// not carry what was paid, so the rewards are the configured tokens the
+// receipt transferred into the Safe, credited like any other inflow. A claim
+// naming its reward tokens only counts those, and no more than it claims.
+// Rewards in tokens that are not configured cannot be valued and are left out.
+func SettleClaim(config *Config, runtime cre.Runtime, evmClient *evm.Client, logger *slog.Logger, action *Action, txHash []byte) error {
+	transfers, err := safeTransfers(config, runtime, evmClient, txHash)
+	if err != nil {
+		return err
+	}
+	if err := claimRewards(action, transfers); err != nil {
+		return err
+	}
+
+	// Rewards claimed for another account pay the Safe nothing
+	if action.Recipient != (common.Address{}) {
+		avatar, err := GetAvatar(runtime, evmClient, ActiveTarget(config).ModuleAddress.Address)
+		if err != nil {
+			return err
+		}
+		if action.Recipient != avatar && !action.NeedsReview {
+			action.NeedsReview, action.ReviewReason = true, fmt.Sprintf("rewards claimed to %s", action.Recipient.Hex())
+		}
+	}
+
+	logger.Info("Rewards claimed", "protocol", action.Protocol, "claimer", action.Counterparty.Hex(), "rewards", len(action.AssetsIn))
+	return nil
+}
+
+// claimRewards sets the rewards of a claim from the Safe's receipt transfers.
+// Claim selectors are matched on any target, so a claim that also takes
+// tokens out of the Safe is held for review instead of crediting what it paid.
+func claimRewards(action *Action, transfers []receiptTransfer) error {
+	claimed := make(map[common.Address]*big.Int)
+	for _, asset := range action.AssetsIn {
+		if claimed[asset.Token] == nil {
+			claimed[asset.Token] = new(big.Int)
+		}
+		if asset.Amount != nil {
+			claimed[asset.Token].Add(claimed[asset.Token], asset.Amount)
+		}
+	}
+
+	var rewards []AssetAmount
+	paid := make(map[common.Address]*big.Int)
+	for _, t := range transfers {
+		if !t.In {
+			if !action.NeedsReview {
+				action.NeedsReview, action.ReviewReason = true, fmt.Sprintf("claim transferred %s of %s out of the Safe", t.Amount, t.Token.Hex())
+			}
+			continue
+		}
+		if len(claimed) > 0 && claimed[t.Token] == nil {
+			continue
+		}
+		if paid[t.Token] == nil {
+			paid[t.Token] = new(big.Int)
+			rewards = append(rewards, AssetAmount{Token: t.Token, Amount: paid[t.Token]})
+		}
+		paid[t.Token].Add(paid[t.Token], t.Amount)
+	}
+	for token, amount := range paid {
+		if max := claimed[token]; max != nil && max.Sign() > 0 && amount.Cmp(max) > 0 {
+			return fmt.Errorf("claim paid %s of %s, more than the %s claimed", amount, token.Hex(), max)
+		}
+	}
+	action.AssetsIn = rewards
+	return nil
+}
@@ -0,0 +1,65 @@
+//go:build wasip1
+
+package main
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestClaimRewards(t *testing.T) {
+	reward := common.HexToAddress("0x00000000000000000000000000000000000000bb")
+	other := common.HexToAddress("0x00000000000000000000000000000000000000ee")
+	in := func(token common.Address, n int64) receiptTransfer {
+		return receiptTransfer{Token: token, Amount: big.NewInt(n), In: true}
+	}
+	out := func(token common.Address, n int64) receiptTransfer {
+		return receiptTransfer{Token: token, Amount: big.NewInt(n)}
+	}
+
+	tests := []struct {
+		name      string
+		claimed   []AssetAmount
+		transfers []receiptTransfer
+		rewards   int64
+		review    bool
+		ok        bool
+	}{
+		{"paid", nil, []receiptTransfer{in(reward, 10), in(reward, 5)}, 15, false, true},
+		{"nothing paid", nil, nil, 0, false, true},
+		{"named reward", []AssetAmount{{Token: reward, Amount: big.NewInt(20)}}, []receiptTransfer{in(reward, 15), in(other, 7)}, 15, false, true},
+		{"above the claimed amount", []AssetAmount{{Token: reward, Amount: big.NewInt(10)}}, []receiptTransfer{in(reward, 15)}, 0, false, false},
+		{"takes another token", nil, []receiptTransfer{out(other, 100), in(reward, 15)}, 15, true, true},
+		{"takes the reward token", nil, []receiptTransfer{in(reward, 15), out(reward, 15)}, 15, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action := &Action{Verb: VerbClaim, AssetsIn: tt.claimed}
+			err := claimRewards(action, tt.transfers)
+			if !tt.ok {
+				if err == nil {
+					t.Errorf("settled %+v", action.AssetsIn)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			total := new(big.Int)
+			for _, asset := range action.AssetsIn {
+				if asset.Token != reward {
+					t.Errorf("credited %s", asset.Token.Hex())
+				}
+				total.Add(total, asset.Amount)
+			}
+			if total.Int64() != tt.rewards {
+				t.Errorf("credited %s, want %d", total, tt.rewards)
+			}
+			if action.NeedsReview != tt.review {
+				t.Errorf("review %t (%s)", action.NeedsReview, action.ReviewReason)
+			}
+		})
+	}
+}
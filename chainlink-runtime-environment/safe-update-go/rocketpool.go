@@ -0,0 +1,93 @@
+//go:build wasip1
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/blockchain/evm"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+)
+
+// Rocket Pool rETH ABI (getEthValue)
+const rETHABI = `[{"constant":true,"inputs":[{"name":"_rethAmount","type":"uint256"}],"name":"getEthValue","outputs":[{"name":"","type":"uint256"}],"type":"function"}]`
+
+// TokensBurned(address indexed from, uint256 amount, uint256 ethAmount, uint256 time), emitted by rETH
+var rETHTokensBurnedSignature = crypto.Keccak256Hash([]byte("TokensBurned(address,uint256,uint256,uint256)"))
+
+// GetRETHEthValue converts rETH to ETH with the contract's getEthValue at a block
+func GetRETHEthValue(runtime cre.Runtime, evmClient *evm.Client, rETH common.Address, amount *big.Int, receipt *evm.Receipt) (*big.Int, error) {
+	parsedRETHABI, err := abi.JSON(strings.NewReader(rETHABI))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse rETH ABI: %w", err)
+	}
+
+	callData, err := parsedRETHABI.Pack("getEthValue", amount)
+	if err != nil {
+		return nil, fmt.Errorf("failed to pack getEthValue call: %w", err)
+	}
+
+	result, err := evmClient.CallContract(runtime, &evm.CallContractRequest{
+		Call: &evm.CallMsg{
+			To:   rETH.Bytes(),
+			Data: callData,
+		},
+		BlockNumber: receipt.BlockNumber,
+	}).Await()
+	if err != nil {
+		return nil, fmt.Errorf("failed to call getEthValue on rETH %s: %w", rETH.Hex(), err)
+	}
+
+	ethValue := new(big.Int)
+	if err := parsedRETHABI.UnpackIntoInterface(&ethValue, "getEthValue", result.Data); err != nil {
+		return nil, fmt.Errorf("failed to unpack getEthValue: %w", err)
+	}
+	return ethValue, nil
+}
+
+// ResolveRocketPoolBurn settles an rETH burn. The burned rETH is debited at
+// its ETH value from getEthValue in the burn's block, and the ETH paid out is
+// credited from the TokensBurned event. Both are valued through the rETH
+// entry of the vaults registry, which maps it to WETH. A burn(uint256) on
+// another token has no TokensBurned event and is left to the fallback decoders.
+func ResolveRocketPoolBurn(runtime cre.Runtime, evmClient *evm.Client, logger *slog.Logger, action *Action, calldata []byte, txHash []byte) error {
+	if len(action.AssetsOut) != 1 {
+		return nil
+	}
+	burned := action.AssetsOut[0]
+
+	reply, err := evmClient.GetTransactionReceipt(runtime, &evm.GetTransactionReceiptRequest{Hash: txHash}).Await()
+	if err != nil {
+		return fmt.Errorf("failed to get transaction receipt: %w", err)
+	}
+	if reply.Receipt == nil {
+		return fmt.Errorf("transaction receipt not found")
+	}
+
+	for _, log := range reply.Receipt.Logs {
+		if common.BytesToAddress(log.Address) != action.Counterparty || len(log.Topics) != 2 || len(log.Data) < 96 ||
+			!bytes.Equal(log.Topics[0], rETHTokensBurnedSignature.Bytes()) {
+			continue
+		}
+		ethAmount := new(big.Int).SetBytes(log.Data[32:64])
+
+		ethValue, err := GetRETHEthValue(runtime, evmClient, action.Counterparty, burned.Amount, reply.Receipt)
+		if err != nil {
+			return err
+		}
+
+		action.AssetsOut = []AssetAmount{{Token: action.Counterparty, Amount: ethValue, Vault: true}}
+		action.AssetsIn = []AssetAmount{{Token: action.Counterparty, Amount: ethAmount, Vault: true}}
+		logger.Info("Rocket Pool rETH burned", "rETH", burned.Amount.String(), "ethValue", ethValue.String(), "ethAmount", ethAmount.String())
+		return nil
+	}
+
+	return fmt.Errorf("%w: no rETH TokensBurned from %s in receipt", ErrUnknownSelector, action.Counterparty.Hex())
+}
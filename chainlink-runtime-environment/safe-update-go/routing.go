@@ -0,0 +1,331 @@
+//go:build wasip1
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/networking/http"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// Route schedules
+const (
+	// RouteAlways delivers at any time
+	RouteAlways = ""
+
+	// RouteBusinessHours delivers only during business hours
+	RouteBusinessHours = "businessHours"
+
+	// RouteAfterHours delivers only outside business hours
+	RouteAfterHours = "afterHours"
+)
+
+// Alert channel types
+const (
+	ChannelSlack     = "slack"
+	ChannelPagerDuty = "pagerduty"
+	ChannelWebhook   = "webhook"
+)
+
+// pagerDutyEventsURL is the PagerDuty Events API v2 endpoint
+const pagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+// alertDeliveryCacheAge is how long the nodes share the response of the one
+// node that delivered an alert, instead of each posting it again
+const alertDeliveryCacheAge = 5 * time.Minute
+
+// BusinessHours represents the working days and hours of a team
+type BusinessHours struct {
+	TimeZone string   `json:"timeZone"`
+	Days     []string `json:"days"`
+	Start    string   `json:"start"`
+	End      string   `json:"end"`
+}
+
+// AlertRoute delivers the alerts matching a message prefix and, for a tenant,
+// its subaccounts to a channel on a schedule. Hours overrides the global
+// business hours for tenants in another time zone.
+type AlertRoute struct {
+	Name        string         `json:"name"`
+	Prefix      string         `json:"prefix,omitempty"`
+	SubAccounts []Address      `json:"subAccounts,omitempty"`
+	When        string         `json:"when,omitempty"`
+	Hours       *BusinessHours `json:"hours,omitempty"`
+	Channel     AlertChannel   `json:"channel"`
+}
+
+// AlertChannel represents where a route delivers alerts. The URL and the
+// PagerDuty routing key are credentials, so the config only names the
+// secrets holding them.
+type AlertChannel struct {
+	Type             string `json:"type"`
+	URLSecret        string `json:"urlSecret,omitempty"`
+	RoutingKeySecret string `json:"routingKeySecret,omitempty"`
+}
+
+// Alert represents an alert handed to the routes
+type Alert struct {
+	Message    string            `json:"message"`
+	Level      string            `json:"level"`
+	Key        string            `json:"key,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	At         int64             `json:"at"`
+}
+
+// weekdays maps the configured day names to weekdays
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// validateRoutes checks the alert routes and the business hours they rely on
+func validateRoutes(alerts *AlertConfig) error {
+	if alerts.BusinessHours != nil {
+		if err := validateBusinessHours(alerts.BusinessHours); err != nil {
+			return fmt.Errorf("businessHours: %w", err)
+		}
+	}
+
+	for i, route := range alerts.Routes {
+		switch route.When {
+		case RouteAlways:
+		case RouteBusinessHours, RouteAfterHours:
+			if route.Hours == nil && alerts.BusinessHours == nil {
+				return fmt.Errorf("route %d: %s requires business hours", i, route.When)
+			}
+		default:
+			return fmt.Errorf("route %d: unknown schedule %q", i, route.When)
+		}
+		if route.Hours != nil {
+			if err := validateBusinessHours(route.Hours); err != nil {
+				return fmt.Errorf("route %d: %w", i, err)
+			}
+		}
+
+		switch route.Channel.Type {
+		case ChannelSlack, ChannelWebhook:
+			if route.Channel.URLSecret == "" {
+				return fmt.Errorf("route %d: %s channel requires a urlSecret", i, route.Channel.Type)
+			}
+		case ChannelPagerDuty:
+			if route.Channel.RoutingKeySecret == "" {
+				return fmt.Errorf("route %d: pagerduty channel requires a routingKeySecret", i)
+			}
+		default:
+			return fmt.Errorf("route %d: unknown channel type %q", i, route.Channel.Type)
+		}
+	}
+	return nil
+}
+
+// validateBusinessHours checks the time zone, days and hours
+func validateBusinessHours(hours *BusinessHours) error {
+	if _, err := time.LoadLocation(hours.TimeZone); err != nil {
+		return fmt.Errorf("invalid timeZone: %w", err)
+	}
+	for _, day := range hours.Days {
+		if _, ok := weekdays[strings.ToLower(day)]; !ok {
+			return fmt.Errorf("invalid day %q", day)
+		}
+	}
+	start, err := time.Parse("15:04", hours.Start)
+	if err != nil {
+		return fmt.Errorf("invalid start: %w", err)
+	}
+	end, err := time.Parse("15:04", hours.End)
+	if err != nil {
+		return fmt.Errorf("invalid end: %w", err)
+	}
+	if !end.After(start) {
+		return fmt.Errorf("end must be after start")
+	}
+	return nil
+}
+
+// InBusinessHours reports whether a point in time falls within business hours
+func InBusinessHours(hours *BusinessHours, now time.Time) bool {
+	location, err := time.LoadLocation(hours.TimeZone)
+	if err != nil {
+		return false
+	}
+	local := now.In(location)
+	if !IsWorkday(hours, now) {
+		return false
+	}
+
+	clock := local.Format("15:04")
+	return clock >= hours.Start && clock < hours.End
+}
+
+// IsWorkday reports whether a point in time falls on one of the working days,
+// in the business hours' time zone
+func IsWorkday(hours *BusinessHours, now time.Time) bool {
+	location, err := time.LoadLocation(hours.TimeZone)
+	if err != nil {
+		return false
+	}
+	weekday := now.In(location).Weekday()
+	for _, day := range hours.Days {
+		if weekdays[strings.ToLower(day)] == weekday {
+			return true
+		}
+	}
+	return false
+}
+
+// routeMatches reports whether a route takes an alert at a point in time
+func routeMatches(alerts *AlertConfig, route AlertRoute, alert Alert, now time.Time) bool {
+	if !strings.HasPrefix(alert.Message, route.Prefix) {
+		return false
+	}
+
+	if len(route.SubAccounts) > 0 {
+		subAccount := alert.Attributes["subAccount"]
+		tenant := false
+		for _, s := range route.SubAccounts {
+			if strings.EqualFold(s.Hex(), subAccount) {
+				tenant = true
+				break
+			}
+		}
+		if !tenant {
+			return false
+		}
+	}
+
+	if route.When == RouteAlways {
+		return true
+	}
+	hours := route.Hours
+	if hours == nil {
+		hours = alerts.BusinessHours
+	}
+	return InBusinessHours(hours, now) == (route.When == RouteBusinessHours)
+}
+
+// newAlert builds an alert from a log message and its key value arguments
+func newAlert(level slog.Level, message string, key string, now time.Time, args ...any) Alert {
+	attributes := make(map[string]string)
+	for i := 0; i+1 < len(args); i += 2 {
+		attributes[fmt.Sprint(args[i])] = fmt.Sprint(args[i+1])
+	}
+	return Alert{Message: message, Level: level.String(), Key: key, Attributes: attributes, At: now.Unix()}
+}
+
+// RouteAlert delivers an alert to every matching route. Delivery failures are
+// logged and do not affect the handler that raised the alert.
+func RouteAlert(config *Config, runtime cre.Runtime, alert Alert) {
+	if config.Alerts == nil {
+		return
+	}
+	logger := runtime.Logger()
+	now := runtime.Now()
+
+	for _, route := range config.Alerts.Routes {
+		if !routeMatches(config.Alerts, route, alert, now) {
+			continue
+		}
+		if err := deliverAlert(config, runtime, route.Channel, alert); err != nil {
+			logger.Warn("Failed to deliver alert", "route", route.Name, "alert", alert.Message, "error", err.Error())
+			continue
+		}
+		logger.Info("Alert delivered", "route", route.Name, "channel", route.Channel.Type, "alert", alert.Message)
+	}
+}
+
+// channelSecret reads one of a channel's secrets, or returns fallback when it is not named
+func channelSecret(runtime cre.Runtime, id string, fallback string) (string, error) {
+	if id == "" {
+		return fallback, nil
+	}
+	secret, err := runtime.GetSecret(&cre.SecretRequest{Id: id}).Await()
+	if err != nil {
+		return "", fmt.Errorf("failed to get secret %s: %w", id, err)
+	}
+	return secret.Value, nil
+}
+
+// alertBody encodes an alert in the format expected by a channel
+func alertBody(channel AlertChannel, routingKey string, alert Alert) ([]byte, error) {
+	summary := alert.Message
+	if alert.Key != "" {
+		summary += " [" + alert.Key + "]"
+	}
+
+	switch channel.Type {
+	case ChannelSlack:
+		return json.Marshal(map[string]string{"text": summary})
+	case ChannelPagerDuty:
+		severity := "warning"
+		if strings.HasPrefix(alert.Message, "PAGE:") || alert.Level == slog.LevelError.String() {
+			severity = "critical"
+		}
+		return json.Marshal(map[string]interface{}{
+			"routing_key":  routingKey,
+			"event_action": "trigger",
+			"dedup_key":    alert.Message + "|" + alert.Key,
+			"payload": map[string]interface{}{
+				"summary":        summary,
+				"source":         "safe-update-go",
+				"severity":       severity,
+				"custom_details": alert.Attributes,
+			},
+		})
+	default:
+		return json.Marshal(alert)
+	}
+}
+
+// deliverAlert posts an alert to a channel. The request is cached so that one
+// node posts it and the others agree on its response instead of posting it
+// again.
+func deliverAlert(config *Config, runtime cre.Runtime, channel AlertChannel, alert Alert) error {
+	fallbackURL := ""
+	if channel.Type == ChannelPagerDuty {
+		fallbackURL = pagerDutyEventsURL
+	}
+	url, err := channelSecret(runtime, channel.URLSecret, fallbackURL)
+	if err != nil {
+		return err
+	}
+	routingKey, err := channelSecret(runtime, channel.RoutingKeySecret, "")
+	if err != nil {
+		return err
+	}
+
+	body, err := alertBody(channel, routingKey, alert)
+	if err != nil {
+		return fmt.Errorf("failed to encode alert: %w", err)
+	}
+
+	_, err = http.SendRequest(config, runtime, &http.Client{},
+		func(config *Config, logger *slog.Logger, sendRequester *http.SendRequester) (string, error) {
+			resp, err := sendRequester.SendRequest(&http.Request{
+				Url:     url,
+				Method:  "POST",
+				Headers: map[string]string{"Content-Type": "application/json"},
+				Body:    body,
+				CacheSettings: &http.CacheSettings{
+					Store:  true,
+					MaxAge: durationpb.New(alertDeliveryCacheAge),
+				},
+			}).Await()
+			if err != nil {
+				return "", fmt.Errorf("failed to post alert: %w", err)
+			}
+			if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+				return "", fmt.Errorf("alert channel returned status %d", resp.StatusCode)
+			}
+			return "delivered", nil
+		},
+		cre.ConsensusIdenticalAggregation[string](),
+	).Await()
+	return err
+}
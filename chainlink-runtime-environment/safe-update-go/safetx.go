@@ -0,0 +1,144 @@
+//go:build wasip1
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/networking/http"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+)
+
+// SafeTxServiceConfig represents the Safe Transaction Service used to find who
+// proposed and signed a subaccount's transaction
+type SafeTxServiceConfig struct {
+	BaseURL      string `json:"baseUrl"`
+	APIKeySecret string `json:"apiKeySecret,omitempty"`
+}
+
+// SafeInitiator represents the owners behind a Safe multisig transaction
+type SafeInitiator struct {
+	SafeTxHash string
+	Nonce      uint64
+	Proposer   string
+	Signers    []string
+	Executor   string
+}
+
+// safeMultisigTransactions represents the Safe Transaction Service response
+// of /api/v1/safes/{address}/multisig-transactions/
+type safeMultisigTransactions struct {
+	Results []struct {
+		SafeTxHash    string `json:"safeTxHash"`
+		Nonce         uint64 `json:"nonce"`
+		Proposer      string `json:"proposer"`
+		Executor      string `json:"executor"`
+		Confirmations []struct {
+			Owner string `json:"owner"`
+		} `json:"confirmations"`
+	} `json:"results"`
+}
+
+// LookupSafeInitiator asks the Safe Transaction Service which owners queued and
+// signed the transaction of a Safe subaccount. It returns nil when the service
+// is not configured, the subaccount is not a Safe or the lookup fails; audit
+// enrichment never blocks allowance updates.
+func LookupSafeInitiator(config *Config, runtime cre.Runtime, subAccount common.Address, txHash string) *SafeInitiator {
+	if config.SafeTxService == nil {
+		return nil
+	}
+	logger := runtime.Logger()
+
+	apiKey := ""
+	if config.SafeTxService.APIKeySecret != "" {
+		secret, err := runtime.GetSecret(&cre.SecretRequest{Id: config.SafeTxService.APIKeySecret}).Await()
+		if err != nil {
+			logger.Warn("Failed to get Safe Transaction Service key", "error", err.Error())
+			return nil
+		}
+		apiKey = secret.Value
+	}
+
+	url := fmt.Sprintf("%s/api/v1/safes/%s/multisig-transactions/?transaction_hash=%s",
+		strings.TrimSuffix(config.SafeTxService.BaseURL, "/"), subAccount.Hex(), txHash)
+
+	// The initiator is returned JSON encoded so nodes agree on a plain string
+	encoded, err := http.SendRequest(config, runtime, &http.Client{},
+		func(config *Config, logger *slog.Logger, sendRequester *http.SendRequester) (string, error) {
+			headers := map[string]string{"Accept": "application/json"}
+			if apiKey != "" {
+				headers["Authorization"] = "Bearer " + apiKey
+			}
+
+			resp, err := sendRequester.SendRequest(&http.Request{
+				Url:     url,
+				Method:  "GET",
+				Headers: headers,
+			}).Await()
+			if err != nil {
+				return "", fmt.Errorf("failed to call Safe Transaction Service: %w", err)
+			}
+			if resp.StatusCode == 404 {
+				return "", nil
+			}
+			if resp.StatusCode != 200 {
+				return "", fmt.Errorf("Safe Transaction Service returned status %d", resp.StatusCode)
+			}
+
+			var txs safeMultisigTransactions
+			if err := json.Unmarshal(resp.Body, &txs); err != nil {
+				return "", fmt.Errorf("failed to decode Safe transactions: %w", err)
+			}
+			if len(txs.Results) == 0 {
+				return "", nil
+			}
+
+			tx := txs.Results[0]
+			initiator := SafeInitiator{
+				SafeTxHash: tx.SafeTxHash,
+				Nonce:      tx.Nonce,
+				Proposer:   tx.Proposer,
+				Executor:   tx.Executor,
+			}
+			for _, confirmation := range tx.Confirmations {
+				initiator.Signers = append(initiator.Signers, confirmation.Owner)
+			}
+			body, err := json.Marshal(initiator)
+			return string(body), err
+		},
+		cre.ConsensusIdenticalAggregation[string](),
+	).Await()
+	if err != nil {
+		logger.Warn("Failed to look up Safe transaction", "subAccount", subAccount.Hex(), "txHash", txHash, "error", err.Error())
+		return nil
+	}
+	if encoded == "" {
+		return nil
+	}
+
+	var initiator SafeInitiator
+	if err := json.Unmarshal([]byte(encoded), &initiator); err != nil {
+		logger.Warn("Failed to decode Safe transaction initiator", "error", err.Error())
+		return nil
+	}
+
+	logger.Info("Safe transaction initiator", "safeTxHash", initiator.SafeTxHash, "proposer", initiator.Proposer,
+		"signers", initiator.Signers, "executor", initiator.Executor)
+	return &initiator
+}
+
+// WithInitiator copies the Safe owners behind a transaction into an audit record
+func (r AuditRecord) WithInitiator(initiator *SafeInitiator) AuditRecord {
+	if initiator == nil {
+		return r
+	}
+	r.SafeTxHash = initiator.SafeTxHash
+	r.Proposer = initiator.Proposer
+	r.Signers = strings.Join(initiator.Signers, ",")
+	r.Executor = initiator.Executor
+	return r
+}
@@ -0,0 +1,261 @@
+// Package scenarios encodes known attack and abuse patterns against the
+// allowance workflow: sequences of executeOnProtocol calls by a subaccount,
+// each with the outcome the workflow's defenses must reach. The workflow's
+// tests replay them through the full event pipeline, from the
+// ProtocolExecuted log to the allowance report, so the defenses are verified
+// on every run rather than assumed.
+//
+// Every scenario runs in the same environment: one module and Safe, one
+// subaccount, an Aave-style pool and a 6 decimals token priced $1 by its feed.
+package scenarios
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Outcome represents what the workflow does with one step
+type Outcome string
+
+// Outcomes of a step
+const (
+	// Submitted: the allowance update was written
+	Submitted Outcome = "submitted"
+
+	// Rejected: the action broke the policy and nothing was submitted
+	Rejected Outcome = "rejected"
+
+	// Review: the action was held for an operator
+	Review Outcome = "review"
+
+	// Failed: the handler failed and nothing was submitted
+	Failed Outcome = "failed"
+
+	// Ignored: the event was handled without any update, e.g. a replay
+	Ignored Outcome = "ignored"
+)
+
+// Environment addresses shared by every scenario
+var (
+	Module     = common.HexToAddress("0x00000000000000000000000000000000000A0001")
+	Safe       = common.HexToAddress("0x00000000000000000000000000000000000A0002")
+	Updater    = common.HexToAddress("0x00000000000000000000000000000000000A0003")
+	SubAccount = common.HexToAddress("0x00000000000000000000000000000000000B0001")
+	Pool       = common.HexToAddress("0x00000000000000000000000000000000000C0001")
+	Token      = common.HexToAddress("0x00000000000000000000000000000000000D0001")
+	PriceFeed  = common.HexToAddress("0x00000000000000000000000000000000000D0002")
+	Treasury   = common.HexToAddress("0x00000000000000000000000000000000000E0001")
+	Attacker   = common.HexToAddress("0x00000000000000000000000000000000000F0001")
+)
+
+// Token and feed precisions, and the feed answer: $1
+const (
+	TokenDecimals = 6
+	PriceDecimals = 8
+)
+
+// TokenPrice is the feed answer of Token
+var TokenPrice = big.NewInt(100_000_000)
+
+// Step represents one executeOnProtocol call and the outcome expected from it
+type Step struct {
+	Name string
+
+	// After is the time elapsed since the previous step
+	After time.Duration
+
+	// Target and Calldata are the protocol call wrapped by executeOnProtocol
+	Target   common.Address
+	Calldata []byte
+
+	// PriceAge is how old the feed answer is when the step is processed
+	PriceAge time.Duration
+
+	// Replay delivers the previous step's log again instead of a new one
+	Replay bool
+
+	Expect Outcome
+}
+
+// Scenario represents an abuse pattern and the policy defending against it
+type Scenario struct {
+	Name   string
+	Attack string
+
+	// Policy is the JSON policy configuration the defense relies on
+	Policy string
+
+	Steps []Step
+}
+
+// USD returns the amount of Token worth a number of dollars
+func USD(dollars int64) *big.Int {
+	return new(big.Int).Mul(big.NewInt(dollars), big.NewInt(1_000_000))
+}
+
+// word left-pads a value to an ABI word
+func word(b []byte) []byte {
+	return common.LeftPadBytes(b, 32)
+}
+
+// AaveWithdraw returns the calldata of withdraw(address asset, uint256 amount, address to)
+func AaveWithdraw(asset common.Address, amount *big.Int, to common.Address) []byte {
+	data := crypto.Keccak256([]byte("withdraw(address,uint256,address)"))[:4]
+	data = append(data, word(asset.Bytes())...)
+	data = append(data, word(amount.Bytes())...)
+	return append(data, word(to.Bytes())...)
+}
+
+// AaveSupply returns the calldata of supply(address asset, uint256 amount, address onBehalfOf, uint16 referralCode)
+func AaveSupply(asset common.Address, amount *big.Int, onBehalfOf common.Address) []byte {
+	data := crypto.Keccak256([]byte("supply(address,uint256,address,uint16)"))[:4]
+	data = append(data, word(asset.Bytes())...)
+	data = append(data, word(amount.Bytes())...)
+	data = append(data, word(onBehalfOf.Bytes())...)
+	return append(data, word(nil)...)
+}
+
+// ExecuteOnProtocol returns the calldata of executeOnProtocol(address target, bytes data)
+func ExecuteOnProtocol(target common.Address, calldata []byte) []byte {
+	data := crypto.Keccak256([]byte("executeOnProtocol(address,bytes)"))[:4]
+	data = append(data, word(target.Bytes())...)
+	data = append(data, word(big.NewInt(64).Bytes())...)
+	data = append(data, word(big.NewInt(int64(len(calldata))).Bytes())...)
+	return append(data, common.RightPadBytes(calldata, (len(calldata)+31)/32*32)...)
+}
+
+// withdrawal returns a step withdrawing dollars of Token from the pool to a recipient
+func withdrawal(name string, after time.Duration, dollars int64, to common.Address, expect Outcome) Step {
+	return Step{
+		Name:     name,
+		After:    after,
+		Target:   Pool,
+		Calldata: AaveWithdraw(Token, USD(dollars), to),
+		PriceAge: time.Minute,
+		Expect:   expect,
+	}
+}
+
+// SplitWithdrawals splits a withdrawal into parts each below the daily cap,
+// hoping they are checked one by one. The exposure limit sums the period.
+func SplitWithdrawals() Scenario {
+	return Scenario{
+		Name:   "split-withdrawals",
+		Attack: "withdraw $120k in four parts of $30k against a $100k daily cap",
+		Policy: `{"exposureLimits": [{"verb": "withdraw", "maxUsd": 100000, "periodSeconds": 86400}]}`,
+		Steps: []Step{
+			withdrawal("first part", 0, 30_000, Safe, Submitted),
+			withdrawal("second part", 15*time.Minute, 30_000, Safe, Submitted),
+			withdrawal("third part", 15*time.Minute, 30_000, Safe, Submitted),
+			withdrawal("fourth part over the cap", 15*time.Minute, 30_000, Safe, Rejected),
+			withdrawal("next day", 24*time.Hour+5*time.Minute, 30_000, Safe, Submitted),
+		},
+	}
+}
+
+// StructuredWithdrawals splits a withdrawal into parts each just below the
+// per-transaction threshold. The structuring detector escalates the sequence
+// as one withdrawal above it.
+func StructuredWithdrawals() Scenario {
+	return Scenario{
+		Name:   "structured-withdrawals",
+		Attack: "withdraw $28.5k in three parts of $9.5k against a $10k per-transaction threshold",
+		Policy: `{"structuring": {"thresholdUsd": 10000, "windowSeconds": 3600, "response": "review"}}`,
+		Steps: []Step{
+			withdrawal("first part", 0, 9_500, Safe, Submitted),
+			withdrawal("unrelated small withdrawal", 5*time.Minute, 2_000, Safe, Submitted),
+			withdrawal("second part", 5*time.Minute, 9_500, Safe, Submitted),
+			withdrawal("third part", 5*time.Minute, 9_500, Safe, Review),
+			withdrawal("after the window", 2*time.Hour, 9_500, Safe, Submitted),
+		},
+	}
+}
+
+// WithdrawalBurst builds a quiet history, then withdraws in a burst and in
+// one unusually large amount. Each stays under any fixed cap; the anomaly
+// detector holds them against the subaccount's own pattern.
+func WithdrawalBurst() Scenario {
+	var steps []Step
+	for day := 0; day < 10; day++ {
+		after := 24 * time.Hour
+		if day == 0 {
+			after = 0
+		}
+		steps = append(steps, withdrawal(fmt.Sprintf("daily withdrawal %d", day+1), after, 1_000, Safe, Submitted))
+	}
+	steps = append(steps,
+		withdrawal("usual withdrawal", 24*time.Hour, 1_000, Safe, Submitted),
+		withdrawal("burst", 5*time.Minute, 1_000, Safe, Review),
+		withdrawal("large one-off", 2*time.Hour, 50_000, Safe, Review),
+	)
+	return Scenario{
+		Name:   "withdrawal-burst",
+		Attack: "drain in a burst of small withdrawals, or one large one, after weeks of small daily ones",
+		Policy: `{"anomaly": {"lookbackSeconds": 2592000, "response": "review"}}`,
+		Steps:  steps,
+	}
+}
+
+// WithdrawToUnknownAddress pays a withdrawal out to an address that is not
+// the Safe, so the allowance is credited while the funds leave
+func WithdrawToUnknownAddress() Scenario {
+	return Scenario{
+		Name:   "withdraw-to-unknown-address",
+		Attack: "withdraw from the pool to an attacker-controlled address",
+		Policy: fmt.Sprintf(`{"restrictRecipients": true, "allowedRecipients": [%q]}`, Treasury.Hex()),
+		Steps: []Step{
+			withdrawal("to the Safe", 0, 10_000, Safe, Submitted),
+			withdrawal("to an unknown address", time.Minute, 10_000, Attacker, Rejected),
+			withdrawal("to an allowed recipient", time.Minute, 10_000, Treasury, Submitted),
+		},
+	}
+}
+
+// StaleOracleWindow withdraws while the price feed has stopped updating, so
+// the tokens are valued at a price the market may have left
+func StaleOracleWindow() Scenario {
+	stale := withdrawal("stale feed", 10*time.Minute, 10_000, Safe, Failed)
+	stale.PriceAge = 3 * time.Hour
+	return Scenario{
+		Name:   "stale-oracle-window",
+		Attack: "withdraw while the feed answer is hours old",
+		Policy: `{"maxPriceAgeSeconds": 3600}`,
+		Steps: []Step{
+			withdrawal("fresh feed", 0, 10_000, Safe, Submitted),
+			stale,
+			withdrawal("feed updated", 10*time.Minute, 10_000, Safe, Submitted),
+		},
+	}
+}
+
+// ReplayedEvent delivers the same ProtocolExecuted log twice, hoping the
+// withdrawal is credited twice
+func ReplayedEvent() Scenario {
+	replay := withdrawal("replayed log", time.Minute, 10_000, Safe, Ignored)
+	replay.Replay = true
+	return Scenario{
+		Name:   "replayed-event",
+		Attack: "deliver the log of one withdrawal twice",
+		Policy: `{}`,
+		Steps: []Step{
+			withdrawal("withdrawal", 0, 10_000, Safe, Submitted),
+			replay,
+		},
+	}
+}
+
+// All returns every scenario of the pack
+func All() []Scenario {
+	return []Scenario{
+		SplitWithdrawals(),
+		StructuredWithdrawals(),
+		WithdrawalBurst(),
+		WithdrawToUnknownAddress(),
+		StaleOracleWindow(),
+		ReplayedEvent(),
+	}
+}
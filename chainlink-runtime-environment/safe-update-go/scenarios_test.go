@@ -0,0 +1,287 @@
+//go:build wasip1
+
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/blockchain/evm"
+	evmmock "github.com/smartcontractkit/cre-sdk-go/capabilities/blockchain/evm/mock"
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/networking/http"
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/scheduler/cron"
+	"github.com/smartcontractkit/cre-sdk-go/cre/testutils"
+
+	"safe-update-go/scenarios"
+)
+
+// scenarioStart is when the first step of every scenario happens, a Monday morning
+var scenarioStart = time.Date(2026, time.March, 2, 10, 0, 0, 0, time.UTC)
+
+// scenarioRuntime is a test runtime whose clock is moved by the scenario steps
+type scenarioRuntime struct {
+	*testutils.TestRuntime
+	now time.Time
+}
+
+// Now returns the time of the current step
+func (r *scenarioRuntime) Now() time.Time {
+	return r.now
+}
+
+// scenarioChain represents the chain the scenario steps are played against
+type scenarioChain struct {
+	transactions map[string][]byte
+	priceAge     time.Duration
+	now          time.Time
+	writes       int
+
+	// updaterReads counts the preflight's authorizedUpdater() calls
+	updaterReads int
+
+	// receiver makes the module declare IReceiver through ERC-165
+	receiver bool
+
+	// onWrite runs after each write, e.g. to race a save with it
+	onWrite func()
+}
+
+// selectorOf returns the 4 bytes selector of a function signature
+func selectorOf(signature string) string {
+	return hex.EncodeToString(crypto.Keccak256([]byte(signature))[:4])
+}
+
+// callContract answers the reads of the pipeline: token and feed decimals,
+// the feed answer, and the module's avatar, updater, update probe and ERC-165
+// receiver query
+func (c *scenarioChain) callContract(_ context.Context, input *evm.CallContractRequest) (*evm.CallContractReply, error) {
+	to, selector := common.BytesToAddress(input.Call.To), hex.EncodeToString(input.Call.Data[:4])
+	word := func(value *big.Int) []byte { return common.LeftPadBytes(value.Bytes(), 32) }
+
+	switch {
+	case to == scenarios.Token && selector == selectorOf("decimals()"):
+		return &evm.CallContractReply{Data: word(big.NewInt(scenarios.TokenDecimals))}, nil
+	case to == scenarios.PriceFeed && selector == selectorOf("decimals()"):
+		return &evm.CallContractReply{Data: word(big.NewInt(scenarios.PriceDecimals))}, nil
+	case to == scenarios.PriceFeed && selector == selectorOf("latestRoundData()"):
+		updatedAt := big.NewInt(c.now.Add(-c.priceAge).Unix())
+		var data []byte
+		for _, value := range []*big.Int{big.NewInt(1), scenarios.TokenPrice, updatedAt, updatedAt, big.NewInt(1)} {
+			data = append(data, word(value)...)
+		}
+		return &evm.CallContractReply{Data: data}, nil
+	case to == scenarios.Module && selector == selectorOf("avatar()"):
+		return &evm.CallContractReply{Data: word(new(big.Int).SetBytes(scenarios.Safe.Bytes()))}, nil
+	case to == scenarios.Module && selector == selectorOf("authorizedUpdater()"):
+		c.updaterReads++
+		return &evm.CallContractReply{Data: word(new(big.Int).SetBytes(scenarios.Updater.Bytes()))}, nil
+	case to == scenarios.Module && selector == selectorOf("updateSubaccountAllowances(address,uint256)"):
+		return &evm.CallContractReply{}, nil
+	case to == scenarios.Module && selector == selectorOf("supportsInterface(bytes4)") && c.receiver:
+		return &evm.CallContractReply{Data: word(big.NewInt(1))}, nil
+	}
+	return nil, fmt.Errorf("unexpected call to %s with selector %s", to.Hex(), selector)
+}
+
+// getTransactionByHash returns the executeOnProtocol transaction of a step
+func (c *scenarioChain) getTransactionByHash(_ context.Context, input *evm.GetTransactionByHashRequest) (*evm.GetTransactionByHashReply, error) {
+	data, ok := c.transactions[hex.EncodeToString(input.Hash)]
+	if !ok {
+		return nil, fmt.Errorf("transaction 0x%x not found", input.Hash)
+	}
+	return &evm.GetTransactionByHashReply{Transaction: &evm.Transaction{Data: data}}, nil
+}
+
+// writeReport counts the allowance updates written
+func (c *scenarioChain) writeReport(_ context.Context, input *evm.WriteReportRequest) (*evm.WriteReportReply, error) {
+	c.writes++
+	if c.onWrite != nil {
+		c.onWrite()
+	}
+	return &evm.WriteReportReply{
+		TxStatus: evm.TxStatus_TX_STATUS_SUCCESS,
+		TxHash:   crypto.Keccak256([]byte(fmt.Sprintf("write %d", c.writes))),
+	}, nil
+}
+
+// scenarioConfig returns the workflow config of the scenario environment with a policy
+func scenarioConfig(t *testing.T, policy string) *Config {
+	config, err := ParseConfig([]byte(fmt.Sprintf(`{
+		"moduleAddress": %q,
+		"chainSelector": "16015286601757825753",
+		"gasLimit": 500000,
+		"proxyAddress": %q,
+		"tokens": [{"address": %q, "priceFeedAddress": %q, "symbol": "USDC", "type": "erc20"}],
+		"policy": %s
+	}`, scenarios.Module.Hex(), scenarios.Updater.Hex(), scenarios.Token.Hex(), scenarios.PriceFeed.Hex(), policy)))
+	if err != nil {
+		t.Fatalf("parse config: %v", err)
+	}
+	if err := ValidateConfig(config); err != nil {
+		t.Fatalf("validate config: %v", err)
+	}
+	return config
+}
+
+// newScenarioChain registers the mocked EVM capability of the scenario
+// environment, with a runtime whose clock starts at scenarioStart
+func newScenarioChain(t *testing.T, config *Config) (*scenarioRuntime, *scenarioChain) {
+	t.Helper()
+	runtime := &scenarioRuntime{TestRuntime: testutils.NewRuntime(t, nil), now: scenarioStart}
+	chain := &scenarioChain{transactions: make(map[string][]byte), now: scenarioStart}
+	client, err := evmmock.NewClientCapability(config.ChainSelector.Uint64(), t)
+	if err != nil {
+		t.Fatalf("register EVM capability: %v", err)
+	}
+	client.CallContract = chain.callContract
+	client.GetTransactionByHash = chain.getTransactionByHash
+	client.WriteReport = chain.writeReport
+	return runtime, chain
+}
+
+// protocolExecuted records an executeOnProtocol transaction of the
+// subaccount, named to derive its hash, and returns its ProtocolExecuted log
+func (c *scenarioChain) protocolExecuted(name string, target common.Address, calldata []byte, at time.Time) *evm.Log {
+	txHash := crypto.Keccak256([]byte(name))
+	c.transactions[hex.EncodeToString(txHash)] = scenarios.ExecuteOnProtocol(target, calldata)
+	return &evm.Log{
+		Address: scenarios.Module.Bytes(),
+		Topics: [][]byte{
+			protocolExecutedSignature.Bytes(),
+			common.LeftPadBytes(scenarios.SubAccount.Bytes(), 32),
+			common.LeftPadBytes(target.Bytes(), 32),
+		},
+		Data:   common.LeftPadBytes(big.NewInt(at.Unix()).Bytes(), 32),
+		TxHash: txHash,
+	}
+}
+
+// harness runs the workflow's handlers against the scenario environment,
+// each in a fresh instance sharing one state store
+type harness struct {
+	t       *testing.T
+	config  *Config
+	runtime *scenarioRuntime
+	chain   *scenarioChain
+	store   mapStore
+	events  int
+}
+
+func newHarness(t *testing.T) *harness {
+	config := scenarioConfig(t, "{}")
+	runtime, chain := newScenarioChain(t, config)
+	return &harness{t: t, config: config, runtime: runtime, chain: chain, store: make(mapStore)}
+}
+
+// instance starts a fresh workflow memory on the shared store
+func (h *harness) instance() {
+	state = NewWorkflowState()
+	state.Store = h.store
+}
+
+// advance moves the clocks of the runtime and the chain
+func (h *harness) advance(d time.Duration) {
+	h.runtime.now = h.runtime.now.Add(d)
+	h.chain.now = h.runtime.now
+}
+
+// withdraw delivers a $1,000 withdrawal to the Safe, emitted delay ago, and
+// reports whether an allowance update was written
+func (h *harness) withdraw(delay time.Duration) bool {
+	h.t.Helper()
+	h.events++
+	payload := h.chain.protocolExecuted(h.t.Name()+string(rune('a'+h.events)), scenarios.Pool,
+		scenarios.AaveWithdraw(scenarios.Token, scenarios.USD(1000), scenarios.Safe), h.runtime.now.Add(-delay))
+	return h.deliver(payload)
+}
+
+// deliver runs the event handler on a log and reports whether an allowance
+// update was written
+func (h *harness) deliver(payload *evm.Log) bool {
+	h.t.Helper()
+	writes := h.chain.writes
+	h.instance()
+	if _, err := withStateStore(OnProtocolExecuted)(h.config, h.runtime, payload); err != nil {
+		h.t.Fatalf("event: %v", err)
+	}
+	return h.chain.writes > writes
+}
+
+// healthCheck runs the health handler and reports whether updates are paused
+func (h *harness) healthCheck() bool {
+	h.t.Helper()
+	h.instance()
+	if _, err := withStateStore(OnHealthCheck)(h.config, h.runtime, &cron.Payload{}); err != nil {
+		h.t.Fatalf("health check: %v", err)
+	}
+	return state.Paused
+}
+
+// admin calls an admin method signed by the updater's key
+func (h *harness) admin(method string, params string) error {
+	h.instance()
+	payload := &http.Payload{
+		Input: []byte(`{"method": "` + method + `", "params": ` + params + `}`),
+		Key:   &http.AuthorizedKey{Type: http.KeyType_KEY_TYPE_ECDSA_EVM, PublicKey: scenarios.Updater.Hex()},
+	}
+	_, err := withStateStore(OnAdminRequest)(h.config, h.runtime, payload)
+	return err
+}
+
+// stepOutcome maps the handler's result to the outcome of a step
+func stepOutcome(err error, writes int, reviews int) scenarios.Outcome {
+	switch {
+	case errors.Is(err, ErrPolicyViolation):
+		return scenarios.Rejected
+	case err != nil:
+		return scenarios.Failed
+	case reviews > 0:
+		return scenarios.Review
+	case writes > 0:
+		return scenarios.Submitted
+	}
+	return scenarios.Ignored
+}
+
+// TestScenarios plays each scenario through the event handler. Every step
+// starts from a fresh workflow memory and only finds what the earlier steps
+// persisted in the state store, as separate executions do.
+func TestScenarios(t *testing.T) {
+	for _, scenario := range scenarios.All() {
+		t.Run(scenario.Name, func(t *testing.T) {
+			config := scenarioConfig(t, scenario.Policy)
+			store := make(mapStore)
+			handler := withStateStore(OnProtocolExecuted)
+			reviews := 0
+
+			runtime, chain := newScenarioChain(t, config)
+
+			var payload *evm.Log
+			for i, step := range scenario.Steps {
+				runtime.now = runtime.now.Add(step.After)
+				chain.now, chain.priceAge = runtime.now, step.PriceAge
+
+				if !step.Replay || payload == nil {
+					payload = chain.protocolExecuted(fmt.Sprintf("%s %d", scenario.Name, i), step.Target, step.Calldata, runtime.now)
+				}
+
+				state = NewWorkflowState()
+				state.Store = store
+				writes := chain.writes
+				result, err := handler(config, runtime, payload)
+				outcome := stepOutcome(err, chain.writes-writes, len(state.Reviews)-reviews)
+				reviews = len(state.Reviews)
+				if outcome != step.Expect {
+					t.Fatalf("step %d (%s): got %s, want %s (result %+v, error %v)", i+1, step.Name, outcome, step.Expect, result, err)
+				}
+			}
+		})
+	}
+}
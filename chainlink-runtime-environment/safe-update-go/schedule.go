@@ -0,0 +1,139 @@
+//go:build wasip1
+
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"safe-update-go/fixedpoint"
+)
+
+// Policy modifier schedules
+const (
+	// ModifierAfterHours applies outside business hours, weekends included
+	ModifierAfterHours = "afterHours"
+
+	// ModifierWeekend applies on the days that are not working days
+	ModifierWeekend = "weekend"
+
+	// ModifierBusinessHours applies during business hours
+	ModifierBusinessHours = "businessHours"
+)
+
+// PolicyModifier tightens the policy on a schedule: caps are scaled down to
+// limitPercent of their value, and actions can be held for review whatever
+// their confidence. Hours overrides the policy's business hours.
+type PolicyModifier struct {
+	Name          string         `json:"name"`
+	When          string         `json:"when"`
+	Hours         *BusinessHours `json:"hours,omitempty"`
+	LimitPercent  uint64         `json:"limitPercent,omitempty"`
+	RequireReview bool           `json:"requireReview,omitempty"`
+}
+
+// validateModifiers checks the policy modifiers and the business hours they rely on
+func validateModifiers(policy *PolicyConfig) error {
+	if policy.BusinessHours != nil {
+		if err := validateBusinessHours(policy.BusinessHours); err != nil {
+			return fmt.Errorf("businessHours: %w", err)
+		}
+	}
+
+	for i, modifier := range policy.Modifiers {
+		switch modifier.When {
+		case ModifierAfterHours, ModifierWeekend, ModifierBusinessHours:
+		default:
+			return fmt.Errorf("modifier %d: unknown schedule %q", i, modifier.When)
+		}
+		if modifier.Hours == nil && policy.BusinessHours == nil {
+			return fmt.Errorf("modifier %d: %s requires business hours", i, modifier.When)
+		}
+		if modifier.Hours != nil {
+			if err := validateBusinessHours(modifier.Hours); err != nil {
+				return fmt.Errorf("modifier %d: %w", i, err)
+			}
+		}
+		if modifier.LimitPercent > 100 {
+			return fmt.Errorf("modifier %d: limitPercent must be at most 100", i)
+		}
+		if modifier.LimitPercent == 0 && !modifier.RequireReview {
+			return fmt.Errorf("modifier %d: limitPercent or requireReview is required", i)
+		}
+	}
+	return nil
+}
+
+// active reports whether the modifier applies at a point in time
+func (m PolicyModifier) active(policy *PolicyConfig, now time.Time) bool {
+	hours := m.Hours
+	if hours == nil {
+		hours = policy.BusinessHours
+	}
+	if hours == nil {
+		return false
+	}
+
+	switch m.When {
+	case ModifierAfterHours:
+		return !InBusinessHours(hours, now)
+	case ModifierWeekend:
+		return !IsWorkday(hours, now)
+	case ModifierBusinessHours:
+		return InBusinessHours(hours, now)
+	default:
+		return false
+	}
+}
+
+// ActiveModifiers returns the policy modifiers that apply at a point in time
+func ActiveModifiers(policy *PolicyConfig, now time.Time) []PolicyModifier {
+	if policy == nil {
+		return nil
+	}
+	var active []PolicyModifier
+	for _, modifier := range policy.Modifiers {
+		if modifier.active(policy, now) {
+			active = append(active, modifier)
+		}
+	}
+	return active
+}
+
+// limitPercent returns the share of their value caps keep at a point in time:
+// the strictest limitPercent of the active modifiers, or 100
+func limitPercent(policy *PolicyConfig, now time.Time) uint64 {
+	percent := uint64(100)
+	for _, modifier := range ActiveModifiers(policy, now) {
+		if modifier.LimitPercent != 0 && modifier.LimitPercent < percent {
+			percent = modifier.LimitPercent
+		}
+	}
+	return percent
+}
+
+// scheduledCap scales a cap by the share the active modifiers leave, and
+// describes the scaling for errors
+func scheduledCap(capUSD *big.Int, percent uint64) (*big.Int, string) {
+	if percent >= 100 {
+		return capUSD, ""
+	}
+	return fixedpoint.Percent(capUSD, percent, fixedpoint.RoundDown), fmt.Sprintf(" at %d%% by schedule", percent)
+}
+
+// ScheduledReview reports whether an active modifier holds every action for
+// review at a point in time, and why
+func ScheduledReview(policy *PolicyConfig, now time.Time) (bool, string) {
+	var names []string
+	for _, modifier := range ActiveModifiers(policy, now) {
+		if modifier.RequireReview {
+			names = append(names, modifier.Name)
+		}
+	}
+	if len(names) == 0 {
+		return false, ""
+	}
+	return true, fmt.Sprintf("review required by schedule %s", strings.Join(names, ", "))
+}
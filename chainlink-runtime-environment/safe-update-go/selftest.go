@@ -0,0 +1,142 @@
+//go:build wasip1
+
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/networking/http"
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/scheduler/cron"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+)
+
+// SelfTestConfig represents how the self-test can be triggered
+type SelfTestConfig struct {
+	Schedule       string   `json:"schedule,omitempty"`
+	AuthorizedKeys []string `json:"authorizedKeys,omitempty"`
+}
+
+// SelfTestStep represents the outcome of one pipeline stage of the self-test
+type SelfTestStep struct {
+	Name   string
+	Passed bool
+	Detail string
+}
+
+// selfTestAmount is the raw token amount of the synthetic withdrawal
+var selfTestAmount = big.NewInt(1_000_000)
+
+// OnSelfTestCron runs the self-test on a schedule
+func OnSelfTestCron(config *Config, runtime cre.Runtime, payload *cron.Payload) (*ExecutionResult, error) {
+	return RunSelfTest(config, runtime)
+}
+
+// OnSelfTestHTTP runs the self-test on request of an authorized key
+func OnSelfTestHTTP(config *Config, runtime cre.Runtime, payload *http.Payload) (*ExecutionResult, error) {
+	return RunSelfTest(config, runtime)
+}
+
+// syntheticExecuteOnProtocol builds executeOnProtocol(target, data) calldata
+// wrapping an Aave withdrawal of a configured token
+func syntheticExecuteOnProtocol(token common.Address, recipient common.Address) []byte {
+	withdraw, _ := hex.DecodeString(AaveWithdrawSelector)
+	withdraw = append(withdraw, common.LeftPadBytes(token.Bytes(), 32)...)
+	withdraw = append(withdraw, common.LeftPadBytes(selfTestAmount.Bytes(), 32)...)
+	withdraw = append(withdraw, common.LeftPadBytes(recipient.Bytes(), 32)...)
+
+	data := crypto.Keccak256([]byte("executeOnProtocol(address,bytes)"))[:4]
+	data = append(data, common.LeftPadBytes(recipient.Bytes(), 32)...)
+	data = append(data, common.LeftPadBytes(big.NewInt(64).Bytes(), 32)...)
+	data = append(data, common.LeftPadBytes(big.NewInt(int64(len(withdraw))).Bytes(), 32)...)
+	data = append(data, common.RightPadBytes(withdraw, (len(withdraw)+31)/32*32)...)
+	return data
+}
+
+// RunSelfTest runs a synthetic withdrawal through the pipeline without submitting
+// anything. Every dependency is exercised with one real read: the token and its
+// price feed through accounting, and the module through the permission preflight.
+func RunSelfTest(config *Config, runtime cre.Runtime) (*ExecutionResult, error) {
+	logger := runtime.Logger()
+	logger.Info("Self-test started")
+
+	evmClient := newEVMClient(config)
+	active := ActiveTarget(config)
+	var steps []SelfTestStep
+
+	record := func(name string, err error, detail string) bool {
+		step := SelfTestStep{Name: name, Passed: err == nil, Detail: detail}
+		if err != nil {
+			step.Detail = err.Error()
+		}
+		steps = append(steps, step)
+		logger.Info("Self-test step", "step", name, "passed", step.Passed, "detail", step.Detail)
+		return err == nil
+	}
+
+	report := func() (*ExecutionResult, error) {
+		var failed []string
+		for _, step := range steps {
+			if !step.Passed {
+				failed = append(failed, step.Name+": "+step.Detail)
+			}
+		}
+		if len(failed) > 0 {
+			RaiseAlert(config, runtime, slog.LevelError, "PAGE: self-test failed", "", "failures", failed)
+			return &ExecutionResult{Message: "Self-test failed: " + strings.Join(failed, "; "), Success: false}, nil
+		}
+		logger.Info("Self-test passed", "steps", len(steps))
+		return &ExecutionResult{Message: fmt.Sprintf("Self-test passed: %d steps", len(steps)), Success: true}, nil
+	}
+
+	if len(config.Tokens) == 0 {
+		record("config", fmt.Errorf("no tokens configured"), "")
+		return report()
+	}
+	token := config.Tokens[0].Address.Address
+	moduleAddr := active.ModuleAddress.Address
+
+	call, err := ExtractProtocolCalldata(logger, syntheticExecuteOnProtocol(token, moduleAddr))
+	if err != nil {
+		record("extract", err, "")
+		return report()
+	}
+	record("extract", nil, fmt.Sprintf("%d bytes", len(call.Calldata)))
+
+	action, err := DecodeAction(logger, moduleAddr, call.Calldata)
+	if err != nil {
+		record("decode", err, "")
+		return report()
+	}
+	record("decode", nil, action.Protocol+" "+string(action.Verb))
+
+	accounting, err := AccountAction(config, runtime, evmClient, logger, action)
+	if err != nil {
+		record("accounting", err, "")
+		return report()
+	}
+	record("accounting", nil, "net "+FormatUSD(config, accounting.NetUSD))
+
+	_, policyErr := EvaluatePolicy(config.Policy, state, action, accounting, runtime.Now())
+	record("policy", policyErr, "")
+
+	_, _, err = ApplyPrecisionGuard(config.Precision, accounting.NetUSD)
+	record("precision", err, "")
+
+	paused, err := IsModulePaused(runtime, evmClient, moduleAddr)
+	if err == nil && paused {
+		err = fmt.Errorf("module %s is paused", moduleAddr.Hex())
+	}
+	record("module", err, "not paused")
+
+	// Force a fresh permission check rather than trusting the cached result
+	delete(state.PreflightPassed, active.ModuleAddress.Hex())
+	record("preflight", Preflight(active, runtime, evmClient), "updater authorized")
+
+	return report()
+}
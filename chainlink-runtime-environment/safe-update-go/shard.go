@@ -0,0 +1,98 @@
+//go:build wasip1
+
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// ShardingConfig represents the share of subaccounts processed by this instance.
+// Every instance is deployed with the same Count, Pinned and Fingerprint and
+// its own Index. Pinned is keyed by the subaccount as written, so the same
+// subaccount written in two cases is caught as an overlap instead of collapsing.
+type ShardingConfig struct {
+	Count       uint64            `json:"count"`
+	Index       uint64            `json:"index"`
+	Pinned      map[string]uint64 `json:"pinned,omitempty"`
+	Fingerprint string            `json:"fingerprint,omitempty"`
+}
+
+// ValidateSharding checks the shard table and detects overlapping claims
+func ValidateSharding(sharding *ShardingConfig) error {
+	if sharding == nil {
+		return nil
+	}
+	if sharding.Count == 0 {
+		return fmt.Errorf("count is required")
+	}
+	if sharding.Index >= sharding.Count {
+		return fmt.Errorf("index %d out of range for %d shards", sharding.Index, sharding.Count)
+	}
+
+	// The same subaccount written twice with a different case is claimed by both shards
+	seen := make(map[common.Address]uint64)
+	for addr, shard := range sharding.Pinned {
+		if !common.IsHexAddress(addr) {
+			return fmt.Errorf("invalid pinned subAccount %q", addr)
+		}
+		if shard >= sharding.Count {
+			return fmt.Errorf("subAccount %s pinned to shard %d out of range", addr, shard)
+		}
+		subAccount := common.HexToAddress(addr)
+		if previous, ok := seen[subAccount]; ok && previous != shard {
+			return fmt.Errorf("overlap: subAccount %s pinned to shards %d and %d", subAccount.Hex(), previous, shard)
+		}
+		seen[subAccount] = shard
+	}
+
+	// A different fingerprint means this instance disagrees with its peers on
+	// the shard table, so subaccounts could be processed twice or not at all
+	if sharding.Fingerprint != "" {
+		if actual := ShardFingerprint(sharding); !strings.EqualFold(actual, sharding.Fingerprint) {
+			return fmt.Errorf("overlap: shard table fingerprint %s does not match expected %s", actual, sharding.Fingerprint)
+		}
+	}
+
+	return nil
+}
+
+// ShardFingerprint hashes the parts of the shard table shared by all instances
+func ShardFingerprint(sharding *ShardingConfig) string {
+	pinned := make([]string, 0, len(sharding.Pinned))
+	for addr, shard := range sharding.Pinned {
+		pinned = append(pinned, fmt.Sprintf("%s:%d", common.HexToAddress(addr).Hex(), shard))
+	}
+	sort.Strings(pinned)
+
+	count := make([]byte, 8)
+	binary.BigEndian.PutUint64(count, sharding.Count)
+	data := append(count, []byte(strings.Join(pinned, ","))...)
+	return crypto.Keccak256Hash(data).Hex()
+}
+
+// ShardOf returns the shard owning a subaccount: its pinned shard, otherwise
+// keccak256(subAccount) mod count
+func ShardOf(sharding *ShardingConfig, subAccount common.Address) uint64 {
+	for addr, shard := range sharding.Pinned {
+		if common.HexToAddress(addr) == subAccount {
+			return shard
+		}
+	}
+	hash := new(big.Int).SetBytes(crypto.Keccak256(subAccount.Bytes()))
+	return hash.Mod(hash, new(big.Int).SetUint64(sharding.Count)).Uint64()
+}
+
+// OwnsSubaccount reports whether this instance processes a subaccount
+func OwnsSubaccount(config *Config, subAccount common.Address) bool {
+	if config.Sharding == nil {
+		return true
+	}
+	return ShardOf(config.Sharding, subAccount) == config.Sharding.Index
+}
@@ -0,0 +1,179 @@
+//go:build wasip1
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/smartcontractkit/chainlink-protos/cre/go/values/pb"
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/blockchain/evm"
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/networking/http"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+)
+
+// SimulationConfig represents the Tenderly project used to simulate
+// transactions that need human review
+type SimulationConfig struct {
+	AccountSlug     string `json:"accountSlug"`
+	ProjectSlug     string `json:"projectSlug"`
+	NetworkID       string `json:"networkId"`
+	AccessKeySecret string `json:"accessKeySecret"`
+	MaxCallDepth    int    `json:"maxCallDepth,omitempty"`
+}
+
+// SimulationResult represents the review material returned by the simulator.
+// Simulations are not saved, so every node gets the same result and there is
+// no per-node simulation id or dashboard link.
+type SimulationResult struct {
+	Success      bool     `json:"success"`
+	AssetChanges []string `json:"assetChanges"`
+	Calls        []string `json:"calls"`
+}
+
+// tenderlyCall represents a node of a Tenderly call trace
+type tenderlyCall struct {
+	FunctionName string         `json:"function_name"`
+	To           string         `json:"to"`
+	Calls        []tenderlyCall `json:"calls"`
+}
+
+// tenderlyResponse represents the parts of a Tenderly simulation used in alerts
+type tenderlyResponse struct {
+	Transaction struct {
+		Status          bool `json:"status"`
+		TransactionInfo struct {
+			AssetChanges []struct {
+				Type      string `json:"type"`
+				From      string `json:"from"`
+				To        string `json:"to"`
+				Amount    string `json:"amount"`
+				TokenInfo struct {
+					Symbol string `json:"symbol"`
+				} `json:"token_info"`
+			} `json:"asset_changes"`
+			CallTrace tenderlyCall `json:"call_trace"`
+		} `json:"transaction_info"`
+	} `json:"transaction"`
+}
+
+// defaultMaxCallDepth limits the decoded trace embedded in alerts
+const defaultMaxCallDepth = 2
+
+// flattenCalls lists the decoded calls of a trace down to a depth
+func flattenCalls(call tenderlyCall, depth int, maxDepth int, calls []string) []string {
+	if depth > maxDepth {
+		return calls
+	}
+	if call.FunctionName != "" {
+		calls = append(calls, fmt.Sprintf("%d:%s@%s", depth, call.FunctionName, call.To))
+	}
+	for _, child := range call.Calls {
+		calls = flattenCalls(child, depth+1, maxDepth, calls)
+	}
+	return calls
+}
+
+// SimulateTransaction replays a subaccount's transaction on Tenderly at its
+// position in the block and returns the asset flows and decoded calls
+func SimulateTransaction(config *Config, runtime cre.Runtime, subAccount common.Address, tx *evm.Transaction, log *evm.Log) (*SimulationResult, error) {
+	sim := config.Simulation
+
+	secret, err := runtime.GetSecret(&cre.SecretRequest{Id: sim.AccessKeySecret}).Await()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get secret %s: %w", sim.AccessKeySecret, err)
+	}
+
+	value := "0"
+	if tx.Value != nil {
+		value = pb.NewIntFromBigInt(tx.Value).String()
+	}
+	request := map[string]interface{}{
+		"network_id":        sim.NetworkID,
+		"from":              subAccount.Hex(),
+		"to":                common.BytesToAddress(tx.To).Hex(),
+		"input":             "0x" + common.Bytes2Hex(tx.Data),
+		"gas":               tx.Gas,
+		"value":             value,
+		"transaction_index": log.TxIndex,
+		"simulation_type":   "full",
+		"save":              false,
+		"save_if_fails":     false,
+	}
+	if log.BlockNumber != nil {
+		request["block_number"] = pb.NewIntFromBigInt(log.BlockNumber).Uint64()
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode simulation request: %w", err)
+	}
+
+	url := fmt.Sprintf("https://api.tenderly.co/api/v1/account/%s/project/%s/simulate", sim.AccountSlug, sim.ProjectSlug)
+	maxDepth := sim.MaxCallDepth
+	if maxDepth == 0 {
+		maxDepth = defaultMaxCallDepth
+	}
+
+	// The result is returned JSON encoded so nodes agree on a plain string
+	encoded, err := http.SendRequest(config, runtime, &http.Client{},
+		func(config *Config, logger *slog.Logger, sendRequester *http.SendRequester) (string, error) {
+			resp, err := sendRequester.SendRequest(&http.Request{
+				Url:     url,
+				Method:  "POST",
+				Headers: map[string]string{"Content-Type": "application/json", "X-Access-Key": secret.Value},
+				Body:    body,
+			}).Await()
+			if err != nil {
+				return "", fmt.Errorf("failed to call simulator: %w", err)
+			}
+			if resp.StatusCode != 200 {
+				return "", fmt.Errorf("simulator returned status %d", resp.StatusCode)
+			}
+
+			var simulation tenderlyResponse
+			if err := json.Unmarshal(resp.Body, &simulation); err != nil {
+				return "", fmt.Errorf("failed to decode simulation: %w", err)
+			}
+
+			result := SimulationResult{
+				Success: simulation.Transaction.Status,
+				Calls:   flattenCalls(simulation.Transaction.TransactionInfo.CallTrace, 0, maxDepth, nil),
+			}
+			for _, change := range simulation.Transaction.TransactionInfo.AssetChanges {
+				result.AssetChanges = append(result.AssetChanges,
+					fmt.Sprintf("%s %s %s: %s -> %s", change.Type, change.Amount, change.TokenInfo.Symbol, change.From, change.To))
+			}
+
+			encoded, err := json.Marshal(result)
+			return string(encoded), err
+		},
+		cre.ConsensusIdenticalAggregation[string](),
+	).Await()
+	if err != nil {
+		return nil, err
+	}
+
+	var result SimulationResult
+	if err := json.Unmarshal([]byte(encoded), &result); err != nil {
+		return nil, fmt.Errorf("failed to decode simulation result: %w", err)
+	}
+	return &result, nil
+}
+
+// simulationAlertArgs simulates a transaction for review and returns the
+// alert attributes describing it. Simulation failures only drop the enrichment.
+func simulationAlertArgs(config *Config, runtime cre.Runtime, subAccount common.Address, tx *evm.Transaction, log *evm.Log) []any {
+	if config.Simulation == nil || tx == nil {
+		return nil
+	}
+
+	result, err := SimulateTransaction(config, runtime, subAccount, tx, log)
+	if err != nil {
+		runtime.Logger().Warn("Failed to simulate transaction", "subAccount", subAccount.Hex(), "error", err.Error())
+		return nil
+	}
+	return []any{"simulationSuccess", result.Success,
+		"assetChanges", result.AssetChanges, "calls", result.Calls}
+}
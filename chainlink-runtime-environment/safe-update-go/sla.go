@@ -0,0 +1,191 @@
+//go:build wasip1
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+)
+
+// SLAConfig represents the processing SLAs checked by the health handler
+type SLAConfig struct {
+	MaxEventLatencySeconds  uint64           `json:"maxEventLatencySeconds"`
+	MaxFeedStalenessSeconds uint64           `json:"maxFeedStalenessSeconds"`
+	MaxDeadLetterAgeSeconds uint64           `json:"maxDeadLetterAgeSeconds"`
+	Escalation              EscalationConfig `json:"escalation"`
+}
+
+// EscalationConfig represents the number of consecutive breached health checks
+// needed to reach each escalation level
+type EscalationConfig struct {
+	WarnAfter  int `json:"warnAfter"`
+	PageAfter  int `json:"pageAfter"`
+	PauseAfter int `json:"pauseAfter"`
+}
+
+// EscalationLevel represents a step of the escalation ladder
+type EscalationLevel int
+
+const (
+	EscalationNone EscalationLevel = iota
+	EscalationWarn
+	EscalationPage
+	EscalationPause
+)
+
+func (l EscalationLevel) String() string {
+	switch l {
+	case EscalationWarn:
+		return "warn"
+	case EscalationPage:
+		return "page"
+	case EscalationPause:
+		return "pause"
+	default:
+		return "none"
+	}
+}
+
+// pausedReasonPrefix starts the reason of dead letters queued while allowance
+// updates are paused
+const pausedReasonPrefix = "paused: "
+
+// resumeParams represents the parameters of the resume admin method
+type resumeParams struct {
+	Note string `json:"note,omitempty"`
+}
+
+func init() {
+	RegisterAdminMethod("resume", adminResume)
+}
+
+// SLABreach represents a single SLA that is currently not met
+type SLABreach struct {
+	Name   string
+	Actual time.Duration
+	Limit  time.Duration
+}
+
+func (b SLABreach) String() string {
+	return fmt.Sprintf("%s: %s > %s", b.Name, b.Actual, b.Limit)
+}
+
+// EvaluateSLA checks the recorded workflow state against the configured SLAs.
+// A zero limit disables the corresponding check. Dead letters queued by a
+// pause wait on it rather than fail, so they are left out of the dead letter
+// age, or they would hold the pause in place.
+func EvaluateSLA(sla *SLAConfig, s *WorkflowState, feedUpdates map[string]time.Time, now time.Time) []SLABreach {
+	var breaches []SLABreach
+
+	if limit := seconds(sla.MaxEventLatencySeconds); limit > 0 && s.LastEventLatency > limit {
+		breaches = append(breaches, SLABreach{Name: "event latency", Actual: s.LastEventLatency, Limit: limit})
+	}
+
+	if limit := seconds(sla.MaxFeedStalenessSeconds); limit > 0 {
+		for symbol, updatedAt := range feedUpdates {
+			if age := now.Sub(updatedAt); age > limit {
+				breaches = append(breaches, SLABreach{Name: "feed staleness " + symbol, Actual: age, Limit: limit})
+			}
+		}
+	}
+
+	if limit := seconds(sla.MaxDeadLetterAgeSeconds); limit > 0 {
+		if oldest, ok := s.OldestFailedDeadLetter(); ok {
+			if age := now.Sub(oldest.QueuedAt); age > limit {
+				breaches = append(breaches, SLABreach{Name: "dead letter age", Actual: age, Limit: limit})
+			}
+		}
+	}
+
+	return breaches
+}
+
+// EscalationFor returns the escalation level reached after the given number of
+// consecutive breached health checks
+func EscalationFor(escalation EscalationConfig, consecutive int) EscalationLevel {
+	switch {
+	case consecutive <= 0:
+		return EscalationNone
+	case escalation.PauseAfter > 0 && consecutive >= escalation.PauseAfter:
+		return EscalationPause
+	case escalation.PageAfter > 0 && consecutive >= escalation.PageAfter:
+		return EscalationPage
+	case consecutive >= escalation.WarnAfter:
+		return EscalationWarn
+	default:
+		return EscalationNone
+	}
+}
+
+// Escalate applies an escalation level to the workflow state
+func Escalate(logger *slog.Logger, s *WorkflowState, level EscalationLevel, breaches []SLABreach) {
+	details := make([]string, len(breaches))
+	for i, breach := range breaches {
+		details[i] = breach.String()
+	}
+
+	switch level {
+	case EscalationWarn:
+		logger.Warn("SLA breached", "consecutive", s.ConsecutiveBreach, "breaches", details)
+	case EscalationPage:
+		logger.Error("PAGE: SLA breached", "consecutive", s.ConsecutiveBreach, "breaches", details)
+	case EscalationPause:
+		if !s.Paused {
+			s.Paused = true
+			s.PausedReason = fmt.Sprintf("SLA breached for %d consecutive checks", s.ConsecutiveBreach)
+		}
+		logger.Error("PAGE: SLA breached, allowance updates paused", "consecutive", s.ConsecutiveBreach, "breaches", details)
+	}
+}
+
+// Resume lifts the pause. Letters queued by the pause are queued again from
+// now, and the latency measured before it is dropped, since nothing submitted
+// while paused could measure it again: the next submission does.
+func (s *WorkflowState) Resume(now time.Time) {
+	s.Paused = false
+	s.PausedReason = ""
+	s.ConsecutiveBreach = 0
+	s.LastEventLatency = 0
+	for i := range s.DeadLetters {
+		if strings.HasPrefix(s.DeadLetters[i].Reason, pausedReasonPrefix) {
+			s.DeadLetters[i].Reason = "resumed after pause"
+			s.DeadLetters[i].QueuedAt = now
+		}
+	}
+}
+
+// adminResume lifts an SLA pause, for breaches the health check cannot see
+// recover while paused, such as the event latency
+func adminResume(config *Config, runtime cre.Runtime, caller common.Address, params json.RawMessage) (interface{}, error) {
+	var p resumeParams
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, fmt.Errorf("invalid params: %w", err)
+		}
+	}
+	if !state.Paused {
+		return nil, fmt.Errorf("allowance updates are not paused")
+	}
+
+	reason := state.PausedReason
+	state.Resume(runtime.Now())
+	RecordAudit(config, runtime, AuditRecord{
+		Outcome:   "resumed",
+		Operator:  caller.Hex(),
+		Note:      p.Note,
+		Timestamp: runtime.Now().Unix(),
+	})
+
+	runtime.Logger().Info("Allowance updates resumed", "pausedReason", reason, "author", caller.Hex())
+	return map[string]string{"resumed": reason}, nil
+}
+
+func seconds(s uint64) time.Duration {
+	return time.Duration(s) * time.Second
+}
@@ -0,0 +1,89 @@
+//go:build wasip1
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"safe-update-go/scenarios"
+)
+
+// TestSLAPauseResumes pauses on a latency breach, which nothing submitted
+// while paused can clear, and resumes through the admin API
+func TestSLAPauseResumes(t *testing.T) {
+	h := newHarness(t)
+	h.config.SLA = &SLAConfig{
+		MaxEventLatencySeconds:  60,
+		MaxDeadLetterAgeSeconds: 600,
+		Escalation:              EscalationConfig{WarnAfter: 1, PauseAfter: 1},
+	}
+
+	if !h.withdraw(5 * time.Minute) {
+		t.Fatal("first update not submitted")
+	}
+	if !h.healthCheck() {
+		t.Fatal("latency breach did not pause")
+	}
+	if h.withdraw(0) {
+		t.Fatal("update submitted while paused")
+	}
+
+	// The queued letter outlives the dead letter SLA, but only the stale
+	// latency keeps the pause in place
+	h.advance(time.Hour)
+	if !h.healthCheck() {
+		t.Fatal("paused without a fresh latency measurement")
+	}
+	if breaches := EvaluateSLA(h.config.SLA, state, nil, h.runtime.now); len(breaches) != 1 || breaches[0].Name != "event latency" {
+		t.Fatalf("breaches %v, want the event latency only", breaches)
+	}
+
+	if err := h.admin("resume", `{"note": "latency caught up"}`); err != nil {
+		t.Fatalf("resume: %v", err)
+	}
+	if fields := state.AuditLog[len(state.AuditLog)-1]; fields["outcome"] != "resumed" || fields["operator"] != scenarios.Updater.Hex() {
+		t.Errorf("resume audited as %v", fields)
+	}
+	if err := h.admin("resume", `{}`); err == nil {
+		t.Error("resumed twice")
+	}
+
+	if h.healthCheck() {
+		t.Fatal("paused again after resume")
+	}
+	if !h.withdraw(0) {
+		t.Fatal("update not submitted after resume")
+	}
+	if state.DeadLetters[0].Reason != "resumed after pause" || !state.DeadLetters[0].QueuedAt.Equal(h.runtime.now) {
+		t.Errorf("queued letter %+v not queued again on resume", state.DeadLetters[0])
+	}
+}
+
+// TestSLAPauseRecovers pauses on a stale feed and resumes on its own once the
+// feed updates, although events were queued by the pause
+func TestSLAPauseRecovers(t *testing.T) {
+	h := newHarness(t)
+	h.config.SLA = &SLAConfig{
+		MaxFeedStalenessSeconds: 3600,
+		MaxDeadLetterAgeSeconds: 600,
+		Escalation:              EscalationConfig{WarnAfter: 1, PauseAfter: 1},
+	}
+
+	h.chain.priceAge = 2 * time.Hour
+	if !h.healthCheck() {
+		t.Fatal("stale feed did not pause")
+	}
+	if h.withdraw(0) {
+		t.Fatal("update submitted while paused")
+	}
+
+	h.advance(time.Hour)
+	h.chain.priceAge = time.Minute
+	if h.healthCheck() {
+		t.Fatal("pause held by the letters it queued")
+	}
+	if !h.withdraw(0) {
+		t.Fatal("update not submitted after recovery")
+	}
+}
@@ -0,0 +1,189 @@
+//go:build wasip1
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+)
+
+// snapshotVersion is the format version of state snapshots
+const snapshotVersion = 1
+
+// StateSnapshot represents a portable export of the workflow state. The
+// checksum is the keccak256 of the JSON encoded collections.
+type StateSnapshot struct {
+	Version     int                        `json:"version"`
+	Namespace   string                     `json:"namespace"`
+	ExportedAt  int64                      `json:"exportedAt"`
+	Collections map[string]json.RawMessage `json:"collections"`
+	Checksum    string                     `json:"checksum"`
+}
+
+// importParams represents the parameters of the importState admin method
+type importParams struct {
+	Snapshot StateSnapshot `json:"snapshot"`
+	DryRun   bool          `json:"dryRun,omitempty"`
+	Force    bool          `json:"force,omitempty"`
+}
+
+func init() {
+	RegisterAdminMethod("exportState", adminExportState)
+	RegisterAdminMethod("importState", adminImportState)
+}
+
+// exportedCollections returns every part of the state that is persisted
+func (s *WorkflowState) exportedCollections() map[string]interface{} {
+	return s.storedCollections()
+}
+
+// snapshotChecksum hashes the collections of a snapshot
+func snapshotChecksum(collections map[string]json.RawMessage) (string, error) {
+	encoded, err := json.Marshal(collections)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode collections: %w", err)
+	}
+	return crypto.Keccak256Hash(encoded).Hex(), nil
+}
+
+// ExportState builds a snapshot of the current state
+func ExportState(config *Config, runtime cre.Runtime) (*StateSnapshot, error) {
+	snapshot := &StateSnapshot{
+		Version:     snapshotVersion,
+		Namespace:   storeNamespace(config),
+		ExportedAt:  runtime.Now().Unix(),
+		Collections: make(map[string]json.RawMessage),
+	}
+
+	for key, collection := range state.exportedCollections() {
+		encoded, err := json.Marshal(collection)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode %s: %w", key, err)
+		}
+		snapshot.Collections[key] = encoded
+	}
+
+	checksum, err := snapshotChecksum(snapshot.Collections)
+	if err != nil {
+		return nil, err
+	}
+	snapshot.Checksum = checksum
+	return snapshot, nil
+}
+
+// VerifySnapshot runs the integrity checks of a snapshot against a scratch
+// state: format version, checksum, namespace, decodable collections and an
+// unbroken decision chain ending at the recorded head
+func VerifySnapshot(config *Config, snapshot *StateSnapshot, force bool) (*WorkflowState, error) {
+	if snapshot.Version != snapshotVersion {
+		return nil, fmt.Errorf("unsupported snapshot version %d", snapshot.Version)
+	}
+
+	checksum, err := snapshotChecksum(snapshot.Collections)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(checksum, snapshot.Checksum) {
+		return nil, fmt.Errorf("checksum mismatch: computed %s, snapshot has %s", checksum, snapshot.Checksum)
+	}
+
+	if namespace := storeNamespace(config); snapshot.Namespace != namespace && !force {
+		return nil, fmt.Errorf("snapshot of %s cannot be imported into %s without force", snapshot.Namespace, namespace)
+	}
+
+	restored := NewWorkflowState()
+	collections := restored.exportedCollections()
+	for key, raw := range snapshot.Collections {
+		collection, ok := collections[key]
+		if !ok {
+			return nil, fmt.Errorf("unknown collection %q", key)
+		}
+		// Nil collections keep the empty defaults of a fresh state
+		if string(raw) == "null" {
+			continue
+		}
+		if err := json.Unmarshal(raw, collection); err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %w", key, err)
+		}
+	}
+
+	if broken := VerifyDecisionChain(restored.DecisionLog); broken >= 0 {
+		return nil, fmt.Errorf("decision chain broken at entry %d", broken)
+	}
+	if n := len(restored.DecisionLog); n > 0 && restored.DecisionLog[n-1].Hash != restored.DecisionHead {
+		return nil, fmt.Errorf("decision head %s does not match the last entry", restored.DecisionHead.Hex())
+	}
+
+	return restored, nil
+}
+
+// ImportState replaces the exported collections of the state with those of
+// a verified snapshot. The config hash stays that of the running config. The
+// restored state is saved over the loaded document after the admin call.
+func ImportState(restored *WorkflowState) {
+	collections := state.exportedCollections()
+	for key, collection := range restored.exportedCollections() {
+		if key == "configHash" {
+			continue
+		}
+		reflect.ValueOf(collections[key]).Elem().Set(reflect.ValueOf(collection).Elem())
+	}
+
+	state.StoredDocument = ""
+}
+
+// adminExportState returns a snapshot of the state
+func adminExportState(config *Config, runtime cre.Runtime, caller common.Address, params json.RawMessage) (interface{}, error) {
+	snapshot, err := ExportState(config, runtime)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(snapshot.Collections))
+	for key := range snapshot.Collections {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	runtime.Logger().Info("State exported", "checksum", snapshot.Checksum, "collections", keys)
+	return snapshot, nil
+}
+
+// adminImportState verifies a snapshot and, unless dryRun is set, restores it
+func adminImportState(config *Config, runtime cre.Runtime, caller common.Address, params json.RawMessage) (interface{}, error) {
+	var p importParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, fmt.Errorf("invalid params: %w", err)
+	}
+
+	restored, err := VerifySnapshot(config, &p.Snapshot, p.Force)
+	if err != nil {
+		return nil, fmt.Errorf("snapshot rejected: %w", err)
+	}
+
+	result := map[string]interface{}{
+		"checksum":      p.Snapshot.Checksum,
+		"ledger":        len(restored.Ledger),
+		"deadLetters":   len(restored.DeadLetters),
+		"decisionLog":   len(restored.DecisionLog),
+		"auditLog":      len(restored.AuditLog),
+		"dryRun":        p.DryRun,
+		"exportedAt":    p.Snapshot.ExportedAt,
+		"fromNamespace": p.Snapshot.Namespace,
+	}
+	if p.DryRun {
+		return result, nil
+	}
+
+	ImportState(restored)
+	RaiseAlert(config, runtime, slog.LevelWarn, "ALERT: state restored from snapshot", p.Snapshot.Checksum,
+		"checksum", p.Snapshot.Checksum, "exportedAt", p.Snapshot.ExportedAt, "from", p.Snapshot.Namespace)
+	return result, nil
+}
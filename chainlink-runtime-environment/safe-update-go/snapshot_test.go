@@ -0,0 +1,63 @@
+//go:build wasip1
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/smartcontractkit/cre-sdk-go/cre/testutils"
+)
+
+// TestImportStateRestoresEveryCollection exports a state, imports it into a
+// fresh one and expects every exported collection back, so a collection added
+// to the store is never silently dropped on import
+func TestImportStateRestoresEveryCollection(t *testing.T) {
+	config := scenarioConfig(t, "{}")
+	runtime := testutils.NewRuntime(t, nil)
+
+	state = NewWorkflowState()
+	state.Degraded = true
+	state.LeaseHolder = "node-1"
+	state.AccountingAnchoredEpoch = 20000
+	state.WatchFlows = []WatchFlow{{}}
+	state.RegressionRuns = []RegressionRun{{}}
+	state.ConfigHash = "0xexported"
+	want := make(map[string]string)
+	for key, collection := range state.exportedCollections() {
+		encoded, err := json.Marshal(collection)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want[key] = string(encoded)
+	}
+
+	snapshot, err := ExportState(config, runtime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored, err := VerifySnapshot(config, snapshot, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state = NewWorkflowState()
+	state.ConfigHash = "0xrunning"
+	ImportState(restored)
+
+	for key, collection := range state.exportedCollections() {
+		encoded, err := json.Marshal(collection)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if key == "configHash" {
+			if state.ConfigHash != "0xrunning" {
+				t.Errorf("config hash replaced by %s", state.ConfigHash)
+			}
+			continue
+		}
+		if string(encoded) != want[key] {
+			t.Errorf("%s: imported %s, exported %s", key, encoded, want[key])
+		}
+	}
+}
@@ -0,0 +1,50 @@
+//go:build wasip1
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/blockchain/evm"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+)
+
+// ResolveSparkWithdraw verifies a SparkLend withdrawal against the pool's
+// Withdraw event for the reserve and recipient, which also settles a
+// withdrawal of the whole balance. A withdrawal whose event does not carry the
+// decoded amount is rejected. Other Spark actions are settled like Aave's.
+func ResolveSparkWithdraw(runtime cre.Runtime, evmClient *evm.Client, logger *slog.Logger, action *Action, calldata []byte, txHash []byte) error {
+	if action.Verb != VerbWithdraw || len(action.AssetsIn) != 1 {
+		return ResolveAaveFullAmount(runtime, evmClient, logger, action, calldata, txHash)
+	}
+	asset := &action.AssetsIn[0]
+
+	reply, err := evmClient.GetTransactionReceipt(runtime, &evm.GetTransactionReceiptRequest{Hash: txHash}).Await()
+	if err != nil {
+		return fmt.Errorf("failed to get transaction receipt: %w", err)
+	}
+	if reply.Receipt == nil {
+		return fmt.Errorf("transaction receipt not found")
+	}
+
+	for _, log := range reply.Receipt.Logs {
+		if common.BytesToAddress(log.Address) != action.Counterparty || len(log.Topics) != 4 || len(log.Data) < 32 ||
+			!bytes.Equal(log.Topics[0], aaveWithdrawSignature.Bytes()) ||
+			common.BytesToAddress(log.Topics[1]) != asset.Token || common.BytesToAddress(log.Topics[3]) != action.Recipient {
+			continue
+		}
+		amount := new(big.Int).SetBytes(log.Data[:32])
+		if asset.Amount.Cmp(aaveFullAmount) != 0 && asset.Amount.Cmp(amount) != 0 {
+			return fmt.Errorf("Spark Withdraw of %s does not match the calldata amount %s", amount, asset.Amount)
+		}
+		asset.Amount = amount
+		logger.Info("Spark withdrawal verified", "token", asset.Token.Hex(), "amount", amount.String(), "to", action.Recipient.Hex())
+		return nil
+	}
+
+	return fmt.Errorf("no Spark Withdraw of %s to %s in receipt", asset.Token.Hex(), action.Recipient.Hex())
+}
@@ -0,0 +1,144 @@
+//go:build wasip1
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/blockchain/evm"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+)
+
+// Stargate pool ABI (token and convertRate)
+const stargatePoolABI = `[
+	{"constant":true,"inputs":[],"name":"token","outputs":[{"name":"","type":"address"}],"type":"function"},
+	{"constant":true,"inputs":[],"name":"convertRate","outputs":[{"name":"","type":"uint256"}],"type":"function"}
+]`
+
+// RedeemLocal(address from, uint256 amountLP, uint256 amountSD, uint16 chainId, uint256 dstPoolId, bytes to), emitted by the pool
+var stargateRedeemLocalSignature = crypto.Keccak256Hash([]byte("RedeemLocal(address,uint256,uint256,uint16,uint256,bytes)"))
+
+// callStargatePool calls a view function of a Stargate pool returning one value
+func callStargatePool(runtime cre.Runtime, evmClient *evm.Client, pool common.Address, method string) (interface{}, error) {
+	parsedPoolABI, err := abi.JSON(strings.NewReader(stargatePoolABI))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse Stargate pool ABI: %w", err)
+	}
+	callData, err := parsedPoolABI.Pack(method)
+	if err != nil {
+		return nil, fmt.Errorf("failed to pack %s call: %w", method, err)
+	}
+	result, err := evmClient.CallContract(runtime, &evm.CallContractRequest{
+		Call: &evm.CallMsg{
+			To:   pool.Bytes(),
+			Data: callData,
+		},
+	}).Await()
+	if err != nil {
+		return nil, fmt.Errorf("failed to call %s on %s: %w", method, pool.Hex(), err)
+	}
+	values, err := parsedPoolABI.Unpack(method, result.Data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unpack %s: %w", method, err)
+	}
+	if len(values) == 0 {
+		return nil, fmt.Errorf("empty %s result", method)
+	}
+	return values[0], nil
+}
+
+// GetStargatePoolToken returns the token of a Stargate pool, from the cache or from the pool
+func GetStargatePoolToken(runtime cre.Runtime, evmClient *evm.Client, pool common.Address) (common.Address, error) {
+	key := pool.Hex() + ":token"
+	if token, ok := state.VaultAssets[key]; ok {
+		return token, nil
+	}
+	value, err := callStargatePool(runtime, evmClient, pool, "token")
+	if err != nil {
+		return common.Address{}, err
+	}
+	token, ok := value.(common.Address)
+	if !ok {
+		return common.Address{}, fmt.Errorf("unexpected token result")
+	}
+	state.VaultAssets[key] = token
+	return token, nil
+}
+
+// ResolveStargateBridge settles a Stargate redeemLocal from its receipt. The
+// Safe is the emitter of ExecutionFromModuleSuccess. The call burns the
+// pool's LP tokens from the Safe; it is debited in the pool's token with the
+// amount of the pool's RedeemLocal event, converted from shared decimals with
+// the pool's convertRate.
+func ResolveStargateBridge(runtime cre.Runtime, evmClient *evm.Client, logger *slog.Logger, action *Action, calldata []byte, txHash []byte) error {
+	reply, err := evmClient.GetTransactionReceipt(runtime, &evm.GetTransactionReceiptRequest{Hash: txHash}).Await()
+	if err != nil {
+		return fmt.Errorf("failed to get transaction receipt: %w", err)
+	}
+	if reply.Receipt == nil {
+		return fmt.Errorf("transaction receipt not found")
+	}
+	logs := reply.Receipt.Logs
+
+	safe, ok := moduleExecutor(logs)
+	if !ok {
+		return fmt.Errorf("no ExecutionFromModuleSuccess event in receipt")
+	}
+	amount := action.AssetsOut[0].Amount
+
+	// The pool burning the Safe's LP tokens gives the pool
+	var pool common.Address
+	found := false
+	for _, log := range logs {
+		if len(log.Topics) < 3 || len(log.Data) < 32 || !bytes.Equal(log.Topics[0], transferSignature.Bytes()) ||
+			common.BytesToAddress(log.Topics[1]) != safe || common.BytesToAddress(log.Topics[2]) != (common.Address{}) ||
+			new(big.Int).SetBytes(log.Data[:32]).Cmp(amount) != 0 {
+			continue
+		}
+		pool, found = common.BytesToAddress(log.Address), true
+		break
+	}
+	if !found {
+		return fmt.Errorf("no burn of %s LP tokens of the Safe %s in receipt", amount, safe.Hex())
+	}
+
+	var amountSD *big.Int
+	for _, log := range logs {
+		if common.BytesToAddress(log.Address) != pool || len(log.Topics) < 1 || len(log.Data) < 96 ||
+			!bytes.Equal(log.Topics[0], stargateRedeemLocalSignature.Bytes()) {
+			continue
+		}
+		if common.BytesToAddress(log.Data[:32]) == safe {
+			amountSD = new(big.Int).SetBytes(log.Data[64:96])
+			break
+		}
+	}
+	if amountSD == nil {
+		return fmt.Errorf("no RedeemLocal event of pool %s in receipt", pool.Hex())
+	}
+
+	underlying, err := GetStargatePoolToken(runtime, evmClient, pool)
+	if err != nil {
+		return err
+	}
+	value, err := callStargatePool(runtime, evmClient, pool, "convertRate")
+	if err != nil {
+		return err
+	}
+	convertRate, ok := value.(*big.Int)
+	if !ok {
+		return fmt.Errorf("unexpected convertRate result")
+	}
+
+	action.AssetsOut[0] = AssetAmount{Token: underlying, Amount: new(big.Int).Mul(amountSD, convertRate)}
+	logger.Info("Stargate LP redeemed on another chain", "pool", pool.Hex(), "amountLP", amount.String(),
+		"token", underlying.Hex(), "amount", action.AssetsOut[0].Amount.String())
+	return nil
+}
@@ -0,0 +1,214 @@
+//go:build wasip1
+
+package main
+
+import (
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// DeadLetter represents an event that could not be turned into an allowance update
+type DeadLetter struct {
+	TxHash        string
+	Module        string
+	SubAccount    string
+	Token         string
+	BalanceChange *big.Int
+	EventTime     time.Time
+	Reason        string
+	QueuedAt      time.Time
+	Attempts      int
+	Exhausted     bool
+}
+
+// WorkflowState holds the processing state shared between handlers. Every
+// trigger runs in its own workflow instance, so the state starts empty on each
+// execution: only the stored collections outlive it, and only when a
+// persistent store is configured.
+type WorkflowState struct {
+	DeadLetters       []DeadLetter
+	LastEventLatency  time.Duration
+	LastSubmissionAt  time.Time
+	FeedUpdatedAt     map[string]time.Time
+	ConsecutiveBreach int
+	Paused            bool
+	PausedReason      string
+	ModulePauses      map[string]*ModulePause
+	Degraded          bool
+	DegradedSince     time.Time
+	Batch             []BatchedUpdate
+
+	PreflightPassed  map[string]string
+	CodeHashVerified map[string]bool
+	ModuleStats      map[string]*ModuleStats
+	Migration        *MigrationState
+	DualWrite        *DualWriteStats
+	AuditLog         []map[string]string
+	Ledger           []LedgerEntry
+	LedgerAggregates []LedgerAggregate
+
+	SubaccountFailures map[string]int
+	HaltedSubaccounts  map[string]HaltedSubaccount
+
+	LeaseHolder    string
+	LeaseCheckedAt time.Time
+	LeaseExpiresAt time.Time
+	Shadow         []ShadowDecision
+
+	DecisionLog       []DecisionEntry
+	DecisionLogOffset uint64
+	DecisionHead      common.Hash
+
+	AccountingAnchoredEpoch uint64
+
+	AlertGroups map[string]*AlertGroup
+	Annotations map[string][]Annotation
+
+	WatchFlows []WatchFlow
+	NAVSeries  []NAVPoint
+	ABICache   map[string]CachedABI
+	Reviews    []ReviewItem
+
+	VaultAssets    map[string]common.Address
+	RegressionRuns []RegressionRun
+
+	Processed      map[string]time.Time
+	OwnUpdates     map[string]time.Time
+	PendingOrders  map[string]*PendingOrder
+	PriceCache     map[string]CachedPrice
+	Store          StateStore
+	StoreLoaded    bool
+	StoredDocument string
+	StoredVersion  string
+
+	GMXWithdrawals map[string]*PendingGMXWithdrawal
+
+	CachedValuations CachedValuationWindow
+
+	ScanCursors map[string]*ScanCursor
+	ScanBudget  ScanBudget
+	ConfigHash  string
+}
+
+// ModuleStats represents the submission outcomes for one module
+type ModuleStats struct {
+	Submitted     int
+	Failed        int
+	LastError     string
+	LastSuccessAt time.Time
+}
+
+// NewWorkflowState creates an empty workflow state
+func NewWorkflowState() *WorkflowState {
+	return &WorkflowState{
+		FeedUpdatedAt:    make(map[string]time.Time),
+		PreflightPassed:  make(map[string]string),
+		CodeHashVerified: make(map[string]bool),
+		ModuleStats:      make(map[string]*ModuleStats),
+		ModulePauses:     make(map[string]*ModulePause),
+
+		SubaccountFailures: make(map[string]int),
+		HaltedSubaccounts:  make(map[string]HaltedSubaccount),
+
+		AlertGroups: make(map[string]*AlertGroup),
+		Annotations: make(map[string][]Annotation),
+		ABICache:    make(map[string]CachedABI),
+		VaultAssets: make(map[string]common.Address),
+
+		Processed:     make(map[string]time.Time),
+		OwnUpdates:    make(map[string]time.Time),
+		PendingOrders: make(map[string]*PendingOrder),
+		PriceCache:    make(map[string]CachedPrice),
+		ScanCursors:   make(map[string]*ScanCursor),
+
+		GMXWithdrawals: make(map[string]*PendingGMXWithdrawal),
+	}
+}
+
+var state = NewWorkflowState()
+
+// RecordFeedUpdate stores the last update time seen for a token's price feed
+func (s *WorkflowState) RecordFeedUpdate(symbol string, updatedAt time.Time) {
+	s.FeedUpdatedAt[symbol] = updatedAt
+}
+
+// RecordSubmission stores the event-to-submission latency of a successful update
+func (s *WorkflowState) RecordSubmission(eventTime time.Time, submittedAt time.Time) {
+	s.LastEventLatency = submittedAt.Sub(eventTime)
+	s.LastSubmissionAt = submittedAt
+}
+
+// AddDeadLetter queues an event that failed processing, counting an attempt.
+// A letter taken off the queue for a retry comes back with its attempts.
+func (s *WorkflowState) AddDeadLetter(letter DeadLetter) {
+	for i := range s.DeadLetters {
+		if s.DeadLetters[i].TxHash == letter.TxHash && s.DeadLetters[i].Module == letter.Module && s.DeadLetters[i].Token == letter.Token {
+			s.DeadLetters[i].Attempts++
+			s.DeadLetters[i].Reason = letter.Reason
+			return
+		}
+	}
+	letter.Attempts++
+	s.DeadLetters = append(s.DeadLetters, letter)
+}
+
+// OldestFailedDeadLetter returns the oldest queued dead letter, if any,
+// leaving out the letters queued by a pause
+func (s *WorkflowState) OldestFailedDeadLetter() (*DeadLetter, bool) {
+	var oldest *DeadLetter
+	for i := range s.DeadLetters {
+		if strings.HasPrefix(s.DeadLetters[i].Reason, pausedReasonPrefix) {
+			continue
+		}
+		if oldest == nil || s.DeadLetters[i].QueuedAt.Before(oldest.QueuedAt) {
+			oldest = &s.DeadLetters[i]
+		}
+	}
+	return oldest, oldest != nil
+}
+
+// RemoveDeadLetter drops a dead letter once it has been handled. Token-native
+// letters of one transaction are told apart by their token.
+func (s *WorkflowState) RemoveDeadLetter(txHash string, module string, token string) {
+	for i := range s.DeadLetters {
+		if s.DeadLetters[i].TxHash == txHash && s.DeadLetters[i].Module == module && s.DeadLetters[i].Token == token {
+			s.DeadLetters = append(s.DeadLetters[:i], s.DeadLetters[i+1:]...)
+			return
+		}
+	}
+}
+
+// MarkDeadLetterExhausted flags a dead letter whose retries ran out. It
+// reports whether the letter was not flagged yet, so it is paged once.
+func (s *WorkflowState) MarkDeadLetterExhausted(txHash string, module string, token string) bool {
+	for i := range s.DeadLetters {
+		if s.DeadLetters[i].TxHash == txHash && s.DeadLetters[i].Module == module && s.DeadLetters[i].Token == token {
+			first := !s.DeadLetters[i].Exhausted
+			s.DeadLetters[i].Exhausted = true
+			return first
+		}
+	}
+	return false
+}
+
+// RecordModuleResult tracks the outcome of a submission to a module
+func (s *WorkflowState) RecordModuleResult(module string, err error, at time.Time) {
+	stats, ok := s.ModuleStats[module]
+	if !ok {
+		stats = &ModuleStats{}
+		s.ModuleStats[module] = stats
+	}
+
+	if err != nil {
+		stats.Failed++
+		stats.LastError = err.Error()
+		// The permissions may have changed, so the next submission checks them again
+		delete(s.PreflightPassed, module)
+		return
+	}
+	stats.Submitted++
+	stats.LastSuccessAt = at
+}
@@ -0,0 +1,777 @@
+//go:build wasip1
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/networking/http"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+)
+
+// State store backends
+const (
+	StoreMemory   = "memory"
+	StoreKV       = "kv"
+	StoreSQLite   = "sqlite"
+	StorePostgres = "postgres"
+)
+
+// processedRetention is how long processed events are remembered for deduplication
+const processedRetention = 7 * 24 * time.Hour
+
+// stateDocumentKey is the key of the one document holding the stored collections
+const stateDocumentKey = "state"
+
+// ErrStaleState is returned when the stored document changed since it was loaded
+var ErrStaleState = errors.New("state store document changed since it was loaded")
+
+// StoreConfig represents where the durable part of the workflow state is kept.
+// AuthSecret holds a bearer token for kv and sqlite, and the connection string
+// for postgres.
+type StoreConfig struct {
+	Backend    string `json:"backend"`
+	URL        string `json:"url,omitempty"`
+	AuthSecret string `json:"authSecret,omitempty"`
+	Namespace  string `json:"namespace,omitempty"`
+}
+
+// StateStore persists versioned JSON documents by key. Load returns the
+// version of the document, and Save only writes over that version, returning
+// the version it wrote: a document saved in between fails the write with
+// ErrStaleState. The version of a missing document is empty. Writing the same
+// value twice over a version succeeds, since every node of the DON sends the
+// same write.
+type StateStore interface {
+	Load(config *Config, runtime cre.Runtime, key string) (value string, version string, found bool, err error)
+	Save(config *Config, runtime cre.Runtime, key string, value string, version string) (newVersion string, err error)
+}
+
+// ValidateStore checks the state store configuration
+func ValidateStore(store *StoreConfig) error {
+	if store == nil {
+		return nil
+	}
+	switch store.Backend {
+	case "", StoreMemory:
+		return nil
+	case StoreKV, StoreSQLite, StorePostgres:
+	default:
+		return fmt.Errorf("unknown backend %q", store.Backend)
+	}
+	if !strings.HasPrefix(store.URL, "https://") {
+		return fmt.Errorf("url must be an https URL for the %s backend", store.Backend)
+	}
+	if store.Backend == StorePostgres && store.AuthSecret == "" {
+		return fmt.Errorf("authSecret with the connection string is required for the postgres backend")
+	}
+	return nil
+}
+
+// NewStateStore returns the configured backend, the workflow memory by default
+func NewStateStore(store *StoreConfig) StateStore {
+	if store == nil {
+		return memoryStore{}
+	}
+	switch store.Backend {
+	case StoreKV:
+		return &kvStore{url: strings.TrimSuffix(store.URL, "/"), authSecret: store.AuthSecret}
+	case StoreSQLite:
+		return &sqlStore{url: strings.TrimSuffix(store.URL, "/"), authSecret: store.AuthSecret, execute: libsqlExecute, placeholder: sqlitePlaceholder}
+	case StorePostgres:
+		return &sqlStore{url: strings.TrimSuffix(store.URL, "/"), authSecret: store.AuthSecret, execute: neonExecute, placeholder: postgresPlaceholder}
+	}
+	return memoryStore{}
+}
+
+// PersistentStore reports whether the state store outlives an execution. The
+// memory backend, the default, keeps nothing.
+func PersistentStore(config *Config) bool {
+	return config.Store != nil && config.Store.Backend != "" && config.Store.Backend != StoreMemory
+}
+
+// historyFeatures returns the enabled features that build on earlier
+// executions and so need a persistent store
+func historyFeatures(config *Config) []string {
+	var features []string
+	if config.SLA != nil && (config.SLA.Escalation.WarnAfter > 1 || config.SLA.Escalation.PageAfter > 1 || config.SLA.Escalation.PauseAfter > 1) {
+		features = append(features, "sla escalation")
+	}
+	if config.Failover != nil {
+		features = append(features, "failover")
+	}
+	if config.Alerts != nil && config.Alerts.GroupWindowSeconds > 0 {
+		features = append(features, "alert grouping")
+	}
+	if config.Admin != nil {
+		features = append(features, "admin API")
+	}
+	if config.Watch != nil {
+		features = append(features, "watch-only flows")
+	}
+	if config.Regression != nil {
+		features = append(features, "regression sampling")
+	}
+	if config.Retention != nil {
+		features = append(features, "retention")
+	}
+	if config.AllowanceEvents != nil {
+		features = append(features, "allowance events")
+	}
+	if config.GMX != nil {
+		features = append(features, "gmx withdrawals")
+	}
+	return features
+}
+
+// stateStore returns the configured store, created once per instance
+func stateStore(config *Config) StateStore {
+	if state.Store == nil {
+		state.Store = NewStateStore(config.Store)
+	}
+	return state.Store
+}
+
+// storeNamespace returns the namespace of the stored documents, the module
+// address by default. Each shard and failover instance keeps a document of
+// its own under it: shards sharing one would reject each other's saves on
+// every execution, and a standby sharing the leader's would mark the leader's
+// events processed before the leader sees them.
+func storeNamespace(config *Config) string {
+	namespace := strings.ToLower(config.ModuleAddress.Hex())
+	if config.Store != nil && config.Store.Namespace != "" {
+		namespace = strings.ToLower(config.Store.Namespace)
+	}
+	if config.Sharding != nil {
+		namespace += fmt.Sprintf("/shard-%d", config.Sharding.Index)
+	}
+	if config.Failover != nil {
+		namespace += "/" + config.Failover.InstanceID
+	}
+	return namespace
+}
+
+// storeKey prefixes a document key with the namespace
+func storeKey(config *Config, key string) string {
+	return storeNamespace(config) + "/" + key
+}
+
+// storeSecret returns the value of the store's auth secret, if any
+func storeSecret(runtime cre.Runtime, id string) (string, error) {
+	if id == "" {
+		return "", nil
+	}
+	secret, err := runtime.GetSecret(&cre.SecretRequest{Id: id}).Await()
+	if err != nil {
+		return "", fmt.Errorf("failed to get state store secret: %w", err)
+	}
+	return secret.Value, nil
+}
+
+// memoryStore keeps nothing outside the workflow memory, which lasts one execution
+type memoryStore struct{}
+
+// Load never finds a document
+func (memoryStore) Load(config *Config, runtime cre.Runtime, key string) (string, string, bool, error) {
+	return "", "", false, nil
+}
+
+// Save drops the document
+func (memoryStore) Save(config *Config, runtime cre.Runtime, key string, value string, version string) (string, error) {
+	return "", nil
+}
+
+// kvStore keeps documents in a key-value service: GET and PUT {url}/{key}.
+// The ETag of a document is its version, and writes are conditional on it
+// with If-Match, or If-None-Match for a new document.
+type kvStore struct {
+	url        string
+	authSecret string
+}
+
+// kvDocument represents a document read from the key-value service
+type kvDocument struct {
+	Found   bool
+	Value   string
+	Version string
+}
+
+// Load reads a document, a 404 meaning it was never saved
+func (s *kvStore) Load(config *Config, runtime cre.Runtime, key string) (string, string, bool, error) {
+	token, err := storeSecret(runtime, s.authSecret)
+	if err != nil {
+		return "", "", false, err
+	}
+
+	// The document is returned JSON encoded so nodes agree on whether it was found
+	encoded, err := http.SendRequest(config, runtime, &http.Client{},
+		func(config *Config, logger *slog.Logger, sendRequester *http.SendRequester) (string, error) {
+			doc, err := s.get(sendRequester, token, storeKey(config, key))
+			if err != nil {
+				return "", err
+			}
+			body, err := json.Marshal(doc)
+			return string(body), err
+		},
+		cre.ConsensusIdenticalAggregation[string](),
+	).Await()
+	if err != nil {
+		return "", "", false, err
+	}
+
+	var doc kvDocument
+	if err := json.Unmarshal([]byte(encoded), &doc); err != nil {
+		return "", "", false, fmt.Errorf("failed to decode state store document: %w", err)
+	}
+	return doc.Value, doc.Version, doc.Found, nil
+}
+
+// get reads a document and its ETag
+func (s *kvStore) get(sendRequester *http.SendRequester, token string, key string) (kvDocument, error) {
+	resp, err := sendRequester.SendRequest(&http.Request{
+		Url:     s.url + "/" + url.PathEscape(key),
+		Method:  "GET",
+		Headers: bearerHeaders(token),
+	}).Await()
+	if err != nil {
+		return kvDocument{}, fmt.Errorf("failed to call state store: %w", err)
+	}
+	switch resp.StatusCode {
+	case 200:
+	case 404:
+		return kvDocument{}, nil
+	default:
+		return kvDocument{}, fmt.Errorf("state store returned status %d", resp.StatusCode)
+	}
+	version := responseHeader(resp, "ETag")
+	if version == "" {
+		return kvDocument{}, fmt.Errorf("state store returned no ETag")
+	}
+	return kvDocument{Found: true, Value: string(resp.Body), Version: version}, nil
+}
+
+// Save writes a document over the version it was loaded at. A 412 is a
+// conflict, unless another node already wrote the same value. The new version
+// is the ETag of the response, or read back when the service returns none.
+func (s *kvStore) Save(config *Config, runtime cre.Runtime, key string, value string, version string) (string, error) {
+	token, err := storeSecret(runtime, s.authSecret)
+	if err != nil {
+		return "", err
+	}
+
+	saved, err := http.SendRequest(config, runtime, &http.Client{},
+		func(config *Config, logger *slog.Logger, sendRequester *http.SendRequester) (string, error) {
+			headers := bearerHeaders(token)
+			headers["Content-Type"] = "application/json"
+			if version == "" {
+				headers["If-None-Match"] = "*"
+			} else {
+				headers["If-Match"] = version
+			}
+			resp, err := sendRequester.SendRequest(&http.Request{
+				Url:     s.url + "/" + url.PathEscape(storeKey(config, key)),
+				Method:  "PUT",
+				Headers: headers,
+				Body:    []byte(value),
+			}).Await()
+			if err != nil {
+				return "", fmt.Errorf("failed to call state store: %w", err)
+			}
+			if resp.StatusCode != 412 && (resp.StatusCode < 200 || resp.StatusCode >= 300) {
+				return "", fmt.Errorf("state store returned status %d", resp.StatusCode)
+			}
+			if etag := responseHeader(resp, "ETag"); etag != "" && resp.StatusCode != 412 {
+				return etag, nil
+			}
+			current, err := s.get(sendRequester, token, storeKey(config, key))
+			if err != nil {
+				return "", err
+			}
+			if !current.Found || current.Value != value {
+				return "", ErrStaleState
+			}
+			return current.Version, nil
+		},
+		cre.ConsensusIdenticalAggregation[string](),
+	).Await()
+	if err != nil && strings.Contains(err.Error(), ErrStaleState.Error()) {
+		return "", ErrStaleState
+	}
+	return saved, err
+}
+
+// responseHeader returns a response header whatever the case of its name
+func responseHeader(resp *http.Response, name string) string {
+	for key, value := range resp.Headers {
+		if strings.EqualFold(key, name) {
+			return value
+		}
+	}
+	return ""
+}
+
+// bearerHeaders returns the JSON request headers with an optional bearer token
+func bearerHeaders(token string) map[string]string {
+	headers := map[string]string{"Accept": "application/json"}
+	if token != "" {
+		headers["Authorization"] = "Bearer " + token
+	}
+	return headers
+}
+
+// sqlExecutor runs one statement over HTTP and returns the first column of each row
+type sqlExecutor func(sendRequester *http.SendRequester, baseURL string, secret string, statement string, args []string) ([]string, error)
+
+// sqlStore keeps documents in a workflow_documents table, created on first
+// use. Each row has a version counting its saves.
+type sqlStore struct {
+	url         string
+	authSecret  string
+	execute     sqlExecutor
+	placeholder func(i int) string
+	ready       bool
+}
+
+// exec runs a statement and returns the first column of each row
+func (s *sqlStore) exec(config *Config, runtime cre.Runtime, statement string, args ...string) ([]string, error) {
+	secret, err := storeSecret(runtime, s.authSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	if !s.ready {
+		create := "CREATE TABLE IF NOT EXISTS workflow_documents (key TEXT PRIMARY KEY, value TEXT NOT NULL, version BIGINT NOT NULL)"
+		if _, err := s.send(config, runtime, secret, create, nil); err != nil {
+			return nil, fmt.Errorf("failed to create state table: %w", err)
+		}
+		s.ready = true
+	}
+	return s.send(config, runtime, secret, statement, args)
+}
+
+// send runs one statement with consensus on its rows
+func (s *sqlStore) send(config *Config, runtime cre.Runtime, secret string, statement string, args []string) ([]string, error) {
+	encoded, err := http.SendRequest(config, runtime, &http.Client{},
+		func(config *Config, logger *slog.Logger, sendRequester *http.SendRequester) (string, error) {
+			rows, err := s.execute(sendRequester, s.url, secret, statement, args)
+			if err != nil {
+				return "", err
+			}
+			body, err := json.Marshal(rows)
+			return string(body), err
+		},
+		cre.ConsensusIdenticalAggregation[string](),
+	).Await()
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []string
+	if err := json.Unmarshal([]byte(encoded), &rows); err != nil {
+		return nil, fmt.Errorf("failed to decode state store rows: %w", err)
+	}
+	return rows, nil
+}
+
+// Load reads a document with its version, selected as "version:value" since
+// the executors return one column
+func (s *sqlStore) Load(config *Config, runtime cre.Runtime, key string) (string, string, bool, error) {
+	statement := "SELECT CAST(version AS TEXT) || ':' || value AS value FROM workflow_documents WHERE key = " + s.placeholder(1)
+	rows, err := s.exec(config, runtime, statement, storeKey(config, key))
+	if err != nil {
+		return "", "", false, err
+	}
+	if len(rows) == 0 {
+		return "", "", false, nil
+	}
+	version, value, ok := strings.Cut(rows[0], ":")
+	if !ok {
+		return "", "", false, fmt.Errorf("malformed state store row")
+	}
+	return value, version, true, nil
+}
+
+// Save upserts a document over the version it was loaded at. The update only
+// applies to that version, or to the same value already written by another
+// node; otherwise no row is returned.
+func (s *sqlStore) Save(config *Config, runtime cre.Runtime, key string, value string, version string) (string, error) {
+	var current uint64
+	if version != "" {
+		if _, err := fmt.Sscan(version, &current); err != nil {
+			return "", fmt.Errorf("malformed state store version %q", version)
+		}
+	}
+	statement := fmt.Sprintf("INSERT INTO workflow_documents (key, value, version) VALUES (%s, %s, %s) "+
+		"ON CONFLICT (key) DO UPDATE SET value = excluded.value, version = excluded.version "+
+		"WHERE workflow_documents.version = %s OR (workflow_documents.version = excluded.version AND workflow_documents.value = excluded.value) "+
+		"RETURNING key",
+		s.placeholder(1), s.placeholder(2), s.placeholder(3), s.placeholder(4))
+	rows, err := s.exec(config, runtime, statement, storeKey(config, key), value, fmt.Sprint(current+1), fmt.Sprint(current))
+	if err != nil {
+		return "", err
+	}
+	if len(rows) == 0 {
+		return "", ErrStaleState
+	}
+	return fmt.Sprint(current + 1), nil
+}
+
+// sqlitePlaceholder returns the positional parameter syntax of SQLite
+func sqlitePlaceholder(i int) string {
+	return "?"
+}
+
+// postgresPlaceholder returns the positional parameter syntax of Postgres
+func postgresPlaceholder(i int) string {
+	return fmt.Sprintf("$%d", i)
+}
+
+// libsqlPipeline represents the response of a libSQL server's /v2/pipeline endpoint
+type libsqlPipeline struct {
+	Results []struct {
+		Type     string `json:"type"`
+		Response struct {
+			Result struct {
+				Rows [][]struct {
+					Type  string  `json:"type"`
+					Value *string `json:"value"`
+				} `json:"rows"`
+			} `json:"result"`
+		} `json:"response"`
+		Error *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	} `json:"results"`
+}
+
+// libsqlExecute runs a statement on a SQLite database served by libSQL (sqld, Turso)
+func libsqlExecute(sendRequester *http.SendRequester, baseURL string, secret string, statement string, args []string) ([]string, error) {
+	type arg struct {
+		Type  string `json:"type"`
+		Value string `json:"value"`
+	}
+	stmtArgs := make([]arg, len(args))
+	for i, a := range args {
+		stmtArgs[i] = arg{Type: "text", Value: a}
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"requests": []interface{}{
+			map[string]interface{}{"type": "execute", "stmt": map[string]interface{}{"sql": statement, "args": stmtArgs}},
+			map[string]interface{}{"type": "close"},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode SQLite request: %w", err)
+	}
+
+	headers := bearerHeaders(secret)
+	headers["Content-Type"] = "application/json"
+	resp, err := sendRequester.SendRequest(&http.Request{
+		Url:     baseURL + "/v2/pipeline",
+		Method:  "POST",
+		Headers: headers,
+		Body:    body,
+	}).Await()
+	if err != nil {
+		return nil, fmt.Errorf("failed to call SQLite server: %w", err)
+	}
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("SQLite server returned status %d", resp.StatusCode)
+	}
+
+	var pipeline libsqlPipeline
+	if err := json.Unmarshal(resp.Body, &pipeline); err != nil {
+		return nil, fmt.Errorf("failed to decode SQLite response: %w", err)
+	}
+	if len(pipeline.Results) == 0 {
+		return nil, fmt.Errorf("empty SQLite response")
+	}
+	result := pipeline.Results[0]
+	if result.Error != nil {
+		return nil, fmt.Errorf("SQLite error: %s", result.Error.Message)
+	}
+
+	var rows []string
+	for _, row := range result.Response.Result.Rows {
+		if len(row) > 0 && row[0].Value != nil {
+			rows = append(rows, *row[0].Value)
+		}
+	}
+	return rows, nil
+}
+
+// neonResponse represents the response of a Postgres SQL-over-HTTP endpoint
+type neonResponse struct {
+	Rows []map[string]*string `json:"rows"`
+}
+
+// neonExecute runs a statement on Postgres through a SQL-over-HTTP endpoint
+// (Neon's /sql), with the connection string as the secret
+func neonExecute(sendRequester *http.SendRequester, baseURL string, secret string, statement string, args []string) ([]string, error) {
+	if args == nil {
+		args = []string{}
+	}
+	body, err := json.Marshal(map[string]interface{}{"query": statement, "params": args})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode Postgres request: %w", err)
+	}
+
+	resp, err := sendRequester.SendRequest(&http.Request{
+		Url:    baseURL + "/sql",
+		Method: "POST",
+		Headers: map[string]string{
+			"Content-Type":           "application/json",
+			"Neon-Connection-String": secret,
+		},
+		Body: body,
+	}).Await()
+	if err != nil {
+		return nil, fmt.Errorf("failed to call Postgres endpoint: %w", err)
+	}
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("Postgres endpoint returned status %d", resp.StatusCode)
+	}
+
+	var result neonResponse
+	if err := json.Unmarshal(resp.Body, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode Postgres response: %w", err)
+	}
+
+	var rows []string
+	for _, row := range result.Rows {
+		if value := row["value"]; value != nil {
+			rows = append(rows, *value)
+		}
+	}
+	return rows, nil
+}
+
+// storedCollections returns the parts of the state kept in the state store
+func (s *WorkflowState) storedCollections() map[string]interface{} {
+	return map[string]interface{}{
+		"processed":      &s.Processed,
+		"ownUpdates":     &s.OwnUpdates,
+		"pendingOrders":  &s.PendingOrders,
+		"gmxWithdrawals": &s.GMXWithdrawals,
+		"priceCache":     &s.PriceCache,
+		"ledger":         &s.Ledger,
+		"ledgerDaily":    &s.LedgerAggregates,
+		"nav":            &s.NAVSeries,
+		"deadLetters":    &s.DeadLetters,
+		"pauses":         &s.ModulePauses,
+		"batch":          &s.Batch,
+		"degraded":       &s.Degraded,
+		"degradedSince":  &s.DegradedSince,
+		"migration":      &s.Migration,
+		"scanCursors":    &s.ScanCursors,
+		"scanBudget":     &s.ScanBudget,
+		"dualWrite":      &s.DualWrite,
+		"configHash":     &s.ConfigHash,
+		"preflight":      &s.PreflightPassed,
+
+		"feedUpdatedAt":     &s.FeedUpdatedAt,
+		"lastEventLatency":  &s.LastEventLatency,
+		"lastSubmissionAt":  &s.LastSubmissionAt,
+		"consecutiveBreach": &s.ConsecutiveBreach,
+		"paused":            &s.Paused,
+		"pausedReason":      &s.PausedReason,
+
+		"auditLog":          &s.AuditLog,
+		"decisionLog":       &s.DecisionLog,
+		"decisionLogOffset": &s.DecisionLogOffset,
+		"decisionHead":      &s.DecisionHead,
+
+		"accountingAnchoredEpoch": &s.AccountingAnchoredEpoch,
+
+		"alertGroups": &s.AlertGroups,
+		"annotations": &s.Annotations,
+		"reviews":     &s.Reviews,
+		"watchFlows":  &s.WatchFlows,
+
+		"regressionRuns": &s.RegressionRuns,
+
+		"cachedValuations": &s.CachedValuations,
+
+		"subaccountFailures": &s.SubaccountFailures,
+		"haltedSubaccounts":  &s.HaltedSubaccounts,
+
+		"leaseHolder":    &s.LeaseHolder,
+		"leaseCheckedAt": &s.LeaseCheckedAt,
+		"leaseExpiresAt": &s.LeaseExpiresAt,
+		"shadow":         &s.Shadow,
+	}
+}
+
+// LoadState reads the stored document into the workflow memory before each
+// run. The collections are decoded again only when the document changed since
+// this instance last read or saved it, and collections missing from it keep
+// their current value.
+func LoadState(config *Config, runtime cre.Runtime) error {
+	store := stateStore(config)
+	loaded := state.StoreLoaded
+	state.StoreLoaded = false
+
+	value, version, found, err := store.Load(config, runtime, stateDocumentKey)
+	if err != nil {
+		return fmt.Errorf("failed to load state: %w", err)
+	}
+	if found && !(loaded && version == state.StoredVersion) {
+		var document map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(value), &document); err != nil {
+			return fmt.Errorf("failed to decode state: %w", err)
+		}
+		for key, collection := range state.storedCollections() {
+			raw, ok := document[key]
+			if !ok {
+				continue
+			}
+			// Reset first so stored maps replace the current ones instead of merging
+			target := reflect.ValueOf(collection).Elem()
+			target.Set(reflect.Zero(target.Type()))
+			if err := json.Unmarshal(raw, collection); err != nil {
+				return fmt.Errorf("failed to decode %s: %w", key, err)
+			}
+		}
+	}
+	state.StoredDocument = value
+	state.StoredVersion = version
+
+	if state.Processed == nil {
+		state.Processed = make(map[string]time.Time)
+	}
+	if state.OwnUpdates == nil {
+		state.OwnUpdates = make(map[string]time.Time)
+	}
+	if state.PendingOrders == nil {
+		state.PendingOrders = make(map[string]*PendingOrder)
+	}
+	if state.GMXWithdrawals == nil {
+		state.GMXWithdrawals = make(map[string]*PendingGMXWithdrawal)
+	}
+	if state.PriceCache == nil {
+		state.PriceCache = make(map[string]CachedPrice)
+	}
+	if state.ModulePauses == nil {
+		state.ModulePauses = make(map[string]*ModulePause)
+	}
+	if state.FeedUpdatedAt == nil {
+		state.FeedUpdatedAt = make(map[string]time.Time)
+	}
+	if state.Annotations == nil {
+		state.Annotations = make(map[string][]Annotation)
+	}
+	if state.AlertGroups == nil {
+		state.AlertGroups = make(map[string]*AlertGroup)
+	}
+	if state.PreflightPassed == nil {
+		state.PreflightPassed = make(map[string]string)
+	}
+	if state.SubaccountFailures == nil {
+		state.SubaccountFailures = make(map[string]int)
+	}
+	if state.HaltedSubaccounts == nil {
+		state.HaltedSubaccounts = make(map[string]HaltedSubaccount)
+	}
+
+	state.StoreLoaded = true
+	return nil
+}
+
+// PersistState saves the stored collections as one document when they changed
+// since the load, over the version that was loaded or last saved. Nothing is
+// saved before the store was loaded, so a failed load never overwrites the
+// stored state. A save that finds a newer document fails with ErrStaleState
+// and marks the state unloaded, so the next run decodes the stored document
+// again.
+func PersistState(config *Config, runtime cre.Runtime) error {
+	if !state.StoreLoaded {
+		return nil
+	}
+	store := stateStore(config)
+
+	// Map keys are sorted when encoded, so every node writes the same document
+	encoded, err := json.Marshal(state.storedCollections())
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %w", err)
+	}
+	value := string(encoded)
+	if value == state.StoredDocument {
+		return nil
+	}
+	version, err := store.Save(config, runtime, stateDocumentKey, value, state.StoredVersion)
+	if err != nil {
+		state.StoreLoaded = false
+		return fmt.Errorf("failed to save state: %w", err)
+	}
+	state.StoredDocument = value
+	state.StoredVersion = version
+	return nil
+}
+
+// CheckpointState saves the state before a report is written. The events and
+// ledger entries the update accounts for are then stored before it is on
+// chain, so a save failing after the write cannot replay them into a second
+// update; it can only lose what the execution recorded after the write. A
+// persistent store that is not loaded, after a failed load or save, fails the
+// checkpoint and so the write.
+func CheckpointState(config *Config, runtime cre.Runtime) error {
+	if !state.StoreLoaded && PersistentStore(config) {
+		return fmt.Errorf("state not loaded: %w", ErrStaleState)
+	}
+	return PersistState(config, runtime)
+}
+
+// withStateStore wraps a handler so the stored document is loaded before it
+// runs and saved after. With a persistent store, a failed load skips the
+// handler: running it on an empty state would replay processed events and
+// lose halts and pauses. Only the memory backend runs on the fresh state.
+func withStateStore[T any](handler func(*Config, cre.Runtime, T) (*ExecutionResult, error)) func(*Config, cre.Runtime, T) (*ExecutionResult, error) {
+	return func(config *Config, runtime cre.Runtime, payload T) (*ExecutionResult, error) {
+		if err := LoadState(config, runtime); err != nil {
+			RaiseAlert(config, runtime, slog.LevelError, "ALERT: state store unavailable", "load", "error", err.Error())
+			if PersistentStore(config) {
+				return nil, err
+			}
+		}
+		CheckConfigHash(config, runtime)
+
+		result, err := handler(config, runtime, payload)
+
+		if persistErr := PersistState(config, runtime); persistErr != nil {
+			RaiseAlert(config, runtime, slog.LevelError, "ALERT: state store unavailable", "save", "error", persistErr.Error())
+			if err == nil {
+				err = persistErr
+			}
+		}
+		return result, err
+	}
+}
+
+// eventKey identifies a log for deduplication
+func eventKey(txHash string, logIndex uint32) string {
+	return fmt.Sprintf("%s:%d", strings.ToLower(txHash), logIndex)
+}
+
+// HasProcessed reports whether an event was already accounted for
+func (s *WorkflowState) HasProcessed(key string) bool {
+	_, ok := s.Processed[key]
+	return ok
+}
+
+// MarkProcessed records an event as accounted for and forgets old ones
+func (s *WorkflowState) MarkProcessed(key string, at time.Time) {
+	for k, processedAt := range s.Processed {
+		if at.Sub(processedAt) > processedRetention {
+			delete(s.Processed, k)
+		}
+	}
+	s.Processed[key] = at
+}
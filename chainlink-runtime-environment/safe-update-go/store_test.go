@@ -0,0 +1,222 @@
+//go:build wasip1
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+	"github.com/smartcontractkit/cre-sdk-go/cre/testutils"
+
+	"safe-update-go/scenarios"
+)
+
+// mapStore is a state store kept in a map, shared by the instances of a test.
+// Documents are keyed in their namespace, and the version of a document
+// counts its saves.
+type mapStore map[string]mapDocument
+
+// mapDocument represents a saved document and its version
+type mapDocument struct {
+	Value   string
+	Version int
+}
+
+// Load returns the saved document of a key
+func (m mapStore) Load(config *Config, runtime cre.Runtime, key string) (string, string, bool, error) {
+	doc, found := m[storeKey(config, key)]
+	if !found {
+		return "", "", false, nil
+	}
+	return doc.Value, strconv.Itoa(doc.Version), true, nil
+}
+
+// Save keeps the document of a key if it was not saved since the given version
+func (m mapStore) Save(config *Config, runtime cre.Runtime, key string, value string, version string) (string, error) {
+	key = storeKey(config, key)
+	doc, found := m[key]
+	current := ""
+	if found {
+		current = strconv.Itoa(doc.Version)
+	}
+	if current != version {
+		return "", ErrStaleState
+	}
+	m[key] = mapDocument{Value: value, Version: doc.Version + 1}
+	return strconv.Itoa(doc.Version + 1), nil
+}
+
+// touch saves a document again unchanged, as an overlapping execution would
+func (m mapStore) touch(config *Config, key string) {
+	key = storeKey(config, key)
+	doc := m[key]
+	m[key] = mapDocument{Value: doc.Value, Version: doc.Version + 1}
+}
+
+// failingStore is a state store that cannot be reached
+type failingStore struct{}
+
+// Load fails
+func (failingStore) Load(config *Config, runtime cre.Runtime, key string) (string, string, bool, error) {
+	return "", "", false, errors.New("unreachable")
+}
+
+// Save fails
+func (failingStore) Save(config *Config, runtime cre.Runtime, key string, value string, version string) (string, error) {
+	return "", errors.New("unreachable")
+}
+
+// TestStaleSaveRejected runs two overlapping executions from the same stored
+// document: the second save must not drop the events of the first
+func TestStaleSaveRejected(t *testing.T) {
+	config := scenarioConfig(t, "{}")
+	runtime := testutils.NewRuntime(t, nil)
+	store := mapStore{}
+
+	load := func() *WorkflowState {
+		t.Helper()
+		state = NewWorkflowState()
+		state.Store = store
+		if err := LoadState(config, runtime); err != nil {
+			t.Fatalf("load state: %v", err)
+		}
+		return state
+	}
+
+	first, second := load(), load()
+	at := runtime.Now()
+
+	state = first
+	state.MarkProcessed("0xaa:1", at)
+	if err := PersistState(config, runtime); err != nil {
+		t.Fatalf("persist first: %v", err)
+	}
+
+	state = second
+	state.MarkProcessed("0xbb:1", at)
+	if err := PersistState(config, runtime); !errors.Is(err, ErrStaleState) {
+		t.Fatalf("stale save: got %v, want ErrStaleState", err)
+	}
+
+	load()
+	if !state.HasProcessed("0xaa:1") {
+		t.Errorf("first execution's event lost")
+	}
+	if state.HasProcessed("0xbb:1") {
+		t.Errorf("stale execution's event saved")
+	}
+}
+
+// TestSaveAfterWriteRejected races another execution's save with the write of
+// an update: the save at the end of the execution is rejected, but the state
+// checkpointed before the write keeps the replayed event from being credited
+// again
+func TestSaveAfterWriteRejected(t *testing.T) {
+	config := scenarioConfig(t, "{}")
+	runtime, chain := newScenarioChain(t, config)
+	store := mapStore{}
+	chain.onWrite = func() { store.touch(config, stateDocumentKey) }
+
+	payload := chain.protocolExecuted(t.Name(), scenarios.Pool,
+		scenarios.AaveWithdraw(scenarios.Token, scenarios.USD(1000), scenarios.Safe), runtime.now)
+	for replay := 0; replay < 2; replay++ {
+		state = NewWorkflowState()
+		state.Store = store
+		_, err := withStateStore(OnProtocolExecuted)(config, runtime, payload)
+		if replay == 0 && !errors.Is(err, ErrStaleState) {
+			t.Fatalf("save after the write: got %v, want ErrStaleState", err)
+		}
+	}
+	if chain.writes != 1 {
+		t.Errorf("%d updates written for one event, want 1", chain.writes)
+	}
+}
+
+// TestPersistentStoreRequiresRetention checks that a persistent store is
+// refused without an audit log bound
+func TestPersistentStoreRequiresRetention(t *testing.T) {
+	config := scenarioConfig(t, "{}")
+	config.Store = &StoreConfig{Backend: StoreKV, URL: "https://state.invalid"}
+	if err := ValidateConfig(config); err == nil || !strings.Contains(err.Error(), "auditDays is required") {
+		t.Fatalf("store without retention: got %v", err)
+	}
+	config.Retention = &RetentionConfig{Schedule: "0 30 2 * * *", AuditDays: 365}
+	if err := ValidateConfig(config); err != nil {
+		t.Fatalf("store with retention: %v", err)
+	}
+}
+
+// TestShardsSaveIndependently runs overlapping executions of two shards of
+// one module: each shard keeps its own document, so neither save is stale
+func TestShardsSaveIndependently(t *testing.T) {
+	runtime := testutils.NewRuntime(t, nil)
+	store := mapStore{}
+
+	shards := make([]*Config, 2)
+	states := make([]*WorkflowState, 2)
+	for i := range shards {
+		config := *scenarioConfig(t, "{}")
+		config.Sharding = &ShardingConfig{Count: 2, Index: uint64(i)}
+		shards[i] = &config
+
+		state = NewWorkflowState()
+		state.Store = store
+		if err := LoadState(shards[i], runtime); err != nil {
+			t.Fatalf("load shard %d: %v", i, err)
+		}
+		states[i] = state
+	}
+	if storeNamespace(shards[0]) == storeNamespace(shards[1]) {
+		t.Fatalf("shards share namespace %s", storeNamespace(shards[0]))
+	}
+
+	for i, config := range shards {
+		state = states[i]
+		state.MarkProcessed(fmt.Sprintf("0x%02x:1", i), runtime.Now())
+		if err := PersistState(config, runtime); err != nil {
+			t.Fatalf("persist shard %d: %v", i, err)
+		}
+	}
+}
+
+// TestLoadFailureSkipsHandler checks that a persistent store that cannot be
+// read stops the handler instead of running it on an empty state
+func TestLoadFailureSkipsHandler(t *testing.T) {
+	config := scenarioConfig(t, "{}")
+	runtime := testutils.NewRuntime(t, nil)
+
+	ran := false
+	handler := withStateStore(func(config *Config, runtime cre.Runtime, payload struct{}) (*ExecutionResult, error) {
+		ran = true
+		return &ExecutionResult{}, nil
+	})
+
+	tests := []struct {
+		name    string
+		store   *StoreConfig
+		wantRun bool
+	}{
+		{"persistent store", &StoreConfig{Backend: StoreKV, URL: "https://state.invalid"}, false},
+		{"memory store", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.Store = tt.store
+			state = NewWorkflowState()
+			state.Store = failingStore{}
+			ran = false
+
+			_, err := handler(config, runtime, struct{}{})
+			if ran != tt.wantRun {
+				t.Errorf("handler ran %v, want %v", ran, tt.wantRun)
+			}
+			if (err != nil) == tt.wantRun {
+				t.Errorf("error %v", err)
+			}
+		})
+	}
+}
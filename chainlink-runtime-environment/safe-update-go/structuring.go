@@ -0,0 +1,135 @@
+//go:build wasip1
+
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"safe-update-go/fixedpoint"
+)
+
+// Structuring detection defaults
+const (
+	defaultStructuringNearPercent = 80
+	defaultStructuringMinCount    = 3
+)
+
+// StructuringConfig represents the detection of withdrawals split just below
+// a per-transaction threshold. Actions worth between nearPercent and 100% of
+// the threshold are near it; minCount of them by one subaccount within the
+// window, together worth more than the threshold, are escalated as if they
+// were one withdrawal above it.
+type StructuringConfig struct {
+	Verb          Verb   `json:"verb,omitempty"`
+	ThresholdUSD  uint64 `json:"thresholdUsd"`
+	NearPercent   uint64 `json:"nearPercent,omitempty"`
+	WindowSeconds uint64 `json:"windowSeconds"`
+	MinCount      uint64 `json:"minCount,omitempty"`
+	Response      string `json:"response,omitempty"`
+}
+
+// Structuring represents a sequence of near-threshold actions of a subaccount,
+// the current one included, worth more than the threshold together
+type Structuring struct {
+	Count        int
+	TotalUSD     *big.Int
+	ThresholdUSD *big.Int
+}
+
+// ValidateStructuring checks the structuring detector configuration
+func ValidateStructuring(structuring *StructuringConfig) error {
+	if structuring == nil {
+		return nil
+	}
+	if structuring.ThresholdUSD == 0 || structuring.WindowSeconds == 0 {
+		return fmt.Errorf("thresholdUsd and windowSeconds are required")
+	}
+	if structuring.NearPercent > 100 {
+		return fmt.Errorf("nearPercent must be at most 100")
+	}
+	if structuring.MinCount == 1 {
+		return fmt.Errorf("minCount must be at least 2")
+	}
+	switch structuring.Response {
+	case "", AnomalyAlert, AnomalyReview, AnomalyReject:
+	default:
+		return fmt.Errorf("unknown response %q", structuring.Response)
+	}
+	return nil
+}
+
+// verb returns the verb of the actions the detector watches
+func (c *StructuringConfig) verb() Verb {
+	if c.Verb == "" {
+		return VerbWithdraw
+	}
+	return c.Verb
+}
+
+// minCount returns how many near-threshold actions make a sequence
+func (c *StructuringConfig) minCount() int {
+	if c.MinCount == 0 {
+		return defaultStructuringMinCount
+	}
+	return int(c.MinCount)
+}
+
+// response returns what is done with a structured sequence
+func (c *StructuringConfig) response() string {
+	if c.Response == "" {
+		return AnomalyReview
+	}
+	return c.Response
+}
+
+// nearThreshold reports whether a value is just below the threshold
+func (c *StructuringConfig) nearThreshold(value *big.Int) bool {
+	threshold := fixedpoint.FromWhole(c.ThresholdUSD, fixedpoint.USDDecimals)
+	nearPercent := c.NearPercent
+	if nearPercent == 0 {
+		nearPercent = defaultStructuringNearPercent
+	}
+	return value.Cmp(threshold) <= 0 && value.Cmp(fixedpoint.Percent(threshold, nearPercent, fixedpoint.RoundUp)) >= 0
+}
+
+// DetectStructuring returns the sequence an action completes when it is near
+// the threshold and the subaccount's near-threshold actions of the same verb
+// within the window, this one included, are at least minCount and together
+// worth more than the threshold. It returns nil otherwise.
+func DetectStructuring(policy *PolicyConfig, s *WorkflowState, subAccount string, action *Action, grossUSD *big.Int, now time.Time) *Structuring {
+	if policy == nil || policy.Structuring == nil {
+		return nil
+	}
+	config := policy.Structuring
+	if action.Verb != config.verb() || !config.nearThreshold(grossUSD) {
+		return nil
+	}
+
+	since := now.Add(-seconds(config.WindowSeconds))
+	sequence := &Structuring{
+		Count:        1,
+		TotalUSD:     new(big.Int).Set(grossUSD),
+		ThresholdUSD: fixedpoint.FromWhole(config.ThresholdUSD, fixedpoint.USDDecimals),
+	}
+	for _, entry := range s.Ledger {
+		if entry.At.Before(since) || entry.At.After(now) || entry.Verb != config.verb() || !strings.EqualFold(entry.SubAccount, subAccount) {
+			continue
+		}
+		if config.nearThreshold(entry.GrossUSD) {
+			sequence.Count++
+			sequence.TotalUSD.Add(sequence.TotalUSD, entry.GrossUSD)
+		}
+	}
+	if sequence.Count < config.minCount() || sequence.TotalUSD.Cmp(sequence.ThresholdUSD) <= 0 {
+		return nil
+	}
+	return sequence
+}
+
+// Reason describes the sequence for logs, alerts and review reasons
+func (s *Structuring) Reason() string {
+	return fmt.Sprintf("structured: %d actions just below %s USD worth %s USD together", s.Count, usdWhole(s.ThresholdUSD), usdWhole(s.TotalUSD))
+}
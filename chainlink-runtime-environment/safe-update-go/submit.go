@@ -0,0 +1,230 @@
+//go:build wasip1
+
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/blockchain/evm"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+)
+
+// Submission modes
+const (
+	// SubmissionModeProxy writes reports to the CRE proxy, which calls the module
+	SubmissionModeProxy = "proxy"
+
+	// SubmissionModeDirect writes reports straight to the module, whose
+	// authorized updater is the workflow's forwarder. The forwarder delivers
+	// reports through onReport, so the module must implement IReceiver.
+	SubmissionModeDirect = "direct"
+)
+
+// receiverABI is the ERC-165 query of report receivers
+const receiverABI = `[{"constant":true,"inputs":[{"name":"interfaceId","type":"bytes4"}],"name":"supportsInterface","outputs":[{"name":"","type":"bool"}],"type":"function"}]`
+
+// receiverInterfaceID is the ERC-165 id of IReceiver, whose only function is
+// onReport(bytes metadata, bytes report)
+var receiverInterfaceID = [4]byte(crypto.Keccak256([]byte("onReport(bytes,bytes)"))[:4])
+
+// submissionMode returns the configured submission mode, defaulting to proxy
+func submissionMode(config *Config) string {
+	if config.SubmissionMode == "" {
+		return SubmissionModeProxy
+	}
+	return config.SubmissionMode
+}
+
+// submissionReceiver returns the address reports are written to
+func submissionReceiver(config *Config) (common.Address, error) {
+	switch submissionMode(config) {
+	case SubmissionModeProxy:
+		if !config.ProxyAddress.IsSet() {
+			return common.Address{}, fmt.Errorf("proxyAddress is required in %s submission mode", SubmissionModeProxy)
+		}
+		return config.ProxyAddress.Address, nil
+	case SubmissionModeDirect:
+		return config.ModuleAddress.Address, nil
+	default:
+		return common.Address{}, fmt.Errorf("unknown submission mode %q", config.SubmissionMode)
+	}
+}
+
+// SupportsReceiver reports whether a module declares IReceiver through
+// ERC-165. A module without supportsInterface reverts, and does not.
+func SupportsReceiver(runtime cre.Runtime, evmClient *evm.Client, moduleAddr common.Address) (bool, error) {
+	parsedABI, err := abi.JSON(strings.NewReader(receiverABI))
+	if err != nil {
+		return false, fmt.Errorf("failed to parse receiver ABI: %w", err)
+	}
+	callData, err := parsedABI.Pack("supportsInterface", receiverInterfaceID)
+	if err != nil {
+		return false, fmt.Errorf("failed to pack supportsInterface call: %w", err)
+	}
+
+	result, err := evmClient.CallContract(runtime, &evm.CallContractRequest{
+		Call: &evm.CallMsg{
+			To:   moduleAddr.Bytes(),
+			Data: callData,
+		},
+	}).Await()
+	if err != nil || len(result.Data) == 0 {
+		return false, nil
+	}
+
+	values, err := parsedABI.Unpack("supportsInterface", result.Data)
+	if err != nil {
+		return false, fmt.Errorf("failed to unpack supportsInterface: %w", err)
+	}
+	supported, _ := values[0].(bool)
+	return supported, nil
+}
+
+// packAllowanceUpdate encodes an updateSubaccountAllowances call
+func packAllowanceUpdate(subAccount common.Address, balanceChange *big.Int) ([]byte, error) {
+	parsedABI, err := abi.JSON(strings.NewReader(moduleABI))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse module ABI: %w", err)
+	}
+
+	callData, err := parsedABI.Pack("updateSubaccountAllowances", subAccount, balanceChange)
+	if err != nil {
+		return nil, fmt.Errorf("failed to pack updateSubaccountAllowances call: %w", err)
+	}
+	return callData, nil
+}
+
+// packTokenAllowanceUpdate encodes an updateSubaccountTokenAllowances call of a
+// token-native module
+func packTokenAllowanceUpdate(subAccount common.Address, token common.Address, amount *big.Int) ([]byte, error) {
+	parsedABI, err := abi.JSON(strings.NewReader(tokenAllowanceABI))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse module ABI: %w", err)
+	}
+
+	callData, err := parsedABI.Pack("updateSubaccountTokenAllowances", subAccount, token, amount)
+	if err != nil {
+		return nil, fmt.Errorf("failed to pack updateSubaccountTokenAllowances call: %w", err)
+	}
+	return callData, nil
+}
+
+// packLetter encodes the module call of a queued update
+func packLetter(config *Config, letter DeadLetter) ([]byte, error) {
+	subAccount := common.HexToAddress(letter.SubAccount)
+	if letter.Token != "" {
+		return packTokenAllowanceUpdate(subAccount, common.HexToAddress(letter.Token), letter.BalanceChange)
+	}
+	return packAllowanceUpdate(subAccount, letter.BalanceChange)
+}
+
+// SubmitAllowanceUpdate generates a report calling updateSubaccountAllowances
+// and writes it to the receiver of the configured submission mode
+func SubmitAllowanceUpdate(config *Config, runtime cre.Runtime, evmClient *evm.Client, subAccount common.Address, balanceChange *big.Int, gasLimit uint64) (*evm.WriteReportReply, error) {
+	if err := Preflight(config, runtime, evmClient); err != nil {
+		return nil, err
+	}
+
+	// Module variants take the balance change in another unit than USD
+	balanceChange, err := TransformBalanceChange(config, runtime, evmClient, subAccount, balanceChange)
+	if err != nil {
+		return nil, err
+	}
+
+	callData, err := packAllowanceUpdate(subAccount, balanceChange)
+	if err != nil {
+		return nil, err
+	}
+	return writeModuleReport(config, runtime, evmClient, callData, gasLimit)
+}
+
+// SubmitTokenAllowanceUpdate generates a report calling
+// updateSubaccountTokenAllowances of a token-native module and writes it to
+// the receiver of the configured submission mode
+func SubmitTokenAllowanceUpdate(config *Config, runtime cre.Runtime, evmClient *evm.Client, subAccount common.Address, token common.Address, amount *big.Int, gasLimit uint64) (*evm.WriteReportReply, error) {
+	if err := Preflight(config, runtime, evmClient); err != nil {
+		return nil, err
+	}
+
+	callData, err := packTokenAllowanceUpdate(subAccount, token, amount)
+	if err != nil {
+		return nil, err
+	}
+	return writeModuleReport(config, runtime, evmClient, callData, gasLimit)
+}
+
+// SubmitLetter submits a queued update: a token allowance update when it
+// carries a token, a USD one otherwise
+func SubmitLetter(config *Config, runtime cre.Runtime, evmClient *evm.Client, letter DeadLetter, gasLimit uint64) (*evm.WriteReportReply, error) {
+	subAccount := common.HexToAddress(letter.SubAccount)
+	if letter.Token != "" {
+		return SubmitTokenAllowanceUpdate(config, runtime, evmClient, subAccount, common.HexToAddress(letter.Token), letter.BalanceChange, gasLimit)
+	}
+	return SubmitAllowanceUpdate(config, runtime, evmClient, subAccount, letter.BalanceChange, gasLimit)
+}
+
+// writeModuleReport generates a report for a module call and writes it to the
+// receiver of the configured submission mode
+func writeModuleReport(config *Config, runtime cre.Runtime, evmClient *evm.Client, callData []byte, gasLimit uint64) (*evm.WriteReportReply, error) {
+	receiver, err := submissionReceiver(config)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create report for the transaction
+	reportData, err := runtime.GenerateReport(&cre.ReportRequest{
+		EncodedPayload: callData,
+	}).Await()
+	if err != nil {
+		return nil, fmt.Errorf("failed to await report: %w", err)
+	}
+
+	// The state accounting for the update is stored before it goes on chain
+	if err := CheckpointState(config, runtime); err != nil {
+		return nil, fmt.Errorf("failed to save state before the write: %w", err)
+	}
+
+	// Submit transaction via WriteReport
+	writeReq := &evm.WriteCreReportRequest{
+		Receiver: receiver.Bytes(),
+		Report:   reportData,
+		GasConfig: &evm.GasConfig{
+			GasLimit: gasLimit,
+		},
+	}
+
+	reply, err := evmClient.WriteReport(runtime, writeReq).Await()
+	if err != nil {
+		return nil, err
+	}
+
+	// The module's event for this update is not merged into the ledger again
+	if len(reply.TxHash) > 0 {
+		state.RecordOwnUpdate("0x"+hex.EncodeToString(reply.TxHash), runtime.Now())
+	}
+	return reply, nil
+}
+
+// CheckWriteResult returns an error when a written report did not update the module
+func CheckWriteResult(reply *evm.WriteReportReply) error {
+	if reply.TxStatus != evm.TxStatus_TX_STATUS_SUCCESS {
+		msg := ""
+		if reply.ErrorMessage != nil {
+			msg = *reply.ErrorMessage
+		}
+		return fmt.Errorf("transaction %s: %s", reply.TxStatus.String(), msg)
+	}
+
+	if reply.ReceiverContractExecutionStatus != nil &&
+		*reply.ReceiverContractExecutionStatus != evm.ReceiverContractExecutionStatus_RECEIVER_CONTRACT_EXECUTION_STATUS_SUCCESS {
+		return fmt.Errorf("receiver contract execution %s", reply.ReceiverContractExecutionStatus.String())
+	}
+
+	return nil
+}
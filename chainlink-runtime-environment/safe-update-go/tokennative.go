@@ -0,0 +1,187 @@
+//go:build wasip1
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/smartcontractkit/chainlink-protos/cre/go/values/pb"
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/blockchain/evm"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+
+	"safe-update-go/fixedpoint"
+)
+
+// TokenNativeConfig represents per-token allowance accounting. Instead of one
+// USD balance change, the net amount of every token an action moved is
+// submitted to updateSubaccountTokenAllowances, rescaled from the token's
+// decimals to moduleDecimals. USD values are still computed as estimates for
+// policies, the ledger and reports; a token that cannot be priced is valued
+// at zero USD and its action held for review instead of failing.
+type TokenNativeConfig struct {
+	ModuleDecimals *uint8 `json:"moduleDecimals,omitempty"`
+}
+
+// TokenBalanceChange represents the net amount of one token moved by an action
+type TokenBalanceChange struct {
+	Token    common.Address
+	Symbol   string
+	Amount   *big.Int
+	Scaled   *big.Int
+	USDValue *big.Int
+}
+
+// ValidateTokenNative checks the token-native configuration
+func ValidateTokenNative(tokenNative *TokenNativeConfig) error {
+	if tokenNative == nil {
+		return nil
+	}
+	if tokenNative.ModuleDecimals != nil && *tokenNative.ModuleDecimals > fixedpoint.MaxDecimals {
+		return fmt.Errorf("moduleDecimals must be at most %d", fixedpoint.MaxDecimals)
+	}
+	return nil
+}
+
+// moduleDecimals returns the decimals the module takes token amounts in
+func (c *TokenNativeConfig) moduleDecimals() uint8 {
+	if c.ModuleDecimals == nil {
+		return 18
+	}
+	return *c.ModuleDecimals
+}
+
+// HasPriceSource reports whether a token can be valued in USD
+func (t *TokenConfig) HasPriceSource() bool {
+	return t.PriceFeedAddress.IsSet() || t.HasFixedPrice() || t.PriceFeedQuote != ""
+}
+
+// TokenBalanceChanges nets the deltas of an action per token, in the order the
+// tokens first moved, and rescales each net amount to the module's decimals.
+// Credits are rounded down and debits up, so rounding never favors the
+// subaccount.
+func (a *ActionAccounting) TokenBalanceChanges(tokenNative *TokenNativeConfig) []TokenBalanceChange {
+	var changes []TokenBalanceChange
+	index := make(map[common.Address]int)
+
+	for _, delta := range a.Deltas {
+		i, ok := index[delta.Token]
+		if !ok {
+			i = len(changes)
+			index[delta.Token] = i
+			changes = append(changes, TokenBalanceChange{Token: delta.Token, Symbol: delta.Symbol, Amount: new(big.Int), USDValue: new(big.Int)})
+		}
+		changes[i].Amount.Add(changes[i].Amount, delta.Amount)
+		changes[i].USDValue.Add(changes[i].USDValue, delta.USDValue)
+	}
+
+	for i := range changes {
+		rounding := fixedpoint.RoundDown
+		if changes[i].Amount.Sign() < 0 {
+			rounding = fixedpoint.RoundUp
+		}
+		changes[i].Scaled = fixedpoint.Rescale(changes[i].Amount, a.decimals(changes[i].Token), tokenNative.moduleDecimals(), rounding)
+	}
+	return changes
+}
+
+// decimals returns the decimals of a token moved by the action
+func (a *ActionAccounting) decimals(token common.Address) uint8 {
+	for _, delta := range a.Deltas {
+		if delta.Token == token {
+			return delta.Decimals
+		}
+	}
+	return 0
+}
+
+// UnpricedReview holds an action moving a token that could not be priced. Its
+// zero USD estimate would escape the stale and negative price checks and
+// every USD policy limit.
+func (a *ActionAccounting) UnpricedReview() (bool, string) {
+	for _, delta := range a.Deltas {
+		if delta.Unpriced {
+			return true, fmt.Sprintf("%s could not be priced and is estimated at zero USD", delta.Symbol)
+		}
+	}
+	return false, ""
+}
+
+// formatBalanceChange formats the balance change of an update: a token amount
+// in module decimals for token updates, USD otherwise
+func formatBalanceChange(config *Config, letter DeadLetter) string {
+	if letter.Token != "" {
+		return letter.BalanceChange.String() + " " + letter.Token
+	}
+	return FormatUSD(config, letter.BalanceChange)
+}
+
+// submitTokenBalanceChanges routes one token allowance update per token the
+// action moved on net. Every token is routed even if an earlier one failed;
+// the first failure is returned.
+func submitTokenBalanceChanges(config *Config, runtime cre.Runtime, evmClient *evm.Client, logger *slog.Logger, action *Action, accounting *ActionAccounting,
+	letter DeadLetter, auditRecord AuditRecord, blockNumber *pb.BigInt) (*ExecutionResult, error) {
+	subAccount := letter.SubAccount
+
+	routed := 0
+	var firstErr error
+	for _, change := range accounting.TokenBalanceChanges(config.TokenNative) {
+		logger.Info("Token balance change", "symbol", change.Symbol, "amount", change.Amount.String(), "scaled", change.Scaled.String(),
+			"estimatedUsd", FormatUSD(config, change.USDValue))
+
+		// A net inflow credits the token's allowance; a net outflow cannot be
+		// debited and is reported, unless a deposit charged it at approval
+		if change.Scaled.Sign() == 0 {
+			continue
+		}
+		if change.Scaled.Sign() < 0 && action.Verb == VerbDeposit {
+			logger.Info("Deposit charged at approval, nothing to submit", "symbol", change.Symbol, "amount", change.Scaled.String())
+			continue
+		}
+		if change.Scaled.Sign() < 0 {
+			RaiseAlert(config, runtime, slog.LevelWarn, "ALERT: net outflow not debited", subAccount, "subAccount", subAccount,
+				"txHash", letter.TxHash, "token", change.Symbol, "value", change.Scaled.String())
+			continue
+		}
+
+		guarded, clamped, err := ApplyPrecisionGuard(config.Precision, change.Scaled)
+		if err != nil {
+			RaiseAlert(config, runtime, slog.LevelError, "ALERT: balance change blocked", subAccount, "subAccount", subAccount,
+				"token", change.Symbol, "value", change.Scaled.String(), "error", err.Error())
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if clamped {
+			RaiseAlert(config, runtime, slog.LevelError, "ALERT: balance change clamped", subAccount, "subAccount", subAccount,
+				"token", change.Symbol, "value", change.Scaled.String(), "clampedTo", guarded.String())
+		}
+
+		tokenLetter := letter
+		tokenLetter.Token = change.Token.Hex()
+		tokenLetter.BalanceChange = guarded
+		tokenAudit := auditRecord
+		tokenAudit.Token = change.Token.Hex()
+		tokenAudit.Amount = change.Amount.String()
+		tokenAudit.BalanceChange = guarded.String()
+
+		if _, err := routeAllowanceUpdate(config, runtime, evmClient, logger, action, tokenLetter, tokenAudit, blockNumber); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		routed++
+	}
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if routed == 0 {
+		return &ExecutionResult{Message: "No net inflow", Success: true}, nil
+	}
+	return &ExecutionResult{
+		Message: fmt.Sprintf("Success: Routed %d token allowance updates for %s", routed, subAccount),
+		Success: true,
+	}, nil
+}
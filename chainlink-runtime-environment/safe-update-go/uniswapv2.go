@@ -0,0 +1,62 @@
+//go:build wasip1
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/blockchain/evm"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+)
+
+// Burn(address indexed sender, uint256 amount0, uint256 amount1, address indexed to),
+// emitted by a Uniswap V2 pair
+var uniswapV2BurnSignature = crypto.Keccak256Hash([]byte("Burn(address,uint256,uint256,address)"))
+
+// ResolveUniswapV2Burn settles a Uniswap V2 liquidity removal from the Burn
+// event the router triggered on the pair. Both amounts are matched with the
+// pair's Transfer of that amount to the burn recipient, which gives their
+// tokens. For removeLiquidityETH the recipient is the router, which receives
+// WETH before unwrapping it.
+func ResolveUniswapV2Burn(runtime cre.Runtime, evmClient *evm.Client, logger *slog.Logger, action *Action, calldata []byte, txHash []byte) error {
+	reply, err := evmClient.GetTransactionReceipt(runtime, &evm.GetTransactionReceiptRequest{Hash: txHash}).Await()
+	if err != nil {
+		return fmt.Errorf("failed to get transaction receipt: %w", err)
+	}
+	if reply.Receipt == nil {
+		return fmt.Errorf("transaction receipt not found")
+	}
+	logs := reply.Receipt.Logs
+
+	for _, log := range logs {
+		if len(log.Topics) < 3 || len(log.Data) < 64 || !bytes.Equal(log.Topics[0], uniswapV2BurnSignature.Bytes()) ||
+			common.BytesToAddress(log.Topics[1]) != action.Counterparty {
+			continue
+		}
+		pair := common.BytesToAddress(log.Address)
+		to := common.BytesToAddress(log.Topics[2])
+
+		for _, word := range [][]byte{log.Data[:32], log.Data[32:64]} {
+			amount := new(big.Int).SetBytes(word)
+			if amount.Sign() == 0 {
+				continue
+			}
+			token, ok := transferredToken(logs, to, amount)
+			if !ok {
+				return fmt.Errorf("no transfer of %s from pair %s to %s", amount, pair.Hex(), to.Hex())
+			}
+			action.AssetsIn = append(action.AssetsIn, AssetAmount{Token: token, Amount: amount})
+			logger.Info("Uniswap V2 liquidity removed", "pair", pair.Hex(), "token", token.Hex(), "amount", amount.String())
+		}
+	}
+
+	if len(action.AssetsIn) == 0 {
+		return fmt.Errorf("no Uniswap V2 burn by router %s in receipt", action.Counterparty.Hex())
+	}
+	return nil
+}
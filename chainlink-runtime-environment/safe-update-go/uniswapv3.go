@@ -0,0 +1,156 @@
+//go:build wasip1
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/smartcontractkit/chainlink-protos/cre/go/values/pb"
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/blockchain/evm"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+)
+
+// Uniswap V3 NonfungiblePositionManager ABI (positions)
+const uniswapV3PositionManagerABI = `[{"constant":true,"inputs":[{"name":"tokenId","type":"uint256"}],"name":"positions","outputs":[{"name":"nonce","type":"uint96"},{"name":"operator","type":"address"},{"name":"token0","type":"address"},{"name":"token1","type":"address"},{"name":"fee","type":"uint24"},{"name":"tickLower","type":"int24"},{"name":"tickUpper","type":"int24"},{"name":"liquidity","type":"uint128"},{"name":"feeGrowthInside0LastX128","type":"uint256"},{"name":"feeGrowthInside1LastX128","type":"uint256"},{"name":"tokensOwed0","type":"uint128"},{"name":"tokensOwed1","type":"uint128"}],"type":"function"}]`
+
+// Collect(uint256 indexed tokenId, address recipient, uint256 amount0, uint256 amount1),
+// emitted by the position manager
+var uniswapV3CollectSignature = crypto.Keccak256Hash([]byte("Collect(uint256,address,uint256,uint256)"))
+
+// UniswapV3PositionTokens returns the token pair of a position from the
+// position manager's positions(), read in the block before the exit so that a
+// position burned in the same multicall still resolves. Pairs are cached.
+func UniswapV3PositionTokens(runtime cre.Runtime, evmClient *evm.Client, manager common.Address, tokenID *big.Int, receipt *evm.Receipt) (common.Address, common.Address, error) {
+	key0 := manager.Hex() + ":" + tokenID.String() + ":token0"
+	key1 := manager.Hex() + ":" + tokenID.String() + ":token1"
+	if token0, ok := state.VaultAssets[key0]; ok {
+		if token1, ok := state.VaultAssets[key1]; ok {
+			return token0, token1, nil
+		}
+	}
+
+	parsedABI, err := abi.JSON(strings.NewReader(uniswapV3PositionManagerABI))
+	if err != nil {
+		return common.Address{}, common.Address{}, fmt.Errorf("failed to parse position manager ABI: %w", err)
+	}
+	callData, err := parsedABI.Pack("positions", tokenID)
+	if err != nil {
+		return common.Address{}, common.Address{}, fmt.Errorf("failed to pack positions call: %w", err)
+	}
+
+	previous := new(big.Int).Sub(pb.NewIntFromBigInt(receipt.BlockNumber), big.NewInt(1))
+	result, err := evmClient.CallContract(runtime, &evm.CallContractRequest{
+		Call: &evm.CallMsg{
+			To:   manager.Bytes(),
+			Data: callData,
+		},
+		BlockNumber: pb.NewBigIntFromInt(previous),
+	}).Await()
+	if err != nil {
+		return common.Address{}, common.Address{}, fmt.Errorf("failed to call positions(%s) on %s: %w", tokenID, manager.Hex(), err)
+	}
+
+	values, err := parsedABI.Unpack("positions", result.Data)
+	if err != nil || len(values) < 4 {
+		return common.Address{}, common.Address{}, fmt.Errorf("failed to unpack positions: %v", err)
+	}
+	token0, ok0 := values[2].(common.Address)
+	token1, ok1 := values[3].(common.Address)
+	if !ok0 || !ok1 {
+		return common.Address{}, common.Address{}, fmt.Errorf("unexpected positions result")
+	}
+
+	state.VaultAssets[key0] = token0
+	state.VaultAssets[key1] = token1
+	return token0, token1, nil
+}
+
+// ResolveUniswapV3Collect settles a Uniswap V3 position exit from the
+// position manager's Collect events. The position's token pair comes from
+// positions(), and each collected amount must match a Transfer of its token
+// to the recipient. Collects to another recipient than the calldata's are
+// rejected. Liquidity decreased without a collect stays owed to the position
+// and moves nothing.
+func ResolveUniswapV3Collect(runtime cre.Runtime, evmClient *evm.Client, logger *slog.Logger, action *Action, calldata []byte, txHash []byte) error {
+	reply, err := evmClient.GetTransactionReceipt(runtime, &evm.GetTransactionReceiptRequest{Hash: txHash}).Await()
+	if err != nil {
+		return fmt.Errorf("failed to get transaction receipt: %w", err)
+	}
+	if reply.Receipt == nil {
+		return fmt.Errorf("transaction receipt not found")
+	}
+	logs := reply.Receipt.Logs
+
+	for _, log := range logs {
+		if common.BytesToAddress(log.Address) != action.Counterparty || len(log.Topics) < 2 || len(log.Data) < 96 ||
+			!bytes.Equal(log.Topics[0], uniswapV3CollectSignature.Bytes()) {
+			continue
+		}
+		tokenID := new(big.Int).SetBytes(log.Topics[1])
+		recipient := common.BytesToAddress(log.Data[:32])
+		// A zero recipient collects to the position manager, for a later unwrap or sweep
+		expected := action.Recipient
+		if expected == (common.Address{}) {
+			expected = action.Counterparty
+		}
+		if recipient != expected {
+			return fmt.Errorf("position %s collected to %s, calldata recipient %s", tokenID, recipient.Hex(), expected.Hex())
+		}
+
+		token0, token1, err := UniswapV3PositionTokens(runtime, evmClient, action.Counterparty, tokenID, reply.Receipt)
+		if err != nil {
+			return err
+		}
+
+		for i, token := range []common.Address{token0, token1} {
+			amount := new(big.Int).SetBytes(log.Data[32*(i+1) : 32*(i+2)])
+			if amount.Sign() == 0 {
+				continue
+			}
+			if !hasTransfer(logs, token, recipient, amount) {
+				return fmt.Errorf("no transfer of %s %s to %s for position %s", amount, token.Hex(), recipient.Hex(), tokenID)
+			}
+			action.AssetsIn = append(action.AssetsIn, AssetAmount{Token: token, Amount: amount})
+			logger.Info("Uniswap V3 collected", "tokenId", tokenID.String(), "token", token.Hex(), "amount", amount.String())
+		}
+	}
+
+	if len(action.AssetsIn) == 0 {
+		logger.Info("Uniswap V3 liquidity decreased without collect")
+	}
+	return nil
+}
+
+// hasTransfer reports whether a token was transferred to a recipient for an amount
+func hasTransfer(logs []*evm.Log, token common.Address, recipient common.Address, amount *big.Int) bool {
+	for _, log := range logs {
+		if common.BytesToAddress(log.Address) != token || len(log.Topics) < 3 || len(log.Data) < 32 ||
+			!bytes.Equal(log.Topics[0], transferSignature.Bytes()) {
+			continue
+		}
+		if common.BytesToAddress(log.Topics[2]) == recipient && new(big.Int).SetBytes(log.Data[:32]).Cmp(amount) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// transferredToken finds the token of a Transfer of an amount to a recipient
+func transferredToken(logs []*evm.Log, recipient common.Address, amount *big.Int) (common.Address, bool) {
+	for _, log := range logs {
+		if len(log.Topics) < 3 || len(log.Data) < 32 || !bytes.Equal(log.Topics[0], transferSignature.Bytes()) {
+			continue
+		}
+		if common.BytesToAddress(log.Topics[2]) == recipient && new(big.Int).SetBytes(log.Data[:32]).Cmp(amount) == 0 {
+			return common.BytesToAddress(log.Address), true
+		}
+	}
+	return common.Address{}, false
+}
@@ -0,0 +1,163 @@
+//go:build wasip1
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/blockchain/evm"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+)
+
+// Universal Router ABI (WETH9)
+const universalRouterABI = `[{"constant":true,"inputs":[],"name":"WETH9","outputs":[{"name":"","type":"address"}],"type":"function"}]`
+
+// Withdrawal(address indexed src, uint256 wad), emitted by WETH when it is unwrapped
+var wethWithdrawalSignature = crypto.Keccak256Hash([]byte("Withdrawal(address,uint256)"))
+
+// ExecutionFromModuleSuccess(address indexed module), emitted by the Safe that executed a module transaction
+var executionFromModuleSuccessSignature = crypto.Keccak256Hash([]byte("ExecutionFromModuleSuccess(address)"))
+
+// GetUniversalRouterWETH returns the WETH a Universal Router wraps and unwraps
+// ETH with, from the cache or from the router
+func GetUniversalRouterWETH(runtime cre.Runtime, evmClient *evm.Client, router common.Address) (common.Address, error) {
+	key := router.Hex() + ":weth9"
+	if weth, ok := state.VaultAssets[key]; ok {
+		return weth, nil
+	}
+
+	parsedRouterABI, err := abi.JSON(strings.NewReader(universalRouterABI))
+	if err != nil {
+		return common.Address{}, fmt.Errorf("failed to parse Universal Router ABI: %w", err)
+	}
+	callData, err := parsedRouterABI.Pack("WETH9")
+	if err != nil {
+		return common.Address{}, fmt.Errorf("failed to pack WETH9 call: %w", err)
+	}
+	result, err := evmClient.CallContract(runtime, &evm.CallContractRequest{
+		Call: &evm.CallMsg{
+			To:   router.Bytes(),
+			Data: callData,
+		},
+	}).Await()
+	if err != nil {
+		return common.Address{}, fmt.Errorf("failed to call WETH9 on %s: %w", router.Hex(), err)
+	}
+	values, err := parsedRouterABI.Unpack("WETH9", result.Data)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("failed to unpack WETH9: %w", err)
+	}
+	weth, ok := values[0].(common.Address)
+	if !ok {
+		return common.Address{}, fmt.Errorf("unexpected WETH9 result")
+	}
+
+	state.VaultAssets[key] = weth
+	return weth, nil
+}
+
+// ResolveUniversalRouter settles a Universal Router execution from its
+// receipt. The Safe is the emitter of ExecutionFromModuleSuccess. Each ERC20
+// sold is debited with what the Safe transferred of it, and each ERC20 bought
+// is credited with what the recipient, or the Safe when there is none,
+// received of it. Native ETH is valued as the router's WETH: wrapped ETH at
+// the amount of the command, unwrapped ETH at the WETH the router withdrew.
+func ResolveUniversalRouter(runtime cre.Runtime, evmClient *evm.Client, logger *slog.Logger, action *Action, calldata []byte, txHash []byte) error {
+	weth, err := GetUniversalRouterWETH(runtime, evmClient, action.Counterparty)
+	if err != nil {
+		return err
+	}
+
+	reply, err := evmClient.GetTransactionReceipt(runtime, &evm.GetTransactionReceiptRequest{Hash: txHash}).Await()
+	if err != nil {
+		return fmt.Errorf("failed to get transaction receipt: %w", err)
+	}
+	if reply.Receipt == nil {
+		return fmt.Errorf("transaction receipt not found")
+	}
+	logs := reply.Receipt.Logs
+
+	safe, ok := moduleExecutor(logs)
+	if !ok {
+		return fmt.Errorf("no ExecutionFromModuleSuccess event in receipt")
+	}
+	recipient := action.Recipient
+	if recipient == (common.Address{}) {
+		recipient = safe
+	}
+
+	for i, sold := range action.AssetsOut {
+		if isNativeToken(sold.Token) {
+			action.AssetsOut[i].Token = weth
+			continue
+		}
+		spent := sumTransfers(logs, sold.Token, &safe, nil)
+		if spent.Sign() == 0 {
+			return fmt.Errorf("no transfer of %s by the Safe %s in receipt", sold.Token.Hex(), safe.Hex())
+		}
+		action.AssetsOut[i].Amount = spent
+	}
+
+	for i, bought := range action.AssetsIn {
+		var received *big.Int
+		if isNativeToken(bought.Token) {
+			action.AssetsIn[i].Token = weth
+			received = new(big.Int)
+			for _, log := range logs {
+				if len(log.Topics) < 2 || len(log.Data) < 32 || !bytes.Equal(log.Topics[0], wethWithdrawalSignature.Bytes()) ||
+					common.BytesToAddress(log.Address) != weth || common.BytesToAddress(log.Topics[1]) != action.Counterparty {
+					continue
+				}
+				received.Add(received, new(big.Int).SetBytes(log.Data[:32]))
+			}
+		} else {
+			received = sumTransfers(logs, bought.Token, nil, &recipient)
+		}
+		if received.Cmp(bought.Amount) < 0 {
+			return fmt.Errorf("Universal Router paid %s of %s, below its minimum %s", received, bought.Token.Hex(), bought.Amount)
+		}
+		action.AssetsIn[i].Amount = received
+	}
+
+	for _, asset := range action.AssetsOut {
+		logger.Info("Universal Router sold", "token", asset.Token.Hex(), "amount", asset.Amount.String())
+	}
+	for _, asset := range action.AssetsIn {
+		logger.Info("Universal Router bought", "token", asset.Token.Hex(), "amount", asset.Amount.String(), "recipient", recipient.Hex())
+	}
+	return nil
+}
+
+// moduleExecutor returns the Safe that executed the module transaction of a receipt
+func moduleExecutor(logs []*evm.Log) (common.Address, bool) {
+	for _, log := range logs {
+		if len(log.Topics) >= 2 && bytes.Equal(log.Topics[0], executionFromModuleSuccessSignature.Bytes()) {
+			return common.BytesToAddress(log.Address), true
+		}
+	}
+	return common.Address{}, false
+}
+
+// sumTransfers sums the Transfers of a token, optionally only those from a
+// sender or to a recipient
+func sumTransfers(logs []*evm.Log, token common.Address, from *common.Address, to *common.Address) *big.Int {
+	total := new(big.Int)
+	for _, log := range logs {
+		if len(log.Topics) < 3 || len(log.Data) < 32 || !bytes.Equal(log.Topics[0], transferSignature.Bytes()) ||
+			common.BytesToAddress(log.Address) != token {
+			continue
+		}
+		if (from != nil && common.BytesToAddress(log.Topics[1]) != *from) || (to != nil && common.BytesToAddress(log.Topics[2]) != *to) {
+			continue
+		}
+		total.Add(total, new(big.Int).SetBytes(log.Data[:32]))
+	}
+	return total
+}
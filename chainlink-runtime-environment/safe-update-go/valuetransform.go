@@ -0,0 +1,155 @@
+//go:build wasip1
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/blockchain/evm"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+
+	"safe-update-go/fixedpoint"
+)
+
+// Units a module takes balanceChange in
+const (
+	// UnitUSD is the absolute USD value with 18 decimals
+	UnitUSD = "usd"
+
+	// UnitBps is basis points of the subaccount's total allowance in its window
+	UnitBps = "bps"
+
+	// UnitToken is an amount of a configured token
+	UnitToken = "token"
+)
+
+// ValueTransformConfig represents the unit a module variant takes balanceChange
+// in. Token amounts are in the token's decimals unless decimals is set.
+type ValueTransformConfig struct {
+	Unit     string `json:"unit"`
+	Token    string `json:"token,omitempty"`
+	Decimals *uint8 `json:"decimals,omitempty"`
+}
+
+// ValidateValueTransform checks the value transform of a module
+func ValidateValueTransform(transform *ValueTransformConfig, tokens []TokenConfig) error {
+	if transform == nil {
+		return nil
+	}
+	switch transform.Unit {
+	case "", UnitUSD, UnitBps:
+		if transform.Token != "" || transform.Decimals != nil {
+			return fmt.Errorf("token and decimals only apply to the %s unit", UnitToken)
+		}
+	case UnitToken:
+		if transform.Token == "" {
+			return fmt.Errorf("token is required for the %s unit", UnitToken)
+		}
+		found := false
+		for _, token := range tokens {
+			found = found || token.Symbol == transform.Token
+		}
+		if !found {
+			return fmt.Errorf("token %s not in tokens", transform.Token)
+		}
+		if transform.Decimals != nil && *transform.Decimals > fixedpoint.MaxDecimals {
+			return fmt.Errorf("decimals must be at most %d", fixedpoint.MaxDecimals)
+		}
+	default:
+		return fmt.Errorf("unknown unit %q", transform.Unit)
+	}
+	return nil
+}
+
+// balanceChangeUnit returns the unit the module of a target config takes
+func balanceChangeUnit(config *Config) string {
+	if config.ValueTransform == nil || config.ValueTransform.Unit == "" {
+		return UnitUSD
+	}
+	return config.ValueTransform.Unit
+}
+
+// TransformBalanceChange converts a USD balance change into the unit of the
+// target module. Converted values are checked against the module's precision,
+// which USD values already were when they were decided.
+func TransformBalanceChange(config *Config, runtime cre.Runtime, evmClient *evm.Client, subAccount common.Address, usd *big.Int) (*big.Int, error) {
+	var value *big.Int
+	switch balanceChangeUnit(config) {
+	case UnitUSD:
+		return usd, nil
+	case UnitBps:
+		allowance, err := totalAllowance(config, runtime, evmClient, subAccount)
+		if err != nil {
+			return nil, err
+		}
+		if allowance.Sign() == 0 {
+			return nil, fmt.Errorf("subaccount %s has no allowance to express %s USD in bps", subAccount.Hex(), usdWhole(usd))
+		}
+		value = fixedpoint.MulDiv(usd, big.NewInt(fixedpoint.BasisPoints), allowance, fixedpoint.RoundDown)
+	case UnitToken:
+		var err error
+		if value, err = usdToTokenAmount(config, runtime, evmClient, usd); err != nil {
+			return nil, err
+		}
+	}
+
+	guarded, clamped, err := ApplyPrecisionGuard(config.Precision, value)
+	if err != nil {
+		return nil, err
+	}
+	if clamped {
+		RaiseAlert(config, runtime, slog.LevelError, "ALERT: balance change clamped", subAccount.Hex(), "subAccount", subAccount.Hex(),
+			"unit", balanceChangeUnit(config), "value", value.String(), "clampedTo", guarded.String())
+	}
+	runtime.Logger().Info("Balance change transformed", "module", config.ModuleAddress.Hex(), "unit", balanceChangeUnit(config),
+		"usd", FormatUSD(config, usd), "value", guarded.String())
+	return guarded, nil
+}
+
+// totalAllowance returns the total allowance of a subaccount in its current
+// window, computed as the module does: windowPortfolioValue * maxLossBps / 10000
+func totalAllowance(config *Config, runtime cre.Runtime, evmClient *evm.Client, subAccount common.Address) (*big.Int, error) {
+	moduleAddr := config.ModuleAddress.Address
+	portfolioValue, err := GetExecutionWindowPortfolioValue(runtime, evmClient, moduleAddr, subAccount)
+	if err != nil {
+		return nil, err
+	}
+	limits, err := GetSubAccountLimits(runtime, evmClient, moduleAddr, subAccount)
+	if err != nil {
+		return nil, err
+	}
+	return fixedpoint.MulDiv(portfolioValue, limits.MaxLossBps, big.NewInt(fixedpoint.BasisPoints), fixedpoint.RoundDown), nil
+}
+
+// usdToTokenAmount converts a USD value into an amount of the transform's
+// token at its current price, rounded down
+func usdToTokenAmount(config *Config, runtime cre.Runtime, evmClient *evm.Client, usd *big.Int) (*big.Int, error) {
+	tokenConfig := findTokenBySymbol(config, config.ValueTransform.Token)
+	if tokenConfig == nil {
+		return nil, fmt.Errorf("token %s not in config", config.ValueTransform.Token)
+	}
+	price, priceDecimals, err := config.priceSource()(config, runtime, evmClient, runtime.Logger(), tokenConfig)
+	if err != nil {
+		return nil, err
+	}
+	if price.Sign() <= 0 {
+		return nil, fmt.Errorf("cannot express USD in %s at price %s", tokenConfig.Symbol, price)
+	}
+
+	decimals := config.ValueTransform.Decimals
+	if decimals == nil {
+		tokenDecimals, err := GetTokenDecimals(runtime, evmClient, tokenConfig.Address.Address)
+		if err != nil {
+			return nil, err
+		}
+		decimals = &tokenDecimals
+	}
+
+	// amount = usd / 10^18 / (price / 10^priceDecimals) * 10^decimals
+	numerator := new(big.Int).Mul(usd, fixedpoint.Pow10(int(*decimals)+int(priceDecimals)))
+	denominator := new(big.Int).Mul(price, fixedpoint.Pow10(int(fixedpoint.USDDecimals)))
+	return fixedpoint.Div(numerator, denominator, fixedpoint.RoundDown), nil
+}
@@ -0,0 +1,197 @@
+//go:build wasip1
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/blockchain/evm"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+)
+
+// ERC-4626 vault ABI (asset and convertToAssets)
+const erc4626ABI = `[
+	{"constant":true,"inputs":[],"name":"asset","outputs":[{"name":"","type":"address"}],"type":"function"},
+	{"constant":true,"inputs":[{"name":"shares","type":"uint256"}],"name":"convertToAssets","outputs":[{"name":"","type":"uint256"}],"type":"function"}
+]`
+
+// VaultConfig maps an ERC-4626 vault or a Compound v2 cToken to its underlying
+// asset. Those that are not configured are resolved on-chain. Protocol
+// decodes the vault's ERC-4626 withdrawals as one of vaultProtocols rather
+// than erc4626, so per-protocol policies keep applying, or marks the contract
+// one of nativePayoutProtocols pays native ETH out of.
+type VaultConfig struct {
+	Address  Address `json:"address"`
+	Asset    Address `json:"asset"`
+	Protocol string  `json:"protocol,omitempty"`
+}
+
+// vaultProtocols are the protocols a configured vault can be decoded as
+var vaultProtocols = map[string]bool{
+	morphoProtocol: true,
+	makerProtocol:  true,
+	ethenaProtocol: true,
+	fraxProtocol:   true,
+}
+
+// nativePayoutProtocols are the protocols that pay native ETH out of a
+// contract with no asset() to resolve it by. The contract must be in the
+// registry with the protocol, mapped to the token the ETH is valued as.
+var nativePayoutProtocols = map[string]bool{
+	lidoProtocol:       true,
+	rocketPoolProtocol: true,
+	pendleProtocol:     true,
+	eigenLayerProtocol: true,
+}
+
+// CheckNativePayoutVaults checks that the native ETH an action was paid is
+// valued through a registry entry of its protocol, rather than failing on a
+// contract without asset()
+func CheckNativePayoutVaults(config *Config, action *Action) error {
+	if !nativePayoutProtocols[action.Protocol] {
+		return nil
+	}
+	for _, asset := range action.AssetsIn {
+		if !asset.Vault {
+			continue
+		}
+		registered := false
+		for _, v := range config.Vaults {
+			if v.Address.Address == asset.Token && v.Protocol == action.Protocol {
+				registered = true
+				break
+			}
+		}
+		if !registered {
+			return fmt.Errorf("%s pays native ETH out of %s, which must be in vaults with protocol %q", action.Protocol, asset.Token.Hex(), action.Protocol)
+		}
+	}
+	return nil
+}
+
+// LabelConfiguredProtocol relabels a decoded action with the protocol the
+// config assigns to its counterparty
+func LabelConfiguredProtocol(config *Config, action *Action) {
+	switch action.Protocol {
+	case erc4626Protocol:
+		for _, v := range config.Vaults {
+			if v.Address.Address == action.Counterparty && v.Protocol != "" {
+				action.Protocol = v.Protocol
+				return
+			}
+		}
+	case aaveProtocol:
+		for _, pool := range config.SparkPools {
+			if pool.Address == action.Counterparty {
+				action.Protocol = sparkProtocol
+				return
+			}
+		}
+	}
+}
+
+// callVault calls a view function of an ERC-4626 vault
+func callVault(runtime cre.Runtime, evmClient *evm.Client, vault common.Address, method string, out interface{}, args ...interface{}) error {
+	parsedVaultABI, err := abi.JSON(strings.NewReader(erc4626ABI))
+	if err != nil {
+		return fmt.Errorf("failed to parse ERC-4626 ABI: %w", err)
+	}
+
+	callData, err := parsedVaultABI.Pack(method, args...)
+	if err != nil {
+		return fmt.Errorf("failed to pack %s call: %w", method, err)
+	}
+
+	result, err := evmClient.CallContract(runtime, &evm.CallContractRequest{
+		Call: &evm.CallMsg{
+			To:   vault.Bytes(),
+			Data: callData,
+		},
+	}).Await()
+	if err != nil {
+		return fmt.Errorf("failed to call %s on vault %s: %w", method, vault.Hex(), err)
+	}
+
+	if err := parsedVaultABI.UnpackIntoInterface(out, method, result.Data); err != nil {
+		return fmt.Errorf("failed to unpack %s: %w", method, err)
+	}
+	return nil
+}
+
+// VaultAsset returns the underlying asset of a vault from the registry, the
+// cache or the vault's asset() function
+func VaultAsset(config *Config, runtime cre.Runtime, evmClient *evm.Client, vault common.Address) (common.Address, error) {
+	for _, v := range config.Vaults {
+		if v.Address.Address == vault {
+			return v.Asset.Address, nil
+		}
+	}
+
+	key := vault.Hex()
+	if asset, ok := state.VaultAssets[key]; ok {
+		return asset, nil
+	}
+
+	var asset common.Address
+	if err := callVault(runtime, evmClient, vault, "asset", &asset); err != nil {
+		return common.Address{}, err
+	}
+	state.VaultAssets[key] = asset
+	return asset, nil
+}
+
+// ConvertToAssets converts vault shares to underlying assets at the vault's current rate
+func ConvertToAssets(runtime cre.Runtime, evmClient *evm.Client, vault common.Address, shares *big.Int) (*big.Int, error) {
+	assets := new(big.Int)
+	if err := callVault(runtime, evmClient, vault, "convertToAssets", &assets, shares); err != nil {
+		return nil, err
+	}
+	return assets, nil
+}
+
+// resolveVaultAsset turns an amount expressed against a vault into an amount
+// of the vault's underlying token
+func resolveVaultAsset(config *Config, runtime cre.Runtime, evmClient *evm.Client, logger *slog.Logger, asset AssetAmount) (AssetAmount, error) {
+	if asset.CToken {
+		return resolveCTokenAsset(config, runtime, evmClient, logger, asset)
+	}
+	if !asset.Vault {
+		return asset, nil
+	}
+
+	underlying, err := VaultAsset(config, runtime, evmClient, asset.Token)
+	if err != nil {
+		return AssetAmount{}, err
+	}
+
+	amount := asset.Amount
+	if asset.Shares {
+		amount, err = ConvertToAssets(runtime, evmClient, asset.Token, asset.Amount)
+		if err != nil {
+			return AssetAmount{}, err
+		}
+	}
+
+	logger.Info("Resolved vault asset", "vault", asset.Token.Hex(), "asset", underlying.Hex(),
+		"shares", asset.Shares, "amount", amount.String())
+	return AssetAmount{Token: underlying, Amount: amount, Debt: asset.Debt}, nil
+}
+
+// ResolveVaultAssets replaces the vault and cToken amounts of an action with their underlying tokens
+func ResolveVaultAssets(config *Config, runtime cre.Runtime, evmClient *evm.Client, logger *slog.Logger, action *Action) error {
+	for _, assets := range [][]AssetAmount{action.AssetsIn, action.AssetsOut} {
+		for i := range assets {
+			resolved, err := resolveVaultAsset(config, runtime, evmClient, logger, assets[i])
+			if err != nil {
+				return err
+			}
+			assets[i] = resolved
+		}
+	}
+	return nil
+}
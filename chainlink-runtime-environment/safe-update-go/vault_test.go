@@ -0,0 +1,47 @@
+//go:build wasip1
+
+package main
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// TestCheckNativePayoutVaults expects the native ETH paid out by a protocol
+// to be valued only through a registry entry labelled with that protocol
+func TestCheckNativePayoutVaults(t *testing.T) {
+	weth := common.HexToAddress("0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2")
+
+	tests := []struct {
+		name     string
+		protocol string
+		payer    common.Address
+	}{
+		{"lido", lidoProtocol, common.HexToAddress("0x889edC2eDab5f40e902b864aD4d7AdE8E412F9B1")},
+		{"rocketpool", rocketPoolProtocol, common.HexToAddress("0xae78736Cd615f374D3085123A210448E74Fc6393")},
+		{"pendle", pendleProtocol, common.HexToAddress("0x888888888889758F76e7103c6CbF23ABbF58F946")},
+		{"eigenlayer", eigenLayerProtocol, eigenLayerBeaconChainETHStrategy},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action := &Action{
+				Protocol: tt.protocol,
+				AssetsIn: []AssetAmount{{Token: tt.payer, Amount: big.NewInt(1e18), Vault: true}},
+			}
+
+			if err := CheckNativePayoutVaults(&Config{}, action); err == nil {
+				t.Error("accepted a payout without a registry entry")
+			}
+			unlabelled := &Config{Vaults: []VaultConfig{{Address: NewAddress(tt.payer), Asset: NewAddress(weth)}}}
+			if err := CheckNativePayoutVaults(unlabelled, action); err == nil {
+				t.Error("accepted a registry entry of another protocol")
+			}
+			registered := &Config{Vaults: []VaultConfig{{Address: NewAddress(tt.payer), Asset: NewAddress(weth), Protocol: tt.protocol}}}
+			if err := CheckNativePayoutVaults(registered, action); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
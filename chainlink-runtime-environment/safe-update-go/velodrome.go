@@ -0,0 +1,207 @@
+//go:build wasip1
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/blockchain/evm"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+)
+
+// Velodrome v2 pool and gauge ABI (token0, token1, factory and
+// stakingToken), shared by Aerodrome
+const velodromeABI = `[
+	{"constant":true,"inputs":[],"name":"token0","outputs":[{"name":"","type":"address"}],"type":"function"},
+	{"constant":true,"inputs":[],"name":"token1","outputs":[{"name":"","type":"address"}],"type":"function"},
+	{"constant":true,"inputs":[],"name":"factory","outputs":[{"name":"","type":"address"}],"type":"function"},
+	{"constant":true,"inputs":[],"name":"stakingToken","outputs":[{"name":"","type":"address"}],"type":"function"}
+]`
+
+// Burn(address indexed sender, address indexed to, uint256 amount0, uint256 amount1),
+// emitted by Velodrome and Aerodrome pools
+var velodromeBurnSignature = crypto.Keccak256Hash([]byte("Burn(address,address,uint256,uint256)"))
+
+// Withdraw(address indexed from, uint256 amount), emitted by Velodrome and Aerodrome gauges
+var velodromeGaugeWithdrawSignature = crypto.Keccak256Hash([]byte("Withdraw(address,uint256)"))
+
+// VelodromePool represents the tokens of a Velodrome or Aerodrome pool and
+// the factory that deployed it
+type VelodromePool struct {
+	Address common.Address
+	Token0  common.Address
+	Token1  common.Address
+	Factory common.Address
+}
+
+// callVelodrome calls a view function of a Velodrome pool or gauge
+func callVelodrome(runtime cre.Runtime, evmClient *evm.Client, contract common.Address, method string) ([]interface{}, error) {
+	parsedVelodromeABI, err := abi.JSON(strings.NewReader(velodromeABI))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse Velodrome ABI: %w", err)
+	}
+
+	callData, err := parsedVelodromeABI.Pack(method)
+	if err != nil {
+		return nil, fmt.Errorf("failed to pack %s call: %w", method, err)
+	}
+
+	result, err := evmClient.CallContract(runtime, &evm.CallContractRequest{
+		Call: &evm.CallMsg{
+			To:   contract.Bytes(),
+			Data: callData,
+		},
+	}).Await()
+	if err != nil {
+		return nil, fmt.Errorf("failed to call %s on %s: %w", method, contract.Hex(), err)
+	}
+
+	values, err := parsedVelodromeABI.Unpack(method, result.Data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unpack %s: %w", method, err)
+	}
+	if len(values) == 0 {
+		return nil, fmt.Errorf("empty %s result", method)
+	}
+	return values, nil
+}
+
+// callVelodromeAddress calls a view function of a Velodrome pool or gauge returning an address
+func callVelodromeAddress(runtime cre.Runtime, evmClient *evm.Client, contract common.Address, method string) (common.Address, error) {
+	values, err := callVelodrome(runtime, evmClient, contract, method)
+	if err != nil {
+		return common.Address{}, err
+	}
+	address, ok := values[0].(common.Address)
+	if !ok {
+		return common.Address{}, fmt.Errorf("unexpected %s result", method)
+	}
+	return address, nil
+}
+
+// GetVelodromePool returns the tokens and the factory of a pool, from the
+// cache or from the pool
+func GetVelodromePool(runtime cre.Runtime, evmClient *evm.Client, pool common.Address) (*VelodromePool, error) {
+	keys := []string{pool.Hex() + ":token0", pool.Hex() + ":token1", pool.Hex() + ":factory"}
+	addresses := make([]common.Address, len(keys))
+	for i, method := range []string{"token0", "token1", "factory"} {
+		if cached, ok := state.VaultAssets[keys[i]]; ok {
+			addresses[i] = cached
+			continue
+		}
+		address, err := callVelodromeAddress(runtime, evmClient, pool, method)
+		if err != nil {
+			return nil, err
+		}
+		state.VaultAssets[keys[i]] = address
+		addresses[i] = address
+	}
+
+	return &VelodromePool{Address: pool, Token0: addresses[0], Token1: addresses[1], Factory: addresses[2]}, nil
+}
+
+// LabelAerodromePool relabels a Velodrome action whose pool was deployed by
+// one of the configured Aerodrome factories. Aerodrome forked Velodrome v2,
+// so their pools are told apart by their factory, cached by the resolver.
+func LabelAerodromePool(config *Config, runtime cre.Runtime, evmClient *evm.Client, action *Action) error {
+	if action.Pool == (common.Address{}) {
+		return nil
+	}
+	pool, err := GetVelodromePool(runtime, evmClient, action.Pool)
+	if err != nil {
+		return err
+	}
+	for _, factory := range config.AerodromeFactories {
+		if factory.Address == pool.Factory {
+			action.Protocol = aerodromeProtocol
+			return nil
+		}
+	}
+	return nil
+}
+
+// ResolveVelodromeBurn settles a Velodrome or Aerodrome liquidity removal from
+// the Burn event the router triggered on the pool. Both amounts are credited
+// in the pool's token0 and token1. For removeLiquidityETH the recipient of the
+// burn is the router, which receives WETH before unwrapping it.
+func ResolveVelodromeBurn(runtime cre.Runtime, evmClient *evm.Client, logger *slog.Logger, action *Action, calldata []byte, txHash []byte) error {
+	reply, err := evmClient.GetTransactionReceipt(runtime, &evm.GetTransactionReceiptRequest{Hash: txHash}).Await()
+	if err != nil {
+		return fmt.Errorf("failed to get transaction receipt: %w", err)
+	}
+	if reply.Receipt == nil {
+		return fmt.Errorf("transaction receipt not found")
+	}
+
+	for _, log := range reply.Receipt.Logs {
+		if len(log.Topics) < 3 || len(log.Data) < 64 || !bytes.Equal(log.Topics[0], velodromeBurnSignature.Bytes()) ||
+			common.BytesToAddress(log.Topics[1]) != action.Counterparty {
+			continue
+		}
+		pool, err := GetVelodromePool(runtime, evmClient, common.BytesToAddress(log.Address))
+		if err != nil {
+			return err
+		}
+		action.Pool = pool.Address
+
+		for i, token := range []common.Address{pool.Token0, pool.Token1} {
+			amount := new(big.Int).SetBytes(log.Data[i*32 : (i+1)*32])
+			if amount.Sign() == 0 {
+				continue
+			}
+			action.AssetsIn = append(action.AssetsIn, AssetAmount{Token: token, Amount: amount})
+			logger.Info("Velodrome liquidity removed", "pool", pool.Address.Hex(), "token", token.Hex(), "amount", amount.String())
+		}
+	}
+
+	if len(action.AssetsIn) == 0 {
+		return fmt.Errorf("no Velodrome burn by router %s in receipt", action.Counterparty.Hex())
+	}
+	return nil
+}
+
+// ResolveVelodromeGaugeWithdraw settles a withdraw(uint256) from a Velodrome or
+// Aerodrome gauge, which shares its selector with Yearn v2 vaults. Unstaking
+// only moves the pool's LP tokens from the gauge back to the Safe, so the
+// amount of the gauge's Withdraw event is accounted as the LP token both in
+// and out; the reserves are credited when the liquidity is removed. A call
+// without the event, or to a contract without a stakingToken, is left to the
+// fallback decoders.
+func ResolveVelodromeGaugeWithdraw(runtime cre.Runtime, evmClient *evm.Client, logger *slog.Logger, action *Action, receipt *evm.Receipt) error {
+	withdrawn := new(big.Int)
+	found := false
+	for _, log := range receipt.Logs {
+		if common.BytesToAddress(log.Address) != action.Counterparty || len(log.Topics) != 2 || len(log.Data) < 32 ||
+			!bytes.Equal(log.Topics[0], velodromeGaugeWithdrawSignature.Bytes()) {
+			continue
+		}
+		withdrawn.Add(withdrawn, new(big.Int).SetBytes(log.Data[:32]))
+		found = true
+	}
+	if !found {
+		return fmt.Errorf("%w: no gauge Withdraw from %s in receipt", ErrUnknownSelector, action.Counterparty.Hex())
+	}
+
+	poolAddress, ok := state.VaultAssets[action.Counterparty.Hex()]
+	if !ok {
+		var err error
+		if poolAddress, err = callVelodromeAddress(runtime, evmClient, action.Counterparty, "stakingToken"); err != nil {
+			return fmt.Errorf("%w: %s is not a Velodrome gauge: %s", ErrUnknownSelector, action.Counterparty.Hex(), err.Error())
+		}
+		state.VaultAssets[action.Counterparty.Hex()] = poolAddress
+	}
+
+	action.Protocol = velodromeProtocol
+	action.Pool = poolAddress
+	action.AssetsIn = []AssetAmount{{Token: poolAddress, Amount: withdrawn}}
+	action.AssetsOut = []AssetAmount{{Token: poolAddress, Amount: new(big.Int).Set(withdrawn)}}
+	logger.Info("Gauge unstaked", "gauge", action.Counterparty.Hex(), "pool", poolAddress.Hex(), "liquidity", withdrawn.String())
+	return nil
+}
@@ -0,0 +1,166 @@
+//go:build wasip1
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/blockchain/evm"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+)
+
+// Policies for events whose timestamp does not match their block
+const (
+	// SkewFlag logs an alert and keeps processing the event
+	SkewFlag = "flag"
+
+	// SkewReject refuses to process the event
+	SkewReject = "reject"
+)
+
+// ClockSkewConfig represents the accepted difference between the timestamp
+// carried by ProtocolExecuted and the timestamp of the block containing it
+type ClockSkewConfig struct {
+	ToleranceSeconds uint64 `json:"toleranceSeconds"`
+	Policy           string `json:"policy,omitempty"`
+}
+
+// ErrEventSkew is returned when an event timestamp is outside the tolerance
+var ErrEventSkew = fmt.Errorf("event timestamp skew")
+
+// CheckEventSkew compares the event timestamp against the block timestamp.
+// The module emits block.timestamp, so any skew beyond the tolerance points
+// to a spoofed or replayed event. It returns ErrEventSkew only under the
+// reject policy; flagged anomalies are logged.
+func CheckEventSkew(config *Config, runtime cre.Runtime, evmClient *evm.Client, log *evm.Log, eventTime time.Time) error {
+	skew := config.ClockSkew
+	if skew == nil {
+		return nil
+	}
+
+	if eventTime.IsZero() || log.BlockNumber == nil {
+		RaiseAlert(config, runtime, slog.LevelError, "ALERT: event timestamp cannot be verified", "", "hasTimestamp", !eventTime.IsZero(), "hasBlock", log.BlockNumber != nil)
+		if skew.Policy == SkewReject {
+			return fmt.Errorf("%w: missing event timestamp or block number", ErrEventSkew)
+		}
+		return nil
+	}
+
+	blockTime, err := LogBlockTime(runtime, evmClient, log)
+	if err != nil {
+		return err
+	}
+	diff := eventTime.Sub(blockTime)
+	if diff < 0 {
+		diff = -diff
+	}
+	if diff <= seconds(skew.ToleranceSeconds) {
+		return nil
+	}
+
+	RaiseAlert(config, runtime, slog.LevelError, "ALERT: event timestamp skew", "", "eventTime", eventTime.Unix(), "blockTime", blockTime.Unix(),
+		"skew", diff.String(), "tolerance", seconds(skew.ToleranceSeconds).String())
+	if skew.Policy == SkewReject {
+		return fmt.Errorf("%w: event %d, block %d", ErrEventSkew, eventTime.Unix(), blockTime.Unix())
+	}
+	return nil
+}
+
+// ErrUnknownEmitter is returned for logs not emitted by a configured module
+var ErrUnknownEmitter = fmt.Errorf("log emitted by unknown contract")
+
+// triggerModules returns the modules whose logs the workflow processes
+func triggerModules(config *Config) []common.Address {
+	modules := []common.Address{config.ModuleAddress.Address}
+	if config.Migration != nil {
+		modules = append(modules, config.Migration.NewModule.ModuleAddress.Address)
+	}
+	return modules
+}
+
+// VerifyEmitter checks that a log was emitted by exactly one of the configured
+// modules and, when an expected code hash is configured for it, that the
+// deployed code matches. Code hashes are checked once per module.
+func VerifyEmitter(config *Config, runtime cre.Runtime, evmClient *evm.Client, log *evm.Log) error {
+	if len(log.Address) != common.AddressLength {
+		return fmt.Errorf("%w: malformed address 0x%x", ErrUnknownEmitter, log.Address)
+	}
+	emitter := common.BytesToAddress(log.Address)
+
+	known := false
+	for _, module := range triggerModules(config) {
+		if module == emitter {
+			known = true
+			break
+		}
+	}
+	if !known {
+		return fmt.Errorf("%w: %s", ErrUnknownEmitter, emitter.Hex())
+	}
+
+	expected, ok := expectedCodeHash(config, emitter)
+	if !ok || state.CodeHashVerified[emitter.Hex()] {
+		return nil
+	}
+
+	actual, err := GetCodeHash(runtime, evmClient, emitter)
+	if err != nil {
+		return err
+	}
+	if actual != expected {
+		return fmt.Errorf("%w: code hash of %s is %s, expected %s", ErrUnknownEmitter, emitter.Hex(), actual.Hex(), expected.Hex())
+	}
+
+	state.CodeHashVerified[emitter.Hex()] = true
+	return nil
+}
+
+// expectedCodeHash returns the configured code hash of a module, if any
+func expectedCodeHash(config *Config, module common.Address) (common.Hash, bool) {
+	hash, ok := config.ModuleCodeHashes[NewAddress(module)]
+	if !ok {
+		return common.Hash{}, false
+	}
+	return common.HexToHash(hash), true
+}
+
+// GetCodeHash returns the EXTCODEHASH of a contract. The EVM capability has no
+// code query, so the call runs init code without a target that returns the hash:
+// PUSH20 addr, EXTCODEHASH, PUSH1 0, MSTORE, PUSH1 32, PUSH1 0, RETURN
+func GetCodeHash(runtime cre.Runtime, evmClient *evm.Client, addr common.Address) (common.Hash, error) {
+	code := append([]byte{0x73}, addr.Bytes()...)
+	code = append(code, 0x3f, 0x60, 0x00, 0x52, 0x60, 0x20, 0x60, 0x00, 0xf3)
+
+	result, err := evmClient.CallContract(runtime, &evm.CallContractRequest{
+		Call: &evm.CallMsg{Data: code},
+	}).Await()
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("failed to get code hash of %s: %w", addr.Hex(), err)
+	}
+	if len(result.Data) != common.HashLength {
+		return common.Hash{}, fmt.Errorf("unexpected code hash result length %d", len(result.Data))
+	}
+
+	return common.BytesToHash(result.Data), nil
+}
+
+// LogBlockTime returns the timestamp of the block a log was mined in, for
+// events that carry no timestamp of their own
+func LogBlockTime(runtime cre.Runtime, evmClient *evm.Client, log *evm.Log) (time.Time, error) {
+	if log.BlockNumber == nil {
+		return time.Time{}, fmt.Errorf("log has no block number")
+	}
+	reply, err := evmClient.HeaderByNumber(runtime, &evm.HeaderByNumberRequest{
+		BlockNumber: log.BlockNumber,
+	}).Await()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get block header: %w", err)
+	}
+	if reply.Header == nil {
+		return time.Time{}, fmt.Errorf("block header not found")
+	}
+	return time.Unix(int64(reply.Header.Timestamp), 0), nil
+}
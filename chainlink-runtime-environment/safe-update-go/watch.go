@@ -0,0 +1,290 @@
+//go:build wasip1
+
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/blockchain/evm"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+)
+
+// WatchConfig represents external addresses whose token flows are reported
+// without submitting allowance updates, e.g. the Safe avatar itself
+type WatchConfig struct {
+	Addresses        []WatchedAddress `json:"addresses"`
+	RetentionSeconds uint64           `json:"retentionSeconds,omitempty"`
+}
+
+// WatchedAddress represents one watch-only address
+type WatchedAddress struct {
+	Address Address `json:"address"`
+	Label   string  `json:"label,omitempty"`
+}
+
+// WatchFlow represents a token transfer into or out of a watched address
+type WatchFlow struct {
+	TxHash   string
+	LogIndex uint32
+	Address  string
+	Label    string
+	Symbol   string
+	Amount   *big.Int
+	USDValue *big.Int
+	At       time.Time
+}
+
+// FlowSummary represents the aggregated flows of one address and token
+type FlowSummary struct {
+	Address    string `json:"address"`
+	Label      string `json:"label,omitempty"`
+	Source     string `json:"source"`
+	Symbol     string `json:"symbol,omitempty"`
+	InflowUSD  string `json:"inflowUsd"`
+	OutflowUSD string `json:"outflowUsd"`
+	NetUSD     string `json:"netUsd"`
+	Count      int    `json:"count"`
+}
+
+// flowsParams represents the parameters of the flows admin method
+type flowsParams struct {
+	Since int64 `json:"since,omitempty"`
+}
+
+// defaultWatchRetention keeps watched flows when no retention is configured
+const defaultWatchRetention = 7 * 24 * time.Hour
+
+// transferSignature is the topic of ERC20 Transfer(address indexed from, address indexed to, uint256 value)
+var transferSignature = crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)"))
+
+func init() {
+	RegisterAdminMethod("flows", adminFlows)
+}
+
+// ValidateWatch checks the watch-only configuration
+func ValidateWatch(watch *WatchConfig) error {
+	if watch == nil {
+		return nil
+	}
+	if len(watch.Addresses) == 0 {
+		return fmt.Errorf("at least one address is required")
+	}
+	for i, watched := range watch.Addresses {
+		if !watched.Address.IsSet() {
+			return fmt.Errorf("address %d: address is required", i)
+		}
+	}
+	return nil
+}
+
+// watchRetention returns how long watched flows are kept
+func watchRetention(watch *WatchConfig) time.Duration {
+	if watch.RetentionSeconds == 0 {
+		return defaultWatchRetention
+	}
+	return seconds(watch.RetentionSeconds)
+}
+
+// watchedAddress returns the watch entry of an address, if watched
+func watchedAddress(watch *WatchConfig, addr common.Address) (WatchedAddress, bool) {
+	for _, watched := range watch.Addresses {
+		if watched.Address.Address == addr {
+			return watched, true
+		}
+	}
+	return WatchedAddress{}, false
+}
+
+// watchTriggers creates the Transfer log triggers of the configured tokens:
+// one matching watched senders and one matching watched recipients, since
+// topic filters of different positions must all match
+func watchTriggers(config *Config, chainSelector uint64) []cre.Trigger[*evm.Log, *evm.Log] {
+	// Native ETH moves without Transfer events
+	var tokens [][]byte
+	for _, token := range config.Tokens {
+		if !token.IsNative() {
+			tokens = append(tokens, token.Address.Bytes())
+		}
+	}
+	watched := make([][]byte, len(config.Watch.Addresses))
+	for i, w := range config.Watch.Addresses {
+		watched[i] = common.LeftPadBytes(w.Address.Bytes(), 32)
+	}
+
+	from := evm.LogTrigger(chainSelector, &evm.FilterLogTriggerRequest{
+		Addresses: tokens,
+		Topics: []*evm.TopicValues{
+			{Values: [][]byte{transferSignature.Bytes()}},
+			{Values: watched},    // from
+			{Values: [][]byte{}}, // to (any)
+		},
+	})
+	to := evm.LogTrigger(chainSelector, &evm.FilterLogTriggerRequest{
+		Addresses: tokens,
+		Topics: []*evm.TopicValues{
+			{Values: [][]byte{transferSignature.Bytes()}},
+			{Values: [][]byte{}}, // from (any)
+			{Values: watched},    // to
+		},
+	})
+	return []cre.Trigger[*evm.Log, *evm.Log]{from, to}
+}
+
+// OnWatchedTransfer is the handler for Transfer events of watched addresses.
+// Flows are valued and recorded for reporting; nothing is submitted.
+func OnWatchedTransfer(config *Config, runtime cre.Runtime, payload *evm.Log) (*ExecutionResult, error) {
+	logger := runtime.Logger()
+
+	if len(payload.Topics) < 3 || len(payload.Data) < 32 {
+		return nil, fmt.Errorf("invalid Transfer log format")
+	}
+	token := common.BytesToAddress(payload.Address)
+	if findTokenConfig(config, token) == nil {
+		return nil, fmt.Errorf("%w: %s is not a configured token", ErrUnknownEmitter, token.Hex())
+	}
+
+	from := common.BytesToAddress(payload.Topics[1])
+	to := common.BytesToAddress(payload.Topics[2])
+	amount := new(big.Int).SetBytes(payload.Data[:32])
+	txHash := "0x" + hex.EncodeToString(payload.TxHash)
+	evmClient := newEVMClient(config)
+	now := runtime.Now()
+
+	state.PruneWatchFlows(now.Add(-watchRetention(config.Watch)))
+
+	recorded := 0
+	for _, side := range []struct {
+		addr common.Address
+		sign int64
+	}{{to, 1}, {from, -1}} {
+		watched, ok := watchedAddress(config.Watch, side.addr)
+		if !ok {
+			continue
+		}
+		// A transfer between two watched addresses is delivered by both triggers
+		if state.HasWatchFlow(txHash, payload.Index, side.addr.Hex()) {
+			continue
+		}
+
+		delta, err := valueAsset(config, runtime, evmClient, logger, AssetAmount{Token: token, Amount: amount}, side.sign, false)
+		if err != nil {
+			return nil, err
+		}
+
+		state.RecordWatchFlow(WatchFlow{
+			TxHash:   txHash,
+			LogIndex: payload.Index,
+			Address:  side.addr.Hex(),
+			Label:    watched.Label,
+			Symbol:   delta.Symbol,
+			Amount:   delta.Amount,
+			USDValue: delta.USDValue,
+			At:       now,
+		})
+		logger.Info("Watched flow", "address", side.addr.Hex(), "label", watched.Label, "symbol", delta.Symbol,
+			"amount", delta.Amount.String(), "usd", FormatUSD(config, delta.USDValue), "txHash", txHash)
+		recorded++
+	}
+
+	return &ExecutionResult{Message: fmt.Sprintf("Recorded %d watched flows", recorded), Success: true}, nil
+}
+
+// RecordWatchFlow appends a flow of a watched address
+func (s *WorkflowState) RecordWatchFlow(flow WatchFlow) {
+	s.WatchFlows = append(s.WatchFlows, flow)
+}
+
+// HasWatchFlow reports whether the flow of a log for an address is already recorded
+func (s *WorkflowState) HasWatchFlow(txHash string, logIndex uint32, address string) bool {
+	for _, flow := range s.WatchFlows {
+		if flow.TxHash == txHash && flow.LogIndex == logIndex && flow.Address == address {
+			return true
+		}
+	}
+	return false
+}
+
+// PruneWatchFlows drops flows older than a point in time
+func (s *WorkflowState) PruneWatchFlows(before time.Time) {
+	kept := s.WatchFlows[:0]
+	for _, flow := range s.WatchFlows {
+		if !flow.At.Before(before) {
+			kept = append(kept, flow)
+		}
+	}
+	s.WatchFlows = kept
+}
+
+// addFlow adds a signed USD value to a summary's inflow or outflow
+func addFlow(summary *FlowSummary, inflow, outflow *big.Int, value *big.Int) {
+	if value.Sign() >= 0 {
+		inflow.Add(inflow, value)
+	} else {
+		outflow.Sub(outflow, value)
+	}
+	summary.Count++
+}
+
+// ConsolidatedFlows aggregates the flows of watched addresses per token and
+// the net ledger values of subaccounts since a point in time
+func ConsolidatedFlows(config *Config, s *WorkflowState, since time.Time) []FlowSummary {
+	type totals struct {
+		summary FlowSummary
+		inflow  *big.Int
+		outflow *big.Int
+	}
+	var order []string
+	byKey := make(map[string]*totals)
+	get := func(key string, summary FlowSummary) *totals {
+		t, ok := byKey[key]
+		if !ok {
+			t = &totals{summary: summary, inflow: new(big.Int), outflow: new(big.Int)}
+			byKey[key] = t
+			order = append(order, key)
+		}
+		return t
+	}
+
+	for _, flow := range s.WatchFlows {
+		if flow.At.Before(since) {
+			continue
+		}
+		t := get("watch:"+flow.Address+":"+flow.Symbol, FlowSummary{Address: flow.Address, Label: flow.Label, Source: "watch", Symbol: flow.Symbol})
+		addFlow(&t.summary, t.inflow, t.outflow, flow.USDValue)
+	}
+	for _, entry := range s.Ledger {
+		if entry.At.Before(since) {
+			continue
+		}
+		t := get("module:"+strings.ToLower(entry.SubAccount), FlowSummary{Address: entry.SubAccount, Source: "module"})
+		addFlow(&t.summary, t.inflow, t.outflow, entry.NetUSD)
+	}
+
+	summaries := make([]FlowSummary, len(order))
+	for i, key := range order {
+		t := byKey[key]
+		t.summary.InflowUSD = FormatUSD(config, t.inflow)
+		t.summary.OutflowUSD = FormatUSD(config, t.outflow)
+		t.summary.NetUSD = FormatUSD(config, new(big.Int).Sub(t.inflow, t.outflow))
+		summaries[i] = t.summary
+	}
+	return summaries
+}
+
+// adminFlows reports the consolidated flows of watched addresses and subaccounts
+func adminFlows(config *Config, runtime cre.Runtime, caller common.Address, params json.RawMessage) (interface{}, error) {
+	var p flowsParams
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, fmt.Errorf("invalid params: %w", err)
+		}
+	}
+	return ConsolidatedFlows(config, state, time.Unix(p.Since, 0)), nil
+}
@@ -0,0 +1,243 @@
+//go:build wasip1
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/blockchain/evm"
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/scheduler/cron"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+)
+
+// WorkflowBuilder composes the accounting workflow from a configuration, so
+// variations such as other modules, monitor-only instances or other policies
+// are built from this package instead of forking InitWorkflow. Options apply
+// to the configuration every handler of the built workflow receives.
+type WorkflowBuilder struct {
+	config   *Config
+	logger   *slog.Logger
+	decoders []DecoderRegistration
+	pricing  PriceSource
+	err      error
+}
+
+// DecoderRegistration represents a protocol decoder added to a workflow. The
+// receipt resolver is optional and settles the actions of Protocol, which it
+// requires.
+type DecoderRegistration struct {
+	Selector  string
+	Signature string
+	Decoder   ActionDecoder
+	Protocol  string
+	Resolver  ReceiptResolver
+}
+
+// NewAccountingWorkflow starts building the workflow of a configuration, with
+// every registered protocol and the configured pricing and policy
+func NewAccountingWorkflow(config *Config) *WorkflowBuilder {
+	return &WorkflowBuilder{config: config, logger: slog.Default()}
+}
+
+// WithLogger sets the logger of the build
+func (b *WorkflowBuilder) WithLogger(logger *slog.Logger) *WorkflowBuilder {
+	b.logger = logger
+	return b
+}
+
+// WithDecoders adds protocol decoders next to the registered ones
+func (b *WorkflowBuilder) WithDecoders(decoders ...DecoderRegistration) *WorkflowBuilder {
+	b.decoders = append(b.decoders, decoders...)
+	return b
+}
+
+// WithPricing replaces how tokens are priced. The source may fall back on
+// DefaultPriceSource for the tokens it does not price itself.
+func (b *WorkflowBuilder) WithPricing(source PriceSource) *WorkflowBuilder {
+	if source == nil {
+		b.err = fmt.Errorf("pricing: price source is nil")
+	}
+	b.pricing = source
+	return b
+}
+
+// WithPolicy replaces the policy of the configuration; nil removes it
+func (b *WorkflowBuilder) WithPolicy(policy *PolicyConfig) *WorkflowBuilder {
+	b.config.Policy = policy
+	return b
+}
+
+// MonitorOnly builds a workflow that decodes, values and records actions
+// without ever updating allowances
+func (b *WorkflowBuilder) MonitorOnly() *WorkflowBuilder {
+	b.config.MonitorOnly = true
+	return b
+}
+
+// Build validates the configuration, sets the added decoders and pricing on
+// it, and returns the handlers of the workflow. The registered decoders and
+// the pricing of other workflows are left unchanged.
+func (b *WorkflowBuilder) Build() (cre.Workflow[*Config], error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	config, logger := b.config, b.logger
+
+	decoders := registeredDecoders
+	if len(b.decoders) > 0 {
+		decoders = registeredDecoders.Clone()
+	}
+	for _, registration := range b.decoders {
+		if err := decoders.AddDecoder(registration.Selector, registration.Signature, registration.Decoder); err != nil {
+			return nil, fmt.Errorf("decoders: %w", err)
+		}
+		if registration.Resolver == nil {
+			continue
+		}
+		if err := decoders.AddResolver(registration.Protocol, registration.Resolver); err != nil {
+			return nil, fmt.Errorf("decoders: %w", err)
+		}
+	}
+	config.decoders, config.pricing = decoders, b.pricing
+
+	if err := ValidateConfig(config); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	hash, err := ConfigHash(config)
+	if err != nil {
+		return nil, err
+	}
+	activeConfigHash = hash
+	logger.Info("Config loaded", "configHash", hash, "chain", config.ChainSelector.Name(), "environment", config.Environment)
+
+	if config.Sharding != nil {
+		logger.Info("Sharding enabled", "index", config.Sharding.Index, "count", config.Sharding.Count,
+			"fingerprint", ShardFingerprint(config.Sharding))
+	}
+
+	// Create EVM log trigger for ProtocolExecuted events
+	moduleAddr := config.ModuleAddress.Address
+	addresses := [][]byte{moduleAddr.Bytes()}
+
+	// Subaccounts move to the new module during a migration
+	if config.Migration != nil {
+		addresses = append(addresses, config.Migration.NewModule.ModuleAddress.Bytes())
+	}
+
+	subAccounts, err := subAccountTopics(config)
+	if err != nil {
+		return nil, err
+	}
+
+	logTrigger := evm.LogTrigger(config.ChainSelector.Uint64(), &evm.FilterLogTriggerRequest{
+		Addresses: addresses,
+		Topics: []*evm.TopicValues{
+			{Values: [][]byte{protocolExecutedSignature.Bytes()}},
+			{Values: subAccounts}, // subAccount (any unless configured)
+			{Values: [][]byte{}},  // target (any)
+			{Values: [][]byte{}},  // timestamp (not indexed, but we need 4 topic slots)
+		},
+	})
+
+	workflow := cre.Workflow[*Config]{
+		cre.Handler(logTrigger, withStateStore(OnProtocolExecuted)),
+	}
+
+	// Watch-only addresses are monitored by the first shard so flows are recorded once
+	if config.Watch != nil && (config.Sharding == nil || config.Sharding.Index == 0) {
+		for _, trigger := range watchTriggers(config, config.ChainSelector.Uint64()) {
+			workflow = append(workflow, cre.Handler(trigger, withStateStore(OnWatchedTransfer)))
+		}
+	}
+
+	// Module pauses and unpauses start and flush the pause queue
+	if config.ModulePause != nil && !config.MonitorOnly {
+		workflow = append(workflow, cre.Handler(modulePauseTrigger(config, addresses), withStateStore(OnModulePauseEvent)))
+	}
+
+	// Allowance updates the workflow did not submit are merged into the ledger.
+	// Its own submissions are only recognized through the persistent store.
+	if config.AllowanceEvents != nil && PersistentStore(config) {
+		workflow = append(workflow, cre.Handler(allowancesUpdatedTrigger(config, addresses, subAccounts), withStateStore(OnAllowancesUpdated)))
+	}
+
+	// Admin changes made by other actors are alerted by the first shard so they alert once
+	if config.AdminAlerts != nil && (config.Sharding == nil || config.Sharding.Index == 0) {
+		workflow = append(workflow, cre.Handler(adminEventsTrigger(config, addresses), withStateStore(OnAdminEvent)))
+	}
+
+	// Trades settling orders pre-signed by subaccounts are accounted when they land
+	if config.CowSwap != nil {
+		workflow = append(workflow, cre.Handler(cowSwapTradeTrigger(config), withStateStore(OnCowSwapTrade)))
+	}
+	if config.GMX != nil {
+		workflow = append(workflow, cre.Handler(gmxWithdrawalTrigger(config), withStateStore(OnGMXWithdrawalEvent)))
+	}
+
+	// Health checks evaluate SLAs on a schedule
+	if config.HealthCheckSchedule != "" {
+		workflow = append(workflow, cre.Handler(cron.Trigger(&cron.Config{Schedule: config.HealthCheckSchedule}), withStateStore(OnHealthCheck)))
+	}
+
+	// Dead letters are retried on a schedule
+	if config.Retry != nil && config.Retry.Schedule != "" && !config.MonitorOnly {
+		workflow = append(workflow, cre.Handler(cron.Trigger(&cron.Config{Schedule: config.Retry.Schedule}), withStateStore(OnRetryDeadLetters)))
+	}
+
+	// Batched updates of degraded processing are flushed on a schedule
+	if config.Backpressure != nil && !config.MonitorOnly {
+		workflow = append(workflow, cre.Handler(cron.Trigger(&cron.Config{Schedule: config.Backpressure.FlushSchedule}), withStateStore(OnFlushBatch)))
+	}
+
+	// Migration steps run on a schedule until the active module is switched
+	if config.Migration != nil && config.Migration.Schedule != "" && !config.MonitorOnly {
+		workflow = append(workflow, cre.Handler(cron.Trigger(&cron.Config{Schedule: config.Migration.Schedule}), withStateStore(OnMigrationStep)))
+	}
+
+	// The decision hash chain is anchored on a schedule
+	if config.DecisionLog != nil && config.DecisionLog.AnchorSchedule != "" {
+		workflow = append(workflow, cre.Handler(cron.Trigger(&cron.Config{Schedule: config.DecisionLog.AnchorSchedule}), withStateStore(OnAnchorDecisions)))
+	}
+
+	// Decoder regressions are sampled on a schedule by the first shard
+	if config.Regression != nil && (config.Sharding == nil || config.Sharding.Index == 0) {
+		workflow = append(workflow, cre.Handler(cron.Trigger(&cron.Config{Schedule: config.Regression.Schedule}), withStateStore(OnRegressionSample)))
+	}
+
+	// Audit and ledger data is compacted on a schedule
+	if config.Retention != nil {
+		workflow = append(workflow, cre.Handler(cron.Trigger(&cron.Config{Schedule: config.Retention.Schedule}), withStateStore(OnCompaction)))
+	}
+
+	// The admin API is served over an HTTP trigger
+	if config.Admin != nil && len(config.Admin.AuthorizedKeys) > 0 {
+		workflow = append(workflow, cre.Handler(authorizedHTTPTrigger(config.Admin.AuthorizedKeys), withStateStore(OnAdminRequest)))
+	}
+
+	// Subaccount owners query their own accounting over a separate HTTP trigger
+	if config.OwnerAPI != nil && len(config.OwnerAPI.AuthorizedKeys) > 0 {
+		workflow = append(workflow, cre.Handler(authorizedHTTPTrigger(config.OwnerAPI.AuthorizedKeys), withStateStore(OnOwnerRequest)))
+	}
+
+	// Self-tests run on a schedule and on request of on-call keys
+	if config.SelfTest != nil {
+		if config.SelfTest.Schedule != "" {
+			workflow = append(workflow, cre.Handler(cron.Trigger(&cron.Config{Schedule: config.SelfTest.Schedule}), OnSelfTestCron))
+		}
+		if len(config.SelfTest.AuthorizedKeys) > 0 {
+			workflow = append(workflow, cre.Handler(authorizedHTTPTrigger(config.SelfTest.AuthorizedKeys), OnSelfTestHTTP))
+		}
+	}
+
+	return workflow, nil
+}
+
+// decoderSet returns the decoders of the workflow built from the config
+func (c *Config) decoderSet() *DecoderSet {
+	if c.decoders != nil {
+		return c.decoders
+	}
+	return registeredDecoders
+}
@@ -0,0 +1,162 @@
+//go:build wasip1
+
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/blockchain/evm"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+	"github.com/smartcontractkit/cre-sdk-go/cre/testutils"
+
+	"safe-update-go/scenarios"
+)
+
+// acmeExitSelector is the selector of exit(uint256), which no registered decoder handles
+const acmeExitSelector = "7f8661a1"
+
+// decodeAcmeExit decodes the exit of the test protocol acme
+func decodeAcmeExit(logger *slog.Logger, target common.Address, calldata []byte) (*Action, error) {
+	amount, err := calldataUint(calldata, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &Action{Protocol: "acme", Verb: VerbWithdraw, AssetsIn: []AssetAmount{{Token: scenarios.Token, Amount: amount}}}, nil
+}
+
+// resolveAcmeExit leaves the decoded exit as it is
+func resolveAcmeExit(runtime cre.Runtime, evmClient *evm.Client, logger *slog.Logger, action *Action, calldata []byte, txHash []byte) error {
+	return nil
+}
+
+// TestBuildKeepsDecodersOnConfig expects the decoders added by a build to be
+// kept on its config, so the same decoders can be built twice and the
+// registered decoders are left unchanged
+func TestBuildKeepsDecodersOnConfig(t *testing.T) {
+	registration := DecoderRegistration{Selector: acmeExitSelector, Signature: "exit(uint256)", Decoder: decodeAcmeExit,
+		Protocol: "acme", Resolver: resolveAcmeExit}
+	calldata := append(common.FromHex(acmeExitSelector), common.LeftPadBytes(big.NewInt(42).Bytes(), 32)...)
+	logger := slog.New(slog.DiscardHandler)
+
+	for i := 0; i < 2; i++ {
+		config := scenarioConfig(t, "null")
+		if _, err := NewAccountingWorkflow(config).WithLogger(logger).WithDecoders(registration).Build(); err != nil {
+			t.Fatalf("build %d: %v", i, err)
+		}
+		action, err := config.decoderSet().DecodeAction(logger, scenarios.Token, calldata)
+		if err != nil {
+			t.Fatalf("build %d: %v", i, err)
+		}
+		if action.Protocol != "acme" || action.AssetsIn[0].Amount.Int64() != 42 {
+			t.Errorf("build %d decoded %+v", i, action)
+		}
+		if _, ok := config.decoderSet().Resolver("acme"); !ok {
+			t.Errorf("build %d has no acme resolver", i)
+		}
+	}
+
+	if _, err := DecodeAction(logger, scenarios.Token, calldata); !errors.Is(err, ErrUnknownSelector) {
+		t.Errorf("registered decoders decode the added selector: %v", err)
+	}
+	if _, ok := registeredDecoders.Resolver("acme"); ok {
+		t.Error("registered decoders have the added resolver")
+	}
+
+	config := scenarioConfig(t, "null")
+	if _, err := NewAccountingWorkflow(config).WithLogger(logger).Build(); err != nil {
+		t.Fatal(err)
+	}
+	if config.decoderSet() != registeredDecoders {
+		t.Error("a build without added decoders copied the registered ones")
+	}
+}
+
+func TestBuildRejectsDecoders(t *testing.T) {
+	tests := []struct {
+		name         string
+		registration DecoderRegistration
+	}{
+		{"registered selector", DecoderRegistration{Selector: YearnV2WithdrawSelector, Signature: "withdraw(uint256)", Decoder: decodeAcmeExit}},
+		{"wrong signature", DecoderRegistration{Selector: acmeExitSelector, Signature: "exit(uint128)", Decoder: decodeAcmeExit}},
+		{"resolver without protocol", DecoderRegistration{Selector: acmeExitSelector, Signature: "exit(uint256)", Decoder: decodeAcmeExit,
+			Resolver: resolveAcmeExit}},
+		{"registered resolver", DecoderRegistration{Selector: acmeExitSelector, Signature: "exit(uint256)", Decoder: decodeAcmeExit,
+			Protocol: yearnProtocol, Resolver: resolveAcmeExit}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := scenarioConfig(t, "null")
+			if _, err := NewAccountingWorkflow(config).WithLogger(slog.New(slog.DiscardHandler)).WithDecoders(tt.registration).Build(); err == nil {
+				t.Error("built")
+			}
+		})
+	}
+}
+
+// TestBuildKeepsPricingOnConfig expects the pricing of a build to apply to
+// its config only, quote tokens included
+func TestBuildKeepsPricingOnConfig(t *testing.T) {
+	logger := slog.New(slog.DiscardHandler)
+	// USDC at $2 with 8 decimals
+	usdcAtTwo := func(config *Config, runtime cre.Runtime, evmClient *evm.Client, logger *slog.Logger, tokenConfig *TokenConfig) (*big.Int, uint8, error) {
+		if tokenConfig.Symbol == "USDC" {
+			return big.NewInt(2e8), 8, nil
+		}
+		return DefaultPriceSource(config, runtime, evmClient, logger, tokenConfig)
+	}
+
+	config := scenarioConfig(t, "null")
+	config.Tokens = append(config.Tokens, TokenConfig{Address: NewAddress(common.HexToAddress("0xaa")), Symbol: "pUSD", Type: "erc20",
+		PriceFeedQuote: "USDC", Pegged: true})
+	if _, err := NewAccountingWorkflow(config).WithLogger(logger).WithPricing(usdcAtTwo).Build(); err != nil {
+		t.Fatal(err)
+	}
+	other := scenarioConfig(t, "null")
+	if _, err := NewAccountingWorkflow(other).WithLogger(logger).Build(); err != nil {
+		t.Fatal(err)
+	}
+	if other.pricing != nil {
+		t.Error("pricing leaked into another build")
+	}
+
+	// The pegged token is priced through its quote token, by the build's pricing
+	runtime := testutils.NewRuntime(t, nil)
+	price, decimals, err := config.priceSource()(config, runtime, nil, logger, findTokenBySymbol(config, "pUSD"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if price.Cmp(big.NewInt(2e8)) != 0 || decimals != 8 {
+		t.Errorf("priced %s with %d decimals", price, decimals)
+	}
+}
+
+// TestBuildRejectsShardWithoutSubaccounts expects a shard that owns none of
+// the listed subaccounts to fail the build, since its empty topic filter
+// would subscribe it to every subaccount
+func TestBuildRejectsShardWithoutSubaccounts(t *testing.T) {
+	pinned := map[string]uint64{scenarios.SubAccount.Hex(): 0}
+	tests := []struct {
+		name    string
+		index   uint64
+		wantErr bool
+	}{
+		{"shard owning the subaccount", 0, false},
+		{"shard owning none", 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := scenarioConfig(t, "null")
+			config.SubAccounts = []Address{{Address: scenarios.SubAccount}}
+			config.Sharding = &ShardingConfig{Count: 2, Index: tt.index, Pinned: pinned}
+
+			_, err := NewAccountingWorkflow(config).WithLogger(slog.New(slog.DiscardHandler)).Build()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("build error %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+//go:build wasip1
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"math"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/blockchain/evm"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+
+	"safe-update-go/fixedpoint"
+)
+
+// Yearn v2 vault ABI (token, pricePerShare and decimals)
+const yearnV2ABI = `[
+	{"constant":true,"inputs":[],"name":"token","outputs":[{"name":"","type":"address"}],"type":"function"},
+	{"constant":true,"inputs":[],"name":"pricePerShare","outputs":[{"name":"","type":"uint256"}],"type":"function"},
+	{"constant":true,"inputs":[],"name":"decimals","outputs":[{"name":"","type":"uint256"}],"type":"function"}
+]`
+
+// Withdraw(address indexed recipient, uint256 shares, uint256 amount), emitted by Yearn v2 vaults
+var yearnV2WithdrawSignature = crypto.Keccak256Hash([]byte("Withdraw(address,uint256,uint256)"))
+
+// callYearnV2Vault calls a view function of a Yearn v2 vault at a block
+func callYearnV2Vault(runtime cre.Runtime, evmClient *evm.Client, vault common.Address, method string, out interface{}, receipt *evm.Receipt) error {
+	parsedYearnABI, err := abi.JSON(strings.NewReader(yearnV2ABI))
+	if err != nil {
+		return fmt.Errorf("failed to parse Yearn v2 ABI: %w", err)
+	}
+
+	callData, err := parsedYearnABI.Pack(method)
+	if err != nil {
+		return fmt.Errorf("failed to pack %s call: %w", method, err)
+	}
+
+	result, err := evmClient.CallContract(runtime, &evm.CallContractRequest{
+		Call: &evm.CallMsg{
+			To:   vault.Bytes(),
+			Data: callData,
+		},
+		BlockNumber: receipt.BlockNumber,
+	}).Await()
+	if err != nil {
+		return fmt.Errorf("failed to call %s on Yearn vault %s: %w", method, vault.Hex(), err)
+	}
+
+	if err := parsedYearnABI.UnpackIntoInterface(out, method, result.Data); err != nil {
+		return fmt.Errorf("failed to unpack %s: %w", method, err)
+	}
+	return nil
+}
+
+// YearnV2SharesToAssets converts Yearn v2 vault shares to its token with
+// pricePerShare at a block: shares × pricePerShare / 10^decimals
+func YearnV2SharesToAssets(runtime cre.Runtime, evmClient *evm.Client, vault common.Address, shares *big.Int, receipt *evm.Receipt) (common.Address, *big.Int, error) {
+	var token common.Address
+	if err := callYearnV2Vault(runtime, evmClient, vault, "token", &token, receipt); err != nil {
+		return common.Address{}, nil, err
+	}
+	pricePerShare, decimals := new(big.Int), new(big.Int)
+	if err := callYearnV2Vault(runtime, evmClient, vault, "pricePerShare", &pricePerShare, receipt); err != nil {
+		return common.Address{}, nil, err
+	}
+	if err := callYearnV2Vault(runtime, evmClient, vault, "decimals", &decimals, receipt); err != nil {
+		return common.Address{}, nil, err
+	}
+	if !decimals.IsUint64() || decimals.Uint64() > math.MaxUint8 {
+		return common.Address{}, nil, fmt.Errorf("Yearn vault %s: %w: %s", vault.Hex(), fixedpoint.ErrDecimalsOutOfRange, decimals)
+	}
+	vaultDecimals := uint8(decimals.Uint64())
+	if err := fixedpoint.CheckDecimals(vaultDecimals); err != nil {
+		return common.Address{}, nil, fmt.Errorf("Yearn vault %s: %w", vault.Hex(), err)
+	}
+	return token, fixedpoint.MulDiv(shares, pricePerShare, fixedpoint.Pow10(int(vaultDecimals)), fixedpoint.RoundDown), nil
+}
+
+// ResolveYearnV2Withdraw settles a Yearn v2 withdrawal from the vault's
+// Withdraw event, which gives the shares actually burned, resolving
+// type(uint256).max and partial withdrawals. The shares are converted with
+// pricePerShare in the withdrawal's block, and the credit is capped at the
+// amount the event reports paid out, so a withdrawal taking a loss is not
+// over-credited. A withdraw(uint256) without the event is settled as a
+// Velodrome gauge withdrawal if it is one; on another contract, such as WETH,
+// it is left to the fallback decoders. Yearn v3 withdrawals are
+// ERC-4626 and need no receipt.
+func ResolveYearnV2Withdraw(runtime cre.Runtime, evmClient *evm.Client, logger *slog.Logger, action *Action, calldata []byte, txHash []byte) error {
+	switch action.Selector {
+	case YearnV2WithdrawSelector, YearnV2WithdrawToSelector, YearnV2WithdrawMaxLossSelector:
+	default:
+		return nil
+	}
+
+	reply, err := evmClient.GetTransactionReceipt(runtime, &evm.GetTransactionReceiptRequest{Hash: txHash}).Await()
+	if err != nil {
+		return fmt.Errorf("failed to get transaction receipt: %w", err)
+	}
+	if reply.Receipt == nil {
+		return fmt.Errorf("transaction receipt not found")
+	}
+
+	for _, log := range reply.Receipt.Logs {
+		if common.BytesToAddress(log.Address) != action.Counterparty || len(log.Topics) != 2 || len(log.Data) < 64 ||
+			!bytes.Equal(log.Topics[0], yearnV2WithdrawSignature.Bytes()) {
+			continue
+		}
+		shares := new(big.Int).SetBytes(log.Data[:32])
+		paid := new(big.Int).SetBytes(log.Data[32:64])
+
+		token, amount, err := YearnV2SharesToAssets(runtime, evmClient, action.Counterparty, shares, reply.Receipt)
+		if err != nil {
+			return err
+		}
+		if paid.Cmp(amount) < 0 {
+			amount = paid
+		}
+
+		action.AssetsIn = []AssetAmount{{Token: token, Amount: amount}}
+		logger.Info("Yearn v2 withdrawal settled", "vault", action.Counterparty.Hex(), "shares", shares.String(),
+			"token", token.Hex(), "amount", amount.String(), "paid", paid.String())
+		return nil
+	}
+
+	// Velodrome and Aerodrome gauges share withdraw(uint256)
+	if action.Selector == YearnV2WithdrawSelector {
+		return ResolveVelodromeGaugeWithdraw(runtime, evmClient, logger, action, reply.Receipt)
+	}
+	return fmt.Errorf("%w: no Yearn v2 Withdraw from %s in receipt", ErrUnknownSelector, action.Counterparty.Hex())
+}
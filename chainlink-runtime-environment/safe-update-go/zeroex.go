@@ -0,0 +1,61 @@
+//go:build wasip1
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/smartcontractkit/cre-sdk-go/capabilities/blockchain/evm"
+	"github.com/smartcontractkit/cre-sdk-go/cre"
+)
+
+// TransformedERC20(address indexed taker, address inputToken, address outputToken, uint256 inputTokenAmount, uint256 outputTokenAmount),
+// emitted by the ExchangeProxy
+var transformedERC20Signature = crypto.Keccak256Hash([]byte("TransformedERC20(address,address,address,uint256,uint256)"))
+
+// ResolveZeroExTransform settles a 0x transformERC20 swap from the
+// TransformedERC20 event the proxy emitted. An input amount of the maximum
+// uint256 sells the whole balance, so both amounts are taken from the event.
+// Native ETH is paid without transfers the Safe's allowances track, so swaps
+// from or to it are not settled.
+func ResolveZeroExTransform(runtime cre.Runtime, evmClient *evm.Client, logger *slog.Logger, action *Action, calldata []byte, txHash []byte) error {
+	sold, bought := action.AssetsOut[0], action.AssetsIn[0]
+	if isNativeToken(sold.Token) || isNativeToken(bought.Token) {
+		return fmt.Errorf("0x swap of native ETH cannot be settled from its event")
+	}
+
+	reply, err := evmClient.GetTransactionReceipt(runtime, &evm.GetTransactionReceiptRequest{Hash: txHash}).Await()
+	if err != nil {
+		return fmt.Errorf("failed to get transaction receipt: %w", err)
+	}
+	if reply.Receipt == nil {
+		return fmt.Errorf("transaction receipt not found")
+	}
+
+	for _, log := range reply.Receipt.Logs {
+		if len(log.Topics) < 2 || len(log.Data) < 128 || !bytes.Equal(log.Topics[0], transformedERC20Signature.Bytes()) ||
+			common.BytesToAddress(log.Address) != action.Counterparty {
+			continue
+		}
+		if common.BytesToAddress(log.Data[:32]) != sold.Token || common.BytesToAddress(log.Data[32:64]) != bought.Token {
+			continue
+		}
+		spent := new(big.Int).SetBytes(log.Data[64:96])
+		returned := new(big.Int).SetBytes(log.Data[96:128])
+		if returned.Cmp(bought.Amount) < 0 {
+			return fmt.Errorf("0x swap returned %s, below its minimum %s", returned, bought.Amount)
+		}
+
+		action.AssetsOut[0].Amount = spent
+		action.AssetsIn[0].Amount = returned
+		logger.Info("0x swap settled", "taker", common.BytesToAddress(log.Topics[1]).Hex(), "sold", sold.Token.Hex(), "spent", spent.String(),
+			"bought", bought.Token.Hex(), "returned", returned.String())
+		return nil
+	}
+	return fmt.Errorf("no TransformedERC20 event of %s in receipt", action.Counterparty.Hex())
+}